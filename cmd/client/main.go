@@ -12,33 +12,76 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		os.Exit(runDoctor(os.Args[2:]))
+	}
+
 	// Check for --tcp flag or no arguments (interactive mode)
 	tcpMode := flag.Bool("tcp", false, "Use new TCP tunnel client with interactive setup")
 
 	// Legacy WebSocket client flags
 	serverAddr := flag.String("server", "link.digit.zone", "Tunnel server address")
 	subdomain := flag.String("subdomain", "", "Subdomain to register (optional, random if not specified)")
+	subdomainPrefix := flag.String("subdomain-prefix", "", "Prefix of the random subdomain when --subdomain is not specified (e.g., feature-)")
+	appID := flag.String("app", "", "Application ID to register for; the subdomain comes from the application (optional)")
 	port := flag.Int("port", 0, "Local port to forward to")
-	localAddr := flag.String("a", "localhost", "Local address to forward to (e.g., localhost, 127.0.0.1, 192.168.1.100)")
+	localAddr := flag.String("a", "localhost", "Local address to forward to (e.g., localhost, 127.0.0.1, 192.168.1.100, unix:/path/to.sock)")
 	localHTTPS := flag.Bool("https", false, "Use HTTPS for local forwarding (default: HTTP)")
 	token := flag.String("token", "", "Authentication token (required)")
 	secret := flag.String("secret", "", "Server secret (deprecated, use --token)")
 	timeout := flag.Duration("timeout", 5*time.Minute, "Request timeout for forwarding (e.g., 5m, 10m, 1h)")
 	insecure := flag.Bool("insecure", false, "Skip TLS verification (for local testing)")
+	showQR := flag.Bool("qr", false, "Show a QR code of the public URL once connected")
+	idleTimeout := flag.Duration("idle-timeout", 0, "Close the tunnel and exit after no requests for this long (e.g., 30m; 0 disables)")
+	retries := flag.Int("retry", 0, "Retry failed local requests this many times, e.g. while the local service restarts (0 disables)")
+	retryBackoff := flag.Duration("retry-backoff", client.DefaultRetryBackoff, "Wait before the first local retry, doubled for each further retry")
+	retryOn := flag.String("retry-on", client.DefaultRetryOn, "Comma-separated retry conditions: refused, reset, or a status code like 502 (resets and statuses only retry idempotent methods)")
+	waitLocal := flag.Duration("wait-local", 0, "Wait up to this long for the local service to accept connections before registering (e.g., 30s; 0 disables)")
+	degraded := flag.Bool("degraded", false, "When --wait-local times out, register the tunnel degraded (visitors get 503) until the local service is up")
+	metricsAddr := flag.String("metrics-addr", "", "Serve the client's status as JSON (/status) and Prometheus metrics (/metrics) on this local address (e.g., :9090; off by default)")
+	noUpdateCheck := flag.Bool("no-update-check", false, "Don't check the server (or --update-url) for a newer client version")
+	updateURL := flag.String("update-url", "", "URL advertising the latest client version, answering like the server's /api/health (default: the server)")
 	flag.Parse()
 
+	retry, err := client.ParseRetryOn(*retryOn)
+	if err != nil {
+		fmt.Printf("Error: --retry-on: %v\n", err)
+		os.Exit(1)
+	}
+	retry.Retries = *retries
+	retry.Backoff = *retryBackoff
+	health := client.HealthCheck{Wait: *waitLocal, Degraded: *degraded}
+
+	// Update check, nil when disabled; the runners fill in the server
+	var updates *client.UpdateCheck
+	if !*noUpdateCheck {
+		updates = &client.UpdateCheck{URL: *updateURL}
+	}
+
+	var metrics *client.Metrics
+	if *metricsAddr != "" {
+		metrics = client.NewMetrics()
+		server, err := client.ServeMetrics(*metricsAddr, metrics)
+		if err != nil {
+			fmt.Printf("Error: --metrics-addr: %v\n", err)
+			os.Exit(1)
+		}
+		defer server.Close()
+	}
+
 	// Determine mode: TCP if --tcp flag, no args, or saved config exists
-	useTCP := *tcpMode || (*port == 0 && *token == "" && *secret == "")
+	unixSocket := client.IsUnixSocketAddr(*localAddr)
+	useTCP := *tcpMode || (*port == 0 && !unixSocket && *token == "" && *secret == "")
 
 	if useTCP {
-		runTCPClient(*insecure, *timeout)
+		runTCPClient(*localAddr, *insecure, *timeout, *showQR, *idleTimeout, retry, health, metrics, updates)
 	} else {
-		runWebSocketClient(*serverAddr, *subdomain, *port, *localAddr, *localHTTPS, *token, *secret, *timeout, *insecure)
+		runWebSocketClient(*serverAddr, *subdomain, *subdomainPrefix, *appID, *port, *localAddr, *localHTTPS, *token, *secret, *timeout, *insecure, *showQR, *idleTimeout, retry, health, metrics, updates)
 	}
 }
 
 // runTCPClient runs the new TCP tunnel client with interactive setup
-func runTCPClient(insecure bool, timeout time.Duration) {
+func runTCPClient(localAddr string, insecure bool, timeout time.Duration, showQR bool, idleTimeout time.Duration, retry client.RetryPolicy, health client.HealthCheck, metrics *client.Metrics, updates *client.UpdateCheck) {
 	// Create setup model
 	setupModel := client.NewSetupModel()
 
@@ -49,9 +92,9 @@ func runTCPClient(insecure bool, timeout time.Duration) {
 
 	// Variables to capture setup results
 	var (
-		server   string
-		token    string
-		forwards []tunnel.ForwardConfig
+		server      string
+		token       string
+		forwards    []tunnel.ForwardConfig
 		useInsecure bool
 	)
 
@@ -81,16 +124,27 @@ func runTCPClient(insecure bool, timeout time.Duration) {
 		Server:         server,
 		Token:          token,
 		Forwards:       forwards,
+		LocalAddr:      localAddr,
 		Insecure:       useInsecure,
 		MaxRetries:     -1, // Infinite retries
 		InitialBackoff: 1 * time.Second,
 		MaxBackoff:     30 * time.Second,
 		Timeout:        timeout,
+		IdleTimeout:    idleTimeout,
+		LocalRetry:     retry,
+		LocalHealth:    health,
 	})
 
 	// Create model for connected view
 	model := client.NewTCPModel()
+	model.SetShowQR(showQR)
+	model.SetIdleTimeout(idleTimeout)
+	model.SetMetrics(metrics)
 	tcpClient.SetModel(model)
+	if updates != nil {
+		updates.Server, updates.Insecure = server, useInsecure
+		go checkForUpdate(model, *updates)
+	}
 
 	// Start client in goroutine
 	go func() {
@@ -110,12 +164,27 @@ func runTCPClient(insecure bool, timeout time.Duration) {
 
 	// Cleanup
 	tcpClient.Close()
+
+	if model.IdleExpired() {
+		fmt.Printf("Tunnel closed after %s of inactivity\n", idleTimeout)
+	}
+	if notice := model.UpdateNotice(); notice != "" {
+		fmt.Println(notice)
+	}
 }
 
 // runWebSocketClient runs the legacy WebSocket tunnel client
-func runWebSocketClient(serverAddr, subdomain string, port int, localAddr string, localHTTPS bool, token, secret string, timeout time.Duration, insecure bool) {
-	// Validate required flags
-	if port == 0 {
+func runWebSocketClient(serverAddr, subdomain, subdomainPrefix, appID string, port int, localAddr string, localHTTPS bool, token, secret string, timeout time.Duration, insecure bool, showQR bool, idleTimeout time.Duration, retry client.RetryPolicy, health client.HealthCheck, metrics *client.Metrics, updates *client.UpdateCheck) {
+	// Validate required flags (a Unix socket replaces the port)
+	if client.IsUnixSocketAddr(localAddr) {
+		if client.UnixSocketPath(localAddr) == "" {
+			fmt.Println("Error: -a unix: requires a socket path (e.g., -a unix:/var/run/app.sock)")
+			os.Exit(1)
+		}
+		if port != 0 {
+			fmt.Println("Warning: --port is ignored when forwarding to a Unix socket")
+		}
+	} else if port == 0 {
 		fmt.Println("Error: --port is required for legacy WebSocket mode")
 		fmt.Println()
 		fmt.Println("For the new interactive TCP client, run without arguments:")
@@ -158,22 +227,33 @@ func runWebSocketClient(serverAddr, subdomain string, port int, localAddr string
 
 	// Create client
 	c := client.New(client.Config{
-		Server:         serverAddr,
-		Subdomain:      subdomain,
-		Token:          authToken,
-		Secret:         secret, // Legacy support
-		LocalPort:      port,
-		LocalAddr:      localAddr,
-		LocalHTTPS:     localHTTPS,
-		Timeout:        timeout,
-		MaxRetries:     -1, // Infinite retries
-		InitialBackoff: 1 * time.Second,
-		MaxBackoff:     30 * time.Second,
-		Insecure:       insecure,
+		Server:          serverAddr,
+		Subdomain:       subdomain,
+		SubdomainPrefix: subdomainPrefix,
+		AppID:           appID,
+		Token:           authToken,
+		Secret:          secret, // Legacy support
+		LocalPort:       port,
+		LocalAddr:       localAddr,
+		LocalHTTPS:      localHTTPS,
+		Timeout:         timeout,
+		MaxRetries:      -1, // Infinite retries
+		InitialBackoff:  1 * time.Second,
+		MaxBackoff:      30 * time.Second,
+		Insecure:        insecure,
+		IdleTimeout:     idleTimeout,
+		LocalRetry:      retry,
+		LocalHealth:     health,
 	})
 
 	// Get the model from the client
 	model := c.Model()
+	model.SetShowQR(showQR)
+	model.SetMetrics(metrics)
+	if updates != nil {
+		updates.Server, updates.Insecure = serverAddr, insecure
+		go checkForUpdate(model, *updates)
+	}
 
 	// Start client in goroutine
 	go func() {
@@ -194,4 +274,74 @@ func runWebSocketClient(serverAddr, subdomain string, port int, localAddr string
 
 	// Cleanup on exit
 	c.Close()
+
+	if model.IdleExpired() {
+		fmt.Printf("Tunnel closed after %s of inactivity\n", idleTimeout)
+	}
+	if notice := model.UpdateNotice(); notice != "" {
+		fmt.Println(notice)
+	}
+}
+
+// checkForUpdate shows a notice in the TUI when a newer client is available.
+// It only notifies; a failed check is ignored so it never gets in the way.
+func checkForUpdate(model *client.Model, check client.UpdateCheck) {
+	notice, err := client.CheckForUpdate(check)
+	if err != nil || notice == nil {
+		return
+	}
+	model.SendUpdate(*notice)
+}
+
+// runDoctor runs the `digit-link doctor` diagnostics and returns the process exit code.
+// Settings missing from the flags are taken from the saved TCP client config.
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	serverAddr := fs.String("server", "", "Tunnel server address (default: saved config or link.digit.zone)")
+	port := fs.Int("port", 0, "Local port to check (default: the saved forwards)")
+	localAddr := fs.String("a", "localhost", "Local address to check (e.g., localhost, 127.0.0.1, unix:/path/to.sock)")
+	token := fs.String("token", "", "Authentication token (default: DIGIT_LINK_TOKEN or saved config)")
+	insecure := fs.Bool("insecure", false, "Server uses plain HTTP (for local testing)")
+	fs.Parse(args)
+
+	cfg := client.DoctorConfig{
+		Server:    *serverAddr,
+		Token:     *token,
+		LocalAddr: *localAddr,
+		Insecure:  *insecure,
+	}
+	if *port != 0 {
+		cfg.LocalPorts = []int{*port}
+	}
+	if cfg.Token == "" {
+		cfg.Token = os.Getenv("DIGIT_LINK_TOKEN")
+	}
+
+	if saved, err := client.LoadConfig(); err != nil {
+		fmt.Printf("Warning: Failed to load saved config: %v\n", err)
+	} else if saved != nil {
+		if cfg.Server == "" {
+			cfg.Server = saved.Server
+			cfg.Insecure = cfg.Insecure || saved.Insecure
+		}
+		if cfg.Token == "" {
+			cfg.Token = saved.Token
+		}
+		if len(cfg.LocalPorts) == 0 && !client.IsUnixSocketAddr(cfg.LocalAddr) {
+			for _, fwd := range saved.Forwards {
+				cfg.LocalPorts = append(cfg.LocalPorts, fwd.LocalPort)
+				for _, route := range fwd.Routes {
+					cfg.LocalPorts = append(cfg.LocalPorts, route.LocalPort)
+				}
+			}
+		}
+	}
+	if cfg.Server == "" {
+		cfg.Server = "link.digit.zone"
+	}
+
+	if !client.PrintDoctorReport(os.Stdout, client.RunDoctor(cfg)) {
+		return 1
+	}
+	return 0
 }
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/niekvdm/digit-link/internal/auth"
 	"github.com/niekvdm/digit-link/internal/db"
@@ -25,7 +31,7 @@ func main() {
 	dbPath := db.GetDBPath()
 
 	// Initialize database
-	database, err := db.New(dbPath)
+	database, err := db.NewWithRetry(dbPath, db.GetRetryConfig())
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
@@ -71,7 +77,23 @@ func main() {
 		log.Printf("Warning: Failed to start tunnel listener: %v", err)
 	}
 
-	log.Fatal(srv.Run(port))
+	go func() {
+		if err := srv.Run(port); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	// Wait for a termination signal, then drain connections
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	<-sig
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Shutdown error: %v", err)
+	}
+	log.Println("Server stopped")
 }
 
 // createInitialAdmin creates the initial admin account and prints the token
@@ -11,7 +11,9 @@ import type {
   SetPolicyRequest,
   DeleteResponse,
   RateLimitResponse,
-  SetRateLimitRequest
+  SetRateLimitRequest,
+  StaticResponse,
+  StaticResponsesResponse
 } from '@/types/api'
 
 export function useApplications() {
@@ -100,6 +102,19 @@ export function useApplications() {
     await api.del(getEndpoint(`/${appId}/rate-limit`))
   }
 
+  // Static responses are managed in the org portal only
+  async function getStaticResponses(appId: string) {
+    return api.get<StaticResponsesResponse>(`/org/applications/${appId}/static-responses`)
+  }
+
+  async function setStaticResponse(appId: string, response: StaticResponse) {
+    await api.put(`/org/applications/${appId}/static-responses`, response)
+  }
+
+  async function deleteStaticResponse(appId: string, path: string) {
+    await api.del(`/org/applications/${appId}/static-responses?path=${encodeURIComponent(path)}`)
+  }
+
   return {
     applications: readonly(applications),
     loading: readonly(loading),
@@ -115,6 +130,9 @@ export function useApplications() {
     getTunnels,
     getRateLimit,
     setRateLimit,
-    resetRateLimit
+    resetRateLimit,
+    getStaticResponses,
+    setStaticResponse,
+    deleteStaticResponse
   }
 }
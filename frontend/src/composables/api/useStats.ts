@@ -1,6 +1,6 @@
 import { ref, readonly } from 'vue'
 import { useApi } from '@/composables/useApi'
-import type { Stats } from '@/types/api'
+import type { MetricsTimeseriesResponse, Stats, TimeseriesMetric } from '@/types/api'
 
 export function useStats() {
   const api = useApi()
@@ -23,10 +23,31 @@ export function useStats() {
     }
   }
 
+  async function getTimeseries(
+    metric: TimeseriesMetric,
+    from: string,
+    to: string,
+    bucket: 'minute' | 'hour' | 'day' = 'hour'
+  ): Promise<MetricsTimeseriesResponse | null> {
+    loading.value = true
+    error.value = null
+
+    try {
+      const params = new URLSearchParams({ metric, from, to, bucket })
+      return await api.get<MetricsTimeseriesResponse>(`/admin/metrics/timeseries?${params}`)
+    } catch (e) {
+      error.value = e instanceof Error ? e.message : 'Failed to load metrics'
+      return null
+    } finally {
+      loading.value = false
+    }
+  }
+
   return {
     stats: readonly(stats),
     loading: readonly(loading),
     error: readonly(error),
-    fetchStats
+    fetchStats,
+    getTimeseries
   }
 }
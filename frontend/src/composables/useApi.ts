@@ -28,6 +28,11 @@ export function useApi() {
       }
     }
 
+    // Ask for JSON errors (the server negotiates the error format from Accept)
+    if (!headers.has('Accept')) {
+      headers.set('Accept', 'application/json')
+    }
+
     // Add content type for JSON bodies
     if (fetchOptions.body && typeof fetchOptions.body === 'string') {
       if (!headers.has('Content-Type')) {
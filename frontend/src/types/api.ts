@@ -11,6 +11,19 @@ export interface Stats {
   totalConnections?: number
 }
 
+export type TimeseriesMetric = 'requests' | 'errors' | 'tunnels'
+
+export interface MetricsTimeseriesResponse {
+  metric: TimeseriesMetric
+  from: string
+  to: string
+  bucket: 'minute' | 'hour' | 'day'
+  points: Array<{
+    bucketStart: string
+    value: number
+  }>
+}
+
 export interface Tunnel {
   id: string
   subdomain: string
@@ -23,10 +36,13 @@ export interface TunnelsResponse {
   active: Tunnel[]
 }
 
+export type AdminRole = 'full' | 'read_only'
+
 export interface Account {
   id: string
   username: string
   isAdmin: boolean
+  adminRole?: AdminRole
   isOrgAdmin?: boolean
   active: boolean
   createdAt: string
@@ -35,6 +51,10 @@ export interface Account {
   orgName?: string
   hasPassword?: boolean
   totpEnabled?: boolean
+  tokenExpiresAt?: string
+  tokenExpiringSoon?: boolean
+  tokenExpired?: boolean
+  defaultSubdomain?: string
 }
 
 export interface AccountsResponse {
@@ -45,7 +65,9 @@ export interface CreateAccountRequest {
   username: string
   password?: string
   isAdmin: boolean
+  adminRole?: AdminRole
   orgId?: string
+  tokenExpiresIn?: number // days
 }
 
 export interface CreateAccountResponse {
@@ -183,7 +205,14 @@ export interface CreateOrganizationResponse {
 // ============================================
 
 export type AuthMode = 'inherit' | 'disabled' | 'custom'
-export type AuthType = 'basic' | 'api_key' | 'oidc'
+export type AuthType = 'basic' | 'api_key' | 'oidc' | 'webhook'
+export type IdentityHeader = 'user' | 'email' | 'method' | 'groups'
+export type HostHeaderMode = 'preserve' | 'local' | 'custom'
+
+export interface HostHeaderConfig {
+  mode?: HostHeaderMode
+  value?: string
+}
 
 export interface TunnelStats {
   totalConnections: number
@@ -200,13 +229,44 @@ export interface Application {
   name: string
   authMode: AuthMode
   authType?: AuthType
+  preserveHost?: boolean
+  hostHeader?: HostHeaderConfig
+  identityHeaders?: IdentityHeader[]
+  forwardChunked?: boolean
+  http2?: boolean
+  coalesce?: boolean
+  streamingMode?: boolean
+  htmlBaseHref?: string
+  htmlRewriteOrigin?: string
+  forceHttps?: ForceHttpsMode
+  staticResponses?: StaticResponse[]
   createdAt: string
+  releasedAt?: string
+  releasedSubdomain?: string
   hasPolicy?: boolean
   isActive?: boolean
   activeTunnelCount?: number
   stats?: TunnelStats
 }
 
+// HTTPS enforcement of an application; '' uses the server's force_https setting
+export type ForceHttpsMode = '' | 'off' | 'redirect' | 'reject'
+
+// Canned response the server answers a path of an application with
+export interface StaticResponse {
+  path: string
+  status?: number
+  headers?: Record<string, string>
+  body?: string
+  public?: boolean
+}
+
+export interface StaticResponsesResponse {
+  responses: StaticResponse[]
+  maxResponses: number
+  maxBytes: number
+}
+
 export interface ApplicationsResponse {
   applications: Application[]
 }
@@ -228,6 +288,16 @@ export interface UpdateApplicationRequest {
   authMode: AuthMode
   authType?: AuthType
   subdomain?: string
+  preserveHost?: boolean
+  hostHeader?: HostHeaderConfig
+  identityHeaders?: IdentityHeader[]
+  forwardChunked?: boolean
+  http2?: boolean
+  coalesce?: boolean
+  streamingMode?: boolean
+  htmlBaseHref?: string
+  htmlRewriteOrigin?: string
+  forceHttps?: ForceHttpsMode
 }
 
 // ============================================
@@ -243,6 +313,8 @@ export interface OrgAuthPolicy {
   oidcScopes?: string[]
   oidcAllowedDomains?: string[]
   oidcRequiredClaims?: Record<string, string>
+  webhookUrl?: string
+  webhookHeaders?: string[]
 }
 
 export interface AppAuthPolicy {
@@ -254,6 +326,8 @@ export interface AppAuthPolicy {
   oidcScopes?: string[]
   oidcAllowedDomains?: string[]
   oidcRequiredClaims?: Record<string, string>
+  webhookUrl?: string
+  webhookHeaders?: string[]
 }
 
 export interface PolicyResponse {
@@ -272,6 +346,8 @@ export interface SetPolicyRequest {
   oidcScopes?: string[]
   oidcAllowedDomains?: string[]
   oidcRequiredClaims?: Record<string, string>
+  webhookUrl?: string
+  webhookHeaders?: string[]
 }
 
 // ============================================
@@ -381,6 +457,10 @@ export interface Plan {
   requestsMonthly?: number
   overageAllowedPercent: number
   gracePeriodHours: number
+  maxBytesPerSecond?: number
+  maxForwards?: number
+  maxConcurrentRequests?: number
+  releaseInactiveDays?: number
   createdAt: string
   updatedAt: string
 }
@@ -397,6 +477,10 @@ export interface CreatePlanRequest {
   requestsMonthly?: number
   overageAllowedPercent?: number
   gracePeriodHours?: number
+  maxBytesPerSecond?: number
+  maxForwards?: number
+  maxConcurrentRequests?: number
+  releaseInactiveDays?: number
 }
 
 export interface PlanResponse {
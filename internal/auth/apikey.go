@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
@@ -101,6 +103,9 @@ func (h *APIKeyAuthHandler) Authenticate(w http.ResponseWriter, r *http.Request,
 
 // Challenge sends an API key auth challenge to the client
 func (h *APIKeyAuthHandler) Challenge(w http.ResponseWriter, r *http.Request, p *policy.EffectivePolicy, ctx *policy.AuthContext) {
+	if RedirectWithoutAPIKey(w, r, p) {
+		return
+	}
 	w.Header().Set("WWW-Authenticate", `Bearer realm="digit-link", error="invalid_token"`)
 	http.Error(w, "API key required. Provide via 'Authorization: Bearer <key>', 'X-API-Key: <key>', or 'X-Tunnel-API-Key: <key>' header", http.StatusUnauthorized)
 }
@@ -201,6 +206,7 @@ func RotateAPIKey(database *db.DB, oldKeyID string, revokeOld bool) (newRawKey s
 	if err != nil {
 		return "", nil, err
 	}
+	newKey.RateLimitTier = oldKey.RateLimitTier
 
 	err = database.CreateAPIKey(newKey)
 	if err != nil {
@@ -244,3 +250,36 @@ func GetAPIKeyInfo(database *db.DB, keyID string) (*db.APIKey, error) {
 func CountAPIKeysForOrg(database *db.DB, orgID string) (int, error) {
 	return database.CountAPIKeysByOrg(orgID)
 }
+
+// RedirectWithoutAPIKey sends browsers (Accept: text/html) to the policy's API key
+// redirect URL and reports whether it did. Programmatic clients keep getting a 401.
+func RedirectWithoutAPIKey(w http.ResponseWriter, r *http.Request, p *policy.EffectivePolicy) bool {
+	if p == nil || p.APIKey == nil || p.APIKey.RedirectURL == "" {
+		return false
+	}
+	if !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		return false
+	}
+	w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate")
+	w.Header().Set("Pragma", "no-cache")
+	http.Redirect(w, r, p.APIKey.RedirectURL, http.StatusFound)
+	return true
+}
+
+// maxAPIKeyRedirectURLLength bounds the API key redirect URL stored on a policy
+const maxAPIKeyRedirectURLLength = 2048
+
+// ValidateAPIKeyRedirectURL checks the URL browsers without an API key are sent to
+func ValidateAPIKeyRedirectURL(redirectURL string) error {
+	if redirectURL == "" {
+		return nil
+	}
+	if len(redirectURL) > maxAPIKeyRedirectURLLength {
+		return fmt.Errorf("API key redirect URL must be at most %d characters", maxAPIKeyRedirectURLLength)
+	}
+	u, err := url.Parse(redirectURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.User != nil {
+		return fmt.Errorf("API key redirect URL must be an absolute http(s) URL")
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package auth
 import (
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/niekvdm/digit-link/internal/db"
 	"github.com/niekvdm/digit-link/internal/policy"
@@ -10,12 +11,13 @@ import (
 
 // BasicAuthHandler handles Basic authentication
 type BasicAuthHandler struct {
-	db *db.DB
+	db           *db.DB
+	failureDelay FailureDelay
 }
 
 // NewBasicAuthHandler creates a new Basic auth handler
 func NewBasicAuthHandler(database *db.DB) *BasicAuthHandler {
-	return &BasicAuthHandler{db: database}
+	return &BasicAuthHandler{db: database, failureDelay: GetFailureDelay()}
 }
 
 // Authenticate implements the AuthHandler interface for Basic auth
@@ -26,6 +28,8 @@ func (h *BasicAuthHandler) Authenticate(w http.ResponseWriter, r *http.Request,
 		return policy.Challenge("basic auth required")
 	}
 
+	start := time.Now()
+
 	// Parse credentials
 	username, password, ok := r.BasicAuth()
 	if !ok {
@@ -50,6 +54,7 @@ func (h *BasicAuthHandler) Authenticate(w http.ResponseWriter, r *http.Request,
 			}
 			h.db.LogAuthFailure(orgID, appID, "basic", GetClientIPFromRequest(r), "invalid_password")
 		}
+		h.failureDelay.Wait(r.Context(), start)
 		return policy.Challenge("invalid credentials")
 	}
 
@@ -66,6 +71,7 @@ func (h *BasicAuthHandler) Authenticate(w http.ResponseWriter, r *http.Request,
 				}
 				h.db.LogAuthFailure(orgID, appID, "basic", GetClientIPFromRequest(r), "invalid_username")
 			}
+			h.failureDelay.Wait(r.Context(), start)
 			return policy.Challenge("invalid credentials")
 		}
 	}
@@ -2,8 +2,11 @@ package auth
 
 import (
 	"html/template"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/niekvdm/digit-link/internal/db"
@@ -29,23 +32,26 @@ type LoginPageData struct {
 	LoginURL  string
 	Username  string
 	Error     string
+	Brand     Branding
 }
 
 // BasicAuthLoginHandler handles the Basic Auth login flow
 // It serves a custom login page and handles form submissions
 type BasicAuthLoginHandler struct {
-	db       *db.DB
-	scheme   string // "http" or "https" for cookie security
-	template *template.Template
+	db           *db.DB
+	scheme       string // "http" or "https" for cookie security
+	template     *template.Template
+	failureDelay FailureDelay
 }
 
 // NewBasicAuthLoginHandler creates a new BasicAuthLoginHandler
 func NewBasicAuthLoginHandler(database *db.DB, scheme string) *BasicAuthLoginHandler {
 	tmpl := template.Must(template.New("login").Parse(BasicLoginTemplate))
 	return &BasicAuthLoginHandler{
-		db:       database,
-		scheme:   scheme,
-		template: tmpl,
+		db:           database,
+		scheme:       scheme,
+		template:     tmpl,
+		failureDelay: GetFailureDelay(),
 	}
 }
 
@@ -54,6 +60,12 @@ type LoginConfig struct {
 	Policy    *policy.EffectivePolicy
 	AuthCtx   *policy.AuthContext
 	ReturnURL string
+	Branding  Branding     // Look of the login page; zero value uses the defaults
+	Cookie    CookieConfig // Session cookie attributes; zero value is a host-only Lax cookie
+
+	// ReturnHosts are other hosts the login may redirect back to; the
+	// requested host always is allowed
+	ReturnHosts []string
 }
 
 // HandleLogin handles the login endpoint
@@ -72,7 +84,7 @@ func (h *BasicAuthLoginHandler) HandleLogin(w http.ResponseWriter, r *http.Reque
 
 	switch r.Method {
 	case http.MethodGet:
-		h.renderLoginPage(w, subdomain, config.ReturnURL, "", "")
+		h.renderLoginPage(w, config, subdomain, config.ReturnURL, "", "")
 	case http.MethodPost:
 		h.handleFormSubmit(w, r, config)
 	default:
@@ -81,7 +93,7 @@ func (h *BasicAuthLoginHandler) HandleLogin(w http.ResponseWriter, r *http.Reque
 }
 
 // renderLoginPage renders the login HTML page
-func (h *BasicAuthLoginHandler) renderLoginPage(w http.ResponseWriter, subdomain, returnURL, username, errorMsg string) {
+func (h *BasicAuthLoginHandler) renderLoginPage(w http.ResponseWriter, config *LoginConfig, subdomain, returnURL, username, errorMsg string) {
 	realm := "digit-link"
 	if subdomain != "" {
 		realm = subdomain + ".digit-link"
@@ -94,6 +106,10 @@ func (h *BasicAuthLoginHandler) renderLoginPage(w http.ResponseWriter, subdomain
 		LoginURL:  BasicAuthLoginPath,
 		Username:  username,
 		Error:     errorMsg,
+		Brand:     config.Branding,
+	}
+	if data.Brand == (Branding{}) {
+		data.Brand = DefaultBranding()
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -106,9 +122,11 @@ func (h *BasicAuthLoginHandler) renderLoginPage(w http.ResponseWriter, subdomain
 
 // handleFormSubmit handles the login form POST submission
 func (h *BasicAuthLoginHandler) handleFormSubmit(w http.ResponseWriter, r *http.Request, config *LoginConfig) {
+	start := time.Now()
+
 	// Parse form data
 	if err := r.ParseForm(); err != nil {
-		h.renderLoginPage(w, config.AuthCtx.Subdomain, config.ReturnURL, "", "Invalid form data")
+		h.renderLoginPage(w, config, config.AuthCtx.Subdomain, config.ReturnURL, "", "Invalid form data")
 		return
 	}
 
@@ -120,20 +138,22 @@ func (h *BasicAuthLoginHandler) handleFormSubmit(w http.ResponseWriter, r *http.
 	if returnURL == "" {
 		returnURL = config.ReturnURL
 	}
+	returnURL = SafeReturnURL(returnURL, r.Host, config.ReturnHosts)
 	if subdomain == "" && config.AuthCtx != nil {
 		subdomain = config.AuthCtx.Subdomain
 	}
 
 	// Validate required fields
 	if username == "" || password == "" {
-		h.renderLoginPage(w, subdomain, returnURL, username, "Username and password are required")
+		h.renderLoginPage(w, config, subdomain, returnURL, username, "Username and password are required")
 		return
 	}
 
 	// Validate password
 	if !VerifyPassword(password, config.Policy.Basic.PassHash) {
 		h.logFailure(config.AuthCtx, r, "invalid_password")
-		h.renderLoginPage(w, subdomain, returnURL, username, "Invalid username or password")
+		h.failureDelay.Wait(r.Context(), start)
+		h.renderLoginPage(w, config, subdomain, returnURL, username, "Invalid username or password")
 		return
 	}
 
@@ -141,7 +161,8 @@ func (h *BasicAuthLoginHandler) handleFormSubmit(w http.ResponseWriter, r *http.
 	if config.Policy.Basic.UserHash != "" {
 		if !VerifyPassword(username, config.Policy.Basic.UserHash) {
 			h.logFailure(config.AuthCtx, r, "invalid_username")
-			h.renderLoginPage(w, subdomain, returnURL, username, "Invalid username or password")
+			h.failureDelay.Wait(r.Context(), start)
+			h.renderLoginPage(w, config, subdomain, returnURL, username, "Invalid username or password")
 			return
 		}
 	}
@@ -149,12 +170,12 @@ func (h *BasicAuthLoginHandler) handleFormSubmit(w http.ResponseWriter, r *http.
 	// Credentials valid - create session
 	sessionID, err := h.createSession(config.AuthCtx, username, config.Policy.Basic.SessionDuration)
 	if err != nil {
-		h.renderLoginPage(w, subdomain, returnURL, username, "Failed to create session")
+		h.renderLoginPage(w, config, subdomain, returnURL, username, "Failed to create session")
 		return
 	}
 
 	// Set session cookie
-	h.setSessionCookie(w, sessionID, config.Policy.Basic.SessionDuration)
+	h.setSessionCookie(w, sessionID, config.Policy.Basic.SessionDuration, config.Cookie)
 
 	// Log success
 	h.logSuccess(config.AuthCtx, r, username)
@@ -198,7 +219,7 @@ func (h *BasicAuthLoginHandler) createSession(ctx *policy.AuthContext, username
 }
 
 // setSessionCookie sets the session cookie on the response
-func (h *BasicAuthLoginHandler) setSessionCookie(w http.ResponseWriter, sessionID string, duration time.Duration) {
+func (h *BasicAuthLoginHandler) setSessionCookie(w http.ResponseWriter, sessionID string, duration time.Duration, cookie CookieConfig) {
 	if sessionID == "" {
 		return
 	}
@@ -207,15 +228,14 @@ func (h *BasicAuthLoginHandler) setSessionCookie(w http.ResponseWriter, sessionI
 		duration = DefaultBasicSessionDuration
 	}
 
-	http.SetCookie(w, &http.Cookie{
+	http.SetCookie(w, cookie.Apply(&http.Cookie{
 		Name:     BasicAuthSessionCookie,
 		Value:    sessionID,
 		Path:     "/",
 		MaxAge:   int(duration.Seconds()),
 		HttpOnly: true,
 		Secure:   h.scheme == "https",
-		SameSite: http.SameSiteLaxMode,
-	})
+	}))
 }
 
 // logFailure logs a failed authentication attempt
@@ -264,6 +284,56 @@ func (h *BasicAuthLoginHandler) ValidateSession(r *http.Request, appID, orgID *s
 	return h.db.ValidateSessionForApp(cookie.Value, appID, orgID)
 }
 
+// GetLoginReturnHosts returns the comma-separated LOGIN_RETURN_HOSTS, hosts
+// besides the requested one that logins may redirect back to
+func GetLoginReturnHosts() []string {
+	var hosts []string
+	for _, host := range strings.Split(os.Getenv("LOGIN_RETURN_HOSTS"), ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// SafeReturnURL returns the URL to send a visitor back to after logging in,
+// or "" when it would leave the application: only paths and absolute http(s)
+// URLs for the requested host or one of the allowed hosts are kept, so the
+// login page cannot be used as an open redirect.
+func SafeReturnURL(returnURL, host string, allowed []string) string {
+	if returnURL == "" || strings.ContainsAny(returnURL, "\\\r\n\t") {
+		return ""
+	}
+	u, err := url.Parse(returnURL)
+	if err != nil || u.Opaque != "" || u.User != nil {
+		return ""
+	}
+	if u.Scheme == "" && u.Host == "" {
+		// Browsers read "///evil.example" as the host evil.example
+		if !strings.HasPrefix(returnURL, "/") || strings.HasPrefix(returnURL, "//") {
+			return ""
+		}
+		return returnURL
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+
+	target := strings.ToLower(u.Hostname())
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if target != "" && target == strings.ToLower(host) {
+		return returnURL
+	}
+	for _, h := range allowed {
+		if target == h {
+			return returnURL
+		}
+	}
+	return ""
+}
+
 // BuildLoginURL builds the login URL with return parameter
 func BuildLoginURL(returnURL, subdomain string) string {
 	loginURL := BasicAuthLoginPath + "?"
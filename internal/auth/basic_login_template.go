@@ -18,9 +18,9 @@ const BasicLoginTemplate = `<!DOCTYPE html>
       --text-muted: #5c5c66;
       --border-subtle: #232328;
       --border-accent: #2d2d35;
-      --accent-primary: #6ee7b7;
-      --accent-primary-rgb: 110, 231, 183;
-      --accent-primary-dim: #5dd4a6;
+      --accent-primary: {{.Brand.PrimaryColor}};
+      --accent-primary-rgb: {{.Brand.PrimaryRGB}};
+      --accent-primary-dim: {{.Brand.PrimaryDim}};
       --accent-red: #f87171;
       --accent-red-rgb: 248, 113, 113;
     }
@@ -97,6 +97,13 @@ const BasicLoginTemplate = `<!DOCTYPE html>
       justify-content: center;
     }
 
+    .logo-img {
+      display: block;
+      max-width: 160px;
+      max-height: 56px;
+      margin: 0 auto 1.25rem;
+    }
+
     .logo-inner {
       width: 20px;
       height: 20px;
@@ -348,12 +355,18 @@ const BasicLoginTemplate = `<!DOCTYPE html>
   <div class="container">
     <!-- Logo -->
     <div class="logo-section">
+      {{if .Brand.LogoURL}}
+      <img class="logo-img" src="{{.Brand.LogoURL}}" alt="{{.Brand.ProductName}}" />
+      {{else}}
       <div class="logo">
         <div class="logo-inner"></div>
         <div class="logo-ring"></div>
       </div>
-      <h1 class="brand-title">digit-link</h1>
+      {{end}}
+      <h1 class="brand-title">{{.Brand.ProductName}}</h1>
+      {{if .Brand.IsDefault}}
       <p class="brand-subtitle">Secure Tunnel Infrastructure</p>
+      {{end}}
     </div>
 
     <!-- Login Card -->
@@ -435,9 +448,11 @@ const BasicLoginTemplate = `<!DOCTYPE html>
     </div>
 
     <!-- Footer -->
+    {{if .Brand.IsDefault}}
     <div class="footer">
       <p>Secure infrastructure by <a href="https://digit.zone" target="_blank" rel="noopener">digit.zone</a></p>
     </div>
+    {{end}}
   </div>
 
   <script>
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+const (
+	// DefaultProductName is the product name shown on unbranded pages
+	DefaultProductName = "digit-link"
+	// DefaultPrimaryColor is the accent color of unbranded pages
+	DefaultPrimaryColor = "#6ee7b7"
+
+	// maxBrandLogoURLLength is the longest accepted logo URL
+	maxBrandLogoURLLength = 2048
+	// maxBrandProductNameLength is the longest accepted product name (in characters)
+	maxBrandProductNameLength = 64
+)
+
+var hexColorPattern = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// Branding is the resolved look of a login or error page
+type Branding struct {
+	LogoURL      string
+	PrimaryColor string
+	ProductName  string
+}
+
+// DefaultBranding returns the generic digit-link branding
+func DefaultBranding() Branding {
+	return Branding{
+		PrimaryColor: DefaultPrimaryColor,
+		ProductName:  DefaultProductName,
+	}
+}
+
+// BrandingForOrg returns an organization's branding, falling back to the defaults for unset fields
+func BrandingForOrg(org *db.Organization) Branding {
+	b := DefaultBranding()
+	if org == nil {
+		return b
+	}
+	if org.Branding.LogoURL != "" {
+		b.LogoURL = org.Branding.LogoURL
+	}
+	if org.Branding.PrimaryColor != "" {
+		b.PrimaryColor = org.Branding.PrimaryColor
+	}
+	if org.Branding.ProductName != "" {
+		b.ProductName = org.Branding.ProductName
+	}
+	return b
+}
+
+// IsDefault reports whether the page uses the generic digit-link product name
+func (b Branding) IsDefault() bool {
+	return b.ProductName == DefaultProductName
+}
+
+// PrimaryRGB returns the primary color as "r, g, b" for use in rgba()
+func (b Branding) PrimaryRGB() string {
+	r, g, bl := parseHexColor(b.PrimaryColor)
+	return fmt.Sprintf("%d, %d, %d", r, g, bl)
+}
+
+// PrimaryDim returns a slightly darker primary color for hover states
+func (b Branding) PrimaryDim() string {
+	r, g, bl := parseHexColor(b.PrimaryColor)
+	return fmt.Sprintf("#%02x%02x%02x", r*9/10, g*9/10, bl*9/10)
+}
+
+// parseHexColor parses a #rgb or #rrggbb color, returning the default color for invalid input
+func parseHexColor(color string) (r, g, b int) {
+	if !hexColorPattern.MatchString(color) {
+		color = DefaultPrimaryColor
+	}
+	hex := strings.TrimPrefix(color, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	v, _ := strconv.ParseUint(hex, 16, 32)
+	return int(v >> 16 & 0xff), int(v >> 8 & 0xff), int(v & 0xff)
+}
+
+// NormalizeBranding trims the branding fields and lowercases the color
+func NormalizeBranding(b db.OrgBranding) db.OrgBranding {
+	return db.OrgBranding{
+		LogoURL:      strings.TrimSpace(b.LogoURL),
+		PrimaryColor: strings.ToLower(strings.TrimSpace(b.PrimaryColor)),
+		ProductName:  strings.TrimSpace(b.ProductName),
+	}
+}
+
+// ValidateBranding checks org branding settings. Empty fields are valid and mean "use the default".
+func ValidateBranding(b db.OrgBranding) error {
+	if b.LogoURL != "" {
+		if len(b.LogoURL) > maxBrandLogoURLLength {
+			return fmt.Errorf("logo URL must be at most %d characters", maxBrandLogoURLLength)
+		}
+		u, err := url.Parse(b.LogoURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" || u.User != nil {
+			return fmt.Errorf("logo URL must be an absolute https URL")
+		}
+	}
+	if b.PrimaryColor != "" && !hexColorPattern.MatchString(b.PrimaryColor) {
+		return fmt.Errorf("primary color must be a hex color like #6ee7b7")
+	}
+	if b.ProductName != "" {
+		if len([]rune(b.ProductName)) > maxBrandProductNameLength {
+			return fmt.Errorf("product name must be at most %d characters", maxBrandProductNameLength)
+		}
+		if strings.IndexFunc(b.ProductName, unicode.IsControl) >= 0 {
+			return fmt.Errorf("product name must not contain control characters")
+		}
+	}
+	return nil
+}
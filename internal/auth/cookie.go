@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// CookieConfig holds the attributes of Basic and OIDC session cookies
+type CookieConfig struct {
+	Domain   string        // "" = host-only cookie for the tunnel's subdomain
+	SameSite http.SameSite // Zero value means Lax
+}
+
+// GetCookieConfig returns the server-wide session cookie attributes from
+// SESSION_COOKIE_DOMAIN and SESSION_COOKIE_SAMESITE
+func GetCookieConfig() CookieConfig {
+	c := CookieConfig{
+		Domain:   normalizeCookieDomain(os.Getenv("SESSION_COOKIE_DOMAIN")),
+		SameSite: http.SameSiteLaxMode,
+	}
+	if v := os.Getenv("SESSION_COOKIE_SAMESITE"); v != "" {
+		sameSite, err := ParseSameSite(v)
+		if err != nil {
+			log.Printf("WARNING: %v, using lax", err)
+		} else {
+			c.SameSite = sameSite
+		}
+	}
+	return c
+}
+
+// ParseSameSite parses "lax", "strict" or "none" (case-insensitive). Empty means lax.
+func ParseSameSite(s string) (http.SameSite, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return 0, fmt.Errorf("invalid SameSite value %q (use lax, strict or none)", s)
+	}
+}
+
+// ForOrg returns the cookie attributes for an organization, applying its overrides
+func (c CookieConfig) ForOrg(org *db.Organization) CookieConfig {
+	if org == nil {
+		return c
+	}
+	if org.SessionCookie.Domain != "" {
+		c.Domain = org.SessionCookie.Domain
+	}
+	if org.SessionCookie.SameSite != "" {
+		if sameSite, err := ParseSameSite(org.SessionCookie.SameSite); err == nil {
+			c.SameSite = sameSite
+		}
+	}
+	return c
+}
+
+// Apply sets the domain and SameSite attributes on a cookie. Browsers reject
+// SameSite=None without Secure, so such cookies fall back to Lax.
+func (c CookieConfig) Apply(cookie *http.Cookie) *http.Cookie {
+	cookie.Domain = c.Domain
+	cookie.SameSite = c.SameSite
+	if cookie.SameSite == 0 || (cookie.SameSite == http.SameSiteNoneMode && !cookie.Secure) {
+		cookie.SameSite = http.SameSiteLaxMode
+	}
+	return cookie
+}
+
+// NormalizeSessionCookie trims and lowercases org session cookie settings
+func NormalizeSessionCookie(c db.OrgSessionCookie) db.OrgSessionCookie {
+	return db.OrgSessionCookie{
+		Domain:   normalizeCookieDomain(c.Domain),
+		SameSite: strings.ToLower(strings.TrimSpace(c.SameSite)),
+		SSO:      c.SSO,
+	}
+}
+
+// ValidateSessionCookie checks org session cookie settings against the server.
+// The domain may only widen the cookie to the server domain, so it is shared by
+// the tunnels of this server and nothing else. SameSite=None requires https.
+func ValidateSessionCookie(c db.OrgSessionCookie, serverDomain string, secure bool) error {
+	if c.Domain != "" && c.Domain != normalizeCookieDomain(serverDomain) {
+		return fmt.Errorf("session cookie domain must be empty or %s", normalizeCookieDomain(serverDomain))
+	}
+	sameSite, err := ParseSameSite(c.SameSite)
+	if err != nil {
+		return err
+	}
+	if sameSite == http.SameSiteNoneMode && !secure {
+		return fmt.Errorf("SameSite=None requires Secure cookies, which need an https server")
+	}
+	return nil
+}
+
+// normalizeCookieDomain lowercases a cookie domain and strips any port and the legacy leading dot
+func normalizeCookieDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if host, _, err := net.SplitHostPort(domain); err == nil {
+		domain = host
+	}
+	return strings.TrimPrefix(domain, ".")
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultFailureDelay is the minimum time a failed authentication takes to answer
+const DefaultFailureDelay = 300 * time.Millisecond
+
+// FailureDelay pads failed authentication responses to a minimum duration plus random jitter,
+// so failures answer in roughly constant time regardless of which check rejected them
+type FailureDelay struct {
+	Min    time.Duration
+	Jitter time.Duration
+}
+
+// GetFailureDelay returns the failed-auth delay from environment or default.
+// AUTH_FAILURE_DELAY is in milliseconds; 0 disables the delay. Jitter is half the delay.
+func GetFailureDelay() FailureDelay {
+	d := DefaultFailureDelay
+	if ms := os.Getenv("AUTH_FAILURE_DELAY"); ms != "" {
+		if v, err := strconv.Atoi(ms); err == nil && v >= 0 {
+			d = time.Duration(v) * time.Millisecond
+		}
+	}
+	return FailureDelay{Min: d, Jitter: d / 2}
+}
+
+// Wait blocks until at least Min plus a random share of Jitter has passed since start,
+// or until ctx is done. Work already spent since start counts toward the delay.
+func (d FailureDelay) Wait(ctx context.Context, start time.Time) {
+	if d.Min <= 0 {
+		return
+	}
+	target := d.Min
+	if d.Jitter > 0 {
+		target += rand.N(d.Jitter)
+	}
+	remaining := target - time.Since(start)
+	if remaining <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(remaining)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+var (
+	dummyPasswordHash     []byte
+	dummyPasswordHashOnce sync.Once
+)
+
+// VerifyDummyPassword runs a bcrypt comparison against a throwaway hash and always returns false.
+// Call it when the account is missing so the response takes as long as a real password check.
+func VerifyDummyPassword(password string) bool {
+	dummyPasswordHashOnce.Do(func() {
+		dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("digit-link-dummy-password"), getBcryptCost())
+	})
+	bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+	return false
+}
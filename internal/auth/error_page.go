@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"html/template"
+	"net/http"
+)
+
+// ErrorPageData contains data for rendering a platform error page
+type ErrorPageData struct {
+	Status  int
+	Title   string
+	Message string
+	Brand   Branding
+}
+
+// ErrorPageSecurityHeaders returns security headers for error pages.
+// The page only uses inline styles and an optional https logo.
+func ErrorPageSecurityHeaders() *SecurityHeaders {
+	return &SecurityHeaders{
+		CSPEnabled:          true,
+		CSPDirectives:       "default-src 'none'; style-src 'unsafe-inline'; img-src https: data:; frame-ancestors 'none';",
+		HSTSEnabled:         true,
+		HSTSMaxAge:          31536000,
+		XFrameOptions:       "DENY",
+		XContentTypeOptions: "nosniff",
+	}
+}
+
+var errorPageTemplate = template.Must(template.New("error").Parse(ErrorPageTemplate))
+
+// RenderErrorPage writes a branded HTML error page with the given status
+func RenderErrorPage(w http.ResponseWriter, status int, message string, brand Branding) {
+	data := ErrorPageData{
+		Status:  status,
+		Title:   http.StatusText(status),
+		Message: message,
+		Brand:   brand,
+	}
+
+	ErrorPageSecurityHeaders().Apply(w)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate")
+	w.WriteHeader(status)
+	errorPageTemplate.Execute(w, data)
+}
+
+// ErrorPageTemplate is the HTML template for platform error pages
+// Styled to match the Basic Auth login page
+const ErrorPageTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="UTF-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1.0">
+  <title>{{.Status}} {{.Title}} - {{.Brand.ProductName}}</title>
+  <style>
+    :root {
+      --bg-deep: #0a0a0b;
+      --bg-surface: #111113;
+      --text-primary: #fafafa;
+      --text-secondary: #a1a1a6;
+      --text-muted: #5c5c66;
+      --border-subtle: #232328;
+      --accent-primary: {{.Brand.PrimaryColor}};
+      --accent-primary-rgb: {{.Brand.PrimaryRGB}};
+    }
+
+    * {
+      margin: 0;
+      padding: 0;
+      box-sizing: border-box;
+    }
+
+    body {
+      font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif;
+      background: var(--bg-deep);
+      color: var(--text-primary);
+      min-height: 100vh;
+      display: flex;
+      align-items: center;
+      justify-content: center;
+      padding: 2rem;
+    }
+
+    .container {
+      width: 100%;
+      max-width: 440px;
+      text-align: center;
+    }
+
+    .logo {
+      width: 56px;
+      height: 56px;
+      margin: 0 auto 1.25rem;
+      border: 2px solid var(--accent-primary);
+      border-radius: 14px;
+      display: flex;
+      align-items: center;
+      justify-content: center;
+    }
+
+    .logo-inner {
+      width: 20px;
+      height: 20px;
+      background: var(--accent-primary);
+      border-radius: 4px;
+      transform: rotate(45deg);
+    }
+
+    .logo-img {
+      display: block;
+      max-width: 160px;
+      max-height: 56px;
+      margin: 0 auto 1.25rem;
+    }
+
+    .brand-title {
+      font-size: 1.25rem;
+      font-weight: 600;
+      margin-bottom: 2rem;
+    }
+
+    .card {
+      background: var(--bg-surface);
+      border: 1px solid var(--border-subtle);
+      border-top: 2px solid var(--accent-primary);
+      border-radius: 16px;
+      padding: 2rem;
+    }
+
+    .status {
+      font-size: 2.5rem;
+      font-weight: 700;
+      color: var(--accent-primary);
+      text-shadow: 0 0 24px rgba(var(--accent-primary-rgb), 0.35);
+    }
+
+    .title {
+      font-size: 1.125rem;
+      font-weight: 600;
+      margin: 0.5rem 0 0.75rem;
+    }
+
+    .message {
+      color: var(--text-secondary);
+      font-size: 0.9375rem;
+      line-height: 1.5;
+      word-break: break-word;
+    }
+  </style>
+</head>
+<body>
+  <div class="container">
+    {{if .Brand.LogoURL}}
+    <img class="logo-img" src="{{.Brand.LogoURL}}" alt="{{.Brand.ProductName}}" />
+    {{else}}
+    <div class="logo"><div class="logo-inner"></div></div>
+    {{end}}
+    <h1 class="brand-title">{{.Brand.ProductName}}</h1>
+
+    <div class="card">
+      <div class="status">{{.Status}}</div>
+      <h2 class="title">{{.Title}}</h2>
+      <p class="message">{{.Message}}</p>
+    </div>
+  </div>
+</body>
+</html>`
@@ -1,8 +1,10 @@
 package auth
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
 // SecurityHeaders adds security-related HTTP headers to responses
@@ -45,6 +47,74 @@ func AuthEndpointSecurityHeaders() *SecurityHeaders {
 	}
 }
 
+// BasicLoginSecurityHeaders returns security headers for the Basic auth login page.
+// The page uses inline styles and scripts, so its CSP only restricts framing and form targets.
+func BasicLoginSecurityHeaders() *SecurityHeaders {
+	return &SecurityHeaders{
+		CSPEnabled:          true,
+		CSPDirectives:       "frame-ancestors 'none'; form-action 'self';",
+		HSTSEnabled:         true,
+		HSTSMaxAge:          31536000,
+		XFrameOptions:       "DENY",
+		XContentTypeOptions: "nosniff",
+	}
+}
+
+// WithFrameAncestors returns a copy of the headers that allows framing by the given
+// CSP frame-ancestors source list. An empty list keeps the headers unchanged.
+func (sh *SecurityHeaders) WithFrameAncestors(sources string) *SecurityHeaders {
+	sources = strings.Join(strings.Fields(sources), " ")
+	if sh == nil || sources == "" {
+		return sh
+	}
+
+	out := *sh
+
+	// Replace the frame-ancestors directive, keeping all others
+	directives := []string{}
+	for _, d := range strings.Split(sh.CSPDirectives, ";") {
+		d = strings.TrimSpace(d)
+		if d == "" || strings.HasPrefix(d, "frame-ancestors") {
+			continue
+		}
+		directives = append(directives, d)
+	}
+	directives = append(directives, "frame-ancestors "+sources)
+	out.CSPDirectives = strings.Join(directives, "; ") + ";"
+
+	// X-Frame-Options cannot express an allow-list; browsers that support
+	// frame-ancestors ignore it, so only keep it where it matches exactly
+	switch sources {
+	case "'none'":
+		out.XFrameOptions = "DENY"
+	case "'self'":
+		out.XFrameOptions = "SAMEORIGIN"
+	default:
+		out.XFrameOptions = ""
+	}
+
+	return &out
+}
+
+// ValidateFrameAncestors checks a CSP frame-ancestors source list such as
+// "'self' https://portal.example.com". An empty list is valid.
+func ValidateFrameAncestors(sources string) error {
+	for _, source := range strings.Fields(sources) {
+		switch {
+		case source == "'self'" || source == "'none'":
+			continue
+		case strings.ContainsAny(source, "';,\""):
+			return fmt.Errorf("invalid frame ancestor %q", source)
+		case source == "*":
+			return fmt.Errorf("wildcard frame ancestor is not allowed")
+		}
+	}
+	if strings.Contains(sources, "'none'") && len(strings.Fields(sources)) > 1 {
+		return fmt.Errorf("'none' cannot be combined with other frame ancestors")
+	}
+	return nil
+}
+
 // Apply adds security headers to the response
 func (sh *SecurityHeaders) Apply(w http.ResponseWriter) {
 	if sh == nil {
@@ -82,9 +152,10 @@ func SetSecurityHeaders(w http.ResponseWriter) {
 	DefaultSecurityHeaders().Apply(w)
 }
 
-// SetAuthSecurityHeaders is a convenience function to set auth endpoint security headers
-func SetAuthSecurityHeaders(w http.ResponseWriter) {
-	AuthEndpointSecurityHeaders().Apply(w)
+// SetAuthSecurityHeaders is a convenience function to set auth endpoint security headers.
+// frameAncestors optionally allows embedding by the given CSP sources ("" = not embeddable).
+func SetAuthSecurityHeaders(w http.ResponseWriter, frameAncestors string) {
+	AuthEndpointSecurityHeaders().WithFrameAncestors(frameAncestors).Apply(w)
 }
 
 // SecurityHeadersMiddleware is an http.Handler wrapper that adds security headers
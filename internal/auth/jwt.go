@@ -14,6 +14,9 @@ import (
 const (
 	// JWTExpiration is the default expiration time for JWT tokens
 	JWTExpiration = 24 * time.Hour
+
+	// PasswordChangeTokenExpiration is how long a password change token stays valid
+	PasswordChangeTokenExpiration = 15 * time.Minute
 )
 
 // JWTClaims contains the claims for a JWT token
@@ -22,6 +25,8 @@ type JWTClaims struct {
 	Username  string `json:"username"`
 	IsAdmin   bool   `json:"isAdmin"`
 	OrgID     string `json:"orgId,omitempty"` // Set for org accounts
+	// PasswordChange marks a restricted token that only permits setting a new password
+	PasswordChange bool `json:"passwordChange,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -63,12 +68,17 @@ func GenerateJWT(accountID, username string, isAdmin bool) (string, error) {
 
 // GenerateJWTWithOrg creates a new JWT token for an authenticated user with optional org context
 func GenerateJWTWithOrg(accountID, username string, isAdmin bool, orgID string) (string, error) {
+	return GenerateSessionJWT(accountID, username, isAdmin, orgID, "", time.Now())
+}
+
+// GenerateSessionJWT creates a JWT token issued at now for a tracked login
+// session, whose ID is set as the token ID ("" for untracked logins)
+func GenerateSessionJWT(accountID, username string, isAdmin bool, orgID, sessionID string, now time.Time) (string, error) {
 	secret, err := getJWTSecret()
 	if err != nil {
 		return "", err
 	}
 
-	now := time.Now()
 	claims := JWTClaims{
 		AccountID: accountID,
 		Username:  username,
@@ -80,6 +90,7 @@ func GenerateJWTWithOrg(accountID, username string, isAdmin bool, orgID string)
 			NotBefore: jwt.NewNumericDate(now),
 			Issuer:    "digit-link",
 			Subject:   accountID,
+			ID:        sessionID,
 		},
 	}
 
@@ -87,8 +98,61 @@ func GenerateJWTWithOrg(accountID, username string, isAdmin bool, orgID string)
 	return token.SignedString(secret)
 }
 
-// ValidateJWT validates a JWT token and returns the claims
+// ValidateJWT validates a JWT token and returns the claims.
+// Password change tokens are rejected, they only work with ValidatePasswordChangeToken.
 func ValidateJWT(tokenString string) (*JWTClaims, error) {
+	claims, err := parseJWT(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.PasswordChange {
+		return nil, fmt.Errorf("password change required")
+	}
+	return claims, nil
+}
+
+// GeneratePasswordChangeToken creates a short-lived token for an account that must
+// change its password before it gets a regular session
+func GeneratePasswordChangeToken(accountID, username string, isAdmin bool, orgID string) (string, error) {
+	secret, err := getJWTSecret()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := JWTClaims{
+		AccountID:      accountID,
+		Username:       username,
+		IsAdmin:        isAdmin,
+		OrgID:          orgID,
+		PasswordChange: true,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(PasswordChangeTokenExpiration)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "digit-link",
+			Subject:   accountID,
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(secret)
+}
+
+// ValidatePasswordChangeToken validates a password change token and returns its claims
+func ValidatePasswordChangeToken(tokenString string) (*JWTClaims, error) {
+	claims, err := parseJWT(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if !claims.PasswordChange {
+		return nil, fmt.Errorf("not a password change token")
+	}
+	return claims, nil
+}
+
+// parseJWT verifies a JWT token's signature and expiry and returns its claims
+func parseJWT(tokenString string) (*JWTClaims, error) {
 	secret, err := getJWTSecret()
 	if err != nil {
 		return nil, err
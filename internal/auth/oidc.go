@@ -9,6 +9,7 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -19,11 +20,17 @@ import (
 	"golang.org/x/oauth2"
 )
 
+// OIDCSessionCookie is the name of the OIDC session cookie
+const OIDCSessionCookie = "digit_link_session"
+
 // OIDCAuthHandler handles OIDC/OAuth2 authentication
 type OIDCAuthHandler struct {
 	db            *db.DB
 	domain        string
 	sessionCookie string
+	cookies       CookieConfig  // Server-wide session cookie attributes, orgs may override
+	stateTTL      time.Duration // How long a login may wait for the provider's callback
+	returnHosts   []string      // Hosts besides the requested one logins may redirect back to
 
 	// Provider cache
 	providers   map[string]*cachedOIDCProvider
@@ -42,19 +49,35 @@ func NewOIDCAuthHandler(database *db.DB, domain string) *OIDCAuthHandler {
 	return &OIDCAuthHandler{
 		db:            database,
 		domain:        domain,
-		sessionCookie: "digit_link_session",
+		sessionCookie: OIDCSessionCookie,
+		cookies:       GetCookieConfig(),
+		stateTTL:      GetOIDCStateTTL(),
+		returnHosts:   GetLoginReturnHosts(),
 		providers:     make(map[string]*cachedOIDCProvider),
 	}
 }
 
+// GetOIDCStateTTL returns how long an OIDC login may take from OIDC_STATE_TTL (seconds) or default
+func GetOIDCStateTTL() time.Duration {
+	if ttl := os.Getenv("OIDC_STATE_TTL"); ttl != "" {
+		var seconds int
+		fmt.Sscanf(ttl, "%d", &seconds)
+		if seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		log.Printf("WARNING: invalid OIDC_STATE_TTL %q, using default", ttl)
+	}
+	return db.DefaultOIDCStateTTL
+}
+
 // Authenticate implements the AuthHandler interface for OIDC auth
 func (h *OIDCAuthHandler) Authenticate(w http.ResponseWriter, r *http.Request, p *policy.EffectivePolicy, ctx *policy.AuthContext) *policy.AuthResult {
 	// Check for existing session
 	cookie, err := r.Cookie(h.sessionCookie)
 	if err == nil && cookie.Value != "" {
 		session, err := h.validateSession(cookie.Value, ctx)
-		if err == nil && session != nil {
-			return policy.SuccessWithSession(session.ID, session.UserEmail)
+		if err == nil && session != nil && OrgSessionAllowed(session, p.OIDC) {
+			return policy.SuccessFromSession(session)
 		}
 	}
 
@@ -75,12 +98,12 @@ func (h *OIDCAuthHandler) Challenge(w http.ResponseWriter, r *http.Request, p *p
 // HandleLogin handles the login endpoint - starts OIDC flow
 func (h *OIDCAuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request, p *policy.EffectivePolicy, ctx *policy.AuthContext) {
 	if p == nil || p.OIDC == nil {
-		http.Error(w, "OIDC not configured", http.StatusInternalServerError)
+		h.renderError(w, ctx, http.StatusInternalServerError, "OIDC not configured")
 		return
 	}
 
-	// Get redirect URL from query param
-	redirectURL := r.URL.Query().Get("redirect")
+	// Get redirect URL from query param; it must stay on this host
+	redirectURL := SafeReturnURL(r.URL.Query().Get("redirect"), r.Host, h.returnHosts)
 	if redirectURL == "" {
 		redirectURL = "/"
 	}
@@ -89,7 +112,7 @@ func (h *OIDCAuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request, p
 	provider, err := h.getOrCreateProvider(r.Context(), p.OIDC)
 	if err != nil {
 		log.Printf("Failed to create OIDC provider: %v", err)
-		http.Error(w, "Failed to initialize OIDC provider", http.StatusInternalServerError)
+		h.renderError(w, ctx, http.StatusInternalServerError, "Failed to initialize OIDC provider")
 		return
 	}
 
@@ -106,7 +129,7 @@ func (h *OIDCAuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request, p
 	verifier, challenge, err := generatePKCE()
 	if err != nil {
 		log.Printf("Failed to generate PKCE: %v", err)
-		http.Error(w, "Failed to initialize authentication", http.StatusInternalServerError)
+		h.renderError(w, ctx, http.StatusInternalServerError, "Failed to initialize authentication")
 		return
 	}
 
@@ -121,10 +144,10 @@ func (h *OIDCAuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request, p
 		}
 	}
 
-	state, err := h.db.CreateOIDCState(appID, orgID, redirectURL, verifier)
+	state, err := h.db.CreateOIDCState(appID, orgID, redirectURL, verifier, h.stateTTL)
 	if err != nil {
 		log.Printf("Failed to create OIDC state: %v", err)
-		http.Error(w, "Failed to initialize authentication", http.StatusInternalServerError)
+		h.renderError(w, ctx, http.StatusInternalServerError, "Failed to initialize authentication")
 		return
 	}
 
@@ -142,7 +165,7 @@ func (h *OIDCAuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request, p
 // HandleCallback handles the OIDC callback endpoint
 func (h *OIDCAuthHandler) HandleCallback(w http.ResponseWriter, r *http.Request, p *policy.EffectivePolicy, ctx *policy.AuthContext) {
 	if p == nil || p.OIDC == nil {
-		http.Error(w, "OIDC not configured", http.StatusInternalServerError)
+		h.renderError(w, ctx, http.StatusInternalServerError, "OIDC not configured")
 		return
 	}
 
@@ -156,10 +179,10 @@ func (h *OIDCAuthHandler) HandleCallback(w http.ResponseWriter, r *http.Request,
 		errorDesc := r.URL.Query().Get("error_description")
 		if errorParam != "" {
 			log.Printf("OIDC error: %s - %s", errorParam, errorDesc)
-			http.Error(w, fmt.Sprintf("Authentication failed: %s", errorDesc), http.StatusUnauthorized)
+			h.renderError(w, ctx, http.StatusUnauthorized, fmt.Sprintf("Authentication failed: %s", errorDesc))
 			return
 		}
-		http.Error(w, "Missing code or state parameter", http.StatusBadRequest)
+		h.renderError(w, ctx, http.StatusBadRequest, "Missing code or state parameter")
 		return
 	}
 
@@ -167,11 +190,11 @@ func (h *OIDCAuthHandler) HandleCallback(w http.ResponseWriter, r *http.Request,
 	state, err := h.db.ValidateOIDCState(stateParam)
 	if err != nil {
 		log.Printf("Failed to validate OIDC state: %v", err)
-		http.Error(w, "Invalid state parameter", http.StatusBadRequest)
+		h.renderError(w, ctx, http.StatusBadRequest, "Invalid state parameter")
 		return
 	}
 	if state == nil {
-		http.Error(w, "Invalid or expired state parameter", http.StatusBadRequest)
+		h.renderError(w, ctx, http.StatusBadRequest, "Invalid or expired state parameter")
 		return
 	}
 
@@ -179,7 +202,7 @@ func (h *OIDCAuthHandler) HandleCallback(w http.ResponseWriter, r *http.Request,
 	provider, err := h.getOrCreateProvider(r.Context(), p.OIDC)
 	if err != nil {
 		log.Printf("Failed to get OIDC provider: %v", err)
-		http.Error(w, "Failed to validate authentication", http.StatusInternalServerError)
+		h.renderError(w, ctx, http.StatusInternalServerError, "Failed to validate authentication")
 		return
 	}
 
@@ -200,7 +223,7 @@ func (h *OIDCAuthHandler) HandleCallback(w http.ResponseWriter, r *http.Request,
 	)
 	if err != nil {
 		log.Printf("Failed to exchange code: %v", err)
-		http.Error(w, "Failed to exchange authorization code", http.StatusInternalServerError)
+		h.renderError(w, ctx, http.StatusInternalServerError, "Failed to exchange authorization code")
 		return
 	}
 
@@ -208,14 +231,14 @@ func (h *OIDCAuthHandler) HandleCallback(w http.ResponseWriter, r *http.Request,
 	rawIDToken, ok := token.Extra("id_token").(string)
 	if !ok {
 		log.Printf("No id_token in token response")
-		http.Error(w, "Missing ID token", http.StatusInternalServerError)
+		h.renderError(w, ctx, http.StatusInternalServerError, "Missing ID token")
 		return
 	}
 
 	idToken, err := provider.verifier.Verify(r.Context(), rawIDToken)
 	if err != nil {
 		log.Printf("Failed to verify ID token: %v", err)
-		http.Error(w, "Failed to verify ID token", http.StatusUnauthorized)
+		h.renderError(w, ctx, http.StatusUnauthorized, "Failed to verify ID token")
 		return
 	}
 
@@ -229,13 +252,13 @@ func (h *OIDCAuthHandler) HandleCallback(w http.ResponseWriter, r *http.Request,
 	}
 	if err := idToken.Claims(&claims); err != nil {
 		log.Printf("Failed to parse claims: %v", err)
-		http.Error(w, "Failed to parse ID token claims", http.StatusInternalServerError)
+		h.renderError(w, ctx, http.StatusInternalServerError, "Failed to parse ID token claims")
 		return
 	}
 
 	if claims.Nonce != state.Nonce {
 		log.Printf("Nonce mismatch")
-		http.Error(w, "Invalid nonce", http.StatusUnauthorized)
+		h.renderError(w, ctx, http.StatusUnauthorized, "Invalid nonce")
 		return
 	}
 
@@ -248,21 +271,32 @@ func (h *OIDCAuthHandler) HandleCallback(w http.ResponseWriter, r *http.Request,
 			h.db.LogAuthFailure(state.OrgID, state.AppID, "oidc", GetClientIPFromRequest(r), err.Error())
 		}
 
-		http.Error(w, err.Error(), http.StatusForbidden)
+		h.renderError(w, ctx, http.StatusForbidden, err.Error())
 		return
 	}
 
-	// Create session
+	// Create session, org-wide when the org uses SSO. The issuer lets other apps
+	// of the org check that the session comes from their identity provider.
 	userClaims := map[string]string{
 		"sub":   claims.Subject,
 		"email": claims.Email,
 		"name":  claims.Name,
+		"iss":   p.OIDC.IssuerURL,
+	}
+	if groups := groupsClaim(idToken); len(groups) > 0 {
+		userClaims["groups"] = strings.Join(groups, ",")
 	}
 
-	session, err := h.db.CreateSession(state.AppID, state.OrgID, claims.Email, userClaims, 24*time.Hour)
+	org := h.lookupOrg(state.OrgID)
+	var session *db.AuthSession
+	if org != nil && org.SessionCookie.SSO {
+		session, err = h.db.CreateOrgWideSession(org.ID, claims.Email, userClaims, 24*time.Hour)
+	} else {
+		session, err = h.db.CreateSession(state.AppID, state.OrgID, claims.Email, userClaims, 24*time.Hour)
+	}
 	if err != nil {
 		log.Printf("Failed to create session: %v", err)
-		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		h.renderError(w, ctx, http.StatusInternalServerError, "Failed to create session")
 		return
 	}
 
@@ -272,22 +306,64 @@ func (h *OIDCAuthHandler) HandleCallback(w http.ResponseWriter, r *http.Request,
 	}
 
 	// Set session cookie
-	http.SetCookie(w, &http.Cookie{
+	http.SetCookie(w, h.cookieConfig(org).Apply(&http.Cookie{
 		Name:     h.sessionCookie,
 		Value:    session.ID,
 		Path:     "/",
 		Expires:  session.ExpiresAt,
 		HttpOnly: true,
 		Secure:   true,
-		SameSite: http.SameSiteLaxMode,
-	})
+	}))
 
 	// Redirect to original URL
 	http.Redirect(w, r, state.RedirectURL, http.StatusFound)
 }
 
-// HandleLogout handles the logout endpoint
-func (h *OIDCAuthHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+// renderError writes a branded error page for the context's organization
+func (h *OIDCAuthHandler) renderError(w http.ResponseWriter, ctx *policy.AuthContext, status int, message string) {
+	var org *db.Organization
+	if ctx != nil && ctx.OrgID != "" && h.db != nil {
+		org, _ = h.db.GetOrganizationByID(ctx.OrgID)
+	}
+	RenderErrorPage(w, status, message, BrandingForOrg(org))
+}
+
+// lookupOrg returns an organization by ID, or nil if it is unset or cannot be loaded
+func (h *OIDCAuthHandler) lookupOrg(orgID *string) *db.Organization {
+	if orgID == nil || *orgID == "" || h.db == nil {
+		return nil
+	}
+	org, _ := h.db.GetOrganizationByID(*orgID)
+	return org
+}
+
+// cookieConfig returns the session cookie attributes for an organization. With
+// SSO the cookie is set on the server domain so all of the org's subdomains get it.
+// That domain also covers other orgs' tunnels, so only server admins enable SSO.
+func (h *OIDCAuthHandler) cookieConfig(org *db.Organization) CookieConfig {
+	c := h.cookies.ForOrg(org)
+	if org != nil && org.SessionCookie.SSO {
+		c.Domain = normalizeCookieDomain(h.domain)
+	}
+	return c
+}
+
+// OrgSessionAllowed reports whether a session may be used under an app's OIDC policy.
+// Org-wide sessions must come from the policy's issuer and satisfy its AllowedDomains,
+// since they were issued on another app of the org; app sessions passed them at login.
+func OrgSessionAllowed(session *db.AuthSession, config *policy.OIDCConfig) bool {
+	if !session.OrgWide {
+		return true
+	}
+	if config == nil || session.UserClaims["iss"] != config.IssuerURL {
+		return false
+	}
+	return checkEmailDomain(session.UserEmail, config.AllowedDomains) == nil
+}
+
+// HandleLogout handles the logout endpoint. The context selects the cookie
+// attributes, which must match the ones the session cookie was set with.
+func (h *OIDCAuthHandler) HandleLogout(w http.ResponseWriter, r *http.Request, ctx *policy.AuthContext) {
 	// Get session from cookie
 	cookie, err := r.Cookie(h.sessionCookie)
 	if err == nil && cookie.Value != "" {
@@ -296,18 +372,21 @@ func (h *OIDCAuthHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Clear session cookie
-	http.SetCookie(w, &http.Cookie{
+	var org *db.Organization
+	if ctx != nil {
+		org = h.lookupOrg(&ctx.OrgID)
+	}
+	http.SetCookie(w, h.cookieConfig(org).Apply(&http.Cookie{
 		Name:     h.sessionCookie,
 		Value:    "",
 		Path:     "/",
 		MaxAge:   -1,
 		HttpOnly: true,
 		Secure:   true,
-		SameSite: http.SameSiteLaxMode,
-	})
+	}))
 
-	// Redirect to home or specified URL
-	redirectURL := r.URL.Query().Get("redirect")
+	// Redirect to home or specified URL on this host
+	redirectURL := SafeReturnURL(r.URL.Query().Get("redirect"), r.Host, h.returnHosts)
 	if redirectURL == "" {
 		redirectURL = "/"
 	}
@@ -339,28 +418,8 @@ func (h *OIDCAuthHandler) validateClaims(claims *struct {
 	Subject       string `json:"sub"`
 }, config *policy.OIDCConfig) error {
 	// Check email domain restriction
-	if len(config.AllowedDomains) > 0 {
-		if claims.Email == "" {
-			return fmt.Errorf("email claim required but not provided")
-		}
-
-		parts := strings.Split(claims.Email, "@")
-		if len(parts) != 2 {
-			return fmt.Errorf("invalid email format")
-		}
-
-		domain := strings.ToLower(parts[1])
-		allowed := false
-		for _, d := range config.AllowedDomains {
-			if strings.ToLower(d) == domain {
-				allowed = true
-				break
-			}
-		}
-
-		if !allowed {
-			return fmt.Errorf("email domain '%s' not allowed", domain)
-		}
+	if err := checkEmailDomain(claims.Email, config.AllowedDomains); err != nil {
+		return err
 	}
 
 	// Note: Required claims validation would need access to the full claims map
@@ -369,6 +428,29 @@ func (h *OIDCAuthHandler) validateClaims(claims *struct {
 	return nil
 }
 
+// checkEmailDomain checks an email address against the allowed domains (none = any)
+func checkEmailDomain(email string, allowedDomains []string) error {
+	if len(allowedDomains) == 0 {
+		return nil
+	}
+	if email == "" {
+		return fmt.Errorf("email claim required but not provided")
+	}
+
+	parts := strings.Split(email, "@")
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid email format")
+	}
+
+	domain := strings.ToLower(parts[1])
+	for _, d := range allowedDomains {
+		if strings.ToLower(d) == domain {
+			return nil
+		}
+	}
+	return fmt.Errorf("email domain '%s' not allowed", domain)
+}
+
 // ValidateClaimsExtended validates claims with full access to all claim values
 // This is used when you need to validate arbitrary claims beyond email domain
 func (h *OIDCAuthHandler) ValidateClaimsExtended(claims map[string]interface{}, config *policy.OIDCConfig) error {
@@ -537,3 +619,29 @@ func (h *OIDCAuthHandler) UpdateProviderRedirectURL(issuerURL, subdomain string)
 	// No-op: redirect URLs are now set per-request to avoid race conditions
 	// See getOAuth2ConfigForSubdomain for the correct approach
 }
+
+// groupsClaim returns the ID token's groups claim, which providers send as an
+// array or as a single string. It returns nil when the claim is absent.
+func groupsClaim(idToken *oidc.IDToken) []string {
+	var claims struct {
+		Groups interface{} `json:"groups"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil
+	}
+	switch v := claims.Groups.(type) {
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	case []interface{}:
+		var groups []string
+		for _, item := range v {
+			if group, ok := item.(string); ok && group != "" {
+				groups = append(groups, group)
+			}
+		}
+		return groups
+	}
+	return nil
+}
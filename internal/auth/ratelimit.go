@@ -54,6 +54,18 @@ func DefaultRateLimiterConfig() RateLimiterConfig {
 	}
 }
 
+// ElevatedRateLimiterConfig returns the configuration used for API keys on the
+// elevated rate limit tier. Each key gets its own bucket, so the limits are
+// sized for automated clients rather than interactive logins.
+func ElevatedRateLimiterConfig() RateLimiterConfig {
+	return RateLimiterConfig{
+		WindowDuration:  time.Minute,
+		MaxAttempts:     600,
+		BlockDuration:   time.Minute,
+		CleanupInterval: 5 * time.Minute,
+	}
+}
+
 // NewRateLimiter creates a new rate limiter
 func NewRateLimiter(database *db.DB, config RateLimiterConfig) *RateLimiter {
 	rl := &RateLimiter{
@@ -72,6 +84,29 @@ func NewRateLimiter(database *db.DB, config RateLimiterConfig) *RateLimiter {
 	return rl
 }
 
+// Config returns the limiter's current configuration
+func (rl *RateLimiter) Config() RateLimiterConfig {
+	rl.cacheMu.RLock()
+	defer rl.cacheMu.RUnlock()
+	return RateLimiterConfig{
+		WindowDuration:  rl.windowDuration,
+		MaxAttempts:     rl.maxAttempts,
+		BlockDuration:   rl.blockDuration,
+		CleanupInterval: rl.cleanupInterval,
+	}
+}
+
+// SetConfig changes the window, attempt limit and block duration at runtime.
+// Counts already recorded are kept and judged by the new limits; blocks already
+// imposed run out as they were set. The cleanup interval cannot be changed.
+func (rl *RateLimiter) SetConfig(config RateLimiterConfig) {
+	rl.cacheMu.Lock()
+	defer rl.cacheMu.Unlock()
+	rl.windowDuration = config.WindowDuration
+	rl.maxAttempts = config.MaxAttempts
+	rl.blockDuration = config.BlockDuration
+}
+
 // Allow checks if a request should be allowed based on rate limits
 // Returns (allowed, retryAfter) where retryAfter is the duration until the block expires
 func (rl *RateLimiter) Allow(key string) (bool, time.Duration) {
@@ -275,9 +310,10 @@ func (rl *RateLimiter) cleanup() {
 
 	// Clean cache
 	rl.cacheMu.Lock()
+	window := rl.windowDuration
 	for key, entry := range rl.cache {
 		// Remove if window expired and not blocked
-		if now.Sub(entry.windowStart) > rl.windowDuration &&
+		if now.Sub(entry.windowStart) > window &&
 			(entry.blockedUntil.IsZero() || now.After(entry.blockedUntil)) {
 			delete(rl.cache, key)
 		}
@@ -286,7 +322,7 @@ func (rl *RateLimiter) cleanup() {
 
 	// Clean database
 	if rl.db != nil {
-		cutoff := now.Add(-rl.windowDuration)
+		cutoff := now.Add(-window)
 		rl.db.Conn().Exec(`
 			DELETE FROM rate_limit_state 
 			WHERE window_start < ? 
@@ -326,6 +362,11 @@ func OrgIPRateLimitKey(orgID, ip string) string {
 	return BuildRateLimitKey("org_ip", orgID, ip)
 }
 
+// APIKeyRateLimitKey returns a rate limit key for an authenticated API key
+func APIKeyRateLimitKey(keyID string) string {
+	return BuildRateLimitKey("api_key", keyID)
+}
+
 // UserRateLimitKey returns a rate limit key for a user identity
 func UserRateLimitKey(userIdentity string) string {
 	return BuildRateLimitKey("user", userIdentity)
@@ -10,15 +10,21 @@ import (
 	"io"
 	"log"
 	"os"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/pquerna/otp"
 	"github.com/pquerna/otp/totp"
 )
 
 const (
-	// TOTPIssuer is the issuer name shown in authenticator apps
+	// TOTPIssuer is the default issuer name shown in authenticator apps
 	TOTPIssuer = "digit-link"
+
+	// maxTOTPLabelLength bounds the issuer and account name of a TOTP entry
+	maxTOTPLabelLength = 64
 )
 
 // TOTPKey contains the generated TOTP secret and provisioning URL
@@ -27,11 +33,12 @@ type TOTPKey struct {
 	URL    string `json:"url"`
 }
 
-// GenerateTOTPSecret generates a new TOTP secret for an account
-func GenerateTOTPSecret(username string) (*TOTPKey, error) {
+// GenerateTOTPSecret generates a new TOTP secret for an account. Authenticator
+// apps list it under the issuer and account name.
+func GenerateTOTPSecret(issuer, accountName string) (*TOTPKey, error) {
 	key, err := totp.Generate(totp.GenerateOpts{
-		Issuer:      TOTPIssuer,
-		AccountName: username,
+		Issuer:      issuer,
+		AccountName: accountName,
 		Period:      30,
 		Digits:      otp.DigitsSix,
 		Algorithm:   otp.AlgorithmSHA1,
@@ -46,6 +53,26 @@ func GenerateTOTPSecret(username string) (*TOTPKey, error) {
 	}, nil
 }
 
+// ValidateTOTPLabel checks an issuer or account name for the otpauth URL of a
+// TOTP secret. A colon would split the URL's label in the wrong place.
+func ValidateTOTPLabel(label string) error {
+	if strings.TrimSpace(label) == "" {
+		return fmt.Errorf("cannot be empty")
+	}
+	if len(label) > maxTOTPLabelLength {
+		return fmt.Errorf("must be at most %d characters", maxTOTPLabelLength)
+	}
+	if !utf8.ValidString(label) {
+		return fmt.Errorf("must be valid UTF-8")
+	}
+	for _, c := range label {
+		if c == ':' || unicode.IsControl(c) {
+			return fmt.Errorf("cannot contain colons or control characters")
+		}
+	}
+	return nil
+}
+
 // ValidateTOTP validates a TOTP code against the secret with a 3-frame time window
 // This checks the previous, current, and next time periods to account for clock drift
 func ValidateTOTP(secret, code string) bool {
@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/policy"
+)
+
+const (
+	// webhookTimeout bounds a call to an authorization webhook
+	webhookTimeout = 5 * time.Second
+	// maxWebhookResponseBytes bounds the body read from an authorization webhook
+	maxWebhookResponseBytes = 16 << 10
+	// maxWebhookURLLength bounds the URL of an authorization webhook
+	maxWebhookURLLength = 2048
+	// MaxWebhookHeaders bounds the header allowlist of an authorization webhook
+	MaxWebhookHeaders = 20
+)
+
+// DefaultWebhookHeaders are forwarded to an authorization webhook whose policy
+// has no header allowlist: the credentials and nothing else about the visitor
+var DefaultWebhookHeaders = []string{"Authorization"}
+
+// webhookHopHeaders describe the connection to the edge, not the visitor, and
+// cannot be allowlisted
+var webhookHopHeaders = map[string]bool{
+	"Connection": true, "Keep-Alive": true, "Proxy-Connection": true, "Te": true,
+	"Trailer": true, "Transfer-Encoding": true, "Upgrade": true, "Host": true, "Content-Length": true,
+}
+
+// WebhookRequest is the JSON body sent to an authorization webhook. Only the
+// headers on the policy's allowlist are included.
+type WebhookRequest struct {
+	Method    string              `json:"method"`
+	Path      string              `json:"path"` // Request URI, with the query
+	Subdomain string              `json:"subdomain"`
+	OrgID     string              `json:"orgId,omitempty"`
+	AppID     string              `json:"appId,omitempty"`
+	ClientIP  string              `json:"clientIp"`
+	Headers   map[string][]string `json:"headers,omitempty"`
+}
+
+// WebhookResponse is the optional JSON body of an authorization webhook's 2xx
+// answer, naming the visitor for the identity headers
+type WebhookResponse struct {
+	User string `json:"user"`
+}
+
+// WebhookAuthHandler asks an external service to authorize each request
+type WebhookAuthHandler struct {
+	client *http.Client
+}
+
+// NewWebhookAuthHandler creates a new authorization webhook handler. Its
+// transport only connects to public addresses, checked after DNS resolution,
+// so a webhook URL cannot reach the server's own network.
+func NewWebhookAuthHandler() *WebhookAuthHandler {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would be dialed in place of the webhook, hiding its address from the check
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{
+		Timeout:   webhookTimeout,
+		KeepAlive: 30 * time.Second,
+		Control:   checkWebhookAddress,
+	}).DialContext
+	return newWebhookAuthHandler(transport)
+}
+
+// newWebhookAuthHandler creates an authorization webhook handler on transport
+func newWebhookAuthHandler(transport http.RoundTripper) *WebhookAuthHandler {
+	return &WebhookAuthHandler{client: &http.Client{
+		Transport: transport,
+		Timeout:   webhookTimeout,
+		// A redirect would resend the visitor's headers somewhere the policy didn't name
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}}
+}
+
+// Authenticate implements the AuthHandler interface for webhook auth. A 2xx
+// answer lets the request through; anything else, including a webhook that
+// cannot be reached, denies it.
+func (h *WebhookAuthHandler) Authenticate(w http.ResponseWriter, r *http.Request, p *policy.EffectivePolicy, ctx *policy.AuthContext) *policy.AuthResult {
+	if p.Webhook == nil || p.Webhook.URL == "" {
+		return policy.Failure("authorization webhook not configured")
+	}
+
+	body, _ := json.Marshal(NewWebhookRequest(r, p.Webhook, ctx))
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, p.Webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return policy.Failure("authorization webhook unavailable")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		log.Printf("Authorization webhook for %s failed: %v", ctx.Subdomain, err)
+		return policy.Failure("authorization webhook unavailable")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return policy.Failure("denied by authorization webhook")
+	}
+
+	var answer WebhookResponse
+	json.NewDecoder(io.LimitReader(resp.Body, maxWebhookResponseBytes)).Decode(&answer)
+	return policy.Success(answer.User)
+}
+
+// Challenge implements the AuthHandler interface; a webhook has nothing to ask the visitor
+func (h *WebhookAuthHandler) Challenge(w http.ResponseWriter, r *http.Request, p *policy.EffectivePolicy, ctx *policy.AuthContext) {
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+// NewWebhookRequest builds the body sent to an authorization webhook, with
+// only the allowlisted headers of r
+func NewWebhookRequest(r *http.Request, config *policy.WebhookConfig, ctx *policy.AuthContext) *WebhookRequest {
+	req := &WebhookRequest{
+		Method:   r.Method,
+		Path:     r.URL.RequestURI(),
+		ClientIP: GetClientIP(r),
+	}
+	if ctx != nil {
+		req.Subdomain, req.OrgID, req.AppID = ctx.Subdomain, ctx.OrgID, ctx.AppID
+	}
+
+	allowed := config.Headers
+	if len(allowed) == 0 {
+		allowed = DefaultWebhookHeaders
+	}
+	for _, name := range allowed {
+		if values := r.Header.Values(name); len(values) > 0 {
+			if req.Headers == nil {
+				req.Headers = make(map[string][]string)
+			}
+			req.Headers[name] = values
+		}
+	}
+	return req
+}
+
+// ValidateWebhookConfig checks an authorization webhook's URL and header
+// allowlist, returning the header names in canonical form
+func ValidateWebhookConfig(webhookURL string, headers []string) ([]string, error) {
+	if len(webhookURL) > maxWebhookURLLength {
+		return nil, fmt.Errorf("webhook URL must be at most %d characters", maxWebhookURLLength)
+	}
+	u, err := url.Parse(webhookURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" || u.User != nil {
+		return nil, fmt.Errorf("webhook requires an absolute https URL")
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !publicWebhookIP(ip) {
+		return nil, fmt.Errorf("webhook URL must point to a public address")
+	}
+
+	if len(headers) > MaxWebhookHeaders {
+		return nil, fmt.Errorf("at most %d webhook headers are allowed", MaxWebhookHeaders)
+	}
+	canonical := make([]string, 0, len(headers))
+	seen := make(map[string]bool, len(headers))
+	for _, name := range headers {
+		name = strings.TrimSpace(name)
+		if !validHeaderName(name) {
+			return nil, fmt.Errorf("invalid webhook header name %q", name)
+		}
+		name = http.CanonicalHeaderKey(name)
+		if webhookHopHeaders[name] {
+			return nil, fmt.Errorf("header %s cannot be forwarded to a webhook", name)
+		}
+		if !seen[name] {
+			seen[name] = true
+			canonical = append(canonical, name)
+		}
+	}
+	if len(canonical) == 0 {
+		return nil, nil
+	}
+	return canonical, nil
+}
+
+// checkWebhookAddress is the dialer's Control hook: it runs on the resolved
+// address of every connection to a webhook and refuses anything but a public IP
+func checkWebhookAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicWebhookIP(ip) {
+		return fmt.Errorf("webhook address %s is not public", host)
+	}
+	return nil
+}
+
+// publicWebhookIP reports whether ip may be called as a webhook: loopback,
+// private, link-local (including cloud metadata endpoints), multicast and
+// unspecified addresses are refused
+func publicWebhookIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified()
+}
+
+// validHeaderName checks that name is an RFC 9110 field name (a token)
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package client
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// statusClientClosedRequest is recorded for requests the visitor canceled before the local service answered
+const statusClientClosedRequest = 499
+
+// inflightRequests tracks the cancel functions of requests being forwarded so
+// the server can abort them when the visitor disconnects
+type inflightRequests struct {
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+// add registers a request and returns its context and a function releasing it
+func (r *inflightRequests) add(id string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r.mu.Lock()
+	if r.cancels == nil {
+		r.cancels = make(map[string]context.CancelFunc)
+	}
+	r.cancels[id] = cancel
+	r.mu.Unlock()
+
+	return ctx, func() {
+		r.mu.Lock()
+		delete(r.cancels, id)
+		r.mu.Unlock()
+		cancel()
+	}
+}
+
+// cancel aborts an in-flight request, reporting whether it was found
+func (r *inflightRequests) cancel(id string) bool {
+	r.mu.Lock()
+	cancel, ok := r.cancels[id]
+	r.mu.Unlock()
+
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// cancelOnStreamClose cancels a request when the server closes its stream.
+// The server sends nothing after the request frame, so any read result means
+// the visitor is gone or the response has been sent.
+func cancelOnStreamClose(stream net.Conn, cancel context.CancelFunc) {
+	var buf [1]byte
+	stream.Read(buf[:])
+	cancel()
+}
@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -87,21 +88,47 @@ func formatDuration(d time.Duration) string {
 type Client struct {
 	serverURL string
 	subdomain string
+	appID     string // Application to register for, if any
+	prefix    string // Prefix of the generated subdomain when none is given
 	token     string
 	secret    string // Legacy
 	localPort int
 	conn      *websocket.Conn
+	target    protocol.LocalTarget // Local service reported to the server
 	proxy     *Proxy
 	publicURL string
 	connected bool
 	mu        sync.RWMutex
-	done      chan struct{}
+
+	// Subdomain alternatives offered by the server on a conflict
+	suggestions []string
+
+	// Largest message the server accepts; larger responses are fragmented
+	maxMessageBytes int
+
+	// Subdomain and token from the last registration, to resume it after a dropped connection
+	registeredSubdomain string
+	reconnectToken      string
+	done                chan struct{}
 
 	// Reconnection settings
 	maxRetries     int
 	initialBackoff time.Duration
 	maxBackoff     time.Duration
 
+	// Inactivity auto-disconnect
+	idle *idleTracker
+
+	// Reconnect delay hinted by the server's shutdown notice
+	shutdown shutdownHint
+
+	// Requests being forwarded, so the server can cancel them
+	inflight inflightRequests
+
+	// Wait for the local service before registering
+	health   HealthCheck
+	degraded atomic.Bool // Register degraded until the local service is up
+
 	// Display
 	model  *Model
 	server string // Original server hostname for display
@@ -109,18 +136,23 @@ type Client struct {
 
 // Config holds client configuration
 type Config struct {
-	Server         string
-	Subdomain      string
-	Token          string
-	Secret         string // Legacy support
-	LocalPort      int
-	LocalAddr      string        // Local address to forward to (default: localhost)
-	LocalHTTPS     bool          // Use HTTPS for local forwarding
-	Timeout        time.Duration // Request timeout (default: 5 minutes)
-	MaxRetries     int
-	InitialBackoff time.Duration
-	MaxBackoff     time.Duration
-	Insecure       bool // Use ws:// instead of wss://
+	Server          string
+	Subdomain       string
+	AppID           string // Register for this application; the server assigns its subdomain
+	SubdomainPrefix string // Prefix of the subdomain the server generates when Subdomain is empty
+	Token           string
+	Secret          string // Legacy support
+	LocalPort       int
+	LocalAddr       string        // Local address to forward to (default: localhost)
+	LocalHTTPS      bool          // Use HTTPS for local forwarding
+	Timeout         time.Duration // Request timeout (default: 5 minutes)
+	MaxRetries      int
+	InitialBackoff  time.Duration
+	MaxBackoff      time.Duration
+	Insecure        bool          // Use ws:// instead of wss://
+	IdleTimeout     time.Duration // Disconnect after no requests for this long (0 disables)
+	LocalRetry      RetryPolicy   // Retries for failed local requests
+	LocalHealth     HealthCheck   // Wait for the local service before registering
 }
 
 // New creates a new tunnel client
@@ -152,17 +184,24 @@ func New(cfg Config) *Client {
 	c := &Client{
 		serverURL:      wsURL,
 		subdomain:      cfg.Subdomain,
+		appID:          cfg.AppID,
+		prefix:         cfg.SubdomainPrefix,
 		token:          cfg.Token,
 		secret:         cfg.Secret,
 		localPort:      cfg.LocalPort,
+		target:         protocol.LocalTarget{Address: cfg.LocalAddr, Port: cfg.LocalPort, HTTPS: cfg.LocalHTTPS},
 		proxy:          NewProxyWithTimeout(cfg.LocalAddr, cfg.LocalPort, cfg.LocalHTTPS, cfg.Timeout),
 		done:           make(chan struct{}),
 		maxRetries:     cfg.MaxRetries,
 		initialBackoff: cfg.InitialBackoff,
 		maxBackoff:     cfg.MaxBackoff,
 		server:         cfg.Server,
+		idle:           newIdleTracker(cfg.IdleTimeout),
+		health:         cfg.LocalHealth,
 	}
+	c.proxy.SetRetryPolicy(cfg.LocalRetry)
 	c.model = NewModel(c, cfg.Server, cfg.LocalAddr, cfg.LocalPort, cfg.LocalHTTPS)
+	c.model.SetIdleTimeout(cfg.IdleTimeout)
 	return c
 }
 
@@ -201,13 +240,22 @@ func (c *Client) Connect() error {
 
 	c.conn = conn
 
-	// Send registration request
+	// Send registration request, resuming the previous subdomain if we had one
+	subdomain := c.subdomain
+	if c.reconnectToken != "" {
+		subdomain = c.registeredSubdomain
+	}
 	regReq := protocol.Message{
 		Type: protocol.TypeRegisterRequest,
 		Payload: protocol.RegisterRequest{
-			Subdomain: c.subdomain,
-			Token:     c.token,
-			Secret:    c.secret, // Legacy support
+			Subdomain:       subdomain,
+			Token:           c.token,
+			AppID:           c.appID,
+			SubdomainPrefix: c.prefix,
+			Secret:          c.secret, // Legacy support
+			ReconnectToken:  c.reconnectToken,
+			Degraded:        c.degraded.Load(),
+			LocalTarget:     &c.target,
 		},
 	}
 
@@ -241,11 +289,15 @@ func (c *Client) Connect() error {
 	}
 
 	if !regResp.Success {
+		c.suggestions = regResp.Suggestions
 		conn.Close()
-		return fmt.Errorf("registration failed: %s", regResp.Error)
+		return &registrationError{code: regResp.Code, message: regResp.Error}
 	}
 
 	c.publicURL = regResp.URL
+	c.maxMessageBytes = regResp.MaxMessageBytes
+	c.registeredSubdomain = regResp.Subdomain
+	c.reconnectToken = regResp.ReconnectToken
 	c.connected = true
 
 	return nil
@@ -256,6 +308,15 @@ func (c *Client) Run() error {
 	retries := 0
 	backoff := c.initialBackoff
 
+	go c.idle.watch(c.done, func() {
+		if c.model != nil {
+			c.model.SendUpdate(IdleTimeoutMsg{Timeout: c.idle.timeout})
+		}
+	})
+
+	// Wait for the local service before registering
+	c.health.start([]*Proxy{c.proxy}, c.done, c.model, &c.degraded, c.sendHealthy)
+
 	for {
 		select {
 		case <-c.done:
@@ -265,15 +326,14 @@ func (c *Client) Run() error {
 
 		// Connect if not connected
 		if err := c.Connect(); err != nil {
-			errMsg := err.Error()
-
 			// Check if this is a fatal (non-retriable) error
-			if isFatalError(errMsg) {
+			if fatal, reason := connectFailure(err); fatal {
 				if c.model != nil {
 					c.model.SendUpdate(StatusUpdateMsg{
-						Status: "rejected",
-						Server: c.server,
-						Error:  extractErrorReason(errMsg),
+						Status:      "rejected",
+						Server:      c.server,
+						Error:       reason,
+						Suggestions: c.suggestions,
 					})
 				}
 				// For fatal errors, don't retry - just wait for quit
@@ -329,14 +389,19 @@ func (c *Client) Run() error {
 		}
 		c.mu.Unlock()
 
+		// Back off before reconnecting if the server announced a shutdown
+		delay := c.shutdown.take()
+
 		// Update model to show reconnecting status
 		if c.model != nil {
 			c.model.SendUpdate(StatusUpdateMsg{
-				Status:    "reconnecting",
-				Server:    c.server,
-				PublicURL: c.publicURL,
+				Status:       "reconnecting",
+				Server:       c.server,
+				PublicURL:    c.publicURL,
+				RetryBackoff: delay,
 			})
 		}
+		waitShutdownDelay(delay, c.done)
 	}
 }
 
@@ -368,20 +433,47 @@ func (c *Client) handleMessages() {
 			go c.handleHTTPRequestRaw(message.Payload)
 		case protocol.TypePing:
 			c.sendPong()
+		case protocol.TypeShutdown:
+			c.handleShutdown(message.Payload)
+		case protocol.TypeCancel:
+			var cancel protocol.CancelRequest
+			if err := json.Unmarshal(message.Payload, &cancel); err == nil {
+				c.inflight.cancel(cancel.ID)
+			}
 		}
 	}
 }
 
+// handleShutdown records the server's reconnect hint and notifies the model
+func (c *Client) handleShutdown(payload json.RawMessage) {
+	var notice protocol.ShutdownNotice
+	json.Unmarshal(payload, &notice)
+
+	delay := c.shutdown.set(notice.ReconnectDelay)
+	if c.model != nil {
+		c.model.SendUpdate(ShutdownMsg{
+			Message:        notice.Message,
+			ReconnectDelay: delay,
+		})
+	}
+}
+
 // handleHTTPRequestRaw handles an incoming HTTP request using raw JSON payload
 func (c *Client) handleHTTPRequestRaw(payload json.RawMessage) {
 	startTime := time.Now()
 
+	c.idle.begin()
+	defer c.idle.end()
+
 	// Parse request payload directly - no double serialization
 	var httpReq protocol.HTTPRequest
 	if err := json.Unmarshal(payload, &httpReq); err != nil {
 		return
 	}
 
+	// Let the server know the request arrived before the local service is involved
+	c.sendRequestAck(httpReq.ID)
+
 	// Calculate bytes received (request body)
 	bytesRecv := int64(len(httpReq.Body))
 
@@ -396,8 +488,23 @@ func (c *Client) handleHTTPRequestRaw(payload json.RawMessage) {
 	}
 
 	// Forward to local service
-	httpResp, err := c.proxy.Forward(&httpReq)
+	ctx, done := c.inflight.add(httpReq.ID)
+	defer done()
+
+	httpResp, err := c.proxy.Forward(ctx, &httpReq)
 	if err != nil {
+		if ctx.Err() != nil {
+			// The visitor disconnected; nobody is waiting for a response
+			if c.model != nil {
+				c.model.SendUpdate(RequestCompletedMsg{
+					ID:         httpReq.ID,
+					StatusCode: statusClientClosedRequest,
+					Duration:   time.Since(startTime),
+					BytesRecv:  bytesRecv,
+				})
+			}
+			return
+		}
 		httpResp = ForwardError(httpReq.ID, 502, err.Error())
 	}
 
@@ -425,9 +532,15 @@ func (c *Client) handleHTTPRequestRaw(payload json.RawMessage) {
 
 	data, _ := json.Marshal(respMsg)
 
+	// Fragments of one response must not interleave with other messages,
+	// so they are all written while holding the lock
 	c.mu.Lock()
 	if c.conn != nil {
-		c.conn.WriteMessage(websocket.TextMessage, data)
+		for _, part := range protocol.FragmentMessage(data, c.maxMessageBytes) {
+			if err := c.conn.WriteMessage(websocket.TextMessage, part); err != nil {
+				break
+			}
+		}
 	}
 	c.mu.Unlock()
 }
@@ -442,6 +555,32 @@ func (c *Client) sendPong() {
 	c.mu.Unlock()
 }
 
+// sendHealthy tells the server that the local service of a degraded tunnel is up
+func (c *Client) sendHealthy() {
+	healthMsg, _ := json.Marshal(protocol.Message{
+		Type:    protocol.TypeHealth,
+		Payload: protocol.HealthStatus{Healthy: true},
+	})
+	c.mu.Lock()
+	if c.conn != nil {
+		c.conn.WriteMessage(websocket.TextMessage, healthMsg)
+	}
+	c.mu.Unlock()
+}
+
+// sendRequestAck acknowledges that a request was received
+func (c *Client) sendRequestAck(requestID string) {
+	ackMsg, _ := json.Marshal(protocol.Message{
+		Type:    protocol.TypeRequestAck,
+		Payload: protocol.RequestAck{ID: requestID},
+	})
+	c.mu.Lock()
+	if c.conn != nil {
+		c.conn.WriteMessage(websocket.TextMessage, ackMsg)
+	}
+	c.mu.Unlock()
+}
+
 // Close closes the client connection
 func (c *Client) Close() {
 	close(c.done)
@@ -478,6 +617,7 @@ func isFatalError(errMsg string) bool {
 		"Subdomain already in use",
 		"Application not found",
 		"expired",
+		"Local target",
 	}
 
 	errLower := strings.ToLower(errMsg)
@@ -0,0 +1,269 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/version"
+)
+
+const (
+	// doctorTimeout bounds each network check of `digit-link doctor`
+	doctorTimeout = 10 * time.Second
+	// maxClockSkew is the largest clock difference TOTP codes tolerate (one 30s step)
+	maxClockSkew = 30 * time.Second
+	// certExpiryWarning is how close to expiry the server certificate is reported
+	certExpiryWarning = 14 * 24 * time.Hour
+	// defaultTunnelPort is the port TCP tunnel clients connect to when the server has none
+	defaultTunnelPort = "4443"
+)
+
+// DoctorConfig describes what `digit-link doctor` checks
+type DoctorConfig struct {
+	Server     string // Tunnel server address, e.g. link.digit.zone or link.digit.zone:4443
+	Token      string
+	LocalAddr  string // Local address (localhost, 127.0.0.1 or unix:/path/to.sock)
+	LocalPorts []int
+	Insecure   bool // Server is plain HTTP without TLS
+}
+
+// DoctorCheck is the outcome of one diagnostic check
+type DoctorCheck struct {
+	Name     string
+	Passed   bool
+	Critical bool // A failed critical check means the tunnel cannot work
+	Detail   string
+}
+
+// RunDoctor runs the diagnostic checks against the local target and the server
+func RunDoctor(cfg DoctorConfig) []DoctorCheck {
+	var checks []DoctorCheck
+	checks = append(checks, checkLocalTargets(cfg)...)
+
+	// The web endpoints are served on the default HTTPS port, the TCP tunnel on its own port
+	host, tunnelPort, err := net.SplitHostPort(cfg.Server)
+	if err != nil {
+		host, tunnelPort = cfg.Server, defaultTunnelPort
+	}
+
+	baseURL := webBaseURL(cfg.Server, cfg.Insecure)
+	if !cfg.Insecure {
+		checks = append(checks,
+			checkServerTLS("TLS certificate", net.JoinHostPort(host, "443"), true),
+			checkServerTLS("Tunnel port", net.JoinHostPort(host, tunnelPort), false),
+		)
+	}
+	httpClient := &http.Client{Timeout: doctorTimeout}
+
+	health, healthCheck := checkServerHealth(httpClient, baseURL)
+	checks = append(checks, healthCheck)
+	if health != nil {
+		checks = append(checks, checkClockSkew(health.Time, health.received))
+		checks = append(checks, checkClientVersion(health.clientVersions))
+	}
+	checks = append(checks, checkToken(httpClient, baseURL, cfg.Token))
+	return checks
+}
+
+// PrintDoctorReport writes a pass/fail report and returns false if any critical check failed
+func PrintDoctorReport(w io.Writer, checks []DoctorCheck) bool {
+	ok := true
+	fmt.Fprintf(w, "digit-link doctor (client %s)\n\n", version.Version)
+	for _, c := range checks {
+		mark := "PASS"
+		if !c.Passed {
+			mark = "WARN"
+			if c.Critical {
+				mark = "FAIL"
+				ok = false
+			}
+		}
+		fmt.Fprintf(w, "  [%s] %s: %s\n", mark, c.Name, c.Detail)
+	}
+	fmt.Fprintln(w)
+	if ok {
+		fmt.Fprintln(w, "All critical checks passed")
+	} else {
+		fmt.Fprintln(w, "Some critical checks failed")
+	}
+	return ok
+}
+
+// checkLocalTargets verifies that the local service accepts connections
+func checkLocalTargets(cfg DoctorConfig) []DoctorCheck {
+	if IsUnixSocketAddr(cfg.LocalAddr) {
+		path := UnixSocketPath(cfg.LocalAddr)
+		return []DoctorCheck{dialCheck("Local target "+cfg.LocalAddr, "unix", path)}
+	}
+	if len(cfg.LocalPorts) == 0 {
+		return []DoctorCheck{{Name: "Local target", Passed: false, Detail: "no local port given (use --port)"}}
+	}
+
+	host := cfg.LocalAddr
+	if host == "" {
+		host = "localhost"
+	}
+	var checks []DoctorCheck
+	for _, port := range cfg.LocalPorts {
+		addr := net.JoinHostPort(host, strconv.Itoa(port))
+		checks = append(checks, dialCheck("Local target "+addr, "tcp", addr))
+	}
+	return checks
+}
+
+// dialCheck opens and closes a connection to the local service
+func dialCheck(name, network, addr string) DoctorCheck {
+	conn, err := net.DialTimeout(network, addr, doctorTimeout)
+	if err != nil {
+		return DoctorCheck{Name: name, Critical: true, Detail: fmt.Sprintf("not reachable (%v); is the local service running?", err)}
+	}
+	conn.Close()
+	return DoctorCheck{Name: name, Passed: true, Critical: true, Detail: "accepting connections"}
+}
+
+// checkServerTLS verifies the certificate served on addr and reports when it expires
+func checkServerTLS(name, addr string, critical bool) DoctorCheck {
+	check := DoctorCheck{Name: name, Critical: critical}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: doctorTimeout}, "tcp", addr, &tls.Config{})
+	if err != nil {
+		check.Detail = fmt.Sprintf("handshake with %s failed: %v", addr, err)
+		return check
+	}
+	defer conn.Close()
+
+	cert := conn.ConnectionState().PeerCertificates[0]
+	remaining := time.Until(cert.NotAfter)
+	check.Passed = true
+	check.Detail = fmt.Sprintf("valid for %s, expires %s", strings.Join(cert.DNSNames, ", "), cert.NotAfter.Format("2006-01-02"))
+	if remaining < certExpiryWarning {
+		check.Passed = false
+		check.Critical = false
+		check.Detail = fmt.Sprintf("expires soon (%s)", cert.NotAfter.Format("2006-01-02"))
+	}
+	return check
+}
+
+// doctorHealth is the server's /api/health response plus when it was received
+type doctorHealth struct {
+	Status string    `json:"status"`
+	Time   time.Time `json:"time"`
+	clientVersions
+	received time.Time
+}
+
+// checkServerHealth checks that the server answers and reports its status
+func checkServerHealth(httpClient *http.Client, baseURL string) (*doctorHealth, DoctorCheck) {
+	check := DoctorCheck{Name: "Server", Critical: true}
+
+	resp, err := httpClient.Get(baseURL + "/api/health")
+	if err != nil {
+		check.Detail = fmt.Sprintf("not reachable: %v", err)
+		return nil, check
+	}
+	defer resp.Body.Close()
+
+	var health doctorHealth
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil || health.Time.IsZero() {
+		check.Detail = fmt.Sprintf("unexpected response (HTTP %d); server may be too old for doctor", resp.StatusCode)
+		return nil, check
+	}
+	health.received = time.Now()
+
+	check.Detail = health.Status
+	check.Passed = resp.StatusCode == http.StatusOK
+	return &health, check
+}
+
+// checkClockSkew compares the local clock with the server's; large skew breaks TOTP codes
+func checkClockSkew(serverTime, received time.Time) DoctorCheck {
+	skew := received.Sub(serverTime).Round(time.Second)
+	check := DoctorCheck{Name: "Clock skew", Passed: skew.Abs() <= maxClockSkew}
+	if check.Passed {
+		check.Detail = fmt.Sprintf("%s from server", skew)
+	} else {
+		check.Detail = fmt.Sprintf("local clock is %s off the server; TOTP codes will be rejected", skew)
+	}
+	return check
+}
+
+// checkClientVersion compares the running client with the versions the server advertises
+func checkClientVersion(versions clientVersions) DoctorCheck {
+	check := DoctorCheck{Name: "Client version", Passed: true, Detail: version.Version}
+	if notice := updateNotice(version.Version, versions); notice != nil {
+		check.Passed = !notice.Required
+		check.Detail = notice.Text()
+	}
+	return check
+}
+
+// checkToken validates the token with the server and reports what it connects as
+func checkToken(httpClient *http.Client, baseURL, token string) DoctorCheck {
+	check := DoctorCheck{Name: "Token", Critical: true}
+	if token == "" {
+		check.Detail = "no token given (use --token or DIGIT_LINK_TOKEN)"
+		return check
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/api/whoami", nil)
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		check.Detail = fmt.Sprintf("could not be checked: %v", err)
+		return check
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Error     string     `json:"error"`
+		Type      string     `json:"type"`
+		Username  string     `json:"username"`
+		AppID     string     `json:"appId"`
+		ExpiresAt *time.Time `json:"expiresAt"`
+		ClientIP  string     `json:"clientIp"`
+		IPAllowed bool       `json:"ipAllowed"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+
+	if resp.StatusCode != http.StatusOK {
+		check.Detail = fmt.Sprintf("rejected (HTTP %d)", resp.StatusCode)
+		if body.Error != "" {
+			check.Detail = "rejected: " + body.Error
+		}
+		return check
+	}
+	if !body.IPAllowed {
+		check.Detail = fmt.Sprintf("valid, but your IP %s is not whitelisted", body.ClientIP)
+		return check
+	}
+
+	check.Passed = true
+	switch {
+	case body.Username != "":
+		check.Detail = "valid account token for " + body.Username
+	case body.AppID != "":
+		check.Detail = "valid app API key"
+	default:
+		check.Detail = "valid API key"
+	}
+	if body.ExpiresAt != nil {
+		check.Detail += ", expires " + body.ExpiresAt.Format("2006-01-02")
+	}
+	return check
+}
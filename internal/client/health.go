@@ -0,0 +1,135 @@
+package client
+
+import (
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultHealthInterval is the wait between attempts to connect to the local service
+	DefaultHealthInterval = time.Second
+	// healthDialTimeout bounds a single attempt to connect to the local service
+	healthDialTimeout = time.Second
+)
+
+// HealthCheck controls waiting for the local service before the tunnel is registered,
+// so early visitors don't get 502s while it starts
+type HealthCheck struct {
+	Wait     time.Duration // Longest wait for the local service before registering (0 disables)
+	Interval time.Duration // Wait between connection attempts (default DefaultHealthInterval)
+	Degraded bool          // Register degraded when the wait times out, until the local service is up
+}
+
+// BackendHealthMsg reports the local service's health to the TUI
+type BackendHealthMsg struct {
+	Healthy  bool
+	Waiting  bool          // Still waiting before registering
+	Degraded bool          // Registered degraded; visitors get 503 until the service is up
+	Target   string        // Local target that is not accepting connections
+	Elapsed  time.Duration // Time spent waiting so far
+	Wait     time.Duration // Longest wait
+}
+
+// dialTarget returns the network and address of the proxy's local service
+func (p *Proxy) dialTarget() (network, addr string) {
+	if p.socketPath != "" {
+		return "unix", p.socketPath
+	}
+	addr = strings.TrimPrefix(p.localAddr, "http://")
+	return "tcp", strings.TrimPrefix(addr, "https://")
+}
+
+// probeTargets tries to connect to the local service of each proxy and returns
+// the first one that does not accept connections, or "" when all do
+func probeTargets(proxies []*Proxy) string {
+	for _, p := range proxies {
+		network, addr := p.dialTarget()
+		conn, err := net.DialTimeout(network, addr, healthDialTimeout)
+		if err != nil {
+			return addr
+		}
+		conn.Close()
+	}
+	return ""
+}
+
+// interval returns the wait between connection attempts
+func (h HealthCheck) interval() time.Duration {
+	if h.Interval <= 0 {
+		return DefaultHealthInterval
+	}
+	return h.Interval
+}
+
+// waitForBackend polls the local services until they all accept connections,
+// the wait times out or done is closed, reporting progress after each attempt.
+// It reports whether the services are up.
+func (h HealthCheck) waitForBackend(proxies []*Proxy, done <-chan struct{}, report func(BackendHealthMsg)) bool {
+	start := time.Now()
+	for {
+		target := probeTargets(proxies)
+		if target == "" {
+			report(BackendHealthMsg{Healthy: true})
+			return true
+		}
+
+		elapsed := time.Since(start)
+		if elapsed >= h.Wait {
+			report(BackendHealthMsg{Degraded: h.Degraded, Target: target, Elapsed: elapsed, Wait: h.Wait})
+			return false
+		}
+		report(BackendHealthMsg{Waiting: true, Target: target, Elapsed: elapsed, Wait: h.Wait})
+
+		select {
+		case <-time.After(min(h.interval(), h.Wait-elapsed)):
+		case <-done:
+			return false
+		}
+	}
+}
+
+// watchBackend polls the local services of a degraded tunnel until they all
+// accept connections, then calls onHealthy. It returns early when done is closed.
+func (h HealthCheck) watchBackend(proxies []*Proxy, done <-chan struct{}, onHealthy func()) {
+	ticker := time.NewTicker(h.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if probeTargets(proxies) == "" {
+				onHealthy()
+				return
+			}
+		}
+	}
+}
+
+// start waits for the local services before the first registration. When they
+// are still down after the wait and degraded registration is enabled, degraded
+// is set and the services are watched: once they are up, degraded is cleared
+// and sendHealthy tells the server.
+func (h HealthCheck) start(proxies []*Proxy, done <-chan struct{}, model *Model, degraded *atomic.Bool, sendHealthy func()) {
+	if h.Wait <= 0 {
+		return
+	}
+	report := func(msg BackendHealthMsg) {
+		if model != nil {
+			model.SendUpdate(msg)
+		}
+	}
+	if h.waitForBackend(proxies, done, report) || !h.Degraded {
+		return
+	}
+
+	degraded.Store(true)
+	go h.watchBackend(proxies, done, func() {
+		degraded.Store(false)
+		sendHealthy()
+		report(BackendHealthMsg{Healthy: true})
+	})
+}
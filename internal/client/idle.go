@@ -0,0 +1,69 @@
+package client
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// idleTracker tracks forwarding activity for the --idle-timeout auto-disconnect.
+// A tunnel is idle when no request is in flight and none finished within the timeout.
+type idleTracker struct {
+	timeout  time.Duration // Zero disables the auto-disconnect
+	last     atomic.Int64  // Unix nanos of the last request start/end
+	inFlight atomic.Int64
+	now      func() time.Time // Clock, replaced in tests
+}
+
+// newIdleTracker creates a tracker whose idle period starts now
+func newIdleTracker(timeout time.Duration) *idleTracker {
+	t := &idleTracker{timeout: timeout, now: time.Now}
+	t.touch()
+	return t
+}
+
+// touch records activity at the current time
+func (t *idleTracker) touch() {
+	t.last.Store(t.now().UnixNano())
+}
+
+// begin marks the start of a forwarded request
+func (t *idleTracker) begin() {
+	t.inFlight.Add(1)
+	t.touch()
+}
+
+// end marks the completion of a forwarded request
+func (t *idleTracker) end() {
+	t.inFlight.Add(-1)
+	t.touch()
+}
+
+// expired checks if the tunnel has been idle for longer than the timeout
+func (t *idleTracker) expired() bool {
+	if t.timeout <= 0 || t.inFlight.Load() > 0 {
+		return false
+	}
+	return t.now().Sub(time.Unix(0, t.last.Load())) >= t.timeout
+}
+
+// watch polls for idleness until done is closed, calling onIdle once when the timeout elapses
+func (t *idleTracker) watch(done <-chan struct{}, onIdle func()) {
+	if t.timeout <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if t.expired() {
+				onIdle()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+// newClockedIdleTracker returns a tracker reading the time from *now, with its
+// idle period starting at that time
+func newClockedIdleTracker(timeout time.Duration, now *time.Time) *idleTracker {
+	t := newIdleTracker(timeout)
+	t.now = func() time.Time { return *now }
+	t.touch()
+	return t
+}
+
+func TestIdleTracker(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracker := newClockedIdleTracker(time.Minute, &now)
+
+	now = now.Add(59 * time.Second)
+	if tracker.expired() {
+		t.Error("expired() before the timeout = true")
+	}
+	now = now.Add(time.Second)
+	if !tracker.expired() {
+		t.Error("expired() at the timeout = false")
+	}
+
+	// Activity resets the idle period
+	tracker.touch()
+	if tracker.expired() {
+		t.Error("expired() right after touch() = true")
+	}
+	now = now.Add(30 * time.Second)
+	tracker.begin()
+	tracker.end()
+	now = now.Add(59 * time.Second)
+	if tracker.expired() {
+		t.Error("expired() within the timeout of a finished request = true")
+	}
+	now = now.Add(time.Second)
+	if !tracker.expired() {
+		t.Error("expired() a timeout after the last request = false")
+	}
+
+	// A request in flight is never idle, however long it runs
+	tracker.begin()
+	now = now.Add(time.Hour)
+	if tracker.expired() {
+		t.Error("expired() with a request in flight = true")
+	}
+	tracker.end()
+	if tracker.expired() {
+		t.Error("expired() right after a long request ended = true")
+	}
+}
+
+func TestIdleTrackerDisabled(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracker := newClockedIdleTracker(0, &now)
+
+	now = now.Add(24 * time.Hour)
+	if tracker.expired() {
+		t.Error("expired() without a timeout = true")
+	}
+
+	// watch returns at once instead of polling
+	done := make(chan struct{})
+	returned := make(chan struct{})
+	go func() {
+		tracker.watch(done, func() { t.Error("onIdle called without a timeout") })
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		close(done)
+		t.Error("watch() without a timeout did not return")
+	}
+}
@@ -0,0 +1,267 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/niekvdm/digit-link/internal/tunnel"
+)
+
+// Metrics collects the client's status for the --metrics-addr endpoint from the
+// updates its tunnel sends to the model, so it covers TCP and WebSocket clients alike
+type Metrics struct {
+	mu sync.Mutex
+
+	startTime      time.Time
+	status         string
+	server         string
+	publicURL      string
+	tunnels        []tunnel.TunnelInfo
+	connectedSince time.Time
+	reconnects     int64
+
+	requests   map[string]int64  // Completed requests by status class (2xx, 3xx, ...)
+	inFlight   map[string]string // Method and path of requests in flight, by ID
+	bytesSent  int64
+	bytesRecv  int64
+	websockets int64 // Open WebSocket connections
+
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// MetricsStatus is the client status served as JSON on /status
+type MetricsStatus struct {
+	Status         string              `json:"status"`
+	Server         string              `json:"server,omitempty"`
+	PublicURL      string              `json:"publicUrl,omitempty"`
+	Forwards       []tunnel.TunnelInfo `json:"forwards"`
+	Uptime         float64             `json:"uptimeSeconds"`
+	ConnectedSince *time.Time          `json:"connectedSince,omitempty"`
+	Reconnects     int64               `json:"reconnects"`
+	Requests       map[string]int64    `json:"requests"`
+	RequestsTotal  int64               `json:"requestsTotal"`
+	InFlight       int                 `json:"inFlight"`
+	BytesSent      int64               `json:"bytesSent"`
+	BytesReceived  int64               `json:"bytesReceived"`
+	WebSockets     int64               `json:"websockets"`
+	LastError      string              `json:"lastError,omitempty"`
+	LastErrorAt    *time.Time          `json:"lastErrorAt,omitempty"`
+}
+
+// NewMetrics creates an empty metrics collector
+func NewMetrics() *Metrics {
+	return &Metrics{
+		startTime: time.Now(),
+		status:    "connecting",
+		requests:  make(map[string]int64),
+		inFlight:  make(map[string]string),
+	}
+}
+
+// observe records a model update
+func (mt *Metrics) observe(msg tea.Msg) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	switch msg := msg.(type) {
+	case StatusUpdateMsg:
+		if msg.Status == "reconnecting" && mt.status == "online" {
+			mt.reconnects++
+		}
+		mt.status = msg.Status
+		if msg.Server != "" {
+			mt.server = msg.Server
+		}
+		if msg.Status == "online" {
+			mt.connectedSince = time.Now()
+			mt.publicURL = msg.PublicURL
+			mt.tunnels = msg.Tunnels
+		}
+		if msg.Error != "" {
+			mt.setError(msg.Error)
+		}
+	case RequestAddedMsg:
+		mt.inFlight[msg.ID] = msg.Method + " " + msg.Path
+	case RequestCompletedMsg:
+		request := mt.inFlight[msg.ID]
+		delete(mt.inFlight, msg.ID)
+		mt.requests[statusClass(msg.StatusCode)]++
+		mt.bytesSent += msg.BytesSent
+		mt.bytesRecv += msg.BytesRecv
+		if msg.StatusCode >= 500 {
+			mt.setError(fmt.Sprintf("%s returned %d", strings.TrimSpace(request), msg.StatusCode))
+		}
+	case WebSocketConnectedMsg:
+		mt.websockets++
+	case WebSocketDataMsg:
+		mt.bytesSent += msg.BytesSent
+		mt.bytesRecv += msg.BytesRecv
+	case WebSocketClosedMsg:
+		if mt.websockets > 0 {
+			mt.websockets--
+		}
+	case BackendHealthMsg:
+		if !msg.Healthy && msg.Target != "" {
+			mt.setError(fmt.Sprintf("local service %s is not accepting connections", msg.Target))
+		}
+	}
+}
+
+// setError records the last error; the caller holds mt.mu
+func (mt *Metrics) setError(message string) {
+	mt.lastError = message
+	mt.lastErrorAt = time.Now()
+}
+
+// statusClass groups a status code as 2xx, 3xx, 4xx or 5xx
+func statusClass(code int) string {
+	if code < 100 || code > 599 {
+		return "other"
+	}
+	return fmt.Sprintf("%dxx", code/100)
+}
+
+// Status returns the current client status
+func (mt *Metrics) Status() MetricsStatus {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	status := MetricsStatus{
+		Status:        mt.status,
+		Server:        mt.server,
+		PublicURL:     mt.publicURL,
+		Forwards:      append([]tunnel.TunnelInfo{}, mt.tunnels...),
+		Uptime:        time.Since(mt.startTime).Seconds(),
+		Reconnects:    mt.reconnects,
+		Requests:      make(map[string]int64, len(mt.requests)),
+		InFlight:      len(mt.inFlight),
+		BytesSent:     mt.bytesSent,
+		BytesReceived: mt.bytesRecv,
+		WebSockets:    mt.websockets,
+		LastError:     mt.lastError,
+	}
+	for class, count := range mt.requests {
+		status.Requests[class] = count
+		status.RequestsTotal += count
+	}
+	if mt.status == "online" {
+		since := mt.connectedSince
+		status.ConnectedSince = &since
+	}
+	if !mt.lastErrorAt.IsZero() {
+		at := mt.lastErrorAt
+		status.LastErrorAt = &at
+	}
+	return status
+}
+
+// ServeHTTP serves the status as JSON on /status and in the Prometheus text
+// format on /metrics
+func (mt *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status := mt.Status()
+	switch r.URL.Path {
+	case "/", "/status":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	case "/metrics":
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writePrometheus(w, status)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// writePrometheus writes the status as Prometheus metrics
+func writePrometheus(w http.ResponseWriter, status MetricsStatus) {
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	connected := 0
+	if status.Status == "online" {
+		connected = 1
+	}
+	metric("digit_link_client_connected", "gauge", "Whether the tunnel is connected.")
+	fmt.Fprintf(w, "digit_link_client_connected %d\n", connected)
+
+	metric("digit_link_client_uptime_seconds", "gauge", "Seconds since the client started.")
+	fmt.Fprintf(w, "digit_link_client_uptime_seconds %.0f\n", status.Uptime)
+
+	metric("digit_link_client_reconnects_total", "counter", "Reconnects after the tunnel was lost.")
+	fmt.Fprintf(w, "digit_link_client_reconnects_total %d\n", status.Reconnects)
+
+	metric("digit_link_client_forwards", "gauge", "Registered forwards.")
+	fmt.Fprintf(w, "digit_link_client_forwards %d\n", len(status.Forwards))
+
+	metric("digit_link_client_requests_total", "counter", "Completed requests by status class.")
+	classes := make([]string, 0, len(status.Requests))
+	for class := range status.Requests {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		fmt.Fprintf(w, "digit_link_client_requests_total{code=%q} %d\n", class, status.Requests[class])
+	}
+
+	metric("digit_link_client_requests_in_flight", "gauge", "Requests being forwarded.")
+	fmt.Fprintf(w, "digit_link_client_requests_in_flight %d\n", status.InFlight)
+
+	metric("digit_link_client_bytes_sent_total", "counter", "Bytes sent to visitors.")
+	fmt.Fprintf(w, "digit_link_client_bytes_sent_total %d\n", status.BytesSent)
+
+	metric("digit_link_client_bytes_received_total", "counter", "Bytes received from visitors.")
+	fmt.Fprintf(w, "digit_link_client_bytes_received_total %d\n", status.BytesReceived)
+
+	metric("digit_link_client_websockets", "gauge", "Open WebSocket connections.")
+	fmt.Fprintf(w, "digit_link_client_websockets %d\n", status.WebSockets)
+}
+
+// localMetricsAddr returns the address to serve metrics on, which must be a
+// loopback address: a bare port like ":9090" binds 127.0.0.1
+func localMetricsAddr(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	if host == "" {
+		return net.JoinHostPort("127.0.0.1", port), nil
+	}
+	if host == "localhost" {
+		return addr, nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return "", fmt.Errorf("%s is not a loopback address; metrics are only served locally", host)
+	}
+	return addr, nil
+}
+
+// ServeMetrics serves the metrics on a local address in the background. It
+// returns the server, to close on exit, once it is listening; its Addr is the
+// address it listens on.
+func ServeMetrics(addr string, metrics *Metrics) (*http.Server, error) {
+	addr, err := localMetricsAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	server := &http.Server{Addr: listener.Addr().String(), Handler: metrics, ReadHeaderTimeout: 5 * time.Second}
+	go server.Serve(listener)
+	return server, nil
+}
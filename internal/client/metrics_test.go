@@ -0,0 +1,96 @@
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/niekvdm/digit-link/internal/tunnel"
+)
+
+func TestServeMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.observe(StatusUpdateMsg{Status: "online", Server: "link.test", PublicURL: "https://myapp.link.test", Tunnels: []tunnel.TunnelInfo{{Subdomain: "myapp"}}})
+	metrics.observe(RequestAddedMsg{ID: "1", Method: http.MethodGet, Path: "/ok"})
+	metrics.observe(RequestCompletedMsg{ID: "1", StatusCode: http.StatusOK, BytesSent: 120, BytesRecv: 30})
+	metrics.observe(RequestAddedMsg{ID: "2", Method: http.MethodPost, Path: "/fail"})
+	metrics.observe(RequestCompletedMsg{ID: "2", StatusCode: http.StatusBadGateway, BytesSent: 10})
+	metrics.observe(RequestAddedMsg{ID: "3", Method: http.MethodGet, Path: "/slow"})
+	metrics.observe(WebSocketConnectedMsg{})
+
+	if _, err := ServeMetrics("0.0.0.0:0", metrics); err == nil {
+		t.Error("ServeMetrics on a non-loopback address = nil, want error")
+	}
+	server, err := ServeMetrics("127.0.0.1:0", metrics)
+	if err != nil {
+		t.Fatalf("ServeMetrics() error: %v", err)
+	}
+	defer server.Close()
+	base := "http://" + server.Addr
+
+	get := func(path string) (*http.Response, string) {
+		t.Helper()
+		resp, err := http.Get(base + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	resp, body := get("/status")
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("/status Content-Type = %q, want application/json", ct)
+	}
+	var status MetricsStatus
+	if err := json.Unmarshal([]byte(body), &status); err != nil {
+		t.Fatalf("/status body %q: %v", body, err)
+	}
+	if status.Status != "online" || status.PublicURL != "https://myapp.link.test" || len(status.Forwards) != 1 || status.ConnectedSince == nil {
+		t.Errorf("/status connection = %+v, want online with one forward", status)
+	}
+	if status.RequestsTotal != 2 || status.Requests["2xx"] != 1 || status.Requests["5xx"] != 1 || status.InFlight != 1 {
+		t.Errorf("/status requests = %v (total %d, in flight %d), want one 2xx, one 5xx and one in flight", status.Requests, status.RequestsTotal, status.InFlight)
+	}
+	if status.BytesSent != 130 || status.BytesReceived != 30 || status.WebSockets != 1 {
+		t.Errorf("/status traffic = %d sent, %d received, %d websockets, want 130, 30, 1", status.BytesSent, status.BytesReceived, status.WebSockets)
+	}
+	if status.LastError != "POST /fail returned 502" || status.LastErrorAt == nil {
+		t.Errorf("/status last error = %q, want the failed request", status.LastError)
+	}
+
+	resp, body = get("/metrics")
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("/metrics Content-Type = %q, want the Prometheus text format", ct)
+	}
+	for _, line := range []string{
+		"# TYPE digit_link_client_connected gauge",
+		"digit_link_client_connected 1",
+		"digit_link_client_forwards 1",
+		`digit_link_client_requests_total{code="2xx"} 1`,
+		`digit_link_client_requests_total{code="5xx"} 1`,
+		"digit_link_client_requests_in_flight 1",
+		"digit_link_client_bytes_sent_total 130",
+		"digit_link_client_bytes_received_total 30",
+		"digit_link_client_websockets 1",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("/metrics missing %q in:\n%s", line, body)
+		}
+	}
+
+	if resp, _ := get("/other"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("/other status = %d, want 404", resp.StatusCode)
+	}
+	resp, err = http.Post(base+"/status", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST /status: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST /status status = %d, want 405", resp.StatusCode)
+	}
+}
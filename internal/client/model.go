@@ -11,6 +11,7 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/niekvdm/digit-link/internal/tunnel"
+	"github.com/niekvdm/digit-link/internal/version"
 )
 
 // Style definitions
@@ -144,6 +145,7 @@ type StatusUpdateMsg struct {
 	Error        string              // Error message for rejected/error status
 	RetryCount   int                 // Retry count when reconnecting
 	RetryBackoff time.Duration       // Backoff duration when reconnecting
+	Suggestions  []string            // Available subdomains offered on a conflict
 }
 
 type RequestAddedMsg struct {
@@ -168,6 +170,11 @@ type FastTickMsg time.Time // Fast tick for pending request timer updates
 
 type QuitMsg struct{}
 
+// IdleTimeoutMsg is sent when the tunnel is closed for inactivity
+type IdleTimeoutMsg struct {
+	Timeout time.Duration
+}
+
 // WebSocket connection messages
 type WebSocketConnectedMsg struct {
 	ID        string
@@ -206,7 +213,8 @@ type Model struct {
 	localPort    int
 	localAddr    string
 	localHTTPS   bool
-	errorMessage string // Error message when status is "rejected"
+	errorMessage string   // Error message when status is "rejected"
+	suggestions  []string // Available subdomains offered by the server on a conflict
 
 	requests    []RequestLog
 	maxRequests int
@@ -271,6 +279,30 @@ type Model struct {
 
 	// Deprecation notice (for WebSocket client)
 	deprecated bool
+
+	// QR code of the public URL (rendered once the URL is known)
+	showQR bool
+	qrURL  string
+	qrCode string
+
+	// Inactivity auto-disconnect countdown
+	idleTimeout  time.Duration
+	lastActivity time.Time
+	idleExpired  bool
+
+	// Server shutdown notice (shown until the tunnel is back online)
+	shutdownMessage string
+	shutdownDelay   time.Duration
+	shutdownAt      time.Time
+
+	// Local service health while waiting for it or registered degraded
+	backend BackendHealthMsg
+
+	// Newer client advertised by the server (nil while up to date)
+	updateNotice *UpdateNoticeMsg
+
+	// Status collected for the --metrics-addr endpoint
+	metrics *Metrics
 }
 
 // NewModel creates a new Bubbletea model
@@ -344,6 +376,44 @@ func NewTCPModel() *Model {
 	}
 }
 
+// SetShowQR enables rendering a QR code of the public URL once connected
+func (m *Model) SetShowQR(show bool) {
+	m.showQR = show
+}
+
+// SetMetrics collects the status updates sent to the model into metrics
+func (m *Model) SetMetrics(metrics *Metrics) {
+	m.metrics = metrics
+}
+
+// SetIdleTimeout enables the inactivity countdown display
+func (m *Model) SetIdleTimeout(timeout time.Duration) {
+	m.idleTimeout = timeout
+	m.lastActivity = time.Now()
+}
+
+// UpdateNotice returns the update notice shown in the TUI, or "" when none was shown
+func (m *Model) UpdateNotice() string {
+	if m.updateNotice == nil {
+		return ""
+	}
+	return m.updateNotice.Text()
+}
+
+// IdleExpired reports whether the TUI exited because of the inactivity timeout
+func (m *Model) IdleExpired() bool {
+	return m.idleExpired
+}
+
+// idleRemaining returns the time left before the inactivity auto-disconnect
+func (m *Model) idleRemaining() time.Duration {
+	remaining := m.idleTimeout - time.Since(m.lastActivity)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
 // Init initializes the model and returns initial commands
 func (m *Model) Init() tea.Cmd {
 	return tea.Batch(
@@ -471,6 +541,14 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if msg.Error != "" {
 			m.errorMessage = msg.Error
 		}
+		m.suggestions = msg.Suggestions
+		// Render QR code only after registration assigned a URL (and re-render if it changes)
+		if m.showQR && m.publicURL != "" && m.publicURL != m.qrURL {
+			if code, err := RenderQR(m.publicURL); err == nil {
+				m.qrURL = m.publicURL
+				m.qrCode = code
+			}
+		}
 		// Copy retry info for reconnecting status
 		m.retryCount = msg.RetryCount
 		m.retryBackoff = msg.RetryBackoff
@@ -478,6 +556,9 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if prevStatus == "reconnecting" && msg.Status == "online" {
 			m.reconnectCount++
 		}
+		if msg.Status == "online" {
+			m.shutdownMessage = ""
+		}
 		if msg.Status == "online" && (prevStatus == "connecting" || prevStatus == "reconnecting") {
 			m.connectionStart = time.Now()
 		}
@@ -496,6 +577,7 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		m.requests = append(m.requests, req)
 		m.totalRequests++
+		m.lastActivity = req.Time
 		if len(m.requests) > m.maxRequests {
 			m.requests = m.requests[1:]
 			// Adjust selectedIndex if needed
@@ -511,6 +593,7 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, tea.Batch(m.waitForUpdates(), m.fastTick(), cmd)
 
 	case RequestCompletedMsg:
+		m.lastActivity = time.Now()
 		for i := range m.requests {
 			if m.requests[i].ID == msg.ID {
 				m.requests[i].StatusCode = msg.StatusCode
@@ -573,6 +656,7 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, m.waitForUpdates()
 
 	case WebSocketClosedMsg:
+		m.lastActivity = time.Now()
 		for i := range m.wsConnections {
 			if m.wsConnections[i].ID == msg.ID {
 				m.wsConnections[i].Active = false
@@ -602,6 +686,27 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case QuitMsg:
 		return m, tea.Quit
 
+	case IdleTimeoutMsg:
+		m.idleExpired = true
+		return m, tea.Quit
+
+	case BackendHealthMsg:
+		m.backend = msg
+		return m, nil
+
+	case UpdateNoticeMsg:
+		m.updateNotice = &msg
+		return m, nil
+
+	case ShutdownMsg:
+		m.shutdownMessage = msg.Message
+		if m.shutdownMessage == "" {
+			m.shutdownMessage = "Server is shutting down"
+		}
+		m.shutdownDelay = msg.ReconnectDelay
+		m.shutdownAt = time.Now()
+		return m, nil
+
 	default:
 		// Handle spinner tick messages and other unknown messages
 		var cmd tea.Cmd
@@ -636,6 +741,22 @@ func (m *Model) getStatusBadge() string {
 	}
 }
 
+// renderBackendHealth describes the local service's health while it is not up
+func (m *Model) renderBackendHealth() string {
+	b := m.backend
+	warningStyle := lipgloss.NewStyle().Foreground(colorMustardYellow)
+	switch {
+	case b.Healthy || b.Target == "":
+		return ""
+	case b.Waiting:
+		return timeStyle.Render(fmt.Sprintf("Waiting for local service %s (%s of %s)", b.Target, formatUptime(b.Elapsed), formatUptime(b.Wait)))
+	case b.Degraded:
+		return warningStyle.Render(fmt.Sprintf("⚠ Local service %s is down, visitors get 503 until it is up", b.Target))
+	default:
+		return warningStyle.Render(fmt.Sprintf("⚠ Local service %s not up after %s, registered anyway", b.Target, formatUptime(b.Wait)))
+	}
+}
+
 // getMethodBadge returns the styled method badge
 func getMethodBadge(method string) string {
 	switch strings.ToUpper(method) {
@@ -705,6 +826,34 @@ func (m *Model) View() string {
 	}
 	content = append(content, statusLine)
 
+	// Inactivity countdown (paused while requests or WebSockets are active)
+	if m.idleTimeout > 0 && m.status == "online" {
+		idleText := "Idle disconnect in " + formatUptime(m.idleRemaining())
+		if m.activeWSConns > 0 || m.hasPendingRequests() {
+			idleText = "Idle disconnect paused (active requests)"
+		}
+		content = append(content, timeStyle.Render(idleText))
+	}
+
+	// Local service not up yet: waiting before registering, or degraded
+	if backendLine := m.renderBackendHealth(); backendLine != "" {
+		content = append(content, backendLine)
+	}
+
+	// Server shutdown banner with reconnect countdown
+	if m.shutdownMessage != "" {
+		content = append(content, "")
+		shutdownStyle := lipgloss.NewStyle().
+			Foreground(colorMustardYellow).
+			Bold(true)
+		content = append(content, shutdownStyle.Render("⚠ "+m.shutdownMessage))
+		if remaining := m.shutdownDelay - time.Since(m.shutdownAt); remaining > 0 {
+			content = append(content, timeStyle.Render("Reconnecting in "+formatUptime(remaining)))
+		} else {
+			content = append(content, timeStyle.Render("Reconnecting..."))
+		}
+	}
+
 	// Show error message if rejected
 	if m.status == "rejected" && m.errorMessage != "" {
 		content = append(content, "")
@@ -719,6 +868,12 @@ func (m *Model) View() string {
 		content = append(content, hintStyle.Render("Check your token, IP whitelist settings, or contact your administrator."))
 	}
 
+	// Offer the server's alternatives when the requested subdomain is taken
+	if len(m.suggestions) > 0 && m.status != "online" {
+		content = append(content, "")
+		content = append(content, labelStyle.Render("Available subdomains: ")+urlPublicStyle.Render(strings.Join(m.suggestions, ", ")))
+	}
+
 	// Show deprecation notice for WebSocket client
 	if m.deprecated {
 		content = append(content, "")
@@ -729,7 +884,11 @@ func (m *Model) View() string {
 	}
 
 	content = append(content, "")
-	content = append(content, labelStyle.Render("Version")+valueStyle.MarginLeft(2).Render("1.0.0"))
+	content = append(content, labelStyle.Render("Version")+valueStyle.MarginLeft(2).Render(version.Version))
+	if m.updateNotice != nil {
+		updateStyle := lipgloss.NewStyle().Foreground(colorMustardYellow)
+		content = append(content, updateStyle.Render("⬆ "+m.updateNotice.Text()))
+	}
 	content = append(content, labelStyle.Render("Server")+valueStyle.MarginLeft(2).Render(m.server))
 
 	// Forwarding section - show all tunnels if multi-forward, otherwise single line
@@ -756,9 +915,13 @@ func (m *Model) View() string {
 		if m.localHTTPS {
 			localScheme = "https"
 		}
+		localTarget := fmt.Sprintf("%s://%s:%d", localScheme, m.localAddr, m.localPort)
+		if IsUnixSocketAddr(m.localAddr) {
+			localTarget = fmt.Sprintf("%s+%s", localScheme, m.localAddr)
+		}
 		forwarding := urlPublicStyle.Render(forwardingText) +
 			" → " +
-			urlLocalStyle.Render(fmt.Sprintf("%s://%s:%d", localScheme, m.localAddr, m.localPort))
+			urlLocalStyle.Render(localTarget)
 		content = append(content, labelStyle.Render("Forwarding")+valueStyle.MarginLeft(2).Render(forwarding))
 	}
 
@@ -767,6 +930,12 @@ func (m *Model) View() string {
 		clipStyle := lipgloss.NewStyle().Foreground(colorGreen).Italic(true)
 		content = append(content, clipStyle.Render("  "+m.clipboardMsg))
 	}
+
+	// QR code of the public URL for quick mobile testing
+	if m.showQR && m.qrCode != "" {
+		content = append(content, "")
+		content = append(content, m.qrCode)
+	}
 	content = append(content, "")
 
 	// Stats Section with tabs
@@ -1134,6 +1303,9 @@ func (m *Model) waitForUpdates() tea.Cmd {
 
 // SendUpdate sends a message to the model via the update channel
 func (m *Model) SendUpdate(msg tea.Msg) {
+	if m.metrics != nil {
+		m.metrics.observe(msg)
+	}
 	select {
 	case m.updateCh <- msg:
 	default:
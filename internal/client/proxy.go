@@ -3,12 +3,15 @@ package client
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"net"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
@@ -93,7 +96,14 @@ func (p *Proxy) ForwardWebSocket(method, path string, headers map[string]string,
 	// Connect to local service
 	var conn net.Conn
 	var err error
-	if isHTTPS {
+	if p.socketPath != "" {
+		conn, err = net.DialTimeout("unix", p.socketPath, 10*time.Second)
+		if err == nil && isHTTPS {
+			conn = tls.Client(conn, &tls.Config{
+				InsecureSkipVerify: true, // Local services often use self-signed certs
+			})
+		}
+	} else if isHTTPS {
 		// Use TLS for HTTPS local services
 		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", host, &tls.Config{
 			InsecureSkipVerify: true, // Local services often use self-signed certs
@@ -109,16 +119,14 @@ func (p *Proxy) ForwardWebSocket(method, path string, headers map[string]string,
 	var reqBuf bytes.Buffer
 	fmt.Fprintf(&reqBuf, "%s %s HTTP/1.1\r\n", method, path)
 
-	// Write headers - include Connection and Upgrade for WebSocket
-	// But rewrite the Host header to match the local service
+	// Write headers - include Connection and Upgrade for WebSocket.
+	// The server only sends Host when the app preserves the visitor's host or
+	// sets a custom one; otherwise it is set to the local service address
 	wroteHost := false
 	for key, value := range headers {
-		// Rewrite Host header to local service address
+		fmt.Fprintf(&reqBuf, "%s: %s\r\n", key, value)
 		if strings.EqualFold(key, "Host") {
-			fmt.Fprintf(&reqBuf, "Host: %s\r\n", host)
 			wroteHost = true
-		} else {
-			fmt.Fprintf(&reqBuf, "%s: %s\r\n", key, value)
 		}
 	}
 	// Ensure Host header is always present (required for HTTP/1.1)
@@ -174,13 +182,29 @@ func (p *Proxy) ForwardWebSocket(method, path string, headers map[string]string,
 
 // Proxy handles forwarding requests to the local service
 type Proxy struct {
-	localAddr string
-	client    *http.Client
+	localAddr  string
+	socketPath string // Unix socket path (empty when forwarding over TCP)
+	client     *http.Client
+	grpcClient *http.Client // HTTP/2 only, for gRPC calls
+	retry      RetryPolicy  // Retries for failed local requests (none by default)
 }
 
 // DefaultTimeout is the default timeout for forwarding requests (5 minutes)
 const DefaultTimeout = 5 * time.Minute
 
+// unixSocketPrefix marks a local address as a Unix domain socket path
+const unixSocketPrefix = "unix:"
+
+// IsUnixSocketAddr checks if a local address refers to a Unix domain socket (unix:/path/to.sock)
+func IsUnixSocketAddr(addr string) bool {
+	return strings.HasPrefix(addr, unixSocketPrefix)
+}
+
+// UnixSocketPath returns the socket path from a unix:/path/to.sock address
+func UnixSocketPath(addr string) string {
+	return strings.TrimPrefix(addr, unixSocketPrefix)
+}
+
 // NewProxy creates a new local proxy
 func NewProxy(localAddr string, localPort int, useHTTPS bool) *Proxy {
 	return NewProxyWithTimeout(localAddr, localPort, useHTTPS, DefaultTimeout)
@@ -192,25 +216,55 @@ func NewProxyWithTimeout(localAddr string, localPort int, useHTTPS bool, timeout
 	if useHTTPS {
 		scheme = "https"
 	}
-	return &Proxy{
+
+	transport := &http.Transport{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 100,
+		IdleConnTimeout:     90 * time.Second,
+		DisableKeepAlives:   false,
+	}
+
+	p := &Proxy{
 		localAddr: fmt.Sprintf("%s://%s:%d", scheme, localAddr, localPort),
 		client: &http.Client{
-			Timeout: timeout,
-			Transport: &http.Transport{
-				MaxIdleConns:        100,
-				MaxIdleConnsPerHost: 100,
-				IdleConnTimeout:     90 * time.Second,
-				DisableKeepAlives:   false,
-			},
+			Timeout:   timeout,
+			Transport: transport,
 			CheckRedirect: func(req *http.Request, via []*http.Request) error {
 				return http.ErrUseLastResponse // Don't follow redirects
 			},
 		},
 	}
+
+	// gRPC needs HTTP/2 to the local service: negotiated over TLS, otherwise
+	// with prior knowledge (h2c). Server-streaming calls last until the caller
+	// hangs up, so only the request context ends them.
+	grpcTransport := &http.Transport{
+		IdleConnTimeout: 90 * time.Second,
+		Protocols:       new(http.Protocols),
+	}
+	if useHTTPS {
+		grpcTransport.Protocols.SetHTTP2(true)
+	} else {
+		grpcTransport.Protocols.SetUnencryptedHTTP2(true)
+	}
+	p.grpcClient = &http.Client{Transport: grpcTransport}
+
+	// Unix socket mode: every request is dialed to the socket, the URL host is a placeholder
+	if IsUnixSocketAddr(localAddr) {
+		p.socketPath = UnixSocketPath(localAddr)
+		p.localAddr = scheme + "://localhost"
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", p.socketPath)
+		}
+		grpcTransport.DialContext = transport.DialContext
+	}
+
+	return p
 }
 
 // Forward forwards an HTTP request to the local service and returns the response
-func (p *Proxy) Forward(req *protocol.HTTPRequest) (*protocol.HTTPResponse, error) {
+func (p *Proxy) Forward(ctx context.Context, req *protocol.HTTPRequest) (*protocol.HTTPResponse, error) {
 	// Build local request URL
 	url := p.localAddr + req.Path
 
@@ -220,7 +274,7 @@ func (p *Proxy) Forward(req *protocol.HTTPRequest) (*protocol.HTTPResponse, erro
 		body = bytes.NewReader(req.Body)
 	}
 
-	httpReq, err := http.NewRequest(req.Method, url, body)
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, url, body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -230,14 +284,21 @@ func (p *Proxy) Forward(req *protocol.HTTPRequest) (*protocol.HTTPResponse, erro
 		// Skip hop-by-hop headers
 		switch key {
 		case "Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
-			"Te", "Trailers", "Transfer-Encoding", "Upgrade":
+			"Te", "Trailers", "Upgrade":
+			continue
+		case "Transfer-Encoding":
+			setChunked(httpReq, value)
+			continue
+		case "Host":
+			// Only sent when the app preserves the visitor's host; otherwise the local address is used
+			httpReq.Host = value
 			continue
 		}
 		httpReq.Header.Set(key, value)
 	}
 
 	// Execute request
-	resp, err := p.client.Do(httpReq)
+	resp, err := p.do(ctx, httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to forward request: %w", err)
 	}
@@ -258,8 +319,9 @@ func (p *Proxy) Forward(req *protocol.HTTPRequest) (*protocol.HTTPResponse, erro
 			"Te", "Trailers", "Transfer-Encoding", "Upgrade":
 			continue
 		}
-		headers[key] = values[0]
+		headers[key] = responseHeaderValue(key, values)
 	}
+	reportChunked(headers, resp)
 
 	return &protocol.HTTPResponse{
 		ID:         req.ID,
@@ -269,6 +331,55 @@ func (p *Proxy) Forward(req *protocol.HTTPRequest) (*protocol.HTTPResponse, erro
 	}, nil
 }
 
+// responseHeaderValue flattens a response header for the single-value tunnel protocol.
+// Vary may be split over several lines, and caches need every listed field, so
+// its values are joined; other headers keep their first value.
+func responseHeaderValue(key string, values []string) string {
+	if key == "Vary" && len(values) > 1 {
+		return strings.Join(values, ", ")
+	}
+	return values[0]
+}
+
+// setChunked sends the request body chunked when the server forwards a chunked
+// request (only for apps that keep chunked encoding); otherwise it is sent with a
+// Content-Length
+func setChunked(httpReq *http.Request, transferEncoding string) {
+	if strings.EqualFold(transferEncoding, "chunked") && httpReq.Body != nil {
+		httpReq.TransferEncoding = []string{"chunked"}
+	}
+}
+
+// reportChunked tells the server that the local service sent a chunked response.
+// The server decides whether the visitor gets it chunked.
+func reportChunked(headers map[string]string, resp *http.Response) {
+	if slices.Contains(resp.TransferEncoding, "chunked") {
+		headers["Transfer-Encoding"] = "chunked"
+	}
+}
+
+// streamingContentTypes are media types whose bodies are consumed as they
+// arrive, such as newline-delimited JSON logs and server-sent events
+var streamingContentTypes = map[string]bool{
+	"application/x-ndjson":    true,
+	"application/ndjson":      true,
+	"application/jsonl":       true,
+	"application/jsonlines":   true,
+	"application/x-jsonlines": true,
+	"text/event-stream":       true,
+}
+
+// isStreamingResponse reports whether a response should be relayed as it
+// arrives instead of buffered: a streaming content type sent without a
+// Content-Length, so chunked or until the connection closes
+func isStreamingResponse(resp *http.Response) bool {
+	if resp.ContentLength >= 0 {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return streamingContentTypes[mediaType]
+}
+
 // ForwardError creates an error response for failed requests
 func ForwardError(requestID string, statusCode int, message string) *protocol.HTTPResponse {
 	body, _ := json.Marshal(map[string]string{"error": message})
@@ -282,7 +393,82 @@ func ForwardError(requestID string, statusCode int, message string) *protocol.HT
 
 // ForwardRaw forwards a raw HTTP request and returns a tunnel.ResponseFrame
 // Used by the TCP client for yamux-based forwarding
-func (p *Proxy) ForwardRaw(method, path string, headers map[string]string, reqBody []byte) (*tunnel.ResponseFrame, error) {
+func (p *Proxy) ForwardRaw(ctx context.Context, method, path string, headers map[string]string, reqBody []byte) (*tunnel.ResponseFrame, error) {
+	return p.forwardRaw(ctx, method, path, headers, reqBody, false)
+}
+
+// ForwardStreaming forwards a raw HTTP request like ForwardRaw, but always
+// relays the response body as it arrives, for apps in streaming mode
+func (p *Proxy) ForwardStreaming(ctx context.Context, method, path string, headers map[string]string, reqBody []byte) (*tunnel.ResponseFrame, error) {
+	return p.forwardRaw(ctx, method, path, headers, reqBody, true)
+}
+
+func (p *Proxy) forwardRaw(ctx context.Context, method, path string, headers map[string]string, reqBody []byte, stream bool) (*tunnel.ResponseFrame, error) {
+	httpReq, err := p.rawRequest(ctx, method, path, headers, reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.do(ctx, httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to forward request: %w", err)
+	}
+
+	respHeaders := rawResponseHeaders(resp.Header)
+	reportChunked(respHeaders, resp)
+
+	// Streamed bodies are passed on as they arrive; the caller closes them
+	if stream || isStreamingResponse(resp) {
+		return &tunnel.ResponseFrame{
+			Status:     resp.StatusCode,
+			Headers:    respHeaders,
+			Stream:     true,
+			BodyStream: resp.Body,
+		}, nil
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	return &tunnel.ResponseFrame{
+		Status:  resp.StatusCode,
+		Headers: respHeaders,
+		Body:    respBody,
+	}, nil
+}
+
+// ForwardGRPC forwards a gRPC call to the local service over HTTP/2. The body
+// is streamed, so server-streaming calls reach the caller message by message,
+// and the trailers with the call's status follow it. Calls are not retried.
+func (p *Proxy) ForwardGRPC(ctx context.Context, method, path string, headers map[string]string, reqBody []byte) (*tunnel.ResponseFrame, error) {
+	httpReq, err := p.rawRequest(ctx, method, path, headers, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Te", "trailers") // gRPC servers require it
+
+	resp, err := p.grpcClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to forward gRPC call: %w", err)
+	}
+
+	return &tunnel.ResponseFrame{
+		Status:     resp.StatusCode,
+		Headers:    rawResponseHeaders(resp.Header),
+		Stream:     true,
+		Trailers:   true,
+		BodyStream: resp.Body,
+		Trailer: func() map[string]string {
+			return rawResponseHeaders(resp.Trailer)
+		},
+	}, nil
+}
+
+// rawRequest builds the local request for a request forwarded over the TCP tunnel
+func (p *Proxy) rawRequest(ctx context.Context, method, path string, headers map[string]string, reqBody []byte) (*http.Request, error) {
 	url := p.localAddr + path
 
 	var body io.Reader
@@ -290,7 +476,7 @@ func (p *Proxy) ForwardRaw(method, path string, headers map[string]string, reqBo
 		body = bytes.NewReader(reqBody)
 	}
 
-	httpReq, err := http.NewRequest(method, url, body)
+	httpReq, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -298,36 +484,34 @@ func (p *Proxy) ForwardRaw(method, path string, headers map[string]string, reqBo
 	for key, value := range headers {
 		switch key {
 		case "Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
-			"Te", "Trailers", "Transfer-Encoding", "Upgrade":
+			"Te", "Trailers", "Upgrade":
+			continue
+		case "Transfer-Encoding":
+			setChunked(httpReq, value)
+			continue
+		case "Host":
+			httpReq.Host = value
 			continue
 		}
 		httpReq.Header.Set(key, value)
 	}
+	return httpReq, nil
+}
 
-	resp, err := p.client.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("failed to forward request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	respHeaders := make(map[string]string)
-	for key, values := range resp.Header {
+// rawResponseHeaders flattens the local service's response headers or
+// trailers for the tunnel, leaving out hop-by-hop headers
+func rawResponseHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string)
+	for key, values := range header {
+		if len(values) == 0 {
+			continue // A declared trailer that was never sent
+		}
 		switch key {
 		case "Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
 			"Te", "Trailers", "Transfer-Encoding", "Upgrade":
 			continue
 		}
-		respHeaders[key] = values[0]
+		headers[key] = responseHeaderValue(key, values)
 	}
-
-	return &tunnel.ResponseFrame{
-		Status:  resp.StatusCode,
-		Headers: respHeaders,
-		Body:    respBody,
-	}, nil
+	return headers
 }
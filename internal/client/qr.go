@@ -0,0 +1,53 @@
+package client
+
+import (
+	"image/color"
+	"strings"
+
+	"github.com/boombuler/barcode/qr"
+)
+
+// qrQuietZone is the number of blank modules around the code (scanners need a margin)
+const qrQuietZone = 2
+
+// RenderQR renders content as a terminal QR code using half-block characters,
+// packing two module rows into each text line
+func RenderQR(content string) (string, error) {
+	code, err := qr.Encode(content, qr.M, qr.Auto)
+	if err != nil {
+		return "", err
+	}
+
+	size := code.Bounds().Dx()
+	dark := func(x, y int) bool {
+		x -= qrQuietZone
+		y -= qrQuietZone
+		if x < 0 || y < 0 || x >= size || y >= size {
+			return false
+		}
+		return code.At(x, y) == color.Black
+	}
+
+	total := size + 2*qrQuietZone
+	var b strings.Builder
+	for y := 0; y < total; y += 2 {
+		for x := 0; x < total; x++ {
+			// Light modules are drawn as blocks so the code reads on dark terminals
+			top, bottom := !dark(x, y), !dark(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		if y+2 < total {
+			b.WriteString("\n")
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/boombuler/barcode/qr"
+)
+
+func TestRenderQR(t *testing.T) {
+	const url = "https://myapp.link.digit.zone"
+	out, err := RenderQR(url)
+	if err != nil {
+		t.Fatalf("RenderQR() error: %v", err)
+	}
+
+	code, err := qr.Encode(url, qr.M, qr.Auto)
+	if err != nil {
+		t.Fatalf("qr.Encode() error: %v", err)
+	}
+	total := code.Bounds().Dx() + 2*qrQuietZone
+
+	// Two module rows per line, every line as wide as the code plus its quiet zone
+	lines := strings.Split(out, "\n")
+	if want := (total + 1) / 2; len(lines) != want {
+		t.Fatalf("RenderQR() = %d lines, want %d", len(lines), want)
+	}
+	for i, line := range lines {
+		if n := utf8.RuneCountInString(line); n != total {
+			t.Errorf("line %d is %d modules wide, want %d", i, n, total)
+		}
+	}
+
+	// The quiet zone is light, and the top-left finder pattern starts with a dark corner
+	if lines[0] != strings.Repeat("█", total) {
+		t.Errorf("first line = %q, want the light quiet zone", lines[0])
+	}
+	if corner := []rune(lines[1])[qrQuietZone]; corner != ' ' {
+		t.Errorf("finder pattern corner = %q, want two dark modules", corner)
+	}
+}
+
+func TestRenderQRTooLong(t *testing.T) {
+	// Past the capacity of the largest QR code at medium error correction
+	if out, err := RenderQR("https://myapp.link.digit.zone/?q=" + strings.Repeat("x", 3000)); err == nil {
+		t.Errorf("RenderQR() of 3000 bytes = %d bytes of output, want error", len(out))
+	}
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"errors"
+
+	"github.com/niekvdm/digit-link/internal/protocol"
+)
+
+// registrationError is a registration the server rejected
+type registrationError struct {
+	code    protocol.RegisterCode // Empty from servers that predate reason codes
+	message string
+}
+
+func (e *registrationError) Error() string {
+	return "registration failed: " + e.message
+}
+
+// registerCodeHints tell the user what to do about a rejection
+var registerCodeHints = map[protocol.RegisterCode]string{
+	protocol.RegisterCodeAuthRequired:     "pass a token with --token",
+	protocol.RegisterCodeInvalidToken:     "check the token passed with --token",
+	protocol.RegisterCodeIPNotWhitelisted: "ask an administrator to whitelist this machine's IP address",
+	protocol.RegisterCodeAppNotFound:      "check the --app ID and that the token belongs to its organization",
+	protocol.RegisterCodeAppSubdomain:     "leave out --subdomain to use the application's",
+	protocol.RegisterCodeAppReleased:      "ask an administrator to restore the application",
+	protocol.RegisterCodeInvalidSubdomain: "choose another subdomain",
+	protocol.RegisterCodeQuotaExceeded:    "the organization's plan limit is reached; ask an administrator",
+	protocol.RegisterCodeLocalTarget:      "forward to a local address and port the server allows",
+}
+
+// retryableRegisterCodes are rejections that registering again may get past
+var retryableRegisterCodes = map[protocol.RegisterCode]bool{
+	protocol.RegisterCodeInternal:        true,
+	protocol.RegisterCodeNoFreeSubdomain: true,
+}
+
+// knownRegisterCodes are the codes the client decides on; unknown codes from
+// newer servers are handled like rejections without a code
+var knownRegisterCodes = map[protocol.RegisterCode]bool{
+	protocol.RegisterCodeAuthRequired:     true,
+	protocol.RegisterCodeInvalidToken:     true,
+	protocol.RegisterCodeTokenExpired:     true,
+	protocol.RegisterCodeIPNotWhitelisted: true,
+	protocol.RegisterCodeAppNotFound:      true,
+	protocol.RegisterCodeAppSubdomain:     true,
+	protocol.RegisterCodeAppReleased:      true,
+	protocol.RegisterCodeInvalidSubdomain: true,
+	protocol.RegisterCodeSubdomainTaken:   true,
+	protocol.RegisterCodeNoFreeSubdomain:  true,
+	protocol.RegisterCodeQuotaExceeded:    true,
+	protocol.RegisterCodeLocalTarget:      true,
+	protocol.RegisterCodeInternal:         true,
+	protocol.RegisterCodeInvalidRequest:   true,
+}
+
+// connectFailure reports whether a connection error is fatal (not worth
+// retrying) and the reason to show. Rejections with a reason code decide on the
+// code; other errors, e.g. from older servers, on their message.
+func connectFailure(err error) (fatal bool, reason string) {
+	var regErr *registrationError
+	if errors.As(err, &regErr) && knownRegisterCodes[regErr.code] {
+		reason = regErr.message
+		if hint := registerCodeHints[regErr.code]; hint != "" {
+			reason += " (" + hint + ")"
+		}
+		return !retryableRegisterCodes[regErr.code], reason
+	}
+	return isFatalError(err.Error()), extractErrorReason(err.Error())
+}
@@ -0,0 +1,137 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DefaultRetryBackoff is the wait before the first retry of a local request
+const DefaultRetryBackoff = 250 * time.Millisecond
+
+// DefaultRetryOn is the default list of conditions that trigger a retry
+const DefaultRetryOn = "refused"
+
+// RetryPolicy controls retrying local requests while the local service restarts.
+// Connection-refused retries apply to every method since the request never reached the service;
+// resets and status retries only repeat idempotent requests.
+type RetryPolicy struct {
+	Retries  int           // Extra attempts after the first (0 disables retrying)
+	Backoff  time.Duration // Wait before the first retry, doubled for each further retry
+	Refused  bool          // Retry when the connection is refused (or the Unix socket is missing)
+	Reset    bool          // Retry when the connection is reset or closed before a response
+	Statuses []int         // Retry when the local service answers with one of these statuses
+}
+
+// ParseRetryOn parses a comma-separated retry condition list like "refused,reset,502,503"
+// into the conditions of a policy
+func ParseRetryOn(s string) (RetryPolicy, error) {
+	var p RetryPolicy
+	for _, part := range strings.Split(s, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		switch part {
+		case "":
+			continue
+		case "refused":
+			p.Refused = true
+		case "reset":
+			p.Reset = true
+		default:
+			status, err := strconv.Atoi(part)
+			if err != nil || status < 400 || status > 599 {
+				return RetryPolicy{}, fmt.Errorf("invalid retry condition %q (expected refused, reset or a 4xx/5xx status)", part)
+			}
+			p.Statuses = append(p.Statuses, status)
+		}
+	}
+	return p, nil
+}
+
+// retryableError reports whether a failed attempt may be retried under the policy
+func (p RetryPolicy) retryableError(err error, method string) bool {
+	if p.Refused && (errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ENOENT)) {
+		return true
+	}
+	if p.Reset && isIdempotent(method) &&
+		(errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)) {
+		return true
+	}
+	return false
+}
+
+// retryableStatus reports whether a response status may be retried under the policy
+func (p RetryPolicy) retryableStatus(status int, method string) bool {
+	if !isIdempotent(method) {
+		return false
+	}
+	for _, s := range p.Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// isIdempotent reports whether repeating a request with this method is safe
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// SetRetryPolicy sets how failed local requests are retried
+func (p *Proxy) SetRetryPolicy(policy RetryPolicy) {
+	p.retry = policy
+}
+
+// do executes a local request, retrying according to the proxy's retry policy.
+// The request body must be replayable (set by http.NewRequest for byte readers).
+func (p *Proxy) do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	backoff := p.retry.Backoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+
+		resp, err := p.client.Do(req)
+		if attempt >= p.retry.Retries || ctx.Err() != nil {
+			return resp, err
+		}
+		if err != nil {
+			if !p.retry.retryableError(err, req.Method) {
+				return nil, err
+			}
+		} else if p.retry.retryableStatus(resp.StatusCode, req.Method) {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		} else {
+			return resp, nil
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/protocol"
+)
+
+func TestProxyRetriesLocalRequests(t *testing.T) {
+	var attempts int
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+
+	backendURL, _ := url.Parse(backend.URL)
+	port, _ := strconv.Atoi(backendURL.Port())
+	proxy := NewProxy(backendURL.Hostname(), port, false)
+
+	retry, err := ParseRetryOn("refused,503")
+	if err != nil {
+		t.Fatalf("ParseRetryOn() error: %v", err)
+	}
+	retry.Retries = 3
+	retry.Backoff = time.Millisecond
+	proxy.SetRetryPolicy(retry)
+
+	resp, err := proxy.Forward(context.Background(), &protocol.HTTPRequest{ID: "req", Method: http.MethodGet, Path: "/"})
+	if err != nil {
+		t.Fatalf("Forward() error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || attempts != 3 {
+		t.Errorf("status = %d after %d attempts, want 200 after 3", resp.StatusCode, attempts)
+	}
+
+	// Non-idempotent requests are not repeated on a status
+	attempts = 0
+	resp, err = proxy.Forward(context.Background(), &protocol.HTTPRequest{ID: "req", Method: http.MethodPost, Path: "/", Body: []byte("x")})
+	if err != nil {
+		t.Fatalf("Forward() error: %v", err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable || attempts != 1 {
+		t.Errorf("POST status = %d after %d attempts, want 503 after 1", resp.StatusCode, attempts)
+	}
+
+	// Connection refused is retried for any method and then reported
+	backend.Close()
+	stopped := NewProxy(backendURL.Hostname(), port, false)
+	stopped.SetRetryPolicy(retry)
+	start := time.Now()
+	if _, err := stopped.Forward(context.Background(), &protocol.HTTPRequest{ID: "req", Method: http.MethodPost, Path: "/"}); err == nil {
+		t.Error("Forward() to a stopped backend succeeded")
+	}
+	if elapsed := time.Since(start); elapsed < 7*time.Millisecond {
+		t.Errorf("Forward() returned after %v, want backoff of at least 7ms", elapsed)
+	}
+
+	if _, err := ParseRetryOn("refused,200"); err == nil {
+		t.Error("ParseRetryOn(200) = nil error, want error")
+	}
+}
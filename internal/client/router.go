@@ -0,0 +1,139 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/tunnel"
+)
+
+// routeTarget binds a path prefix to the proxy serving it
+type routeTarget struct {
+	prefix string
+	proxy  *Proxy
+}
+
+// pathRouter dispatches requests within a single forward to local targets by path prefix.
+// Precedence: the longest matching prefix wins; requests matching no route use the default proxy.
+type pathRouter struct {
+	routes   []routeTarget // Sorted by prefix length, longest first
+	fallback *Proxy
+}
+
+// newPathRouter creates a router for a forward, with one proxy per route plus the default target
+func newPathRouter(fwd tunnel.ForwardConfig, localAddr string, timeout time.Duration, retry RetryPolicy) *pathRouter {
+	r := &pathRouter{
+		fallback: NewProxyWithTimeout(localAddr, fwd.LocalPort, fwd.LocalHTTPS, timeout),
+	}
+	r.fallback.SetRetryPolicy(retry)
+
+	for _, route := range fwd.Routes {
+		proxy := NewProxyWithTimeout(localAddr, route.LocalPort, route.LocalHTTPS, timeout)
+		proxy.SetRetryPolicy(retry)
+		r.routes = append(r.routes, routeTarget{
+			prefix: route.Prefix,
+			proxy:  proxy,
+		})
+	}
+
+	sort.SliceStable(r.routes, func(i, j int) bool {
+		return len(r.routes[i].prefix) > len(r.routes[j].prefix)
+	})
+
+	return r
+}
+
+// match returns the proxy for a request path
+func (r *pathRouter) match(path string) *Proxy {
+	for _, route := range r.routes {
+		if matchPathPrefix(path, route.prefix) {
+			return route.proxy
+		}
+	}
+	return r.fallback
+}
+
+// proxies returns the proxies of all local targets of the forward
+func (r *pathRouter) proxies() []*Proxy {
+	proxies := []*Proxy{r.fallback}
+	for _, route := range r.routes {
+		proxies = append(proxies, route.proxy)
+	}
+	return proxies
+}
+
+// matchPathPrefix checks if a request path falls under a prefix on a segment boundary,
+// so "/api" matches "/api", "/api/users" and "/api?x=1" but not "/apiv2"
+func matchPathPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	if len(path) == len(prefix) || strings.HasSuffix(prefix, "/") {
+		return true
+	}
+	switch path[len(prefix)] {
+	case '/', '?', '#':
+		return true
+	}
+	return false
+}
+
+// ParseRoutes parses a comma-separated route list like "/api=8080,/admin=https:9000"
+func ParseRoutes(s string) ([]tunnel.PathRoute, error) {
+	var routes []tunnel.PathRoute
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		prefix, target, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid route %q (expected /prefix=port)", part)
+		}
+		prefix = strings.TrimSpace(prefix)
+		if !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("route prefix %q must start with /", prefix)
+		}
+
+		target = strings.TrimSpace(target)
+		localHTTPS := false
+		if strings.HasPrefix(target, "https:") {
+			localHTTPS = true
+			target = strings.TrimPrefix(target, "https:")
+		}
+		port, err := strconv.Atoi(target)
+		if err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid port in route %q (1-65535)", part)
+		}
+
+		for _, existing := range routes {
+			if existing.Prefix == prefix {
+				return nil, fmt.Errorf("duplicate route prefix %q", prefix)
+			}
+		}
+
+		routes = append(routes, tunnel.PathRoute{
+			Prefix:     prefix,
+			LocalPort:  port,
+			LocalHTTPS: localHTTPS,
+		})
+	}
+	return routes, nil
+}
+
+// FormatRoutes formats routes back into the "/api=8080,/admin=https:9000" form used by ParseRoutes
+func FormatRoutes(routes []tunnel.PathRoute) string {
+	parts := make([]string, 0, len(routes))
+	for _, r := range routes {
+		target := strconv.Itoa(r.LocalPort)
+		if r.LocalHTTPS {
+			target = "https:" + target
+		}
+		parts = append(parts, r.Prefix+"="+target)
+	}
+	return strings.Join(parts, ",")
+}
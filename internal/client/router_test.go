@@ -0,0 +1,122 @@
+package client
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/tunnel"
+)
+
+func TestMatchPathPrefix(t *testing.T) {
+	tests := []struct {
+		path, prefix string
+		want         bool
+	}{
+		{"/api", "/api", true},
+		{"/api/users", "/api", true},
+		{"/api?x=1", "/api", true},
+		{"/api#top", "/api", true},
+		{"/apix", "/api", false},
+		{"/apiv2/users", "/api", false},
+		{"/ap", "/api", false},
+		{"/other/api", "/api", false},
+		{"/api/", "/api/", true},
+		{"/api/users", "/api/", true},
+		{"/api", "/api/", false},
+		{"/anything", "/", true},
+	}
+	for _, tt := range tests {
+		if got := matchPathPrefix(tt.path, tt.prefix); got != tt.want {
+			t.Errorf("matchPathPrefix(%q, %q) = %v, want %v", tt.path, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestPathRouterMatch(t *testing.T) {
+	fwd := tunnel.ForwardConfig{
+		LocalPort: 3000,
+		Routes: []tunnel.PathRoute{
+			{Prefix: "/api", LocalPort: 8080},
+			{Prefix: "/api/admin", LocalPort: 9000},
+			{Prefix: "/static/", LocalPort: 8081},
+		},
+	}
+	r := newPathRouter(fwd, "localhost", time.Second, RetryPolicy{})
+
+	targets := map[*Proxy]string{r.fallback: "default"}
+	for _, route := range r.routes {
+		targets[route.proxy] = route.prefix
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/", "default"},
+		{"/api", "/api"},
+		{"/api/users", "/api"},
+		{"/apix", "default"},
+		{"/api/admin", "/api/admin"},
+		{"/api/admin/users?page=2", "/api/admin"},
+		{"/api/administrators", "/api"},
+		{"/static/app.js", "/static/"},
+		{"/static", "default"},
+	}
+	for _, tt := range tests {
+		if got := targets[r.match(tt.path)]; got != tt.want {
+			t.Errorf("match(%q) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+	if n := len(r.proxies()); n != 4 {
+		t.Errorf("proxies() = %d, want the default and three routes", n)
+	}
+}
+
+func TestParseRoutes(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []tunnel.PathRoute
+		wantErr string
+	}{
+		{in: "", want: nil},
+		{in: " , ", want: nil},
+		{in: "/api=8080", want: []tunnel.PathRoute{{Prefix: "/api", LocalPort: 8080}}},
+		{
+			in: " /api = 8080 , /admin=https:9000,",
+			want: []tunnel.PathRoute{
+				{Prefix: "/api", LocalPort: 8080},
+				{Prefix: "/admin", LocalPort: 9000, LocalHTTPS: true},
+			},
+		},
+		{in: "/api", wantErr: "expected /prefix=port"},
+		{in: "api=8080", wantErr: "must start with /"},
+		{in: "=8080", wantErr: "must start with /"},
+		{in: "/api=", wantErr: "invalid port"},
+		{in: "/api=http", wantErr: "invalid port"},
+		{in: "/api=0", wantErr: "invalid port"},
+		{in: "/api=65536", wantErr: "invalid port"},
+		{in: "/api=https:", wantErr: "invalid port"},
+		{in: "/api=8080,/api=9000", wantErr: "duplicate route prefix"},
+	}
+	for _, tt := range tests {
+		got, err := ParseRoutes(tt.in)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseRoutes(%q) error = %v, want %q", tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseRoutes(%q) error: %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseRoutes(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+		if again, err := ParseRoutes(FormatRoutes(got)); err != nil || !reflect.DeepEqual(again, got) {
+			t.Errorf("ParseRoutes(FormatRoutes(%+v)) = %+v, %v, want the same routes", got, again, err)
+		}
+	}
+}
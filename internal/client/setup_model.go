@@ -26,6 +26,7 @@ const (
 	forwardsBoxWidth = 60
 	subdomainWidth   = 34
 	portWidth        = 14
+	routesWidth      = 44
 )
 
 // SetupModel holds the state for the setup TUI
@@ -40,7 +41,8 @@ type SetupModel struct {
 	// Add forward view inputs
 	subdomainInput textinput.Model
 	portInput      textinput.Model
-	localHTTPS     bool // HTTPS for local forwarding (in add forward view)
+	routesInput    textinput.Model // Path routes, e.g. "/api=8080,/admin=9000"
+	localHTTPS     bool            // HTTPS for local forwarding (in add forward view)
 
 	// Forwards list
 	forwards       []tunnel.ForwardConfig
@@ -82,7 +84,7 @@ func NewSetupModel() *SetupModel {
 
 	// Subdomain input
 	subdomainInput := textinput.New()
-	subdomainInput.Placeholder = "myapp"
+	subdomainInput.Placeholder = "myapp (empty for your default)"
 	subdomainInput.CharLimit = 50
 	subdomainInput.Width = 30
 	subdomainInput.Prompt = ""
@@ -94,12 +96,20 @@ func NewSetupModel() *SetupModel {
 	portInput.Width = 10
 	portInput.Prompt = ""
 
+	// Routes input
+	routesInput := textinput.New()
+	routesInput.Placeholder = "/api=8080,/admin=9000 (optional)"
+	routesInput.CharLimit = 200
+	routesInput.Width = 40
+	routesInput.Prompt = ""
+
 	return &SetupModel{
 		view:           SetupViewMain,
 		serverInput:    serverInput,
 		tokenInput:     tokenInput,
 		subdomainInput: subdomainInput,
 		portInput:      portInput,
+		routesInput:    routesInput,
 		forwards:       make([]tunnel.ForwardConfig, 0),
 		selectedFwd:    -1,
 		primaryFwdIdx:  0,
@@ -325,24 +335,32 @@ func (m *SetupModel) updateAddForward(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, nil
 
 		case "tab", "down":
-			// Toggle between subdomain and port
-			if m.subdomainInput.Focused() {
+			// Cycle subdomain -> port -> routes
+			switch {
+			case m.subdomainInput.Focused():
 				m.subdomainInput.Blur()
 				m.portInput.Focus()
-			} else {
+			case m.portInput.Focused():
 				m.portInput.Blur()
+				m.routesInput.Focus()
+			default:
+				m.routesInput.Blur()
 				m.subdomainInput.Focus()
 			}
 			return m, nil
 
 		case "shift+tab", "up":
-			// Toggle between port and subdomain
-			if m.portInput.Focused() {
+			// Cycle routes -> port -> subdomain
+			switch {
+			case m.routesInput.Focused():
+				m.routesInput.Blur()
+				m.portInput.Focus()
+			case m.portInput.Focused():
 				m.portInput.Blur()
 				m.subdomainInput.Focus()
-			} else {
+			default:
 				m.subdomainInput.Blur()
-				m.portInput.Focus()
+				m.routesInput.Focus()
 			}
 			return m, nil
 
@@ -350,17 +368,22 @@ func (m *SetupModel) updateAddForward(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m.handleAddForward()
 
 		case "h":
-			// Toggle local HTTPS
-			m.localHTTPS = !m.localHTTPS
-			return m, nil
+			// Toggle local HTTPS (routes may contain "https:" so let it through there)
+			if !m.routesInput.Focused() {
+				m.localHTTPS = !m.localHTTPS
+				return m, nil
+			}
 		}
 	}
 
 	// Update focused input
 	var cmd tea.Cmd
-	if m.subdomainInput.Focused() {
+	switch {
+	case m.subdomainInput.Focused():
 		m.subdomainInput, cmd = m.subdomainInput.Update(msg)
-	} else {
+	case m.routesInput.Focused():
+		m.routesInput, cmd = m.routesInput.Update(msg)
+	default:
 		m.portInput, cmd = m.portInput.Update(msg)
 	}
 
@@ -454,9 +477,11 @@ func (m *SetupModel) handleEnter() (tea.Model, tea.Cmd) {
 		m.editingFwdIdx = -1 // Not editing, adding new
 		m.subdomainInput.SetValue("")
 		m.portInput.SetValue("")
+		m.routesInput.SetValue("")
 		m.localHTTPS = false // Reset for new forward
 		m.subdomainInput.Focus()
 		m.portInput.Blur()
+		m.routesInput.Blur()
 		return m, nil
 
 	case 4:
@@ -480,9 +505,11 @@ func (m *SetupModel) openEditForward(idx int) (tea.Model, tea.Cmd) {
 	m.editingFwdIdx = idx
 	m.subdomainInput.SetValue(fwd.Subdomain)
 	m.portInput.SetValue(strconv.Itoa(fwd.LocalPort))
+	m.routesInput.SetValue(FormatRoutes(fwd.Routes))
 	m.localHTTPS = fwd.LocalHTTPS
 	m.subdomainInput.Focus()
 	m.portInput.Blur()
+	m.routesInput.Blur()
 	return m, nil
 }
 
@@ -492,21 +519,26 @@ func (m *SetupModel) handleAddForward() (tea.Model, tea.Cmd) {
 	portStr := strings.TrimSpace(m.portInput.Value())
 
 	// Validate
-	if subdomain == "" {
-		m.errorMsg = "Subdomain is required"
-		return m, nil
-	}
-
 	port, err := strconv.Atoi(portStr)
 	if err != nil || port <= 0 || port > 65535 {
 		m.errorMsg = "Invalid port number (1-65535)"
 		return m, nil
 	}
 
+	routes, err := ParseRoutes(m.routesInput.Value())
+	if err != nil {
+		m.errorMsg = err.Error()
+		return m, nil
+	}
+
 	// Check for duplicate subdomain (skip the one being edited)
 	for i, fwd := range m.forwards {
 		if fwd.Subdomain == subdomain && i != m.editingFwdIdx {
 			m.errorMsg = "Subdomain already exists"
+			if subdomain == "" {
+				// The server assigns the default subdomain to one forward only
+				m.errorMsg = "Only one forward can leave the subdomain empty"
+			}
 			return m, nil
 		}
 	}
@@ -516,6 +548,7 @@ func (m *SetupModel) handleAddForward() (tea.Model, tea.Cmd) {
 		m.forwards[m.editingFwdIdx].Subdomain = subdomain
 		m.forwards[m.editingFwdIdx].LocalPort = port
 		m.forwards[m.editingFwdIdx].LocalHTTPS = m.localHTTPS
+		m.forwards[m.editingFwdIdx].Routes = routes
 		m.selectedFwd = m.editingFwdIdx
 	} else {
 		// Add new forward
@@ -524,6 +557,7 @@ func (m *SetupModel) handleAddForward() (tea.Model, tea.Cmd) {
 			LocalPort:  port,
 			LocalHTTPS: m.localHTTPS,
 			Primary:    len(m.forwards) == 0, // First one is primary
+			Routes:     routes,
 		})
 		m.selectedFwd = len(m.forwards) - 1
 	}
@@ -653,7 +687,11 @@ func (m *SetupModel) viewMain() string {
 				proto = "https"
 			}
 			// Show full URL: subdomain.server → proto://localhost:port
-			fullURL := fmt.Sprintf("%s.%s", fwd.Subdomain, server)
+			subdomain := fwd.Subdomain
+			if subdomain == "" {
+				subdomain = "<default>"
+			}
+			fullURL := fmt.Sprintf("%s.%s", subdomain, server)
 			line := fmt.Sprintf("%s → %s://:%d", fullURL, proto, fwd.LocalPort)
 			if i == m.primaryFwdIdx {
 				line += " ★"
@@ -665,6 +703,13 @@ func (m *SetupModel) viewMain() string {
 				line = valueStyle.Render("  " + line)
 			}
 			fwdContent.WriteString(line)
+			for _, r := range fwd.Routes {
+				routeProto := "http"
+				if r.LocalHTTPS {
+					routeProto = "https"
+				}
+				fwdContent.WriteString("\n" + timeStyle.Render(fmt.Sprintf("    %s → %s://:%d", r.Prefix, routeProto, r.LocalPort)))
+			}
 			if i < len(m.forwards)-1 {
 				fwdContent.WriteString("\n")
 			}
@@ -754,6 +799,24 @@ func (m *SetupModel) viewAddForward() string {
 	b.WriteString(portStyle.Render(m.portInput.View()))
 	b.WriteString("\n\n")
 
+	// Routes input
+	routesLabel := "Path Routes"
+	if m.routesInput.Focused() {
+		routesLabel = labelStyle.Render("▶ Path Routes")
+	} else {
+		routesLabel = timeStyle.Render("  Path Routes")
+	}
+	b.WriteString(routesLabel + "\n")
+	routesStyle := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(m.getInputBorderColor(m.routesInput.Focused())).
+		Padding(0, 1).
+		Width(routesWidth)
+	b.WriteString(routesStyle.Render(m.routesInput.View()))
+	b.WriteString("\n")
+	b.WriteString(timeStyle.Render("Prefix=port, comma separated; longest prefix wins, others go to Local Port"))
+	b.WriteString("\n\n")
+
 	// Local HTTPS toggle
 	httpsStatus := timeStyle.Render("○ http")
 	if m.localHTTPS {
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultShutdownReconnectDelay is used when a shutdown notice carries no delay hint
+	defaultShutdownReconnectDelay = 5 * time.Second
+	// maxShutdownReconnectDelay caps the server's hint so a bad value cannot stall the client
+	maxShutdownReconnectDelay = 2 * time.Minute
+)
+
+// ShutdownMsg is sent when the server announces it is shutting down
+type ShutdownMsg struct {
+	Message        string
+	ReconnectDelay time.Duration
+}
+
+// shutdownHint holds the reconnect delay from the last shutdown notice until the next reconnect
+type shutdownHint struct {
+	delay atomic.Int64
+}
+
+// set records the server's reconnect hint (in seconds), applying the default and cap
+func (h *shutdownHint) set(seconds int) time.Duration {
+	delay := time.Duration(seconds) * time.Second
+	if delay <= 0 {
+		delay = defaultShutdownReconnectDelay
+	}
+	if delay > maxShutdownReconnectDelay {
+		delay = maxShutdownReconnectDelay
+	}
+	h.delay.Store(int64(delay))
+	return delay
+}
+
+// take returns the pending reconnect delay with up to 25% jitter, so clients of a
+// restarting server don't all reconnect at once, and clears it. Zero means no notice.
+func (h *shutdownHint) take() time.Duration {
+	delay := time.Duration(h.delay.Swap(0))
+	if delay <= 0 {
+		return 0
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/4+1))
+}
+
+// waitShutdownDelay sleeps for a pending shutdown reconnect delay, returning early when done closes
+func waitShutdownDelay(delay time.Duration, done <-chan struct{}) {
+	if delay <= 0 {
+		return
+	}
+	select {
+	case <-time.After(delay):
+	case <-done:
+	}
+}
@@ -1,10 +1,13 @@
 package client
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/niekvdm/digit-link/internal/tunnel"
@@ -15,20 +18,40 @@ type TCPClient struct {
 	server    string
 	token     string
 	forwards  []tunnel.ForwardConfig
+	localAddr string // Local host the forwards go to, reported to the server
 	insecure  bool
 	session   *tunnel.Session
 	tunnels   []tunnel.TunnelInfo
 	connected bool
 	mu        sync.RWMutex
-	done      chan struct{}
+
+	// Subdomain alternatives offered by the server on a conflict
+	suggestions []string
+
+	// Subdomain the server assigned to the forward that asked for none
+	assignedSubdomain string
+
+	// Token from the last registration, to resume it after a dropped connection
+	reconnectToken string
+	done           chan struct{}
 
 	// Reconnection settings
 	maxRetries     int
 	initialBackoff time.Duration
 	maxBackoff     time.Duration
 
-	// Proxy instances for each forward
-	proxies map[string]*Proxy // subdomain -> proxy
+	// Path routers for each forward
+	routers map[string]*pathRouter // subdomain -> router
+
+	// Inactivity auto-disconnect
+	idle *idleTracker
+
+	// Reconnect delay hinted by the server's shutdown notice
+	shutdown shutdownHint
+
+	// Wait for the local services before registering
+	health   HealthCheck
+	degraded atomic.Bool // Register degraded until the local services are up
 
 	// Display
 	model  *Model
@@ -39,11 +62,15 @@ type TCPConfig struct {
 	Server         string
 	Token          string
 	Forwards       []tunnel.ForwardConfig
-	Insecure       bool // Skip TLS verification
+	LocalAddr      string // Local host to forward to (default: localhost)
+	Insecure       bool   // Skip TLS verification
 	MaxRetries     int
 	InitialBackoff time.Duration
 	MaxBackoff     time.Duration
 	Timeout        time.Duration // Request timeout for proxies
+	IdleTimeout    time.Duration // Disconnect after no requests for this long (0 disables)
+	LocalRetry     RetryPolicy   // Retries for failed local requests
+	LocalHealth    HealthCheck   // Wait for the local services before registering
 }
 
 // NewTCPClient creates a new TCP/yamux tunnel client
@@ -61,23 +88,29 @@ func NewTCPClient(cfg TCPConfig) *TCPClient {
 	if cfg.Timeout == 0 {
 		cfg.Timeout = 5 * time.Minute
 	}
+	if cfg.LocalAddr == "" {
+		cfg.LocalAddr = "localhost"
+	}
 
-	// Create proxy for each forward
-	proxies := make(map[string]*Proxy)
+	// Create path router for each forward
+	routers := make(map[string]*pathRouter)
 	for _, fwd := range cfg.Forwards {
-		proxies[fwd.Subdomain] = NewProxyWithTimeout("localhost", fwd.LocalPort, fwd.LocalHTTPS, cfg.Timeout)
+		routers[fwd.Subdomain] = newPathRouter(fwd, cfg.LocalAddr, cfg.Timeout, cfg.LocalRetry)
 	}
 
 	return &TCPClient{
 		server:         cfg.Server,
 		token:          cfg.Token,
 		forwards:       cfg.Forwards,
+		localAddr:      cfg.LocalAddr,
 		insecure:       cfg.Insecure,
 		done:           make(chan struct{}),
 		maxRetries:     cfg.MaxRetries,
 		initialBackoff: cfg.InitialBackoff,
 		maxBackoff:     cfg.MaxBackoff,
-		proxies:        proxies,
+		routers:        routers,
+		idle:           newIdleTracker(cfg.IdleTimeout),
+		health:         cfg.LocalHealth,
 	}
 }
 
@@ -122,10 +155,21 @@ func (c *TCPClient) Connect() error {
 		return fmt.Errorf("failed to open auth stream: %w", err)
 	}
 
-	// Send auth request
+	// Send auth request, reporting the local host the forwards are dialed on
+	forwards := make([]tunnel.ForwardConfig, len(c.forwards))
+	for i, fwd := range c.forwards {
+		fwd.LocalAddr = c.localAddr
+		if fwd.Subdomain == "" && c.reconnectToken != "" {
+			// Resume the subdomain assigned before the connection dropped
+			fwd.Subdomain = c.assignedSubdomain
+		}
+		forwards[i] = fwd
+	}
 	authReq := tunnel.AuthRequest{
-		Token:    c.token,
-		Forwards: c.forwards,
+		Token:          c.token,
+		Forwards:       forwards,
+		Degraded:       c.degraded.Load(),
+		ReconnectToken: c.reconnectToken,
 	}
 
 	if err := tunnel.WriteFrame(stream, &authReq); err != nil {
@@ -145,22 +189,26 @@ func (c *TCPClient) Connect() error {
 	stream.Close()
 
 	if !authResp.Success {
+		c.suggestions = authResp.Suggestions
 		session.Close()
-		return fmt.Errorf("registration failed: %s", authResp.Error)
+		return &registrationError{code: authResp.Code, message: authResp.Error}
 	}
 
 	// Store session and tunnel info
 	c.session = session
 	c.tunnels = authResp.Tunnels
+	c.reconnectToken = authResp.ReconnectToken
 	c.connected = true
 
-	// Copy LocalHTTPS from forwards to tunnels (matched by subdomain)
+	// Copy LocalHTTPS from forwards to tunnels, which the server returns in
+	// forward order with assigned subdomains filled in
 	for i := range c.tunnels {
-		for _, fwd := range c.forwards {
-			if fwd.Subdomain == c.tunnels[i].Subdomain {
-				c.tunnels[i].LocalHTTPS = fwd.LocalHTTPS
-				break
-			}
+		if i >= len(c.forwards) {
+			break
+		}
+		c.tunnels[i].LocalHTTPS = c.forwards[i].LocalHTTPS
+		if c.forwards[i].Subdomain == "" {
+			c.assignedSubdomain = c.tunnels[i].Subdomain
 		}
 	}
 
@@ -175,6 +223,15 @@ func (c *TCPClient) Run() error {
 	retries := 0
 	backoff := c.initialBackoff
 
+	go c.idle.watch(c.done, func() {
+		if c.model != nil {
+			c.model.SendUpdate(IdleTimeoutMsg{Timeout: c.idle.timeout})
+		}
+	})
+
+	// Wait for the local services before registering
+	c.health.start(c.localProxies(), c.done, c.model, &c.degraded, c.sendHealthy)
+
 	for {
 		select {
 		case <-c.done:
@@ -183,15 +240,14 @@ func (c *TCPClient) Run() error {
 		}
 
 		if err := c.Connect(); err != nil {
-			errMsg := err.Error()
-
 			// Check if fatal error
-			if isFatalError(errMsg) {
+			if fatal, reason := connectFailure(err); fatal {
 				if c.model != nil {
 					c.model.SendUpdate(StatusUpdateMsg{
-						Status: "rejected",
-						Server: c.server,
-						Error:  extractErrorReason(errMsg),
+						Status:      "rejected",
+						Server:      c.server,
+						Error:       reason,
+						Suggestions: c.suggestions,
 					})
 				}
 				<-c.done
@@ -205,8 +261,9 @@ func (c *TCPClient) Run() error {
 
 			if c.model != nil {
 				c.model.SendUpdate(StatusUpdateMsg{
-					Status: "connecting",
-					Server: c.server,
+					Status:      "connecting",
+					Server:      c.server,
+					Suggestions: c.suggestions,
 				})
 			}
 			time.Sleep(backoff)
@@ -248,14 +305,22 @@ func (c *TCPClient) Run() error {
 		}
 		c.mu.Unlock()
 
+		// Back off before reconnecting if the server announced a shutdown
+		delay := c.shutdown.take()
+		retryBackoff := backoff
+		if delay > 0 {
+			retryBackoff = delay
+		}
+
 		if c.model != nil {
 			c.model.SendUpdate(StatusUpdateMsg{
 				Status:       "reconnecting",
 				Server:       c.server,
 				RetryCount:   retries + 1,
-				RetryBackoff: backoff,
+				RetryBackoff: retryBackoff,
 			})
 		}
+		waitShutdownDelay(delay, c.done)
 	}
 }
 
@@ -294,6 +359,9 @@ func (c *TCPClient) handleStreams() {
 func (c *TCPClient) handleRequest(stream net.Conn) {
 	startTime := time.Now()
 
+	c.idle.begin()
+	defer c.idle.end()
+
 	// Read request frame
 	reqFrame, err := tunnel.ReadFrame[tunnel.RequestFrame](stream)
 	if err != nil {
@@ -301,16 +369,33 @@ func (c *TCPClient) handleRequest(stream net.Conn) {
 		return
 	}
 
-	// Find the proxy for this subdomain
-	proxy, ok := c.proxies[reqFrame.Subdomain]
+	// Control frame: the server is shutting down
+	if reqFrame.Type == tunnel.TypeShutdown {
+		stream.Close()
+		c.handleShutdown(reqFrame.Shutdown)
+		return
+	}
+
+	// Find the router for this subdomain
+	router, ok := c.routers[reqFrame.Subdomain]
 	if !ok {
-		// Fallback to first proxy if subdomain not found
-		for _, p := range c.proxies {
-			proxy = p
+		// An unknown subdomain is the one the server assigned, if any
+		router, ok = c.routers[""]
+	}
+	if !ok {
+		// Fallback to first router if subdomain not found
+		for _, r := range c.routers {
+			router = r
 			break
 		}
 	}
 
+	// Pick the local target by path prefix
+	var proxy *Proxy
+	if router != nil {
+		proxy = router.match(reqFrame.Path)
+	}
+
 	if proxy == nil {
 		// Send error response
 		tunnel.WriteFrame(stream, &tunnel.ResponseFrame{
@@ -348,7 +433,38 @@ func (c *TCPClient) handleRequest(stream net.Conn) {
 	// Regular HTTP request - use existing flow
 	defer stream.Close()
 
-	httpResp, err := proxy.ForwardRaw(reqFrame.Method, reqFrame.Path, reqFrame.Headers, reqFrame.Body)
+	// Let the server know the request arrived before the local service is involved
+	if reqFrame.WantAck {
+		if err := tunnel.WriteFrame(stream, &tunnel.ResponseFrame{ID: reqFrame.ID, Ack: true}); err != nil {
+			return
+		}
+	}
+
+	// The server closes the stream if the visitor disconnects
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cancelOnStreamClose(stream, cancel)
+
+	forward := proxy.ForwardRaw
+	switch {
+	case reqFrame.GRPC:
+		forward = proxy.ForwardGRPC
+	case reqFrame.Stream:
+		forward = proxy.ForwardStreaming
+	}
+	httpResp, err := forward(ctx, reqFrame.Method, reqFrame.Path, reqFrame.Headers, reqFrame.Body)
+	if err != nil && ctx.Err() != nil {
+		// The visitor disconnected; nobody is waiting for a response
+		if c.model != nil {
+			c.model.SendUpdate(RequestCompletedMsg{
+				ID:         reqFrame.ID,
+				StatusCode: statusClientClosedRequest,
+				Duration:   time.Since(startTime),
+				BytesRecv:  bytesRecv,
+			})
+		}
+		return
+	}
 	if err != nil {
 		httpResp = &tunnel.ResponseFrame{
 			ID:     reqFrame.ID,
@@ -362,22 +478,68 @@ func (c *TCPClient) handleRequest(stream net.Conn) {
 		httpResp.ID = reqFrame.ID
 	}
 
-	duration := time.Since(startTime)
+	// Send response frame; a streamed body follows it as the local service produces it
 	bytesSent := int64(len(httpResp.Body))
+	err = tunnel.WriteFrame(stream, httpResp)
+	if httpResp.BodyStream != nil {
+		if err == nil && httpResp.Trailers {
+			bytesSent, _ = tunnel.WriteChunkedBody(stream, httpResp.BodyStream, httpResp.Trailer)
+		} else if err == nil {
+			bytesSent, _ = io.Copy(stream, httpResp.BodyStream)
+		}
+		httpResp.BodyStream.Close()
+	}
 
 	// Notify model of completed request
 	if c.model != nil {
 		c.model.SendUpdate(RequestCompletedMsg{
 			ID:         reqFrame.ID,
 			StatusCode: httpResp.Status,
-			Duration:   duration,
+			Duration:   time.Since(startTime),
 			BytesSent:  bytesSent,
 			BytesRecv:  bytesRecv,
 		})
 	}
+}
+
+// handleShutdown records the server's reconnect hint and notifies the model
+func (c *TCPClient) handleShutdown(notice *tunnel.ShutdownNotice) {
+	if notice == nil {
+		notice = &tunnel.ShutdownNotice{}
+	}
+	delay := c.shutdown.set(notice.ReconnectDelay)
+	if c.model != nil {
+		c.model.SendUpdate(ShutdownMsg{
+			Message:        notice.Message,
+			ReconnectDelay: delay,
+		})
+	}
+}
+
+// localProxies returns the proxies of all local targets
+func (c *TCPClient) localProxies() []*Proxy {
+	var proxies []*Proxy
+	for _, router := range c.routers {
+		proxies = append(proxies, router.proxies()...)
+	}
+	return proxies
+}
+
+// sendHealthy tells the server, on a new stream, that the local services of a degraded tunnel are up
+func (c *TCPClient) sendHealthy() {
+	c.mu.RLock()
+	session := c.session
+	c.mu.RUnlock()
+	if session == nil {
+		return
+	}
 
-	// Send response frame
-	tunnel.WriteFrame(stream, httpResp)
+	stream, err := session.Open()
+	if err != nil {
+		return
+	}
+	tunnel.WriteFrame(stream, &tunnel.HealthFrame{Type: tunnel.TypeHealth, Healthy: true})
+	stream.Close()
 }
 
 // handleWebSocketRequest handles WebSocket upgrade requests
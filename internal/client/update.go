@@ -0,0 +1,97 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/version"
+)
+
+// updateCheckTimeout bounds the update check so a slow server cannot hold it open
+const updateCheckTimeout = 5 * time.Second
+
+// UpdateCheck describes where the client looks for newer versions
+type UpdateCheck struct {
+	Server   string // Tunnel server address; its /api/health advertises the client versions
+	Insecure bool   // Server is plain HTTP without TLS
+	URL      string // Update URL answering like /api/health, used instead of the server
+}
+
+// UpdateNoticeMsg tells the TUI that a newer client is available
+type UpdateNoticeMsg struct {
+	Current  string
+	Latest   string
+	Required bool // The running client is older than the minimum version the server supports
+}
+
+// Text describes the notice for the TUI and the terminal
+func (n UpdateNoticeMsg) Text() string {
+	if n.Required {
+		return fmt.Sprintf("digit-link %s is no longer supported by this server, please update to %s", n.Current, n.Latest)
+	}
+	return fmt.Sprintf("digit-link %s is available (running %s)", n.Latest, n.Current)
+}
+
+// clientVersions are the versions advertised by the server's /api/health or an update URL
+type clientVersions struct {
+	Latest  string `json:"latestClientVersion"`
+	Minimum string `json:"minClientVersion"`
+}
+
+// CheckForUpdate fetches the advertised client versions and returns a notice
+// when the running client is outdated. It returns nil for an up-to-date client,
+// a development build or when nothing is advertised. It never downloads anything.
+func CheckForUpdate(check UpdateCheck) (*UpdateNoticeMsg, error) {
+	if _, ok := version.Compare(version.Version, version.Version); !ok {
+		return nil, nil // Development builds have nothing to compare
+	}
+
+	url := check.URL
+	if url == "" {
+		url = webBaseURL(check.Server, check.Insecure) + "/api/health"
+	}
+	httpClient := &http.Client{Timeout: updateCheckTimeout}
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("update check failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var versions clientVersions
+	if err := json.NewDecoder(resp.Body).Decode(&versions); err != nil {
+		return nil, fmt.Errorf("update check: unexpected response (HTTP %d)", resp.StatusCode)
+	}
+	return updateNotice(version.Version, versions), nil
+}
+
+// updateNotice compares the running version with the advertised ones
+func updateNotice(current string, versions clientVersions) *UpdateNoticeMsg {
+	notice := &UpdateNoticeMsg{Current: current, Latest: versions.Latest}
+	if cmp, ok := version.Compare(current, versions.Minimum); ok && cmp < 0 {
+		notice.Required = true
+		if notice.Latest == "" {
+			notice.Latest = versions.Minimum
+		}
+		return notice
+	}
+	if cmp, ok := version.Compare(current, versions.Latest); ok && cmp < 0 {
+		return notice
+	}
+	return nil
+}
+
+// webBaseURL returns the URL of the server's web endpoints. They are served on
+// the default HTTPS port, so the tunnel port of the address is dropped.
+func webBaseURL(server string, insecure bool) string {
+	if insecure {
+		return "http://" + server
+	}
+	host, _, err := net.SplitHostPort(server)
+	if err != nil {
+		host = server
+	}
+	return "https://" + host
+}
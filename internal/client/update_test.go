@@ -0,0 +1,39 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/niekvdm/digit-link/internal/version"
+)
+
+func TestCheckForUpdate(t *testing.T) {
+	// Answers like the server's /api/health
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":"ok","latestClientVersion":"v1.5.0","minClientVersion":"v1.2.0"}`)
+	}))
+	defer srv.Close()
+	defer func(v string) { version.Version = v }(version.Version)
+
+	for _, tt := range []struct {
+		running  string
+		notice   bool
+		required bool
+	}{
+		{"dev", false, false},
+		{"v1.5.0", false, false},
+		{"v1.4.2", true, false},
+		{"v1.1.9", true, true},
+	} {
+		version.Version = tt.running
+		notice, err := CheckForUpdate(UpdateCheck{URL: srv.URL})
+		if err != nil {
+			t.Fatalf("CheckForUpdate(%s) error: %v", tt.running, err)
+		}
+		if (notice != nil) != tt.notice || (notice != nil && (notice.Required != tt.required || notice.Latest != "v1.5.0")) {
+			t.Errorf("CheckForUpdate(%s) = %+v, want notice %v, required %v", tt.running, notice, tt.notice, tt.required)
+		}
+	}
+}
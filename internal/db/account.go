@@ -10,18 +10,37 @@ import (
 
 // Account represents a user account in the system
 type Account struct {
-	ID           string     `json:"id"`
-	Username     string     `json:"username"`
-	TokenHash    string     `json:"-"` // Never expose hash
-	PasswordHash string     `json:"-"` // Never expose hash
-	TOTPSecret   string     `json:"-"` // Never expose secret
-	TOTPEnabled  bool       `json:"totpEnabled"`
-	IsAdmin      bool       `json:"isAdmin"`
-	IsOrgAdmin   bool       `json:"isOrgAdmin"`
-	OrgID        string     `json:"orgId,omitempty"`
-	CreatedAt    time.Time  `json:"createdAt"`
-	LastUsed     *time.Time `json:"lastUsed,omitempty"`
-	Active       bool       `json:"active"`
+	ID                 string     `json:"id"`
+	Username           string     `json:"username"`
+	TokenHash          string     `json:"-"` // Never expose hash
+	PasswordHash       string     `json:"-"` // Never expose hash
+	TOTPSecret         string     `json:"-"` // Never expose secret
+	TOTPEnabled        bool       `json:"totpEnabled"`
+	IsAdmin            bool       `json:"isAdmin"`
+	IsOrgAdmin         bool       `json:"isOrgAdmin"`
+	OrgID              string     `json:"orgId,omitempty"`
+	CreatedAt          time.Time  `json:"createdAt"`
+	LastUsed           *time.Time `json:"lastUsed,omitempty"`
+	Active             bool       `json:"active"`
+	TokenExpiresAt     *time.Time `json:"tokenExpiresAt,omitempty"`   // Nil means the token never expires
+	TokenID            string     `json:"-"`                          // Token used to authenticate, set by GetAccountByTokenHash
+	MustChangePassword bool       `json:"mustChangePassword"`         // Login only grants a password change until a new password is set
+	AdminRole          string     `json:"-"`                          // Stored role, see EffectiveAdminRole
+	DefaultSubdomain   string     `json:"defaultSubdomain,omitempty"` // Used when a registration asks for no subdomain
+}
+
+// Admin roles. Admins without a stored role, from before roles existed, have
+// full access.
+const (
+	// AdminRoleFull can view and change everything
+	AdminRoleFull = "full"
+	// AdminRoleReadOnly can view everything but change nothing
+	AdminRoleReadOnly = "read_only"
+)
+
+// ValidAdminRole checks if a role is a known admin role
+func ValidAdminRole(role string) bool {
+	return role == AdminRoleFull || role == AdminRoleReadOnly
 }
 
 // CreateAccount creates a new account with the given username and token hash
@@ -29,7 +48,7 @@ func (db *DB) CreateAccount(username, tokenHash string, isAdmin bool) (*Account,
 	id := uuid.New().String()
 	now := time.Now()
 
-	_, err := db.conn.Exec(`
+	err := db.createAccountTx(id, tokenHash, nil, `
 		INSERT INTO accounts (id, username, token_hash, is_admin, created_at, active)
 		VALUES (?, ?, ?, ?, ?, ?)
 	`, id, username, tokenHash, isAdmin, now, true)
@@ -50,17 +69,17 @@ func (db *DB) CreateAccount(username, tokenHash string, isAdmin bool) (*Account,
 // GetAccountByID retrieves an account by its ID
 func (db *DB) GetAccountByID(id string) (*Account, error) {
 	account := &Account{}
-	var lastUsed sql.NullTime
+	var lastUsed, tokenExpiresAt sql.NullTime
 	var passwordHash, totpSecret, orgID sql.NullString
 	var isOrgAdmin sql.NullBool
 
 	err := db.conn.QueryRow(`
-		SELECT id, username, token_hash, password_hash, totp_secret, totp_enabled, is_admin, is_org_admin, org_id, created_at, last_used, active
+		SELECT id, username, token_hash, password_hash, totp_secret, totp_enabled, is_admin, is_org_admin, org_id, created_at, last_used, active, token_expires_at, COALESCE(must_change_password, FALSE), COALESCE(admin_role, ''), COALESCE(default_subdomain, '')
 		FROM accounts WHERE id = ?
 	`, id).Scan(
 		&account.ID, &account.Username, &account.TokenHash,
 		&passwordHash, &totpSecret, &account.TOTPEnabled,
-		&account.IsAdmin, &isOrgAdmin, &orgID, &account.CreatedAt, &lastUsed, &account.Active,
+		&account.IsAdmin, &isOrgAdmin, &orgID, &account.CreatedAt, &lastUsed, &account.Active, &tokenExpiresAt, &account.MustChangePassword, &account.AdminRole, &account.DefaultSubdomain,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -72,6 +91,9 @@ func (db *DB) GetAccountByID(id string) (*Account, error) {
 	if lastUsed.Valid {
 		account.LastUsed = &lastUsed.Time
 	}
+	if tokenExpiresAt.Valid {
+		account.TokenExpiresAt = &tokenExpiresAt.Time
+	}
 	if passwordHash.Valid {
 		account.PasswordHash = passwordHash.String
 	}
@@ -88,20 +110,23 @@ func (db *DB) GetAccountByID(id string) (*Account, error) {
 	return account, nil
 }
 
-// GetAccountByTokenHash retrieves an account by its token hash
+// GetAccountByTokenHash retrieves an account by the hash of any of its tokens.
+// TokenExpiresAt and TokenID describe the matched token.
 func (db *DB) GetAccountByTokenHash(tokenHash string) (*Account, error) {
 	account := &Account{}
-	var lastUsed sql.NullTime
+	var lastUsed, tokenExpiresAt sql.NullTime
 	var passwordHash, totpSecret, orgID sql.NullString
 	var isOrgAdmin sql.NullBool
 
 	err := db.conn.QueryRow(`
-		SELECT id, username, token_hash, password_hash, totp_secret, totp_enabled, is_admin, is_org_admin, org_id, created_at, last_used, active
-		FROM accounts WHERE token_hash = ? AND active = TRUE
+		SELECT a.id, a.username, a.token_hash, a.password_hash, a.totp_secret, a.totp_enabled, a.is_admin, a.is_org_admin, a.org_id, a.created_at, a.last_used, a.active, t.expires_at, t.id, COALESCE(a.must_change_password, FALSE), COALESCE(a.admin_role, ''), COALESCE(a.default_subdomain, '')
+		FROM account_tokens t
+		JOIN accounts a ON a.id = t.account_id
+		WHERE t.token_hash = ? AND a.active = TRUE
 	`, tokenHash).Scan(
 		&account.ID, &account.Username, &account.TokenHash,
 		&passwordHash, &totpSecret, &account.TOTPEnabled,
-		&account.IsAdmin, &isOrgAdmin, &orgID, &account.CreatedAt, &lastUsed, &account.Active,
+		&account.IsAdmin, &isOrgAdmin, &orgID, &account.CreatedAt, &lastUsed, &account.Active, &tokenExpiresAt, &account.TokenID, &account.MustChangePassword, &account.AdminRole, &account.DefaultSubdomain,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -113,6 +138,9 @@ func (db *DB) GetAccountByTokenHash(tokenHash string) (*Account, error) {
 	if lastUsed.Valid {
 		account.LastUsed = &lastUsed.Time
 	}
+	if tokenExpiresAt.Valid {
+		account.TokenExpiresAt = &tokenExpiresAt.Time
+	}
 	if passwordHash.Valid {
 		account.PasswordHash = passwordHash.String
 	}
@@ -132,17 +160,17 @@ func (db *DB) GetAccountByTokenHash(tokenHash string) (*Account, error) {
 // GetAccountByUsername retrieves an account by its username
 func (db *DB) GetAccountByUsername(username string) (*Account, error) {
 	account := &Account{}
-	var lastUsed sql.NullTime
+	var lastUsed, tokenExpiresAt sql.NullTime
 	var passwordHash, totpSecret, orgID sql.NullString
 	var isOrgAdmin sql.NullBool
 
 	err := db.conn.QueryRow(`
-		SELECT id, username, token_hash, password_hash, totp_secret, totp_enabled, is_admin, is_org_admin, org_id, created_at, last_used, active
+		SELECT id, username, token_hash, password_hash, totp_secret, totp_enabled, is_admin, is_org_admin, org_id, created_at, last_used, active, token_expires_at, COALESCE(must_change_password, FALSE), COALESCE(admin_role, ''), COALESCE(default_subdomain, '')
 		FROM accounts WHERE username = ?
 	`, username).Scan(
 		&account.ID, &account.Username, &account.TokenHash,
 		&passwordHash, &totpSecret, &account.TOTPEnabled,
-		&account.IsAdmin, &isOrgAdmin, &orgID, &account.CreatedAt, &lastUsed, &account.Active,
+		&account.IsAdmin, &isOrgAdmin, &orgID, &account.CreatedAt, &lastUsed, &account.Active, &tokenExpiresAt, &account.MustChangePassword, &account.AdminRole, &account.DefaultSubdomain,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -154,6 +182,9 @@ func (db *DB) GetAccountByUsername(username string) (*Account, error) {
 	if lastUsed.Valid {
 		account.LastUsed = &lastUsed.Time
 	}
+	if tokenExpiresAt.Valid {
+		account.TokenExpiresAt = &tokenExpiresAt.Time
+	}
 	if passwordHash.Valid {
 		account.PasswordHash = passwordHash.String
 	}
@@ -173,7 +204,7 @@ func (db *DB) GetAccountByUsername(username string) (*Account, error) {
 // ListAccounts returns all accounts
 func (db *DB) ListAccounts() ([]*Account, error) {
 	rows, err := db.conn.Query(`
-		SELECT id, username, token_hash, password_hash, totp_secret, totp_enabled, is_admin, is_org_admin, org_id, created_at, last_used, active
+		SELECT id, username, token_hash, password_hash, totp_secret, totp_enabled, is_admin, is_org_admin, org_id, created_at, last_used, active, token_expires_at, COALESCE(must_change_password, FALSE), COALESCE(admin_role, ''), COALESCE(default_subdomain, '')
 		FROM accounts ORDER BY created_at DESC
 	`)
 	if err != nil {
@@ -184,14 +215,14 @@ func (db *DB) ListAccounts() ([]*Account, error) {
 	var accounts []*Account
 	for rows.Next() {
 		account := &Account{}
-		var lastUsed sql.NullTime
+		var lastUsed, tokenExpiresAt sql.NullTime
 		var passwordHash, totpSecret, orgID sql.NullString
 		var isOrgAdmin sql.NullBool
 
 		err := rows.Scan(
 			&account.ID, &account.Username, &account.TokenHash,
 			&passwordHash, &totpSecret, &account.TOTPEnabled,
-			&account.IsAdmin, &isOrgAdmin, &orgID, &account.CreatedAt, &lastUsed, &account.Active,
+			&account.IsAdmin, &isOrgAdmin, &orgID, &account.CreatedAt, &lastUsed, &account.Active, &tokenExpiresAt, &account.MustChangePassword, &account.AdminRole, &account.DefaultSubdomain,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan account: %w", err)
@@ -200,6 +231,9 @@ func (db *DB) ListAccounts() ([]*Account, error) {
 		if lastUsed.Valid {
 			account.LastUsed = &lastUsed.Time
 		}
+		if tokenExpiresAt.Valid {
+			account.TokenExpiresAt = &tokenExpiresAt.Time
+		}
 		if passwordHash.Valid {
 			account.PasswordHash = passwordHash.String
 		}
@@ -227,14 +261,102 @@ func (db *DB) UpdateAccountLastUsed(id string) error {
 	return err
 }
 
-// UpdateAccountToken updates the token hash for an account
+// UpdateAccountToken replaces the default token for an account, leaving its other tokens intact
 func (db *DB) UpdateAccountToken(id, tokenHash string) error {
-	_, err := db.conn.Exec(`
-		UPDATE accounts SET token_hash = ? WHERE id = ?
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE accounts SET token_hash = ?, token_expires_at = NULL WHERE id = ?
 	`, tokenHash, id)
+	if err != nil {
+		return err
+	}
+	if err := setDefaultAccountTokenTx(tx, id, tokenHash, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateAccountTokenExpiry sets when an account's default token expires (nil = never)
+func (db *DB) UpdateAccountTokenExpiry(id string, expiresAt *time.Time) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE accounts SET token_expires_at = ? WHERE id = ?
+	`, expiresAt, id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE account_tokens SET expires_at = ? WHERE account_id = ? AND name = ?
+	`, expiresAt, id, DefaultAccountTokenName)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// IsTokenExpired checks if the account's token has passed its expiry time
+func (a *Account) IsTokenExpired() bool {
+	return a.TokenExpiresAt != nil && time.Now().After(*a.TokenExpiresAt)
+}
+
+// IsTokenExpiringSoon checks if the account's token is still valid but expires within the window
+func (a *Account) IsTokenExpiringSoon(window time.Duration) bool {
+	return a.TokenExpiresAt != nil && !a.IsTokenExpired() && time.Until(*a.TokenExpiresAt) <= window
+}
+
+// EffectiveAdminRole returns the admin's role, or "" for accounts that are not admins
+func (a *Account) EffectiveAdminRole() string {
+	if !a.IsAdmin {
+		return ""
+	}
+	if a.AdminRole == "" {
+		return AdminRoleFull
+	}
+	return a.AdminRole
+}
+
+// IsReadOnlyAdmin checks if the account is an admin with the read-only role
+func (a *Account) IsReadOnlyAdmin() bool {
+	return a.EffectiveAdminRole() == AdminRoleReadOnly
+}
+
+// SetAccountAdminRole sets an admin account's role
+func (db *DB) SetAccountAdminRole(id, role string) error {
+	_, err := db.conn.Exec(`
+		UPDATE accounts SET admin_role = ? WHERE id = ?
+	`, role, id)
 	return err
 }
 
+// UpdateAccountDefaultSubdomain sets the subdomain an account's tunnels get when
+// they register without one; "" means a random subdomain
+func (db *DB) UpdateAccountDefaultSubdomain(id, subdomain string) error {
+	_, err := db.conn.Exec(`
+		UPDATE accounts SET default_subdomain = ? WHERE id = ?
+	`, subdomain, id)
+	return err
+}
+
+// CountFullAdmins returns the number of active admins with full access
+func (db *DB) CountFullAdmins() (int, error) {
+	var count int
+	err := db.conn.QueryRow(`
+		SELECT COUNT(*) FROM accounts
+		WHERE is_admin = TRUE AND active = TRUE AND COALESCE(admin_role, '') != ?
+	`, AdminRoleReadOnly).Scan(&count)
+	return count, err
+}
+
 // UpdateAccountPassword updates the password hash for an account
 func (db *DB) UpdateAccountPassword(id, passwordHash string) error {
 	_, err := db.conn.Exec(`
@@ -243,20 +365,105 @@ func (db *DB) UpdateAccountPassword(id, passwordHash string) error {
 	return err
 }
 
-// UpdateAccountTOTP updates the TOTP secret and enabled status for an account
+// SetAccountMustChangePassword sets whether the account must change its password on next login
+func (db *DB) SetAccountMustChangePassword(id string, mustChange bool) error {
+	_, err := db.conn.Exec(`
+		UPDATE accounts SET must_change_password = ? WHERE id = ?
+	`, mustChange, id)
+	return err
+}
+
+// UpdateAccountTOTP updates the TOTP secret and enabled status for an account.
+// Enabling TOTP ends the re-enrollment grace period of a reset.
 func (db *DB) UpdateAccountTOTP(id, totpSecret string, enabled bool) error {
 	_, err := db.conn.Exec(`
-		UPDATE accounts SET totp_secret = ?, totp_enabled = ? WHERE id = ?
-	`, totpSecret, enabled, id)
+		UPDATE accounts SET totp_secret = ?, totp_enabled = ?, totp_setup_at = NULL,
+			totp_reset_at = CASE WHEN ? THEN NULL ELSE totp_reset_at END
+		WHERE id = ?
+	`, totpSecret, enabled, enabled, id)
 	return err
 }
 
+// BeginAccountTOTPSetup stores a new, not yet verified TOTP secret for an
+// account and records when the setup started
+func (db *DB) BeginAccountTOTPSetup(id, totpSecret string) error {
+	_, err := db.conn.Exec(`
+		UPDATE accounts SET totp_secret = ?, totp_enabled = FALSE, totp_setup_at = ? WHERE id = ?
+	`, totpSecret, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to begin account TOTP setup: %w", err)
+	}
+	return nil
+}
+
+// GetAccountTOTPSetupAt returns when the account's pending TOTP setup started,
+// or nil if there is none
+func (db *DB) GetAccountTOTPSetupAt(accountID string) (*time.Time, error) {
+	var setupAt sql.NullTime
+	err := db.conn.QueryRow(`SELECT totp_setup_at FROM accounts WHERE id = ?`, accountID).Scan(&setupAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account TOTP setup at: %w", err)
+	}
+	if !setupAt.Valid {
+		return nil, nil
+	}
+	return &setupAt.Time, nil
+}
+
+// ClearStaleTOTPSetups removes the unverified TOTP secrets of setups started
+// before the given time. Unverified secrets without a start time predate its
+// tracking and are cleared as well.
+func (db *DB) ClearStaleTOTPSetups(before time.Time) (int64, error) {
+	result, err := db.conn.Exec(`
+		UPDATE accounts SET totp_secret = '', totp_setup_at = NULL
+		WHERE totp_enabled = FALSE AND totp_secret != ''
+			AND (totp_setup_at IS NULL OR totp_setup_at < ?)
+	`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear stale TOTP setups: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// ResetAccountTOTP removes the account's TOTP and records when, which starts
+// the grace period in which an admin can re-enroll with password only
+func (db *DB) ResetAccountTOTP(id string) (resetAt time.Time, err error) {
+	resetAt = time.Now()
+	_, err = db.conn.Exec(`
+		UPDATE accounts SET totp_secret = '', totp_enabled = FALSE, totp_setup_at = NULL, totp_reset_at = ? WHERE id = ?
+	`, resetAt, id)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to reset account TOTP: %w", err)
+	}
+	return resetAt, nil
+}
+
+// GetAccountTOTPResetAt returns when the account's TOTP was reset, or nil if
+// it was not or TOTP has been enabled again since
+func (db *DB) GetAccountTOTPResetAt(accountID string) (*time.Time, error) {
+	var resetAt sql.NullTime
+	err := db.conn.QueryRow(`SELECT totp_reset_at FROM accounts WHERE id = ?`, accountID).Scan(&resetAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account TOTP reset at: %w", err)
+	}
+	if !resetAt.Valid {
+		return nil, nil
+	}
+	return &resetAt.Time, nil
+}
+
 // CreateAccountWithPassword creates a new account with username, password, and token
 func (db *DB) CreateAccountWithPassword(username, tokenHash, passwordHash string, isAdmin bool) (*Account, error) {
 	id := uuid.New().String()
 	now := time.Now()
 
-	_, err := db.conn.Exec(`
+	err := db.createAccountTx(id, tokenHash, nil, `
 		INSERT INTO accounts (id, username, token_hash, password_hash, is_admin, created_at, active)
 		VALUES (?, ?, ?, ?, ?, ?, ?)
 	`, id, username, tokenHash, passwordHash, isAdmin, now, true)
@@ -327,7 +534,7 @@ func (db *DB) CreateOrgAccount(username, tokenHash, passwordHash, orgID string)
 	id := uuid.New().String()
 	now := time.Now()
 
-	_, err := db.conn.Exec(`
+	err := db.createAccountTx(id, tokenHash, nil, `
 		INSERT INTO accounts (id, username, token_hash, password_hash, is_admin, org_id, created_at, active)
 		VALUES (?, ?, ?, ?, FALSE, ?, ?, TRUE)
 	`, id, username, tokenHash, passwordHash, orgID, now)
@@ -350,7 +557,7 @@ func (db *DB) CreateOrgAccount(username, tokenHash, passwordHash, orgID string)
 // ListAccountsByOrg returns all accounts for an organization
 func (db *DB) ListAccountsByOrg(orgID string) ([]*Account, error) {
 	rows, err := db.conn.Query(`
-		SELECT id, username, token_hash, password_hash, totp_secret, totp_enabled, is_admin, is_org_admin, org_id, created_at, last_used, active
+		SELECT id, username, token_hash, password_hash, totp_secret, totp_enabled, is_admin, is_org_admin, org_id, created_at, last_used, active, token_expires_at, COALESCE(must_change_password, FALSE), COALESCE(admin_role, ''), COALESCE(default_subdomain, '')
 		FROM accounts WHERE org_id = ? ORDER BY created_at DESC
 	`, orgID)
 	if err != nil {
@@ -361,14 +568,14 @@ func (db *DB) ListAccountsByOrg(orgID string) ([]*Account, error) {
 	var accounts []*Account
 	for rows.Next() {
 		account := &Account{}
-		var lastUsed sql.NullTime
+		var lastUsed, tokenExpiresAt sql.NullTime
 		var passwordHash, totpSecret, orgIDVal sql.NullString
 		var isOrgAdmin sql.NullBool
 
 		err := rows.Scan(
 			&account.ID, &account.Username, &account.TokenHash,
 			&passwordHash, &totpSecret, &account.TOTPEnabled,
-			&account.IsAdmin, &isOrgAdmin, &orgIDVal, &account.CreatedAt, &lastUsed, &account.Active,
+			&account.IsAdmin, &isOrgAdmin, &orgIDVal, &account.CreatedAt, &lastUsed, &account.Active, &tokenExpiresAt, &account.MustChangePassword, &account.AdminRole, &account.DefaultSubdomain,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan account: %w", err)
@@ -377,6 +584,9 @@ func (db *DB) ListAccountsByOrg(orgID string) ([]*Account, error) {
 		if lastUsed.Valid {
 			account.LastUsed = &lastUsed.Time
 		}
+		if tokenExpiresAt.Valid {
+			account.TokenExpiresAt = &tokenExpiresAt.Time
+		}
 		if passwordHash.Valid {
 			account.PasswordHash = passwordHash.String
 		}
@@ -416,7 +626,7 @@ func (db *DB) UpdateAccountOrg(accountID, orgID string) error {
 // GetAccountsByOrgWithPassword returns accounts for an org that have passwords set (for login)
 func (db *DB) GetAccountsByOrgWithPassword(orgID string) ([]*Account, error) {
 	rows, err := db.conn.Query(`
-		SELECT id, username, token_hash, password_hash, totp_secret, totp_enabled, is_admin, is_org_admin, org_id, created_at, last_used, active
+		SELECT id, username, token_hash, password_hash, totp_secret, totp_enabled, is_admin, is_org_admin, org_id, created_at, last_used, active, token_expires_at, COALESCE(must_change_password, FALSE), COALESCE(admin_role, ''), COALESCE(default_subdomain, '')
 		FROM accounts WHERE org_id = ? AND password_hash IS NOT NULL AND active = TRUE
 		ORDER BY created_at DESC
 	`, orgID)
@@ -428,14 +638,14 @@ func (db *DB) GetAccountsByOrgWithPassword(orgID string) ([]*Account, error) {
 	var accounts []*Account
 	for rows.Next() {
 		account := &Account{}
-		var lastUsed sql.NullTime
+		var lastUsed, tokenExpiresAt sql.NullTime
 		var passwordHash, totpSecret, orgIDVal sql.NullString
 		var isOrgAdmin sql.NullBool
 
 		err := rows.Scan(
 			&account.ID, &account.Username, &account.TokenHash,
 			&passwordHash, &totpSecret, &account.TOTPEnabled,
-			&account.IsAdmin, &isOrgAdmin, &orgIDVal, &account.CreatedAt, &lastUsed, &account.Active,
+			&account.IsAdmin, &isOrgAdmin, &orgIDVal, &account.CreatedAt, &lastUsed, &account.Active, &tokenExpiresAt, &account.MustChangePassword, &account.AdminRole, &account.DefaultSubdomain,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan account: %w", err)
@@ -444,6 +654,9 @@ func (db *DB) GetAccountsByOrgWithPassword(orgID string) ([]*Account, error) {
 		if lastUsed.Valid {
 			account.LastUsed = &lastUsed.Time
 		}
+		if tokenExpiresAt.Valid {
+			account.TokenExpiresAt = &tokenExpiresAt.Time
+		}
 		if passwordHash.Valid {
 			account.PasswordHash = passwordHash.String
 		}
@@ -479,29 +692,33 @@ func (db *DB) UpdateAccountOrgAdmin(id string, isOrgAdmin bool) error {
 	return err
 }
 
-// CreateOrgAccountWithOrgAdmin creates a new account associated with an organization with org admin option
-func (db *DB) CreateOrgAccountWithOrgAdmin(username, tokenHash, passwordHash, orgID string, isOrgAdmin bool) (*Account, error) {
+// CreateOrgAccountWithOrgAdmin creates a new account associated with an organization with org admin option.
+// Its token expires at tokenExpiresAt (nil = never), and mustChangePassword makes
+// its first login only grant a password change.
+func (db *DB) CreateOrgAccountWithOrgAdmin(username, tokenHash, passwordHash, orgID string, isOrgAdmin bool, tokenExpiresAt *time.Time, mustChangePassword bool) (*Account, error) {
 	id := uuid.New().String()
 	now := time.Now()
 
-	_, err := db.conn.Exec(`
-		INSERT INTO accounts (id, username, token_hash, password_hash, is_admin, is_org_admin, org_id, created_at, active)
-		VALUES (?, ?, ?, ?, FALSE, ?, ?, ?, TRUE)
-	`, id, username, tokenHash, passwordHash, isOrgAdmin, orgID, now)
+	err := db.createAccountTx(id, tokenHash, tokenExpiresAt, `
+		INSERT INTO accounts (id, username, token_hash, password_hash, is_admin, is_org_admin, org_id, created_at, active, token_expires_at, must_change_password)
+		VALUES (?, ?, ?, ?, FALSE, ?, ?, ?, TRUE, ?, ?)
+	`, id, username, tokenHash, passwordHash, isOrgAdmin, orgID, now, tokenExpiresAt, mustChangePassword)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create org account: %w", err)
 	}
 
 	return &Account{
-		ID:           id,
-		Username:     username,
-		TokenHash:    tokenHash,
-		PasswordHash: passwordHash,
-		IsAdmin:      false,
-		IsOrgAdmin:   isOrgAdmin,
-		OrgID:        orgID,
-		CreatedAt:    now,
-		Active:       true,
+		ID:                 id,
+		Username:           username,
+		TokenHash:          tokenHash,
+		PasswordHash:       passwordHash,
+		IsAdmin:            false,
+		IsOrgAdmin:         isOrgAdmin,
+		OrgID:              orgID,
+		CreatedAt:          now,
+		Active:             true,
+		TokenExpiresAt:     tokenExpiresAt,
+		MustChangePassword: mustChangePassword,
 	}, nil
 }
 
@@ -511,6 +728,9 @@ func (db *DB) HardDeleteAccount(id string) error {
 	// Delete API keys created by this account
 	db.conn.Exec(`DELETE FROM api_keys WHERE id IN (SELECT id FROM api_keys WHERE id = ?)`, id)
 
+	// Delete the account's tokens
+	db.conn.Exec(`DELETE FROM account_tokens WHERE account_id = ?`, id)
+
 	// Delete whitelist entries created by this account
 	db.conn.Exec(`DELETE FROM global_whitelist WHERE created_by = ?`, id)
 	db.conn.Exec(`DELETE FROM org_whitelist WHERE created_by = ?`, id)
@@ -520,3 +740,52 @@ func (db *DB) HardDeleteAccount(id string) error {
 	_, err := db.conn.Exec(`DELETE FROM accounts WHERE id = ?`, id)
 	return err
 }
+
+// RevokeAccountSessions deletes all of an account's tokens and invalidates the
+// dashboard sessions it holds, in one transaction. Dashboard tokens issued before
+// the returned time are rejected (see GetAccountSessionsRevokedAt).
+func (db *DB) RevokeAccountSessions(accountID string) (tokensRevoked int64, revokedAt time.Time, err error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM account_tokens WHERE account_id = ?`, accountID)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to delete account tokens: %w", err)
+	}
+	tokensRevoked, _ = result.RowsAffected()
+
+	if _, err := tx.Exec(`DELETE FROM login_sessions WHERE account_id = ?`, accountID); err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to delete login sessions: %w", err)
+	}
+
+	// Dashboard tokens carry their issue time in whole seconds
+	revokedAt = time.Now().Truncate(time.Second)
+	if _, err := tx.Exec(`UPDATE accounts SET sessions_revoked_at = ? WHERE id = ?`, revokedAt, accountID); err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to revoke account sessions: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return tokensRevoked, revokedAt, nil
+}
+
+// GetAccountSessionsRevokedAt returns when the account's sessions were last
+// revoked, or nil if they never were
+func (db *DB) GetAccountSessionsRevokedAt(accountID string) (*time.Time, error) {
+	var revokedAt sql.NullTime
+	err := db.conn.QueryRow(`SELECT sessions_revoked_at FROM accounts WHERE id = ?`, accountID).Scan(&revokedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account sessions revoked at: %w", err)
+	}
+	if !revokedAt.Valid {
+		return nil, nil
+	}
+	return &revokedAt.Time, nil
+}
@@ -0,0 +1,44 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCreateOrgAccountSettings(t *testing.T) {
+	database := newTestDB(t)
+	org, err := database.CreateOrganization("Acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+
+	expiresAt := time.Now().Add(30 * 24 * time.Hour).Truncate(time.Second)
+	created, err := database.CreateOrgAccountWithOrgAdmin("alice", "alice-token", "hash", org.ID, true, &expiresAt, true)
+	if err != nil {
+		t.Fatalf("CreateOrgAccountWithOrgAdmin() error: %v", err)
+	}
+
+	account, err := database.GetAccountByID(created.ID)
+	if err != nil || account == nil {
+		t.Fatalf("GetAccountByID() = %v, %v", account, err)
+	}
+	if !account.IsOrgAdmin || account.OrgID != org.ID || !account.MustChangePassword {
+		t.Errorf("account = %+v, want an org admin of Acme who must change the password", account)
+	}
+	if account.TokenExpiresAt == nil || !account.TokenExpiresAt.Equal(expiresAt) {
+		t.Errorf("TokenExpiresAt = %v, want %v", account.TokenExpiresAt, expiresAt)
+	}
+	tokens, err := database.ListAccountTokens(created.ID)
+	if err != nil || len(tokens) != 1 || tokens[0].ExpiresAt == nil || !tokens[0].ExpiresAt.Equal(expiresAt) {
+		t.Errorf("ListAccountTokens() = %+v, %v, want the default token expiring with the account", tokens, err)
+	}
+
+	// Without the settings the token never expires and login is not restricted
+	bob, err := database.CreateOrgAccountWithOrgAdmin("bob", "bob-token", "", org.ID, false, nil, false)
+	if err != nil {
+		t.Fatalf("CreateOrgAccountWithOrgAdmin() error: %v", err)
+	}
+	if account, _ := database.GetAccountByID(bob.ID); account == nil || account.TokenExpiresAt != nil || account.MustChangePassword {
+		t.Errorf("account = %+v, want no expiry and no password change", account)
+	}
+}
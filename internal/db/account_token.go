@@ -0,0 +1,233 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultAccountTokenName is the name of the token created with an account and replaced on regeneration
+const DefaultAccountTokenName = "default"
+
+// AccountToken represents one of an account's named API tokens
+type AccountToken struct {
+	ID        string     `json:"id"`
+	AccountID string     `json:"accountId"`
+	Name      string     `json:"name"`
+	TokenHash string     `json:"-"`
+	CreatedAt time.Time  `json:"createdAt"`
+	LastUsed  *time.Time `json:"lastUsed,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"` // Nil means the token never expires
+}
+
+// IsExpired checks if the token has passed its expiry time
+func (t *AccountToken) IsExpired() bool {
+	return t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt)
+}
+
+// IsExpiringSoon checks if the token is still valid but expires within the window
+func (t *AccountToken) IsExpiringSoon(window time.Duration) bool {
+	return t.ExpiresAt != nil && !t.IsExpired() && time.Until(*t.ExpiresAt) <= window
+}
+
+// CreateAccountToken adds a named token to an account
+func (db *DB) CreateAccountToken(accountID, name, tokenHash string, expiresAt *time.Time) (*AccountToken, error) {
+	token := newAccountToken(accountID, name, tokenHash, expiresAt)
+	if err := insertAccountToken(db.conn, token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// newAccountToken builds a token record with a fresh ID
+func newAccountToken(accountID, name, tokenHash string, expiresAt *time.Time) *AccountToken {
+	return &AccountToken{
+		ID:        uuid.New().String(),
+		AccountID: accountID,
+		Name:      name,
+		TokenHash: tokenHash,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+}
+
+// sqlExecer runs statements on the database or inside a transaction
+type sqlExecer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// insertAccountToken stores a token record
+func insertAccountToken(conn sqlExecer, token *AccountToken) error {
+	_, err := conn.Exec(`
+		INSERT INTO account_tokens (id, account_id, name, token_hash, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, token.ID, token.AccountID, token.Name, token.TokenHash, token.CreatedAt, token.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create account token: %w", err)
+	}
+	return nil
+}
+
+// GetAccountToken retrieves a token by ID
+func (db *DB) GetAccountToken(id string) (*AccountToken, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, account_id, name, token_hash, created_at, last_used, expires_at
+		FROM account_tokens WHERE id = ?
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account token: %w", err)
+	}
+	defer rows.Close()
+
+	tokens, err := scanAccountTokens(rows)
+	if err != nil || len(tokens) == 0 {
+		return nil, err
+	}
+	return tokens[0], nil
+}
+
+// ListAccountTokens returns all tokens of an account
+func (db *DB) ListAccountTokens(accountID string) ([]*AccountToken, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, account_id, name, token_hash, created_at, last_used, expires_at
+		FROM account_tokens WHERE account_id = ? ORDER BY created_at
+	`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list account tokens: %w", err)
+	}
+	defer rows.Close()
+
+	return scanAccountTokens(rows)
+}
+
+// AccountTokenNameExists checks if an account already has a token with the given name
+func (db *DB) AccountTokenNameExists(accountID, name string) (bool, error) {
+	var count int
+	err := db.conn.QueryRow(`
+		SELECT COUNT(*) FROM account_tokens WHERE account_id = ? AND name = ?
+	`, accountID, name).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to check account token name: %w", err)
+	}
+	return count > 0, nil
+}
+
+// UpdateAccountTokenLastUsed updates the last_used timestamp for a token
+func (db *DB) UpdateAccountTokenLastUsed(id string) error {
+	_, err := db.conn.Exec(`
+		UPDATE account_tokens SET last_used = ? WHERE id = ?
+	`, time.Now(), id)
+	return err
+}
+
+// DeleteAccountToken revokes a token of an account
+func (db *DB) DeleteAccountToken(accountID, id string) error {
+	_, err := db.conn.Exec(`DELETE FROM account_tokens WHERE id = ? AND account_id = ?`, id, accountID)
+	return err
+}
+
+// setDefaultAccountTokenTx replaces an account's default token inside tx
+func setDefaultAccountTokenTx(tx *sql.Tx, accountID, tokenHash string, expiresAt *time.Time) error {
+	_, err := tx.Exec(`
+		DELETE FROM account_tokens WHERE account_id = ? AND name = ?
+	`, accountID, DefaultAccountTokenName)
+	if err != nil {
+		return fmt.Errorf("failed to remove default account token: %w", err)
+	}
+
+	return insertAccountToken(tx, newAccountToken(accountID, DefaultAccountTokenName, tokenHash, expiresAt))
+}
+
+// createAccountTx inserts an account with the given statement and its default
+// token, expiring at tokenExpiresAt (nil = never), in one transaction, so an
+// account never exists without its token
+func (db *DB) createAccountTx(id, tokenHash string, tokenExpiresAt *time.Time, query string, args ...any) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(query, args...); err != nil {
+		return err
+	}
+	if err := setDefaultAccountTokenTx(tx, id, tokenHash, tokenExpiresAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// migrateLegacyAccountTokens copies each account's single legacy token into
+// account_tokens as its default token, so existing clients keep working
+func (db *DB) migrateLegacyAccountTokens() error {
+	rows, err := db.conn.Query(`
+		SELECT id, token_hash, token_expires_at FROM accounts
+		WHERE token_hash != ''
+		AND NOT EXISTS (SELECT 1 FROM account_tokens WHERE account_tokens.account_id = accounts.id)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to find legacy account tokens: %w", err)
+	}
+
+	type legacyToken struct {
+		accountID string
+		tokenHash string
+		expiresAt *time.Time
+	}
+	var legacy []legacyToken
+	for rows.Next() {
+		var t legacyToken
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&t.accountID, &t.tokenHash, &expiresAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan legacy account token: %w", err)
+		}
+		if expiresAt.Valid {
+			t.expiresAt = &expiresAt.Time
+		}
+		legacy = append(legacy, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read legacy account tokens: %w", err)
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, t := range legacy {
+		if err := insertAccountToken(tx, newAccountToken(t.accountID, DefaultAccountTokenName, t.tokenHash, t.expiresAt)); err != nil {
+			return fmt.Errorf("failed to migrate token for account %s: %w", t.accountID, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func scanAccountTokens(rows *sql.Rows) ([]*AccountToken, error) {
+	var tokens []*AccountToken
+	for rows.Next() {
+		token := &AccountToken{}
+		var lastUsed, expiresAt sql.NullTime
+
+		err := rows.Scan(&token.ID, &token.AccountID, &token.Name, &token.TokenHash, &token.CreatedAt, &lastUsed, &expiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan account token: %w", err)
+		}
+
+		if lastUsed.Valid {
+			token.LastUsed = &lastUsed.Time
+		}
+		if expiresAt.Valid {
+			token.ExpiresAt = &expiresAt.Time
+		}
+
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
@@ -0,0 +1,47 @@
+package db
+
+import "testing"
+
+func TestAccountTokenWritesAreAtomic(t *testing.T) {
+	database := newTestDB(t)
+	alice, err := database.CreateAccount("alice", "alice-default", false)
+	if err != nil {
+		t.Fatalf("CreateAccount() error: %v", err)
+	}
+	if _, err := database.CreateAccountToken(alice.ID, "laptop", "alice-laptop", nil); err != nil {
+		t.Fatalf("CreateAccountToken() error: %v", err)
+	}
+
+	// The account row would be valid, but its default token collides with
+	// alice's named token, so neither is created
+	if _, err := database.CreateAccount("bob", "alice-laptop", false); err == nil {
+		t.Fatal("CreateAccount() with a taken token = nil, want error")
+	}
+	if bob, err := database.GetAccountByUsername("bob"); err != nil || bob != nil {
+		t.Errorf("GetAccountByUsername(bob) = %v, %v, want no account left behind", bob, err)
+	}
+
+	// A failed regeneration keeps the old default token on the account and in account_tokens
+	if err := database.UpdateAccountToken(alice.ID, "alice-laptop"); err == nil {
+		t.Fatal("UpdateAccountToken() with a taken token = nil, want error")
+	}
+	account, err := database.GetAccountByTokenHash("alice-default")
+	if err != nil || account == nil || account.ID != alice.ID || account.TokenHash != "alice-default" {
+		t.Errorf("GetAccountByTokenHash(old default) = %+v, %v, want alice unchanged", account, err)
+	}
+
+	if err := database.UpdateAccountToken(alice.ID, "alice-rotated"); err != nil {
+		t.Fatalf("UpdateAccountToken() error: %v", err)
+	}
+	tokens, err := database.ListAccountTokens(alice.ID)
+	if err != nil {
+		t.Fatalf("ListAccountTokens() error: %v", err)
+	}
+	hashes := map[string]string{}
+	for _, token := range tokens {
+		hashes[token.Name] = token.TokenHash
+	}
+	if len(hashes) != 2 || hashes[DefaultAccountTokenName] != "alice-rotated" || hashes["laptop"] != "alice-laptop" {
+		t.Errorf("tokens after rotation = %v, want the new default and the laptop token", hashes)
+	}
+}
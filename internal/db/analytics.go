@@ -0,0 +1,143 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// AppAnalyticsBucket holds request counts for an application within one time bucket
+type AppAnalyticsBucket struct {
+	BucketStart  time.Time `json:"bucketStart"`
+	RequestCount int64     `json:"requestCount"`
+	Status2xx    int64     `json:"status2xx"`
+	Status3xx    int64     `json:"status3xx"`
+	Status4xx    int64     `json:"status4xx"`
+	Status5xx    int64     `json:"status5xx"`
+}
+
+// PathCount holds the request count for a single path
+type PathCount struct {
+	Path  string `json:"path"`
+	Count int64  `json:"count"`
+}
+
+// AddAppAnalytics adds request and status counts to an application's hourly bucket
+func (db *DB) AddAppAnalytics(appID string, bucket AppAnalyticsBucket) error {
+	_, err := db.conn.Exec(`
+		INSERT INTO app_analytics (app_id, bucket_start, request_count, status_2xx, status_3xx, status_4xx, status_5xx)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(app_id, bucket_start) DO UPDATE SET
+			request_count = request_count + excluded.request_count,
+			status_2xx = status_2xx + excluded.status_2xx,
+			status_3xx = status_3xx + excluded.status_3xx,
+			status_4xx = status_4xx + excluded.status_4xx,
+			status_5xx = status_5xx + excluded.status_5xx
+	`, appID, bucket.BucketStart, bucket.RequestCount,
+		bucket.Status2xx, bucket.Status3xx, bucket.Status4xx, bucket.Status5xx)
+	if err != nil {
+		return fmt.Errorf("failed to add app analytics: %w", err)
+	}
+	return nil
+}
+
+// AddAppPathCounts adds per-path request counts to an application's hourly bucket
+func (db *DB) AddAppPathCounts(appID string, bucketStart time.Time, paths map[string]int64) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO app_path_stats (app_id, bucket_start, path, request_count)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(app_id, bucket_start, path) DO UPDATE SET
+			request_count = request_count + excluded.request_count
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare path stats: %w", err)
+	}
+	defer stmt.Close()
+
+	for path, count := range paths {
+		if _, err := stmt.Exec(appID, bucketStart, path, count); err != nil {
+			return fmt.Errorf("failed to add path stats: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetAppAnalytics retrieves hourly analytics buckets for an application within a time range
+func (db *DB) GetAppAnalytics(appID string, start, end time.Time) ([]*AppAnalyticsBucket, error) {
+	rows, err := db.conn.Query(`
+		SELECT bucket_start, request_count, status_2xx, status_3xx, status_4xx, status_5xx
+		FROM app_analytics
+		WHERE app_id = ? AND bucket_start >= ? AND bucket_start < ?
+		ORDER BY bucket_start
+	`, appID, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get app analytics: %w", err)
+	}
+	defer rows.Close()
+
+	var buckets []*AppAnalyticsBucket
+	for rows.Next() {
+		b := &AppAnalyticsBucket{}
+		err := rows.Scan(&b.BucketStart, &b.RequestCount, &b.Status2xx, &b.Status3xx, &b.Status4xx, &b.Status5xx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan app analytics: %w", err)
+		}
+		buckets = append(buckets, b)
+	}
+
+	return buckets, rows.Err()
+}
+
+// GetAppTopPaths retrieves the most requested paths for an application within a time range
+func (db *DB) GetAppTopPaths(appID string, start, end time.Time, limit int) ([]*PathCount, error) {
+	rows, err := db.conn.Query(`
+		SELECT path, SUM(request_count) AS total
+		FROM app_path_stats
+		WHERE app_id = ? AND bucket_start >= ? AND bucket_start < ?
+		GROUP BY path
+		ORDER BY total DESC, path
+		LIMIT ?
+	`, appID, start, end, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get top paths: %w", err)
+	}
+	defer rows.Close()
+
+	var paths []*PathCount
+	for rows.Next() {
+		p := &PathCount{}
+		if err := rows.Scan(&p.Path, &p.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan top path: %w", err)
+		}
+		paths = append(paths, p)
+	}
+
+	return paths, rows.Err()
+}
+
+// DeleteAppAnalyticsBefore removes analytics and path stats older than the cutoff
+func (db *DB) DeleteAppAnalyticsBefore(cutoff time.Time) (int64, error) {
+	result, err := db.conn.Exec(`DELETE FROM app_analytics WHERE bucket_start < ?`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete old app analytics: %w", err)
+	}
+	deleted, _ := result.RowsAffected()
+
+	result, err = db.conn.Exec(`DELETE FROM app_path_stats WHERE bucket_start < ?`, cutoff)
+	if err != nil {
+		return deleted, fmt.Errorf("failed to delete old path stats: %w", err)
+	}
+	pathsDeleted, _ := result.RowsAffected()
+
+	return deleted + pathsDeleted, nil
+}
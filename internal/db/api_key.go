@@ -28,6 +28,25 @@ const (
 	KeyTypeApp KeyType = "app"
 )
 
+// Rate limit tiers for API keys
+const (
+	// RateLimitTierStandard shares the per-IP auth rate limit with anonymous traffic
+	RateLimitTierStandard = "standard"
+	// RateLimitTierElevated gets its own, more generous rate limit bucket keyed by the API key
+	RateLimitTierElevated = "elevated"
+	// RateLimitTierExempt bypasses auth rate limiting entirely
+	RateLimitTierExempt = "exempt"
+)
+
+// IsValidRateLimitTier reports whether tier is a known API key rate limit tier
+func IsValidRateLimitTier(tier string) bool {
+	switch tier {
+	case RateLimitTierStandard, RateLimitTierElevated, RateLimitTierExempt:
+		return true
+	}
+	return false
+}
+
 // APIKey represents an API key for authentication
 type APIKey struct {
 	ID          string     `json:"id"`
@@ -40,6 +59,9 @@ type APIKey struct {
 	CreatedAt   time.Time  `json:"createdAt"`
 	LastUsed    *time.Time `json:"lastUsed,omitempty"`
 	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+
+	// RateLimitTier controls how auth rate limiting applies to requests using this key
+	RateLimitTier string `json:"rateLimitTier"`
 }
 
 // GenerateAPIKey generates a new API key
@@ -70,6 +92,8 @@ func GenerateAPIKey(orgID, appID *string, description string, expiresAt *time.Ti
 		Description: description,
 		CreatedAt:   time.Now(),
 		ExpiresAt:   expiresAt,
+
+		RateLimitTier: RateLimitTierStandard,
 	}
 
 	return rawKey, key, nil
@@ -97,6 +121,8 @@ func GenerateAppAPIKey(orgID, appID, description string, expiresAt *time.Time) (
 		Description: description,
 		CreatedAt:   time.Now(),
 		ExpiresAt:   expiresAt,
+
+		RateLimitTier: RateLimitTierStandard,
 	}
 
 	return rawKey, key, nil
@@ -111,9 +137,9 @@ func HashAPIKey(key string) string {
 // CreateAPIKey stores a new API key in the database
 func (db *DB) CreateAPIKey(key *APIKey) error {
 	_, err := db.conn.Exec(`
-		INSERT INTO api_keys (id, org_id, app_id, key_type, key_hash, key_prefix, description, created_at, expires_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, key.ID, key.OrgID, key.AppID, key.KeyType, key.KeyHash, key.KeyPrefix, key.Description, key.CreatedAt, key.ExpiresAt)
+		INSERT INTO api_keys (id, org_id, app_id, key_type, key_hash, key_prefix, description, created_at, expires_at, rate_limit_tier)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, key.ID, key.OrgID, key.AppID, key.KeyType, key.KeyHash, key.KeyPrefix, key.Description, key.CreatedAt, key.ExpiresAt, key.RateLimitTier)
 	if err != nil {
 		return fmt.Errorf("failed to create API key: %w", err)
 	}
@@ -127,11 +153,12 @@ func (db *DB) GetAPIKeyByID(id string) (*APIKey, error) {
 	var lastUsed, expiresAt sql.NullTime
 
 	err := db.conn.QueryRow(`
-		SELECT id, org_id, app_id, key_type, key_hash, key_prefix, description, created_at, last_used, expires_at
+		SELECT id, org_id, app_id, key_type, key_hash, key_prefix, description, created_at, last_used, expires_at,
+		       COALESCE(rate_limit_tier, 'standard')
 		FROM api_keys WHERE id = ?
 	`, id).Scan(
 		&key.ID, &orgID, &appID, &keyType, &key.KeyHash, &key.KeyPrefix, &description,
-		&key.CreatedAt, &lastUsed, &expiresAt,
+		&key.CreatedAt, &lastUsed, &expiresAt, &key.RateLimitTier,
 	)
 
 	if err == sql.ErrNoRows {
@@ -172,11 +199,12 @@ func (db *DB) GetAPIKeyByHash(keyHash string) (*APIKey, error) {
 	var lastUsed, expiresAt sql.NullTime
 
 	err := db.conn.QueryRow(`
-		SELECT id, org_id, app_id, key_type, key_hash, key_prefix, description, created_at, last_used, expires_at
+		SELECT id, org_id, app_id, key_type, key_hash, key_prefix, description, created_at, last_used, expires_at,
+		       COALESCE(rate_limit_tier, 'standard')
 		FROM api_keys WHERE key_hash = ?
 	`, keyHash).Scan(
 		&key.ID, &orgID, &appID, &keyType, &key.KeyHash, &key.KeyPrefix, &description,
-		&key.CreatedAt, &lastUsed, &expiresAt,
+		&key.CreatedAt, &lastUsed, &expiresAt, &key.RateLimitTier,
 	)
 
 	if err == sql.ErrNoRows {
@@ -232,7 +260,8 @@ func (db *DB) ValidateAPIKey(rawKey string) (*APIKey, error) {
 // ListAPIKeysByOrg returns all API keys for an organization
 func (db *DB) ListAPIKeysByOrg(orgID string) ([]*APIKey, error) {
 	rows, err := db.conn.Query(`
-		SELECT id, org_id, app_id, key_type, key_hash, key_prefix, description, created_at, last_used, expires_at
+		SELECT id, org_id, app_id, key_type, key_hash, key_prefix, description, created_at, last_used, expires_at,
+		       COALESCE(rate_limit_tier, 'standard')
 		FROM api_keys WHERE org_id = ? ORDER BY created_at DESC
 	`, orgID)
 	if err != nil {
@@ -246,7 +275,8 @@ func (db *DB) ListAPIKeysByOrg(orgID string) ([]*APIKey, error) {
 // ListAPIKeysByApp returns all API keys for an application
 func (db *DB) ListAPIKeysByApp(appID string) ([]*APIKey, error) {
 	rows, err := db.conn.Query(`
-		SELECT id, org_id, app_id, key_type, key_hash, key_prefix, description, created_at, last_used, expires_at
+		SELECT id, org_id, app_id, key_type, key_hash, key_prefix, description, created_at, last_used, expires_at,
+		       COALESCE(rate_limit_tier, 'standard')
 		FROM api_keys WHERE app_id = ? ORDER BY created_at DESC
 	`, appID)
 	if err != nil {
@@ -265,7 +295,8 @@ func (db *DB) ListAPIKeysForAuth(orgID, appID *string) ([]*APIKey, error) {
 	if appID != nil {
 		// First try app-specific keys, then fall back to org keys
 		rows, err = db.conn.Query(`
-			SELECT id, org_id, app_id, key_type, key_hash, key_prefix, description, created_at, last_used, expires_at
+			SELECT id, org_id, app_id, key_type, key_hash, key_prefix, description, created_at, last_used, expires_at,
+		       COALESCE(rate_limit_tier, 'standard')
 			FROM api_keys 
 			WHERE (app_id = ? OR (app_id IS NULL AND org_id = ?))
 			AND (expires_at IS NULL OR expires_at > ?)
@@ -273,7 +304,8 @@ func (db *DB) ListAPIKeysForAuth(orgID, appID *string) ([]*APIKey, error) {
 		`, *appID, orgID, time.Now())
 	} else if orgID != nil {
 		rows, err = db.conn.Query(`
-			SELECT id, org_id, app_id, key_type, key_hash, key_prefix, description, created_at, last_used, expires_at
+			SELECT id, org_id, app_id, key_type, key_hash, key_prefix, description, created_at, last_used, expires_at,
+		       COALESCE(rate_limit_tier, 'standard')
 			FROM api_keys 
 			WHERE org_id = ? AND app_id IS NULL
 			AND (expires_at IS NULL OR expires_at > ?)
@@ -300,7 +332,7 @@ func scanAPIKeys(rows *sql.Rows) ([]*APIKey, error) {
 
 		err := rows.Scan(
 			&key.ID, &orgID, &appID, &keyType, &key.KeyHash, &key.KeyPrefix, &description,
-			&key.CreatedAt, &lastUsed, &expiresAt,
+			&key.CreatedAt, &lastUsed, &expiresAt, &key.RateLimitTier,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan API key: %w", err)
@@ -346,11 +378,47 @@ func (db *DB) DeleteAPIKey(id string) error {
 	return err
 }
 
+// ReplaceAPIKeys revokes the keys with oldIDs and stores their replacements in one
+// transaction, so a failure leaves the old keys working
+func (db *DB) ReplaceAPIKeys(oldIDs []string, replacements []*APIKey) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, id := range oldIDs {
+		if _, err := tx.Exec(`DELETE FROM api_keys WHERE id = ?`, id); err != nil {
+			return fmt.Errorf("failed to revoke API key: %w", err)
+		}
+	}
+	for _, key := range replacements {
+		if _, err := tx.Exec(`
+			INSERT INTO api_keys (id, org_id, app_id, key_type, key_hash, key_prefix, description, created_at, expires_at, rate_limit_tier)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, key.ID, key.OrgID, key.AppID, key.KeyType, key.KeyHash, key.KeyPrefix, key.Description, key.CreatedAt, key.ExpiresAt, key.RateLimitTier); err != nil {
+			return fmt.Errorf("failed to create API key: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// APIKeyPurgeSettings control how long expired API keys are kept
+type APIKeyPurgeSettings struct {
+	Enabled   bool `json:"enabled"`   // Purge expired keys in the background
+	GraceDays int  `json:"graceDays"` // Days an expired key stays listed before it is purged
+}
+
 // DeleteExpiredAPIKeys removes all expired API keys
 func (db *DB) DeleteExpiredAPIKeys() (int64, error) {
+	return db.DeleteAPIKeysExpiredBefore(time.Now())
+}
+
+// DeleteAPIKeysExpiredBefore removes the API keys that expired before a time
+func (db *DB) DeleteAPIKeysExpiredBefore(before time.Time) (int64, error) {
 	result, err := db.conn.Exec(`
 		DELETE FROM api_keys WHERE expires_at IS NOT NULL AND expires_at < ?
-	`, time.Now())
+	`, before)
 	if err != nil {
 		return 0, err
 	}
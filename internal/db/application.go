@@ -2,7 +2,9 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/google/uuid"
@@ -21,60 +23,164 @@ const (
 type AuthType string
 
 const (
-	AuthTypeBasic  AuthType = "basic"
-	AuthTypeAPIKey AuthType = "api_key"
-	AuthTypeOIDC   AuthType = "oidc"
+	AuthTypeBasic   AuthType = "basic"
+	AuthTypeAPIKey  AuthType = "api_key"
+	AuthTypeOIDC    AuthType = "oidc"
+	AuthTypeWebhook AuthType = "webhook"
 )
 
 // Application represents a persistent application with auth policies
 type Application struct {
-	ID        string    `json:"id"`
-	OrgID     string    `json:"orgId"`
-	Subdomain string    `json:"subdomain"`
-	Name      string    `json:"name"`
-	AuthMode  AuthMode  `json:"authMode"`
-	AuthType  AuthType  `json:"authType,omitempty"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID             string    `json:"id"`
+	OrgID          string    `json:"orgId"`
+	Subdomain      string    `json:"subdomain"`
+	Name           string    `json:"name"`
+	AuthMode       AuthMode  `json:"authMode"`
+	AuthType       AuthType  `json:"authType,omitempty"`
+	PreserveHost   bool      `json:"preserveHost"`             // Forward the visitor's Host header instead of the local address
+	MaxHeaderBytes int       `json:"maxHeaderBytes,omitempty"` // Request/response header size limit (0 = server default)
+	ForwardChunked bool      `json:"forwardChunked"`           // Keep chunked transfer encoding instead of buffering to a Content-Length
+	HTTP2          bool      `json:"http2"`                    // Advertise HTTP/2 to visitors with Alt-Svc
+	Coalesce       bool      `json:"coalesce"`                 // Share one backend request among identical concurrent GETs
+	StreamingMode  bool      `json:"streamingMode"`            // Relay every response as it arrives, uncompressed and uncoalesced
+	ForceHTTPS     string    `json:"forceHttps,omitempty"`     // ForceHTTPSOff, ForceHTTPSRedirect, ForceHTTPSReject or "" for the server's force_https setting
+	CreatedAt      time.Time `json:"createdAt"`
+
+	// HTMLBaseHref and HTMLRewriteOrigin configure the experimental HTML transform:
+	// a <base href> injected into HTML responses, and the backend origin whose
+	// absolute URLs are rewritten to the public tunnel URL (empty = off)
+	HTMLBaseHref      string `json:"htmlBaseHref,omitempty"`
+	HTMLRewriteOrigin string `json:"htmlRewriteOrigin,omitempty"`
+
+	// IdentityHeaders lists the authenticated visitor's details forwarded to the
+	// local service as X-Auth-* headers (see IdentityHeaderNames)
+	IdentityHeaders []string `json:"identityHeaders,omitempty"`
+
+	// StaticResponses are answered by the server itself at their path, without
+	// forwarding the request to the tunnel
+	StaticResponses []StaticResponse `json:"staticResponses,omitempty"`
+
+	// HostHeader chooses the Host header sent to the local service. Without a
+	// mode PreserveHost decides, then the server's host_header setting.
+	HostHeader HostHeaderConfig `json:"hostHeader"`
+
+	// ReleasedAt is set when the application's subdomain was released after a
+	// long time offline. A released application has no Subdomain and cannot be
+	// connected to until it is restored; ReleasedSubdomain keeps the old one.
+	ReleasedAt        *time.Time `json:"releasedAt,omitempty"`
+	ReleasedSubdomain string     `json:"releasedSubdomain,omitempty"`
 }
 
-// CreateApplication creates a new application
-func (db *DB) CreateApplication(orgID, subdomain, name string) (*Application, error) {
-	id := uuid.New().String()
-	now := time.Now()
+// releasedSubdomainPrefix starts the placeholder a released application holds in
+// the unique subdomain column. It cannot occur in a valid subdomain.
+const releasedSubdomainPrefix = "~released~"
 
-	_, err := db.conn.Exec(`
-		INSERT INTO applications (id, org_id, subdomain, name, auth_mode, created_at)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, id, orgID, subdomain, name, AuthModeInherit, now)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create application: %w", err)
-	}
+// Host header modes
+const (
+	HostHeaderPreserve = "preserve" // The visitor's public Host
+	HostHeaderLocal    = "local"    // The local target's address, set by the client
+	HostHeaderCustom   = "custom"   // A fixed value
+)
 
-	return &Application{
-		ID:        id,
+// HostHeaderConfig chooses the Host header sent to a local service
+type HostHeaderConfig struct {
+	Mode  string `json:"mode,omitempty"`  // HostHeaderPreserve, HostHeaderLocal, HostHeaderCustom or "" to inherit
+	Value string `json:"value,omitempty"` // The Host of HostHeaderCustom
+}
+
+// StaticResponse is a canned response to requests for one path of an application
+type StaticResponse struct {
+	Path    string            `json:"path"` // Exact URL path, e.g. /status
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	Public  bool              `json:"public,omitempty"` // Served before authentication, even without a tunnel
+}
+
+// IdentityHeaderNames maps the identity details an application can forward to
+// the header that carries them
+var IdentityHeaderNames = map[string]string{
+	"user":   "X-Auth-User",
+	"email":  "X-Auth-Email",
+	"method": "X-Auth-Method",
+	"groups": "X-Auth-Groups",
+}
+
+// CreateApplication creates a new application
+func (db *DB) CreateApplication(orgID, subdomain, name string) (*Application, error) {
+	app := &Application{
+		ID:        uuid.New().String(),
 		OrgID:     orgID,
 		Subdomain: subdomain,
 		Name:      name,
 		AuthMode:  AuthModeInherit,
-		CreatedAt: now,
-	}, nil
+		CreatedAt: time.Now(),
+	}
+	if err := insertApplication(db.conn, app); err != nil {
+		return nil, err
+	}
+	return app, nil
 }
 
-// GetApplicationByID retrieves an application by its ID
-func (db *DB) GetApplicationByID(id string) (*Application, error) {
-	app := &Application{}
-	var name, authType sql.NullString
-
-	err := db.conn.QueryRow(`
-		SELECT id, org_id, subdomain, name, auth_mode, auth_type, created_at
-		FROM applications WHERE id = ?
-	`, id).Scan(&app.ID, &app.OrgID, &app.Subdomain, &name, &app.AuthMode, &authType, &app.CreatedAt)
+// insertApplication stores an application record with all of its settings
+func insertApplication(conn sqlExecer, app *Application) error {
+	var authType *string
+	if app.AuthType != "" {
+		s := string(app.AuthType)
+		authType = &s
+	}
+	identityHeaders, err := nullableJSON(app.IdentityHeaders, len(app.IdentityHeaders))
+	if err != nil {
+		return fmt.Errorf("failed to encode identity headers: %w", err)
+	}
+	staticResponses, err := nullableJSON(app.StaticResponses, len(app.StaticResponses))
+	if err != nil {
+		return fmt.Errorf("failed to encode static responses: %w", err)
+	}
 
-	if err == sql.ErrNoRows {
-		return nil, nil
+	_, err = conn.Exec(`
+		INSERT INTO applications (
+			id, org_id, subdomain, name, auth_mode, auth_type, preserve_host, max_header_bytes,
+			forward_chunked, http2, coalesce_requests, streaming_mode, force_https,
+			html_base_href, html_rewrite_origin, host_header_mode, host_header_value,
+			identity_headers, static_responses, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, app.ID, app.OrgID, app.Subdomain, app.Name, app.AuthMode, authType, app.PreserveHost, app.MaxHeaderBytes,
+		app.ForwardChunked, app.HTTP2, app.Coalesce, app.StreamingMode, app.ForceHTTPS,
+		app.HTMLBaseHref, app.HTMLRewriteOrigin, app.HostHeader.Mode, app.HostHeader.Value,
+		identityHeaders, staticResponses, app.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create application: %w", err)
 	}
+	return nil
+}
+
+// applicationColumns are the applications columns read by scanApplication, in its order
+const applicationColumns = `id, org_id, subdomain, name, auth_mode, auth_type, COALESCE(preserve_host, FALSE), COALESCE(max_header_bytes, 0),
+	COALESCE(forward_chunked, FALSE), COALESCE(http2, FALSE), COALESCE(coalesce_requests, FALSE), COALESCE(streaming_mode, FALSE),
+	COALESCE(force_https, ''), COALESCE(html_base_href, ''), COALESCE(html_rewrite_origin, ''),
+	COALESCE(host_header_mode, ''), COALESCE(host_header_value, ''), identity_headers, static_responses,
+	released_at, COALESCE(released_subdomain, ''), created_at`
+
+// rowScanner is a *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanApplication reads an application selected with applicationColumns. The
+// error of Scan is returned as is, so callers can check for sql.ErrNoRows.
+func scanApplication(row rowScanner) (*Application, error) {
+	app := &Application{}
+	var name, authType, identityHeaders, staticResponses sql.NullString
+	var releasedAt sql.NullTime
+
+	err := row.Scan(&app.ID, &app.OrgID, &app.Subdomain, &name, &app.AuthMode, &authType, &app.PreserveHost, &app.MaxHeaderBytes,
+		&app.ForwardChunked, &app.HTTP2, &app.Coalesce, &app.StreamingMode,
+		&app.ForceHTTPS, &app.HTMLBaseHref, &app.HTMLRewriteOrigin,
+		&app.HostHeader.Mode, &app.HostHeader.Value, &identityHeaders, &staticResponses,
+		&releasedAt, &app.ReleasedSubdomain, &app.CreatedAt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get application: %w", err)
+		return nil, err
 	}
 
 	if name.Valid {
@@ -83,77 +189,62 @@ func (db *DB) GetApplicationByID(id string) (*Application, error) {
 	if authType.Valid {
 		app.AuthType = AuthType(authType.String)
 	}
-
+	// A corrupt list is logged rather than failing the read: the policy
+	// resolver would treat an error as "no application" and skip its auth
+	if identityHeaders.Valid {
+		if err := json.Unmarshal([]byte(identityHeaders.String), &app.IdentityHeaders); err != nil {
+			log.Printf("WARNING: invalid identity headers of application %s: %v", app.ID, err)
+		}
+	}
+	if staticResponses.Valid {
+		if err := json.Unmarshal([]byte(staticResponses.String), &app.StaticResponses); err != nil {
+			log.Printf("WARNING: invalid static responses of application %s: %v", app.ID, err)
+		}
+	}
+	if releasedAt.Valid {
+		app.ReleasedAt = &releasedAt.Time
+		app.Subdomain = ""
+	}
 	return app, nil
 }
 
-// GetApplicationBySubdomain retrieves an application by its subdomain
-func (db *DB) GetApplicationBySubdomain(subdomain string) (*Application, error) {
-	app := &Application{}
-	var name, authType sql.NullString
-
-	err := db.conn.QueryRow(`
-		SELECT id, org_id, subdomain, name, auth_mode, auth_type, created_at
-		FROM applications WHERE subdomain = ?
-	`, subdomain).Scan(&app.ID, &app.OrgID, &app.Subdomain, &name, &app.AuthMode, &authType, &app.CreatedAt)
-
+// GetApplicationByID retrieves an application by its ID
+func (db *DB) GetApplicationByID(id string) (*Application, error) {
+	app, err := scanApplication(db.conn.QueryRow(`SELECT `+applicationColumns+` FROM applications WHERE id = ?`, id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get application: %w", err)
 	}
+	return app, nil
+}
 
-	if name.Valid {
-		app.Name = name.String
+// GetApplicationBySubdomain retrieves an application by its subdomain
+func (db *DB) GetApplicationBySubdomain(subdomain string) (*Application, error) {
+	app, err := scanApplication(db.conn.QueryRow(`SELECT `+applicationColumns+` FROM applications WHERE subdomain = ?`, subdomain))
+	if err == sql.ErrNoRows {
+		return nil, nil
 	}
-	if authType.Valid {
-		app.AuthType = AuthType(authType.String)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get application: %w", err)
 	}
-
 	return app, nil
 }
 
 // ListApplicationsByOrg returns all applications for an organization
 func (db *DB) ListApplicationsByOrg(orgID string) ([]*Application, error) {
-	rows, err := db.conn.Query(`
-		SELECT id, org_id, subdomain, name, auth_mode, auth_type, created_at
-		FROM applications WHERE org_id = ? ORDER BY created_at DESC
-	`, orgID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list applications: %w", err)
-	}
-	defer rows.Close()
-
-	var apps []*Application
-	for rows.Next() {
-		app := &Application{}
-		var name, authType sql.NullString
-
-		err := rows.Scan(&app.ID, &app.OrgID, &app.Subdomain, &name, &app.AuthMode, &authType, &app.CreatedAt)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan application: %w", err)
-		}
-
-		if name.Valid {
-			app.Name = name.String
-		}
-		if authType.Valid {
-			app.AuthType = AuthType(authType.String)
-		}
-
-		apps = append(apps, app)
-	}
-
-	return apps, rows.Err()
+	return db.listApplications(`WHERE org_id = ?`, orgID)
 }
 
 // ListAllApplications returns all applications
 func (db *DB) ListAllApplications() ([]*Application, error) {
-	rows, err := db.conn.Query(`
-		SELECT id, org_id, subdomain, name, auth_mode, auth_type, created_at
-		FROM applications ORDER BY created_at DESC
-	`)
+	return db.listApplications(``)
+}
+
+// listApplications returns the applications matching where, newest first
+func (db *DB) listApplications(where string, args ...any) ([]*Application, error) {
+	rows, err := db.conn.Query(`SELECT `+applicationColumns+` FROM applications `+where+` ORDER BY created_at DESC`, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list applications: %w", err)
 	}
@@ -161,24 +252,12 @@ func (db *DB) ListAllApplications() ([]*Application, error) {
 
 	var apps []*Application
 	for rows.Next() {
-		app := &Application{}
-		var name, authType sql.NullString
-
-		err := rows.Scan(&app.ID, &app.OrgID, &app.Subdomain, &name, &app.AuthMode, &authType, &app.CreatedAt)
+		app, err := scanApplication(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan application: %w", err)
 		}
-
-		if name.Valid {
-			app.Name = name.String
-		}
-		if authType.Valid {
-			app.AuthType = AuthType(authType.String)
-		}
-
 		apps = append(apps, app)
 	}
-
 	return apps, rows.Err()
 }
 
@@ -206,10 +285,177 @@ func (db *DB) UpdateApplicationAuthMode(id string, authMode AuthMode) error {
 	return err
 }
 
-// DeleteApplication deletes an application
+// UpdateApplicationPreserveHost sets whether the visitor's Host header is forwarded to the local service
+func (db *DB) UpdateApplicationPreserveHost(id string, preserveHost bool) error {
+	_, err := db.conn.Exec(`
+		UPDATE applications SET preserve_host = ? WHERE id = ?
+	`, preserveHost, id)
+	if err != nil {
+		return fmt.Errorf("failed to update application preserve host: %w", err)
+	}
+	return nil
+}
+
+// UpdateApplicationHostHeader sets the Host header sent to the application's local service
+func (db *DB) UpdateApplicationHostHeader(id string, hostHeader HostHeaderConfig) error {
+	_, err := db.conn.Exec(`
+		UPDATE applications SET host_header_mode = ?, host_header_value = ? WHERE id = ?
+	`, hostHeader.Mode, hostHeader.Value, id)
+	if err != nil {
+		return fmt.Errorf("failed to update application host header: %w", err)
+	}
+	return nil
+}
+
+// UpdateApplicationMaxHeaderBytes sets the application's header size limit (0 = server default)
+func (db *DB) UpdateApplicationMaxHeaderBytes(id string, maxHeaderBytes int) error {
+	_, err := db.conn.Exec(`
+		UPDATE applications SET max_header_bytes = ? WHERE id = ?
+	`, maxHeaderBytes, id)
+	if err != nil {
+		return fmt.Errorf("failed to update application max header bytes: %w", err)
+	}
+	return nil
+}
+
+// UpdateApplicationForwardChunked sets whether chunked request and response bodies
+// stay chunked instead of being buffered and sent with a Content-Length
+func (db *DB) UpdateApplicationForwardChunked(id string, forwardChunked bool) error {
+	_, err := db.conn.Exec(`
+		UPDATE applications SET forward_chunked = ? WHERE id = ?
+	`, forwardChunked, id)
+	if err != nil {
+		return fmt.Errorf("failed to update application forward chunked: %w", err)
+	}
+	return nil
+}
+
+// UpdateApplicationHTTP2 sets whether HTTP/2 is advertised to the application's visitors
+func (db *DB) UpdateApplicationHTTP2(id string, http2 bool) error {
+	_, err := db.conn.Exec(`
+		UPDATE applications SET http2 = ? WHERE id = ?
+	`, http2, id)
+	if err != nil {
+		return fmt.Errorf("failed to update application http2: %w", err)
+	}
+	return nil
+}
+
+// UpdateApplicationHTMLBaseHref sets the <base href> injected into HTML responses (empty = off)
+func (db *DB) UpdateApplicationHTMLBaseHref(id, baseHref string) error {
+	_, err := db.conn.Exec(`
+		UPDATE applications SET html_base_href = ? WHERE id = ?
+	`, baseHref, id)
+	if err != nil {
+		return fmt.Errorf("failed to update application html base href: %w", err)
+	}
+	return nil
+}
+
+// UpdateApplicationHTMLRewriteOrigin sets the backend origin rewritten to the public
+// URL in HTML responses (empty = off)
+func (db *DB) UpdateApplicationHTMLRewriteOrigin(id, origin string) error {
+	_, err := db.conn.Exec(`
+		UPDATE applications SET html_rewrite_origin = ? WHERE id = ?
+	`, origin, id)
+	if err != nil {
+		return fmt.Errorf("failed to update application html rewrite origin: %w", err)
+	}
+	return nil
+}
+
+// UpdateApplicationCoalesce sets whether identical concurrent GETs to the
+// application share one backend request
+func (db *DB) UpdateApplicationCoalesce(id string, coalesce bool) error {
+	_, err := db.conn.Exec(`
+		UPDATE applications SET coalesce_requests = ? WHERE id = ?
+	`, coalesce, id)
+	if err != nil {
+		return fmt.Errorf("failed to update application coalesce: %w", err)
+	}
+	return nil
+}
+
+// UpdateApplicationStreamingMode sets whether every response of the application
+// is relayed to visitors as it arrives
+func (db *DB) UpdateApplicationStreamingMode(id string, streamingMode bool) error {
+	_, err := db.conn.Exec(`
+		UPDATE applications SET streaming_mode = ? WHERE id = ?
+	`, streamingMode, id)
+	if err != nil {
+		return fmt.Errorf("failed to update application streaming mode: %w", err)
+	}
+	return nil
+}
+
+// UpdateApplicationForceHTTPS sets how plain HTTP requests to the application are handled
+func (db *DB) UpdateApplicationForceHTTPS(id string, mode string) error {
+	_, err := db.conn.Exec(`
+		UPDATE applications SET force_https = ? WHERE id = ?
+	`, mode, id)
+	if err != nil {
+		return fmt.Errorf("failed to update application force https: %w", err)
+	}
+	return nil
+}
+
+// UpdateApplicationIdentityHeaders sets which identity headers are forwarded to the local service
+func (db *DB) UpdateApplicationIdentityHeaders(id string, identityHeaders []string) error {
+	value, err := nullableJSON(identityHeaders, len(identityHeaders))
+	if err != nil {
+		return fmt.Errorf("failed to encode identity headers: %w", err)
+	}
+	_, err = db.conn.Exec(`
+		UPDATE applications SET identity_headers = ? WHERE id = ?
+	`, value, id)
+	if err != nil {
+		return fmt.Errorf("failed to update application identity headers: %w", err)
+	}
+	return nil
+}
+
+// UpdateApplicationStaticResponses replaces the static responses of an application
+func (db *DB) UpdateApplicationStaticResponses(id string, responses []StaticResponse) error {
+	value, err := nullableJSON(responses, len(responses))
+	if err != nil {
+		return fmt.Errorf("failed to encode static responses: %w", err)
+	}
+	_, err = db.conn.Exec(`
+		UPDATE applications SET static_responses = ? WHERE id = ?
+	`, value, id)
+	if err != nil {
+		return fmt.Errorf("failed to update application static responses: %w", err)
+	}
+	return nil
+}
+
+// nullableJSON encodes a list stored as a JSON column, or returns nil for an
+// empty list so the column is NULL
+func nullableJSON(value any, n int) (*string, error) {
+	if n == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	s := string(data)
+	return &s, nil
+}
+
+// DeleteApplication deletes an application together with its auth policy, whitelist,
+// API keys, sessions and analytics in one transaction
 func (db *DB) DeleteApplication(id string) error {
-	_, err := db.conn.Exec(`DELETE FROM applications WHERE id = ?`, id)
-	return err
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := deleteApplicationsTx(tx, `id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // IsSubdomainAvailable checks if a subdomain is available for a new application
@@ -294,3 +540,71 @@ func (db *DB) UpdateApplicationFull(id, name, subdomain string, authMode AuthMod
 	`, name, subdomain, authMode, authTypeStr, id)
 	return err
 }
+
+// ListInactiveApplications returns the organization's applications that have
+// had no tunnel opened or closed since the given time and were created or
+// restored before it. Released applications are left out. Tunnels still open
+// are not seen here, as a server that stopped uncleanly leaves them unclosed;
+// callers check their live tunnels.
+func (db *DB) ListInactiveApplications(orgID string, since time.Time) ([]*Application, error) {
+	rows, err := db.conn.Query(`
+		SELECT a.id, a.subdomain, a.name, a.created_at
+		FROM applications a
+		WHERE a.org_id = ? AND a.released_at IS NULL
+		  AND COALESCE(a.restored_at, a.created_at) < ?
+		  AND NOT EXISTS (
+			SELECT 1 FROM tunnels t
+			WHERE t.app_id = a.id AND COALESCE(t.closed_at, t.created_at) >= ?
+		  )
+		ORDER BY a.created_at
+	`, orgID, since, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list inactive applications: %w", err)
+	}
+	defer rows.Close()
+
+	var apps []*Application
+	for rows.Next() {
+		app := &Application{OrgID: orgID}
+		var name sql.NullString
+		if err := rows.Scan(&app.ID, &app.Subdomain, &name, &app.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan application: %w", err)
+		}
+		app.Name = name.String
+		apps = append(apps, app)
+	}
+	return apps, rows.Err()
+}
+
+// ReleaseApplication frees an application's subdomain, keeping the application
+// and everything attached to it. It reports false when the application does
+// not exist or was already released.
+func (db *DB) ReleaseApplication(id string) (bool, error) {
+	result, err := db.conn.Exec(`
+		UPDATE applications
+		SET released_subdomain = subdomain, subdomain = ?, released_at = ?
+		WHERE id = ? AND released_at IS NULL
+	`, releasedSubdomainPrefix+id, time.Now(), id)
+	if err != nil {
+		return false, fmt.Errorf("failed to release application: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to release application: %w", err)
+	}
+	return n > 0, nil
+}
+
+// RestoreApplication gives a released application a subdomain again. The
+// inactivity window starts over from the restore.
+func (db *DB) RestoreApplication(id, subdomain string) error {
+	_, err := db.conn.Exec(`
+		UPDATE applications
+		SET subdomain = ?, released_subdomain = NULL, released_at = NULL, restored_at = ?
+		WHERE id = ? AND released_at IS NOT NULL
+	`, subdomain, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to restore application: %w", err)
+	}
+	return nil
+}
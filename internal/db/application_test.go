@@ -0,0 +1,46 @@
+package db
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestApplicationJSONColumns(t *testing.T) {
+	database := newTestDB(t)
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	app, err := database.CreateApplication(org.ID, "myapp", "My App")
+	if err != nil {
+		t.Fatalf("CreateApplication() error: %v", err)
+	}
+
+	if err := database.UpdateApplicationIdentityHeaders(app.ID, []string{"user", "email"}); err != nil {
+		t.Fatalf("UpdateApplicationIdentityHeaders() error: %v", err)
+	}
+	if got, err := database.GetApplicationByID(app.ID); err != nil || len(got.IdentityHeaders) != 2 {
+		t.Fatalf("GetApplicationByID() = %+v, %v, want two identity headers", got, err)
+	}
+
+	// A corrupt column is logged; the rest of the application, including its
+	// auth settings, still loads
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	for column, value := range map[string]string{"identity_headers": `["user"`, "static_responses": `{}`} {
+		logs.Reset()
+		if _, err := database.conn.Exec(`UPDATE applications SET `+column+` = ? WHERE id = ?`, value, app.ID); err != nil {
+			t.Fatalf("corrupting %s: %v", column, err)
+		}
+		if got, err := database.GetApplicationByID(app.ID); err != nil || got == nil || got.Subdomain != "myapp" {
+			t.Errorf("GetApplicationByID() with corrupt %s = %+v, %v, want the application", column, got, err)
+		}
+		if !strings.Contains(logs.String(), "application "+app.ID) {
+			t.Errorf("corrupt %s not logged: %q", column, logs.String())
+		}
+	}
+}
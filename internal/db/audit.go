@@ -20,8 +20,47 @@ type AuditEvent struct {
 	SourceIP      string    `json:"sourceIp"`
 	UserIdentity  string    `json:"userIdentity,omitempty"`
 	KeyID         string    `json:"keyId,omitempty"`
+	Actor         string    `json:"actor,omitempty"` // Admin who performed an admin action
 }
 
+// Audit auth types of admin actions
+const (
+	// AuditTypeTOTPReset is an admin removing an account's TOTP
+	AuditTypeTOTPReset = "totp_reset"
+	// AuditTypeTOTPGraceLogin is an admin logging in with password only to re-enroll TOTP after a reset
+	AuditTypeTOTPGraceLogin = "totp_grace_login"
+	// AuditTypeAPIKeysRotated is an org admin rotating all of the org's API keys
+	AuditTypeAPIKeysRotated = "api_keys_rotated"
+	// AuditTypeSessionsRevoked is an admin revoking all tokens and sessions of an account
+	AuditTypeSessionsRevoked = "sessions_revoked"
+	// AuditTypeSessionEvicted is a login ending an account's oldest session under the org's session limit
+	AuditTypeSessionEvicted = "session_evicted"
+	// AuditTypeRateLimitChanged is an admin changing the default auth rate limit
+	AuditTypeRateLimitChanged = "rate_limit_changed"
+	// AuditTypeSettingChanged is an admin changing a server setting
+	AuditTypeSettingChanged = "setting_changed"
+	// AuditTypeAdminRoleChanged is an admin changing the role of an admin account
+	AuditTypeAdminRoleChanged = "admin_role_changed"
+	// AuditTypeFeatureFlagsChanged is an admin changing an organization's feature flags
+	AuditTypeFeatureFlagsChanged = "feature_flags_changed"
+	// AuditTypeComplianceExport is an org admin exporting the stored data of a visitor identity
+	AuditTypeComplianceExport = "compliance_export"
+	// AuditTypeComplianceErase is an org admin erasing the stored data of a visitor identity
+	AuditTypeComplianceErase = "compliance_erase"
+	// AuditTypeAppReleased is the server releasing the subdomain of an application offline past its organization's window
+	AuditTypeAppReleased = "app_released"
+	// AuditTypeAppRestored is an admin restoring a released application
+	AuditTypeAppRestored = "app_restored"
+	// AuditTypeRequestBlocked is a visitor request blocked by one of the application's request rules
+	AuditTypeRequestBlocked = "request_blocked"
+	// AuditTypeAccountsReassigned is an admin moving accounts to another organization in bulk
+	AuditTypeAccountsReassigned = "accounts_reassigned"
+	// AuditTypeAPIKeysPurged is the server or an admin purging API keys expired past the grace window
+	AuditTypeAPIKeysPurged = "api_keys_purged"
+	// AuditTypeUsageRecomputed is an admin recomputing an organization's usage snapshots from its tunnel records
+	AuditTypeUsageRecomputed = "usage_recomputed"
+)
+
 // LogAuthEvent logs an authentication event
 func (db *DB) LogAuthEvent(event *AuditEvent) error {
 	if event.ID == "" {
@@ -34,10 +73,10 @@ func (db *DB) LogAuthEvent(event *AuditEvent) error {
 	_, err := db.conn.Exec(`
 		INSERT INTO auth_audit_log (
 			id, timestamp, org_id, app_id, auth_type, success,
-			failure_reason, source_ip, user_identity, key_id
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			failure_reason, source_ip, user_identity, key_id, actor
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`, event.ID, event.Timestamp, event.OrgID, event.AppID, event.AuthType,
-		event.Success, event.FailureReason, event.SourceIP, event.UserIdentity, event.KeyID)
+		event.Success, event.FailureReason, event.SourceIP, event.UserIdentity, event.KeyID, event.Actor)
 
 	if err != nil {
 		return fmt.Errorf("failed to log auth event: %w", err)
@@ -70,11 +109,23 @@ func (db *DB) LogAuthFailure(orgID, appID *string, authType, sourceIP, failureRe
 	})
 }
 
+// LogAdminAction logs a security-sensitive action an admin performed on an account or key
+func (db *DB) LogAdminAction(orgID *string, action, sourceIP, actor, target string) error {
+	return db.LogAuthEvent(&AuditEvent{
+		OrgID:        orgID,
+		AuthType:     action,
+		Success:      true,
+		SourceIP:     sourceIP,
+		UserIdentity: target,
+		Actor:        actor,
+	})
+}
+
 // GetAuditEvents retrieves audit events with optional filtering
 func (db *DB) GetAuditEvents(orgID, appID *string, limit, offset int) ([]*AuditEvent, error) {
 	query := `
 		SELECT id, timestamp, org_id, app_id, auth_type, success,
-			failure_reason, source_ip, user_identity, key_id
+			failure_reason, source_ip, user_identity, key_id, actor
 		FROM auth_audit_log
 		WHERE 1=1
 	`
@@ -105,7 +156,7 @@ func (db *DB) GetAuditEvents(orgID, appID *string, limit, offset int) ([]*AuditE
 func (db *DB) GetRecentAuditEvents(since time.Time, limit int) ([]*AuditEvent, error) {
 	rows, err := db.conn.Query(`
 		SELECT id, timestamp, org_id, app_id, auth_type, success,
-			failure_reason, source_ip, user_identity, key_id
+			failure_reason, source_ip, user_identity, key_id, actor
 		FROM auth_audit_log
 		WHERE timestamp > ?
 		ORDER BY timestamp DESC
@@ -143,11 +194,11 @@ func scanAuditEvents(rows *sql.Rows) ([]*AuditEvent, error) {
 	events := []*AuditEvent{}
 	for rows.Next() {
 		event := &AuditEvent{}
-		var orgID, appID, failureReason, userIdentity, keyID sql.NullString
+		var orgID, appID, failureReason, userIdentity, keyID, actor sql.NullString
 
 		err := rows.Scan(
 			&event.ID, &event.Timestamp, &orgID, &appID, &event.AuthType, &event.Success,
-			&failureReason, &event.SourceIP, &userIdentity, &keyID,
+			&failureReason, &event.SourceIP, &userIdentity, &keyID, &actor,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan audit event: %w", err)
@@ -168,6 +219,9 @@ func scanAuditEvents(rows *sql.Rows) ([]*AuditEvent, error) {
 		if keyID.Valid {
 			event.KeyID = keyID.String
 		}
+		if actor.Valid {
+			event.Actor = actor.String
+		}
 
 		events = append(events, event)
 	}
@@ -20,6 +20,9 @@ type OrgAuthPolicy struct {
 	OIDCScopes           []string          `json:"oidcScopes,omitempty"`
 	OIDCAllowedDomains   []string          `json:"oidcAllowedDomains,omitempty"`
 	OIDCRequiredClaims   map[string]string `json:"oidcRequiredClaims,omitempty"`
+	APIKeyRedirectURL    string            `json:"apiKeyRedirectUrl,omitempty"` // Where browsers without a valid API key are sent
+	WebhookURL           string            `json:"webhookUrl,omitempty"`        // Authorization webhook asked about each request
+	WebhookHeaders       []string          `json:"webhookHeaders,omitempty"`    // Request headers forwarded to the webhook (empty = default set)
 }
 
 // AppAuthPolicy represents an application-level authentication policy
@@ -36,20 +39,30 @@ type AppAuthPolicy struct {
 	OIDCScopes           []string          `json:"oidcScopes,omitempty"`
 	OIDCAllowedDomains   []string          `json:"oidcAllowedDomains,omitempty"`
 	OIDCRequiredClaims   map[string]string `json:"oidcRequiredClaims,omitempty"`
+	APIKeyRedirectURL    string            `json:"apiKeyRedirectUrl,omitempty"` // Where browsers without a valid API key are sent
+	WebhookURL           string            `json:"webhookUrl,omitempty"`        // Authorization webhook asked about each request
+	WebhookHeaders       []string          `json:"webhookHeaders,omitempty"`    // Request headers forwarded to the webhook (empty = default set)
 }
 
 // CreateOrgAuthPolicy creates or updates an organization auth policy
 func (db *DB) CreateOrgAuthPolicy(policy *OrgAuthPolicy) error {
+	return upsertOrgAuthPolicy(db.conn, policy)
+}
+
+// upsertOrgAuthPolicy stores an org auth policy, replacing the current one
+func upsertOrgAuthPolicy(conn sqlExecer, policy *OrgAuthPolicy) error {
 	scopesJSON, _ := json.Marshal(policy.OIDCScopes)
 	domainsJSON, _ := json.Marshal(policy.OIDCAllowedDomains)
 	claimsJSON, _ := json.Marshal(policy.OIDCRequiredClaims)
+	headersJSON, _ := json.Marshal(policy.WebhookHeaders)
 
-	_, err := db.conn.Exec(`
+	_, err := conn.Exec(`
 		INSERT INTO org_auth_policies (
 			org_id, auth_type, api_key_enabled, basic_user_hash, basic_pass_hash, basic_session_duration,
 			oidc_issuer_url, oidc_client_id, oidc_client_secret_enc,
-			oidc_scopes, oidc_allowed_domains, oidc_required_claims
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			oidc_scopes, oidc_allowed_domains, oidc_required_claims, api_key_redirect_url,
+			webhook_url, webhook_headers
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(org_id) DO UPDATE SET
 			auth_type = excluded.auth_type,
 			api_key_enabled = excluded.api_key_enabled,
@@ -61,10 +74,14 @@ func (db *DB) CreateOrgAuthPolicy(policy *OrgAuthPolicy) error {
 			oidc_client_secret_enc = excluded.oidc_client_secret_enc,
 			oidc_scopes = excluded.oidc_scopes,
 			oidc_allowed_domains = excluded.oidc_allowed_domains,
-			oidc_required_claims = excluded.oidc_required_claims
+			oidc_required_claims = excluded.oidc_required_claims,
+			api_key_redirect_url = excluded.api_key_redirect_url,
+			webhook_url = excluded.webhook_url,
+			webhook_headers = excluded.webhook_headers
 	`, policy.OrgID, policy.AuthType, policy.APIKeyEnabled, policy.BasicUserHash, policy.BasicPassHash, policy.BasicSessionDuration,
 		policy.OIDCIssuerURL, policy.OIDCClientID, policy.OIDCClientSecretEnc,
-		string(scopesJSON), string(domainsJSON), string(claimsJSON))
+		string(scopesJSON), string(domainsJSON), string(claimsJSON), policy.APIKeyRedirectURL,
+		policy.WebhookURL, string(headersJSON))
 
 	if err != nil {
 		return fmt.Errorf("failed to create org auth policy: %w", err)
@@ -76,19 +93,22 @@ func (db *DB) CreateOrgAuthPolicy(policy *OrgAuthPolicy) error {
 func (db *DB) GetOrgAuthPolicy(orgID string) (*OrgAuthPolicy, error) {
 	policy := &OrgAuthPolicy{OrgID: orgID}
 	var apiKeyEnabled sql.NullBool
-	var basicUserHash, basicPassHash, oidcIssuerURL, oidcClientID, oidcClientSecretEnc sql.NullString
+	var basicUserHash, basicPassHash, oidcIssuerURL, oidcClientID, oidcClientSecretEnc, apiKeyRedirectURL sql.NullString
 	var basicSessionDuration sql.NullInt64
 	var scopesJSON, domainsJSON, claimsJSON sql.NullString
+	var webhookURL, webhookHeadersJSON sql.NullString
 
 	err := db.conn.QueryRow(`
 		SELECT auth_type, api_key_enabled, basic_user_hash, basic_pass_hash, basic_session_duration,
 			oidc_issuer_url, oidc_client_id, oidc_client_secret_enc,
-			oidc_scopes, oidc_allowed_domains, oidc_required_claims
+			oidc_scopes, oidc_allowed_domains, oidc_required_claims, api_key_redirect_url,
+			webhook_url, webhook_headers
 		FROM org_auth_policies WHERE org_id = ?
 	`, orgID).Scan(
 		&policy.AuthType, &apiKeyEnabled, &basicUserHash, &basicPassHash, &basicSessionDuration,
 		&oidcIssuerURL, &oidcClientID, &oidcClientSecretEnc,
-		&scopesJSON, &domainsJSON, &claimsJSON,
+		&scopesJSON, &domainsJSON, &claimsJSON, &apiKeyRedirectURL,
+		&webhookURL, &webhookHeadersJSON,
 	)
 
 	if err == sql.ErrNoRows {
@@ -128,6 +148,15 @@ func (db *DB) GetOrgAuthPolicy(orgID string) (*OrgAuthPolicy, error) {
 	if claimsJSON.Valid {
 		json.Unmarshal([]byte(claimsJSON.String), &policy.OIDCRequiredClaims)
 	}
+	if apiKeyRedirectURL.Valid {
+		policy.APIKeyRedirectURL = apiKeyRedirectURL.String
+	}
+	if webhookURL.Valid {
+		policy.WebhookURL = webhookURL.String
+	}
+	if webhookHeadersJSON.Valid {
+		json.Unmarshal([]byte(webhookHeadersJSON.String), &policy.WebhookHeaders)
+	}
 
 	return policy, nil
 }
@@ -140,16 +169,23 @@ func (db *DB) DeleteOrgAuthPolicy(orgID string) error {
 
 // CreateAppAuthPolicy creates or updates an application auth policy
 func (db *DB) CreateAppAuthPolicy(policy *AppAuthPolicy) error {
+	return upsertAppAuthPolicy(db.conn, policy)
+}
+
+// upsertAppAuthPolicy stores an app auth policy, replacing the current one
+func upsertAppAuthPolicy(conn sqlExecer, policy *AppAuthPolicy) error {
 	scopesJSON, _ := json.Marshal(policy.OIDCScopes)
 	domainsJSON, _ := json.Marshal(policy.OIDCAllowedDomains)
 	claimsJSON, _ := json.Marshal(policy.OIDCRequiredClaims)
+	headersJSON, _ := json.Marshal(policy.WebhookHeaders)
 
-	_, err := db.conn.Exec(`
+	_, err := conn.Exec(`
 		INSERT INTO app_auth_policies (
 			app_id, auth_type, api_key_enabled, basic_user_hash, basic_pass_hash, basic_session_duration,
 			oidc_issuer_url, oidc_client_id, oidc_client_secret_enc,
-			oidc_scopes, oidc_allowed_domains, oidc_required_claims
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			oidc_scopes, oidc_allowed_domains, oidc_required_claims, api_key_redirect_url,
+			webhook_url, webhook_headers
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(app_id) DO UPDATE SET
 			auth_type = excluded.auth_type,
 			api_key_enabled = excluded.api_key_enabled,
@@ -161,10 +197,14 @@ func (db *DB) CreateAppAuthPolicy(policy *AppAuthPolicy) error {
 			oidc_client_secret_enc = excluded.oidc_client_secret_enc,
 			oidc_scopes = excluded.oidc_scopes,
 			oidc_allowed_domains = excluded.oidc_allowed_domains,
-			oidc_required_claims = excluded.oidc_required_claims
+			oidc_required_claims = excluded.oidc_required_claims,
+			api_key_redirect_url = excluded.api_key_redirect_url,
+			webhook_url = excluded.webhook_url,
+			webhook_headers = excluded.webhook_headers
 	`, policy.AppID, policy.AuthType, policy.APIKeyEnabled, policy.BasicUserHash, policy.BasicPassHash, policy.BasicSessionDuration,
 		policy.OIDCIssuerURL, policy.OIDCClientID, policy.OIDCClientSecretEnc,
-		string(scopesJSON), string(domainsJSON), string(claimsJSON))
+		string(scopesJSON), string(domainsJSON), string(claimsJSON), policy.APIKeyRedirectURL,
+		policy.WebhookURL, string(headersJSON))
 
 	if err != nil {
 		return fmt.Errorf("failed to create app auth policy: %w", err)
@@ -176,19 +216,22 @@ func (db *DB) CreateAppAuthPolicy(policy *AppAuthPolicy) error {
 func (db *DB) GetAppAuthPolicy(appID string) (*AppAuthPolicy, error) {
 	policy := &AppAuthPolicy{AppID: appID}
 	var apiKeyEnabled sql.NullBool
-	var basicUserHash, basicPassHash, oidcIssuerURL, oidcClientID, oidcClientSecretEnc sql.NullString
+	var basicUserHash, basicPassHash, oidcIssuerURL, oidcClientID, oidcClientSecretEnc, apiKeyRedirectURL sql.NullString
 	var basicSessionDuration sql.NullInt64
 	var scopesJSON, domainsJSON, claimsJSON sql.NullString
+	var webhookURL, webhookHeadersJSON sql.NullString
 
 	err := db.conn.QueryRow(`
 		SELECT auth_type, api_key_enabled, basic_user_hash, basic_pass_hash, basic_session_duration,
 			oidc_issuer_url, oidc_client_id, oidc_client_secret_enc,
-			oidc_scopes, oidc_allowed_domains, oidc_required_claims
+			oidc_scopes, oidc_allowed_domains, oidc_required_claims, api_key_redirect_url,
+			webhook_url, webhook_headers
 		FROM app_auth_policies WHERE app_id = ?
 	`, appID).Scan(
 		&policy.AuthType, &apiKeyEnabled, &basicUserHash, &basicPassHash, &basicSessionDuration,
 		&oidcIssuerURL, &oidcClientID, &oidcClientSecretEnc,
-		&scopesJSON, &domainsJSON, &claimsJSON,
+		&scopesJSON, &domainsJSON, &claimsJSON, &apiKeyRedirectURL,
+		&webhookURL, &webhookHeadersJSON,
 	)
 
 	if err == sql.ErrNoRows {
@@ -228,6 +271,15 @@ func (db *DB) GetAppAuthPolicy(appID string) (*AppAuthPolicy, error) {
 	if claimsJSON.Valid {
 		json.Unmarshal([]byte(claimsJSON.String), &policy.OIDCRequiredClaims)
 	}
+	if apiKeyRedirectURL.Valid {
+		policy.APIKeyRedirectURL = apiKeyRedirectURL.String
+	}
+	if webhookURL.Valid {
+		policy.WebhookURL = webhookURL.String
+	}
+	if webhookHeadersJSON.Valid {
+		json.Unmarshal([]byte(webhookHeadersJSON.String), &policy.WebhookHeaders)
+	}
 
 	return policy, nil
 }
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// ErasedIdentity replaces the user identity of erased audit events
+const ErasedIdentity = "[erased]"
+
+// orgScope matches rows of an organization, directly or through one of its applications.
+// It takes the organization ID twice.
+const orgScope = `(org_id = ? OR app_id IN (SELECT id FROM applications WHERE org_id = ?))`
+
+// ComplianceRecords is the stored data of an organization that references a visitor identity
+type ComplianceRecords struct {
+	AuditEvents []*AuditEvent  `json:"auditEvents"`
+	Sessions    []*AuthSession `json:"sessions"`
+}
+
+// GetComplianceRecords returns the organization's audit events and sessions that
+// reference identity (an email or username, matched case-insensitively)
+func (db *DB) GetComplianceRecords(orgID, identity string) (*ComplianceRecords, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, timestamp, org_id, app_id, auth_type, success,
+			failure_reason, source_ip, user_identity, key_id, actor
+		FROM auth_audit_log
+		WHERE `+orgScope+` AND LOWER(user_identity) = LOWER(?)
+		ORDER BY timestamp DESC
+	`, orgID, orgID, identity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit events: %w", err)
+	}
+	auditEvents, err := scanAuditEvents(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = db.conn.Query(`
+		SELECT id, app_id, org_id, user_email, user_claims, COALESCE(org_wide, FALSE), created_at, expires_at
+		FROM auth_sessions
+		WHERE `+orgScope+` AND LOWER(user_email) = LOWER(?)
+		ORDER BY created_at DESC
+	`, orgID, orgID, identity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []*AuthSession{}
+	for rows.Next() {
+		session := &AuthSession{}
+		var appID, sessionOrgID, claimsJSON sql.NullString
+		if err := rows.Scan(
+			&session.ID, &appID, &sessionOrgID, &session.UserEmail, &claimsJSON, &session.OrgWide,
+			&session.CreatedAt, &session.ExpiresAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		if appID.Valid {
+			session.AppID = &appID.String
+		}
+		if sessionOrgID.Valid {
+			session.OrgID = &sessionOrgID.String
+		}
+		if claimsJSON.Valid {
+			json.Unmarshal([]byte(claimsJSON.String), &session.UserClaims)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &ComplianceRecords{AuditEvents: auditEvents, Sessions: sessions}, nil
+}
+
+// EraseComplianceRecords deletes the organization's sessions of identity and
+// anonymizes its audit events in one transaction. Audit events are kept for
+// security statistics, with the identity replaced by ErasedIdentity and the
+// source IP cleared.
+func (db *DB) EraseComplianceRecords(orgID, identity string) (sessionsDeleted, auditEventsErased int64, err error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		DELETE FROM auth_sessions WHERE `+orgScope+` AND LOWER(user_email) = LOWER(?)
+	`, orgID, orgID, identity)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	sessionsDeleted, _ = result.RowsAffected()
+
+	result, err = tx.Exec(`
+		UPDATE auth_audit_log SET user_identity = ?, source_ip = ''
+		WHERE `+orgScope+` AND LOWER(user_identity) = LOWER(?)
+	`, ErasedIdentity, orgID, orgID, identity)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to anonymize audit events: %w", err)
+	}
+	auditEventsErased, _ = result.RowsAffected()
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return sessionsDeleted, auditEventsErased, nil
+}
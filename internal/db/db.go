@@ -13,11 +13,18 @@ import (
 
 // DB wraps the SQLite database connection
 type DB struct {
-	conn *sql.DB
+	conn *retryConn
 }
 
-// New creates a new database connection and initializes the schema
+// New creates a new database connection with the default retry settings and
+// initializes the schema
 func New(dbPath string) (*DB, error) {
+	return NewWithRetry(dbPath, DefaultRetryConfig())
+}
+
+// NewWithRetry creates a new database connection that waits out lock contention
+// as configured by retry, and initializes the schema
+func NewWithRetry(dbPath string, retry RetryConfig) (*DB, error) {
 	// Ensure directory exists
 	dir := filepath.Dir(dbPath)
 	if dir != "" && dir != "." {
@@ -26,7 +33,9 @@ func New(dbPath string) (*DB, error) {
 		}
 	}
 
-	conn, err := sql.Open("sqlite3", dbPath+"?_foreign_keys=on")
+	// WAL lets readers proceed while a write is in progress
+	dsn := fmt.Sprintf("%s?_foreign_keys=on&_journal_mode=WAL&_busy_timeout=%d", dbPath, retry.BusyTimeout.Milliseconds())
+	conn, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -36,7 +45,7 @@ func New(dbPath string) (*DB, error) {
 	conn.SetMaxIdleConns(5)
 	conn.SetConnMaxLifetime(5 * time.Minute)
 
-	db := &DB{conn: conn}
+	db := &DB{conn: &retryConn{DB: conn, retry: retry}}
 	if err := db.initSchema(); err != nil {
 		conn.Close()
 		return nil, fmt.Errorf("failed to initialize schema: %w", err)
@@ -52,7 +61,7 @@ func (db *DB) Close() error {
 
 // Conn returns the underlying database connection
 func (db *DB) Conn() *sql.DB {
-	return db.conn
+	return db.conn.DB
 }
 
 // initSchema creates the database tables if they don't exist
@@ -120,6 +129,27 @@ func (db *DB) initSchema() error {
 		FOREIGN KEY(account_id) REFERENCES accounts(id) ON DELETE CASCADE
 	);
 
+	CREATE TABLE IF NOT EXISTS account_tokens (
+		id TEXT PRIMARY KEY,
+		account_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_used TIMESTAMP,
+		expires_at TIMESTAMP,
+		FOREIGN KEY(account_id) REFERENCES accounts(id) ON DELETE CASCADE,
+		UNIQUE(account_id, name)
+	);
+
+	-- Dashboard and org portal logins of accounts whose org limits concurrent sessions
+	CREATE TABLE IF NOT EXISTS login_sessions (
+		id TEXT PRIMARY KEY,
+		account_id TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		expires_at TIMESTAMP NOT NULL,
+		FOREIGN KEY(account_id) REFERENCES accounts(id) ON DELETE CASCADE
+	);
+
 	CREATE TABLE IF NOT EXISTS tunnels (
 		id TEXT PRIMARY KEY,
 		account_id TEXT,
@@ -202,6 +232,18 @@ func (db *DB) initSchema() error {
 		expires_at TIMESTAMP NOT NULL
 	);
 
+	-- OIDC login state (CSRF state, nonce, PKCE verifier) between login and callback
+	CREATE TABLE IF NOT EXISTS oidc_states (
+		state TEXT PRIMARY KEY,
+		nonce TEXT NOT NULL,
+		pkce_verifier TEXT NOT NULL,
+		redirect_url TEXT,
+		app_id TEXT,
+		org_id TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		expires_at TIMESTAMP NOT NULL
+	);
+
 	-- Rate limiting state
 	CREATE TABLE IF NOT EXISTS rate_limit_state (
 		key TEXT PRIMARY KEY,
@@ -261,6 +303,70 @@ func (db *DB) initSchema() error {
 		UNIQUE(org_id, period_type, period_start)
 	);
 
+	-- Per-application request analytics in hourly buckets
+	CREATE TABLE IF NOT EXISTS app_analytics (
+		app_id TEXT NOT NULL REFERENCES applications(id) ON DELETE CASCADE,
+		bucket_start TIMESTAMP NOT NULL,
+		request_count BIGINT DEFAULT 0,
+		status_2xx BIGINT DEFAULT 0,
+		status_3xx BIGINT DEFAULT 0,
+		status_4xx BIGINT DEFAULT 0,
+		status_5xx BIGINT DEFAULT 0,
+		PRIMARY KEY(app_id, bucket_start)
+	);
+
+	-- Per-application request counts by path (top paths only, see server analytics)
+	CREATE TABLE IF NOT EXISTS app_path_stats (
+		app_id TEXT NOT NULL REFERENCES applications(id) ON DELETE CASCADE,
+		bucket_start TIMESTAMP NOT NULL,
+		path TEXT NOT NULL,
+		request_count BIGINT DEFAULT 0,
+		PRIMARY KEY(app_id, bucket_start, path)
+	);
+
+	-- Per-application favicon, served for /favicon.ico without reaching the tunnel
+	CREATE TABLE IF NOT EXISTS app_favicons (
+		app_id TEXT PRIMARY KEY REFERENCES applications(id) ON DELETE CASCADE,
+		content_type TEXT NOT NULL,
+		data BLOB NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Per-application rules blocking matching requests before they are forwarded
+	CREATE TABLE IF NOT EXISTS app_request_rules (
+		id TEXT PRIMARY KEY,
+		app_id TEXT NOT NULL REFERENCES applications(id) ON DELETE CASCADE,
+		rule_type TEXT NOT NULL,
+		value TEXT NOT NULL DEFAULT '',
+		description TEXT NOT NULL DEFAULT '',
+		enabled BOOLEAN NOT NULL DEFAULT TRUE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Server-wide settings changed at runtime through the admin API, as JSON values
+	CREATE TABLE IF NOT EXISTS server_settings (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Per-organization feature flag overrides (flags without a row use the server default)
+	CREATE TABLE IF NOT EXISTS org_feature_flags (
+		org_id TEXT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+		flag TEXT NOT NULL,
+		enabled BOOLEAN NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(org_id, flag)
+	);
+
+	-- Server-wide request, error and tunnel counts snapshotted every minute for time series
+	CREATE TABLE IF NOT EXISTS server_metrics (
+		bucket_start TIMESTAMP PRIMARY KEY,
+		request_count BIGINT DEFAULT 0,
+		error_count BIGINT DEFAULT 0,
+		active_tunnels INTEGER DEFAULT 0
+	);
+
 	CREATE INDEX IF NOT EXISTS idx_accounts_username ON accounts(username);
 	CREATE INDEX IF NOT EXISTS idx_accounts_token_hash ON accounts(token_hash);
 	CREATE INDEX IF NOT EXISTS idx_accounts_org_id ON accounts(org_id);
@@ -278,12 +384,27 @@ func (db *DB) initSchema() error {
 	CREATE INDEX IF NOT EXISTS idx_api_keys_org_id ON api_keys(org_id);
 	CREATE INDEX IF NOT EXISTS idx_api_keys_app_id ON api_keys(app_id);
 	CREATE INDEX IF NOT EXISTS idx_auth_sessions_expires ON auth_sessions(expires_at);
+	CREATE INDEX IF NOT EXISTS idx_oidc_states_expires ON oidc_states(expires_at);
 	CREATE INDEX IF NOT EXISTS idx_auth_audit_log_timestamp ON auth_audit_log(timestamp);
 	CREATE INDEX IF NOT EXISTS idx_auth_audit_log_org_id ON auth_audit_log(org_id);
 	CREATE INDEX IF NOT EXISTS idx_auth_audit_log_app_id ON auth_audit_log(app_id);
 	CREATE INDEX IF NOT EXISTS idx_usage_snapshots_org_id ON usage_snapshots(org_id);
 	CREATE INDEX IF NOT EXISTS idx_usage_snapshots_period ON usage_snapshots(period_type, period_start);
 	CREATE INDEX IF NOT EXISTS idx_app_rate_limit_config_app_id ON app_rate_limit_config(app_id);
+	CREATE INDEX IF NOT EXISTS idx_app_request_rules_app_id ON app_request_rules(app_id);
+	CREATE INDEX IF NOT EXISTS idx_app_analytics_bucket ON app_analytics(bucket_start);
+	CREATE INDEX IF NOT EXISTS idx_app_path_stats_bucket ON app_path_stats(bucket_start);
+	CREATE INDEX IF NOT EXISTS idx_account_tokens_account_id ON account_tokens(account_id);
+	CREATE INDEX IF NOT EXISTS idx_login_sessions_account_id ON login_sessions(account_id);
+
+	-- Admin search matches prefixes with the case-insensitive LIKE, which only uses NOCASE indexes
+	DROP INDEX IF EXISTS idx_applications_name;
+	DROP INDEX IF EXISTS idx_api_keys_key_prefix;
+	CREATE INDEX IF NOT EXISTS idx_accounts_username_nocase ON accounts(username COLLATE NOCASE);
+	CREATE INDEX IF NOT EXISTS idx_organizations_name_nocase ON organizations(name COLLATE NOCASE);
+	CREATE INDEX IF NOT EXISTS idx_applications_subdomain_nocase ON applications(subdomain COLLATE NOCASE);
+	CREATE INDEX IF NOT EXISTS idx_applications_name_nocase ON applications(name COLLATE NOCASE);
+	CREATE INDEX IF NOT EXISTS idx_api_keys_key_prefix_nocase ON api_keys(key_prefix COLLATE NOCASE);
 	`
 
 	_, err := db.conn.Exec(schema)
@@ -292,7 +413,16 @@ func (db *DB) initSchema() error {
 	}
 
 	// Run migrations for existing databases
-	return db.runMigrations()
+	if err := db.runMigrations(); err != nil {
+		return err
+	}
+
+	// OIDC states used to be stored in auth_sessions, drop any left from before oidc_states
+	if _, err := db.conn.Exec(`DELETE FROM auth_sessions WHERE id LIKE 'oidc_state:%'`); err != nil {
+		return fmt.Errorf("failed to remove legacy OIDC states: %w", err)
+	}
+
+	return db.migrateLegacyAccountTokens()
 }
 
 // runMigrations adds new columns to existing databases
@@ -308,15 +438,61 @@ func (db *DB) runMigrations() error {
 		{"accounts", "totp_enabled", "BOOLEAN DEFAULT FALSE"},
 		{"accounts", "org_id", "TEXT REFERENCES organizations(id)"},
 		{"accounts", "is_org_admin", "BOOLEAN DEFAULT FALSE"},
+		{"accounts", "token_expires_at", "TIMESTAMP"},
+		{"accounts", "must_change_password", "BOOLEAN DEFAULT FALSE"},
 		{"tunnels", "app_id", "TEXT"},
 		{"tunnels", "request_count", "BIGINT DEFAULT 0"},
 		{"api_keys", "key_type", "TEXT DEFAULT 'account'"},
+		{"api_keys", "rate_limit_tier", "TEXT DEFAULT 'standard'"},
 		{"organizations", "require_totp", "BOOLEAN DEFAULT FALSE"},
 		{"organizations", "plan_id", "TEXT REFERENCES plans(id)"},
+		{"organizations", "auth_frame_ancestors", "TEXT"},
+		{"organizations", "brand_logo_url", "TEXT"},
+		{"organizations", "brand_primary_color", "TEXT"},
+		{"organizations", "brand_product_name", "TEXT"},
+		{"organizations", "session_cookie_domain", "TEXT"},
+		{"organizations", "session_cookie_same_site", "TEXT"},
+		{"organizations", "session_sso", "BOOLEAN DEFAULT FALSE"},
+		{"auth_sessions", "org_wide", "BOOLEAN DEFAULT FALSE"},
+		{"auth_audit_log", "actor", "TEXT"},
+		{"applications", "preserve_host", "BOOLEAN DEFAULT FALSE"},
+		{"applications", "max_header_bytes", "INTEGER"},
 		{"org_auth_policies", "basic_session_duration", "INTEGER"},
 		{"app_auth_policies", "basic_session_duration", "INTEGER"},
 		{"org_auth_policies", "api_key_enabled", "BOOLEAN DEFAULT FALSE"},
 		{"app_auth_policies", "api_key_enabled", "BOOLEAN DEFAULT FALSE"},
+		{"org_auth_policies", "api_key_redirect_url", "TEXT"},
+		{"app_auth_policies", "api_key_redirect_url", "TEXT"},
+		{"org_auth_policies", "webhook_url", "TEXT"},
+		{"org_auth_policies", "webhook_headers", "TEXT"},
+		{"app_auth_policies", "webhook_url", "TEXT"},
+		{"app_auth_policies", "webhook_headers", "TEXT"},
+		{"plans", "max_bytes_per_second", "BIGINT"},
+		{"plans", "max_forwards", "INTEGER"},
+		{"accounts", "sessions_revoked_at", "DATETIME"},
+		{"applications", "identity_headers", "TEXT"},
+		{"accounts", "totp_reset_at", "DATETIME"},
+		{"accounts", "totp_setup_at", "DATETIME"},
+		{"applications", "forward_chunked", "BOOLEAN DEFAULT FALSE"},
+		{"applications", "http2", "BOOLEAN DEFAULT FALSE"},
+		{"applications", "html_base_href", "TEXT"},
+		{"applications", "html_rewrite_origin", "TEXT"},
+		{"applications", "host_header_mode", "TEXT"},
+		{"applications", "host_header_value", "TEXT"},
+		{"organizations", "login_session_max", "INTEGER DEFAULT 0"},
+		{"organizations", "login_session_on_exceed", "TEXT"},
+		{"accounts", "admin_role", "TEXT"},
+		{"plans", "max_concurrent_requests", "INTEGER"},
+		{"plans", "release_inactive_days", "INTEGER"},
+		{"applications", "released_at", "TIMESTAMP"},
+		{"applications", "released_subdomain", "TEXT"},
+		{"applications", "restored_at", "TIMESTAMP"},
+		{"tunnels", "local_target", "TEXT"},
+		{"applications", "coalesce_requests", "BOOLEAN DEFAULT FALSE"},
+		{"applications", "streaming_mode", "BOOLEAN DEFAULT FALSE"},
+		{"applications", "static_responses", "TEXT"},
+		{"applications", "force_https", "TEXT DEFAULT ''"},
+		{"accounts", "default_subdomain", "TEXT"},
 	}
 
 	for _, m := range columnMigrations {
@@ -0,0 +1,18 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// newTestDB opens a fresh database in the test's temporary directory and
+// closes it when the test ends
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	database, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
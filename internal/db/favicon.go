@@ -0,0 +1,66 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// AppFavicon is an uploaded favicon served for an application's /favicon.ico
+type AppFavicon struct {
+	AppID       string
+	ContentType string
+	Data        []byte
+	UpdatedAt   time.Time
+}
+
+// GetAppFavicon retrieves an application's favicon (nil if none is uploaded)
+func (db *DB) GetAppFavicon(appID string) (*AppFavicon, error) {
+	return db.scanAppFavicon(db.conn.QueryRow(`
+		SELECT app_id, content_type, data, updated_at FROM app_favicons WHERE app_id = ?
+	`, appID))
+}
+
+// GetAppFaviconBySubdomain retrieves the favicon of the application on a subdomain (nil if none)
+func (db *DB) GetAppFaviconBySubdomain(subdomain string) (*AppFavicon, error) {
+	return db.scanAppFavicon(db.conn.QueryRow(`
+		SELECT f.app_id, f.content_type, f.data, f.updated_at
+		FROM app_favicons f
+		JOIN applications a ON a.id = f.app_id
+		WHERE a.subdomain = ?
+	`, subdomain))
+}
+
+func (db *DB) scanAppFavicon(row *sql.Row) (*AppFavicon, error) {
+	var f AppFavicon
+	err := row.Scan(&f.AppID, &f.ContentType, &f.Data, &f.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get favicon: %w", err)
+	}
+	return &f, nil
+}
+
+// SetAppFavicon creates or replaces an application's favicon
+func (db *DB) SetAppFavicon(appID, contentType string, data []byte) error {
+	_, err := db.conn.Exec(`
+		INSERT INTO app_favicons (app_id, content_type, data, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(app_id) DO UPDATE SET
+			content_type = excluded.content_type,
+			data = excluded.data,
+			updated_at = excluded.updated_at
+	`, appID, contentType, data, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to set favicon: %w", err)
+	}
+	return nil
+}
+
+// DeleteAppFavicon removes an application's favicon
+func (db *DB) DeleteAppFavicon(appID string) error {
+	_, err := db.conn.Exec(`DELETE FROM app_favicons WHERE app_id = ?`, appID)
+	return err
+}
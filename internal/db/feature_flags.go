@@ -0,0 +1,68 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// Feature flags that can be toggled per organization for gradual rollout
+const (
+	FeatureStreaming           = "streaming"             // Relay streaming responses (NDJSON, SSE) as they arrive
+	FeatureRequestLog          = "request_log"           // Record requests for application log tails
+	FeatureReleaseInactiveApps = "release_inactive_apps" // Release the subdomains of long-offline applications
+	FeatureGRPC                = "grpc"                  // Relay unary and server-streaming gRPC calls over HTTP/2 (experimental)
+)
+
+// FeatureFlags maps feature flags to whether they are enabled
+type FeatureFlags map[string]bool
+
+// GetOrgFeatureFlags returns the flags an organization overrides; flags it does
+// not override are missing from the map
+func (db *DB) GetOrgFeatureFlags(orgID string) (FeatureFlags, error) {
+	rows, err := db.conn.Query(`SELECT flag, enabled FROM org_feature_flags WHERE org_id = ?`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feature flags: %w", err)
+	}
+	defer rows.Close()
+
+	flags := make(FeatureFlags)
+	for rows.Next() {
+		var flag string
+		var enabled bool
+		if err := rows.Scan(&flag, &enabled); err != nil {
+			return nil, fmt.Errorf("failed to scan feature flag: %w", err)
+		}
+		flags[flag] = enabled
+	}
+	return flags, rows.Err()
+}
+
+// SetOrgFeatureFlags overrides an organization's feature flags in one
+// transaction. A nil value removes the override, so the default applies again.
+func (db *DB) SetOrgFeatureFlags(orgID string, flags map[string]*bool) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for flag, enabled := range flags {
+		if enabled == nil {
+			if _, err := tx.Exec(`DELETE FROM org_feature_flags WHERE org_id = ? AND flag = ?`, orgID, flag); err != nil {
+				return fmt.Errorf("failed to clear feature flag %s: %w", flag, err)
+			}
+			continue
+		}
+		_, err := tx.Exec(`
+			INSERT INTO org_feature_flags (org_id, flag, enabled, updated_at)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT(org_id, flag) DO UPDATE SET
+				enabled = excluded.enabled,
+				updated_at = excluded.updated_at
+		`, orgID, flag, *enabled, time.Now())
+		if err != nil {
+			return fmt.Errorf("failed to set feature flag %s: %w", flag, err)
+		}
+	}
+	return tx.Commit()
+}
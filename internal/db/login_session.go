@@ -0,0 +1,134 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LoginSession is a dashboard or org portal login, tracked so an organization
+// can limit how many an account has at once. Its ID is carried in the session JWT.
+type LoginSession struct {
+	ID        string    `json:"id"`
+	AccountID string    `json:"accountId"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// CreateLoginSession records a new login of an account that expires at expiresAt
+func (db *DB) CreateLoginSession(accountID string, expiresAt time.Time) (*LoginSession, error) {
+	session := &LoginSession{
+		ID:        uuid.New().String(),
+		AccountID: accountID,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+
+	if _, err := db.DeleteExpiredLoginSessions(); err != nil {
+		return nil, err
+	}
+
+	_, err := db.conn.Exec(`
+		INSERT INTO login_sessions (id, account_id, created_at, expires_at)
+		VALUES (?, ?, ?, ?)
+	`, session.ID, session.AccountID, session.CreatedAt, session.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create login session: %w", err)
+	}
+
+	return session, nil
+}
+
+// CreateLimitedLoginSession records a new login of an account that may have at
+// most max unexpired sessions. At the limit it deletes the oldest sessions to
+// make room when revokeOldest is set and returns them, or else creates nothing
+// and returns a nil session. Counting and inserting share one transaction, so
+// concurrent logins cannot both slip under the limit.
+func (db *DB) CreateLimitedLoginSession(accountID string, expiresAt time.Time, max int, revokeOldest bool) (*LoginSession, []*LoginSession, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if _, err := tx.Exec(`DELETE FROM login_sessions WHERE expires_at <= ?`, now); err != nil {
+		return nil, nil, fmt.Errorf("failed to delete expired login sessions: %w", err)
+	}
+
+	rows, err := tx.Query(`
+		SELECT id, account_id, created_at, expires_at
+		FROM login_sessions
+		WHERE account_id = ?
+		ORDER BY created_at ASC
+	`, accountID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list login sessions: %w", err)
+	}
+	var sessions []*LoginSession
+	for rows.Next() {
+		session := &LoginSession{}
+		if err := rows.Scan(&session.ID, &session.AccountID, &session.CreatedAt, &session.ExpiresAt); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("failed to scan login session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to list login sessions: %w", err)
+	}
+
+	var evicted []*LoginSession
+	if excess := len(sessions) - max + 1; excess > 0 {
+		if !revokeOldest {
+			return nil, nil, nil
+		}
+		evicted = sessions[:excess]
+		for _, session := range evicted {
+			if _, err := tx.Exec(`DELETE FROM login_sessions WHERE id = ?`, session.ID); err != nil {
+				return nil, nil, fmt.Errorf("failed to delete login session: %w", err)
+			}
+		}
+	}
+
+	session := &LoginSession{
+		ID:        uuid.New().String(),
+		AccountID: accountID,
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO login_sessions (id, account_id, created_at, expires_at)
+		VALUES (?, ?, ?, ?)
+	`, session.ID, session.AccountID, session.CreatedAt, session.ExpiresAt); err != nil {
+		return nil, nil, fmt.Errorf("failed to create login session: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit login session: %w", err)
+	}
+	return session, evicted, nil
+}
+
+// IsLoginSessionActive reports whether a login session exists and has not expired
+func (db *DB) IsLoginSessionActive(id string) (bool, error) {
+	var count int
+	err := db.conn.QueryRow(`
+		SELECT COUNT(*) FROM login_sessions WHERE id = ? AND expires_at > ?
+	`, id, time.Now()).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to check login session: %w", err)
+	}
+	return count > 0, nil
+}
+
+// DeleteExpiredLoginSessions removes login sessions whose JWT has expired
+func (db *DB) DeleteExpiredLoginSessions() (int64, error) {
+	result, err := db.conn.Exec(`DELETE FROM login_sessions WHERE expires_at <= ?`, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired login sessions: %w", err)
+	}
+	return result.RowsAffected()
+}
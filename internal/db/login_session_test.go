@@ -0,0 +1,57 @@
+package db
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCreateLimitedLoginSession(t *testing.T) {
+	database := newTestDB(t)
+	account, err := database.CreateAccount("bob", "token-hash", false)
+	if err != nil {
+		t.Fatalf("CreateAccount() error: %v", err)
+	}
+	expiresAt := time.Now().Add(time.Hour)
+
+	// Concurrent logins cannot both take the last free session
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			session, _, err := database.CreateLimitedLoginSession(account.ID, expiresAt, 2, false)
+			if err == nil && session != nil {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	var stored int
+	if err := database.Conn().QueryRow(`SELECT COUNT(*) FROM login_sessions WHERE account_id = ?`, account.ID).Scan(&stored); err != nil {
+		t.Fatalf("count login sessions: %v", err)
+	}
+	if created > 2 || stored != created {
+		t.Errorf("created %d sessions, %d stored, want at most 2 and all stored", created, stored)
+	}
+
+	// Revoking the oldest makes room and reports what it ended
+	for created < 2 {
+		if session, _, err := database.CreateLimitedLoginSession(account.ID, expiresAt, 2, false); err != nil || session == nil {
+			t.Fatalf("CreateLimitedLoginSession() under the limit = %v, %v", session, err)
+		}
+		created++
+	}
+	session, evicted, err := database.CreateLimitedLoginSession(account.ID, expiresAt, 2, true)
+	if err != nil || session == nil || len(evicted) != 1 {
+		t.Fatalf("CreateLimitedLoginSession() at the limit = %v, %v, %v, want a session and one evicted", session, evicted, err)
+	}
+	if active, _ := database.IsLoginSessionActive(evicted[0].ID); active {
+		t.Error("evicted session still active")
+	}
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// ServerMetrics holds server-wide counts for one snapshot interval
+type ServerMetrics struct {
+	BucketStart   time.Time `json:"bucketStart"`
+	RequestCount  int64     `json:"requestCount"`
+	ErrorCount    int64     `json:"errorCount"`
+	ActiveTunnels int       `json:"activeTunnels"` // Connected tunnels when the snapshot was taken
+}
+
+// MetricsRetentionSettings control how long server metrics snapshots are kept
+type MetricsRetentionSettings struct {
+	Days int `json:"days"`
+}
+
+// AddServerMetrics stores a metrics snapshot, adding to one already stored for the same bucket
+func (db *DB) AddServerMetrics(metrics ServerMetrics) error {
+	_, err := db.conn.Exec(`
+		INSERT INTO server_metrics (bucket_start, request_count, error_count, active_tunnels)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(bucket_start) DO UPDATE SET
+			request_count = request_count + excluded.request_count,
+			error_count = error_count + excluded.error_count,
+			active_tunnels = MAX(active_tunnels, excluded.active_tunnels)
+	`, metrics.BucketStart, metrics.RequestCount, metrics.ErrorCount, metrics.ActiveTunnels)
+	if err != nil {
+		return fmt.Errorf("failed to add server metrics: %w", err)
+	}
+	return nil
+}
+
+// GetServerMetrics retrieves the metrics snapshots within a time range
+func (db *DB) GetServerMetrics(start, end time.Time) ([]*ServerMetrics, error) {
+	rows, err := db.conn.Query(`
+		SELECT bucket_start, request_count, error_count, active_tunnels
+		FROM server_metrics
+		WHERE bucket_start >= ? AND bucket_start < ?
+		ORDER BY bucket_start
+	`, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get server metrics: %w", err)
+	}
+	defer rows.Close()
+
+	var snapshots []*ServerMetrics
+	for rows.Next() {
+		m := &ServerMetrics{}
+		if err := rows.Scan(&m.BucketStart, &m.RequestCount, &m.ErrorCount, &m.ActiveTunnels); err != nil {
+			return nil, fmt.Errorf("failed to scan server metrics: %w", err)
+		}
+		snapshots = append(snapshots, m)
+	}
+
+	return snapshots, rows.Err()
+}
+
+// DeleteServerMetricsBefore removes metrics snapshots older than the cutoff
+func (db *DB) DeleteServerMetricsBefore(cutoff time.Time) (int64, error) {
+	result, err := db.conn.Exec(`DELETE FROM server_metrics WHERE bucket_start < ?`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete old server metrics: %w", err)
+	}
+	return result.RowsAffected()
+}
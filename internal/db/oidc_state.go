@@ -0,0 +1,112 @@
+package db
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// DefaultOIDCStateTTL is how long a login may take between the redirect to the
+// identity provider and its callback
+const DefaultOIDCStateTTL = 10 * time.Minute
+
+// OIDCState represents an OIDC state for CSRF protection
+type OIDCState struct {
+	State        string    `json:"state"`
+	Nonce        string    `json:"nonce"`
+	PKCEVerifier string    `json:"pkceVerifier"`
+	RedirectURL  string    `json:"redirectUrl"`
+	AppID        *string   `json:"appId,omitempty"`
+	OrgID        *string   `json:"orgId,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+// CreateOIDCState creates a new OIDC state for auth flow, valid for ttl (0 = default).
+// Expired states are removed first, so abandoned logins do not pile up.
+func (db *DB) CreateOIDCState(appID, orgID *string, redirectURL, pkceVerifier string, ttl time.Duration) (*OIDCState, error) {
+	stateBytes := make([]byte, 32)
+	nonceBytes := make([]byte, 32)
+	if _, err := rand.Read(stateBytes); err != nil {
+		return nil, fmt.Errorf("failed to generate state: %w", err)
+	}
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	if ttl <= 0 {
+		ttl = DefaultOIDCStateTTL
+	}
+	now := time.Now()
+	state := &OIDCState{
+		State:        hex.EncodeToString(stateBytes),
+		Nonce:        hex.EncodeToString(nonceBytes),
+		PKCEVerifier: pkceVerifier,
+		RedirectURL:  redirectURL,
+		AppID:        appID,
+		OrgID:        orgID,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(ttl),
+	}
+
+	if _, err := db.DeleteExpiredOIDCStates(); err != nil {
+		return nil, err
+	}
+
+	_, err := db.conn.Exec(`
+		INSERT INTO oidc_states (state, nonce, pkce_verifier, redirect_url, app_id, org_id, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, state.State, state.Nonce, state.PKCEVerifier, state.RedirectURL, state.AppID, state.OrgID, state.CreatedAt, state.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OIDC state: %w", err)
+	}
+
+	return state, nil
+}
+
+// ValidateOIDCState validates and consumes an OIDC state. The state is deleted in the
+// same statement that reads it, so only one callback can use it, even across servers
+// sharing the database. Returns nil for unknown, used or expired states.
+func (db *DB) ValidateOIDCState(state string) (*OIDCState, error) {
+	oidcState := &OIDCState{}
+	var redirectURL, appID, orgID sql.NullString
+
+	err := db.conn.QueryRowScan(`
+		DELETE FROM oidc_states WHERE state = ?
+		RETURNING state, nonce, pkce_verifier, redirect_url, app_id, org_id, created_at, expires_at
+	`, []any{state},
+		&oidcState.State, &oidcState.Nonce, &oidcState.PKCEVerifier, &redirectURL,
+		&appID, &orgID, &oidcState.CreatedAt, &oidcState.ExpiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume OIDC state: %w", err)
+	}
+
+	if oidcState.ExpiresAt.Before(time.Now()) {
+		return nil, nil
+	}
+
+	oidcState.RedirectURL = redirectURL.String
+	if appID.Valid {
+		oidcState.AppID = &appID.String
+	}
+	if orgID.Valid {
+		oidcState.OrgID = &orgID.String
+	}
+
+	return oidcState, nil
+}
+
+// DeleteExpiredOIDCStates removes OIDC states of logins that were never completed
+func (db *DB) DeleteExpiredOIDCStates() (int64, error) {
+	result, err := db.conn.Exec(`DELETE FROM oidc_states WHERE expires_at < ?`, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired OIDC states: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOIDCStateStore(t *testing.T) {
+	database := newTestDB(t)
+
+	orgID := "org-1"
+	state, err := database.CreateOIDCState(nil, &orgID, "/dashboard", "verifier", time.Minute)
+	if err != nil {
+		t.Fatalf("CreateOIDCState() error: %v", err)
+	}
+
+	got, err := database.ValidateOIDCState(state.State)
+	if err != nil || got == nil {
+		t.Fatalf("ValidateOIDCState() = %v, %v, want the state", got, err)
+	}
+	if got.Nonce != state.Nonce || got.PKCEVerifier != "verifier" || got.RedirectURL != "/dashboard" || got.OrgID == nil || *got.OrgID != orgID || got.AppID != nil {
+		t.Errorf("ValidateOIDCState() = %+v, want %+v", got, state)
+	}
+	if again, _ := database.ValidateOIDCState(state.State); again != nil {
+		t.Error("state accepted twice")
+	}
+
+	expired, err := database.CreateOIDCState(nil, nil, "/", "verifier", time.Nanosecond)
+	if err != nil {
+		t.Fatalf("CreateOIDCState() error: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := database.CreateOIDCState(nil, nil, "/", "verifier", 0); err != nil {
+		t.Fatalf("CreateOIDCState() error: %v", err)
+	}
+	if got, _ := database.ValidateOIDCState(expired.State); got != nil {
+		t.Error("expired state accepted")
+	}
+	if n, _ := database.DeleteExpiredOIDCStates(); n != 0 {
+		t.Errorf("DeleteExpiredOIDCStates() removed %d states, want 0 after cleanup on create", n)
+	}
+	if n, _ := database.CountActiveSessions(); n != 0 {
+		t.Errorf("CountActiveSessions() = %d, want OIDC states not counted as sessions", n)
+	}
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OrganizationImport is an organization with its configuration, created by
+// ImportOrganization. IDs and creation times are assigned on import.
+type OrganizationImport struct {
+	Organization *Organization
+	Policy       *OrgAuthPolicy
+	Whitelist    []OrgWhitelistEntry
+	Applications []ApplicationImport
+}
+
+// ApplicationImport is an application of an OrganizationImport with its
+// policy, whitelist and rate limit settings
+type ApplicationImport struct {
+	Application *Application
+	Policy      *AppAuthPolicy
+	Whitelist   []AppWhitelistEntry
+	RateLimit   *AppRateLimitConfig
+}
+
+// ImportOrganization creates an organization and all of its applications,
+// policies, whitelists and rate limits in one transaction, so a failed import
+// leaves nothing behind. The records in imp are updated with their new IDs.
+func (db *DB) ImportOrganization(imp *OrganizationImport) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	org := imp.Organization
+	org.ID, org.CreatedAt = uuid.New().String(), now
+	if err := insertOrganization(tx, org); err != nil {
+		return err
+	}
+	if imp.Policy != nil {
+		imp.Policy.OrgID = org.ID
+		if err := upsertOrgAuthPolicy(tx, imp.Policy); err != nil {
+			return err
+		}
+	}
+	for i := range imp.Whitelist {
+		entry := &imp.Whitelist[i]
+		entry.ID, entry.OrgID, entry.CreatedAt = uuid.New().String(), org.ID, now
+		if err := insertOrgWhitelist(tx, entry); err != nil {
+			return err
+		}
+	}
+
+	for _, a := range imp.Applications {
+		app := a.Application
+		app.ID, app.OrgID, app.CreatedAt = uuid.New().String(), org.ID, now
+		if err := insertApplication(tx, app); err != nil {
+			return fmt.Errorf("%s: %w", app.Subdomain, err)
+		}
+		if a.Policy != nil {
+			a.Policy.AppID = app.ID
+			if err := upsertAppAuthPolicy(tx, a.Policy); err != nil {
+				return fmt.Errorf("%s: %w", app.Subdomain, err)
+			}
+		}
+		for i := range a.Whitelist {
+			entry := &a.Whitelist[i]
+			entry.ID, entry.AppID, entry.CreatedAt = uuid.New().String(), app.ID, now
+			if err := insertAppWhitelist(tx, entry); err != nil {
+				return fmt.Errorf("%s: %w", app.Subdomain, err)
+			}
+		}
+		if a.RateLimit != nil {
+			a.RateLimit.AppID = app.ID
+			if err := upsertAppRateLimitConfig(tx, a.RateLimit); err != nil {
+				return fmt.Errorf("%s: %w", app.Subdomain, err)
+			}
+		}
+	}
+
+	return tx.Commit()
+}
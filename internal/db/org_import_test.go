@@ -0,0 +1,59 @@
+package db
+
+import "testing"
+
+func TestImportOrganizationIsAtomic(t *testing.T) {
+	database := newTestDB(t)
+
+	imp := func(name string, secondRange string) *OrganizationImport {
+		return &OrganizationImport{
+			Organization: &Organization{Name: name, RequireTOTP: true, Branding: OrgBranding{ProductName: "Acme Cloud"}},
+			Policy:       &OrgAuthPolicy{AuthType: AuthTypeBasic},
+			Whitelist:    []OrgWhitelistEntry{{IPRange: "10.0.0.0/8"}},
+			Applications: []ApplicationImport{
+				{
+					Application: &Application{Subdomain: name + "-web", Name: "Web", AuthMode: AuthModeCustom, AuthType: AuthTypeOIDC, IdentityHeaders: []string{"user"}},
+					Policy:      &AppAuthPolicy{AuthType: AuthTypeOIDC, OIDCIssuerURL: "https://id.example.com"},
+					RateLimit:   &AppRateLimitConfig{Enabled: true, MaxAttempts: 5},
+				},
+				{
+					Application: &Application{Subdomain: name + "-api", Name: "API", AuthMode: AuthModeInherit},
+					Whitelist:   []AppWhitelistEntry{{IPRange: secondRange}},
+				},
+			},
+		}
+	}
+
+	// The second application's whitelist entry is invalid, so nothing of the import is kept
+	if err := database.ImportOrganization(imp("broken", "not-a-range")); err == nil {
+		t.Fatal("ImportOrganization() with an invalid range = nil, want error")
+	}
+	if org, err := database.GetOrganizationByName("broken"); err != nil || org != nil {
+		t.Errorf("GetOrganizationByName(broken) = %v, %v, want no organization left behind", org, err)
+	}
+	if available, _ := database.IsSubdomainAvailable("broken-web"); !available {
+		t.Error("subdomain of the failed import is still taken")
+	}
+
+	acme := imp("acme", "192.0.2.0/24")
+	if err := database.ImportOrganization(acme); err != nil {
+		t.Fatalf("ImportOrganization() error: %v", err)
+	}
+	org, err := database.GetOrganizationByID(acme.Organization.ID)
+	if err != nil || org == nil || !org.RequireTOTP || org.Branding.ProductName != "Acme Cloud" {
+		t.Fatalf("GetOrganizationByID() = %+v, %v, want the imported settings", org, err)
+	}
+	if policy, _ := database.GetOrgAuthPolicy(org.ID); policy == nil || policy.AuthType != AuthTypeBasic {
+		t.Errorf("org policy = %+v, want basic", policy)
+	}
+	web, err := database.GetApplicationBySubdomain("acme-web")
+	if err != nil || web == nil || web.OrgID != org.ID || web.AuthType != AuthTypeOIDC || len(web.IdentityHeaders) != 1 {
+		t.Fatalf("GetApplicationBySubdomain(acme-web) = %+v, %v, want the imported app", web, err)
+	}
+	if config, _ := database.GetAppRateLimitConfig(web.ID); config == nil || config.MaxAttempts != 5 {
+		t.Errorf("rate limit = %+v, want 5 attempts", config)
+	}
+	if entries, _ := database.ListAppWhitelist(acme.Applications[1].Application.ID); len(entries) != 1 || entries[0].IPRange != "192.0.2.0/24" {
+		t.Errorf("api whitelist = %+v, want the imported range", entries)
+	}
+}
@@ -15,50 +15,82 @@ type Organization struct {
 	PlanID      *string   `json:"planId,omitempty"`
 	RequireTOTP bool      `json:"requireTotp"`
 	CreatedAt   time.Time `json:"createdAt"`
+
+	// AuthFrameAncestors is the CSP frame-ancestors source list for the org's login pages ("" = not embeddable)
+	AuthFrameAncestors string `json:"authFrameAncestors,omitempty"`
+
+	// Branding customizes the org's login and error pages (empty fields use the defaults)
+	Branding OrgBranding `json:"branding"`
+
+	// SessionCookie overrides the attributes of Basic/OIDC session cookies (empty fields use the server defaults)
+	SessionCookie OrgSessionCookie `json:"sessionCookie"`
+
+	// LoginSessionLimit caps the concurrent dashboard/portal logins of each member
+	LoginSessionLimit OrgLoginSessionLimit `json:"loginSessionLimit"`
 }
 
-// CreateOrganization creates a new organization
-func (db *DB) CreateOrganization(name string) (*Organization, error) {
-	id := uuid.New().String()
-	now := time.Now()
+// OrgBranding holds an organization's white-label settings
+type OrgBranding struct {
+	LogoURL      string `json:"logoUrl,omitempty"`
+	PrimaryColor string `json:"primaryColor,omitempty"`
+	ProductName  string `json:"productName,omitempty"`
+}
 
-	_, err := db.conn.Exec(`
-		INSERT INTO organizations (id, name, require_totp, created_at)
-		VALUES (?, ?, ?, ?)
-	`, id, name, false, now)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create organization: %w", err)
-	}
+// OrgSessionCookie holds an organization's session cookie attributes
+type OrgSessionCookie struct {
+	Domain   string `json:"domain,omitempty"`   // Cookie Domain, e.g. the server domain for SSO across tunnels
+	SameSite string `json:"sameSite,omitempty"` // "lax", "strict" or "none"
+	SSO      bool   `json:"sso,omitempty"`      // Share OIDC sessions across all of the org's subdomains
+}
+
+// What happens to a login that exceeds an organization's session limit
+const (
+	LoginSessionRevokeOldest = "revoke_oldest" // The member's oldest sessions are logged out (default)
+	LoginSessionReject       = "reject"        // The login is rejected
+)
 
-	return &Organization{
-		ID:          id,
-		Name:        name,
-		PlanID:      nil,
-		RequireTOTP: false,
-		CreatedAt:   now,
-	}, nil
+// OrgLoginSessionLimit holds an organization's concurrent login session limit
+type OrgLoginSessionLimit struct {
+	Max      int    `json:"max"`                // Concurrent sessions per account (0 = unlimited)
+	OnExceed string `json:"onExceed,omitempty"` // LoginSessionRevokeOldest or LoginSessionReject
+}
+
+// CreateOrganization creates a new organization
+func (db *DB) CreateOrganization(name string) (*Organization, error) {
+	return db.CreateOrganizationWithPlan(name, nil)
 }
 
 // CreateOrganizationWithPlan creates a new organization with a plan
 func (db *DB) CreateOrganizationWithPlan(name string, planID *string) (*Organization, error) {
-	id := uuid.New().String()
-	now := time.Now()
+	org := &Organization{
+		ID:        uuid.New().String(),
+		Name:      name,
+		PlanID:    planID,
+		CreatedAt: time.Now(),
+	}
+	if err := insertOrganization(db.conn, org); err != nil {
+		return nil, err
+	}
+	return org, nil
+}
 
-	_, err := db.conn.Exec(`
-		INSERT INTO organizations (id, name, plan_id, require_totp, created_at)
-		VALUES (?, ?, ?, ?, ?)
-	`, id, name, planID, false, now)
+// insertOrganization stores an organization record with all of its settings
+func insertOrganization(conn sqlExecer, org *Organization) error {
+	_, err := conn.Exec(`
+		INSERT INTO organizations (
+			id, name, plan_id, require_totp, created_at, auth_frame_ancestors,
+			brand_logo_url, brand_primary_color, brand_product_name,
+			session_cookie_domain, session_cookie_same_site, session_sso,
+			login_session_max, login_session_on_exceed
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, org.ID, org.Name, org.PlanID, org.RequireTOTP, org.CreatedAt, org.AuthFrameAncestors,
+		org.Branding.LogoURL, org.Branding.PrimaryColor, org.Branding.ProductName,
+		org.SessionCookie.Domain, org.SessionCookie.SameSite, org.SessionCookie.SSO,
+		org.LoginSessionLimit.Max, org.LoginSessionLimit.OnExceed)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create organization: %w", err)
+		return fmt.Errorf("failed to create organization: %w", err)
 	}
-
-	return &Organization{
-		ID:          id,
-		Name:        name,
-		PlanID:      planID,
-		RequireTOTP: false,
-		CreatedAt:   now,
-	}, nil
+	return nil
 }
 
 // GetOrganizationByID retrieves an organization by its ID
@@ -67,9 +99,15 @@ func (db *DB) GetOrganizationByID(id string) (*Organization, error) {
 	var planID sql.NullString
 
 	err := db.conn.QueryRow(`
-		SELECT id, name, plan_id, COALESCE(require_totp, 0), created_at
+		SELECT id, name, plan_id, COALESCE(require_totp, 0), created_at, COALESCE(auth_frame_ancestors, ''),
+		       COALESCE(brand_logo_url, ''), COALESCE(brand_primary_color, ''), COALESCE(brand_product_name, ''),
+		       COALESCE(session_cookie_domain, ''), COALESCE(session_cookie_same_site, ''), COALESCE(session_sso, FALSE),
+		       COALESCE(login_session_max, 0), COALESCE(login_session_on_exceed, '')
 		FROM organizations WHERE id = ?
-	`, id).Scan(&org.ID, &org.Name, &planID, &org.RequireTOTP, &org.CreatedAt)
+	`, id).Scan(&org.ID, &org.Name, &planID, &org.RequireTOTP, &org.CreatedAt, &org.AuthFrameAncestors,
+		&org.Branding.LogoURL, &org.Branding.PrimaryColor, &org.Branding.ProductName,
+		&org.SessionCookie.Domain, &org.SessionCookie.SameSite, &org.SessionCookie.SSO,
+		&org.LoginSessionLimit.Max, &org.LoginSessionLimit.OnExceed)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -91,9 +129,15 @@ func (db *DB) GetOrganizationByName(name string) (*Organization, error) {
 	var planID sql.NullString
 
 	err := db.conn.QueryRow(`
-		SELECT id, name, plan_id, COALESCE(require_totp, 0), created_at
+		SELECT id, name, plan_id, COALESCE(require_totp, 0), created_at, COALESCE(auth_frame_ancestors, ''),
+		       COALESCE(brand_logo_url, ''), COALESCE(brand_primary_color, ''), COALESCE(brand_product_name, ''),
+		       COALESCE(session_cookie_domain, ''), COALESCE(session_cookie_same_site, ''), COALESCE(session_sso, FALSE),
+		       COALESCE(login_session_max, 0), COALESCE(login_session_on_exceed, '')
 		FROM organizations WHERE name = ?
-	`, name).Scan(&org.ID, &org.Name, &planID, &org.RequireTOTP, &org.CreatedAt)
+	`, name).Scan(&org.ID, &org.Name, &planID, &org.RequireTOTP, &org.CreatedAt, &org.AuthFrameAncestors,
+		&org.Branding.LogoURL, &org.Branding.PrimaryColor, &org.Branding.ProductName,
+		&org.SessionCookie.Domain, &org.SessionCookie.SameSite, &org.SessionCookie.SSO,
+		&org.LoginSessionLimit.Max, &org.LoginSessionLimit.OnExceed)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -112,7 +156,10 @@ func (db *DB) GetOrganizationByName(name string) (*Organization, error) {
 // ListOrganizations returns all organizations
 func (db *DB) ListOrganizations() ([]*Organization, error) {
 	rows, err := db.conn.Query(`
-		SELECT id, name, plan_id, COALESCE(require_totp, 0), created_at
+		SELECT id, name, plan_id, COALESCE(require_totp, 0), created_at, COALESCE(auth_frame_ancestors, ''),
+		       COALESCE(brand_logo_url, ''), COALESCE(brand_primary_color, ''), COALESCE(brand_product_name, ''),
+		       COALESCE(session_cookie_domain, ''), COALESCE(session_cookie_same_site, ''), COALESCE(session_sso, FALSE),
+		       COALESCE(login_session_max, 0), COALESCE(login_session_on_exceed, '')
 		FROM organizations ORDER BY created_at DESC
 	`)
 	if err != nil {
@@ -124,7 +171,10 @@ func (db *DB) ListOrganizations() ([]*Organization, error) {
 	for rows.Next() {
 		org := &Organization{}
 		var planID sql.NullString
-		err := rows.Scan(&org.ID, &org.Name, &planID, &org.RequireTOTP, &org.CreatedAt)
+		err := rows.Scan(&org.ID, &org.Name, &planID, &org.RequireTOTP, &org.CreatedAt, &org.AuthFrameAncestors,
+			&org.Branding.LogoURL, &org.Branding.PrimaryColor, &org.Branding.ProductName,
+			&org.SessionCookie.Domain, &org.SessionCookie.SameSite, &org.SessionCookie.SSO,
+			&org.LoginSessionLimit.Max, &org.LoginSessionLimit.OnExceed)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan organization: %w", err)
 		}
@@ -145,6 +195,19 @@ func (db *DB) UpdateOrganization(id, name string) error {
 	return err
 }
 
+// OrganizationNameTaken reports whether an organization other than exceptID has
+// the name, ignoring ASCII case
+func (db *DB) OrganizationNameTaken(name, exceptID string) (bool, error) {
+	var n int
+	err := db.conn.QueryRow(`
+		SELECT COUNT(*) FROM organizations WHERE name = ? COLLATE NOCASE AND id != ?
+	`, name, exceptID).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to check organization name: %w", err)
+	}
+	return n > 0, nil
+}
+
 // UpdateOrganizationTOTPRequirement updates the TOTP requirement for an organization
 func (db *DB) UpdateOrganizationTOTPRequirement(id string, requireTOTP bool) error {
 	_, err := db.conn.Exec(`
@@ -153,6 +216,43 @@ func (db *DB) UpdateOrganizationTOTPRequirement(id string, requireTOTP bool) err
 	return err
 }
 
+// UpdateOrganizationAuthFrameAncestors sets which origins may embed the organization's login pages
+func (db *DB) UpdateOrganizationAuthFrameAncestors(id, frameAncestors string) error {
+	_, err := db.conn.Exec(`
+		UPDATE organizations SET auth_frame_ancestors = ? WHERE id = ?
+	`, frameAncestors, id)
+	return err
+}
+
+// UpdateOrganizationBranding sets the logo, color and product name shown on the organization's pages
+func (db *DB) UpdateOrganizationBranding(id string, branding OrgBranding) error {
+	_, err := db.conn.Exec(`
+		UPDATE organizations SET brand_logo_url = ?, brand_primary_color = ?, brand_product_name = ? WHERE id = ?
+	`, branding.LogoURL, branding.PrimaryColor, branding.ProductName, id)
+	return err
+}
+
+// UpdateOrganizationSessionCookie sets the session cookie attributes of the organization's auth pages.
+// Turning SSO off ends the org-wide sessions, so they stop working on every subdomain at once.
+func (db *DB) UpdateOrganizationSessionCookie(id string, cookie OrgSessionCookie) error {
+	_, err := db.conn.Exec(`
+		UPDATE organizations SET session_cookie_domain = ?, session_cookie_same_site = ?, session_sso = ? WHERE id = ?
+	`, cookie.Domain, cookie.SameSite, cookie.SSO, id)
+	if err != nil || cookie.SSO {
+		return err
+	}
+	_, err = db.conn.Exec(`DELETE FROM auth_sessions WHERE org_id = ? AND org_wide = TRUE`, id)
+	return err
+}
+
+// UpdateOrganizationLoginSessionLimit sets how many concurrent logins each of the organization's members may have
+func (db *DB) UpdateOrganizationLoginSessionLimit(id string, limit OrgLoginSessionLimit) error {
+	_, err := db.conn.Exec(`
+		UPDATE organizations SET login_session_max = ?, login_session_on_exceed = ? WHERE id = ?
+	`, limit.Max, limit.OnExceed, id)
+	return err
+}
+
 // UpdateOrganizationPlan updates the plan for an organization
 func (db *DB) UpdateOrganizationPlan(id string, planID *string) error {
 	_, err := db.conn.Exec(`
@@ -161,10 +261,31 @@ func (db *DB) UpdateOrganizationPlan(id string, planID *string) error {
 	return err
 }
 
-// DeleteOrganization deletes an organization
+// DeleteOrganization deletes an organization in one transaction, together with its applications
+// (and everything that belongs to them), auth policy, whitelist, API keys, sessions and usage.
+// Member accounts are kept but unlinked from the organization.
 func (db *DB) DeleteOrganization(id string) error {
-	_, err := db.conn.Exec(`DELETE FROM organizations WHERE id = ?`, id)
-	return err
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := deleteApplicationsTx(tx, `org_id = ?`, id); err != nil {
+		return err
+	}
+	for _, table := range orgDependentTables {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE org_id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete from %s: %w", table, err)
+		}
+	}
+	if _, err := tx.Exec(`UPDATE accounts SET org_id = NULL, is_org_admin = FALSE WHERE org_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to unlink accounts: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM organizations WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete organization: %w", err)
+	}
+	return tx.Commit()
 }
 
 // GetOrganizationByAccountID retrieves the organization for a given account
@@ -173,11 +294,17 @@ func (db *DB) GetOrganizationByAccountID(accountID string) (*Organization, error
 	var planID sql.NullString
 
 	err := db.conn.QueryRow(`
-		SELECT o.id, o.name, o.plan_id, COALESCE(o.require_totp, 0), o.created_at
+		SELECT o.id, o.name, o.plan_id, COALESCE(o.require_totp, 0), o.created_at, COALESCE(o.auth_frame_ancestors, ''),
+		       COALESCE(o.brand_logo_url, ''), COALESCE(o.brand_primary_color, ''), COALESCE(o.brand_product_name, ''),
+		       COALESCE(o.session_cookie_domain, ''), COALESCE(o.session_cookie_same_site, ''), COALESCE(o.session_sso, FALSE),
+		       COALESCE(o.login_session_max, 0), COALESCE(o.login_session_on_exceed, '')
 		FROM organizations o
 		JOIN accounts a ON a.org_id = o.id
 		WHERE a.id = ?
-	`, accountID).Scan(&org.ID, &org.Name, &planID, &org.RequireTOTP, &org.CreatedAt)
+	`, accountID).Scan(&org.ID, &org.Name, &planID, &org.RequireTOTP, &org.CreatedAt, &org.AuthFrameAncestors,
+		&org.Branding.LogoURL, &org.Branding.PrimaryColor, &org.Branding.ProductName,
+		&org.SessionCookie.Domain, &org.SessionCookie.SameSite, &org.SessionCookie.SSO,
+		&org.LoginSessionLimit.Max, &org.LoginSessionLimit.OnExceed)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -207,6 +334,24 @@ func (db *DB) SetAccountOrganization(accountID, orgID string) error {
 	return err
 }
 
+// MoveAccountsToOrganization links accounts to an organization in one
+// transaction. Org admin status does not carry over to the new organization,
+// so it is cleared.
+func (db *DB) MoveAccountsToOrganization(accountIDs []string, orgID string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, id := range accountIDs {
+		if _, err := tx.Exec(`UPDATE accounts SET org_id = ?, is_org_admin = FALSE WHERE id = ?`, orgID, id); err != nil {
+			return fmt.Errorf("failed to move account: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
 // CountOrganizations returns the total number of organizations
 func (db *DB) CountOrganizations() (int, error) {
 	var count int
@@ -0,0 +1,160 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// appDependentTables are the tables holding rows that belong to a single application
+var appDependentTables = []string{
+	"app_auth_policies",
+	"app_whitelist",
+	"api_keys",
+	"app_rate_limit_config",
+	"app_analytics",
+	"app_path_stats",
+	"app_favicons",
+	"app_request_rules",
+	"auth_sessions",
+	"oidc_states",
+}
+
+// orgDependentTables are the tables holding rows that belong to an organization itself
+var orgDependentTables = []string{
+	"org_auth_policies",
+	"org_whitelist",
+	"api_keys",
+	"usage_snapshots",
+	"auth_sessions",
+	"oidc_states",
+	"org_feature_flags",
+}
+
+// deleteApplicationsTx removes the applications matching where (a condition on applications)
+// together with everything that belongs to them, and returns how many applications it deleted
+func deleteApplicationsTx(tx *sql.Tx, where string, args ...interface{}) (int64, error) {
+	for _, table := range appDependentTables {
+		query := fmt.Sprintf(`DELETE FROM %s WHERE app_id IN (SELECT id FROM applications WHERE %s)`, table, where)
+		if _, err := tx.Exec(query, args...); err != nil {
+			return 0, fmt.Errorf("failed to delete from %s: %w", table, err)
+		}
+	}
+	res, err := tx.Exec(`DELETE FROM applications WHERE `+where, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete applications: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// OrphanCounts reports rows whose organization, application, account or plan
+// no longer exists, per table
+type OrphanCounts map[string]int64
+
+// Total returns the number of orphaned rows across all tables
+func (c OrphanCounts) Total() int64 {
+	var total int64
+	for _, n := range c {
+		total += n
+	}
+	return total
+}
+
+// accountDependentTables are the tables holding rows that belong to a single account
+var accountDependentTables = []string{
+	"account_tokens",
+	"account_whitelist",
+	"login_sessions",
+}
+
+// orphanRepairs are the SET clauses of tables whose orphaned rows are kept with
+// the dangling reference cleared instead of deleted. Accounts of a deleted
+// organization stay active; an admin decides what happens to them.
+var orphanRepairs = map[string]string{
+	"accounts":      `org_id = NULL, is_org_admin = FALSE`,
+	"organizations": `plan_id = NULL`,
+}
+
+// orphanConditions returns the WHERE clause matching orphaned rows of each table
+func orphanConditions() map[string]string {
+	missingApp := `app_id IS NOT NULL AND app_id != '' AND app_id NOT IN (SELECT id FROM applications)`
+	missingOrg := `org_id IS NOT NULL AND org_id != '' AND org_id NOT IN (SELECT id FROM organizations)`
+
+	conditions := make(map[string]string)
+	for _, table := range appDependentTables {
+		conditions[table] = missingApp
+	}
+	for _, table := range orgDependentTables {
+		if cond, ok := conditions[table]; ok {
+			conditions[table] = "(" + cond + ") OR (" + missingOrg + ")"
+		} else {
+			conditions[table] = missingOrg
+		}
+	}
+	for _, table := range accountDependentTables {
+		conditions[table] = `account_id NOT IN (SELECT id FROM accounts)`
+	}
+	conditions["applications"] = `org_id NOT IN (SELECT id FROM organizations)`
+	conditions["accounts"] = missingOrg
+	conditions["organizations"] = `plan_id IS NOT NULL AND plan_id != '' AND plan_id NOT IN (SELECT id FROM plans)`
+	return conditions
+}
+
+// FindOrphans counts rows that reference a deleted organization, application, account or plan
+func (db *DB) FindOrphans() (OrphanCounts, error) {
+	counts := make(OrphanCounts)
+	for table, cond := range orphanConditions() {
+		var n int64
+		if err := db.conn.QueryRow(`SELECT COUNT(*) FROM ` + table + ` WHERE ` + cond).Scan(&n); err != nil {
+			return nil, fmt.Errorf("failed to count orphans in %s: %w", table, err)
+		}
+		if n > 0 {
+			counts[table] = n
+		}
+	}
+	return counts, nil
+}
+
+// PurgeOrphans deletes rows that reference a deleted organization, application or
+// account in one transaction, and clears the dangling reference of accounts and
+// organizations (see orphanRepairs). Applications of deleted organizations are
+// removed with everything that belongs to them. The counts are the rows changed.
+func (db *DB) PurgeOrphans() (OrphanCounts, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	counts := make(OrphanCounts)
+	conditions := orphanConditions()
+
+	// Orphaned applications go first so their dependents are caught below
+	apps, err := deleteApplicationsTx(tx, conditions["applications"])
+	if err != nil {
+		return nil, err
+	}
+	if apps > 0 {
+		counts["applications"] = apps
+	}
+	delete(conditions, "applications")
+
+	for table, cond := range conditions {
+		query := `DELETE FROM ` + table + ` WHERE ` + cond
+		if set, ok := orphanRepairs[table]; ok {
+			query = `UPDATE ` + table + ` SET ` + set + ` WHERE ` + cond
+		}
+		res, err := tx.Exec(query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to purge orphans in %s: %w", table, err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			counts[table] = n
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit orphan purge: %w", err)
+	}
+	return counts, nil
+}
@@ -0,0 +1,177 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestDeleteOrganizationCascades(t *testing.T) {
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	member, err := database.CreateAccount("member", "token-hash", false)
+	if err != nil {
+		t.Fatalf("CreateAccount() error: %v", err)
+	}
+	if err := database.SetAccountOrganization(member.ID, org.ID); err != nil {
+		t.Fatalf("SetAccountOrganization() error: %v", err)
+	}
+	if _, err := database.AddOrgWhitelist(org.ID, "10.0.0.0/8", "office", ""); err != nil {
+		t.Fatalf("AddOrgWhitelist() error: %v", err)
+	}
+	_, orgKey, _ := GenerateAPIKey(&org.ID, nil, "org key", nil)
+	if err := database.CreateAPIKey(orgKey); err != nil {
+		t.Fatalf("CreateAPIKey() error: %v", err)
+	}
+
+	for _, subdomain := range []string{"web", "api"} {
+		app, err := database.CreateApplication(org.ID, subdomain, subdomain)
+		if err != nil {
+			t.Fatalf("CreateApplication() error: %v", err)
+		}
+		if _, err := database.AddAppWhitelist(app.ID, "192.168.0.0/16", "lan", ""); err != nil {
+			t.Fatalf("AddAppWhitelist() error: %v", err)
+		}
+		_, appKey, _ := GenerateAppAPIKey(org.ID, app.ID, "app key", nil)
+		if err := database.CreateAPIKey(appKey); err != nil {
+			t.Fatalf("CreateAPIKey() error: %v", err)
+		}
+		if err := database.CreateAppAuthPolicy(&AppAuthPolicy{AppID: app.ID, AuthType: AuthTypeAPIKey}); err != nil {
+			t.Fatalf("CreateAppAuthPolicy() error: %v", err)
+		}
+	}
+
+	if err := database.DeleteOrganization(org.ID); err != nil {
+		t.Fatalf("DeleteOrganization() error: %v", err)
+	}
+
+	for _, table := range []string{"organizations", "applications", "org_whitelist", "app_whitelist", "api_keys", "app_auth_policies"} {
+		var n int
+		if err := database.Conn().QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&n); err != nil {
+			t.Fatalf("count %s: %v", table, err)
+		}
+		if n != 0 {
+			t.Errorf("%s has %d rows after deleting the organization, want 0", table, n)
+		}
+	}
+	account, err := database.GetAccountByID(member.ID)
+	if err != nil || account == nil {
+		t.Fatalf("member account was deleted: %v", err)
+	}
+	if account.OrgID != "" {
+		t.Errorf("member OrgID = %q, want unlinked", account.OrgID)
+	}
+
+	// Rows orphaned before cascading deletes existed are found and purged
+	ctx := context.Background()
+	conn, err := database.Conn().Conn(ctx)
+	if err != nil {
+		t.Fatalf("Conn() error: %v", err)
+	}
+	conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF`)
+	if _, err := conn.ExecContext(ctx, `INSERT INTO app_whitelist (id, app_id, ip_range) VALUES ('wl', 'gone-app', '10.0.0.1/32')`); err != nil {
+		t.Fatalf("insert orphan: %v", err)
+	}
+	if _, err := conn.ExecContext(ctx, `INSERT INTO api_keys (id, org_id, key_hash, key_prefix) VALUES ('key', 'gone-org', 'hash', 'prefix')`); err != nil {
+		t.Fatalf("insert orphan: %v", err)
+	}
+	conn.ExecContext(ctx, `PRAGMA foreign_keys = ON`)
+	conn.Close()
+
+	orphans, err := database.FindOrphans()
+	if err != nil {
+		t.Fatalf("FindOrphans() error: %v", err)
+	}
+	if orphans["app_whitelist"] != 1 || orphans["api_keys"] != 1 || orphans.Total() != 2 {
+		t.Errorf("FindOrphans() = %v, want one app_whitelist and one api_keys row", orphans)
+	}
+	purged, err := database.PurgeOrphans()
+	if err != nil {
+		t.Fatalf("PurgeOrphans() error: %v", err)
+	}
+	if purged.Total() != 2 {
+		t.Errorf("PurgeOrphans() = %v, want 2 rows", purged)
+	}
+	if orphans, _ := database.FindOrphans(); orphans.Total() != 0 {
+		t.Errorf("orphans left after purge: %v", orphans)
+	}
+}
+
+func TestOrphanReferences(t *testing.T) {
+	database := newTestDB(t)
+
+	org, _ := database.CreateOrganization("acme")
+	member, err := database.CreateOrgAccount("bob", "token-hash", "", org.ID)
+	if err != nil {
+		t.Fatalf("CreateOrgAccount() error: %v", err)
+	}
+	healthy, _ := database.CreateApplication(org.ID, "healthy", "Healthy")
+
+	// References left dangling by deletes from before foreign keys were enforced
+	ctx := context.Background()
+	conn, err := database.Conn().Conn(ctx)
+	if err != nil {
+		t.Fatalf("Conn() error: %v", err)
+	}
+	conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF`)
+	for _, stmt := range []string{
+		`INSERT INTO applications (id, org_id, subdomain, name) VALUES ('stray-app', 'gone-org', 'stray', 'Stray')`,
+		`INSERT INTO app_whitelist (id, app_id, ip_range) VALUES ('wl', 'stray-app', '10.0.0.1/32')`,
+		`INSERT INTO account_tokens (id, account_id, name, token_hash) VALUES ('tok', 'gone-account', 'laptop', 'hash')`,
+		`INSERT INTO account_whitelist (id, account_id, ip_range) VALUES ('awl', 'gone-account', '10.0.0.2/32')`,
+		`UPDATE organizations SET plan_id = 'gone-plan' WHERE id = '` + org.ID + `'`,
+		`UPDATE accounts SET org_id = 'gone-org' WHERE id = '` + member.ID + `'`,
+	} {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	conn.ExecContext(ctx, `PRAGMA foreign_keys = ON`)
+	conn.Close()
+
+	want := OrphanCounts{
+		"applications":      1,
+		"account_tokens":    1,
+		"account_whitelist": 1,
+		"organizations":     1,
+		"accounts":          1,
+	}
+	orphans, err := database.FindOrphans()
+	if err != nil {
+		t.Fatalf("FindOrphans() error: %v", err)
+	}
+	if !reflect.DeepEqual(orphans, want) {
+		t.Errorf("FindOrphans() = %v, want %v", orphans, want)
+	}
+
+	purged, err := database.PurgeOrphans()
+	if err != nil {
+		t.Fatalf("PurgeOrphans() error: %v", err)
+	}
+	if !reflect.DeepEqual(purged, want) {
+		t.Errorf("PurgeOrphans() = %v, want %v", purged, want)
+	}
+	// The stray application's whitelist entry goes with it
+	var entries int
+	database.Conn().QueryRow(`SELECT COUNT(*) FROM app_whitelist WHERE id = 'wl'`).Scan(&entries)
+	if entries != 0 {
+		t.Error("whitelist entry of the deleted application was kept")
+	}
+	if orphans, _ := database.FindOrphans(); orphans.Total() != 0 {
+		t.Errorf("orphans left after purge: %v", orphans)
+	}
+
+	if app, _ := database.GetApplicationByID(healthy.ID); app == nil {
+		t.Error("healthy application was deleted")
+	}
+	if account, _ := database.GetAccountByID(member.ID); account == nil || account.OrgID != "" || !account.Active {
+		t.Errorf("member = %+v, want unlinked and still active", account)
+	}
+	if stored, _ := database.GetOrganizationByID(org.ID); stored.PlanID != nil {
+		t.Errorf("PlanID = %v, want cleared", *stored.PlanID)
+	}
+}
@@ -18,6 +18,10 @@ type Plan struct {
 	RequestsMonthly       *int64    `json:"requestsMonthly,omitempty"`
 	OverageAllowedPercent int       `json:"overageAllowedPercent"`
 	GracePeriodHours      int       `json:"gracePeriodHours"`
+	MaxBytesPerSecond     *int64    `json:"maxBytesPerSecond,omitempty"`     // Per-tunnel throughput cap
+	MaxForwards           *int      `json:"maxForwards,omitempty"`           // Forwards (subdomains) per client connection
+	MaxConcurrentRequests *int      `json:"maxConcurrentRequests,omitempty"` // Forwarded requests in flight across the organization
+	ReleaseInactiveDays   *int      `json:"releaseInactiveDays,omitempty"`   // Release the subdomains of applications offline this long
 	CreatedAt             time.Time `json:"createdAt"`
 	UpdatedAt             time.Time `json:"updatedAt"`
 }
@@ -31,6 +35,10 @@ type CreatePlanInput struct {
 	RequestsMonthly       *int64 `json:"requestsMonthly,omitempty"`
 	OverageAllowedPercent int    `json:"overageAllowedPercent"`
 	GracePeriodHours      int    `json:"gracePeriodHours"`
+	MaxBytesPerSecond     *int64 `json:"maxBytesPerSecond,omitempty"`
+	MaxForwards           *int   `json:"maxForwards,omitempty"`
+	MaxConcurrentRequests *int   `json:"maxConcurrentRequests,omitempty"`
+	ReleaseInactiveDays   *int   `json:"releaseInactiveDays,omitempty"`
 }
 
 // CreatePlan creates a new plan
@@ -42,11 +50,13 @@ func (db *DB) CreatePlan(input CreatePlanInput) (*Plan, error) {
 		INSERT INTO plans (
 			id, name, bandwidth_bytes_monthly, tunnel_hours_monthly,
 			concurrent_tunnels_max, requests_monthly, overage_allowed_percent,
-			grace_period_hours, created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			grace_period_hours, max_bytes_per_second, max_forwards, max_concurrent_requests,
+			release_inactive_days, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`, id, input.Name, input.BandwidthBytesMonthly, input.TunnelHoursMonthly,
 		input.ConcurrentTunnelsMax, input.RequestsMonthly, input.OverageAllowedPercent,
-		input.GracePeriodHours, now, now)
+		input.GracePeriodHours, input.MaxBytesPerSecond, input.MaxForwards, input.MaxConcurrentRequests,
+		input.ReleaseInactiveDays, now, now)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create plan: %w", err)
 	}
@@ -60,6 +70,10 @@ func (db *DB) CreatePlan(input CreatePlanInput) (*Plan, error) {
 		RequestsMonthly:       input.RequestsMonthly,
 		OverageAllowedPercent: input.OverageAllowedPercent,
 		GracePeriodHours:      input.GracePeriodHours,
+		MaxBytesPerSecond:     input.MaxBytesPerSecond,
+		MaxForwards:           input.MaxForwards,
+		MaxConcurrentRequests: input.MaxConcurrentRequests,
+		ReleaseInactiveDays:   input.ReleaseInactiveDays,
 		CreatedAt:             now,
 		UpdatedAt:             now,
 	}, nil
@@ -68,18 +82,20 @@ func (db *DB) CreatePlan(input CreatePlanInput) (*Plan, error) {
 // GetPlan retrieves a plan by ID
 func (db *DB) GetPlan(id string) (*Plan, error) {
 	plan := &Plan{}
-	var bandwidthBytes, tunnelHours, requests sql.NullInt64
-	var concurrentTunnels sql.NullInt32
+	var bandwidthBytes, tunnelHours, requests, maxBytesPerSecond sql.NullInt64
+	var concurrentTunnels, maxForwards, maxConcurrentRequests, releaseInactiveDays sql.NullInt32
 
 	err := db.conn.QueryRow(`
 		SELECT id, name, bandwidth_bytes_monthly, tunnel_hours_monthly,
 		       concurrent_tunnels_max, requests_monthly, overage_allowed_percent,
-		       grace_period_hours, created_at, updated_at
+		       grace_period_hours, max_bytes_per_second, max_forwards, max_concurrent_requests,
+		       release_inactive_days, created_at, updated_at
 		FROM plans WHERE id = ?
 	`, id).Scan(
 		&plan.ID, &plan.Name, &bandwidthBytes, &tunnelHours,
 		&concurrentTunnels, &requests, &plan.OverageAllowedPercent,
-		&plan.GracePeriodHours, &plan.CreatedAt, &plan.UpdatedAt,
+		&plan.GracePeriodHours, &maxBytesPerSecond, &maxForwards, &maxConcurrentRequests,
+		&releaseInactiveDays, &plan.CreatedAt, &plan.UpdatedAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -102,25 +118,55 @@ func (db *DB) GetPlan(id string) (*Plan, error) {
 	if requests.Valid {
 		plan.RequestsMonthly = &requests.Int64
 	}
+	if maxBytesPerSecond.Valid {
+		plan.MaxBytesPerSecond = &maxBytesPerSecond.Int64
+	}
+	if maxForwards.Valid {
+		v := int(maxForwards.Int32)
+		plan.MaxForwards = &v
+	}
+	if maxConcurrentRequests.Valid {
+		v := int(maxConcurrentRequests.Int32)
+		plan.MaxConcurrentRequests = &v
+	}
+	if releaseInactiveDays.Valid {
+		v := int(releaseInactiveDays.Int32)
+		plan.ReleaseInactiveDays = &v
+	}
 
 	return plan, nil
 }
 
+// PlanNameTaken reports whether a plan other than exceptID has the name,
+// ignoring ASCII case
+func (db *DB) PlanNameTaken(name, exceptID string) (bool, error) {
+	var n int
+	err := db.conn.QueryRow(`
+		SELECT COUNT(*) FROM plans WHERE name = ? COLLATE NOCASE AND id != ?
+	`, name, exceptID).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to check plan name: %w", err)
+	}
+	return n > 0, nil
+}
+
 // GetPlanByName retrieves a plan by name
 func (db *DB) GetPlanByName(name string) (*Plan, error) {
 	plan := &Plan{}
-	var bandwidthBytes, tunnelHours, requests sql.NullInt64
-	var concurrentTunnels sql.NullInt32
+	var bandwidthBytes, tunnelHours, requests, maxBytesPerSecond sql.NullInt64
+	var concurrentTunnels, maxForwards, maxConcurrentRequests, releaseInactiveDays sql.NullInt32
 
 	err := db.conn.QueryRow(`
 		SELECT id, name, bandwidth_bytes_monthly, tunnel_hours_monthly,
 		       concurrent_tunnels_max, requests_monthly, overage_allowed_percent,
-		       grace_period_hours, created_at, updated_at
+		       grace_period_hours, max_bytes_per_second, max_forwards, max_concurrent_requests,
+		       release_inactive_days, created_at, updated_at
 		FROM plans WHERE name = ?
 	`, name).Scan(
 		&plan.ID, &plan.Name, &bandwidthBytes, &tunnelHours,
 		&concurrentTunnels, &requests, &plan.OverageAllowedPercent,
-		&plan.GracePeriodHours, &plan.CreatedAt, &plan.UpdatedAt,
+		&plan.GracePeriodHours, &maxBytesPerSecond, &maxForwards, &maxConcurrentRequests,
+		&releaseInactiveDays, &plan.CreatedAt, &plan.UpdatedAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -143,6 +189,21 @@ func (db *DB) GetPlanByName(name string) (*Plan, error) {
 	if requests.Valid {
 		plan.RequestsMonthly = &requests.Int64
 	}
+	if maxBytesPerSecond.Valid {
+		plan.MaxBytesPerSecond = &maxBytesPerSecond.Int64
+	}
+	if maxForwards.Valid {
+		v := int(maxForwards.Int32)
+		plan.MaxForwards = &v
+	}
+	if maxConcurrentRequests.Valid {
+		v := int(maxConcurrentRequests.Int32)
+		plan.MaxConcurrentRequests = &v
+	}
+	if releaseInactiveDays.Valid {
+		v := int(releaseInactiveDays.Int32)
+		plan.ReleaseInactiveDays = &v
+	}
 
 	return plan, nil
 }
@@ -152,7 +213,8 @@ func (db *DB) ListPlans() ([]*Plan, error) {
 	rows, err := db.conn.Query(`
 		SELECT id, name, bandwidth_bytes_monthly, tunnel_hours_monthly,
 		       concurrent_tunnels_max, requests_monthly, overage_allowed_percent,
-		       grace_period_hours, created_at, updated_at
+		       grace_period_hours, max_bytes_per_second, max_forwards, max_concurrent_requests,
+		       release_inactive_days, created_at, updated_at
 		FROM plans ORDER BY name
 	`)
 	if err != nil {
@@ -163,13 +225,14 @@ func (db *DB) ListPlans() ([]*Plan, error) {
 	var plans []*Plan
 	for rows.Next() {
 		plan := &Plan{}
-		var bandwidthBytes, tunnelHours, requests sql.NullInt64
-		var concurrentTunnels sql.NullInt32
+		var bandwidthBytes, tunnelHours, requests, maxBytesPerSecond sql.NullInt64
+		var concurrentTunnels, maxForwards, maxConcurrentRequests, releaseInactiveDays sql.NullInt32
 
 		err := rows.Scan(
 			&plan.ID, &plan.Name, &bandwidthBytes, &tunnelHours,
 			&concurrentTunnels, &requests, &plan.OverageAllowedPercent,
-			&plan.GracePeriodHours, &plan.CreatedAt, &plan.UpdatedAt,
+			&plan.GracePeriodHours, &maxBytesPerSecond, &maxForwards, &maxConcurrentRequests,
+			&releaseInactiveDays, &plan.CreatedAt, &plan.UpdatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan plan: %w", err)
@@ -188,6 +251,21 @@ func (db *DB) ListPlans() ([]*Plan, error) {
 		if requests.Valid {
 			plan.RequestsMonthly = &requests.Int64
 		}
+		if maxBytesPerSecond.Valid {
+			plan.MaxBytesPerSecond = &maxBytesPerSecond.Int64
+		}
+		if maxForwards.Valid {
+			v := int(maxForwards.Int32)
+			plan.MaxForwards = &v
+		}
+		if maxConcurrentRequests.Valid {
+			v := int(maxConcurrentRequests.Int32)
+			plan.MaxConcurrentRequests = &v
+		}
+		if releaseInactiveDays.Valid {
+			v := int(releaseInactiveDays.Int32)
+			plan.ReleaseInactiveDays = &v
+		}
 
 		plans = append(plans, plan)
 	}
@@ -208,11 +286,16 @@ func (db *DB) UpdatePlan(id string, input CreatePlanInput) (*Plan, error) {
 			requests_monthly = ?,
 			overage_allowed_percent = ?,
 			grace_period_hours = ?,
+			max_bytes_per_second = ?,
+			max_forwards = ?,
+			max_concurrent_requests = ?,
+			release_inactive_days = ?,
 			updated_at = ?
 		WHERE id = ?
 	`, input.Name, input.BandwidthBytesMonthly, input.TunnelHoursMonthly,
 		input.ConcurrentTunnelsMax, input.RequestsMonthly, input.OverageAllowedPercent,
-		input.GracePeriodHours, now, id)
+		input.GracePeriodHours, input.MaxBytesPerSecond, input.MaxForwards, input.MaxConcurrentRequests,
+		input.ReleaseInactiveDays, now, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update plan: %w", err)
 	}
@@ -256,7 +339,10 @@ func (db *DB) CountPlans() (int, error) {
 // GetOrganizationsUsingPlan returns all organizations using a specific plan
 func (db *DB) GetOrganizationsUsingPlan(planID string) ([]*Organization, error) {
 	rows, err := db.conn.Query(`
-		SELECT id, name, plan_id, COALESCE(require_totp, 0), created_at
+		SELECT id, name, plan_id, COALESCE(require_totp, 0), created_at, COALESCE(auth_frame_ancestors, ''),
+		       COALESCE(brand_logo_url, ''), COALESCE(brand_primary_color, ''), COALESCE(brand_product_name, ''),
+		       COALESCE(session_cookie_domain, ''), COALESCE(session_cookie_same_site, ''), COALESCE(session_sso, FALSE),
+		       COALESCE(login_session_max, 0), COALESCE(login_session_on_exceed, '')
 		FROM organizations WHERE plan_id = ?
 		ORDER BY name
 	`, planID)
@@ -269,7 +355,10 @@ func (db *DB) GetOrganizationsUsingPlan(planID string) ([]*Organization, error)
 	for rows.Next() {
 		org := &Organization{}
 		var planID sql.NullString
-		err := rows.Scan(&org.ID, &org.Name, &planID, &org.RequireTOTP, &org.CreatedAt)
+		err := rows.Scan(&org.ID, &org.Name, &planID, &org.RequireTOTP, &org.CreatedAt, &org.AuthFrameAncestors,
+			&org.Branding.LogoURL, &org.Branding.PrimaryColor, &org.Branding.ProductName,
+			&org.SessionCookie.Domain, &org.SessionCookie.SameSite, &org.SessionCookie.SSO,
+			&org.LoginSessionLimit.Max, &org.LoginSessionLimit.OnExceed)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan organization: %w", err)
 		}
@@ -54,7 +54,13 @@ func (db *DB) GetAppRateLimitConfig(appID string) (*AppRateLimitConfig, error) {
 
 // SetAppRateLimitConfig creates or updates the rate limit configuration for an application
 func (db *DB) SetAppRateLimitConfig(config *AppRateLimitConfig) error {
-	_, err := db.conn.Exec(`
+	return upsertAppRateLimitConfig(db.conn, config)
+}
+
+// upsertAppRateLimitConfig stores an application's rate limit configuration,
+// replacing the current one
+func upsertAppRateLimitConfig(conn sqlExecer, config *AppRateLimitConfig) error {
+	_, err := conn.Exec(`
 		INSERT INTO app_rate_limit_config (app_id, enabled, max_attempts, window_duration_seconds, block_duration_seconds, updated_at)
 		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
 		ON CONFLICT(app_id) DO UPDATE SET
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Request rule types. A request matching any enabled rule of its application
+// is blocked before it is forwarded.
+const (
+	RequestRulePath      = "path"       // Value is a regular expression matched against the URL path
+	RequestRuleHeader    = "header"     // Value is a header name; requests carrying the header match
+	RequestRuleMethod    = "method"     // Value is an HTTP method
+	RequestRuleBodySize  = "body_size"  // Value is the largest allowed request body in bytes
+	RequestRuleUserAgent = "user_agent" // Value is a regular expression matched against the User-Agent, or "" for known scanners
+)
+
+// RequestRule is a rule blocking matching requests to an application
+type RequestRule struct {
+	ID          string    `json:"id"`
+	AppID       string    `json:"appId"`
+	Type        string    `json:"type"`
+	Value       string    `json:"value"`
+	Description string    `json:"description,omitempty"`
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// ListAppRequestRules returns an application's request rules, oldest first
+func (db *DB) ListAppRequestRules(appID string) ([]*RequestRule, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, app_id, rule_type, value, description, enabled, created_at
+		FROM app_request_rules WHERE app_id = ? ORDER BY created_at, id
+	`, appID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list request rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []*RequestRule
+	for rows.Next() {
+		rule := &RequestRule{}
+		if err := rows.Scan(&rule.ID, &rule.AppID, &rule.Type, &rule.Value, &rule.Description, &rule.Enabled, &rule.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan request rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// GetAppRequestRule retrieves one of an application's request rules (nil if it has no such rule)
+func (db *DB) GetAppRequestRule(appID, id string) (*RequestRule, error) {
+	rule := &RequestRule{}
+	err := db.conn.QueryRow(`
+		SELECT id, app_id, rule_type, value, description, enabled, created_at
+		FROM app_request_rules WHERE id = ? AND app_id = ?
+	`, id, appID).Scan(&rule.ID, &rule.AppID, &rule.Type, &rule.Value, &rule.Description, &rule.Enabled, &rule.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get request rule: %w", err)
+	}
+	return rule, nil
+}
+
+// CountAppRequestRules returns the number of request rules of an application
+func (db *DB) CountAppRequestRules(appID string) (int, error) {
+	var count int
+	err := db.conn.QueryRow(`SELECT COUNT(*) FROM app_request_rules WHERE app_id = ?`, appID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count request rules: %w", err)
+	}
+	return count, nil
+}
+
+// CreateAppRequestRule adds a request rule to an application, filling in its ID and creation time
+func (db *DB) CreateAppRequestRule(rule *RequestRule) error {
+	rule.ID = uuid.New().String()
+	rule.CreatedAt = time.Now()
+	_, err := db.conn.Exec(`
+		INSERT INTO app_request_rules (id, app_id, rule_type, value, description, enabled, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, rule.ID, rule.AppID, rule.Type, rule.Value, rule.Description, rule.Enabled, rule.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create request rule: %w", err)
+	}
+	return nil
+}
+
+// UpdateAppRequestRule replaces the type, value, description and enabled state of a request rule
+func (db *DB) UpdateAppRequestRule(rule *RequestRule) error {
+	_, err := db.conn.Exec(`
+		UPDATE app_request_rules SET rule_type = ?, value = ?, description = ?, enabled = ?
+		WHERE id = ? AND app_id = ?
+	`, rule.Type, rule.Value, rule.Description, rule.Enabled, rule.ID, rule.AppID)
+	if err != nil {
+		return fmt.Errorf("failed to update request rule: %w", err)
+	}
+	return nil
+}
+
+// DeleteAppRequestRule removes one of an application's request rules. It
+// reports false when the application has no such rule.
+func (db *DB) DeleteAppRequestRule(appID, id string) (bool, error) {
+	result, err := db.conn.Exec(`DELETE FROM app_request_rules WHERE id = ? AND app_id = ?`, id, appID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete request rule: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete request rule: %w", err)
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// RetryConfig controls how writes wait out a locked database
+type RetryConfig struct {
+	// BusyTimeout is how long SQLite itself waits for a lock before a statement
+	// fails with SQLITE_BUSY
+	BusyTimeout time.Duration
+
+	// Retries is how many times a write that failed with SQLITE_BUSY or
+	// SQLITE_LOCKED is run again (0 disables retries)
+	Retries int
+
+	// Backoff is the wait before the first retry, doubled for each further retry
+	Backoff time.Duration
+}
+
+// DefaultRetryConfig returns the retry settings used when none are configured
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		BusyTimeout: 5 * time.Second,
+		Retries:     3,
+		Backoff:     50 * time.Millisecond,
+	}
+}
+
+// GetRetryConfig returns the retry settings from environment or defaults:
+// DB_BUSY_TIMEOUT_MS, DB_BUSY_RETRIES and DB_BUSY_BACKOFF_MS
+func GetRetryConfig() RetryConfig {
+	cfg := DefaultRetryConfig()
+	if ms, ok := getNonNegativeEnv("DB_BUSY_TIMEOUT_MS"); ok {
+		cfg.BusyTimeout = time.Duration(ms) * time.Millisecond
+	}
+	if retries, ok := getNonNegativeEnv("DB_BUSY_RETRIES"); ok {
+		cfg.Retries = retries
+	}
+	if ms, ok := getNonNegativeEnv("DB_BUSY_BACKOFF_MS"); ok {
+		cfg.Backoff = time.Duration(ms) * time.Millisecond
+	}
+	return cfg
+}
+
+// getNonNegativeEnv reads a non-negative integer environment variable
+func getNonNegativeEnv(name string) (int, bool) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Printf("WARNING: invalid %s %q, using default", name, value)
+		return 0, false
+	}
+	return n, true
+}
+
+// isBusy reports whether err means another connection holds the lock
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return false
+}
+
+// retryConn is the database connection with standalone writes retried while the
+// database is locked. Statements inside a transaction are not retried: only
+// the whole transaction could safely be run again. Query and QueryRow are not
+// retried either: in WAL mode readers don't wait for writers, so a read only
+// waits out the busy timeout. A write that returns rows goes through QueryRowScan.
+type retryConn struct {
+	*sql.DB
+	retry RetryConfig
+}
+
+// Exec runs a statement, retrying with bounded backoff while the database is locked
+func (c *retryConn) Exec(query string, args ...any) (sql.Result, error) {
+	result, err := c.DB.Exec(query, args...)
+	backoff := c.retry.Backoff
+	for attempt := 0; attempt < c.retry.Retries && isBusy(err); attempt++ {
+		time.Sleep(backoff)
+		backoff *= 2
+		result, err = c.DB.Exec(query, args...)
+	}
+	return result, err
+}
+
+// QueryRowScan runs a statement returning at most one row, such as a DELETE with
+// RETURNING, and scans it into dest. Unlike QueryRow, whose error only surfaces
+// on Scan, it retries with bounded backoff while the database is locked.
+func (c *retryConn) QueryRowScan(query string, args []any, dest ...any) error {
+	err := c.DB.QueryRow(query, args...).Scan(dest...)
+	backoff := c.retry.Backoff
+	for attempt := 0; attempt < c.retry.Retries && isBusy(err); attempt++ {
+		time.Sleep(backoff)
+		backoff *= 2
+		err = c.DB.QueryRow(query, args...).Scan(dest...)
+	}
+	return err
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDBBusyRetry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	open := func(retries int) *DB {
+		database, err := NewWithRetry(path, RetryConfig{BusyTimeout: time.Millisecond, Retries: retries, Backoff: 20 * time.Millisecond})
+		if err != nil {
+			t.Fatalf("NewWithRetry() error: %v", err)
+		}
+		t.Cleanup(func() { database.Close() })
+		return database
+	}
+	retrying, failing := open(5), open(0)
+
+	// A second connection holds the write lock, as another writer would
+	locker, err := sql.Open("sqlite3", path+"?_txlock=immediate")
+	if err != nil {
+		t.Fatalf("sql.Open() error: %v", err)
+	}
+	defer locker.Close()
+	hold := func() *sql.Tx {
+		tx, err := locker.Begin()
+		if err != nil {
+			t.Fatalf("Begin() error: %v", err)
+		}
+		return tx
+	}
+
+	tx := hold()
+	if _, err := failing.CreateOrganization("no-retry"); err == nil || !strings.Contains(err.Error(), "locked") {
+		t.Errorf("CreateOrganization() without retries = %v, want database is locked", err)
+	}
+	tx.Rollback()
+
+	tx = hold()
+	time.AfterFunc(100*time.Millisecond, func() { tx.Rollback() })
+	if _, err := retrying.CreateOrganization("retried"); err != nil {
+		t.Errorf("CreateOrganization() with retries error: %v, want it to wait out the lock", err)
+	}
+
+	// Writes returning rows are retried too
+	tx = hold()
+	if _, err := failing.ValidateOIDCState("state"); err == nil || !strings.Contains(err.Error(), "locked") {
+		t.Errorf("ValidateOIDCState() without retries = %v, want database is locked", err)
+	}
+	tx.Rollback()
+
+	tx = hold()
+	time.AfterFunc(100*time.Millisecond, func() { tx.Rollback() })
+	if _, err := retrying.ValidateOIDCState("state"); err != nil {
+		t.Errorf("ValidateOIDCState() with retries error: %v, want it to wait out the lock", err)
+	}
+}
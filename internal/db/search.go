@@ -0,0 +1,110 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Search result types
+const (
+	SearchTypeAccount      = "account"
+	SearchTypeOrganization = "organization"
+	SearchTypeApplication  = "application"
+	SearchTypeAPIKey       = "api_key"
+)
+
+// SearchResult is a single match from a cross-resource search
+type SearchResult struct {
+	Type  string `json:"type"`
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	OrgID string `json:"orgId,omitempty"`
+}
+
+// SearchResults holds search matches grouped by resource category
+type SearchResults struct {
+	Accounts      []SearchResult `json:"accounts"`
+	Organizations []SearchResult `json:"organizations"`
+	Applications  []SearchResult `json:"applications"`
+	APIKeys       []SearchResult `json:"apiKeys"`
+}
+
+// escapeLike escapes LIKE wildcards so user input matches literally (used with ESCAPE '\')
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
+
+// Search finds accounts by username, organizations by name, applications by
+// subdomain or name, and API keys by prefix, ignoring case. Values are matched
+// from their start so each lookup is a range scan of a NOCASE index. Each
+// category returns at most limit results.
+func (db *DB) Search(query string, limit int) (*SearchResults, error) {
+	prefix := escapeLike(query) + "%"
+
+	results := &SearchResults{}
+	var err error
+
+	results.Accounts, err = db.searchQuery(SearchTypeAccount, `
+		SELECT id, username, org_id FROM accounts
+		WHERE username LIKE ? ESCAPE '\'
+		ORDER BY username COLLATE NOCASE LIMIT ?
+	`, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	results.Organizations, err = db.searchQuery(SearchTypeOrganization, `
+		SELECT id, name, NULL FROM organizations
+		WHERE name LIKE ? ESCAPE '\'
+		ORDER BY name COLLATE NOCASE LIMIT ?
+	`, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	results.Applications, err = db.searchQuery(SearchTypeApplication, `
+		SELECT id, subdomain, org_id FROM applications
+		WHERE subdomain LIKE ?1 ESCAPE '\' OR name LIKE ?1 ESCAPE '\'
+		ORDER BY subdomain LIMIT ?2
+	`, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	results.APIKeys, err = db.searchQuery(SearchTypeAPIKey, `
+		SELECT id, key_prefix, org_id FROM api_keys
+		WHERE key_prefix LIKE ? ESCAPE '\'
+		ORDER BY key_prefix COLLATE NOCASE LIMIT ?
+	`, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// searchQuery runs a search query selecting (id, label, org_id) and tags each row with the result type
+func (db *DB) searchQuery(resultType, query string, args ...interface{}) ([]SearchResult, error) {
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search %s: %w", resultType, err)
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		result := SearchResult{Type: resultType}
+		var orgID sql.NullString
+		if err := rows.Scan(&result.ID, &result.Label, &orgID); err != nil {
+			return nil, fmt.Errorf("failed to scan %s search result: %w", resultType, err)
+		}
+		if orgID.Valid {
+			result.OrgID = orgID.String
+		}
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEscapeLike(t *testing.T) {
+	for in, want := range map[string]string{
+		"acme":      "acme",
+		"100%":      `100\%`,
+		"my_app":    `my\_app`,
+		`back\`:     `back\\`,
+		`%_\`:       `\%\_\\`,
+		`a\%b`:      `a\\\%b`,
+		"":          "",
+		"über-café": "über-café",
+	} {
+		if got := escapeLike(in); got != want {
+			t.Errorf("escapeLike(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("Acme Corp")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	database.CreateOrganization("My Acme")
+	for _, subdomain := range []string{"acme-web", "acme_api", "acmexapi", "shop"} {
+		if _, err := database.CreateApplication(org.ID, subdomain, "App "+subdomain); err != nil {
+			t.Fatalf("CreateApplication() error: %v", err)
+		}
+	}
+	database.CreateApplication(org.ID, "store", "Acme Store")
+	database.CreateAccount("acme-admin", "hash-1", false)
+	database.CreateAccount("100%-admin", "hash-2", false)
+	database.CreateAPIKey(&APIKey{ID: "key-1", OrgID: &org.ID, KeyType: KeyTypeAccount, KeyHash: "h1", KeyPrefix: "dlk_Acme", CreatedAt: time.Now()})
+
+	labels := func(results []SearchResult) string {
+		var l []string
+		for _, r := range results {
+			l = append(l, r.Label)
+		}
+		return strings.Join(l, ",")
+	}
+
+	results, err := database.Search("ACME", 10)
+	if err != nil {
+		t.Fatalf("Search() error: %v", err)
+	}
+	// Prefixes match ignoring case; "My Acme" does not start with the query
+	if got := labels(results.Organizations); got != "Acme Corp" {
+		t.Errorf("organizations = %q, want Acme Corp", got)
+	}
+	if got := labels(results.Applications); got != "acme-web,acme_api,acmexapi,store" {
+		t.Errorf("applications = %q, want the acme subdomains and the app named Acme Store", got)
+	}
+	if got := labels(results.Accounts); got != "acme-admin" {
+		t.Errorf("accounts = %q, want acme-admin", got)
+	}
+	if results.Organizations[0].ID != org.ID || results.Applications[0].OrgID != org.ID {
+		t.Errorf("results = %+v, want IDs and org IDs", results)
+	}
+
+	// Wildcards in the query match literally
+	for query, want := range map[string]string{"acme_": "acme_api", "100%": "100%-admin", "%": "", "_": ""} {
+		results, err := database.Search(query, 10)
+		if err != nil {
+			t.Fatalf("Search(%q) error: %v", query, err)
+		}
+		got := labels(results.Applications) + labels(results.Accounts) + labels(results.Organizations)
+		if got != want {
+			t.Errorf("Search(%q) = %q, want %q", query, got, want)
+		}
+	}
+
+	if results, _ := database.Search("dlk_a", 10); labels(results.APIKeys) != "dlk_Acme" {
+		t.Errorf("API keys = %q, want dlk_Acme", labels(results.APIKeys))
+	}
+	if results, _ := database.Search("acme", 2); len(results.Applications) != 2 {
+		t.Errorf("applications with limit 2 = %d", len(results.Applications))
+	}
+}
+
+func TestSearchUsesIndexes(t *testing.T) {
+	database := newTestDB(t)
+
+	for _, query := range []string{
+		`SELECT id FROM accounts WHERE username LIKE ? ESCAPE '\'`,
+		`SELECT id FROM organizations WHERE name LIKE ? ESCAPE '\'`,
+		`SELECT id FROM applications WHERE subdomain LIKE ?1 ESCAPE '\' OR name LIKE ?1 ESCAPE '\'`,
+		`SELECT id FROM api_keys WHERE key_prefix LIKE ? ESCAPE '\'`,
+	} {
+		rows, err := database.conn.Query(`EXPLAIN QUERY PLAN `+query, "acme%")
+		if err != nil {
+			t.Fatalf("EXPLAIN %s: %v", query, err)
+		}
+		var plan []string
+		for rows.Next() {
+			var id, parent, unused int
+			var detail string
+			rows.Scan(&id, &parent, &unused, &detail)
+			plan = append(plan, detail)
+		}
+		rows.Close()
+		if joined := strings.Join(plan, "; "); strings.Contains(joined, "SCAN") || !strings.Contains(joined, "USING INDEX") {
+			t.Errorf("plan of %s = %q, want an index search", query, joined)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Server setting keys
+const (
+	SettingDefaultRateLimit  = "default_rate_limit"  // Default auth rate limit (RateLimitSettings)
+	SettingHostHeader        = "host_header"         // Host header of apps that don't choose one (HostHeaderConfig)
+	SettingFeatureFlags      = "feature_flags"       // Feature flags of orgs that don't override them (FeatureFlags)
+	SettingAPIKeyPurge       = "api_key_purge"       // Purge of expired API keys (APIKeyPurgeSettings)
+	SettingLocalTargetPolicy = "local_target_policy" // Local services clients may forward to (LocalTargetPolicy)
+	SettingMetricsRetention  = "metrics_retention"   // Retention of server metrics snapshots (MetricsRetentionSettings)
+	SettingClientVersions    = "client_versions"     // Client versions advertised to clients (ClientVersionSettings)
+	SettingForceHTTPS        = "force_https"         // Handling of plain HTTP requests to tunnels (ForceHTTPSSettings)
+	SettingTOTP              = "totp"                // Name of TOTP entries in authenticator apps (TOTPSettings)
+)
+
+// Setting is a server-wide setting changed at runtime, stored as JSON
+type Setting struct {
+	Key       string          `json:"key"`
+	Value     json.RawMessage `json:"value"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+// RateLimitSettings is the default rate limit applied to auth attempts of apps
+// without their own configuration
+type RateLimitSettings struct {
+	MaxAttempts           int       `json:"maxAttempts"`
+	WindowDurationSeconds int       `json:"windowDurationSeconds"`
+	BlockDurationSeconds  int       `json:"blockDurationSeconds"`
+	UpdatedAt             time.Time `json:"-"`
+}
+
+// ClientVersionSettings are the client versions the server advertises on
+// /api/health, for clients to tell their users about updates
+type ClientVersionSettings struct {
+	Latest  string `json:"latest,omitempty"`  // Newest released client
+	Minimum string `json:"minimum,omitempty"` // Oldest client that is still supported
+}
+
+// Force HTTPS modes: how plain HTTP requests to a tunnel are handled
+const (
+	ForceHTTPSOff      = "off"      // Served over HTTP
+	ForceHTTPSRedirect = "redirect" // Redirected to HTTPS
+	ForceHTTPSReject   = "reject"   // Answered with 403
+)
+
+// ForceHTTPSSettings control plain HTTP requests to tunnels of applications
+// that don't choose a mode, and the HSTS header of those that force HTTPS
+type ForceHTTPSSettings struct {
+	Mode       string `json:"mode"`       // ForceHTTPSOff, ForceHTTPSRedirect or ForceHTTPSReject
+	HSTSMaxAge int    `json:"hstsMaxAge"` // Strict-Transport-Security max-age in seconds (0 = no header)
+}
+
+// TOTPLabelUsername is replaced by the account's username in TOTPSettings.Label
+const TOTPLabelUsername = "{username}"
+
+// TOTPSettings name the entry authenticator apps show for a new TOTP secret
+type TOTPSettings struct {
+	Issuer string `json:"issuer"` // Shown as the entry's name, e.g. "AcmeCorp"
+	Label  string `json:"label"`  // Account name, containing TOTPLabelUsername, e.g. "{username}@acme.com"
+}
+
+// GetSetting returns a server setting, or nil when it was never stored
+func (db *DB) GetSetting(key string) (*Setting, error) {
+	setting := &Setting{Key: key}
+	var value string
+	var updatedAt sql.NullTime
+	err := db.conn.QueryRow(`SELECT value, updated_at FROM server_settings WHERE key = ?`, key).Scan(&value, &updatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get setting %s: %w", key, err)
+	}
+	setting.Value = json.RawMessage(value)
+	if updatedAt.Valid {
+		setting.UpdatedAt = updatedAt.Time
+	}
+	return setting, nil
+}
+
+// SetSetting stores a server setting. The value must be valid JSON.
+func (db *DB) SetSetting(key string, value json.RawMessage) (*Setting, error) {
+	if !json.Valid(value) {
+		return nil, fmt.Errorf("setting %s is not valid JSON", key)
+	}
+	setting := &Setting{Key: key, Value: value, UpdatedAt: time.Now()}
+	_, err := db.conn.Exec(`
+		INSERT INTO server_settings (key, value, updated_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET
+			value = excluded.value,
+			updated_at = excluded.updated_at
+	`, key, string(value), setting.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set setting %s: %w", key, err)
+	}
+	return setting, nil
+}
+
+// ListSettings returns all stored server settings, ordered by key
+func (db *DB) ListSettings() ([]*Setting, error) {
+	rows, err := db.conn.Query(`SELECT key, value, updated_at FROM server_settings ORDER BY key`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list settings: %w", err)
+	}
+	defer rows.Close()
+
+	var settings []*Setting
+	for rows.Next() {
+		setting := &Setting{}
+		var value string
+		var updatedAt sql.NullTime
+		if err := rows.Scan(&setting.Key, &value, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan setting: %w", err)
+		}
+		setting.Value = json.RawMessage(value)
+		if updatedAt.Valid {
+			setting.UpdatedAt = updatedAt.Time
+		}
+		settings = append(settings, setting)
+	}
+	return settings, rows.Err()
+}
+
+// GetDefaultRateLimitSettings returns the stored default rate limit, or nil
+// when it was never changed from the built-in default
+func (db *DB) GetDefaultRateLimitSettings() (*RateLimitSettings, error) {
+	setting, err := db.GetSetting(SettingDefaultRateLimit)
+	if err != nil || setting == nil {
+		return nil, err
+	}
+	var settings RateLimitSettings
+	if err := json.Unmarshal(setting.Value, &settings); err != nil {
+		return nil, fmt.Errorf("failed to decode setting %s: %w", SettingDefaultRateLimit, err)
+	}
+	settings.UpdatedAt = setting.UpdatedAt
+	return &settings, nil
+}
+
+// SetDefaultRateLimitSettings stores the default rate limit
+func (db *DB) SetDefaultRateLimitSettings(settings *RateLimitSettings) error {
+	value, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("failed to encode setting %s: %w", SettingDefaultRateLimit, err)
+	}
+	setting, err := db.SetSetting(SettingDefaultRateLimit, value)
+	if err != nil {
+		return err
+	}
+	settings.UpdatedAt = setting.UpdatedAt
+	return nil
+}
@@ -7,8 +7,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"time"
-
-	"github.com/google/uuid"
 )
 
 const (
@@ -25,6 +23,7 @@ type AuthSession struct {
 	OrgID      *string           `json:"orgId,omitempty"`
 	UserEmail  string            `json:"userEmail"`
 	UserClaims map[string]string `json:"userClaims,omitempty"`
+	OrgWide    bool              `json:"orgWide,omitempty"` // SSO session valid on all of the org's apps
 	CreatedAt  time.Time         `json:"createdAt"`
 	ExpiresAt  time.Time         `json:"expiresAt"`
 }
@@ -40,6 +39,15 @@ func GenerateSessionID() (string, error) {
 
 // CreateSession creates a new auth session
 func (db *DB) CreateSession(appID, orgID *string, userEmail string, userClaims map[string]string, duration time.Duration) (*AuthSession, error) {
+	return db.createSession(appID, orgID, false, userEmail, userClaims, duration)
+}
+
+// CreateOrgWideSession creates an SSO session that is valid on every app of the organization
+func (db *DB) CreateOrgWideSession(orgID string, userEmail string, userClaims map[string]string, duration time.Duration) (*AuthSession, error) {
+	return db.createSession(nil, &orgID, true, userEmail, userClaims, duration)
+}
+
+func (db *DB) createSession(appID, orgID *string, orgWide bool, userEmail string, userClaims map[string]string, duration time.Duration) (*AuthSession, error) {
 	sessionID, err := GenerateSessionID()
 	if err != nil {
 		return nil, err
@@ -56,6 +64,7 @@ func (db *DB) CreateSession(appID, orgID *string, userEmail string, userClaims m
 		OrgID:      orgID,
 		UserEmail:  userEmail,
 		UserClaims: userClaims,
+		OrgWide:    orgWide,
 		CreatedAt:  now,
 		ExpiresAt:  now.Add(duration),
 	}
@@ -63,9 +72,9 @@ func (db *DB) CreateSession(appID, orgID *string, userEmail string, userClaims m
 	claimsJSON, _ := json.Marshal(userClaims)
 
 	_, err = db.conn.Exec(`
-		INSERT INTO auth_sessions (id, app_id, org_id, user_email, user_claims, created_at, expires_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, session.ID, session.AppID, session.OrgID, session.UserEmail, string(claimsJSON), session.CreatedAt, session.ExpiresAt)
+		INSERT INTO auth_sessions (id, app_id, org_id, user_email, user_claims, org_wide, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, session.ID, session.AppID, session.OrgID, session.UserEmail, string(claimsJSON), session.OrgWide, session.CreatedAt, session.ExpiresAt)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create session: %w", err)
 	}
@@ -80,10 +89,10 @@ func (db *DB) GetSession(sessionID string) (*AuthSession, error) {
 	var claimsJSON sql.NullString
 
 	err := db.conn.QueryRow(`
-		SELECT id, app_id, org_id, user_email, user_claims, created_at, expires_at
+		SELECT id, app_id, org_id, user_email, user_claims, COALESCE(org_wide, FALSE), created_at, expires_at
 		FROM auth_sessions WHERE id = ?
 	`, sessionID).Scan(
-		&session.ID, &appID, &orgID, &session.UserEmail, &claimsJSON,
+		&session.ID, &appID, &orgID, &session.UserEmail, &claimsJSON, &session.OrgWide,
 		&session.CreatedAt, &session.ExpiresAt,
 	)
 
@@ -127,23 +136,36 @@ func (db *DB) ValidateSession(sessionID string) (*AuthSession, error) {
 	return session, nil
 }
 
-// ValidateSessionForApp validates a session for a specific app or org
+// ValidateSessionForApp validates a session for a specific app or org.
+// A session issued for an app is only valid on that app, an org-wide (SSO)
+// session on every app of its org.
 func (db *DB) ValidateSessionForApp(sessionID string, appID, orgID *string) (*AuthSession, error) {
 	session, err := db.ValidateSession(sessionID)
 	if err != nil || session == nil {
 		return nil, err
 	}
 
+	// Org-wide sessions match on the org alone
+	if session.OrgWide {
+		if orgID != nil && session.OrgID != nil && *session.OrgID == *orgID {
+			return session, nil
+		}
+		return nil, nil
+	}
+
 	// Check if session matches the app or org
-	if appID != nil && session.AppID != nil && *session.AppID == *appID {
-		return session, nil
+	if session.AppID != nil {
+		if appID != nil && *session.AppID == *appID {
+			return session, nil
+		}
+		return nil, nil
 	}
 	if orgID != nil && session.OrgID != nil && *session.OrgID == *orgID {
 		return session, nil
 	}
 
 	// If no app_id/org_id specified in session, it's valid for all
-	if session.AppID == nil && session.OrgID == nil {
+	if session.OrgID == nil {
 		return session, nil
 	}
 
@@ -205,118 +227,3 @@ func (db *DB) CountSessionsByApp(appID string) (int, error) {
 	`, appID, time.Now()).Scan(&count)
 	return count, err
 }
-
-// OIDCState represents an OIDC state for CSRF protection
-type OIDCState struct {
-	ID           string    `json:"id"`
-	State        string    `json:"state"`
-	Nonce        string    `json:"nonce"`
-	PKCEVerifier string    `json:"pkceVerifier"`
-	RedirectURL  string    `json:"redirectUrl"`
-	AppID        *string   `json:"appId,omitempty"`
-	OrgID        *string   `json:"orgId,omitempty"`
-	CreatedAt    time.Time `json:"createdAt"`
-	ExpiresAt    time.Time `json:"expiresAt"`
-}
-
-// We'll store OIDC state in auth_sessions table with a special prefix
-const oidcStatePrefix = "oidc_state:"
-
-// CreateOIDCState creates a new OIDC state for auth flow
-func (db *DB) CreateOIDCState(appID, orgID *string, redirectURL, pkceVerifier string) (*OIDCState, error) {
-	stateBytes := make([]byte, 32)
-	nonceBytes := make([]byte, 32)
-	if _, err := rand.Read(stateBytes); err != nil {
-		return nil, fmt.Errorf("failed to generate state: %w", err)
-	}
-	if _, err := rand.Read(nonceBytes); err != nil {
-		return nil, fmt.Errorf("failed to generate nonce: %w", err)
-	}
-
-	state := &OIDCState{
-		ID:           uuid.New().String(),
-		State:        hex.EncodeToString(stateBytes),
-		Nonce:        hex.EncodeToString(nonceBytes),
-		PKCEVerifier: pkceVerifier,
-		RedirectURL:  redirectURL,
-		AppID:        appID,
-		OrgID:        orgID,
-		CreatedAt:    time.Now(),
-		ExpiresAt:    time.Now().Add(10 * time.Minute), // OIDC state valid for 10 minutes
-	}
-
-	// Store as JSON in user_claims field
-	claimsJSON, _ := json.Marshal(map[string]string{
-		"type":          "oidc_state",
-		"nonce":         state.Nonce,
-		"pkce_verifier": state.PKCEVerifier,
-		"redirect_url":  state.RedirectURL,
-	})
-
-	_, err := db.conn.Exec(`
-		INSERT INTO auth_sessions (id, app_id, org_id, user_email, user_claims, created_at, expires_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, oidcStatePrefix+state.State, state.AppID, state.OrgID, "", string(claimsJSON), state.CreatedAt, state.ExpiresAt)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create OIDC state: %w", err)
-	}
-
-	return state, nil
-}
-
-// ValidateOIDCState validates and consumes an OIDC state
-func (db *DB) ValidateOIDCState(state string) (*OIDCState, error) {
-	sessionID := oidcStatePrefix + state
-
-	var appID, orgID sql.NullString
-	var claimsJSON sql.NullString
-	var createdAt, expiresAt time.Time
-
-	err := db.conn.QueryRow(`
-		SELECT app_id, org_id, user_claims, created_at, expires_at
-		FROM auth_sessions WHERE id = ?
-	`, sessionID).Scan(&appID, &orgID, &claimsJSON, &createdAt, &expiresAt)
-
-	if err == sql.ErrNoRows {
-		return nil, nil
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to get OIDC state: %w", err)
-	}
-
-	// Delete the state (one-time use)
-	db.DeleteSession(sessionID)
-
-	// Check if expired
-	if expiresAt.Before(time.Now()) {
-		return nil, nil
-	}
-
-	// Parse claims
-	var claims map[string]string
-	if claimsJSON.Valid {
-		json.Unmarshal([]byte(claimsJSON.String), &claims)
-	}
-
-	if claims["type"] != "oidc_state" {
-		return nil, nil
-	}
-
-	oidcState := &OIDCState{
-		State:        state,
-		Nonce:        claims["nonce"],
-		PKCEVerifier: claims["pkce_verifier"],
-		RedirectURL:  claims["redirect_url"],
-		CreatedAt:    createdAt,
-		ExpiresAt:    expiresAt,
-	}
-
-	if appID.Valid {
-		oidcState.AppID = &appID.String
-	}
-	if orgID.Valid {
-		oidcState.OrgID = &orgID.String
-	}
-
-	return oidcState, nil
-}
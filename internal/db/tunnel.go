@@ -15,6 +15,7 @@ type TunnelRecord struct {
 	Subdomain     string     `json:"subdomain"`
 	ClientIP      string     `json:"clientIp,omitempty"`
 	AppID         string     `json:"appId,omitempty"`
+	LocalTarget   string     `json:"localTarget,omitempty"` // Local service reported by the client, e.g. http://localhost:3000
 	CreatedAt     time.Time  `json:"createdAt"`
 	ClosedAt      *time.Time `json:"closedAt,omitempty"`
 	BytesSent     int64      `json:"bytesSent"`
@@ -121,7 +122,7 @@ func (db *DB) GetTunnel(id string) (*TunnelRecord, error) {
 // ListActiveTunnels returns all currently active (not closed) tunnels
 func (db *DB) ListActiveTunnels() ([]*TunnelRecord, error) {
 	rows, err := db.conn.Query(`
-		SELECT t.id, t.account_id, t.subdomain, t.client_ip, t.created_at, t.closed_at, 
+		SELECT t.id, t.account_id, t.subdomain, t.client_ip, t.local_target, t.created_at, t.closed_at, 
 		       t.bytes_sent, t.bytes_received, a.username
 		FROM tunnels t
 		LEFT JOIN accounts a ON t.account_id = a.id
@@ -137,10 +138,10 @@ func (db *DB) ListActiveTunnels() ([]*TunnelRecord, error) {
 	for rows.Next() {
 		record := &TunnelRecord{}
 		var closedAt sql.NullTime
-		var clientIP, username sql.NullString
+		var clientIP, localTarget, username sql.NullString
 
 		err := rows.Scan(
-			&record.ID, &record.AccountID, &record.Subdomain, &clientIP,
+			&record.ID, &record.AccountID, &record.Subdomain, &clientIP, &localTarget,
 			&record.CreatedAt, &closedAt, &record.BytesSent, &record.BytesReceived,
 			&username,
 		)
@@ -154,6 +155,7 @@ func (db *DB) ListActiveTunnels() ([]*TunnelRecord, error) {
 		if clientIP.Valid {
 			record.ClientIP = clientIP.String
 		}
+		record.LocalTarget = localTarget.String
 
 		tunnels = append(tunnels, record)
 	}
@@ -200,6 +202,94 @@ func (db *DB) ListTunnelsForAccount(accountID string) ([]*TunnelRecord, error) {
 	return tunnels, rows.Err()
 }
 
+// ListRecentTunnelsForAccount returns a page of an account's tunnels, open and
+// closed, newest first
+func (db *DB) ListRecentTunnelsForAccount(accountID string, limit, offset int) ([]*TunnelRecord, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, account_id, subdomain, client_ip, app_id, local_target, created_at, closed_at, bytes_sent, bytes_received
+		FROM tunnels WHERE account_id = ?
+		ORDER BY created_at DESC
+		LIMIT ? OFFSET ?
+	`, accountID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tunnels for account: %w", err)
+	}
+	defer rows.Close()
+
+	return scanTunnelRecords(rows)
+}
+
+// CountTunnelsForAccount returns the number of tunnel records of an account
+func (db *DB) CountTunnelsForAccount(accountID string) (int, error) {
+	var count int
+	err := db.conn.QueryRow(`
+		SELECT COUNT(*) FROM tunnels WHERE account_id = ?
+	`, accountID).Scan(&count)
+	return count, err
+}
+
+// accountTunnelsInOrg matches the tunnel records of an account, leaving out
+// tunnels to applications of other organizations. It takes the account ID and
+// organization ID.
+const accountTunnelsInOrg = `account_id = ? AND (app_id IS NULL OR app_id IN (SELECT id FROM applications WHERE org_id = ?))`
+
+// AccountTunnelActivity summarizes the tunnel records of an account
+type AccountTunnelActivity struct {
+	TotalTunnels  int        `json:"totalTunnels"`
+	ActiveTunnels int        `json:"activeTunnels"`
+	BytesSent     int64      `json:"bytesSent"`     // Of tunnels opened since the requested time
+	BytesReceived int64      `json:"bytesReceived"` // Of tunnels opened since the requested time
+	LastClosedAt  *time.Time `json:"lastClosedAt,omitempty"`
+}
+
+// GetAccountTunnelActivity summarizes an account's tunnels within an organization,
+// with the bandwidth of the tunnels opened since the given time
+func (db *DB) GetAccountTunnelActivity(accountID, orgID string, since time.Time) (*AccountTunnelActivity, error) {
+	activity := &AccountTunnelActivity{}
+	err := db.conn.QueryRow(`
+		SELECT COUNT(*),
+			COALESCE(SUM(CASE WHEN closed_at IS NULL THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN created_at >= ? THEN bytes_sent ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN created_at >= ? THEN bytes_received ELSE 0 END), 0)
+		FROM tunnels WHERE `+accountTunnelsInOrg,
+		since, since, accountID, orgID,
+	).Scan(&activity.TotalTunnels, &activity.ActiveTunnels, &activity.BytesSent, &activity.BytesReceived)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account tunnel activity: %w", err)
+	}
+
+	var closedAt sql.NullTime
+	err = db.conn.QueryRow(`
+		SELECT closed_at FROM tunnels
+		WHERE `+accountTunnelsInOrg+` AND closed_at IS NOT NULL
+		ORDER BY closed_at DESC LIMIT 1
+	`, accountID, orgID).Scan(&closedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get account tunnel activity: %w", err)
+	}
+	if closedAt.Valid {
+		activity.LastClosedAt = &closedAt.Time
+	}
+	return activity, nil
+}
+
+// ListAccountTunnelsInOrg returns a page of an account's tunnel records within an
+// organization, open and closed, newest first
+func (db *DB) ListAccountTunnelsInOrg(accountID, orgID string, limit, offset int) ([]*TunnelRecord, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, account_id, subdomain, client_ip, app_id, local_target, created_at, closed_at, bytes_sent, bytes_received
+		FROM tunnels WHERE `+accountTunnelsInOrg+`
+		ORDER BY created_at DESC
+		LIMIT ? OFFSET ?
+	`, accountID, orgID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list account tunnels: %w", err)
+	}
+	defer rows.Close()
+
+	return scanTunnelRecords(rows)
+}
+
 // CountActiveTunnels returns the number of active tunnels
 func (db *DB) CountActiveTunnels() (int, error) {
 	var count int
@@ -234,6 +324,28 @@ func (db *DB) UpdateTunnelAppID(id, appID string) error {
 	return err
 }
 
+// UpdateTunnelLocalTarget records the local service a tunnel forwards to
+func (db *DB) UpdateTunnelLocalTarget(id, localTarget string) error {
+	_, err := db.conn.Exec(`UPDATE tunnels SET local_target = ? WHERE id = ?`, localTarget, id)
+	return err
+}
+
+// LocalTargetPolicy restricts the local services tunnel clients may forward to.
+// Clients report their targets themselves, so the policy guards against
+// mistakes rather than hostile clients.
+type LocalTargetPolicy struct {
+	// AllowedNetworks are CIDRs the target address must be in; localhost and
+	// Unix sockets count as loopback. Empty allows any address.
+	AllowedNetworks []string `json:"allowedNetworks,omitempty"`
+
+	// AllowedPorts are ports or port ranges, e.g. "3000" or "8000-8999". Empty
+	// allows any port.
+	AllowedPorts []string `json:"allowedPorts,omitempty"`
+
+	// RequireReport rejects clients that don't report their local target
+	RequireReport bool `json:"requireReport,omitempty"`
+}
+
 // ============================================
 // App and Org specific tunnel methods
 // ============================================
@@ -303,7 +415,7 @@ func (db *DB) GetTunnelStatsByOrg(orgID string) (*TunnelStats, error) {
 // ListActiveTunnelsByApp returns all active tunnels for a specific application
 func (db *DB) ListActiveTunnelsByApp(appID string) ([]*TunnelRecord, error) {
 	rows, err := db.conn.Query(`
-		SELECT id, account_id, subdomain, client_ip, app_id, created_at, closed_at, bytes_sent, bytes_received
+		SELECT id, account_id, subdomain, client_ip, app_id, local_target, created_at, closed_at, bytes_sent, bytes_received
 		FROM tunnels WHERE app_id = ? AND closed_at IS NULL
 		ORDER BY created_at DESC
 	`, appID)
@@ -318,7 +430,7 @@ func (db *DB) ListActiveTunnelsByApp(appID string) ([]*TunnelRecord, error) {
 // ListActiveTunnelsByOrg returns all active tunnels for an organization
 func (db *DB) ListActiveTunnelsByOrg(orgID string) ([]*TunnelRecord, error) {
 	rows, err := db.conn.Query(`
-		SELECT t.id, t.account_id, t.subdomain, t.client_ip, t.app_id, t.created_at, t.closed_at, t.bytes_sent, t.bytes_received
+		SELECT t.id, t.account_id, t.subdomain, t.client_ip, t.app_id, t.local_target, t.created_at, t.closed_at, t.bytes_sent, t.bytes_received
 		FROM tunnels t
 		JOIN applications a ON t.app_id = a.id
 		WHERE a.org_id = ? AND t.closed_at IS NULL
@@ -359,10 +471,10 @@ func scanTunnelRecords(rows *sql.Rows) ([]*TunnelRecord, error) {
 	for rows.Next() {
 		record := &TunnelRecord{}
 		var closedAt sql.NullTime
-		var clientIP, appID sql.NullString
+		var clientIP, appID, localTarget sql.NullString
 
 		err := rows.Scan(
-			&record.ID, &record.AccountID, &record.Subdomain, &clientIP, &appID,
+			&record.ID, &record.AccountID, &record.Subdomain, &clientIP, &appID, &localTarget,
 			&record.CreatedAt, &closedAt, &record.BytesSent, &record.BytesReceived,
 		)
 		if err != nil {
@@ -378,6 +490,7 @@ func scanTunnelRecords(rows *sql.Rows) ([]*TunnelRecord, error) {
 		if appID.Valid {
 			record.AppID = appID.String
 		}
+		record.LocalTarget = localTarget.String
 
 		tunnels = append(tunnels, record)
 	}
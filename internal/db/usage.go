@@ -17,6 +17,50 @@ const (
 	PeriodMonthly PeriodType = "monthly"
 )
 
+// coarser returns the period type that snapshots of this type are rolled up into
+func (p PeriodType) coarser() PeriodType {
+	switch p {
+	case PeriodHourly:
+		return PeriodDaily
+	case PeriodDaily:
+		return PeriodMonthly
+	}
+	return ""
+}
+
+// truncate returns the start of the period of this type containing t
+func (p PeriodType) truncate(t time.Time) time.Time {
+	t = t.UTC()
+	switch p {
+	case PeriodHourly:
+		return t.Truncate(time.Hour)
+	case PeriodDaily:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	case PeriodMonthly:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return t
+}
+
+// next returns the start of the period of this type following the one starting at t
+func (p PeriodType) next(t time.Time) time.Time {
+	switch p {
+	case PeriodHourly:
+		return t.Add(time.Hour)
+	case PeriodDaily:
+		return t.AddDate(0, 0, 1)
+	}
+	return t.AddDate(0, 1, 0)
+}
+
+// unrolledUsageFilter matches the snapshots that make up a month's running total:
+// daily snapshots plus hourly snapshots of days that have not been rolled up yet.
+// The alias u must refer to usage_snapshots.
+const unrolledUsageFilter = `(u.period_type = 'daily' OR (u.period_type = 'hourly' AND NOT EXISTS (
+	SELECT 1 FROM usage_snapshots d
+	WHERE d.org_id = u.org_id AND d.period_type = 'daily'
+	  AND substr(d.period_start, 1, 10) = substr(u.period_start, 1, 10))))`
+
 // UsageSnapshot represents aggregated usage metrics for a period
 type UsageSnapshot struct {
 	ID                    string     `json:"id"`
@@ -123,8 +167,46 @@ func (db *DB) GetUsageSnapshot(orgID string, periodType PeriodType, periodStart
 	return snapshot, nil
 }
 
-// GetUsageSnapshotsForOrg retrieves all usage snapshots for an organization within a time range
+// GetUsageSnapshotsForOrg retrieves all usage snapshots for an organization within a time range.
+// Where snapshots of the requested type have already been pruned, the older part of the
+// range is served from the coarser rollups instead, so long ranges return fewer rows.
 func (db *DB) GetUsageSnapshotsForOrg(orgID string, periodType PeriodType, start, end time.Time) ([]*UsageSnapshot, error) {
+	coarser := periodType.coarser()
+	if coarser == "" {
+		return db.getUsageSnapshots(orgID, periodType, start, end)
+	}
+
+	earliest, err := db.getEarliestUsageSnapshot(orgID, periodType)
+	if err != nil {
+		return nil, err
+	}
+	if earliest == nil || !earliest.After(start) {
+		return db.getUsageSnapshots(orgID, periodType, start, end)
+	}
+
+	// Use rollups up to the first period fully covered by finer snapshots; a partially
+	// pruned coarse period is served by its rollup
+	boundary := coarser.truncate(*earliest)
+	if boundary.Before(*earliest) {
+		boundary = coarser.next(boundary)
+	}
+	if boundary.After(end) {
+		boundary = end
+	}
+
+	snapshots, err := db.GetUsageSnapshotsForOrg(orgID, coarser, start, boundary)
+	if err != nil {
+		return nil, err
+	}
+	finer, err := db.getUsageSnapshots(orgID, periodType, boundary, end)
+	if err != nil {
+		return nil, err
+	}
+	return append(snapshots, finer...), nil
+}
+
+// getUsageSnapshots retrieves the usage snapshots of one period type within a time range
+func (db *DB) getUsageSnapshots(orgID string, periodType PeriodType, start, end time.Time) ([]*UsageSnapshot, error) {
 	rows, err := db.conn.Query(`
 		SELECT id, org_id, period_type, period_start, bandwidth_bytes,
 		       tunnel_seconds, request_count, peak_concurrent_tunnels
@@ -154,6 +236,24 @@ func (db *DB) GetUsageSnapshotsForOrg(orgID string, periodType PeriodType, start
 	return snapshots, rows.Err()
 }
 
+// getEarliestUsageSnapshot returns the start of an organization's oldest snapshot of a period type
+func (db *DB) getEarliestUsageSnapshot(orgID string, periodType PeriodType) (*time.Time, error) {
+	var periodStart time.Time
+	err := db.conn.QueryRow(`
+		SELECT period_start FROM usage_snapshots
+		WHERE org_id = ? AND period_type = ?
+		ORDER BY period_start
+		LIMIT 1
+	`, orgID, string(periodType)).Scan(&periodStart)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get earliest usage snapshot: %w", err)
+	}
+	return &periodStart, nil
+}
+
 // GetCurrentPeriodUsage returns the aggregated usage for the current billing period (month)
 func (db *DB) GetCurrentPeriodUsage(orgID string) (*UsageSnapshot, error) {
 	now := time.Now()
@@ -166,12 +266,13 @@ func (db *DB) GetCurrentPeriodUsage(orgID string) (*UsageSnapshot, error) {
 		PeriodStart: periodStart,
 	}
 
-	// Aggregate from all snapshot types for the current month
+	// Aggregate the current month without counting rolled-up hours twice
 	err := db.conn.QueryRow(`
 		SELECT COALESCE(SUM(bandwidth_bytes), 0), COALESCE(SUM(tunnel_seconds), 0),
 		       COALESCE(SUM(request_count), 0), COALESCE(MAX(peak_concurrent_tunnels), 0)
-		FROM usage_snapshots
-		WHERE org_id = ? AND period_start >= ? AND period_start < ?
+		FROM usage_snapshots u
+		WHERE u.org_id = ? AND u.period_start >= ? AND u.period_start < ?
+		  AND `+unrolledUsageFilter+`
 	`, orgID, periodStart, periodEnd).Scan(
 		&snapshot.BandwidthBytes, &snapshot.TunnelSeconds,
 		&snapshot.RequestCount, &snapshot.PeakConcurrentTunnels,
@@ -300,6 +401,7 @@ func (db *DB) GetUsageSummaryForAllOrgs() ([]map[string]interface{}, error) {
 		FROM organizations o
 		LEFT JOIN usage_snapshots u ON o.id = u.org_id 
 			AND u.period_start >= ? AND u.period_start < ?
+			AND `+unrolledUsageFilter+`
 		GROUP BY o.id, o.name, o.plan_id
 		ORDER BY bandwidth DESC
 	`, periodStart, periodEnd)
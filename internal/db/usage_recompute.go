@@ -0,0 +1,336 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UsageTotals are usage metrics summed over a time range
+type UsageTotals struct {
+	BandwidthBytes        int64 `json:"bandwidthBytes"`
+	TunnelSeconds         int64 `json:"tunnelSeconds"`
+	RequestCount          int64 `json:"requestCount"`
+	PeakConcurrentTunnels int   `json:"peakConcurrentTunnels"`
+}
+
+// Sub returns the difference between these totals and other
+func (t UsageTotals) Sub(other UsageTotals) UsageTotals {
+	return UsageTotals{
+		BandwidthBytes:        t.BandwidthBytes - other.BandwidthBytes,
+		TunnelSeconds:         t.TunnelSeconds - other.TunnelSeconds,
+		RequestCount:          t.RequestCount - other.RequestCount,
+		PeakConcurrentTunnels: t.PeakConcurrentTunnels - other.PeakConcurrentTunnels,
+	}
+}
+
+// UsageRecompute reports an organization's usage over a range before and after
+// recomputing its snapshots
+type UsageRecompute struct {
+	OrgID  string      `json:"orgId"`
+	From   time.Time   `json:"from"`
+	To     time.Time   `json:"to"`
+	Hours  int         `json:"hours"` // Hourly snapshots written
+	Before UsageTotals `json:"before"`
+	After  UsageTotals `json:"after"`
+}
+
+// hourUsage accumulates the usage of one hour from tunnel records
+type hourUsage struct {
+	bandwidth float64
+	requests  float64
+	active    time.Duration
+	intervals [][2]time.Time // Tunnel lifetimes clipped to the hour
+}
+
+func (h *hourUsage) totals() UsageTotals {
+	return UsageTotals{
+		BandwidthBytes:        int64(math.Round(h.bandwidth)),
+		TunnelSeconds:         int64(h.active.Seconds()),
+		RequestCount:          int64(math.Round(h.requests)),
+		PeakConcurrentTunnels: peakConcurrent(h.intervals),
+	}
+}
+
+// peakConcurrent returns the largest number of overlapping intervals
+func peakConcurrent(intervals [][2]time.Time) int {
+	type event struct {
+		at    time.Time
+		delta int
+	}
+	events := make([]event, 0, 2*len(intervals))
+	for _, iv := range intervals {
+		events = append(events, event{iv[0], 1}, event{iv[1], -1})
+	}
+	// A tunnel closing at the instant another opens doesn't overlap it
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].at.Equal(events[j].at) {
+			return events[i].delta < events[j].delta
+		}
+		return events[i].at.Before(events[j].at)
+	})
+
+	peak, current := 0, 0
+	for _, e := range events {
+		current += e.delta
+		if current > peak {
+			peak = current
+		}
+	}
+	return peak
+}
+
+// RecomputeOrgUsage rebuilds an organization's usage snapshots for whole UTC days
+// covering [from, to) from its tunnel records, replacing the stored aggregates in
+// one transaction. Tunnel records only hold lifetime totals, so bandwidth and
+// requests are spread over the hours a tunnel was open in proportion to time.
+// Rolled-up daily snapshots are replaced and monthly rollups adjusted by the
+// difference; days whose daily snapshot was already pruned keep their share
+// of the monthly rollup.
+func (db *DB) RecomputeOrgUsage(orgID string, from, to time.Time) (*UsageRecompute, error) {
+	from = PeriodDaily.truncate(from)
+	if end := PeriodDaily.truncate(to); end.Before(to.UTC()) {
+		to = PeriodDaily.next(end)
+	} else {
+		to = end
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("empty usage range")
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result := &UsageRecompute{OrgID: orgID, From: from, To: to}
+	if result.Before, err = usageTotalsTx(tx, orgID, from, to); err != nil {
+		return nil, err
+	}
+
+	hours, err := tunnelUsageByHour(tx, orgID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`
+		DELETE FROM usage_snapshots
+		WHERE org_id = ? AND period_type = 'hourly' AND period_start >= ? AND period_start < ?
+	`, orgID, from, to); err != nil {
+		return nil, fmt.Errorf("failed to delete hourly snapshots: %w", err)
+	}
+
+	days := make(map[time.Time]UsageTotals)
+	for hour, usage := range hours {
+		totals := usage.totals()
+		if totals == (UsageTotals{}) {
+			continue
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO usage_snapshots (id, org_id, period_type, period_start,
+				bandwidth_bytes, tunnel_seconds, request_count, peak_concurrent_tunnels)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, uuid.New().String(), orgID, string(PeriodHourly), hour,
+			totals.BandwidthBytes, totals.TunnelSeconds, totals.RequestCount, totals.PeakConcurrentTunnels); err != nil {
+			return nil, fmt.Errorf("failed to insert hourly snapshot: %w", err)
+		}
+		result.Hours++
+
+		day := PeriodDaily.truncate(hour)
+		dayTotals := days[day]
+		dayTotals.BandwidthBytes += totals.BandwidthBytes
+		dayTotals.TunnelSeconds += totals.TunnelSeconds
+		dayTotals.RequestCount += totals.RequestCount
+		dayTotals.PeakConcurrentTunnels = max(dayTotals.PeakConcurrentTunnels, totals.PeakConcurrentTunnels)
+		days[day] = dayTotals
+	}
+
+	if err := replaceDailySnapshotsTx(tx, orgID, from, to, days); err != nil {
+		return nil, err
+	}
+
+	if result.After, err = usageTotalsTx(tx, orgID, from, to); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit usage recompute: %w", err)
+	}
+	return result, nil
+}
+
+// usageTotalsTx sums an organization's usage over a range without counting
+// rolled-up hours twice
+func usageTotalsTx(tx *sql.Tx, orgID string, from, to time.Time) (UsageTotals, error) {
+	var totals UsageTotals
+	err := tx.QueryRow(`
+		SELECT COALESCE(SUM(bandwidth_bytes), 0), COALESCE(SUM(tunnel_seconds), 0),
+		       COALESCE(SUM(request_count), 0), COALESCE(MAX(peak_concurrent_tunnels), 0)
+		FROM usage_snapshots u
+		WHERE u.org_id = ? AND u.period_start >= ? AND u.period_start < ?
+		  AND `+unrolledUsageFilter+`
+	`, orgID, from, to).Scan(&totals.BandwidthBytes, &totals.TunnelSeconds,
+		&totals.RequestCount, &totals.PeakConcurrentTunnels)
+	if err != nil {
+		return totals, fmt.Errorf("failed to sum usage: %w", err)
+	}
+	return totals, nil
+}
+
+// tunnelUsageByHour spreads the organization's tunnel records over the hours of
+// [from, to). Tunnels count towards the organization of their application, or
+// of their account when they have none; open tunnels count up to now.
+func tunnelUsageByHour(tx *sql.Tx, orgID string, from, to time.Time) (map[time.Time]*hourUsage, error) {
+	rows, err := tx.Query(`
+		SELECT t.created_at, t.closed_at,
+		       COALESCE(t.bytes_sent, 0) + COALESCE(t.bytes_received, 0), COALESCE(t.request_count, 0)
+		FROM tunnels t
+		LEFT JOIN applications a ON t.app_id = a.id
+		LEFT JOIN accounts acc ON t.account_id = acc.id
+		WHERE COALESCE(a.org_id, acc.org_id) = ?
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tunnels: %w", err)
+	}
+	defer rows.Close()
+
+	now := time.Now().UTC()
+	hours := make(map[time.Time]*hourUsage)
+	hourOf := func(t time.Time) *hourUsage {
+		hour := PeriodHourly.truncate(t)
+		usage, ok := hours[hour]
+		if !ok {
+			usage = &hourUsage{}
+			hours[hour] = usage
+		}
+		return usage
+	}
+
+	for rows.Next() {
+		var createdAt time.Time
+		var closedAt sql.NullTime
+		var bytes, requests int64
+		if err := rows.Scan(&createdAt, &closedAt, &bytes, &requests); err != nil {
+			return nil, fmt.Errorf("failed to scan tunnel: %w", err)
+		}
+
+		start, end := createdAt.UTC(), now
+		if closedAt.Valid {
+			end = closedAt.Time.UTC()
+		}
+		if end.Before(start) {
+			end = start
+		}
+		lifetime := end.Sub(start)
+
+		if lifetime == 0 {
+			if !start.Before(from) && start.Before(to) {
+				usage := hourOf(start)
+				usage.bandwidth += float64(bytes)
+				usage.requests += float64(requests)
+			}
+			continue
+		}
+
+		lo, hi := start, end
+		if lo.Before(from) {
+			lo = from
+		}
+		if hi.After(to) {
+			hi = to
+		}
+		for hour := PeriodHourly.truncate(lo); hour.Before(hi); hour = PeriodHourly.next(hour) {
+			a, b := hour, PeriodHourly.next(hour)
+			if a.Before(lo) {
+				a = lo
+			}
+			if b.After(hi) {
+				b = hi
+			}
+			if !a.Before(b) {
+				continue
+			}
+			share := float64(b.Sub(a)) / float64(lifetime)
+			usage := hourOf(hour)
+			usage.bandwidth += share * float64(bytes)
+			usage.requests += share * float64(requests)
+			usage.active += b.Sub(a)
+			usage.intervals = append(usage.intervals, [2]time.Time{a, b})
+		}
+	}
+	return hours, rows.Err()
+}
+
+// replaceDailySnapshotsTx overwrites the organization's rolled-up daily snapshots
+// in [from, to) with the recomputed day totals and moves the monthly rollups of
+// those days by the same difference. Days that were not rolled up stay that way.
+func replaceDailySnapshotsTx(tx *sql.Tx, orgID string, from, to time.Time, days map[time.Time]UsageTotals) error {
+	rows, err := tx.Query(`
+		SELECT id, period_start, bandwidth_bytes, tunnel_seconds, request_count
+		FROM usage_snapshots
+		WHERE org_id = ? AND period_type = 'daily' AND period_start >= ? AND period_start < ?
+	`, orgID, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to list daily snapshots: %w", err)
+	}
+
+	type dailySnapshot struct {
+		id    string
+		day   time.Time
+		stale UsageTotals
+	}
+	var dailies []dailySnapshot
+	for rows.Next() {
+		var d dailySnapshot
+		if err := rows.Scan(&d.id, &d.day, &d.stale.BandwidthBytes, &d.stale.TunnelSeconds, &d.stale.RequestCount); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan daily snapshot: %w", err)
+		}
+		d.day = PeriodDaily.truncate(d.day)
+		dailies = append(dailies, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list daily snapshots: %w", err)
+	}
+
+	months := make(map[time.Time]UsageTotals)
+	for _, d := range dailies {
+		fresh := days[d.day]
+		if _, err := tx.Exec(`
+			UPDATE usage_snapshots SET
+				bandwidth_bytes = ?, tunnel_seconds = ?, request_count = ?, peak_concurrent_tunnels = ?
+			WHERE id = ?
+		`, fresh.BandwidthBytes, fresh.TunnelSeconds, fresh.RequestCount, fresh.PeakConcurrentTunnels, d.id); err != nil {
+			return fmt.Errorf("failed to update daily snapshot: %w", err)
+		}
+
+		month := PeriodMonthly.truncate(d.day)
+		delta := fresh.Sub(d.stale)
+		monthDelta := months[month]
+		monthDelta.BandwidthBytes += delta.BandwidthBytes
+		monthDelta.TunnelSeconds += delta.TunnelSeconds
+		monthDelta.RequestCount += delta.RequestCount
+		monthDelta.PeakConcurrentTunnels = max(monthDelta.PeakConcurrentTunnels, fresh.PeakConcurrentTunnels)
+		months[month] = monthDelta
+	}
+
+	for month, delta := range months {
+		if _, err := tx.Exec(`
+			UPDATE usage_snapshots SET
+				bandwidth_bytes = MAX(bandwidth_bytes + ?, 0),
+				tunnel_seconds = MAX(tunnel_seconds + ?, 0),
+				request_count = MAX(request_count + ?, 0),
+				peak_concurrent_tunnels = MAX(peak_concurrent_tunnels, ?)
+			WHERE org_id = ? AND period_type = 'monthly' AND period_start >= ? AND period_start < ?
+		`, delta.BandwidthBytes, delta.TunnelSeconds, delta.RequestCount, delta.PeakConcurrentTunnels,
+			orgID, month, PeriodMonthly.next(month)); err != nil {
+			return fmt.Errorf("failed to adjust monthly snapshot: %w", err)
+		}
+	}
+	return nil
+}
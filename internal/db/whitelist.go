@@ -164,34 +164,39 @@ func (db *DB) DeleteGlobalWhitelist(id string) error {
 
 // AddOrgWhitelist adds an IP range to an organization's whitelist
 func (db *DB) AddOrgWhitelist(orgID, ipRange, description, createdBy string) (*OrgWhitelistEntry, error) {
-	if err := validateIPRange(ipRange); err != nil {
-		return nil, fmt.Errorf("invalid IP range: %w", err)
+	entry := &OrgWhitelistEntry{
+		ID:          uuid.New().String(),
+		OrgID:       orgID,
+		IPRange:     ipRange,
+		Description: description,
+		CreatedBy:   createdBy,
+		CreatedAt:   time.Now(),
+	}
+	if err := insertOrgWhitelist(db.conn, entry); err != nil {
+		return nil, err
 	}
+	return entry, nil
+}
 
-	id := uuid.New().String()
-	now := time.Now()
+// insertOrgWhitelist validates and stores an org whitelist entry
+func insertOrgWhitelist(conn sqlExecer, entry *OrgWhitelistEntry) error {
+	if err := validateIPRange(entry.IPRange); err != nil {
+		return fmt.Errorf("invalid IP range: %w", err)
+	}
 
-	var createdByPtr *string
-	if createdBy != "" {
-		createdByPtr = &createdBy
+	var createdBy *string
+	if entry.CreatedBy != "" {
+		createdBy = &entry.CreatedBy
 	}
 
-	_, err := db.conn.Exec(`
+	_, err := conn.Exec(`
 		INSERT INTO org_whitelist (id, org_id, ip_range, description, created_by, created_at)
 		VALUES (?, ?, ?, ?, ?, ?)
-	`, id, orgID, ipRange, description, createdByPtr, now)
+	`, entry.ID, entry.OrgID, entry.IPRange, entry.Description, createdBy, entry.CreatedAt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to add org whitelist entry: %w", err)
+		return fmt.Errorf("failed to add org whitelist entry: %w", err)
 	}
-
-	return &OrgWhitelistEntry{
-		ID:          id,
-		OrgID:       orgID,
-		IPRange:     ipRange,
-		Description: description,
-		CreatedBy:   createdBy,
-		CreatedAt:   now,
-	}, nil
+	return nil
 }
 
 // ListOrgWhitelist returns all whitelist entries for an organization
@@ -320,34 +325,39 @@ func (db *DB) CountOrgWhitelist(orgID string) (int, error) {
 
 // AddAppWhitelist adds an IP range to an application's whitelist
 func (db *DB) AddAppWhitelist(appID, ipRange, description, createdBy string) (*AppWhitelistEntry, error) {
-	if err := validateIPRange(ipRange); err != nil {
-		return nil, fmt.Errorf("invalid IP range: %w", err)
+	entry := &AppWhitelistEntry{
+		ID:          uuid.New().String(),
+		AppID:       appID,
+		IPRange:     ipRange,
+		Description: description,
+		CreatedBy:   createdBy,
+		CreatedAt:   time.Now(),
 	}
+	if err := insertAppWhitelist(db.conn, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
 
-	id := uuid.New().String()
-	now := time.Now()
+// insertAppWhitelist validates and stores an app whitelist entry
+func insertAppWhitelist(conn sqlExecer, entry *AppWhitelistEntry) error {
+	if err := validateIPRange(entry.IPRange); err != nil {
+		return fmt.Errorf("invalid IP range: %w", err)
+	}
 
-	var createdByPtr *string
-	if createdBy != "" {
-		createdByPtr = &createdBy
+	var createdBy *string
+	if entry.CreatedBy != "" {
+		createdBy = &entry.CreatedBy
 	}
 
-	_, err := db.conn.Exec(`
+	_, err := conn.Exec(`
 		INSERT INTO app_whitelist (id, app_id, ip_range, description, created_by, created_at)
 		VALUES (?, ?, ?, ?, ?, ?)
-	`, id, appID, ipRange, description, createdByPtr, now)
+	`, entry.ID, entry.AppID, entry.IPRange, entry.Description, createdBy, entry.CreatedAt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to add app whitelist entry: %w", err)
+		return fmt.Errorf("failed to add app whitelist entry: %w", err)
 	}
-
-	return &AppWhitelistEntry{
-		ID:          id,
-		AppID:       appID,
-		IPRange:     ipRange,
-		Description: description,
-		CreatedBy:   createdBy,
-		CreatedAt:   now,
-	}, nil
+	return nil
 }
 
 // ListAppWhitelist returns all whitelist entries for an application
@@ -549,122 +559,158 @@ func (db *DB) DeleteAccountWhitelist(id string) error {
 	return nil
 }
 
+// Whitelist layers reported in a WhitelistMatch
+const (
+	WhitelistLayerGlobal  = "global"
+	WhitelistLayerOrg     = "org"
+	WhitelistLayerApp     = "app"
+	WhitelistLayerAccount = "account"
+)
+
+// WhitelistMatch describes the whitelist entry that allowed an IP
+type WhitelistMatch struct {
+	Layer       string `json:"layer"`
+	EntryID     string `json:"entryId"`
+	IPRange     string `json:"ipRange"`
+	Description string `json:"description,omitempty"`
+}
+
 // IsIPWhitelisted checks if an IP is in the global whitelist (legacy, for backward compatibility)
 func (db *DB) IsIPWhitelisted(ipStr string) (bool, error) {
+	match, err := db.MatchIPWhitelist(ipStr)
+	return match != nil, err
+}
+
+// MatchIPWhitelist returns the global whitelist entry matching an IP, or nil if none does
+func (db *DB) MatchIPWhitelist(ipStr string) (*WhitelistMatch, error) {
 	ip := net.ParseIP(ipStr)
 	if ip == nil {
-		return false, fmt.Errorf("invalid IP address: %s", ipStr)
+		return nil, fmt.Errorf("invalid IP address: %s", ipStr)
 	}
 
 	entries, err := db.ListGlobalWhitelist()
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
 	for _, entry := range entries {
 		if matchesIPRange(ip, entry.IPRange) {
-			return true, nil
+			return &WhitelistMatch{Layer: WhitelistLayerGlobal, EntryID: entry.ID, IPRange: entry.IPRange, Description: entry.Description}, nil
 		}
 	}
 
-	return false, nil
+	return nil, nil
 }
 
 // IsIPWhitelistedForOrg checks if an IP is whitelisted for an organization
 func (db *DB) IsIPWhitelistedForOrg(ipStr, orgID string) (bool, error) {
+	match, err := db.MatchIPWhitelistForOrg(ipStr, orgID)
+	return match != nil, err
+}
+
+// MatchIPWhitelistForOrg returns the org whitelist entry matching an IP, or nil if none does
+func (db *DB) MatchIPWhitelistForOrg(ipStr, orgID string) (*WhitelistMatch, error) {
 	ip := net.ParseIP(ipStr)
 	if ip == nil {
-		return false, fmt.Errorf("invalid IP address: %s", ipStr)
+		return nil, fmt.Errorf("invalid IP address: %s", ipStr)
 	}
 
 	entries, err := db.ListOrgWhitelist(orgID)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
 	for _, entry := range entries {
 		if matchesIPRange(ip, entry.IPRange) {
-			return true, nil
+			return &WhitelistMatch{Layer: WhitelistLayerOrg, EntryID: entry.ID, IPRange: entry.IPRange, Description: entry.Description}, nil
 		}
 	}
 
-	return false, nil
+	return nil, nil
 }
 
 // IsIPWhitelistedForApp checks if an IP is whitelisted for an application
 // It checks both app-specific whitelist and falls back to org whitelist
 func (db *DB) IsIPWhitelistedForApp(ipStr, appID string) (bool, error) {
+	match, err := db.MatchIPWhitelistForApp(ipStr, appID)
+	return match != nil, err
+}
+
+// MatchIPWhitelistForApp returns the entry that whitelists an IP for an application,
+// checking the app whitelist before the org whitelist. Returns nil if none matches.
+func (db *DB) MatchIPWhitelistForApp(ipStr, appID string) (*WhitelistMatch, error) {
 	ip := net.ParseIP(ipStr)
 	if ip == nil {
-		return false, fmt.Errorf("invalid IP address: %s", ipStr)
+		return nil, fmt.Errorf("invalid IP address: %s", ipStr)
 	}
 
 	// First check app-specific whitelist
 	appEntries, err := db.ListAppWhitelist(appID)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
 	for _, entry := range appEntries {
 		if matchesIPRange(ip, entry.IPRange) {
-			return true, nil
+			return &WhitelistMatch{Layer: WhitelistLayerApp, EntryID: entry.ID, IPRange: entry.IPRange, Description: entry.Description}, nil
 		}
 	}
 
 	// If no app-specific whitelist entries, check org whitelist
 	app, err := db.GetApplicationByID(appID)
 	if err != nil || app == nil {
-		return false, err
+		return nil, err
 	}
 
-	return db.IsIPWhitelistedForOrg(ipStr, app.OrgID)
+	return db.MatchIPWhitelistForOrg(ipStr, app.OrgID)
 }
 
 // IsIPWhitelistedForAccount checks if an IP is whitelisted for a specific account
 // It checks org whitelist (based on account's org), then account-specific whitelist
 func (db *DB) IsIPWhitelistedForAccount(ipStr, accountID string) (bool, error) {
+	match, err := db.MatchIPWhitelistForAccount(ipStr, accountID)
+	return match != nil, err
+}
+
+// MatchIPWhitelistForAccount returns the entry that whitelists an IP for an account,
+// checking the org, global and account whitelists in that order. Returns nil if none matches.
+func (db *DB) MatchIPWhitelistForAccount(ipStr, accountID string) (*WhitelistMatch, error) {
 	ip := net.ParseIP(ipStr)
 	if ip == nil {
-		return false, fmt.Errorf("invalid IP address: %s", ipStr)
+		return nil, fmt.Errorf("invalid IP address: %s", ipStr)
 	}
 
 	// First check if account has an org_id and check org whitelist
 	account, err := db.GetAccountByID(accountID)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 	if account != nil && account.OrgID != "" {
-		whitelisted, err := db.IsIPWhitelistedForOrg(ipStr, account.OrgID)
-		if err != nil {
-			return false, err
-		}
-		if whitelisted {
-			return true, nil
+		match, err := db.MatchIPWhitelistForOrg(ipStr, account.OrgID)
+		if err != nil || match != nil {
+			return match, err
 		}
 	}
 
 	// Fall back to global whitelist for backward compatibility
-	whitelisted, err := db.IsIPWhitelisted(ipStr)
-	if err != nil {
-		return false, err
-	}
-	if whitelisted {
-		return true, nil
+	match, err := db.MatchIPWhitelist(ipStr)
+	if err != nil || match != nil {
+		return match, err
 	}
 
 	// Then check account-specific whitelist
 	entries, err := db.ListAccountWhitelist(accountID)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
 	for _, entry := range entries {
 		if matchesIPRange(ip, entry.IPRange) {
-			return true, nil
+			return &WhitelistMatch{Layer: WhitelistLayerAccount, EntryID: entry.ID, IPRange: entry.IPRange, Description: entry.Description}, nil
 		}
 	}
 
-	return false, nil
+	return nil, nil
 }
 
 // CountGlobalWhitelist returns the number of global whitelist entries
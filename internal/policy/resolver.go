@@ -171,7 +171,7 @@ func (r *Resolver) orgPolicyToEffective(orgPolicy *db.OrgAuthPolicy) (*Effective
 		}
 
 	case AuthTypeAPIKey:
-		policy.APIKey = &APIKeyConfig{}
+		policy.APIKey = &APIKeyConfig{RedirectURL: orgPolicy.APIKeyRedirectURL}
 
 	case AuthTypeOIDC:
 		clientSecret := orgPolicy.OIDCClientSecretEnc
@@ -191,6 +191,9 @@ func (r *Resolver) orgPolicyToEffective(orgPolicy *db.OrgAuthPolicy) (*Effective
 			AllowedDomains: orgPolicy.OIDCAllowedDomains,
 			RequiredClaims: orgPolicy.OIDCRequiredClaims,
 		}
+
+	case AuthTypeWebhook:
+		policy.Webhook = &WebhookConfig{URL: orgPolicy.WebhookURL, Headers: orgPolicy.WebhookHeaders}
 	}
 
 	return policy, nil
@@ -214,7 +217,7 @@ func (r *Resolver) appPolicyToEffective(appPolicy *db.AppAuthPolicy, orgID, appI
 		}
 
 	case AuthTypeAPIKey:
-		policy.APIKey = &APIKeyConfig{}
+		policy.APIKey = &APIKeyConfig{RedirectURL: appPolicy.APIKeyRedirectURL}
 
 	case AuthTypeOIDC:
 		clientSecret := appPolicy.OIDCClientSecretEnc
@@ -234,6 +237,9 @@ func (r *Resolver) appPolicyToEffective(appPolicy *db.AppAuthPolicy, orgID, appI
 			AllowedDomains: appPolicy.OIDCAllowedDomains,
 			RequiredClaims: appPolicy.OIDCRequiredClaims,
 		}
+
+	case AuthTypeWebhook:
+		policy.Webhook = &WebhookConfig{URL: appPolicy.WebhookURL, Headers: appPolicy.WebhookHeaders}
 	}
 
 	return policy, nil
@@ -1,6 +1,7 @@
 package policy
 
 import (
+	"strings"
 	"time"
 
 	"github.com/niekvdm/digit-link/internal/db"
@@ -19,10 +20,11 @@ const (
 type AuthType string
 
 const (
-	AuthTypeNone   AuthType = ""
-	AuthTypeBasic  AuthType = "basic"
-	AuthTypeAPIKey AuthType = "api_key"
-	AuthTypeOIDC   AuthType = "oidc"
+	AuthTypeNone    AuthType = ""
+	AuthTypeBasic   AuthType = "basic"
+	AuthTypeAPIKey  AuthType = "api_key"
+	AuthTypeOIDC    AuthType = "oidc"
+	AuthTypeWebhook AuthType = "webhook"
 )
 
 // BasicConfig holds Basic auth configuration
@@ -35,7 +37,9 @@ type BasicConfig struct {
 // APIKeyConfig holds API key auth configuration
 type APIKeyConfig struct {
 	// API keys are stored separately in the api_keys table
-	// This config is just a marker that API key auth is enabled
+
+	// RedirectURL is where browsers without a valid API key are sent ("" = 401)
+	RedirectURL string
 }
 
 // OIDCConfig holds OIDC auth configuration
@@ -48,6 +52,14 @@ type OIDCConfig struct {
 	RequiredClaims map[string]string
 }
 
+// WebhookConfig holds authorization webhook configuration
+type WebhookConfig struct {
+	URL string
+
+	// Headers are the request headers forwarded to the webhook (nil = the default set)
+	Headers []string
+}
+
 // EffectivePolicy represents the resolved authentication policy
 // This is what the middleware actually enforces
 type EffectivePolicy struct {
@@ -72,6 +84,9 @@ type EffectivePolicy struct {
 
 	// OIDC holds OIDC auth configuration (if Type == AuthTypeOIDC)
 	OIDC *OIDCConfig
+
+	// Webhook holds authorization webhook configuration (if Type == AuthTypeWebhook)
+	Webhook *WebhookConfig
 }
 
 // IsNone returns true if no authentication is required
@@ -94,6 +109,11 @@ func (p *EffectivePolicy) IsOIDC() bool {
 	return p != nil && p.Type == AuthTypeOIDC
 }
 
+// IsWebhook returns true if an authorization webhook decides
+func (p *EffectivePolicy) IsWebhook() bool {
+	return p != nil && p.Type == AuthTypeWebhook
+}
+
 // HasAPIKeyAddOn returns true if API key can be used as add-on auth
 func (p *EffectivePolicy) HasAPIKeyAddOn() bool {
 	return p != nil && p.APIKeyEnabled && (p.Type == AuthTypeBasic || p.Type == AuthTypeOIDC)
@@ -131,6 +151,12 @@ type AuthResult struct {
 	// SessionID is the session ID if authenticated via OIDC
 	SessionID string
 
+	// Method is the auth type that authenticated the request (basic, api_key, oidc or webhook)
+	Method string
+
+	// Groups are the user's identity provider groups (OIDC sessions only)
+	Groups []string
+
 	// Error is the error message if authentication failed
 	Error string
 
@@ -170,6 +196,16 @@ func SuccessWithSession(sessionID, userEmail string) *AuthResult {
 	}
 }
 
+// SuccessFromSession returns a successful auth result for a Basic or OIDC session,
+// including the groups stored in its claims
+func SuccessFromSession(session *db.AuthSession) *AuthResult {
+	result := SuccessWithSession(session.ID, session.UserEmail)
+	if groups := session.UserClaims["groups"]; groups != "" {
+		result.Groups = strings.Split(groups, ",")
+	}
+	return result
+}
+
 // Failure returns a failed auth result
 func Failure(err string) *AuthResult {
 	return &AuthResult{
@@ -1,6 +1,11 @@
 package protocol
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+)
 
 // Message types for WebSocket communication between client and server
 const (
@@ -10,6 +15,11 @@ const (
 	TypeHTTPResponse     = "http_response"
 	TypePing             = "ping"
 	TypePong             = "pong"
+	TypeShutdown         = "shutdown"
+	TypeCancel           = "cancel"
+	TypeRequestAck       = "request_ack"
+	TypeFragment         = "fragment"
+	TypeHealth           = "health"
 )
 
 // Message is the base wrapper for all WebSocket messages
@@ -29,15 +39,84 @@ type RegisterRequest struct {
 	Subdomain string `json:"subdomain"`
 	Secret    string `json:"secret,omitempty"` // Deprecated: use Token instead
 	Token     string `json:"token,omitempty"`  // Authentication token (account token or API key)
-	AppID     string `json:"appId,omitempty"`  // App ID when using app-specific API key
+	AppID     string `json:"appId,omitempty"`  // Register for this application; its subdomain and organization apply
+
+	// SubdomainPrefix asks for a generated subdomain starting with this prefix
+	// when Subdomain is empty, e.g. "feature-" for feature-3f9a
+	SubdomainPrefix string `json:"subdomain_prefix,omitempty"`
+
+	// ReconnectToken from an earlier registration resumes its subdomain,
+	// replacing the previous connection if the server still holds it
+	ReconnectToken string `json:"reconnect_token,omitempty"`
+
+	// Degraded registers while the local service is not accepting connections
+	// yet. The server answers visitors with 503 until a HealthStatus reports it healthy.
+	Degraded bool `json:"degraded,omitempty"`
+
+	// LocalTarget is the local service the client forwards to. Clients that
+	// predate it leave it out; servers may restrict which targets they accept.
+	LocalTarget *LocalTarget `json:"local_target,omitempty"`
+}
+
+// LocalTarget is the local service a client forwards requests to
+type LocalTarget struct {
+	Address string `json:"address"`        // Host name, IP address or unix:/path/to.sock
+	Port    int    `json:"port,omitempty"` // Unused for Unix sockets
+	HTTPS   bool   `json:"https,omitempty"`
 }
 
+// String returns the target as a URL, e.g. http://localhost:3000
+func (t LocalTarget) String() string {
+	if strings.HasPrefix(t.Address, "unix:") {
+		return t.Address
+	}
+	scheme := "http"
+	if t.HTTPS {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(t.Address, strconv.Itoa(t.Port))
+}
+
+// RegisterCode tells clients why a registration was rejected. Error carries the
+// human-readable message; clients decide on the code, e.g. whether to retry.
+type RegisterCode string
+
+const (
+	RegisterCodeAuthRequired     RegisterCode = "auth_required"      // No token or secret given
+	RegisterCodeInvalidToken     RegisterCode = "invalid_token"      // Unknown token, API key or secret
+	RegisterCodeTokenExpired     RegisterCode = "token_expired"      // The token or API key has expired
+	RegisterCodeIPNotWhitelisted RegisterCode = "ip_not_whitelisted" // The client's IP is not whitelisted
+	RegisterCodeAppNotFound      RegisterCode = "app_not_found"      // Unknown application, or one the credentials have no rights to
+	RegisterCodeAppSubdomain     RegisterCode = "app_subdomain"      // The subdomain asked for is not the application's
+	RegisterCodeAppReleased      RegisterCode = "app_released"       // The application's subdomain was released after long inactivity
+	RegisterCodeInvalidSubdomain RegisterCode = "invalid_subdomain"  // The subdomain or prefix breaks the subdomain policy
+	RegisterCodeSubdomainTaken   RegisterCode = "subdomain_taken"    // See Suggestions for free alternatives
+	RegisterCodeNoFreeSubdomain  RegisterCode = "no_free_subdomain"  // No free subdomain could be generated
+	RegisterCodeQuotaExceeded    RegisterCode = "quota_exceeded"     // A quota of the organization's plan is used up
+	RegisterCodeLocalTarget      RegisterCode = "local_target"       // The server does not allow forwarding to the local target
+	RegisterCodeInternal         RegisterCode = "internal_error"     // A server-side failure; registering again may succeed
+	RegisterCodeInvalidRequest   RegisterCode = "invalid_request"    // The registration request is malformed, e.g. TCP forwards without a port
+)
+
 // RegisterResponse is sent by the server to confirm or reject registration
 type RegisterResponse struct {
-	Success   bool   `json:"success"`
-	Subdomain string `json:"subdomain,omitempty"`
-	URL       string `json:"url,omitempty"`
-	Error     string `json:"error,omitempty"`
+	Success     bool         `json:"success"`
+	Subdomain   string       `json:"subdomain,omitempty"`
+	URL         string       `json:"url,omitempty"`
+	Error       string       `json:"error,omitempty"`
+	Code        RegisterCode `json:"code,omitempty"`        // Set when Success is false
+	Suggestions []string     `json:"suggestions,omitempty"` // Available alternatives when the subdomain is taken
+
+	// MaxMessageBytes is the largest WebSocket message the server accepts; larger
+	// messages must be split with FragmentMessage. Zero means no advertised limit.
+	MaxMessageBytes int `json:"max_message_bytes,omitempty"`
+
+	// ConnectionID identifies this tunnel connection. ReconnectToken lets the
+	// client resume the subdomain after a dropped connection; it is only valid
+	// for the same credentials and expires after ReconnectTokenTTL seconds.
+	ConnectionID      string `json:"connection_id,omitempty"`
+	ReconnectToken    string `json:"reconnect_token,omitempty"`
+	ReconnectTokenTTL int    `json:"reconnect_token_ttl,omitempty"`
 }
 
 // HTTPRequest represents an incoming HTTP request to be forwarded
@@ -56,3 +135,62 @@ type HTTPResponse struct {
 	Headers    map[string]string `json:"headers"`
 	Body       []byte            `json:"body,omitempty"`
 }
+
+// CancelRequest is sent by the server when the visitor disconnects before the response arrives
+type CancelRequest struct {
+	ID string `json:"id"`
+}
+
+// RequestAck is sent by the client as soon as it receives a request, before forwarding it
+// to the local service, so the server can tell a slow backend from an unresponsive client
+type RequestAck struct {
+	ID string `json:"id"`
+}
+
+// HealthStatus is sent by a client that registered degraded when its local service's health changes
+type HealthStatus struct {
+	Healthy bool `json:"healthy"`
+}
+
+// ShutdownNotice is sent by the server before it shuts down so clients can back off before reconnecting
+type ShutdownNotice struct {
+	Message        string `json:"message,omitempty"`
+	ReconnectDelay int    `json:"reconnect_delay,omitempty"` // Seconds to wait before reconnecting
+}
+
+// Fragment carries part of a message that is larger than the receiver's
+// maximum message size. Fragments of one message are sent back to back; the
+// receiver concatenates Data until Final and handles the result as one message.
+type Fragment struct {
+	Data  []byte `json:"data"`
+	Final bool   `json:"final,omitempty"`
+}
+
+// fragmentOverhead is room left in each fragment message for the JSON envelope
+const fragmentOverhead = 128
+
+// FragmentMessage splits an encoded message into fragment messages that each
+// fit in maxBytes. Messages that already fit, or a maxBytes too small to hold
+// a fragment, are returned unchanged as the only element.
+func FragmentMessage(data []byte, maxBytes int) [][]byte {
+	if maxBytes <= 0 || len(data) <= maxBytes {
+		return [][]byte{data}
+	}
+
+	// Data is base64-encoded, which grows it by 4/3
+	chunkSize := (maxBytes - fragmentOverhead) / 4 * 3
+	if chunkSize <= 0 {
+		return [][]byte{data}
+	}
+
+	var parts [][]byte
+	for start := 0; start < len(data); start += chunkSize {
+		end := min(start+chunkSize, len(data))
+		part, _ := json.Marshal(Message{
+			Type:    TypeFragment,
+			Payload: Fragment{Data: data[start:end], Final: end == len(data)},
+		})
+		parts = append(parts, part)
+	}
+	return parts
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// maxBulkReassignAccounts bounds the accounts moved by one bulk reassign request
+const maxBulkReassignAccounts = 500
+
+// Per-account outcomes of a bulk reassign
+const (
+	reassignMoved     = "moved"
+	reassignUnchanged = "unchanged" // Already in the target organization
+	reassignNotFound  = "not_found"
+)
+
+// accountReassignResult is the outcome of moving one account
+type accountReassignResult struct {
+	AccountID     string `json:"accountId"`
+	Username      string `json:"username,omitempty"`
+	Status        string `json:"status"`
+	PreviousOrgID string `json:"previousOrgId,omitempty"`
+}
+
+// handleBulkReassignAccounts moves accounts to an organization in one
+// transaction. Unknown accounts are reported and skipped; moved accounts lose
+// their org admin status.
+func (s *Server) handleBulkReassignAccounts(w http.ResponseWriter, r *http.Request, adminUsername string) {
+	if !validateJSONContentType(w, r) {
+		return
+	}
+	limitRequestBody(r)
+
+	var req struct {
+		AccountIDs []string `json:"accountIds"`
+		OrgID      string   `json:"orgId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "Invalid request body")
+		return
+	}
+	if req.OrgID == "" {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "orgId is required")
+		return
+	}
+	if len(req.AccountIDs) == 0 {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "accountIds is required")
+		return
+	}
+	if len(req.AccountIDs) > maxBulkReassignAccounts {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, fmt.Sprintf("At most %d accounts can be moved at once", maxBulkReassignAccounts))
+		return
+	}
+
+	org, err := s.db.GetOrganizationByID(req.OrgID)
+	if err != nil {
+		log.Printf("Failed to get organization: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+	if org == nil {
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Organization not found")
+		return
+	}
+
+	results := make([]accountReassignResult, 0, len(req.AccountIDs))
+	var moveIDs, moved []string
+	seen := make(map[string]bool)
+	for _, id := range req.AccountIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		account, err := s.db.GetAccountByID(id)
+		if err != nil {
+			log.Printf("Failed to get account: %v", err)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+			return
+		}
+		result := accountReassignResult{AccountID: id, Status: reassignNotFound}
+		if account != nil {
+			result.Username = account.Username
+			result.PreviousOrgID = account.OrgID
+			result.Status = reassignUnchanged
+			if account.OrgID != req.OrgID {
+				result.Status = reassignMoved
+				moveIDs = append(moveIDs, id)
+				moved = append(moved, account.Username)
+			}
+		}
+		results = append(results, result)
+	}
+
+	if len(moveIDs) > 0 {
+		if err := s.db.MoveAccountsToOrganization(moveIDs, req.OrgID); err != nil {
+			log.Printf("Failed to move accounts: %v", err)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+			return
+		}
+
+		log.Printf("%d accounts moved to organization %s by admin %s", len(moveIDs), org.Name, adminUsername)
+		target := fmt.Sprintf("%d accounts to %s: %s", len(moved), org.Name, strings.Join(moved, ", "))
+		if err := s.db.LogAdminAction(&org.ID, db.AuditTypeAccountsReassigned, auth.GetClientIP(r), adminUsername, target); err != nil {
+			log.Printf("Failed to audit account reassignment: %v", err)
+		}
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"orgId":   org.ID,
+		"orgName": org.Name,
+		"moved":   len(moveIDs),
+		"results": results,
+	})
+}
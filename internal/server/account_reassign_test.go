@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestBulkReassignAccounts(t *testing.T) {
+	database := newTestDB(t)
+
+	acme, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	globex, err := database.CreateOrganization("globex")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	alice, err := database.CreateOrgAccountWithOrgAdmin("alice", auth.HashToken("alice"), "", acme.ID, true, nil, false)
+	if err != nil {
+		t.Fatalf("CreateOrgAccountWithOrgAdmin() error: %v", err)
+	}
+	bob, err := database.CreateOrgAccount("bob", auth.HashToken("bob"), "", globex.ID)
+	if err != nil {
+		t.Fatalf("CreateOrgAccount() error: %v", err)
+	}
+	aliceToken, err := auth.GenerateJWTWithOrg(alice.ID, alice.Username, false, acme.ID)
+	if err != nil {
+		t.Fatalf("GenerateJWTWithOrg() error: %v", err)
+	}
+
+	s := newTestServer(database)
+	reassign := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/admin/accounts/bulk-reassign", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.handleBulkReassignAccounts(w, r, "root")
+		return w
+	}
+
+	if w := reassign(`{"accountIds":["` + alice.ID + `"],"orgId":"missing"}`); w.Code != http.StatusNotFound {
+		t.Errorf("unknown org: status %d, want 404", w.Code)
+	}
+	if w := reassign(`{"accountIds":[],"orgId":"` + globex.ID + `"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("no accounts: status %d, want 400", w.Code)
+	}
+
+	w := reassign(`{"accountIds":["` + alice.ID + `","` + bob.ID + `","missing","` + alice.ID + `"],"orgId":"` + globex.ID + `"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("bulk reassign: status %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Moved   int                     `json:"moved"`
+		Results []accountReassignResult `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	want := []accountReassignResult{
+		{AccountID: alice.ID, Username: "alice", Status: reassignMoved, PreviousOrgID: acme.ID},
+		{AccountID: bob.ID, Username: "bob", Status: reassignUnchanged, PreviousOrgID: globex.ID},
+		{AccountID: "missing", Status: reassignNotFound},
+	}
+	if resp.Moved != 1 || !reflect.DeepEqual(resp.Results, want) {
+		t.Errorf("bulk reassign = %d moved, %+v, want 1 moved, %+v", resp.Moved, resp.Results, want)
+	}
+
+	// The org admin of acme is a plain member of globex
+	moved, err := database.GetAccountByID(alice.ID)
+	if err != nil || moved.OrgID != globex.ID || moved.IsOrgAdmin {
+		t.Errorf("alice after move = %+v, %v, want a member of globex without org admin", moved, err)
+	}
+
+	// Dashboard tokens for the old organization stop working
+	r := httptest.NewRequest(http.MethodGet, "/org/me", nil)
+	r.Header.Set("Authorization", "Bearer "+aliceToken)
+	if orgCtx, err := s.authenticateOrgAccount(r); err != nil || orgCtx != nil {
+		t.Errorf("old org token = %+v, %v, want rejected", orgCtx, err)
+	}
+
+	audit, err := database.GetAuditEvents(&globex.ID, nil, 10, 0)
+	if err != nil || len(audit) != 1 || audit[0].AuthType != db.AuditTypeAccountsReassigned || audit[0].Actor != "root" {
+		t.Errorf("audit = %+v, %v, want one accounts_reassigned entry by root", audit, err)
+	}
+}
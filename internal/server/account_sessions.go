@@ -0,0 +1,213 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+	"github.com/niekvdm/digit-link/internal/tunnel"
+)
+
+// AccountTunnel is a live tunnel connected with an account's credentials
+type AccountTunnel struct {
+	Subdomains  []string  `json:"subdomains"`
+	Transport   string    `json:"transport"` // "websocket" or "tcp"
+	ConnectedAt time.Time `json:"connectedAt"`
+}
+
+// accountTunnels returns the live tunnels of an account. A TCP client that
+// forwards several subdomains over one session is listed once.
+func (s *Server) accountTunnels(accountID string) []AccountTunnel {
+	tunnels := []AccountTunnel{}
+
+	s.mu.RLock()
+	for subdomain, t := range s.tunnels {
+		if t.AccountID == accountID {
+			tunnels = append(tunnels, AccountTunnel{
+				Subdomains:  []string{subdomain},
+				Transport:   "websocket",
+				ConnectedAt: t.CreatedAt,
+			})
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, session := range s.accountSessions(accountID) {
+		tunnels = append(tunnels, AccountTunnel{
+			Subdomains:  session.GetSubdomains(),
+			Transport:   "tcp",
+			ConnectedAt: session.CreatedAt(),
+		})
+	}
+	return tunnels
+}
+
+// accountSessions returns the TCP tunnel sessions of an account
+func (s *Server) accountSessions(accountID string) []*tunnel.Session {
+	if s.tunnelListener == nil {
+		return nil
+	}
+
+	tl := s.tunnelListener
+	tl.mu.RLock()
+	defer tl.mu.RUnlock()
+
+	seen := make(map[*tunnel.Session]bool)
+	var sessions []*tunnel.Session
+	for _, session := range tl.sessions {
+		if seen[session] {
+			continue
+		}
+		seen[session] = true
+		if id, _, _ := session.GetAccountInfo(); id == accountID {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
+}
+
+// closeAccountTunnels disconnects all live tunnels of an account and returns
+// how many were closed. Their usual cleanup runs when the connections end.
+func (s *Server) closeAccountTunnels(accountID string) int {
+	s.mu.RLock()
+	var wsTunnels []*Tunnel
+	for _, t := range s.tunnels {
+		if t.AccountID == accountID {
+			wsTunnels = append(wsTunnels, t)
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, t := range wsTunnels {
+		t.Close()
+	}
+	sessions := s.accountSessions(accountID)
+	for _, session := range sessions {
+		session.Close()
+	}
+	return len(wsTunnels) + len(sessions)
+}
+
+// dashboardSessionRevoked reports whether a dashboard JWT was issued before the
+// account's sessions were last revoked. JWTs cannot be recalled, so they are
+// checked against the revocation time instead. JWTs of tracked login sessions
+// are also revoked once their session was ended by the org's session limit.
+func (s *Server) dashboardSessionRevoked(claims *auth.JWTClaims) (bool, error) {
+	if claims.ID != "" {
+		active, err := s.db.IsLoginSessionActive(claims.ID)
+		if err != nil {
+			return false, err
+		}
+		if !active {
+			return true, nil
+		}
+	}
+	revokedAt, err := s.db.GetAccountSessionsRevokedAt(claims.AccountID)
+	if err != nil || revokedAt == nil {
+		return false, err
+	}
+	return claims.IssuedAt == nil || !claims.IssuedAt.After(*revokedAt), nil
+}
+
+// handleListAccountSessions lists everything that can act as an account: its
+// tokens, live tunnels and when its dashboard sessions were last revoked
+func (s *Server) handleListAccountSessions(w http.ResponseWriter, r *http.Request, accountID string) {
+	account, err := s.db.GetAccountByID(accountID)
+	if err != nil {
+		log.Printf("Failed to get account: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if account == nil {
+		jsonError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+
+	tokens, err := s.db.ListAccountTokens(accountID)
+	if err != nil {
+		log.Printf("Failed to list account tokens: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	revokedAt, err := s.db.GetAccountSessionsRevokedAt(accountID)
+	if err != nil {
+		log.Printf("Failed to get account sessions: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	tokenList := make([]map[string]interface{}, len(tokens))
+	for i, t := range tokens {
+		tokenList[i] = map[string]interface{}{
+			"id":        t.ID,
+			"name":      t.Name,
+			"createdAt": t.CreatedAt,
+			"lastUsed":  t.LastUsed,
+			"expiresAt": t.ExpiresAt,
+			"expired":   t.IsExpired(),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tokens":                     tokenList,
+		"tunnels":                    s.accountTunnels(accountID),
+		"dashboardSessionsRevokedAt": revokedAt,
+	})
+}
+
+// handleRevokeAccountSessions revokes everything that can act as an account:
+// its tokens are deleted, its live tunnels disconnected and its dashboard
+// sessions invalidated. The revocation is written to the audit log and
+// published as an event.
+func (s *Server) handleRevokeAccountSessions(w http.ResponseWriter, r *http.Request, accountID, adminUsername string) {
+	account, err := s.db.GetAccountByID(accountID)
+	if err != nil {
+		log.Printf("Failed to get account: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if account == nil {
+		jsonError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+
+	// Revoke credentials first so disconnected tunnels cannot reconnect with them
+	tokensRevoked, revokedAt, err := s.db.RevokeAccountSessions(accountID)
+	if err != nil {
+		log.Printf("Failed to revoke account sessions: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	tunnelsClosed := s.closeAccountTunnels(accountID)
+
+	log.Printf("Sessions revoked for account: %s (%s) by admin %s: %d tokens, %d tunnels",
+		accountID, account.Username, adminUsername, tokensRevoked, tunnelsClosed)
+
+	var orgID *string
+	if account.OrgID != "" {
+		orgID = &account.OrgID
+	}
+	clientIP := auth.GetClientIP(r)
+	if err := s.db.LogAdminAction(orgID, db.AuditTypeSessionsRevoked, clientIP, adminUsername, account.Username); err != nil {
+		log.Printf("Failed to audit session revocation: %v", err)
+	}
+	s.publishEvent(Event{
+		Type:      EventAccountSessionsRevoked,
+		OrgID:     account.OrgID,
+		AccountID: account.ID,
+		ClientIP:  clientIP,
+		Reason:    "Sessions revoked by admin " + adminUsername,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"tokensRevoked": tokensRevoked,
+		"tunnelsClosed": tunnelsClosed,
+		"revokedAt":     revokedAt,
+	})
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestRevokeAccountSessions(t *testing.T) {
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	member, err := database.CreateOrgAccount("member", auth.HashToken("member"), "", org.ID)
+	if err != nil {
+		t.Fatalf("CreateOrgAccount() error: %v", err)
+	}
+	if _, err := database.CreateAccountToken(member.ID, "ci", auth.HashToken("ci"), nil); err != nil {
+		t.Fatalf("CreateAccountToken() error: %v", err)
+	}
+	jwtToken, err := auth.GenerateJWTWithOrg(member.ID, member.Username, false, org.ID)
+	if err != nil {
+		t.Fatalf("GenerateJWTWithOrg() error: %v", err)
+	}
+
+	s := newTestServer(database)
+	events, unsubscribe := s.events.Subscribe(EventFilter{OrgID: org.ID, AccountID: member.ID})
+	defer unsubscribe()
+
+	dashboardRequest := func() *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/org/me", nil)
+		r.Header.Set("Authorization", "Bearer "+jwtToken)
+		return r
+	}
+	if orgCtx, err := s.authenticateOrgAccount(dashboardRequest()); err != nil || orgCtx == nil {
+		t.Fatalf("authenticateOrgAccount() before revocation = %v, %v, want the account", orgCtx, err)
+	}
+
+	w := httptest.NewRecorder()
+	s.handleListAccountSessions(w, httptest.NewRequest(http.MethodGet, "/admin/accounts/"+member.ID+"/sessions", nil), member.ID)
+	var listed struct {
+		Tokens                     []map[string]interface{} `json:"tokens"`
+		DashboardSessionsRevokedAt *time.Time               `json:"dashboardSessionsRevokedAt"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&listed); err != nil {
+		t.Fatalf("decode sessions: %v", err)
+	}
+	if len(listed.Tokens) != 2 || listed.DashboardSessionsRevokedAt != nil {
+		t.Fatalf("sessions = %+v, want 2 tokens and no revocation", listed)
+	}
+
+	w = httptest.NewRecorder()
+	s.handleRevokeAccountSessions(w, httptest.NewRequest(http.MethodDelete, "/admin/accounts/"+member.ID+"/sessions", nil), member.ID, "root")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	var revoked struct {
+		TokensRevoked int       `json:"tokensRevoked"`
+		RevokedAt     time.Time `json:"revokedAt"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&revoked); err != nil {
+		t.Fatalf("decode revoke response: %v", err)
+	}
+	if revoked.TokensRevoked != 2 {
+		t.Errorf("tokensRevoked = %d, want 2", revoked.TokensRevoked)
+	}
+
+	for _, token := range []string{"member", "ci"} {
+		if account, _ := database.GetAccountByTokenHash(auth.HashToken(token)); account != nil {
+			t.Errorf("token %q still authenticates after revocation", token)
+		}
+	}
+	if orgCtx, _ := s.authenticateOrgAccount(dashboardRequest()); orgCtx != nil {
+		t.Error("dashboard JWT still accepted after revocation")
+	}
+
+	// A login after the revocation gets a working session again
+	claims := &auth.JWTClaims{AccountID: member.ID}
+	claims.IssuedAt = jwt.NewNumericDate(revoked.RevokedAt.Add(time.Second))
+	if stale, err := s.dashboardSessionRevoked(claims); err != nil || stale {
+		t.Errorf("dashboardSessionRevoked() for a later login = %v, %v, want false", stale, err)
+	}
+
+	audit, err := database.GetAuditEvents(&org.ID, nil, 10, 0)
+	if err != nil {
+		t.Fatalf("GetAuditEvents() error: %v", err)
+	}
+	if len(audit) != 1 || audit[0].AuthType != db.AuditTypeSessionsRevoked || audit[0].Actor != "root" || audit[0].UserIdentity != "member" {
+		t.Errorf("audit events = %+v, want one sessions_revoked by root on member", audit)
+	}
+
+	select {
+	case e := <-events:
+		if e.Type != EventAccountSessionsRevoked || !strings.Contains(e.Reason, "root") {
+			t.Errorf("event = %+v, want account.sessions_revoked naming the admin", e)
+		}
+	default:
+		t.Error("no event published for the account owner")
+	}
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// maxAccountTokenNameLength limits the length of a token name
+const maxAccountTokenNameLength = 64
+
+// ============================================
+// Admin Account Token Handlers
+// ============================================
+
+// handleListAccountTokens returns all tokens of an account
+func (s *Server) handleListAccountTokens(w http.ResponseWriter, r *http.Request, accountID string) {
+	account, err := s.db.GetAccountByID(accountID)
+	if err != nil {
+		log.Printf("Failed to get account: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if account == nil {
+		jsonError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+
+	s.writeAccountTokens(w, accountID)
+}
+
+// handleCreateAccountToken adds a named token to an account
+func (s *Server) handleCreateAccountToken(w http.ResponseWriter, r *http.Request, accountID string) {
+	account, err := s.db.GetAccountByID(accountID)
+	if err != nil {
+		log.Printf("Failed to get account: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if account == nil {
+		jsonError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+
+	token, created := s.createAccountToken(w, r, accountID)
+	if created == nil {
+		return
+	}
+
+	log.Printf("Token %q created for account: %s", created.Name, accountID)
+	writeCreatedAccountToken(w, token, created)
+}
+
+// handleRevokeAccountToken revokes one token of an account
+func (s *Server) handleRevokeAccountToken(w http.ResponseWriter, r *http.Request, accountID, tokenID string) {
+	if !s.revokeAccountToken(w, accountID, tokenID) {
+		return
+	}
+
+	log.Printf("Token %s revoked for account: %s", tokenID, accountID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+	})
+}
+
+// ============================================
+// Org Account Token Handlers
+// ============================================
+
+// handleOrgListAccountTokens returns all tokens of an org account (org admin only)
+func (s *Server) handleOrgListAccountTokens(w http.ResponseWriter, r *http.Request, orgCtx *OrgContext, accountID string) {
+	if !s.requireOrgAdmin(w, orgCtx) {
+		return
+	}
+
+	account, err := s.verifyOrgAccountOwnership(orgCtx, accountID)
+	if err != nil {
+		log.Printf("Failed to get account: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if account == nil {
+		jsonError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+
+	s.writeAccountTokens(w, accountID)
+}
+
+// handleOrgCreateAccountToken adds a named token to an org account (org admin only)
+func (s *Server) handleOrgCreateAccountToken(w http.ResponseWriter, r *http.Request, orgCtx *OrgContext, accountID string) {
+	if !s.requireOrgAdmin(w, orgCtx) {
+		return
+	}
+
+	account, err := s.verifyOrgAccountOwnership(orgCtx, accountID)
+	if err != nil {
+		log.Printf("Failed to get account: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if account == nil {
+		jsonError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+
+	token, created := s.createAccountToken(w, r, accountID)
+	if created == nil {
+		return
+	}
+
+	log.Printf("Token %q created for org account %s by %s", created.Name, accountID, orgCtx.Username)
+	writeCreatedAccountToken(w, token, created)
+}
+
+// handleOrgRevokeAccountToken revokes one token of an org account (org admin only)
+func (s *Server) handleOrgRevokeAccountToken(w http.ResponseWriter, r *http.Request, orgCtx *OrgContext, accountID, tokenID string) {
+	if !s.requireOrgAdmin(w, orgCtx) {
+		return
+	}
+
+	account, err := s.verifyOrgAccountOwnership(orgCtx, accountID)
+	if err != nil {
+		log.Printf("Failed to get account: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if account == nil {
+		jsonError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+
+	if !s.revokeAccountToken(w, accountID, tokenID) {
+		return
+	}
+
+	log.Printf("Token %s revoked for org account %s by %s", tokenID, accountID, orgCtx.Username)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+	})
+}
+
+// ============================================
+// Shared Helpers
+// ============================================
+
+// writeAccountTokens writes the token list of an account
+func (s *Server) writeAccountTokens(w http.ResponseWriter, accountID string) {
+	tokens, err := s.db.ListAccountTokens(accountID)
+	if err != nil {
+		log.Printf("Failed to list account tokens: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	result := make([]map[string]interface{}, len(tokens))
+	for i, t := range tokens {
+		result[i] = map[string]interface{}{
+			"id":           t.ID,
+			"name":         t.Name,
+			"createdAt":    t.CreatedAt,
+			"lastUsed":     t.LastUsed,
+			"expiresAt":    t.ExpiresAt,
+			"expired":      t.IsExpired(),
+			"expiringSoon": t.IsExpiringSoon(tokenExpiryWarningWindow),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tokens": result,
+	})
+}
+
+// createAccountToken decodes a {"name", "expiresIn"} request and stores a new token.
+// It writes the error response and returns nil on failure.
+func (s *Server) createAccountToken(w http.ResponseWriter, r *http.Request, accountID string) (string, *db.AccountToken) {
+	var req struct {
+		Name      string `json:"name"`
+		ExpiresIn *int   `json:"expiresIn,omitempty"` // days
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return "", nil
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		jsonError(w, "Token name is required", http.StatusBadRequest)
+		return "", nil
+	}
+	if len(req.Name) > maxAccountTokenNameLength {
+		jsonError(w, "Token name is too long", http.StatusBadRequest)
+		return "", nil
+	}
+
+	exists, err := s.db.AccountTokenNameExists(accountID, req.Name)
+	if err != nil {
+		log.Printf("Failed to check token name: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return "", nil
+	}
+	if exists {
+		jsonError(w, "Token name already exists", http.StatusConflict)
+		return "", nil
+	}
+
+	token, tokenHash, err := auth.GenerateToken()
+	if err != nil {
+		log.Printf("Failed to generate token: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return "", nil
+	}
+
+	created, err := s.db.CreateAccountToken(accountID, req.Name, tokenHash, tokenExpiresAtFromDays(req.ExpiresIn))
+	if err != nil {
+		log.Printf("Failed to create account token: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return "", nil
+	}
+
+	return token, created
+}
+
+// revokeAccountToken deletes a token after checking it belongs to the account.
+// It writes the error response and returns false on failure.
+func (s *Server) revokeAccountToken(w http.ResponseWriter, accountID, tokenID string) bool {
+	token, err := s.db.GetAccountToken(tokenID)
+	if err != nil {
+		log.Printf("Failed to get account token: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	if token == nil || token.AccountID != accountID {
+		jsonError(w, "Token not found", http.StatusNotFound)
+		return false
+	}
+
+	if err := s.db.DeleteAccountToken(accountID, tokenID); err != nil {
+		log.Printf("Failed to revoke account token: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+
+	return true
+}
+
+// writeCreatedAccountToken writes a newly created token, including the raw value shown only once
+func writeCreatedAccountToken(w http.ResponseWriter, token string, created *db.AccountToken) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"token":   token,
+		"tokenInfo": map[string]interface{}{
+			"id":        created.ID,
+			"name":      created.Name,
+			"createdAt": created.CreatedAt,
+			"expiresAt": created.ExpiresAt,
+		},
+	})
+}
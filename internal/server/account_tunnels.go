@@ -0,0 +1,154 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/niekvdm/digit-link/internal/db"
+	"github.com/niekvdm/digit-link/internal/tunnel"
+)
+
+// AccountTunnelSummary counts the live tunnels connected with one account's credentials
+type AccountTunnelSummary struct {
+	AccountID  string `json:"accountId"`
+	Username   string `json:"username,omitempty"`
+	OrgID      string `json:"orgId,omitempty"`
+	Tunnels    int    `json:"tunnels"`    // WebSocket tunnels plus TCP sessions
+	Subdomains int    `json:"subdomains"` // Subdomains served, counting every forward of a TCP session
+}
+
+// pageParams reads the limit (default 50, at most 100) and offset query parameters
+func pageParams(r *http.Request) (limit, offset int) {
+	query := r.URL.Query()
+	limit = 50
+	if v := query.Get("limit"); v != "" {
+		if l, err := strconv.Atoi(v); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+	if v := query.Get("offset"); v != "" {
+		if o, err := strconv.Atoi(v); err == nil && o >= 0 {
+			offset = o
+		}
+	}
+	return limit, offset
+}
+
+// tunnelsByAccount groups the live tunnels by the account that connected them,
+// most tunnels first. It also returns how many tunnels were connected without
+// an account (API keys or the legacy secret).
+func (s *Server) tunnelsByAccount() (summaries []*AccountTunnelSummary, unattributed int) {
+	byAccount := make(map[string]*AccountTunnelSummary)
+	add := func(accountID, orgID string, subdomains int) {
+		if accountID == "" {
+			unattributed++
+			return
+		}
+		summary := byAccount[accountID]
+		if summary == nil {
+			summary = &AccountTunnelSummary{AccountID: accountID, OrgID: orgID}
+			byAccount[accountID] = summary
+		}
+		summary.Tunnels++
+		summary.Subdomains += subdomains
+	}
+
+	s.mu.RLock()
+	for _, t := range s.tunnels {
+		add(t.AccountID, t.OrgID, 1)
+	}
+	s.mu.RUnlock()
+
+	if tl := s.tunnelListener; tl != nil {
+		tl.mu.RLock()
+		seen := make(map[*tunnel.Session]bool)
+		for _, session := range tl.sessions {
+			if seen[session] {
+				continue
+			}
+			seen[session] = true
+			accountID, orgID, _ := session.GetAccountInfo()
+			add(accountID, orgID, len(session.GetSubdomains()))
+		}
+		tl.mu.RUnlock()
+	}
+
+	summaries = make([]*AccountTunnelSummary, 0, len(byAccount))
+	for _, summary := range byAccount {
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Tunnels != summaries[j].Tunnels {
+			return summaries[i].Tunnels > summaries[j].Tunnels
+		}
+		return summaries[i].AccountID < summaries[j].AccountID
+	})
+	return summaries, unattributed
+}
+
+// handleListTunnelsByAccount summarizes the live tunnels per account, a page at a time
+func (s *Server) handleListTunnelsByAccount(w http.ResponseWriter, r *http.Request) {
+	limit, offset := pageParams(r)
+	summaries, unattributed := s.tunnelsByAccount()
+	total := len(summaries)
+
+	page := []*AccountTunnelSummary{}
+	if offset < total {
+		page = summaries[offset:min(offset+limit, total)]
+	}
+	for _, summary := range page {
+		if account, err := s.db.GetAccountByID(summary.AccountID); err == nil && account != nil {
+			summary.Username = account.Username
+		}
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"accounts":     page,
+		"unattributed": unattributed,
+		"total":        total,
+		"limit":        limit,
+		"offset":       offset,
+	})
+}
+
+// handleListAccountTunnels returns an account's live tunnels and a page of its
+// tunnel records, open and closed, newest first
+func (s *Server) handleListAccountTunnels(w http.ResponseWriter, r *http.Request, accountID string) {
+	account, err := s.db.GetAccountByID(accountID)
+	if err != nil {
+		log.Printf("Failed to get account: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+	if account == nil {
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Account not found")
+		return
+	}
+
+	limit, offset := pageParams(r)
+	records, err := s.db.ListRecentTunnelsForAccount(accountID, limit, offset)
+	if err != nil {
+		log.Printf("Failed to list account tunnels: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+	total, err := s.db.CountTunnelsForAccount(accountID)
+	if err != nil {
+		log.Printf("Failed to count account tunnels: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+	if records == nil {
+		records = []*db.TunnelRecord{}
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"active": s.accountTunnels(accountID),
+		"recent": records,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestTunnelsByAccount(t *testing.T) {
+	database := newTestDB(t)
+
+	org, _ := database.CreateOrganization("acme")
+	alice, err := database.CreateOrgAccount("alice", auth.HashToken("alice"), "", org.ID)
+	if err != nil {
+		t.Fatalf("CreateOrgAccount() error: %v", err)
+	}
+	bob, _ := database.CreateOrgAccount("bob", auth.HashToken("bob"), "", org.ID)
+	for _, subdomain := range []string{"one", "two", "three"} {
+		record, err := database.CreateTunnel(alice.ID, subdomain, "1.2.3.4")
+		if err != nil {
+			t.Fatalf("CreateTunnel() error: %v", err)
+		}
+		if subdomain == "one" {
+			database.CloseTunnel(record.ID)
+		}
+	}
+
+	s := newTestServer(database)
+	s.tunnels = map[string]*Tunnel{
+		"two":   {AccountID: alice.ID, OrgID: org.ID},
+		"three": {AccountID: alice.ID, OrgID: org.ID},
+		"bobs":  {AccountID: bob.ID, OrgID: org.ID},
+		"key":   {OrgID: org.ID},
+	}
+
+	w := httptest.NewRecorder()
+	s.handleListTunnelsByAccount(w, httptest.NewRequest(http.MethodGet, "/admin/tunnels/by-account?limit=1", nil))
+	var grouped struct {
+		Accounts     []AccountTunnelSummary `json:"accounts"`
+		Unattributed int                    `json:"unattributed"`
+		Total        int                    `json:"total"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&grouped); err != nil {
+		t.Fatalf("decode by-account: %v", err)
+	}
+	if grouped.Total != 2 || grouped.Unattributed != 1 || len(grouped.Accounts) != 1 {
+		t.Fatalf("by-account = %+v, want a page of 1 of 2 accounts and 1 unattributed tunnel", grouped)
+	}
+	if got := grouped.Accounts[0]; got.AccountID != alice.ID || got.Username != "alice" || got.Tunnels != 2 {
+		t.Errorf("first account = %+v, want alice with 2 tunnels", got)
+	}
+
+	w = httptest.NewRecorder()
+	s.handleListAccountTunnels(w, httptest.NewRequest(http.MethodGet, "/admin/accounts/"+alice.ID+"/tunnels?limit=2", nil), alice.ID)
+	var listed struct {
+		Active []AccountTunnel    `json:"active"`
+		Recent []*db.TunnelRecord `json:"recent"`
+		Total  int                `json:"total"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&listed); err != nil {
+		t.Fatalf("decode account tunnels: %v", err)
+	}
+	if len(listed.Active) != 2 || len(listed.Recent) != 2 || listed.Total != 3 {
+		t.Errorf("account tunnels = %d active, %d recent of %d, want 2, 2 of 3", len(listed.Active), len(listed.Recent), listed.Total)
+	}
+
+	w = httptest.NewRecorder()
+	s.handleListAccountTunnels(w, httptest.NewRequest(http.MethodGet, "/admin/accounts/missing/tunnels", nil), "missing")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown account: status %d, want 404", w.Code)
+	}
+}
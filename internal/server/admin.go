@@ -2,6 +2,7 @@ package server
 
 import (
 	"encoding/json"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
@@ -15,6 +16,12 @@ import (
 // maxRequestBodySize is the maximum allowed request body size (1MB)
 const maxRequestBodySize = 1 << 20
 
+// tokenExpiryWarningWindow flags account tokens expiring within this window in account responses
+const tokenExpiryWarningWindow = 7 * 24 * time.Hour
+
+// maxSearchResultsPerType caps the results returned per category by admin search
+const maxSearchResultsPerType = 20
+
 // jsonError writes a JSON error response
 func jsonError(w http.ResponseWriter, message string, code int) {
 	w.Header().Set("Content-Type", "application/json")
@@ -53,13 +60,25 @@ func (s *Server) handleAdmin(w http.ResponseWriter, r *http.Request) {
 	// Verify admin authentication
 	account, err := s.authenticateAdmin(r)
 	if err != nil || account == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Unauthorized")
 		return
 	}
 
 	// Route admin endpoints
 	path := strings.TrimPrefix(r.URL.Path, "/admin")
 
+	canWrite, err := s.adminCanWrite(r, account.ID, path)
+	if err != nil {
+		log.Printf("Failed to check admin role: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+	if !canWrite {
+		log.Printf("Read-only admin %s denied %s %s", account.Username, r.Method, r.URL.Path)
+		writeError(w, r, http.StatusForbidden, errCodeForbidden, "Read-only admins cannot make changes")
+		return
+	}
+
 	switch {
 	// Self-management endpoints (admin's own account)
 	case path == "/me" && r.Method == http.MethodGet:
@@ -73,11 +92,36 @@ func (s *Server) handleAdmin(w http.ResponseWriter, r *http.Request) {
 	case path == "/me/totp" && r.Method == http.MethodDelete:
 		s.handleAdminDisableMyTOTP(w, r, account)
 
+	// Live event stream (Server-Sent Events)
+	case path == "/events" && r.Method == http.MethodGet:
+		s.handleAdminEvents(w, r)
+
 	// Account management
 	case path == "/accounts" && r.Method == http.MethodGet:
 		s.handleListAccounts(w, r)
 	case path == "/accounts" && r.Method == http.MethodPost:
 		s.handleCreateAccount(w, r)
+	case path == "/accounts/bulk-reassign" && r.Method == http.MethodPost:
+		s.handleBulkReassignAccounts(w, r, account.Username)
+	case strings.HasPrefix(path, "/accounts/") && strings.HasSuffix(path, "/tokens") && r.Method == http.MethodGet:
+		accountID := strings.TrimSuffix(strings.TrimPrefix(path, "/accounts/"), "/tokens")
+		s.handleListAccountTokens(w, r, accountID)
+	case strings.HasPrefix(path, "/accounts/") && strings.HasSuffix(path, "/tokens") && r.Method == http.MethodPost:
+		accountID := strings.TrimSuffix(strings.TrimPrefix(path, "/accounts/"), "/tokens")
+		s.handleCreateAccountToken(w, r, accountID)
+	case strings.HasPrefix(path, "/accounts/") && strings.Contains(path, "/tokens/") && r.Method == http.MethodDelete:
+		// DELETE /accounts/:id/tokens/:tokenId
+		accountID, tokenID, _ := strings.Cut(strings.TrimPrefix(path, "/accounts/"), "/tokens/")
+		s.handleRevokeAccountToken(w, r, accountID, tokenID)
+	case strings.HasPrefix(path, "/accounts/") && strings.HasSuffix(path, "/tunnels") && r.Method == http.MethodGet:
+		accountID := strings.TrimSuffix(strings.TrimPrefix(path, "/accounts/"), "/tunnels")
+		s.handleListAccountTunnels(w, r, accountID)
+	case strings.HasPrefix(path, "/accounts/") && strings.HasSuffix(path, "/sessions") && r.Method == http.MethodGet:
+		accountID := strings.TrimSuffix(strings.TrimPrefix(path, "/accounts/"), "/sessions")
+		s.handleListAccountSessions(w, r, accountID)
+	case strings.HasPrefix(path, "/accounts/") && strings.HasSuffix(path, "/sessions") && r.Method == http.MethodDelete:
+		accountID := strings.TrimSuffix(strings.TrimPrefix(path, "/accounts/"), "/sessions")
+		s.handleRevokeAccountSessions(w, r, accountID, account.Username)
 	case strings.HasPrefix(path, "/accounts/") && strings.HasSuffix(path, "/hard") && r.Method == http.MethodDelete:
 		accountID := strings.TrimSuffix(strings.TrimPrefix(path, "/accounts/"), "/hard")
 		s.handleHardDeleteAccount(w, r, accountID)
@@ -99,9 +143,18 @@ func (s *Server) handleAdmin(w http.ResponseWriter, r *http.Request) {
 	case strings.HasPrefix(path, "/accounts/") && strings.HasSuffix(path, "/org-admin") && r.Method == http.MethodPut:
 		accountID := strings.TrimSuffix(strings.TrimPrefix(path, "/accounts/"), "/org-admin")
 		s.handleSetAccountOrgAdmin(w, r, accountID)
+	case strings.HasPrefix(path, "/accounts/") && strings.HasSuffix(path, "/admin-role") && r.Method == http.MethodPut:
+		accountID := strings.TrimSuffix(strings.TrimPrefix(path, "/accounts/"), "/admin-role")
+		s.handleSetAccountAdminRole(w, r, accountID, account.Username)
+	case strings.HasPrefix(path, "/accounts/") && strings.HasSuffix(path, "/whitelist-check") && r.Method == http.MethodGet:
+		accountID := strings.TrimSuffix(strings.TrimPrefix(path, "/accounts/"), "/whitelist-check")
+		s.handleAccountWhitelistCheck(w, r, accountID)
 	case strings.HasPrefix(path, "/accounts/") && strings.HasSuffix(path, "/totp") && r.Method == http.MethodDelete:
 		accountID := strings.TrimSuffix(strings.TrimPrefix(path, "/accounts/"), "/totp")
-		s.handleResetAccountTOTP(w, r, accountID)
+		s.handleResetAccountTOTP(w, r, accountID, account.Username)
+	case strings.HasPrefix(path, "/accounts/") && strings.HasSuffix(path, "/totp/reset-with-audit") && r.Method == http.MethodPost:
+		accountID := strings.TrimSuffix(strings.TrimPrefix(path, "/accounts/"), "/totp/reset-with-audit")
+		s.handleResetAccountTOTP(w, r, accountID, account.Username)
 	case strings.HasPrefix(path, "/accounts/") && r.Method == http.MethodGet:
 		accountID := strings.TrimPrefix(path, "/accounts/")
 		s.handleGetAccount(w, r, accountID)
@@ -127,6 +180,8 @@ func (s *Server) handleAdmin(w http.ResponseWriter, r *http.Request) {
 	// Tunnel management
 	case path == "/tunnels" && r.Method == http.MethodGet:
 		s.handleListTunnels(w, r)
+	case path == "/tunnels/by-account" && r.Method == http.MethodGet:
+		s.handleListTunnelsByAccount(w, r)
 
 	// Stats
 	case path == "/stats" && r.Method == http.MethodGet:
@@ -137,12 +192,23 @@ func (s *Server) handleAdmin(w http.ResponseWriter, r *http.Request) {
 		s.handleListOrganizations(w, r)
 	case path == "/organizations" && r.Method == http.MethodPost:
 		s.handleCreateOrganization(w, r)
+	case path == "/organizations/import" && r.Method == http.MethodPost:
+		s.handleImportOrganization(w, r)
+	case strings.HasPrefix(path, "/organizations/") && strings.HasSuffix(path, "/export") && r.Method == http.MethodGet:
+		orgID := strings.TrimSuffix(strings.TrimPrefix(path, "/organizations/"), "/export")
+		s.handleExportOrganization(w, r, orgID)
 	case strings.HasPrefix(path, "/organizations/") && strings.HasSuffix(path, "/policy") && r.Method == http.MethodGet:
 		orgID := strings.TrimSuffix(strings.TrimPrefix(path, "/organizations/"), "/policy")
 		s.handleGetOrgPolicy(w, r, orgID)
 	case strings.HasPrefix(path, "/organizations/") && strings.HasSuffix(path, "/policy") && r.Method == http.MethodPut:
 		orgID := strings.TrimSuffix(strings.TrimPrefix(path, "/organizations/"), "/policy")
 		s.handleSetOrgPolicy(w, r, orgID)
+	case strings.HasPrefix(path, "/organizations/") && strings.HasSuffix(path, "/features") && r.Method == http.MethodGet:
+		orgID := strings.TrimSuffix(strings.TrimPrefix(path, "/organizations/"), "/features")
+		s.handleGetOrgFeatureFlags(w, r, orgID)
+	case strings.HasPrefix(path, "/organizations/") && strings.HasSuffix(path, "/features") && r.Method == http.MethodPut:
+		orgID := strings.TrimSuffix(strings.TrimPrefix(path, "/organizations/"), "/features")
+		s.handleUpdateOrgFeatureFlags(w, r, orgID, account.Username)
 	case strings.HasPrefix(path, "/organizations/") && strings.HasSuffix(path, "/plan") && r.Method == http.MethodPut:
 		orgID := strings.TrimSuffix(strings.TrimPrefix(path, "/organizations/"), "/plan")
 		s.handleSetOrganizationPlan(w, r, orgID)
@@ -164,7 +230,7 @@ func (s *Server) handleAdmin(w http.ResponseWriter, r *http.Request) {
 		if !strings.Contains(orgID, "/") {
 			s.handleGetOrganization(w, r, orgID)
 		} else {
-			http.Error(w, "Not found", http.StatusNotFound)
+			writeError(w, r, http.StatusNotFound, errCodeNotFound, "Not found")
 		}
 
 	// Application management
@@ -172,12 +238,21 @@ func (s *Server) handleAdmin(w http.ResponseWriter, r *http.Request) {
 		s.handleListApplications(w, r)
 	case path == "/applications" && r.Method == http.MethodPost:
 		s.handleCreateApplication(w, r)
+	case strings.HasPrefix(path, "/applications/") && strings.HasSuffix(path, "/restore") && r.Method == http.MethodPost:
+		appID := strings.TrimSuffix(strings.TrimPrefix(path, "/applications/"), "/restore")
+		s.handleRestoreApplication(w, r, appID, account.Username)
 	case strings.HasPrefix(path, "/applications/") && strings.HasSuffix(path, "/stats") && r.Method == http.MethodGet:
 		appID := strings.TrimSuffix(strings.TrimPrefix(path, "/applications/"), "/stats")
 		s.handleGetApplicationStats(w, r, appID)
+	case strings.HasPrefix(path, "/applications/") && strings.HasSuffix(path, "/analytics") && r.Method == http.MethodGet:
+		appID := strings.TrimSuffix(strings.TrimPrefix(path, "/applications/"), "/analytics")
+		s.handleGetApplicationAnalytics(w, r, appID)
 	case strings.HasPrefix(path, "/applications/") && strings.HasSuffix(path, "/tunnels") && r.Method == http.MethodGet:
 		appID := strings.TrimSuffix(strings.TrimPrefix(path, "/applications/"), "/tunnels")
 		s.handleGetApplicationTunnels(w, r, appID)
+	case strings.HasPrefix(path, "/applications/") && strings.HasSuffix(path, "/whitelist-check") && r.Method == http.MethodGet:
+		appID := strings.TrimSuffix(strings.TrimPrefix(path, "/applications/"), "/whitelist-check")
+		s.handleApplicationWhitelistCheck(w, r, appID)
 	case strings.HasPrefix(path, "/applications/") && strings.HasSuffix(path, "/policy") && r.Method == http.MethodGet:
 		appID := strings.TrimSuffix(strings.TrimPrefix(path, "/applications/"), "/policy")
 		s.handleGetAppPolicy(w, r, appID)
@@ -208,6 +283,8 @@ func (s *Server) handleAdmin(w http.ResponseWriter, r *http.Request) {
 		s.handleListAPIKeys(w, r)
 	case path == "/api-keys" && r.Method == http.MethodPost:
 		s.handleCreateAPIKey(w, r)
+	case path == "/api-keys/introspect" && r.Method == http.MethodPost:
+		s.handleIntrospectAPIKey(w, r, account.ID)
 	case strings.HasPrefix(path, "/api-keys/") && r.Method == http.MethodDelete:
 		keyID := strings.TrimPrefix(path, "/api-keys/")
 		s.handleDeleteAPIKey(w, r, keyID)
@@ -237,8 +314,38 @@ func (s *Server) handleAdmin(w http.ResponseWriter, r *http.Request) {
 	case path == "/usage/summary" && r.Method == http.MethodGet:
 		s.handleUsageSummary(w, r)
 
+	// Metrics
+	case path == "/metrics/timeseries" && r.Method == http.MethodGet:
+		s.handleMetricsTimeseries(w, r)
+
+	// Search
+	case path == "/search" && r.Method == http.MethodGet:
+		s.handleAdminSearch(w, r)
+
+	// Server settings
+	case path == "/settings/rate-limit" && r.Method == http.MethodGet:
+		s.handleGetRateLimitSettings(w, r)
+	case path == "/settings/rate-limit" && r.Method == http.MethodPut:
+		s.handleUpdateRateLimitSettings(w, r, account.Username)
+	case path == "/settings" && r.Method == http.MethodGet:
+		s.handleListSettings(w, r)
+	case strings.HasPrefix(path, "/settings/") && r.Method == http.MethodGet:
+		s.handleGetSetting(w, r, strings.TrimPrefix(path, "/settings/"))
+	case strings.HasPrefix(path, "/settings/") && r.Method == http.MethodPut:
+		s.handleUpdateSetting(w, r, strings.TrimPrefix(path, "/settings/"), account.Username)
+
+	// Maintenance
+	case path == "/maintenance/orphans" && r.Method == http.MethodGet:
+		s.handleFindOrphans(w, r)
+	case path == "/maintenance/orphans" && r.Method == http.MethodDelete:
+		s.handlePurgeOrphans(w, r)
+	case path == "/maintenance/purge-expired-keys" && r.Method == http.MethodPost:
+		s.handlePurgeExpiredAPIKeys(w, r, account.Username)
+	case path == "/maintenance/recompute-usage" && r.Method == http.MethodPost:
+		s.handleRecomputeUsage(w, r, account.Username)
+
 	default:
-		http.Error(w, "Not found", http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Not found")
 	}
 }
 
@@ -274,6 +381,13 @@ func (s *Server) authenticateAdmin(r *http.Request) (*struct {
 		if !claims.IsAdmin {
 			return nil, nil
 		}
+		revoked, err := s.dashboardSessionRevoked(claims)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, nil
+		}
 		return &struct {
 			ID       string
 			Username string
@@ -291,7 +405,7 @@ func (s *Server) authenticateAdmin(r *http.Request) (*struct {
 	if err != nil {
 		return nil, err
 	}
-	if account == nil || !account.IsAdmin {
+	if account == nil || !account.IsAdmin || account.IsTokenExpired() {
 		return nil, nil
 	}
 
@@ -333,6 +447,7 @@ func (s *Server) handleAdminGetMe(w http.ResponseWriter, r *http.Request, admin
 			"id":          account.ID,
 			"username":    account.Username,
 			"isAdmin":     account.IsAdmin,
+			"adminRole":   account.EffectiveAdminRole(),
 			"totpEnabled": account.TOTPEnabled,
 			"createdAt":   account.CreatedAt,
 			"lastUsed":    account.LastUsed,
@@ -394,7 +509,7 @@ func (s *Server) handleAdminGetMyTOTPSetup(w http.ResponseWriter, r *http.Reques
 	IsAdmin  bool
 }) {
 	// Generate TOTP secret
-	totpKey, err := auth.GenerateTOTPSecret(admin.Username)
+	totpKey, err := s.generateTOTPSecret(admin.Username)
 	if err != nil {
 		log.Printf("Failed to generate TOTP secret: %v", err)
 		jsonError(w, "Failed to generate TOTP", http.StatusInternalServerError)
@@ -410,7 +525,7 @@ func (s *Server) handleAdminGetMyTOTPSetup(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Store the secret (not enabled until verified)
-	if err := s.db.UpdateAccountTOTP(admin.ID, encryptedSecret, false); err != nil {
+	if err := s.db.BeginAccountTOTPSetup(admin.ID, encryptedSecret); err != nil {
 		log.Printf("Failed to store TOTP secret: %v", err)
 		jsonError(w, "Failed to setup TOTP", http.StatusInternalServerError)
 		return
@@ -461,6 +576,15 @@ func (s *Server) handleAdminEnableMyTOTP(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
+	if expired, err := s.totpSetupExpired(account); err != nil {
+		log.Printf("Failed to check TOTP setup: %v", err)
+		jsonError(w, "Failed to verify TOTP", http.StatusInternalServerError)
+		return
+	} else if expired {
+		jsonError(w, "TOTP setup expired. Call GET /admin/me/totp/setup again", http.StatusBadRequest)
+		return
+	}
+
 	// Decrypt the TOTP secret
 	secret, err := auth.DecryptTOTPSecret(account.TOTPSecret)
 	if err != nil {
@@ -541,8 +665,9 @@ func (s *Server) handleAdminDisableMyTOTP(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Disable TOTP
-	if err := s.db.UpdateAccountTOTP(admin.ID, "", false); err != nil {
+	// Disable TOTP like a reset, so an admin gets the same re-enrollment grace
+	// period instead of password-only logins for good
+	if _, err := s.db.ResetAccountTOTP(admin.ID); err != nil {
 		log.Printf("Failed to disable TOTP: %v", err)
 		jsonError(w, "Failed to disable TOTP", http.StatusInternalServerError)
 		return
@@ -577,17 +702,21 @@ func (s *Server) handleListAccounts(w http.ResponseWriter, r *http.Request) {
 		}
 
 		result[i] = map[string]interface{}{
-			"id":          acc.ID,
-			"username":    acc.Username,
-			"isAdmin":     acc.IsAdmin,
-			"isOrgAdmin":  acc.IsOrgAdmin,
-			"totpEnabled": acc.TOTPEnabled,
-			"createdAt":   acc.CreatedAt,
-			"lastUsed":    acc.LastUsed,
-			"active":      acc.Active,
-			"orgId":       acc.OrgID,
-			"orgName":     orgName,
-			"hasPassword": acc.PasswordHash != "",
+			"id":                acc.ID,
+			"username":          acc.Username,
+			"isAdmin":           acc.IsAdmin,
+			"adminRole":         acc.EffectiveAdminRole(),
+			"isOrgAdmin":        acc.IsOrgAdmin,
+			"totpEnabled":       acc.TOTPEnabled,
+			"createdAt":         acc.CreatedAt,
+			"lastUsed":          acc.LastUsed,
+			"active":            acc.Active,
+			"tokenExpiresAt":    acc.TokenExpiresAt,
+			"tokenExpiringSoon": acc.IsTokenExpiringSoon(tokenExpiryWarningWindow),
+			"tokenExpired":      acc.IsTokenExpired(),
+			"orgId":             acc.OrgID,
+			"orgName":           orgName,
+			"hasPassword":       acc.PasswordHash != "",
 		}
 	}
 
@@ -605,10 +734,13 @@ func (s *Server) handleCreateAccount(w http.ResponseWriter, r *http.Request) {
 	limitRequestBody(r)
 
 	var req struct {
-		Username string `json:"username"`
-		Password string `json:"password,omitempty"`
-		IsAdmin  bool   `json:"isAdmin"`
-		OrgID    string `json:"orgId,omitempty"`
+		Username           string `json:"username"`
+		Password           string `json:"password,omitempty"`
+		IsAdmin            bool   `json:"isAdmin"`
+		AdminRole          string `json:"adminRole,omitempty"` // full (default) or read_only, admins only
+		OrgID              string `json:"orgId,omitempty"`
+		TokenExpiresIn     *int   `json:"tokenExpiresIn,omitempty"`     // days
+		MustChangePassword bool   `json:"mustChangePassword,omitempty"` // Force a change on first login
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -626,6 +758,14 @@ func (s *Server) handleCreateAccount(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, "Password must be at least 8 characters", http.StatusBadRequest)
 		return
 	}
+	if req.MustChangePassword && req.Password == "" {
+		jsonError(w, "mustChangePassword requires a password", http.StatusBadRequest)
+		return
+	}
+	if req.AdminRole != "" && (!req.IsAdmin || !db.ValidAdminRole(req.AdminRole)) {
+		jsonError(w, "adminRole must be full or read_only, and requires isAdmin", http.StatusBadRequest)
+		return
+	}
 
 	// Check if username already exists
 	existing, err := s.db.GetAccountByUsername(req.Username)
@@ -687,6 +827,34 @@ func (s *Server) handleCreateAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Set token expiry if requested
+	if expiresAt := tokenExpiresAtFromDays(req.TokenExpiresIn); expiresAt != nil {
+		if err := s.db.UpdateAccountTokenExpiry(account.ID, expiresAt); err != nil {
+			log.Printf("Failed to set token expiry: %v", err)
+			jsonError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		account.TokenExpiresAt = expiresAt
+	}
+
+	if req.AdminRole != "" {
+		if err := s.db.SetAccountAdminRole(account.ID, req.AdminRole); err != nil {
+			log.Printf("Failed to set admin role: %v", err)
+			jsonError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		account.AdminRole = req.AdminRole
+	}
+
+	if req.MustChangePassword {
+		if err := s.db.SetAccountMustChangePassword(account.ID, true); err != nil {
+			log.Printf("Failed to flag password change: %v", err)
+			jsonError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		account.MustChangePassword = true
+	}
+
 	// If org ID provided, link account to organization
 	if req.OrgID != "" {
 		if err := s.db.SetAccountOrganization(account.ID, req.OrgID); err != nil {
@@ -703,13 +871,16 @@ func (s *Server) handleCreateAccount(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
 		"account": map[string]interface{}{
-			"id":          account.ID,
-			"username":    account.Username,
-			"isAdmin":     account.IsAdmin,
-			"createdAt":   account.CreatedAt,
-			"orgId":       account.OrgID,
-			"orgName":     orgName,
-			"hasPassword": passwordHash != "",
+			"id":                 account.ID,
+			"username":           account.Username,
+			"isAdmin":            account.IsAdmin,
+			"adminRole":          account.EffectiveAdminRole(),
+			"createdAt":          account.CreatedAt,
+			"orgId":              account.OrgID,
+			"orgName":            orgName,
+			"hasPassword":        passwordHash != "",
+			"tokenExpiresAt":     account.TokenExpiresAt,
+			"mustChangePassword": account.MustChangePassword,
 		},
 		"token": token, // Only returned once at creation
 	})
@@ -749,6 +920,12 @@ func (s *Server) handleActivateAccount(w http.ResponseWriter, r *http.Request, a
 
 // handleRegenerateToken generates a new token for an account
 func (s *Server) handleRegenerateToken(w http.ResponseWriter, r *http.Request, accountID string) {
+	expiresAt, err := decodeTokenExpiry(r)
+	if err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
 	// Generate new token
 	token, tokenHash, err := auth.GenerateToken()
 	if err != nil {
@@ -757,22 +934,53 @@ func (s *Server) handleRegenerateToken(w http.ResponseWriter, r *http.Request, a
 		return
 	}
 
-	// Update account
+	// Update account (the new token replaces any previous expiry)
 	if err := s.db.UpdateAccountToken(accountID, tokenHash); err != nil {
 		log.Printf("Failed to update token: %v", err)
 		jsonError(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	if err := s.db.UpdateAccountTokenExpiry(accountID, expiresAt); err != nil {
+		log.Printf("Failed to update token expiry: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	log.Printf("Token regenerated for account: %s", accountID)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"token":   token,
+		"success":        true,
+		"token":          token,
+		"tokenExpiresAt": expiresAt,
 	})
 }
 
+// tokenExpiresAtFromDays converts an expiry in days into an absolute time (nil or <= 0 = never)
+func tokenExpiresAtFromDays(days *int) *time.Time {
+	if days == nil || *days <= 0 {
+		return nil
+	}
+	exp := time.Now().Add(time.Duration(*days) * 24 * time.Hour)
+	return &exp
+}
+
+// decodeTokenExpiry reads the optional {"tokenExpiresIn": days} body of a token regeneration request
+func decodeTokenExpiry(r *http.Request) (*time.Time, error) {
+	if r.Body == nil || r.ContentLength == 0 {
+		return nil, nil
+	}
+	limitRequestBody(r)
+
+	var req struct {
+		TokenExpiresIn *int `json:"tokenExpiresIn,omitempty"` // days
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return tokenExpiresAtFromDays(req.TokenExpiresIn), nil
+}
+
 // handleSetAccountOrganization links or unlinks an account to/from an organization
 func (s *Server) handleSetAccountOrganization(w http.ResponseWriter, r *http.Request, accountID string) {
 	if !validateJSONContentType(w, r) {
@@ -846,7 +1054,8 @@ func (s *Server) handleSetAccountPassword(w http.ResponseWriter, r *http.Request
 	limitRequestBody(r)
 
 	var req struct {
-		Password string `json:"password"`
+		Password           string `json:"password"`
+		MustChangePassword bool   `json:"mustChangePassword,omitempty"` // Force a change on next login
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -890,6 +1099,11 @@ func (s *Server) handleSetAccountPassword(w http.ResponseWriter, r *http.Request
 		jsonError(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	if err := s.db.SetAccountMustChangePassword(accountID, req.MustChangePassword); err != nil {
+		log.Printf("Failed to set password change flag: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	log.Printf("Password set for account %s", accountID)
 
@@ -923,17 +1137,21 @@ func (s *Server) handleGetAccount(w http.ResponseWriter, r *http.Request, accoun
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"account": map[string]interface{}{
-			"id":          account.ID,
-			"username":    account.Username,
-			"isAdmin":     account.IsAdmin,
-			"isOrgAdmin":  account.IsOrgAdmin,
-			"totpEnabled": account.TOTPEnabled,
-			"createdAt":   account.CreatedAt,
-			"lastUsed":    account.LastUsed,
-			"active":      account.Active,
-			"orgId":       account.OrgID,
-			"orgName":     orgName,
-			"hasPassword": account.PasswordHash != "",
+			"id":                account.ID,
+			"username":          account.Username,
+			"isAdmin":           account.IsAdmin,
+			"adminRole":         account.EffectiveAdminRole(),
+			"isOrgAdmin":        account.IsOrgAdmin,
+			"totpEnabled":       account.TOTPEnabled,
+			"createdAt":         account.CreatedAt,
+			"lastUsed":          account.LastUsed,
+			"active":            account.Active,
+			"tokenExpiresAt":    account.TokenExpiresAt,
+			"tokenExpiringSoon": account.IsTokenExpiringSoon(tokenExpiryWarningWindow),
+			"tokenExpired":      account.IsTokenExpired(),
+			"orgId":             account.OrgID,
+			"orgName":           orgName,
+			"hasPassword":       account.PasswordHash != "",
 		},
 	})
 }
@@ -1053,8 +1271,10 @@ func (s *Server) handleSetAccountOrgAdmin(w http.ResponseWriter, r *http.Request
 	})
 }
 
-// handleResetAccountTOTP disables TOTP for an account (admin only)
-func (s *Server) handleResetAccountTOTP(w http.ResponseWriter, r *http.Request, accountID string) {
+// handleResetAccountTOTP disables TOTP for an account (admin only). The reset is
+// written to the audit log and published as an event, which the account owner
+// sees on their org event stream, so 2FA cannot be removed quietly.
+func (s *Server) handleResetAccountTOTP(w http.ResponseWriter, r *http.Request, accountID, adminUsername string) {
 	// Check account exists
 	account, err := s.db.GetAccountByID(accountID)
 	if err != nil {
@@ -1068,18 +1288,40 @@ func (s *Server) handleResetAccountTOTP(w http.ResponseWriter, r *http.Request,
 	}
 
 	// Disable TOTP for the account
-	if err := s.db.UpdateAccountTOTP(accountID, "", false); err != nil {
+	resetAt, err := s.db.ResetAccountTOTP(accountID)
+	if err != nil {
 		log.Printf("Failed to reset TOTP: %v", err)
 		jsonError(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("TOTP reset for account: %s (%s)", accountID, account.Username)
+	log.Printf("TOTP reset for account: %s (%s) by admin %s", accountID, account.Username, adminUsername)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
+	var orgID *string
+	if account.OrgID != "" {
+		orgID = &account.OrgID
+	}
+	clientIP := auth.GetClientIP(r)
+	if err := s.db.LogAdminAction(orgID, db.AuditTypeTOTPReset, clientIP, adminUsername, account.Username); err != nil {
+		log.Printf("Failed to audit TOTP reset: %v", err)
+	}
+	s.publishEvent(Event{
+		Type:      EventAccountTOTPReset,
+		OrgID:     account.OrgID,
+		AccountID: account.ID,
+		ClientIP:  clientIP,
+		Reason:    "TOTP removed by admin " + adminUsername,
 	})
+
+	resp := map[string]interface{}{
+		"success": true,
+	}
+	// Admins always require TOTP and must re-enroll before the grace period ends
+	if account.IsAdmin && s.totpResetGrace > 0 {
+		resp["totpGraceEndsAt"] = resetAt.Add(s.totpResetGrace)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
 }
 
 // handleHardDeleteAccount permanently deletes an account
@@ -1116,7 +1358,7 @@ func (s *Server) handleListWhitelist(w http.ResponseWriter, r *http.Request) {
 	entries, err := s.db.ListGlobalWhitelist()
 	if err != nil {
 		log.Printf("Failed to list whitelist: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 
@@ -1149,14 +1391,14 @@ func (s *Server) handleAddWhitelist(w http.ResponseWriter, r *http.Request, crea
 	}
 
 	if req.IPRange == "" {
-		http.Error(w, "IP range is required", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "IP range is required")
 		return
 	}
 
 	entry, err := s.db.AddGlobalWhitelist(req.IPRange, req.Description, createdBy)
 	if err != nil {
 		log.Printf("Failed to add whitelist entry: %v", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, err.Error())
 		return
 	}
 
@@ -1173,7 +1415,7 @@ func (s *Server) handleAddWhitelist(w http.ResponseWriter, r *http.Request, crea
 func (s *Server) handleDeleteWhitelist(w http.ResponseWriter, r *http.Request, entryID string) {
 	if err := s.db.DeleteGlobalWhitelist(entryID); err != nil {
 		log.Printf("Failed to delete whitelist entry: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 
@@ -1190,7 +1432,7 @@ func (s *Server) handleListAllOrgWhitelists(w http.ResponseWriter, r *http.Reque
 	entries, err := s.db.ListAllOrgWhitelists()
 	if err != nil {
 		log.Printf("Failed to list org whitelists: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 
@@ -1210,7 +1452,7 @@ func (s *Server) handleListAllAppWhitelists(w http.ResponseWriter, r *http.Reque
 	entries, err := s.db.ListAllAppWhitelists()
 	if err != nil {
 		log.Printf("Failed to list app whitelists: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 
@@ -1289,7 +1531,7 @@ func (s *Server) handleListOrganizations(w http.ResponseWriter, r *http.Request)
 	orgs, err := s.db.ListOrganizations()
 	if err != nil {
 		log.Printf("Failed to list organizations: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 
@@ -1338,27 +1580,29 @@ func (s *Server) handleCreateOrganization(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if req.Name == "" {
-		http.Error(w, "Name is required", http.StatusBadRequest)
+	name, err := normalizeEntityName("Organization", req.Name)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, err.Error())
 		return
 	}
+	req.Name = name
 
 	// Check if name already exists
-	existing, err := s.db.GetOrganizationByName(req.Name)
+	taken, err := s.db.OrganizationNameTaken(req.Name, "")
 	if err != nil {
 		log.Printf("Failed to check organization name: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
-	if existing != nil {
-		http.Error(w, "Organization name already exists", http.StatusConflict)
+	if taken {
+		writeError(w, r, http.StatusConflict, errCodeConflict, "Organization name already exists")
 		return
 	}
 
 	org, err := s.db.CreateOrganization(req.Name)
 	if err != nil {
 		log.Printf("Failed to create organization: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 
@@ -1379,7 +1623,11 @@ func (s *Server) handleUpdateOrganization(w http.ResponseWriter, r *http.Request
 	limitRequestBody(r)
 
 	var req struct {
-		Name string `json:"name"`
+		Name               string                   `json:"name"`
+		AuthFrameAncestors *string                  `json:"authFrameAncestors,omitempty"` // CSP sources allowed to embed login pages
+		Branding           *db.OrgBranding          `json:"branding,omitempty"`           // Logo, color and product name of login/error pages
+		SessionCookie      *db.OrgSessionCookie     `json:"sessionCookie,omitempty"`      // Domain and SameSite of tunnel session cookies
+		LoginSessionLimit  *db.OrgLoginSessionLimit `json:"loginSessionLimit,omitempty"`  // Concurrent dashboard/portal logins per member
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1387,28 +1635,95 @@ func (s *Server) handleUpdateOrganization(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if req.Name == "" {
-		http.Error(w, "Name is required", http.StatusBadRequest)
+	name, err := normalizeEntityName("Organization", req.Name)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, err.Error())
 		return
 	}
+	req.Name = name
+	if req.AuthFrameAncestors != nil {
+		if err := auth.ValidateFrameAncestors(*req.AuthFrameAncestors); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Branding != nil {
+		*req.Branding = auth.NormalizeBranding(*req.Branding)
+		if err := auth.ValidateBranding(*req.Branding); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.SessionCookie != nil {
+		*req.SessionCookie = auth.NormalizeSessionCookie(*req.SessionCookie)
+		if err := auth.ValidateSessionCookie(*req.SessionCookie, s.domain, s.scheme == "https"); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.LoginSessionLimit != nil {
+		if err := validateLoginSessionLimit(*req.LoginSessionLimit); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
 	// Check org exists
 	existing, err := s.db.GetOrganizationByID(orgID)
 	if err != nil {
 		log.Printf("Failed to get organization: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 	if existing == nil {
-		http.Error(w, "Organization not found", http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Organization not found")
+		return
+	}
+
+	taken, err := s.db.OrganizationNameTaken(req.Name, orgID)
+	if err != nil {
+		log.Printf("Failed to check organization name: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+	if taken {
+		writeError(w, r, http.StatusConflict, errCodeConflict, "Organization name already exists")
 		return
 	}
 
 	if err := s.db.UpdateOrganization(orgID, req.Name); err != nil {
 		log.Printf("Failed to update organization: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
+	if req.AuthFrameAncestors != nil {
+		if err := s.db.UpdateOrganizationAuthFrameAncestors(orgID, strings.Join(strings.Fields(*req.AuthFrameAncestors), " ")); err != nil {
+			log.Printf("Failed to update organization frame ancestors: %v", err)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+			return
+		}
+	}
+	if req.Branding != nil {
+		if err := s.db.UpdateOrganizationBranding(orgID, *req.Branding); err != nil {
+			log.Printf("Failed to update organization branding: %v", err)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+			return
+		}
+	}
+	if req.SessionCookie != nil {
+		if err := s.db.UpdateOrganizationSessionCookie(orgID, *req.SessionCookie); err != nil {
+			log.Printf("Failed to update organization session cookie: %v", err)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+			return
+		}
+	}
+	if req.LoginSessionLimit != nil {
+		if err := s.db.UpdateOrganizationLoginSessionLimit(orgID, *req.LoginSessionLimit); err != nil {
+			log.Printf("Failed to update organization login session limit: %v", err)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+			return
+		}
+	}
 
 	log.Printf("Organization updated: %s -> %s", orgID, req.Name)
 
@@ -1424,30 +1739,31 @@ func (s *Server) handleDeleteOrganization(w http.ResponseWriter, r *http.Request
 	existing, err := s.db.GetOrganizationByID(orgID)
 	if err != nil {
 		log.Printf("Failed to get organization: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 	if existing == nil {
-		http.Error(w, "Organization not found", http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Organization not found")
 		return
 	}
 
 	// Check for dependent applications
 	appCount, _ := s.db.CountApplicationsByOrg(orgID)
 	if appCount > 0 {
-		http.Error(w, "Cannot delete organization with applications", http.StatusConflict)
+		writeError(w, r, http.StatusConflict, errCodeConflict, "Cannot delete organization with applications")
 		return
 	}
 
-	// Delete org policy first
-	s.db.DeleteOrgAuthPolicy(orgID)
-
 	if err := s.db.DeleteOrganization(orgID); err != nil {
 		log.Printf("Failed to delete organization: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 
+	if s.authMiddleware != nil {
+		s.authMiddleware.InvalidateOrgCache(orgID)
+	}
+
 	log.Printf("Organization deleted: %s", orgID)
 
 	w.Header().Set("Content-Type", "application/json")
@@ -1461,11 +1777,11 @@ func (s *Server) handleGetOrganization(w http.ResponseWriter, r *http.Request, o
 	org, err := s.db.GetOrganizationByID(orgID)
 	if err != nil {
 		log.Printf("Failed to get organization: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 	if org == nil {
-		http.Error(w, "Organization not found", http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Organization not found")
 		return
 	}
 
@@ -1475,6 +1791,11 @@ func (s *Server) handleGetOrganization(w http.ResponseWriter, r *http.Request, o
 	accountCount, _ := s.db.CountAccountsByOrg(orgID)
 	activeTunnels, _ := s.db.CountActiveTunnelsByOrg(orgID)
 
+	featureFlags, err := s.orgFeatureFlags(orgID)
+	if err != nil {
+		log.Printf("Failed to get feature flags: %v", err)
+	}
+
 	result := map[string]interface{}{
 		"id":            org.ID,
 		"name":          org.Name,
@@ -1483,6 +1804,7 @@ func (s *Server) handleGetOrganization(w http.ResponseWriter, r *http.Request, o
 		"hasPolicy":     hasPolicy,
 		"accountCount":  accountCount,
 		"activeTunnels": activeTunnels,
+		"featureFlags":  featureFlags,
 	}
 
 	// Add plan info if set
@@ -1503,7 +1825,7 @@ func (s *Server) handleGetOrgPolicy(w http.ResponseWriter, r *http.Request, orgI
 	policy, err := s.db.GetOrgAuthPolicy(orgID)
 	if err != nil {
 		log.Printf("Failed to get org policy: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 
@@ -1523,6 +1845,7 @@ func (s *Server) handleSetOrgPolicy(w http.ResponseWriter, r *http.Request, orgI
 	var req struct {
 		AuthType             string            `json:"authType"`
 		APIKeyEnabled        bool              `json:"apiKeyEnabled"`
+		APIKeyRedirectURL    string            `json:"apiKeyRedirectUrl,omitempty"`
 		BasicUsername        string            `json:"basicUsername,omitempty"`
 		BasicPassword        string            `json:"basicPassword,omitempty"`
 		BasicSessionDuration int               `json:"basicSessionDuration,omitempty"` // Hours, 0 = default (24h)
@@ -1532,6 +1855,8 @@ func (s *Server) handleSetOrgPolicy(w http.ResponseWriter, r *http.Request, orgI
 		OIDCScopes           []string          `json:"oidcScopes,omitempty"`
 		OIDCAllowedDomains   []string          `json:"oidcAllowedDomains,omitempty"`
 		OIDCRequiredClaims   map[string]string `json:"oidcRequiredClaims,omitempty"`
+		WebhookURL           string            `json:"webhookUrl,omitempty"`
+		WebhookHeaders       []string          `json:"webhookHeaders,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1541,21 +1866,27 @@ func (s *Server) handleSetOrgPolicy(w http.ResponseWriter, r *http.Request, orgI
 
 	// Validate auth type
 	authType := db.AuthType(req.AuthType)
-	if authType != db.AuthTypeBasic && authType != db.AuthTypeAPIKey && authType != db.AuthTypeOIDC {
+	if authType != db.AuthTypeBasic && authType != db.AuthTypeAPIKey && authType != db.AuthTypeOIDC && authType != db.AuthTypeWebhook {
 		jsonError(w, "Invalid auth type", http.StatusBadRequest)
 		return
 	}
 
 	// API key add-on is only valid with Basic or OIDC
-	if req.APIKeyEnabled && authType == db.AuthTypeAPIKey {
+	if req.APIKeyEnabled && (authType == db.AuthTypeAPIKey || authType == db.AuthTypeWebhook) {
 		jsonError(w, "API key add-on is only valid with Basic or OIDC auth types", http.StatusBadRequest)
 		return
 	}
 
 	policy := &db.OrgAuthPolicy{
-		OrgID:         orgID,
-		AuthType:      authType,
-		APIKeyEnabled: req.APIKeyEnabled,
+		OrgID:          orgID,
+		AuthType:       authType,
+		APIKeyEnabled:  req.APIKeyEnabled,
+		WebhookURL:     req.WebhookURL,
+		WebhookHeaders: req.WebhookHeaders,
+	}
+	if err := applyWebhookPolicy(authType, &policy.WebhookURL, &policy.WebhookHeaders); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	switch authType {
@@ -1588,6 +1919,13 @@ func (s *Server) handleSetOrgPolicy(w http.ResponseWriter, r *http.Request, orgI
 		policy.BasicPassHash = passHash
 		policy.BasicSessionDuration = req.BasicSessionDuration
 
+	case db.AuthTypeAPIKey:
+		if err := auth.ValidateAPIKeyRedirectURL(req.APIKeyRedirectURL); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		policy.APIKeyRedirectURL = req.APIKeyRedirectURL
+
 	case db.AuthTypeOIDC:
 		if req.OIDCIssuerURL == "" || req.OIDCClientID == "" {
 			jsonError(w, "OIDC requires issuer URL and client ID", http.StatusBadRequest)
@@ -1648,7 +1986,7 @@ func (s *Server) handleListApplications(w http.ResponseWriter, r *http.Request)
 
 	if err != nil {
 		log.Printf("Failed to list applications: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 
@@ -1681,6 +2019,8 @@ func (s *Server) handleListApplications(w http.ResponseWriter, r *http.Request)
 			"hasPolicy":         hasPolicy,
 			"isActive":          activeCount > 0,
 			"activeTunnelCount": activeCount,
+			"releasedAt":        app.ReleasedAt,
+			"releasedSubdomain": app.ReleasedSubdomain,
 		}
 		if tunnelStats != nil {
 			result[i]["stats"] = tunnelStats
@@ -1698,7 +2038,7 @@ func (s *Server) handleGetApplication(w http.ResponseWriter, r *http.Request, ap
 	app, err := s.db.GetApplicationByID(appID)
 	if err != nil {
 		log.Printf("Failed to get application: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 	if app == nil {
@@ -1732,6 +2072,8 @@ func (s *Server) handleGetApplication(w http.ResponseWriter, r *http.Request, ap
 		"hasPolicy":         hasPolicy,
 		"isActive":          activeCount > 0,
 		"activeTunnelCount": activeCount,
+		"releasedAt":        app.ReleasedAt,
+		"releasedSubdomain": app.ReleasedSubdomain,
 	}
 	if tunnelStats != nil {
 		result["stats"] = tunnelStats
@@ -1748,7 +2090,7 @@ func (s *Server) handleGetApplicationStats(w http.ResponseWriter, r *http.Reques
 	app, err := s.db.GetApplicationByID(appID)
 	if err != nil {
 		log.Printf("Failed to get application: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 	if app == nil {
@@ -1772,6 +2114,115 @@ func (s *Server) handleGetApplicationStats(w http.ResponseWriter, r *http.Reques
 		"subdomain":         app.Subdomain,
 		"activeTunnelCount": activeCount,
 		"stats":             stats,
+		"coalescing":        s.coalesceStats(appID),
+	})
+}
+
+// analyticsTopPathsLimit is the number of top paths returned by the analytics endpoint
+const analyticsTopPathsLimit = 10
+
+// handleGetApplicationAnalytics returns status code distribution, top paths and
+// requests over time for an application
+func (s *Server) handleGetApplicationAnalytics(w http.ResponseWriter, r *http.Request, appID string) {
+	app, err := s.db.GetApplicationByID(appID)
+	if err != nil {
+		log.Printf("Failed to get application: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+	if app == nil {
+		jsonError(w, "Application not found", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	to := time.Now().UTC()
+	from := to.Add(-24 * time.Hour)
+	if v := query.Get("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			jsonError(w, "Invalid from (expected RFC3339)", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			jsonError(w, "Invalid to (expected RFC3339)", http.StatusBadRequest)
+			return
+		}
+	}
+	if !from.Before(to) {
+		jsonError(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	bucket := query.Get("bucket")
+	var bucketSize time.Duration
+	switch bucket {
+	case "", "hour":
+		bucket = "hour"
+		bucketSize = time.Hour
+	case "day":
+		bucketSize = 24 * time.Hour
+	default:
+		jsonError(w, "Invalid bucket (expected hour or day)", http.StatusBadRequest)
+		return
+	}
+
+	hourly, err := s.db.GetAppAnalytics(appID, from.UTC(), to.UTC())
+	if err != nil {
+		log.Printf("Failed to get app analytics: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	topPaths, err := s.db.GetAppTopPaths(appID, from.UTC(), to.UTC(), analyticsTopPathsLimit)
+	if err != nil {
+		log.Printf("Failed to get app top paths: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if topPaths == nil {
+		topPaths = []*db.PathCount{}
+	}
+
+	// Fold hourly rows into the requested bucket size and compute totals
+	series := []*db.AppAnalyticsBucket{}
+	var total db.AppAnalyticsBucket
+	for _, h := range hourly {
+		start := h.BucketStart.UTC().Truncate(bucketSize)
+		if len(series) == 0 || !series[len(series)-1].BucketStart.Equal(start) {
+			series = append(series, &db.AppAnalyticsBucket{BucketStart: start})
+		}
+		b := series[len(series)-1]
+		b.RequestCount += h.RequestCount
+		b.Status2xx += h.Status2xx
+		b.Status3xx += h.Status3xx
+		b.Status4xx += h.Status4xx
+		b.Status5xx += h.Status5xx
+
+		total.RequestCount += h.RequestCount
+		total.Status2xx += h.Status2xx
+		total.Status3xx += h.Status3xx
+		total.Status4xx += h.Status4xx
+		total.Status5xx += h.Status5xx
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"appId":         appID,
+		"subdomain":     app.Subdomain,
+		"from":          from,
+		"to":            to,
+		"bucket":        bucket,
+		"totalRequests": total.RequestCount,
+		"statusCodes": map[string]int64{
+			"2xx": total.Status2xx,
+			"3xx": total.Status3xx,
+			"4xx": total.Status4xx,
+			"5xx": total.Status5xx,
+		},
+		"topPaths": topPaths,
+		"series":   series,
 	})
 }
 
@@ -1780,7 +2231,7 @@ func (s *Server) handleGetApplicationTunnels(w http.ResponseWriter, r *http.Requ
 	app, err := s.db.GetApplicationByID(appID)
 	if err != nil {
 		log.Printf("Failed to get application: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 	if app == nil {
@@ -1823,14 +2274,20 @@ func (s *Server) handleCreateApplication(w http.ResponseWriter, r *http.Request)
 	}
 
 	if req.OrgID == "" || req.Subdomain == "" {
-		http.Error(w, "Organization ID and subdomain are required", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "Organization ID and subdomain are required")
+		return
+	}
+
+	req.Subdomain = strings.ToLower(req.Subdomain)
+	if err := s.subdomainPolicy.Validate(req.Subdomain); err != nil {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, err.Error())
 		return
 	}
 
 	// Check org exists
 	org, err := s.db.GetOrganizationByID(req.OrgID)
 	if err != nil || org == nil {
-		http.Error(w, "Organization not found", http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Organization not found")
 		return
 	}
 
@@ -1838,18 +2295,18 @@ func (s *Server) handleCreateApplication(w http.ResponseWriter, r *http.Request)
 	available, err := s.db.IsSubdomainAvailable(req.Subdomain)
 	if err != nil {
 		log.Printf("Failed to check subdomain: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 	if !available {
-		http.Error(w, "Subdomain already in use", http.StatusConflict)
+		writeError(w, r, http.StatusConflict, errCodeConflict, "Subdomain already in use")
 		return
 	}
 
 	app, err := s.db.CreateApplication(req.OrgID, req.Subdomain, req.Name)
 	if err != nil {
 		log.Printf("Failed to create application: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 
@@ -1875,10 +2332,23 @@ func (s *Server) handleUpdateApplication(w http.ResponseWriter, r *http.Request,
 	limitRequestBody(r)
 
 	var req struct {
-		Name      string `json:"name"`
-		Subdomain string `json:"subdomain,omitempty"`
-		AuthMode  string `json:"authMode"`
-		AuthType  string `json:"authType,omitempty"`
+		Name            string               `json:"name"`
+		Subdomain       string               `json:"subdomain,omitempty"`
+		AuthMode        string               `json:"authMode"`
+		AuthType        string               `json:"authType,omitempty"`
+		PreserveHost    *bool                `json:"preserveHost,omitempty"`
+		HostHeader      *db.HostHeaderConfig `json:"hostHeader,omitempty"`      // {} inherits the server's host_header setting
+		MaxHeaderBytes  *int                 `json:"maxHeaderBytes,omitempty"`  // 0 resets to the server default
+		IdentityHeaders *[]string            `json:"identityHeaders,omitempty"` // [] stops forwarding identity headers
+		ForwardChunked  *bool                `json:"forwardChunked,omitempty"`
+		HTTP2           *bool                `json:"http2,omitempty"`
+		Coalesce        *bool                `json:"coalesce,omitempty"`
+		StreamingMode   *bool                `json:"streamingMode,omitempty"`
+		ForceHTTPS      *string              `json:"forceHttps,omitempty"` // "" inherits the server's force_https setting
+
+		// Experimental HTML transform; "" turns a setting off
+		HTMLBaseHref      *string `json:"htmlBaseHref,omitempty"`
+		HTMLRewriteOrigin *string `json:"htmlRewriteOrigin,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1886,10 +2356,52 @@ func (s *Server) handleUpdateApplication(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
+	if req.MaxHeaderBytes != nil {
+		if err := validateAppMaxHeaderBytes(*req.MaxHeaderBytes); err != nil {
+			writeError(w, r, http.StatusBadRequest, errCodeBadRequest, err.Error())
+			return
+		}
+	}
+
+	if req.IdentityHeaders != nil {
+		if err := validateIdentityHeaders(*req.IdentityHeaders); err != nil {
+			writeError(w, r, http.StatusBadRequest, errCodeBadRequest, err.Error())
+			return
+		}
+	}
+
+	if req.HostHeader != nil {
+		if err := validateHostHeader(*req.HostHeader); err != nil {
+			writeError(w, r, http.StatusBadRequest, errCodeBadRequest, err.Error())
+			return
+		}
+	}
+
+	if req.ForceHTTPS != nil {
+		if err := validateForceHTTPSMode(*req.ForceHTTPS); err != nil {
+			writeError(w, r, http.StatusBadRequest, errCodeBadRequest, err.Error())
+			return
+		}
+	}
+
+	if req.HTMLBaseHref != nil {
+		if err := validateHTMLBaseHref(*req.HTMLBaseHref); err != nil {
+			writeError(w, r, http.StatusBadRequest, errCodeBadRequest, err.Error())
+			return
+		}
+	}
+
+	if req.HTMLRewriteOrigin != nil {
+		if err := validateHTMLRewriteOrigin(*req.HTMLRewriteOrigin); err != nil {
+			writeError(w, r, http.StatusBadRequest, errCodeBadRequest, err.Error())
+			return
+		}
+	}
+
 	// Validate auth mode
 	authMode := db.AuthMode(req.AuthMode)
 	if authMode != db.AuthModeInherit && authMode != db.AuthModeDisabled && authMode != db.AuthModeCustom {
-		http.Error(w, "Invalid auth mode", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "Invalid auth mode")
 		return
 	}
 
@@ -1897,18 +2409,27 @@ func (s *Server) handleUpdateApplication(w http.ResponseWriter, r *http.Request,
 	existing, err := s.db.GetApplicationByID(appID)
 	if err != nil {
 		log.Printf("Failed to get application: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 	if existing == nil {
-		http.Error(w, "Application not found", http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Application not found")
+		return
+	}
+	if existing.ReleasedAt != nil {
+		writeError(w, r, http.StatusConflict, errCodeConflict, "Application was released; restore it first")
 		return
 	}
 
 	// Use existing subdomain if not provided
-	subdomain := req.Subdomain
+	subdomain := strings.ToLower(req.Subdomain)
 	if subdomain == "" {
 		subdomain = existing.Subdomain
+	} else if subdomain != existing.Subdomain {
+		if err := s.subdomainPolicy.Validate(subdomain); err != nil {
+			writeError(w, r, http.StatusBadRequest, errCodeBadRequest, err.Error())
+			return
+		}
 	}
 
 	authType := db.AuthType(req.AuthType)
@@ -1917,11 +2438,99 @@ func (s *Server) handleUpdateApplication(w http.ResponseWriter, r *http.Request,
 		if strings.Contains(err.Error(), "already in use") {
 			jsonError(w, err.Error(), http.StatusConflict)
 		} else {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		}
 		return
 	}
 
+	if req.PreserveHost != nil {
+		if err := s.db.UpdateApplicationPreserveHost(appID, *req.PreserveHost); err != nil {
+			log.Printf("Failed to update application preserve host: %v", err)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+			return
+		}
+	}
+
+	if req.HostHeader != nil {
+		if err := s.db.UpdateApplicationHostHeader(appID, *req.HostHeader); err != nil {
+			log.Printf("Failed to update application host header: %v", err)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+			return
+		}
+	}
+
+	if req.MaxHeaderBytes != nil {
+		if err := s.db.UpdateApplicationMaxHeaderBytes(appID, *req.MaxHeaderBytes); err != nil {
+			log.Printf("Failed to update application max header bytes: %v", err)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+			return
+		}
+	}
+
+	if req.IdentityHeaders != nil {
+		if err := s.db.UpdateApplicationIdentityHeaders(appID, *req.IdentityHeaders); err != nil {
+			log.Printf("Failed to update application identity headers: %v", err)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+			return
+		}
+	}
+
+	if req.ForwardChunked != nil {
+		if err := s.db.UpdateApplicationForwardChunked(appID, *req.ForwardChunked); err != nil {
+			log.Printf("Failed to update application forward chunked: %v", err)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+			return
+		}
+	}
+
+	if req.HTTP2 != nil {
+		if err := s.db.UpdateApplicationHTTP2(appID, *req.HTTP2); err != nil {
+			log.Printf("Failed to update application http2: %v", err)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+			return
+		}
+	}
+
+	if req.Coalesce != nil {
+		if err := s.db.UpdateApplicationCoalesce(appID, *req.Coalesce); err != nil {
+			log.Printf("Failed to update application coalesce: %v", err)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+			return
+		}
+	}
+
+	if req.StreamingMode != nil {
+		if err := s.db.UpdateApplicationStreamingMode(appID, *req.StreamingMode); err != nil {
+			log.Printf("Failed to update application streaming mode: %v", err)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+			return
+		}
+	}
+
+	if req.ForceHTTPS != nil {
+		if err := s.db.UpdateApplicationForceHTTPS(appID, *req.ForceHTTPS); err != nil {
+			log.Printf("Failed to update application force https: %v", err)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+			return
+		}
+	}
+
+	if req.HTMLBaseHref != nil {
+		if err := s.db.UpdateApplicationHTMLBaseHref(appID, *req.HTMLBaseHref); err != nil {
+			log.Printf("Failed to update application html base href: %v", err)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+			return
+		}
+	}
+
+	if req.HTMLRewriteOrigin != nil {
+		if err := s.db.UpdateApplicationHTMLRewriteOrigin(appID, *req.HTMLRewriteOrigin); err != nil {
+			log.Printf("Failed to update application html rewrite origin: %v", err)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+			return
+		}
+	}
+
 	// Invalidate policy cache for both old and new subdomains
 	if s.authMiddleware != nil {
 		s.authMiddleware.InvalidateSubdomainCache(existing.Subdomain)
@@ -1945,20 +2554,17 @@ func (s *Server) handleDeleteApplication(w http.ResponseWriter, r *http.Request,
 	existing, err := s.db.GetApplicationByID(appID)
 	if err != nil {
 		log.Printf("Failed to get application: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 	if existing == nil {
-		http.Error(w, "Application not found", http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Application not found")
 		return
 	}
 
-	// Delete app policy first
-	s.db.DeleteAppAuthPolicy(appID)
-
 	if err := s.db.DeleteApplication(appID); err != nil {
 		log.Printf("Failed to delete application: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 
@@ -1981,7 +2587,7 @@ func (s *Server) handleGetAppPolicy(w http.ResponseWriter, r *http.Request, appI
 	policy, err := s.db.GetAppAuthPolicy(appID)
 	if err != nil {
 		log.Printf("Failed to get app policy: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 
@@ -2001,6 +2607,7 @@ func (s *Server) handleSetAppPolicy(w http.ResponseWriter, r *http.Request, appI
 	var req struct {
 		AuthType             string            `json:"authType"`
 		APIKeyEnabled        bool              `json:"apiKeyEnabled"`
+		APIKeyRedirectURL    string            `json:"apiKeyRedirectUrl,omitempty"`
 		BasicUsername        string            `json:"basicUsername,omitempty"`
 		BasicPassword        string            `json:"basicPassword,omitempty"`
 		BasicSessionDuration int               `json:"basicSessionDuration,omitempty"` // Hours, 0 = default (24h)
@@ -2010,6 +2617,8 @@ func (s *Server) handleSetAppPolicy(w http.ResponseWriter, r *http.Request, appI
 		OIDCScopes           []string          `json:"oidcScopes,omitempty"`
 		OIDCAllowedDomains   []string          `json:"oidcAllowedDomains,omitempty"`
 		OIDCRequiredClaims   map[string]string `json:"oidcRequiredClaims,omitempty"`
+		WebhookURL           string            `json:"webhookUrl,omitempty"`
+		WebhookHeaders       []string          `json:"webhookHeaders,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -2019,21 +2628,27 @@ func (s *Server) handleSetAppPolicy(w http.ResponseWriter, r *http.Request, appI
 
 	// Validate auth type
 	authType := db.AuthType(req.AuthType)
-	if authType != db.AuthTypeBasic && authType != db.AuthTypeAPIKey && authType != db.AuthTypeOIDC {
+	if authType != db.AuthTypeBasic && authType != db.AuthTypeAPIKey && authType != db.AuthTypeOIDC && authType != db.AuthTypeWebhook {
 		jsonError(w, "Invalid auth type", http.StatusBadRequest)
 		return
 	}
 
 	// API key add-on is only valid with Basic or OIDC
-	if req.APIKeyEnabled && authType == db.AuthTypeAPIKey {
+	if req.APIKeyEnabled && (authType == db.AuthTypeAPIKey || authType == db.AuthTypeWebhook) {
 		jsonError(w, "API key add-on is only valid with Basic or OIDC auth types", http.StatusBadRequest)
 		return
 	}
 
 	policy := &db.AppAuthPolicy{
-		AppID:         appID,
-		AuthType:      authType,
-		APIKeyEnabled: req.APIKeyEnabled,
+		AppID:          appID,
+		AuthType:       authType,
+		APIKeyEnabled:  req.APIKeyEnabled,
+		WebhookURL:     req.WebhookURL,
+		WebhookHeaders: req.WebhookHeaders,
+	}
+	if err := applyWebhookPolicy(authType, &policy.WebhookURL, &policy.WebhookHeaders); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	switch authType {
@@ -2066,6 +2681,13 @@ func (s *Server) handleSetAppPolicy(w http.ResponseWriter, r *http.Request, appI
 		policy.BasicPassHash = passHash
 		policy.BasicSessionDuration = req.BasicSessionDuration
 
+	case db.AuthTypeAPIKey:
+		if err := auth.ValidateAPIKeyRedirectURL(req.APIKeyRedirectURL); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		policy.APIKeyRedirectURL = req.APIKeyRedirectURL
+
 	case db.AuthTypeOIDC:
 		if req.OIDCIssuerURL == "" || req.OIDCClientID == "" {
 			jsonError(w, "OIDC requires issuer URL and client ID", http.StatusBadRequest)
@@ -2139,7 +2761,7 @@ func (s *Server) handleAdminGetAppRateLimit(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Get default values
-	defaultMax, defaultWindow, defaultBlock := db.DefaultRateLimitValues()
+	defaultMax, defaultWindow, defaultBlock := s.defaultRateLimitValues()
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -2273,13 +2895,13 @@ func (s *Server) handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
 	} else if orgID != "" {
 		keys, err = s.db.ListAPIKeysByOrg(orgID)
 	} else {
-		http.Error(w, "Either org or app parameter is required", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "Either org or app parameter is required")
 		return
 	}
 
 	if err != nil {
 		log.Printf("Failed to list API keys: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 
@@ -2306,6 +2928,8 @@ func (s *Server) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
 		AppID       string `json:"appId,omitempty"`
 		Description string `json:"description"`
 		ExpiresIn   *int   `json:"expiresIn,omitempty"` // days
+
+		RateLimitTier string `json:"rateLimitTier,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -2314,7 +2938,12 @@ func (s *Server) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if req.OrgID == "" {
-		http.Error(w, "Organization ID is required", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "Organization ID is required")
+		return
+	}
+
+	if req.RateLimitTier != "" && !db.IsValidRateLimitTier(req.RateLimitTier) {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "rateLimitTier must be one of standard, elevated, exempt")
 		return
 	}
 
@@ -2333,13 +2962,16 @@ func (s *Server) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
 	rawKey, key, err := db.GenerateAPIKey(orgID, appID, req.Description, expiresAt)
 	if err != nil {
 		log.Printf("Failed to generate API key: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
+	if req.RateLimitTier != "" {
+		key.RateLimitTier = req.RateLimitTier
+	}
 
 	if err := s.db.CreateAPIKey(key); err != nil {
 		log.Printf("Failed to create API key: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 
@@ -2359,17 +2991,17 @@ func (s *Server) handleDeleteAPIKey(w http.ResponseWriter, r *http.Request, keyI
 	existing, err := s.db.GetAPIKeyByID(keyID)
 	if err != nil {
 		log.Printf("Failed to get API key: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 	if existing == nil {
-		http.Error(w, "API key not found", http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "API key not found")
 		return
 	}
 
 	if err := s.db.DeleteAPIKey(keyID); err != nil {
 		log.Printf("Failed to delete API key: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 
@@ -2381,6 +3013,95 @@ func (s *Server) handleDeleteAPIKey(w http.ResponseWriter, r *http.Request, keyI
 	})
 }
 
+// handleIntrospectAPIKey reports whether a raw API key is valid and, if it is known,
+// its scope and metadata, to help debug rejected keys. The key hash is never returned.
+func (s *Server) handleIntrospectAPIKey(w http.ResponseWriter, r *http.Request, adminID string) {
+	if !validateJSONContentType(w, r) {
+		return
+	}
+	limitRequestBody(r)
+
+	// Rate limit per admin so the endpoint cannot be used to guess keys
+	if s.introspectRateLimiter != nil {
+		allowed, retryAfter := s.introspectRateLimiter.Allow(auth.UserRateLimitKey(adminID))
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+			jsonError(w, "Too many introspection requests. Please try again later.", http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	var req struct {
+		Key string `json:"key"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	rawKey := strings.TrimSpace(req.Key)
+	if rawKey == "" {
+		jsonError(w, "Key is required", http.StatusBadRequest)
+		return
+	}
+
+	key, err := s.db.ValidateAPIKey(rawKey)
+	if err != nil {
+		log.Printf("Failed to validate API key: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+
+	valid := key != nil
+	response := map[string]interface{}{
+		"valid": valid,
+	}
+
+	if !valid {
+		// Distinguish an expired key from one that does not exist
+		key, err = s.db.GetAPIKeyByHash(db.HashAPIKey(rawKey))
+		if err != nil {
+			log.Printf("Failed to get API key: %v", err)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+			return
+		}
+		if key == nil {
+			response["reason"] = "unknown"
+		} else {
+			response["reason"] = "expired"
+		}
+	}
+
+	if key != nil {
+		keyInfo := map[string]interface{}{
+			"id":          key.ID,
+			"keyPrefix":   key.KeyPrefix,
+			"keyType":     key.KeyType,
+			"description": key.Description,
+			"createdAt":   key.CreatedAt,
+			"lastUsed":    key.LastUsed,
+			"expiresAt":   key.ExpiresAt,
+		}
+		if key.OrgID != nil {
+			keyInfo["orgId"] = *key.OrgID
+			if org, err := s.db.GetOrganizationByID(*key.OrgID); err == nil && org != nil {
+				keyInfo["orgName"] = org.Name
+			}
+		}
+		if key.AppID != nil {
+			keyInfo["appId"] = *key.AppID
+			if app, err := s.db.GetApplicationByID(*key.AppID); err == nil && app != nil {
+				keyInfo["appSubdomain"] = app.Subdomain
+			}
+		}
+		response["key"] = keyInfo
+	}
+
+	log.Printf("API key introspected by admin %s: valid=%v", adminID, valid)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 // ============================================
 // Audit Log
 // ============================================
@@ -2397,23 +3118,11 @@ func (s *Server) handleListAuditEvents(w http.ResponseWriter, r *http.Request) {
 		appID = &v
 	}
 
-	limit := 50
-	offset := 0
-	if v := query.Get("limit"); v != "" {
-		if l, err := strconv.Atoi(v); err == nil && l > 0 && l <= 100 {
-			limit = l
-		}
-	}
-	if v := query.Get("offset"); v != "" {
-		if o, err := strconv.Atoi(v); err == nil && o >= 0 {
-			offset = o
-		}
-	}
-
+	limit, offset := pageParams(r)
 	events, err := s.db.GetAuditEvents(orgID, appID, limit, offset)
 	if err != nil {
 		log.Printf("Failed to get audit events: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 
@@ -2434,7 +3143,7 @@ func (s *Server) handleAuditStats(w http.ResponseWriter, r *http.Request) {
 	stats, err := s.db.GetAuthStats()
 	if err != nil {
 		log.Printf("Failed to get auth stats: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 
@@ -2473,19 +3182,37 @@ func (s *Server) handleCreatePlan(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if input.Name == "" {
-		jsonError(w, "Name is required", http.StatusBadRequest)
+	name, err := normalizeEntityName("Plan", input.Name)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	input.Name = name
+	if input.MaxBytesPerSecond != nil && *input.MaxBytesPerSecond <= 0 {
+		jsonError(w, "maxBytesPerSecond must be positive", http.StatusBadRequest)
+		return
+	}
+	if input.MaxForwards != nil && *input.MaxForwards <= 0 {
+		jsonError(w, "maxForwards must be positive", http.StatusBadRequest)
+		return
+	}
+	if input.MaxConcurrentRequests != nil && *input.MaxConcurrentRequests <= 0 {
+		jsonError(w, "maxConcurrentRequests must be positive", http.StatusBadRequest)
+		return
+	}
+	if input.ReleaseInactiveDays != nil && *input.ReleaseInactiveDays <= 0 {
+		jsonError(w, "releaseInactiveDays must be positive", http.StatusBadRequest)
 		return
 	}
 
 	// Check for duplicate name
-	existing, err := s.db.GetPlanByName(input.Name)
+	taken, err := s.db.PlanNameTaken(input.Name, "")
 	if err != nil {
 		log.Printf("Failed to check plan name: %v", err)
 		jsonError(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	if existing != nil {
+	if taken {
 		jsonError(w, "Plan name already exists", http.StatusConflict)
 		return
 	}
@@ -2552,23 +3279,39 @@ func (s *Server) handleUpdatePlan(w http.ResponseWriter, r *http.Request, planID
 		return
 	}
 
-	if input.Name == "" {
-		jsonError(w, "Name is required", http.StatusBadRequest)
+	name, err := normalizeEntityName("Plan", input.Name)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	input.Name = name
+	if input.MaxBytesPerSecond != nil && *input.MaxBytesPerSecond <= 0 {
+		jsonError(w, "maxBytesPerSecond must be positive", http.StatusBadRequest)
+		return
+	}
+	if input.MaxForwards != nil && *input.MaxForwards <= 0 {
+		jsonError(w, "maxForwards must be positive", http.StatusBadRequest)
+		return
+	}
+	if input.MaxConcurrentRequests != nil && *input.MaxConcurrentRequests <= 0 {
+		jsonError(w, "maxConcurrentRequests must be positive", http.StatusBadRequest)
+		return
+	}
+	if input.ReleaseInactiveDays != nil && *input.ReleaseInactiveDays <= 0 {
+		jsonError(w, "releaseInactiveDays must be positive", http.StatusBadRequest)
 		return
 	}
 
-	// Check for duplicate name (if changing)
-	if input.Name != existing.Name {
-		duplicate, err := s.db.GetPlanByName(input.Name)
-		if err != nil {
-			log.Printf("Failed to check plan name: %v", err)
-			jsonError(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
-		if duplicate != nil {
-			jsonError(w, "Plan name already exists", http.StatusConflict)
-			return
-		}
+	// Check for duplicate name
+	taken, err := s.db.PlanNameTaken(input.Name, planID)
+	if err != nil {
+		log.Printf("Failed to check plan name: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if taken {
+		jsonError(w, "Plan name already exists", http.StatusConflict)
+		return
 	}
 
 	plan, err := s.db.UpdatePlan(planID, input)
@@ -2712,6 +3455,7 @@ func (s *Server) handleGetOrganizationUsage(w http.ResponseWriter, r *http.Reque
 			"tunnelSeconds":     tunnelSeconds,
 			"requestCount":      requestCount,
 			"currentConcurrent": currentConcurrent,
+			"inFlightRequests":  s.inFlight.current(orgID),
 		},
 		"history": history,
 	}
@@ -2785,7 +3529,8 @@ func (s *Server) handleSetOrganizationPlan(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Verify plan exists if provided
+	// Verify plan exists if provided, and check the org is not already above its limits
+	violations := []PlanViolation{}
 	if input.PlanID != nil && *input.PlanID != "" {
 		plan, err := s.db.GetPlan(*input.PlanID)
 		if err != nil {
@@ -2797,6 +3542,23 @@ func (s *Server) handleSetOrganizationPlan(w http.ResponseWriter, r *http.Reques
 			jsonError(w, "Plan not found", http.StatusNotFound)
 			return
 		}
+
+		violations, err = s.planViolations(orgID, plan)
+		if err != nil {
+			log.Printf("Failed to check plan limits: %v", err)
+			jsonError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if len(violations) > 0 && s.planDowngradePolicy == PlanDowngradeEnforce {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":      "Organization is over the plan's limits",
+				"code":       errCodeConflict,
+				"violations": violations,
+			})
+			return
+		}
 	}
 
 	if err := s.db.UpdateOrganizationPlan(orgID, input.PlanID); err != nil {
@@ -2810,6 +3572,70 @@ func (s *Server) handleSetOrganizationPlan(w http.ResponseWriter, r *http.Reques
 		s.usageCache.UpdateOrgPlanID(orgID, input.PlanID)
 	}
 
+	if len(violations) > 0 {
+		log.Printf("Organization %s is over %d limit(s) of its new plan", orgID, len(violations))
+	}
+
 	log.Printf("Organization %s plan updated to: %v", orgID, input.PlanID)
-	jsonResponse(w, map[string]bool{"success": true})
+	jsonResponse(w, map[string]interface{}{
+		"success":    true,
+		"violations": violations,
+	})
+}
+
+// handleAdminSearch searches accounts, organizations, applications and API keys
+func (s *Server) handleAdminSearch(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "Query parameter q is required")
+		return
+	}
+
+	results, err := s.db.Search(query, maxSearchResultsPerType)
+	if err != nil {
+		log.Printf("Failed to search: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"query":   query,
+		"results": results,
+	})
+}
+
+// handleFindOrphans reports whitelist entries, API keys, accounts, policies and
+// other rows that still reference a deleted organization, application, account or plan
+func (s *Server) handleFindOrphans(w http.ResponseWriter, r *http.Request) {
+	counts, err := s.db.FindOrphans()
+	if err != nil {
+		log.Printf("Failed to find orphans: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"orphans": counts,
+		"total":   counts.Total(),
+	})
+}
+
+// handlePurgeOrphans deletes rows that reference a deleted organization, application
+// or account, and unlinks accounts and organizations from deleted ones
+func (s *Server) handlePurgeOrphans(w http.ResponseWriter, r *http.Request) {
+	counts, err := s.db.PurgeOrphans()
+	if err != nil {
+		log.Printf("Failed to purge orphans: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+
+	log.Printf("Purged %d orphaned rows: %v", counts.Total(), counts)
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"deleted": counts,
+		"total":   counts.Total(),
+	})
 }
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// adminCanWrite reports whether an admin may make the request. Read-only
+// admins may only read, apart from managing their own password and TOTP under
+// /me/. The role is loaded on each write rather than taken from the token, so
+// demoting an admin takes effect on their existing sessions.
+func (s *Server) adminCanWrite(r *http.Request, accountID, path string) (bool, error) {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead || strings.HasPrefix(path, "/me/") {
+		return true, nil
+	}
+	account, err := s.db.GetAccountByID(accountID)
+	if err != nil {
+		return false, err
+	}
+	return account != nil && account.IsAdmin && !account.IsReadOnlyAdmin(), nil
+}
+
+// handleSetAccountAdminRole sets the role of an admin account. The last admin
+// with full access cannot be made read-only, and the change is written to the
+// audit log.
+func (s *Server) handleSetAccountAdminRole(w http.ResponseWriter, r *http.Request, accountID, adminUsername string) {
+	if !validateJSONContentType(w, r) {
+		return
+	}
+	limitRequestBody(r)
+
+	var req struct {
+		AdminRole string `json:"adminRole"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "Invalid request body")
+		return
+	}
+	if !db.ValidAdminRole(req.AdminRole) {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "adminRole must be full or read_only")
+		return
+	}
+
+	account, err := s.db.GetAccountByID(accountID)
+	if err != nil {
+		log.Printf("Failed to get account: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+	if account == nil {
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Account not found")
+		return
+	}
+	if !account.IsAdmin {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "Account is not an admin")
+		return
+	}
+
+	previous := account.EffectiveAdminRole()
+	if previous == req.AdminRole {
+		jsonResponse(w, map[string]interface{}{"success": true, "adminRole": req.AdminRole})
+		return
+	}
+	if req.AdminRole == db.AdminRoleReadOnly && account.Active {
+		full, err := s.db.CountFullAdmins()
+		if err != nil {
+			log.Printf("Failed to count admins: %v", err)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+			return
+		}
+		if full <= 1 {
+			writeError(w, r, http.StatusConflict, errCodeConflict, "Cannot make the last full admin read-only")
+			return
+		}
+	}
+
+	if err := s.db.SetAccountAdminRole(accountID, req.AdminRole); err != nil {
+		log.Printf("Failed to set admin role: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+
+	log.Printf("Admin role of account %s changed by admin %s: %s -> %s", account.Username, adminUsername, previous, req.AdminRole)
+	target := account.Username + ": " + previous + " -> " + req.AdminRole
+	if err := s.db.LogAdminAction(nil, db.AuditTypeAdminRoleChanged, auth.GetClientIP(r), adminUsername, target); err != nil {
+		log.Printf("Failed to audit admin role change: %v", err)
+	}
+
+	jsonResponse(w, map[string]interface{}{"success": true, "adminRole": req.AdminRole})
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestReadOnlyAdmin(t *testing.T) {
+	database := newTestDB(t)
+	s := newTestServer(database)
+
+	newAdmin := func(username string) (*db.Account, string) {
+		token, tokenHash, err := auth.GenerateToken()
+		if err != nil {
+			t.Fatalf("GenerateToken() error: %v", err)
+		}
+		account, err := database.CreateAccount(username, tokenHash, true)
+		if err != nil {
+			t.Fatalf("CreateAccount() error: %v", err)
+		}
+		return account, token
+	}
+	root, rootToken := newAdmin("root")
+	support, supportToken := newAdmin("support")
+
+	call := func(token, method, path, body string) int {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("X-Admin-Token", token)
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.handleAdmin(w, r)
+		return w.Code
+	}
+
+	if code := call(rootToken, http.MethodPut, "/admin/accounts/"+support.ID+"/admin-role", `{"adminRole":"viewer"}`); code != http.StatusBadRequest {
+		t.Errorf("unknown role: status %d, want 400", code)
+	}
+	if code := call(rootToken, http.MethodPut, "/admin/accounts/"+support.ID+"/admin-role", `{"adminRole":"read_only"}`); code != http.StatusOK {
+		t.Fatalf("demote support: status %d, want 200", code)
+	}
+	if code := call(rootToken, http.MethodPut, "/admin/accounts/"+root.ID+"/admin-role", `{"adminRole":"read_only"}`); code != http.StatusConflict {
+		t.Errorf("demote last full admin: status %d, want 409", code)
+	}
+
+	if code := call(supportToken, http.MethodGet, "/admin/accounts", ""); code != http.StatusOK {
+		t.Errorf("read-only GET: status %d, want 200", code)
+	}
+	for _, req := range []struct{ method, path, body string }{
+		{http.MethodPost, "/admin/organizations", `{"name":"Acme"}`},
+		{http.MethodPut, "/admin/accounts/" + support.ID + "/admin-role", `{"adminRole":"full"}`},
+		{http.MethodPost, "/admin/accounts", `{"username":"sneaky","isAdmin":true}`},
+		{http.MethodDelete, "/admin/accounts/" + root.ID, ""},
+	} {
+		if code := call(supportToken, req.method, req.path, req.body); code != http.StatusForbidden {
+			t.Errorf("read-only %s %s: status %d, want 403", req.method, req.path, code)
+		}
+	}
+	if got, _ := database.GetAccountByID(support.ID); !got.IsReadOnlyAdmin() {
+		t.Error("read-only admin escalated their own role")
+	}
+	if got, _ := database.GetAccountByUsername("sneaky"); got != nil {
+		t.Error("read-only admin created an account")
+	}
+	if code := call(supportToken, http.MethodPut, "/admin/me/password", `{"password":"correct-horse-battery"}`); code == http.StatusForbidden {
+		t.Error("read-only admin cannot change their own password")
+	}
+
+	if code := call(rootToken, http.MethodPost, "/admin/organizations", `{"name":"Acme"}`); code != http.StatusOK {
+		t.Errorf("full admin POST: status %d, want 200", code)
+	}
+}
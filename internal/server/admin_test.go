@@ -0,0 +1,118 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestAdminSearch(t *testing.T) {
+	database := newTestDB(t)
+	s := newTestServer(database)
+
+	token, tokenHash, err := auth.GenerateToken()
+	if err != nil {
+		t.Fatalf("GenerateToken() error: %v", err)
+	}
+	if _, err := database.CreateAccount("root", tokenHash, true); err != nil {
+		t.Fatalf("CreateAccount() error: %v", err)
+	}
+	org, err := database.CreateOrganization("Acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	if _, err := database.CreateApplication(org.ID, "acme-web", "Web"); err != nil {
+		t.Fatalf("CreateApplication() error: %v", err)
+	}
+
+	search := func(token, q string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/admin/search?q="+url.QueryEscape(q), nil)
+		r.Header.Set("X-Admin-Token", token)
+		r.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		s.handleAdmin(w, r)
+		return w
+	}
+
+	if w := search("", "acme"); w.Code != http.StatusUnauthorized {
+		t.Errorf("search without admin token: status %d, want 401", w.Code)
+	}
+	if w := search(token, "  "); w.Code != http.StatusBadRequest {
+		t.Errorf("search without q: status %d, want 400", w.Code)
+	}
+
+	w := search(token, " ACME ")
+	if w.Code != http.StatusOK {
+		t.Fatalf("search: status %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Query   string           `json:"query"`
+		Results db.SearchResults `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("search body: %v", err)
+	}
+	if resp.Query != "ACME" || len(resp.Results.Organizations) != 1 || resp.Results.Organizations[0].ID != org.ID {
+		t.Errorf("search = %+v, want the Acme organization", resp)
+	}
+	if apps := resp.Results.Applications; len(apps) != 1 || apps[0].Type != db.SearchTypeApplication || apps[0].Label != "acme-web" || apps[0].OrgID != org.ID {
+		t.Errorf("applications = %+v, want acme-web in Acme", apps)
+	}
+	if resp.Results.Accounts == nil || resp.Results.APIKeys == nil {
+		t.Errorf("empty categories = %+v, want empty lists", resp.Results)
+	}
+}
+
+func TestResetAccountTOTPAudit(t *testing.T) {
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	member, err := database.CreateOrgAccount("member", auth.HashToken("member"), "", org.ID)
+	if err != nil {
+		t.Fatalf("CreateOrgAccount() error: %v", err)
+	}
+	if err := database.UpdateAccountTOTP(member.ID, "secret", true); err != nil {
+		t.Fatalf("UpdateAccountTOTP() error: %v", err)
+	}
+
+	s := newTestServer(database)
+	events, unsubscribe := s.events.Subscribe(EventFilter{OrgID: org.ID, AccountID: member.ID})
+	defer unsubscribe()
+
+	r := httptest.NewRequest(http.MethodPost, "/admin/accounts/"+member.ID+"/totp/reset-with-audit", nil)
+	w := httptest.NewRecorder()
+	s.handleResetAccountTOTP(w, r, member.ID, "root")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	if account, _ := database.GetAccountByID(member.ID); account.TOTPEnabled {
+		t.Error("TOTP still enabled after reset")
+	}
+
+	audit, err := database.GetAuditEvents(&org.ID, nil, 10, 0)
+	if err != nil {
+		t.Fatalf("GetAuditEvents() error: %v", err)
+	}
+	if len(audit) != 1 || audit[0].AuthType != db.AuditTypeTOTPReset || audit[0].Actor != "root" || audit[0].UserIdentity != "member" {
+		t.Errorf("audit events = %+v, want one totp_reset by root on member", audit)
+	}
+
+	select {
+	case e := <-events:
+		if e.Type != EventAccountTOTPReset || !strings.Contains(e.Reason, "root") {
+			t.Errorf("event = %+v, want account.totp_reset naming the admin", e)
+		}
+	default:
+		t.Error("no event published for the account owner")
+	}
+}
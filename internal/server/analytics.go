@@ -0,0 +1,193 @@
+package server
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+const (
+	// maxTrackedPaths caps the distinct paths tracked per app per hour; further paths count as otherPathsLabel
+	maxTrackedPaths = 100
+	// maxPathLength truncates long paths before they are tracked
+	maxPathLength = 256
+	// otherPathsLabel aggregates requests for paths beyond the tracked cap
+	otherPathsLabel = "(other)"
+	// analyticsRetention is how long hourly analytics are kept
+	analyticsRetention = 90 * 24 * time.Hour
+)
+
+// AnalyticsCache aggregates per-application request analytics in memory and
+// periodically flushes them into hourly buckets in the database
+type AnalyticsCache struct {
+	db   *db.DB
+	mu   sync.Mutex
+	apps map[string]*appAnalytics
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// appAnalytics holds unflushed counts for one application's current hour
+type appAnalytics struct {
+	bucketStart time.Time
+	delta       db.AppAnalyticsBucket
+	paths       map[string]int64    // Unflushed counts per path
+	tracked     map[string]struct{} // Paths admitted this hour, bounded by maxTrackedPaths
+}
+
+// NewAnalyticsCache creates a new analytics cache
+func NewAnalyticsCache(database *db.DB) *AnalyticsCache {
+	return &AnalyticsCache{
+		db:     database,
+		apps:   make(map[string]*appAnalytics),
+		stopCh: make(chan struct{}),
+	}
+}
+
+// Start begins the background flush goroutine
+func (ac *AnalyticsCache) Start() {
+	ac.wg.Add(1)
+	go ac.syncLoop()
+}
+
+// Stop stops the background flush goroutine
+func (ac *AnalyticsCache) Stop() {
+	close(ac.stopCh)
+	ac.wg.Wait()
+	// Final flush
+	ac.flushAll()
+}
+
+// syncLoop periodically flushes analytics and prunes expired buckets
+func (ac *AnalyticsCache) syncLoop() {
+	defer ac.wg.Done()
+
+	flushTicker := time.NewTicker(1 * time.Minute)
+	pruneTicker := time.NewTicker(1 * time.Hour)
+	defer flushTicker.Stop()
+	defer pruneTicker.Stop()
+
+	for {
+		select {
+		case <-ac.stopCh:
+			return
+		case <-flushTicker.C:
+			ac.flushAll()
+		case <-pruneTicker.C:
+			if _, err := ac.db.DeleteAppAnalyticsBefore(time.Now().Add(-analyticsRetention)); err != nil {
+				log.Printf("Failed to prune app analytics: %v", err)
+			}
+		}
+	}
+}
+
+// analyticsFlush is a detached batch of counts waiting to be written
+type analyticsFlush struct {
+	appID  string
+	bucket db.AppAnalyticsBucket
+	paths  map[string]int64
+}
+
+// RecordRequest records a forwarded request's status code and path for an application
+func (ac *AnalyticsCache) RecordRequest(appID, path string, status int) {
+	if appID == "" {
+		return
+	}
+	if len(path) > maxPathLength {
+		path = path[:maxPathLength]
+	}
+
+	hourStart := time.Now().UTC().Truncate(time.Hour)
+
+	ac.mu.Lock()
+	app, exists := ac.apps[appID]
+	if !exists {
+		app = &appAnalytics{}
+		ac.apps[appID] = app
+	}
+
+	var pending *analyticsFlush
+	if !app.bucketStart.Equal(hourStart) {
+		// A new hour starts; detach the previous one and reset the tracked path set
+		pending = app.detach(appID)
+		app.bucketStart = hourStart
+		app.tracked = make(map[string]struct{})
+	}
+
+	app.delta.RequestCount++
+	switch {
+	case status >= 500:
+		app.delta.Status5xx++
+	case status >= 400:
+		app.delta.Status4xx++
+	case status >= 300:
+		app.delta.Status3xx++
+	case status >= 200:
+		app.delta.Status2xx++
+	}
+
+	if _, ok := app.tracked[path]; !ok {
+		if len(app.tracked) >= maxTrackedPaths {
+			path = otherPathsLabel
+		}
+		app.tracked[path] = struct{}{}
+	}
+	if app.paths == nil {
+		app.paths = make(map[string]int64)
+	}
+	app.paths[path]++
+	ac.mu.Unlock()
+
+	if pending != nil {
+		go ac.write(pending)
+	}
+}
+
+// detach takes the unflushed counts, resetting them (caller holds ac.mu)
+func (app *appAnalytics) detach(appID string) *analyticsFlush {
+	if app.delta.RequestCount == 0 {
+		return nil
+	}
+
+	f := &analyticsFlush{appID: appID, bucket: app.delta, paths: app.paths}
+	f.bucket.BucketStart = app.bucketStart
+
+	app.delta = db.AppAnalyticsBucket{}
+	app.paths = nil
+	return f
+}
+
+// flushAll writes all unflushed analytics to the database
+func (ac *AnalyticsCache) flushAll() {
+	hourStart := time.Now().UTC().Truncate(time.Hour)
+
+	ac.mu.Lock()
+	var pending []*analyticsFlush
+	for appID, app := range ac.apps {
+		if f := app.detach(appID); f != nil {
+			pending = append(pending, f)
+		} else if !app.bucketStart.Equal(hourStart) {
+			// Drop apps idle since a previous hour
+			delete(ac.apps, appID)
+		}
+	}
+	ac.mu.Unlock()
+
+	for _, f := range pending {
+		ac.write(f)
+	}
+}
+
+// write stores a detached batch in the database
+func (ac *AnalyticsCache) write(f *analyticsFlush) {
+	if err := ac.db.AddAppAnalytics(f.appID, f.bucket); err != nil {
+		log.Printf("Failed to flush analytics for app %s: %v", f.appID, err)
+		return
+	}
+	if err := ac.db.AddAppPathCounts(f.appID, f.bucket.BucketStart, f.paths); err != nil {
+		log.Printf("Failed to flush path stats for app %s: %v", f.appID, err)
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// apiKeyPurgeInterval is how often expired API keys are purged
+const apiKeyPurgeInterval = time.Hour
+
+// defaultAPIKeyPurgeGraceDays is how long expired API keys stay listed by default
+const defaultAPIKeyPurgeGraceDays = 30
+
+// purgeExpiredAPIKeys deletes the API keys that expired longer ago than the
+// api_key_purge grace window and audits how many were purged. Expired keys are
+// rejected whether or not they were purged yet.
+func (s *Server) purgeExpiredAPIKeys(sourceIP, actor string) (int64, *db.APIKeyPurgeSettings, error) {
+	settings := s.settingValue(db.SettingAPIKeyPurge).(*db.APIKeyPurgeSettings)
+	purged, err := s.db.DeleteAPIKeysExpiredBefore(time.Now().AddDate(0, 0, -settings.GraceDays))
+	if err != nil {
+		return 0, settings, err
+	}
+	if purged > 0 {
+		log.Printf("Purged %d API keys expired more than %d days ago (by %s)", purged, settings.GraceDays, actor)
+		target := fmt.Sprintf("%d API keys expired more than %d days ago", purged, settings.GraceDays)
+		if err := s.db.LogAdminAction(nil, db.AuditTypeAPIKeysPurged, sourceIP, actor, target); err != nil {
+			log.Printf("Failed to audit API key purge: %v", err)
+		}
+	}
+	return purged, settings, nil
+}
+
+// apiKeyPurgeRoutine periodically purges expired API keys while the
+// api_key_purge setting enables it
+func (s *Server) apiKeyPurgeRoutine() {
+	if s.db == nil {
+		return
+	}
+	ticker := time.NewTicker(apiKeyPurgeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !s.settingValue(db.SettingAPIKeyPurge).(*db.APIKeyPurgeSettings).Enabled {
+			continue
+		}
+		if _, _, err := s.purgeExpiredAPIKeys("", "system"); err != nil {
+			log.Printf("Failed to purge expired API keys: %v", err)
+		}
+	}
+}
+
+// handlePurgeExpiredAPIKeys purges expired API keys now, also while the
+// background purge is disabled
+func (s *Server) handlePurgeExpiredAPIKeys(w http.ResponseWriter, r *http.Request, adminUsername string) {
+	purged, settings, err := s.purgeExpiredAPIKeys(auth.GetClientIP(r), adminUsername)
+	if err != nil {
+		log.Printf("Failed to purge expired API keys: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success":   true,
+		"deleted":   purged,
+		"graceDays": settings.GraceDays,
+	})
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestPurgeExpiredAPIKeys(t *testing.T) {
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	createKey := func(expiresAt *time.Time) (string, *db.APIKey) {
+		rawKey, key, err := db.GenerateAPIKey(&org.ID, nil, "test", expiresAt)
+		if err != nil {
+			t.Fatalf("GenerateAPIKey() error: %v", err)
+		}
+		if err := database.CreateAPIKey(key); err != nil {
+			t.Fatalf("CreateAPIKey() error: %v", err)
+		}
+		return rawKey, key
+	}
+	longAgo := time.Now().AddDate(0, 0, -40)
+	yesterday := time.Now().AddDate(0, 0, -1)
+	_, old := createKey(&longAgo)
+	recentRaw, recent := createKey(&yesterday)
+	_, permanent := createKey(nil)
+
+	s := newTestServer(database)
+	if s.settingValue(db.SettingAPIKeyPurge).(*db.APIKeyPurgeSettings).Enabled {
+		t.Error("background purge enabled by default, want it off until an admin turns it on")
+	}
+	w := httptest.NewRecorder()
+	s.handlePurgeExpiredAPIKeys(w, httptest.NewRequest(http.MethodPost, "/admin/maintenance/purge-expired-keys", nil), "root")
+	var resp struct {
+		Deleted   int64 `json:"deleted"`
+		GraceDays int   `json:"graceDays"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if w.Code != http.StatusOK || resp.Deleted != 1 || resp.GraceDays != defaultAPIKeyPurgeGraceDays {
+		t.Errorf("purge = %d %+v, want 1 key deleted with a %d day grace window", w.Code, resp, defaultAPIKeyPurgeGraceDays)
+	}
+
+	for _, tc := range []struct {
+		key  *db.APIKey
+		kept bool
+	}{{old, false}, {recent, true}, {permanent, true}} {
+		if key, err := database.GetAPIKeyByID(tc.key.ID); err != nil || (key != nil) != tc.kept {
+			t.Errorf("key expiring %v after purge = %+v, %v, want kept %v", tc.key.ExpiresAt, key, err, tc.kept)
+		}
+	}
+
+	// Keys in the grace window are listed but no longer authenticate
+	if key, err := database.ValidateAPIKey(recentRaw); err == nil && key != nil {
+		t.Errorf("ValidateAPIKey(expired) = %+v, want rejected", key)
+	}
+
+	audit, err := database.GetAuditEvents(nil, nil, 10, 0)
+	if err != nil || len(audit) != 1 || audit[0].AuthType != db.AuditTypeAPIKeysPurged || audit[0].Actor != "root" {
+		t.Errorf("audit = %+v, %v, want one api_keys_purged entry by root", audit, err)
+	}
+
+	// Nothing left to purge is not audited
+	w = httptest.NewRecorder()
+	s.handlePurgeExpiredAPIKeys(w, httptest.NewRequest(http.MethodPost, "/admin/maintenance/purge-expired-keys", nil), "root")
+	if audit, _ := database.GetAuditEvents(nil, nil, 10, 0); w.Code != http.StatusOK || len(audit) != 1 {
+		t.Errorf("second purge = %d with %d audit entries, want 200 with 1", w.Code, len(audit))
+	}
+
+	if _, err := serverSettings[db.SettingAPIKeyPurge].parse(json.RawMessage(`{"enabled":true,"graceDays":-1}`)); err == nil {
+		t.Error("negative graceDays accepted")
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/niekvdm/digit-link/internal/db"
+	"github.com/niekvdm/digit-link/internal/protocol"
+)
+
+// bindApplication resolves the application a tunnel registers for by ID and
+// checks that the credentials have authority over it: an app API key must belong
+// to the app, an org API key or account token to its organization. Requests that
+// name a subdomain must name the app's. On rejection the application is nil and
+// the reason code and message are returned for the client.
+func (s *Server) bindApplication(appID, subdomain string, account *db.Account, apiKey *db.APIKey) (*db.Application, protocol.RegisterCode, string) {
+	if s.db == nil || (account == nil && apiKey == nil) {
+		return nil, protocol.RegisterCodeAuthRequired, "Registering by application requires a token"
+	}
+
+	app, err := s.db.GetApplicationByID(appID)
+	if err != nil {
+		log.Printf("Failed to load application %s: %v", appID, err)
+		return nil, protocol.RegisterCodeInternal, "Internal server error"
+	}
+	if app == nil {
+		return nil, protocol.RegisterCodeAppNotFound, "Application not found"
+	}
+
+	authorized := false
+	switch {
+	case apiKey != nil && apiKey.KeyType == db.KeyTypeApp:
+		authorized = apiKey.AppID != nil && *apiKey.AppID == app.ID
+	case apiKey != nil:
+		authorized = apiKey.OrgID != nil && *apiKey.OrgID == app.OrgID
+	case account != nil:
+		authorized = (account.IsAdmin && !account.IsReadOnlyAdmin()) || (account.OrgID != "" && account.OrgID == app.OrgID)
+	}
+	if !authorized {
+		// Don't reveal whether the app exists to credentials without rights to it
+		return nil, protocol.RegisterCodeAppNotFound, "Application not found"
+	}
+	if app.ReleasedAt != nil {
+		return nil, protocol.RegisterCodeAppReleased, "Application was released after being offline; restore it to connect"
+	}
+
+	if subdomain != "" && strings.ToLower(subdomain) != app.Subdomain {
+		return nil, protocol.RegisterCodeAppSubdomain, fmt.Sprintf("Application %s serves subdomain '%s'", app.ID, app.Subdomain)
+	}
+
+	return app, "", ""
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/niekvdm/digit-link/internal/db"
+	"github.com/niekvdm/digit-link/internal/protocol"
+)
+
+func TestRegisterByAppID(t *testing.T) {
+	database := newTestDB(t)
+
+	org, _ := database.CreateOrganization("acme")
+	other, _ := database.CreateOrganization("other")
+	app, err := database.CreateApplication(org.ID, "shop", "Shop")
+	if err != nil {
+		t.Fatalf("CreateApplication() error: %v", err)
+	}
+	sibling, _ := database.CreateApplication(org.ID, "blog", "Blog")
+	database.AddOrgWhitelist(org.ID, "127.0.0.1", "test client", "")
+	database.AddOrgWhitelist(other.ID, "127.0.0.1", "test client", "")
+	orgRaw, orgKey, _ := db.GenerateAPIKey(&org.ID, nil, "deploy", nil)
+	otherRaw, otherKey, _ := db.GenerateAPIKey(&other.ID, nil, "deploy", nil)
+	siblingRaw, siblingKey, _ := db.GenerateAppAPIKey(org.ID, sibling.ID, "ci", nil)
+	for _, key := range []*db.APIKey{orgKey, otherKey, siblingKey} {
+		if err := database.CreateAPIKey(key); err != nil {
+			t.Fatalf("CreateAPIKey() error: %v", err)
+		}
+	}
+
+	s := newTestServer(database)
+	ts := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer ts.Close()
+
+	register := func(req protocol.RegisterRequest) (*websocket.Conn, protocol.RegisterResponse) {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/_tunnel", nil)
+		if err != nil {
+			t.Fatalf("Dial() error: %v", err)
+		}
+		reg, _ := json.Marshal(protocol.Message{Type: protocol.TypeRegisterRequest, Payload: req})
+		conn.WriteMessage(websocket.TextMessage, reg)
+		var regResp struct {
+			Payload protocol.RegisterResponse `json:"payload"`
+		}
+		if err := conn.ReadJSON(&regResp); err != nil {
+			t.Fatalf("reading registration response: %v", err)
+		}
+		return conn, regResp.Payload
+	}
+
+	rejected := []struct {
+		name    string
+		req     protocol.RegisterRequest
+		wantErr string
+	}{
+		{"unknown app", protocol.RegisterRequest{Token: orgRaw, AppID: "missing"}, "Application not found"},
+		{"other org's key", protocol.RegisterRequest{Token: otherRaw, AppID: app.ID}, "Application not found"},
+		{"sibling app key", protocol.RegisterRequest{Token: siblingRaw, AppID: app.ID}, "Application not found"},
+		{"subdomain mismatch", protocol.RegisterRequest{Token: orgRaw, AppID: app.ID, Subdomain: "blog"}, "serves subdomain 'shop'"},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, resp := register(tt.req)
+			defer conn.Close()
+			if resp.Success || !strings.Contains(resp.Error, tt.wantErr) {
+				t.Errorf("registration = %+v, want error containing %q", resp, tt.wantErr)
+			}
+		})
+	}
+
+	conn, resp := register(protocol.RegisterRequest{Token: orgRaw, AppID: app.ID})
+	defer conn.Close()
+	if !resp.Success || resp.Subdomain != "shop" {
+		t.Fatalf("registration = %+v, want success on the app's subdomain", resp)
+	}
+	s.mu.RLock()
+	tun := s.tunnels["shop"]
+	s.mu.RUnlock()
+	if tun == nil || tun.AppID != app.ID || tun.OrgID != org.ID {
+		t.Errorf("tunnel = %+v, want app %s in org %s", tun, app.ID, org.ID)
+	}
+}
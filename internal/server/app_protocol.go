@@ -0,0 +1,60 @@
+package server
+
+import (
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// altSvcHTTP2 advertises HTTP/2 for a day on the port the visitor reached the
+// server on, 443 unless the Host header names another
+func altSvcHTTP2(r *http.Request) string {
+	port := "443"
+	if _, p, err := net.SplitHostPort(r.Host); err == nil && p != "" {
+		port = p
+	}
+	return fmt.Sprintf(`h2=":%s"; ma=86400`, port)
+}
+
+// isEventStream reports whether a response content type announces server-sent
+// events, which are streamed without streaming mode
+func isEventStream(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "text/event-stream"
+}
+
+// isChunkedRequest reports whether the visitor sent the request body chunked
+func isChunkedRequest(r *http.Request) bool {
+	return slices.Contains(r.TransferEncoding, "chunked")
+}
+
+// applyAppProtocol returns the headers of a tunneled response adjusted to the app's
+// protocol settings. The tunnel client reports a chunked response from the local
+// service as Transfer-Encoding; by default the edge terminates it and the
+// buffered body is sent the way the server frames it. Apps forwarding chunked
+// keep the encoding, unless the response cannot have a body. Without an app
+// both settings are off.
+func (s *Server) applyAppProtocol(headers map[string]string, r *http.Request, status int, app *db.Application) map[string]string {
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+
+	if te, ok := headers["Transfer-Encoding"]; ok {
+		delete(headers, "Transfer-Encoding")
+		if app != nil && app.ForwardChunked && strings.EqualFold(te, "chunked") && bodyAllowedForStatus(status) && r.Method != http.MethodHead {
+			headers["Transfer-Encoding"] = "chunked"
+			delete(headers, "Content-Length")
+		}
+	}
+
+	// Alt-Svc h2 names a TLS endpoint, so it is only sent when visitors use HTTPS
+	if app != nil && app.HTTP2 && s.scheme == "https" && headers["Alt-Svc"] == "" {
+		headers["Alt-Svc"] = altSvcHTTP2(r)
+	}
+	return headers
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestAppProtocolSettings(t *testing.T) {
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	if _, err := database.CreateApplication(org.ID, "plain", "plain"); err != nil {
+		t.Fatalf("CreateApplication() error: %v", err)
+	}
+	stream, err := database.CreateApplication(org.ID, "stream", "stream")
+	if err != nil {
+		t.Fatalf("CreateApplication() error: %v", err)
+	}
+	database.UpdateApplicationForwardChunked(stream.ID, true)
+	database.UpdateApplicationHTTP2(stream.ID, true)
+	if app, _ := database.GetApplicationByID(stream.ID); !app.ForwardChunked || !app.HTTP2 {
+		t.Fatalf("application = %+v, want forwardChunked and http2", app)
+	}
+
+	s := newTestServer(database)
+	s.scheme = "https"
+
+	chunkedRequest := func(method string) *http.Request {
+		r := httptest.NewRequest(method, "/upload", strings.NewReader("hello"))
+		r.TransferEncoding = []string{"chunked"}
+		return r
+	}
+	if te := s.forwardedHeaders(chunkedRequest(http.MethodPost), s.authMiddleware.appForSubdomain("stream"))["Transfer-Encoding"]; te != "chunked" {
+		t.Errorf("forwarded Transfer-Encoding for stream = %q, want chunked", te)
+	}
+	if te, ok := s.forwardedHeaders(chunkedRequest(http.MethodPost), s.authMiddleware.appForSubdomain("plain"))["Transfer-Encoding"]; ok {
+		t.Errorf("forwarded Transfer-Encoding for plain = %q, want the body buffered", te)
+	}
+
+	chunkedResponse := func() map[string]string {
+		return map[string]string{"Transfer-Encoding": "chunked", "Content-Length": "5"}
+	}
+	tests := []struct {
+		name      string
+		subdomain string
+		method    string
+		status    int
+		wantTE    string
+		wantAlt   bool
+	}{
+		{"terminated by default", "plain", http.MethodGet, http.StatusOK, "", false},
+		{"forwarded", "stream", http.MethodGet, http.StatusOK, "chunked", true},
+		{"no body for 304", "stream", http.MethodGet, http.StatusNotModified, "", true},
+		{"no body for HEAD", "stream", http.MethodHead, http.StatusOK, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := s.applyAppProtocol(chunkedResponse(), httptest.NewRequest(tt.method, "/", nil), tt.status, s.authMiddleware.appForSubdomain(tt.subdomain))
+			if headers["Transfer-Encoding"] != tt.wantTE {
+				t.Errorf("Transfer-Encoding = %q, want %q", headers["Transfer-Encoding"], tt.wantTE)
+			}
+			if tt.wantTE != "" && headers["Content-Length"] != "" {
+				t.Error("chunked response kept its Content-Length")
+			}
+			if (headers["Alt-Svc"] == `h2=":443"; ma=86400`) != tt.wantAlt {
+				t.Errorf("Alt-Svc = %q, want advertised: %v", headers["Alt-Svc"], tt.wantAlt)
+			}
+		})
+	}
+
+	// Alt-Svc names the port the visitor used
+	app := s.authMiddleware.appForSubdomain("stream")
+	r := httptest.NewRequest(http.MethodGet, "https://stream.link.test:8443/", nil)
+	if headers := s.applyAppProtocol(nil, r, http.StatusOK, app); headers["Alt-Svc"] != `h2=":8443"; ma=86400` {
+		t.Errorf("Alt-Svc on port 8443 = %q, want h2 on :8443", headers["Alt-Svc"])
+	}
+
+	// The local service's own Alt-Svc wins, and plain HTTP never advertises h2
+	if headers := s.applyAppProtocol(map[string]string{"Alt-Svc": "clear"}, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, app); headers["Alt-Svc"] != "clear" {
+		t.Errorf("Alt-Svc = %q, want the backend's", headers["Alt-Svc"])
+	}
+	s.scheme = "http"
+	if headers := s.applyAppProtocol(nil, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, app); headers["Alt-Svc"] != "" {
+		t.Errorf("Alt-Svc over http = %q, want none", headers["Alt-Svc"])
+	}
+}
+
+func TestStreamingMode(t *testing.T) {
+	release := make(chan struct{})
+	var acceptEncoding atomic.Value
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding.Store(r.Header.Get("Accept-Encoding"))
+		if r.URL.Path == "/events" {
+			w.Header().Set("Content-Type", "text/event-stream")
+		} else {
+			w.Header().Set("Content-Type", "text/plain")
+		}
+		fmt.Fprint(w, "data: 1\n\n")
+		w.(http.Flusher).Flush()
+		<-release
+		fmt.Fprint(w, "data: 2\n\n")
+	}))
+	defer backend.Close()
+
+	serverSession := newTestTCPSession(t, backend.URL)
+
+	database := newTestDB(t)
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	for subdomain, streamingMode := range map[string]bool{"plain": false, "live": true} {
+		app, err := database.CreateApplication(org.ID, subdomain, subdomain)
+		if err != nil {
+			t.Fatalf("CreateApplication() error: %v", err)
+		}
+		if err := database.UpdateApplicationStreamingMode(app.ID, streamingMode); err != nil {
+			t.Fatalf("UpdateApplicationStreamingMode() error: %v", err)
+		}
+	}
+	serverSession.SetAccountInfo("", org.ID, "")
+
+	s := newTestServer(database)
+	var subdomain string
+	visitor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.forwardRequestViaTCP(w, r, serverSession, subdomain, s.authMiddleware.appForSubdomain(subdomain))
+	}))
+	defer visitor.Close()
+
+	// firstEvent reports whether the first event arrives while the backend holds back the second
+	firstEvent := func(path string) bool {
+		t.Helper()
+		resp, err := http.Get(visitor.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s error: %v", path, err)
+		}
+		defer resp.Body.Close()
+		events := make(chan string, 2)
+		go func() {
+			reader := bufio.NewReader(resp.Body)
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					close(events)
+					return
+				}
+				if strings.HasPrefix(line, "data: ") {
+					events <- line
+				}
+			}
+		}()
+		defer func() {
+			release <- struct{}{}
+			for range events {
+			}
+		}()
+		select {
+		case event := <-events:
+			return event == "data: 1\n"
+		case <-time.After(time.Second):
+			return false
+		}
+	}
+
+	// Server-sent events stream without streaming mode
+	subdomain = "plain"
+	if !firstEvent("/events") {
+		t.Error("plain app: first event was not delivered before the response completed")
+	}
+	if got := acceptEncoding.Load(); got == "identity" {
+		t.Errorf("plain app: Accept-Encoding = %q, want the visitor's", got)
+	}
+
+	// Streaming mode relays any response as it arrives, also with the org's streaming feature off
+	disabled := false
+	if err := database.SetOrgFeatureFlags(org.ID, map[string]*bool{db.FeatureStreaming: &disabled}); err != nil {
+		t.Fatalf("SetOrgFeatureFlags() error: %v", err)
+	}
+	subdomain = "live"
+	if !firstEvent("/plain") {
+		t.Error("streaming mode: first chunk was not delivered before the response completed")
+	}
+	if got := acceptEncoding.Load(); got != "identity" {
+		t.Errorf("streaming mode: Accept-Encoding = %q, want identity", got)
+	}
+
+	// Without streaming mode the same response is buffered
+	subdomain = "plain"
+	if firstEvent("/plain") {
+		t.Error("plain app: text/plain response was streamed")
+	}
+}
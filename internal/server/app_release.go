@@ -0,0 +1,222 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// appReleaseInterval is how often applications are checked for inactivity
+const appReleaseInterval = time.Hour
+
+// defaultReleaseInactiveDays is the inactivity window of organizations that
+// enable the release_inactive_apps flag while their plan sets none
+const defaultReleaseInactiveDays = 90
+
+// releaseInactiveDays returns after how many days offline the organization's
+// applications lose their subdomain, or 0 when they keep it. Organizations opt
+// in through their plan's window or the release_inactive_apps feature flag.
+func (s *Server) releaseInactiveDays(orgID string) (int, error) {
+	plan, err := s.db.GetPlanForOrganization(orgID)
+	if err != nil {
+		return 0, err
+	}
+	if plan != nil && plan.ReleaseInactiveDays != nil {
+		return *plan.ReleaseInactiveDays, nil
+	}
+	if s.featureEnabled(orgID, db.FeatureReleaseInactiveApps) {
+		return defaultReleaseInactiveDays, nil
+	}
+	return 0, nil
+}
+
+// subdomainConnected reports whether a WebSocket or TCP tunnel is serving the subdomain
+func (s *Server) subdomainConnected(subdomain string) bool {
+	s.mu.RLock()
+	_, ok := s.tunnels[subdomain]
+	s.mu.RUnlock()
+	if !ok && s.tunnelListener != nil {
+		_, ok = s.tunnelListener.GetSession(subdomain)
+	}
+	return ok
+}
+
+// releaseInactiveApps releases the subdomains of applications whose tunnels
+// have been offline longer than their organization's window. The applications
+// and their settings are kept, so they can be restored.
+func (s *Server) releaseInactiveApps() {
+	if s.db == nil {
+		return
+	}
+	orgs, err := s.db.ListOrganizations()
+	if err != nil {
+		log.Printf("Failed to list organizations for app release: %v", err)
+		return
+	}
+
+	for _, org := range orgs {
+		days, err := s.releaseInactiveDays(org.ID)
+		if err != nil {
+			log.Printf("Failed to get inactivity window of org %s: %v", org.ID, err)
+			continue
+		}
+		if days <= 0 {
+			continue
+		}
+		apps, err := s.db.ListInactiveApplications(org.ID, time.Now().AddDate(0, 0, -days))
+		if err != nil {
+			log.Printf("Failed to list inactive applications of org %s: %v", org.ID, err)
+			continue
+		}
+		for _, app := range apps {
+			if s.subdomainConnected(app.Subdomain) {
+				continue
+			}
+			s.releaseApplication(org.ID, app, days)
+		}
+	}
+}
+
+// releaseApplication releases one inactive application, audits it and tells
+// the organization on its event stream
+func (s *Server) releaseApplication(orgID string, app *db.Application, days int) {
+	released, err := s.db.ReleaseApplication(app.ID)
+	if err != nil {
+		log.Printf("Failed to release application %s: %v", app.Subdomain, err)
+		return
+	}
+	if !released {
+		return
+	}
+	if s.authMiddleware != nil {
+		s.authMiddleware.InvalidateSubdomainCache(app.Subdomain)
+	}
+
+	reason := fmt.Sprintf("No tunnel connected for %d days", days)
+	log.Printf("Released subdomain %s of application %s: %s", app.Subdomain, app.ID, reason)
+	target := fmt.Sprintf("%s (%s): %s", app.Subdomain, app.ID, reason)
+	if err := s.db.LogAdminAction(&orgID, db.AuditTypeAppReleased, "", "system", target); err != nil {
+		log.Printf("Failed to audit application release: %v", err)
+	}
+	s.publishEvent(Event{
+		Type:      EventAppReleased,
+		Subdomain: app.Subdomain,
+		OrgID:     orgID,
+		AppID:     app.ID,
+		Reason:    reason,
+	})
+}
+
+// appReleaseRoutine periodically releases the subdomains of inactive applications
+func (s *Server) appReleaseRoutine() {
+	if s.db == nil {
+		return
+	}
+	ticker := time.NewTicker(appReleaseInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.releaseInactiveApps()
+	}
+}
+
+// restoreApplication gives a released application a subdomain again: the one
+// it had, or another when that was taken since. It returns the status, error
+// code and message to reply with when the application cannot be restored.
+func (s *Server) restoreApplication(r *http.Request, app *db.Application, actor string) (int, string, string) {
+	if app.ReleasedAt == nil {
+		return http.StatusConflict, errCodeConflict, "Application is not released"
+	}
+
+	limitRequestBody(r)
+	var req struct {
+		Subdomain string `json:"subdomain,omitempty"` // Defaults to the released subdomain
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		return http.StatusBadRequest, errCodeBadRequest, "Invalid request body"
+	}
+
+	subdomain := strings.ToLower(req.Subdomain)
+	if subdomain == "" {
+		subdomain = app.ReleasedSubdomain
+	} else if err := s.subdomainPolicy.Validate(subdomain); err != nil {
+		return http.StatusBadRequest, errCodeBadRequest, err.Error()
+	}
+
+	available, err := s.db.IsSubdomainAvailable(subdomain)
+	if err != nil {
+		log.Printf("Failed to check subdomain: %v", err)
+		return http.StatusInternalServerError, errCodeInternal, "Internal server error"
+	}
+	if !available || s.subdomainConnected(subdomain) {
+		return http.StatusConflict, errCodeConflict, "Subdomain " + subdomain + " is in use; restore with another subdomain"
+	}
+
+	if err := s.db.RestoreApplication(app.ID, subdomain); err != nil {
+		log.Printf("Failed to restore application: %v", err)
+		return http.StatusInternalServerError, errCodeInternal, "Internal server error"
+	}
+	if s.authMiddleware != nil {
+		s.authMiddleware.InvalidateSubdomainCache(subdomain)
+	}
+
+	log.Printf("Application %s restored as %s by %s", app.ID, subdomain, actor)
+	if err := s.db.LogAdminAction(&app.OrgID, db.AuditTypeAppRestored, auth.GetClientIP(r), actor, subdomain+" ("+app.ID+")"); err != nil {
+		log.Printf("Failed to audit application restore: %v", err)
+	}
+	app.Subdomain = subdomain
+	app.ReleasedAt = nil
+	app.ReleasedSubdomain = ""
+	return http.StatusOK, "", ""
+}
+
+// handleRestoreApplication restores a released application
+func (s *Server) handleRestoreApplication(w http.ResponseWriter, r *http.Request, appID, adminUsername string) {
+	app, err := s.db.GetApplicationByID(appID)
+	if err != nil {
+		log.Printf("Failed to get application: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+	if app == nil {
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Application not found")
+		return
+	}
+
+	if status, code, msg := s.restoreApplication(r, app, adminUsername); msg != "" {
+		writeError(w, r, status, code, msg)
+		return
+	}
+	jsonResponse(w, map[string]interface{}{"success": true, "application": app})
+}
+
+// handleOrgRestoreApplication restores one of the organization's released applications
+func (s *Server) handleOrgRestoreApplication(w http.ResponseWriter, r *http.Request, orgCtx *OrgContext, appID string) {
+	app, err := s.verifyOrgOwnership(orgCtx, appID)
+	if err != nil {
+		log.Printf("Failed to get application: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if app == nil {
+		jsonError(w, "Application not found", http.StatusNotFound)
+		return
+	}
+
+	if status, _, msg := s.restoreApplication(r, app, orgCtx.Username); msg != "" {
+		jsonError(w, msg, status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"application": app,
+	})
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/db"
+	"github.com/niekvdm/digit-link/internal/protocol"
+)
+
+func TestReleaseInactiveApps(t *testing.T) {
+	database := newTestDB(t)
+
+	thirty := 30
+	plan, err := database.CreatePlan(db.CreatePlanInput{Name: "Shared", ReleaseInactiveDays: &thirty})
+	if err != nil {
+		t.Fatalf("CreatePlan() error: %v", err)
+	}
+	org, err := database.CreateOrganizationWithPlan("acme", &plan.ID)
+	if err != nil {
+		t.Fatalf("CreateOrganizationWithPlan() error: %v", err)
+	}
+	other, err := database.CreateOrganization("globex")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+
+	longAgo := time.Now().AddDate(0, 0, -60)
+	createApp := func(orgID, subdomain string, createdAt time.Time) *db.Application {
+		app, err := database.CreateApplication(orgID, subdomain, subdomain)
+		if err != nil {
+			t.Fatalf("CreateApplication(%s) error: %v", subdomain, err)
+		}
+		if _, err := database.Conn().Exec(`UPDATE applications SET created_at = ? WHERE id = ?`, createdAt, app.ID); err != nil {
+			t.Fatalf("backdating %s: %v", subdomain, err)
+		}
+		return app
+	}
+	stale := createApp(org.ID, "stale", longAgo)
+	recent := createApp(org.ID, "recent", longAgo)
+	fresh := createApp(org.ID, "fresh", time.Now())
+	optedOut := createApp(other.ID, "kept", longAgo)
+	live := createApp(org.ID, "live", longAgo)
+
+	tunnel, err := database.CreateTunnel("", "recent", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("CreateTunnel() error: %v", err)
+	}
+	database.UpdateTunnelAppID(tunnel.ID, recent.ID)
+	if _, err := database.Conn().Exec(`UPDATE tunnels SET created_at = ?, closed_at = ? WHERE id = ?`,
+		longAgo, time.Now().AddDate(0, 0, -5), tunnel.ID); err != nil {
+		t.Fatalf("backdating tunnel: %v", err)
+	}
+
+	s := newTestServer(database)
+	s.tunnels = map[string]*Tunnel{"live": {Subdomain: "live", AppID: live.ID}}
+	s.releaseInactiveApps()
+
+	released := func(app *db.Application) *db.Application {
+		t.Helper()
+		got, err := database.GetApplicationByID(app.ID)
+		if err != nil || got == nil {
+			t.Fatalf("GetApplicationByID(%s) = %v, %v", app.ID, got, err)
+		}
+		return got
+	}
+	if got := released(stale); got.ReleasedAt == nil || got.Subdomain != "" || got.ReleasedSubdomain != "stale" {
+		t.Fatalf("stale app: releasedAt %v, subdomain %q, releasedSubdomain %q; want released from stale",
+			got.ReleasedAt, got.Subdomain, got.ReleasedSubdomain)
+	}
+	for _, app := range []*db.Application{recent, fresh, optedOut, live} {
+		if got := released(app); got.ReleasedAt != nil {
+			t.Errorf("app %s released, want it kept", app.Subdomain)
+		}
+	}
+
+	// The subdomain is free, and the application can't be connected to
+	if app, _ := database.GetApplicationBySubdomain("stale"); app != nil {
+		t.Errorf("GetApplicationBySubdomain(stale) = %v, want nil after release", app.ID)
+	}
+	if available, _ := database.IsSubdomainAvailable("stale"); !available {
+		t.Error("stale not available after release")
+	}
+	admin := &db.Account{IsAdmin: true}
+	if _, code, _ := s.bindApplication(stale.ID, "", admin, nil); code != protocol.RegisterCodeAppReleased {
+		t.Errorf("bindApplication(released) code = %q, want %q", code, protocol.RegisterCodeAppReleased)
+	}
+
+	// The organization opting in by feature flag uses the default window
+	yes := true
+	if err := database.SetOrgFeatureFlags(other.ID, map[string]*bool{db.FeatureReleaseInactiveApps: &yes}); err != nil {
+		t.Fatalf("SetOrgFeatureFlags() error: %v", err)
+	}
+	s.featureFlags = newFeatureFlagCache(database)
+	s.releaseInactiveApps()
+	if got := released(optedOut); got.ReleasedAt != nil {
+		t.Errorf("kept app released within the %d-day default window", defaultReleaseInactiveDays)
+	}
+
+	events, err := database.GetAuditEvents(&org.ID, nil, 10, 0)
+	if err != nil {
+		t.Fatalf("GetAuditEvents() error: %v", err)
+	}
+	audited := 0
+	for _, event := range events {
+		if event.AuthType == db.AuditTypeAppReleased {
+			audited++
+		}
+	}
+	if audited != 1 {
+		t.Errorf("%d app_released audit events, want 1", audited)
+	}
+
+	orgCtx := &OrgContext{OrgID: org.ID, Username: "alice"}
+	restore := func(appID, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/org/applications/"+appID+"/restore", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		s.handleOrgRestoreApplication(w, r, orgCtx, appID)
+		return w
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPut, "/org/applications/"+stale.ID, strings.NewReader(`{"name":"stale"}`))
+	r.Header.Set("Content-Type", "application/json")
+	s.handleOrgUpdateApplication(w, r, orgCtx, stale.ID)
+	if w.Code != http.StatusConflict {
+		t.Errorf("update released app = %d, want 409", w.Code)
+	}
+
+	// Someone else took the subdomain in the meantime
+	if _, err := database.CreateApplication(org.ID, "stale", "squatter"); err != nil {
+		t.Fatalf("CreateApplication(stale) error: %v", err)
+	}
+	if w := restore(stale.ID, ""); w.Code != http.StatusConflict {
+		t.Errorf("restore onto a taken subdomain = %d, want 409: %s", w.Code, w.Body.String())
+	}
+	if w := restore(stale.ID, `{"subdomain":"stale-again"}`); w.Code != http.StatusOK {
+		t.Fatalf("restore with another subdomain = %d: %s", w.Code, w.Body.String())
+	}
+	if got := released(stale); got.ReleasedAt != nil || got.Subdomain != "stale-again" {
+		t.Errorf("restored app: releasedAt %v, subdomain %q; want stale-again", got.ReleasedAt, got.Subdomain)
+	}
+	if w := restore(stale.ID, ""); w.Code != http.StatusConflict {
+		t.Errorf("restore of an app that isn't released = %d, want 409", w.Code)
+	}
+
+	// A restore starts the inactivity window over
+	s.releaseInactiveApps()
+	if got := released(stale); got.ReleasedAt != nil {
+		t.Error("app released again right after its restore")
+	}
+}
@@ -2,12 +2,15 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
 )
 
 // maxAuthRequestBodySize is the maximum allowed request body size for auth endpoints (64KB)
@@ -44,6 +47,24 @@ type LoginResponse struct {
 	OrgName      string `json:"orgName,omitempty"`     // Organization name
 	IsOrgAdmin   bool   `json:"isOrgAdmin,omitempty"`  // Is org admin
 	Error        string `json:"error,omitempty"`
+	PasswordChangeRequired
+
+	// Set when an admin whose TOTP was reset logs in with password only to re-enroll
+	TOTPGrace       bool       `json:"totpGrace,omitempty"`
+	TOTPGraceEndsAt *time.Time `json:"totpGraceEndsAt,omitempty"`
+}
+
+// PasswordChangeRequired is set in login responses instead of a session token
+// when the account must change its password first
+type PasswordChangeRequired struct {
+	MustChangePassword  bool   `json:"mustChangePassword,omitempty"`
+	PasswordChangeToken string `json:"passwordChangeToken,omitempty"` // Only valid for POST /auth/password/change
+}
+
+// PasswordChangeRequest contains the new password for an account that must change it
+type PasswordChangeRequest struct {
+	PasswordChangeToken string `json:"passwordChangeToken"`
+	NewPassword         string `json:"newPassword"`
 }
 
 // TOTPSetupRequest contains the TOTP setup verification
@@ -63,6 +84,7 @@ type TOTPSetupResponse struct {
 	OrgName     string `json:"orgName,omitempty"`
 	IsOrgAdmin  bool   `json:"isOrgAdmin,omitempty"`
 	Error       string `json:"error,omitempty"`
+	PasswordChangeRequired
 }
 
 // TOTPVerifyRequest contains the TOTP verification
@@ -80,6 +102,7 @@ type TOTPVerifyResponse struct {
 	OrgName     string `json:"orgName,omitempty"`
 	IsOrgAdmin  bool   `json:"isOrgAdmin,omitempty"`
 	Error       string `json:"error,omitempty"`
+	PasswordChangeRequired
 }
 
 // CheckAccountRequest contains the username to check
@@ -114,8 +137,10 @@ func (s *Server) handleAuth(w http.ResponseWriter, r *http.Request) {
 		s.handleTOTPSetupPost(w, r)
 	case path == "/totp/verify" && r.Method == http.MethodPost:
 		s.handleTOTPVerify(w, r)
+	case path == "/password/change" && r.Method == http.MethodPost:
+		s.handlePasswordChange(w, r)
 	default:
-		http.Error(w, `{"error": "Not found"}`, http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Not found")
 	}
 }
 
@@ -206,6 +231,7 @@ func (s *Server) handleCheckAccount(w http.ResponseWriter, r *http.Request) {
 
 // handleLogin handles username/password authentication for both admin and org accounts
 func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
 	if !validateAuthJSONRequest(w, r) {
 		return
 	}
@@ -252,21 +278,31 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if account == nil || !account.Active {
+		// Burn the same bcrypt time as a real check so timing doesn't reveal the username exists
+		auth.VerifyDummyPassword(req.Password)
 		// Record failed attempt for rate limiting
 		if s.loginRateLimiter != nil {
 			clientIP := auth.GetClientIP(r)
 			s.loginRateLimiter.RecordFailure(auth.IPRateLimitKey(clientIP))
 		}
+		s.failureDelay.Wait(r.Context(), start)
 		// Use same error message to prevent username enumeration
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(LoginResponse{Error: "Invalid credentials"})
 		return
 	}
 
-	// Check if account has password set
+	// An account without a password fails like a wrong password, so the answer
+	// doesn't reveal which accounts exist or how they log in
 	if account.PasswordHash == "" {
+		auth.VerifyDummyPassword(req.Password)
+		if s.loginRateLimiter != nil {
+			clientIP := auth.GetClientIP(r)
+			s.loginRateLimiter.RecordFailure(auth.IPRateLimitKey(clientIP))
+		}
+		s.failureDelay.Wait(r.Context(), start)
 		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(LoginResponse{Error: "Account not configured for password login"})
+		json.NewEncoder(w).Encode(LoginResponse{Error: "Invalid credentials"})
 		return
 	}
 
@@ -278,6 +314,7 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 			s.loginRateLimiter.RecordFailure(auth.IPRateLimitKey(clientIP))
 		}
 		log.Printf("Failed login attempt from IP: %s", auth.GetClientIP(r))
+		s.failureDelay.Wait(r.Context(), start)
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(LoginResponse{Error: "Invalid credentials"})
 		return
@@ -312,7 +349,12 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	// If TOTP not required and not enabled, issue token directly
 	if !requiresTOTP && !account.TOTPEnabled {
 		// Generate JWT token directly (no TOTP step)
-		token, err := auth.GenerateJWTWithOrg(account.ID, account.Username, account.IsAdmin, account.OrgID)
+		token, passwordChange, err := s.sessionToken(account, account.IsAdmin, r)
+		if errors.Is(err, errLoginSessionLimit) {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(LoginResponse{Error: loginSessionLimitMessage})
+			return
+		}
 		if err != nil {
 			log.Printf("Failed to generate JWT: %v", err)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -332,16 +374,49 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 		s.db.UpdateAccountLastUsed(account.ID)
 
 		json.NewEncoder(w).Encode(LoginResponse{
-			Success:     true,
-			Token:       token,
-			AccountType: accountType,
-			OrgID:       account.OrgID,
-			OrgName:     orgName,
-			IsOrgAdmin:  account.IsOrgAdmin,
+			Success:                true,
+			Token:                  token,
+			AccountType:            accountType,
+			OrgID:                  account.OrgID,
+			OrgName:                orgName,
+			IsOrgAdmin:             account.IsOrgAdmin,
+			PasswordChangeRequired: passwordChange,
 		})
 		return
 	}
 
+	// An admin whose TOTP was reset may only re-enroll with password within the grace period
+	graceEndsAt, err := s.adminTOTPGraceEndsAt(account)
+	if err != nil {
+		log.Printf("Failed to get TOTP reset: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(LoginResponse{Error: "Internal error"})
+		return
+	}
+	if graceEndsAt != nil {
+		clientIP := auth.GetClientIP(r)
+		event := &db.AuditEvent{
+			AuthType:     db.AuditTypeTOTPGraceLogin,
+			Success:      time.Now().Before(*graceEndsAt),
+			SourceIP:     clientIP,
+			UserIdentity: account.Username,
+			Actor:        account.Username,
+		}
+		if !event.Success {
+			event.FailureReason = "TOTP re-enrollment grace period expired"
+		}
+		if err := s.db.LogAuthEvent(event); err != nil {
+			log.Printf("Failed to audit TOTP grace login: %v", err)
+		}
+		if !event.Success {
+			log.Printf("Blocked password-only login for admin %s: TOTP re-enrollment grace period expired at %s", account.Username, graceEndsAt.Format(time.RFC3339))
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(LoginResponse{Error: "TOTP re-enrollment period expired. Ask another admin to reset your TOTP again."})
+			return
+		}
+		log.Printf("Password-only login for admin %s to re-enroll TOTP (grace period ends %s) from IP: %s", account.Username, graceEndsAt.Format(time.RFC3339), clientIP)
+	}
+
 	// TOTP is required - generate pending token for TOTP step
 	pendingToken, err := auth.GeneratePendingToken(account.ID, account.Username)
 	if err != nil {
@@ -355,11 +430,13 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	if !account.TOTPEnabled || account.TOTPSecret == "" {
 		// User needs to set up TOTP
 		json.NewEncoder(w).Encode(LoginResponse{
-			Success:      true,
-			PendingToken: pendingToken,
-			NeedsSetup:   true,
-			AccountType:  accountType,
-			OrgID:        account.OrgID,
+			Success:         true,
+			PendingToken:    pendingToken,
+			NeedsSetup:      true,
+			AccountType:     accountType,
+			OrgID:           account.OrgID,
+			TOTPGrace:       graceEndsAt != nil,
+			TOTPGraceEndsAt: graceEndsAt,
 		})
 		return
 	}
@@ -374,6 +451,13 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// generateTOTPSecret generates a TOTP secret for an account, named in
+// authenticator apps after the totp setting
+func (s *Server) generateTOTPSecret(username string) (*auth.TOTPKey, error) {
+	settings := s.settingValue(db.SettingTOTP).(*db.TOTPSettings)
+	return auth.GenerateTOTPSecret(settings.Issuer, strings.ReplaceAll(settings.Label, db.TOTPLabelUsername, username))
+}
+
 // handleTOTPSetupGet generates a new TOTP secret for setup
 func (s *Server) handleTOTPSetupGet(w http.ResponseWriter, r *http.Request) {
 	pendingToken := r.URL.Query().Get("token")
@@ -400,7 +484,7 @@ func (s *Server) handleTOTPSetupGet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Generate TOTP secret
-	totpKey, err := auth.GenerateTOTPSecret(username)
+	totpKey, err := s.generateTOTPSecret(username)
 	if err != nil {
 		log.Printf("Failed to generate TOTP secret: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -418,7 +502,7 @@ func (s *Server) handleTOTPSetupGet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Store the secret (not enabled until verified)
-	if err := s.db.UpdateAccountTOTP(accountID, encryptedSecret, false); err != nil {
+	if err := s.db.BeginAccountTOTPSetup(accountID, encryptedSecret); err != nil {
 		log.Printf("Failed to store TOTP secret: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(TOTPSetupResponse{Error: "Failed to setup TOTP"})
@@ -434,6 +518,7 @@ func (s *Server) handleTOTPSetupGet(w http.ResponseWriter, r *http.Request) {
 
 // handleTOTPSetupPost verifies the TOTP code and enables TOTP
 func (s *Server) handleTOTPSetupPost(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
 	var req TOTPSetupRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -463,6 +548,34 @@ func (s *Server) handleTOTPSetupPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A pending token can outlive the re-enrollment grace period it was issued in
+	graceEndsAt, err := s.adminTOTPGraceEndsAt(account)
+	if err != nil {
+		log.Printf("Failed to get TOTP reset: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(TOTPSetupResponse{Error: "Failed to verify TOTP"})
+		return
+	}
+	if graceEndsAt != nil && !time.Now().Before(*graceEndsAt) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(TOTPSetupResponse{Error: "TOTP re-enrollment period expired. Ask another admin to reset your TOTP again."})
+		return
+	}
+
+	// An abandoned setup's secret is cleared after the setup timeout
+	expired, err := s.totpSetupExpired(account)
+	if err != nil {
+		log.Printf("Failed to check TOTP setup: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(TOTPSetupResponse{Error: "Failed to verify TOTP"})
+		return
+	}
+	if expired || account.TOTPSecret == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(TOTPSetupResponse{Error: "TOTP setup expired. Start the setup again."})
+		return
+	}
+
 	// Decrypt the TOTP secret
 	secret, err := auth.DecryptTOTPSecret(account.TOTPSecret)
 	if err != nil {
@@ -474,6 +587,7 @@ func (s *Server) handleTOTPSetupPost(w http.ResponseWriter, r *http.Request) {
 
 	// Validate the code
 	if !auth.ValidateTOTPWithWindow(secret, req.Code) {
+		s.failureDelay.Wait(r.Context(), start)
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(TOTPSetupResponse{Error: "Invalid TOTP code"})
 		return
@@ -488,7 +602,12 @@ func (s *Server) handleTOTPSetupPost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Generate JWT token with org context
-	token, err := auth.GenerateJWTWithOrg(account.ID, account.Username, account.IsAdmin, account.OrgID)
+	token, passwordChange, err := s.sessionToken(account, account.IsAdmin, r)
+	if errors.Is(err, errLoginSessionLimit) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(TOTPSetupResponse{Error: loginSessionLimitMessage})
+		return
+	}
 	if err != nil {
 		log.Printf("Failed to generate JWT: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -518,17 +637,19 @@ func (s *Server) handleTOTPSetupPost(w http.ResponseWriter, r *http.Request) {
 	s.db.UpdateAccountLastUsed(accountID)
 
 	json.NewEncoder(w).Encode(TOTPSetupResponse{
-		Success:     true,
-		Token:       token,
-		AccountType: accountType,
-		OrgID:       account.OrgID,
-		OrgName:     orgName,
-		IsOrgAdmin:  account.IsOrgAdmin,
+		Success:                true,
+		Token:                  token,
+		AccountType:            accountType,
+		OrgID:                  account.OrgID,
+		OrgName:                orgName,
+		IsOrgAdmin:             account.IsOrgAdmin,
+		PasswordChangeRequired: passwordChange,
 	})
 }
 
 // handleTOTPVerify verifies the TOTP code and issues JWT
 func (s *Server) handleTOTPVerify(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
 	if !validateAuthJSONRequest(w, r) {
 		return
 	}
@@ -598,6 +719,7 @@ func (s *Server) handleTOTPVerify(w http.ResponseWriter, r *http.Request) {
 			s.loginRateLimiter.RecordFailure(rateLimitKey)
 		}
 		log.Printf("Invalid TOTP code from IP: %s", auth.GetClientIP(r))
+		s.failureDelay.Wait(r.Context(), start)
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(TOTPVerifyResponse{Error: "Invalid TOTP code"})
 		return
@@ -609,7 +731,12 @@ func (s *Server) handleTOTPVerify(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Generate JWT token with org context
-	token, err := auth.GenerateJWTWithOrg(account.ID, account.Username, account.IsAdmin, account.OrgID)
+	token, passwordChange, err := s.sessionToken(account, account.IsAdmin, r)
+	if errors.Is(err, errLoginSessionLimit) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(TOTPVerifyResponse{Error: loginSessionLimitMessage})
+		return
+	}
 	if err != nil {
 		log.Printf("Failed to generate JWT: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -639,12 +766,13 @@ func (s *Server) handleTOTPVerify(w http.ResponseWriter, r *http.Request) {
 	s.db.UpdateAccountLastUsed(accountID)
 
 	json.NewEncoder(w).Encode(TOTPVerifyResponse{
-		Success:     true,
-		Token:       token,
-		AccountType: accountType,
-		OrgID:       account.OrgID,
-		OrgName:     orgName,
-		IsOrgAdmin:  account.IsOrgAdmin,
+		Success:                true,
+		Token:                  token,
+		AccountType:            accountType,
+		OrgID:                  account.OrgID,
+		OrgName:                orgName,
+		IsOrgAdmin:             account.IsOrgAdmin,
+		PasswordChangeRequired: passwordChange,
 	})
 }
 
@@ -660,11 +788,13 @@ type OrgLoginResponse struct {
 	Token   string `json:"token,omitempty"`
 	OrgID   string `json:"orgId,omitempty"`
 	Error   string `json:"error,omitempty"`
+	PasswordChangeRequired
 }
 
 // handleOrgLogin handles organization account username/password authentication
 // Org accounts don't require TOTP - they use simpler password-only authentication
 func (s *Server) handleOrgLogin(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
 	if !validateAuthJSONRequest(w, r) {
 		return
 	}
@@ -712,21 +842,30 @@ func (s *Server) handleOrgLogin(w http.ResponseWriter, r *http.Request) {
 
 	// Org accounts must NOT be admin and MUST have org_id
 	if account == nil || !account.Active || account.IsAdmin || account.OrgID == "" {
+		auth.VerifyDummyPassword(req.Password)
 		// Record failed attempt for rate limiting
 		if s.loginRateLimiter != nil {
 			clientIP := auth.GetClientIP(r)
 			s.loginRateLimiter.RecordFailure(auth.IPRateLimitKey(clientIP))
 		}
+		s.failureDelay.Wait(r.Context(), start)
 		// Use same error message to prevent username enumeration
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(OrgLoginResponse{Error: "Invalid credentials"})
 		return
 	}
 
-	// Check if account has password set
+	// An account without a password fails like a wrong password, so the answer
+	// doesn't reveal which accounts exist or how they log in
 	if account.PasswordHash == "" {
+		auth.VerifyDummyPassword(req.Password)
+		if s.loginRateLimiter != nil {
+			clientIP := auth.GetClientIP(r)
+			s.loginRateLimiter.RecordFailure(auth.IPRateLimitKey(clientIP))
+		}
+		s.failureDelay.Wait(r.Context(), start)
 		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(OrgLoginResponse{Error: "Account not configured for password login"})
+		json.NewEncoder(w).Encode(OrgLoginResponse{Error: "Invalid credentials"})
 		return
 	}
 
@@ -738,13 +877,20 @@ func (s *Server) handleOrgLogin(w http.ResponseWriter, r *http.Request) {
 			s.loginRateLimiter.RecordFailure(auth.IPRateLimitKey(clientIP))
 		}
 		log.Printf("Failed org login attempt from IP: %s", auth.GetClientIP(r))
+		s.failureDelay.Wait(r.Context(), start)
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(OrgLoginResponse{Error: "Invalid credentials"})
 		return
 	}
 
-	// Generate JWT token with org context (no TOTP required for org accounts)
-	token, err := auth.GenerateJWTWithOrg(account.ID, account.Username, false, account.OrgID)
+	// Generate JWT token with org context (no TOTP required for org accounts). The org
+	// portal login never grants server admin rights.
+	token, passwordChange, err := s.sessionToken(account, false, r)
+	if errors.Is(err, errLoginSessionLimit) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(OrgLoginResponse{Error: loginSessionLimitMessage})
+		return
+	}
 	if err != nil {
 		log.Printf("Failed to generate JWT: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -764,8 +910,172 @@ func (s *Server) handleOrgLogin(w http.ResponseWriter, r *http.Request) {
 	s.db.UpdateAccountLastUsed(account.ID)
 
 	json.NewEncoder(w).Encode(OrgLoginResponse{
-		Success: true,
-		Token:   token,
-		OrgID:   account.OrgID,
+		Success:                true,
+		Token:                  token,
+		OrgID:                  account.OrgID,
+		PasswordChangeRequired: passwordChange,
+	})
+}
+
+// sessionToken issues the session JWT for a fully authenticated account. isAdmin
+// is false for logins that must not get server admin rights, such as the org
+// portal login. Accounts that must change their password get a restricted
+// password change token instead, returned in PasswordChangeRequired with an
+// empty session token. Logins beyond the org's session limit fail with
+// errLoginSessionLimit if the org rejects them.
+func (s *Server) sessionToken(account *db.Account, isAdmin bool, r *http.Request) (string, PasswordChangeRequired, error) {
+	if account.MustChangePassword {
+		token, err := auth.GeneratePasswordChangeToken(account.ID, account.Username, isAdmin, account.OrgID)
+		if err != nil {
+			return "", PasswordChangeRequired{}, err
+		}
+		return "", PasswordChangeRequired{MustChangePassword: true, PasswordChangeToken: token}, nil
+	}
+
+	now := time.Now()
+	sessionID, err := s.startLoginSession(account, r, now.Add(auth.JWTExpiration))
+	if err != nil {
+		return "", PasswordChangeRequired{}, err
+	}
+	token, err := auth.GenerateSessionJWT(account.ID, account.Username, isAdmin, account.OrgID, sessionID, now)
+	return token, PasswordChangeRequired{}, err
+}
+
+// handlePasswordChange sets a new password using a password change token from
+// login, clears the must-change flag and issues a regular session token
+func (s *Server) handlePasswordChange(w http.ResponseWriter, r *http.Request) {
+	if !validateAuthJSONRequest(w, r) {
+		return
+	}
+
+	// Rate limit per IP like logins, so change tokens and passwords can't be guessed at speed
+	rateLimitKey := auth.BuildRateLimitKey("password_change", auth.GetClientIP(r))
+	if s.loginRateLimiter != nil {
+		if allowed, retryAfter := s.loginRateLimiter.Allow(rateLimitKey); !allowed {
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", int(retryAfter.Seconds())))
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(LoginResponse{Error: "Too many requests. Please try again later."})
+			return
+		}
+	}
+
+	var req PasswordChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(LoginResponse{Error: "Invalid request"})
+		return
+	}
+
+	if s.db == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(LoginResponse{Error: "Database not configured"})
+		return
+	}
+
+	claims, err := auth.ValidatePasswordChangeToken(req.PasswordChangeToken)
+	if err != nil {
+		if s.loginRateLimiter != nil {
+			s.loginRateLimiter.RecordFailure(rateLimitKey)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(LoginResponse{Error: "Invalid or expired session"})
+		return
+	}
+
+	account, err := s.db.GetAccountByID(claims.AccountID)
+	if err != nil {
+		log.Printf("Password change error: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(LoginResponse{Error: "Internal error"})
+		return
+	}
+	// A token is only good for one change: once the flag is cleared it is rejected
+	if account == nil || !account.Active || !account.MustChangePassword {
+		if s.loginRateLimiter != nil {
+			s.loginRateLimiter.RecordFailure(rateLimitKey)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(LoginResponse{Error: "Invalid or expired session"})
+		return
+	}
+
+	if len(req.NewPassword) < 8 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(LoginResponse{Error: "Password must be at least 8 characters"})
+		return
+	}
+	if auth.VerifyPassword(req.NewPassword, account.PasswordHash) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(LoginResponse{Error: "New password must differ from the current password"})
+		return
+	}
+
+	passwordHash, err := auth.HashPassword(req.NewPassword)
+	if err != nil {
+		log.Printf("Failed to hash password: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(LoginResponse{Error: "Internal error"})
+		return
+	}
+
+	if err := s.db.UpdateAccountPassword(account.ID, passwordHash); err != nil {
+		log.Printf("Failed to update password: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(LoginResponse{Error: "Internal error"})
+		return
+	}
+	if err := s.db.SetAccountMustChangePassword(account.ID, false); err != nil {
+		log.Printf("Failed to clear password change flag: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(LoginResponse{Error: "Internal error"})
+		return
+	}
+	account.MustChangePassword = false
+	if s.loginRateLimiter != nil {
+		s.loginRateLimiter.RecordSuccess(rateLimitKey)
+	}
+
+	// Keep the admin rights of the login that issued the change token, so an
+	// org portal login doesn't turn into a server admin session
+	isAdmin := claims.IsAdmin && account.IsAdmin
+	token, _, err := s.sessionToken(account, isAdmin, r)
+	if errors.Is(err, errLoginSessionLimit) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(LoginResponse{Error: loginSessionLimitMessage})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to generate JWT: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(LoginResponse{Error: "Failed to generate session"})
+		return
+	}
+
+	// Determine account type
+	accountType := "user"
+	if isAdmin {
+		accountType = "admin"
+	} else if account.OrgID != "" {
+		accountType = "org"
+	}
+
+	// Get org name if org user
+	var orgName string
+	if account.OrgID != "" {
+		if org, _ := s.db.GetOrganizationByID(account.OrgID); org != nil {
+			orgName = org.Name
+		}
+	}
+
+	log.Printf("Password changed on login for user: %s", account.Username)
+	s.db.UpdateAccountLastUsed(account.ID)
+
+	json.NewEncoder(w).Encode(LoginResponse{
+		Success:     true,
+		Token:       token,
+		AccountType: accountType,
+		OrgID:       account.OrgID,
+		OrgName:     orgName,
+		IsOrgAdmin:  account.IsOrgAdmin,
 	})
 }
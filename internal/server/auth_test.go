@@ -0,0 +1,213 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestTOTPSettings(t *testing.T) {
+	database := newTestDB(t)
+	s := newTestServer(database)
+
+	key, err := s.generateTOTPSecret("alice")
+	if err != nil {
+		t.Fatalf("generateTOTPSecret() error: %v", err)
+	}
+	if !strings.HasPrefix(key.URL, "otpauth://totp/digit-link:alice?") {
+		t.Errorf("default URL = %q, want issuer digit-link and label alice", key.URL)
+	}
+
+	for _, raw := range []string{
+		`{"issuer":"Acme:Corp"}`,
+		`{"issuer":"   "}`,
+		`{"label":"alice"}`,
+		`{"label":"{username}\n"}`,
+		`{"issuer":"` + strings.Repeat("a", 65) + `"}`,
+	} {
+		if _, err := serverSettings[db.SettingTOTP].parse(json.RawMessage(raw)); err == nil {
+			t.Errorf("totp %s accepted, want rejected", raw)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodPut, "/admin/settings/"+db.SettingTOTP, strings.NewReader(`{"issuer":"AcmeCorp","label":"{username}@acme.com"}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.handleUpdateSetting(w, r, db.SettingTOTP, "root")
+	if w.Code != http.StatusOK {
+		t.Fatalf("update setting status = %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+	key, err = s.generateTOTPSecret("alice")
+	if err != nil {
+		t.Fatalf("generateTOTPSecret() error: %v", err)
+	}
+	if !strings.HasPrefix(key.URL, "otpauth://totp/AcmeCorp:alice@acme.com?") || !strings.Contains(key.URL, "issuer=AcmeCorp") {
+		t.Errorf("URL = %q, want issuer AcmeCorp and label alice@acme.com", key.URL)
+	}
+}
+
+func TestLoginFailureTiming(t *testing.T) {
+	t.Setenv("BCRYPT_COST", "10")
+	database := newTestDB(t)
+
+	hash, err := auth.HashPassword("correct-horse")
+	if err != nil {
+		t.Fatalf("HashPassword() error: %v", err)
+	}
+	if _, err := database.CreateAccountWithPassword("alice", auth.HashToken("token"), hash, false); err != nil {
+		t.Fatalf("CreateAccountWithPassword() error: %v", err)
+	}
+
+	if _, err := database.CreateAccount("tokenonly", auth.HashToken("other-token"), false); err != nil {
+		t.Fatalf("CreateAccount() error: %v", err)
+	}
+
+	delay := auth.FailureDelay{Min: 200 * time.Millisecond, Jitter: 20 * time.Millisecond}
+	s := newTestServer(database)
+	s.failureDelay = delay
+
+	login := func(username, password string) (int, string, time.Duration) {
+		body := fmt.Sprintf(`{"username":%q,"password":%q}`, username, password)
+		r := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		start := time.Now()
+		s.handleLogin(w, r)
+		return w.Code, w.Body.String(), time.Since(start)
+	}
+
+	missingStatus, missingBody, missing := login("nobody", "wrong-password")
+	wrongStatus, wrongBody, wrong := login("alice", "wrong-password")
+	noPasswordStatus, noPasswordBody, _ := login("tokenonly", "wrong-password")
+
+	for name, status := range map[string]int{"missing account": missingStatus, "wrong password": wrongStatus, "no password": noPasswordStatus} {
+		if status != http.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want %d", name, status, http.StatusUnauthorized)
+		}
+	}
+	if wrongBody != missingBody || noPasswordBody != missingBody {
+		t.Errorf("failure bodies differ: missing=%q wrong=%q no password=%q", missingBody, wrongBody, noPasswordBody)
+	}
+	if missing < delay.Min || wrong < delay.Min {
+		t.Errorf("failures answered before the minimum delay: missing=%s wrong=%s", missing, wrong)
+	}
+	diff := missing - wrong
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff > delay.Jitter+50*time.Millisecond {
+		t.Errorf("failure timings differ by %s (missing=%s wrong=%s)", diff, missing, wrong)
+	}
+}
+
+func TestMustChangePasswordLogin(t *testing.T) {
+	t.Setenv("BCRYPT_COST", "10")
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	hash, err := auth.HashPassword("initial-pass")
+	if err != nil {
+		t.Fatalf("HashPassword() error: %v", err)
+	}
+	account, err := database.CreateOrgAccount("bob", auth.HashToken("token"), hash, org.ID)
+	if err != nil {
+		t.Fatalf("CreateOrgAccount() error: %v", err)
+	}
+	if err := database.SetAccountMustChangePassword(account.ID, true); err != nil {
+		t.Fatalf("SetAccountMustChangePassword() error: %v", err)
+	}
+
+	s := newTestServer(database)
+	post := func(path, body string) (int, LoginResponse) {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.handleAuth(w, r)
+		var resp LoginResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+
+	status, resp := post("/auth/login", `{"username":"bob","password":"initial-pass"}`)
+	if status != http.StatusOK || !resp.MustChangePassword || resp.PasswordChangeToken == "" {
+		t.Fatalf("login = %d %+v, want password change required", status, resp)
+	}
+	if resp.Token != "" {
+		t.Error("login issued a session token while a password change is required")
+	}
+
+	// The restricted token must not work as a session
+	r := httptest.NewRequest(http.MethodGet, "/org/me", nil)
+	r.Header.Set("Authorization", "Bearer "+resp.PasswordChangeToken)
+	w := httptest.NewRecorder()
+	s.handleOrg(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("GET /org/me with password change token = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	changeToken := resp.PasswordChangeToken
+	if status, _ := post("/auth/password/change", fmt.Sprintf(`{"passwordChangeToken":%q,"newPassword":"initial-pass"}`, changeToken)); status != http.StatusBadRequest {
+		t.Errorf("reusing the old password = %d, want %d", status, http.StatusBadRequest)
+	}
+
+	status, resp = post("/auth/password/change", fmt.Sprintf(`{"passwordChangeToken":%q,"newPassword":"brand-new-pass"}`, changeToken))
+	if status != http.StatusOK || resp.Token == "" {
+		t.Fatalf("password change = %d %+v, want session token", status, resp)
+	}
+	if _, err := auth.ValidateJWT(resp.Token); err != nil {
+		t.Errorf("issued token is not a valid session: %v", err)
+	}
+
+	if status, _ := post("/auth/password/change", fmt.Sprintf(`{"passwordChangeToken":%q,"newPassword":"another-pass"}`, changeToken)); status != http.StatusUnauthorized {
+		t.Errorf("reusing the password change token = %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	status, resp = post("/auth/org/login", `{"username":"bob","password":"brand-new-pass"}`)
+	if status != http.StatusOK || resp.Token == "" || resp.MustChangePassword {
+		t.Errorf("login after change = %d %+v, want a regular session", status, resp)
+	}
+
+	// The session keeps the admin rights of the change token, not the account's
+	admin, err := database.CreateAccountWithPassword("carol", auth.HashToken("admin-token"), hash, true)
+	if err != nil {
+		t.Fatalf("CreateAccountWithPassword() error: %v", err)
+	}
+	if err := database.SetAccountMustChangePassword(admin.ID, true); err != nil {
+		t.Fatalf("SetAccountMustChangePassword() error: %v", err)
+	}
+	restricted, err := auth.GeneratePasswordChangeToken(admin.ID, admin.Username, false, "")
+	if err != nil {
+		t.Fatalf("GeneratePasswordChangeToken() error: %v", err)
+	}
+	status, resp = post("/auth/password/change", fmt.Sprintf(`{"passwordChangeToken":%q,"newPassword":"third-pass"}`, restricted))
+	if status != http.StatusOK {
+		t.Fatalf("password change = %d %+v, want session token", status, resp)
+	}
+	if claims, err := auth.ValidateJWT(resp.Token); err != nil || claims.IsAdmin || resp.AccountType == "admin" {
+		t.Errorf("session from a non-admin change token = %+v (%v), want no admin rights", claims, err)
+	}
+
+	// Bad change tokens from one IP are throttled
+	s.loginRateLimiter = auth.NewRateLimiter(database, auth.RateLimiterConfig{
+		WindowDuration:  time.Minute,
+		MaxAttempts:     2,
+		BlockDuration:   time.Minute,
+		CleanupInterval: time.Minute,
+	})
+	defer s.loginRateLimiter.Stop()
+	post("/auth/password/change", `{"passwordChangeToken":"bogus","newPassword":"fourth-pass"}`)
+	post("/auth/password/change", `{"passwordChangeToken":"bogus","newPassword":"fourth-pass"}`)
+	if status, _ := post("/auth/password/change", `{"passwordChangeToken":"bogus","newPassword":"fourth-pass"}`); status != http.StatusTooManyRequests {
+		t.Errorf("password change after failures = %d, want %d", status, http.StatusTooManyRequests)
+	}
+}
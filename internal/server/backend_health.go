@@ -0,0 +1,52 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/tunnel"
+)
+
+const (
+	// degradedRetryAfter is the Retry-After (seconds) sent to visitors of a degraded tunnel
+	degradedRetryAfter = 5
+	// healthFrameTimeout bounds reading a health report from a TCP client stream
+	healthFrameTimeout = 10 * time.Second
+)
+
+// setHealth records a health report from the tunnel's client
+func (t *Tunnel) setHealth(healthy bool) {
+	if wasDegraded := t.degraded.Swap(!healthy); wasDegraded == healthy {
+		if healthy {
+			log.Printf("Tunnel %s: local service is up", t.Subdomain)
+		} else {
+			log.Printf("Tunnel %s: local service is down, tunnel degraded", t.Subdomain)
+		}
+	}
+}
+
+// readHealthFrame reads a health report the client sent on a stream it opened
+func (tl *TunnelListener) readHealthFrame(session *tunnel.Session, stream net.Conn) {
+	defer stream.Close()
+
+	stream.SetReadDeadline(time.Now().Add(healthFrameTimeout))
+	frame, err := tunnel.ReadFrame[tunnel.HealthFrame](stream)
+	if err != nil || frame.Type != tunnel.TypeHealth {
+		return
+	}
+	if wasDegraded := session.Degraded(); wasDegraded == frame.Healthy {
+		session.SetDegraded(!frame.Healthy)
+		log.Printf("TCP tunnel %v: local services healthy: %v", session.GetSubdomains(), frame.Healthy)
+	}
+}
+
+// writeTunnelDegraded tells a visitor that the tunnel's local service is not up yet
+func (s *Server) writeTunnelDegraded(w http.ResponseWriter, r *http.Request, orgID, subdomain string) {
+	w.Header().Set("Retry-After", strconv.Itoa(degradedRetryAfter))
+	s.writeVisitorError(w, r, orgID, http.StatusServiceUnavailable, errCodeTunnelDegraded,
+		fmt.Sprintf("The local service of tunnel '%s' is not available yet", subdomain))
+}
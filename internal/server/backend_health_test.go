@@ -0,0 +1,77 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/niekvdm/digit-link/internal/protocol"
+)
+
+func TestDegradedTunnel(t *testing.T) {
+	s := newTestServer(nil)
+	ts := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer ts.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/_tunnel", nil)
+	if err != nil {
+		t.Fatalf("Dial() error: %v", err)
+	}
+	defer conn.Close()
+	reg, _ := json.Marshal(protocol.Message{Type: protocol.TypeRegisterRequest, Payload: protocol.RegisterRequest{Subdomain: "starting", Degraded: true}})
+	conn.WriteMessage(websocket.TextMessage, reg)
+	var regResp struct {
+		Payload protocol.RegisterResponse `json:"payload"`
+	}
+	if err := conn.ReadJSON(&regResp); err != nil || !regResp.Payload.Success {
+		t.Fatalf("registration failed: %v %+v", err, regResp.Payload)
+	}
+
+	// Visitors of a degraded tunnel get a 503 without reaching the client
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://starting.link.test/", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get(errorCodeHeader) != errCodeTunnelDegraded || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("degraded response = %d %v, want 503 %s with Retry-After", rec.Code, rec.Header(), errCodeTunnelDegraded)
+	}
+	if tunnels := s.GetActiveTunnels(); len(tunnels) != 1 || tunnels[0]["degraded"] != true {
+		t.Errorf("active tunnels = %v, want the tunnel listed as degraded", tunnels)
+	}
+
+	health, _ := json.Marshal(protocol.Message{Type: protocol.TypeHealth, Payload: protocol.HealthStatus{Healthy: true}})
+	conn.WriteMessage(websocket.TextMessage, health)
+	s.mu.RLock()
+	tun := s.tunnels["starting"]
+	s.mu.RUnlock()
+	for deadline := time.Now().Add(5 * time.Second); tun.degraded.Load(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("tunnel still degraded after the client reported healthy")
+		}
+	}
+
+	// Once healthy, requests are forwarded again
+	rec = httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://starting.link.test/", nil))
+		close(done)
+	}()
+	var req struct {
+		Payload protocol.HTTPRequest `json:"payload"`
+	}
+	if err := conn.ReadJSON(&req); err != nil {
+		t.Fatalf("reading request: %v", err)
+	}
+	resp, _ := json.Marshal(protocol.Message{
+		Type:    protocol.TypeHTTPResponse,
+		Payload: protocol.HTTPResponse{ID: req.Payload.ID, StatusCode: http.StatusOK},
+	})
+	conn.WriteMessage(websocket.TextMessage, resp)
+	<-done
+	if rec.Code != http.StatusOK {
+		t.Errorf("status after recovery = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
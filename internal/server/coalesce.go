@@ -0,0 +1,245 @@
+package server
+
+import (
+	"bytes"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// maxCoalescedBodyBytes bounds the response body buffered to share it; larger
+// responses are streamed to the request that fetched them and not shared
+const maxCoalescedBodyBytes = 8 << 20
+
+// coalesceVaryHeaders are the request headers a shared response may depend on.
+// Requests only share a response when these match, along with the host and URI.
+var coalesceVaryHeaders = []string{"Accept", "Accept-Encoding", "Accept-Language", "Authorization", "Cookie", "Origin"}
+
+// requestCoalescer lets identical concurrent GETs share one backend request
+type requestCoalescer struct {
+	group singleflight.Group
+
+	mu    sync.Mutex
+	stats map[string]*coalesceCounters // By application ID
+}
+
+// coalesceCounters count the coalescable requests of an application
+type coalesceCounters struct {
+	forwarded atomic.Int64
+	shared    atomic.Int64
+	bypassed  atomic.Int64
+}
+
+// CoalesceStats reports request coalescing of an application since the server started
+type CoalesceStats struct {
+	Forwarded int64 `json:"forwarded"` // Coalescable requests forwarded to the backend
+	Shared    int64 `json:"shared"`    // Requests answered with a concurrent request's response
+	Bypassed  int64 `json:"bypassed"`  // Waiting requests forwarded on their own because the response could not be shared
+}
+
+func (c *requestCoalescer) counters(appID string) *coalesceCounters {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stats == nil {
+		c.stats = make(map[string]*coalesceCounters)
+	}
+	counters, ok := c.stats[appID]
+	if !ok {
+		counters = &coalesceCounters{}
+		c.stats[appID] = counters
+	}
+	return counters
+}
+
+// coalesceStats returns the coalescing counters of an application
+func (s *Server) coalesceStats(appID string) CoalesceStats {
+	counters := s.coalescer.counters(appID)
+	return CoalesceStats{
+		Forwarded: counters.forwarded.Load(),
+		Shared:    counters.shared.Load(),
+		Bypassed:  counters.bypassed.Load(),
+	}
+}
+
+// isCoalescable reports whether a request may share its response with identical
+// concurrent requests: a GET without a body, range or upgrade that doesn't ask
+// not to be stored
+func isCoalescable(r *http.Request) bool {
+	if r.Method != http.MethodGet || r.ContentLength > 0 || len(r.TransferEncoding) > 0 {
+		return false
+	}
+	if r.Header.Get("Range") != "" || r.Header.Get("Upgrade") != "" {
+		return false
+	}
+	return !strings.Contains(strings.ToLower(r.Header.Get("Cache-Control")), "no-store")
+}
+
+// coalesceKey identifies the requests that may share a response
+func coalesceKey(r *http.Request) string {
+	var key strings.Builder
+	key.WriteString(strings.ToLower(r.Host))
+	key.WriteString(" ")
+	key.WriteString(r.URL.RequestURI())
+	for _, name := range coalesceVaryHeaders {
+		key.WriteString("\n")
+		key.WriteString(strings.Join(r.Header.Values(name), ", "))
+	}
+	for _, name := range slices.Sorted(maps.Values(db.IdentityHeaderNames)) {
+		key.WriteString("\n")
+		key.WriteString(r.Header.Get(name))
+	}
+	return key.String()
+}
+
+// coalescedResponse is a buffered response shared by coalesced requests
+type coalescedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// shareable reports whether the response may be given to other visitors
+func (c *coalescedResponse) shareable() bool {
+	if c.status == 0 || len(c.header.Values("Set-Cookie")) > 0 {
+		return false
+	}
+	cacheControl := strings.ToLower(strings.Join(c.header.Values("Cache-Control"), ","))
+	return !strings.Contains(cacheControl, "private") && !strings.Contains(cacheControl, "no-store")
+}
+
+func (c *coalescedResponse) writeTo(w http.ResponseWriter) {
+	c.writeHeaderTo(w)
+	w.Write(c.body)
+}
+
+func (c *coalescedResponse) writeHeaderTo(w http.ResponseWriter) {
+	for key, values := range c.header {
+		w.Header()[key] = append([]string(nil), values...)
+	}
+	w.WriteHeader(c.status)
+}
+
+// coalesceRecorder buffers the response of the request that is forwarded for
+// the others. Server-sent events and a body outgrowing maxCoalescedBodyBytes
+// are streamed to that request's own visitor instead.
+type coalesceRecorder struct {
+	w         http.ResponseWriter
+	resp      coalescedResponse
+	body      bytes.Buffer
+	streamed  bool
+	streaming chan struct{} // Closed once the response is streamed
+}
+
+func (c *coalesceRecorder) Header() http.Header {
+	if c.streamed {
+		return c.w.Header()
+	}
+	return c.resp.header
+}
+
+// WriteHeader records the status. Server-sent events are streamed from the
+// start, as they may never end.
+func (c *coalesceRecorder) WriteHeader(status int) {
+	if c.resp.status != 0 {
+		return
+	}
+	c.resp.status = status
+	if isEventStream(c.resp.header.Get("Content-Type")) {
+		c.startStreaming()
+	}
+}
+
+func (c *coalesceRecorder) Write(p []byte) (int, error) {
+	if c.resp.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	if !c.streamed && c.body.Len()+len(p) > maxCoalescedBodyBytes {
+		c.startStreaming()
+	}
+	if c.streamed {
+		return c.w.Write(p)
+	}
+	return c.body.Write(p)
+}
+
+// startStreaming writes what was buffered so far to the visitor and passes the
+// rest of the response straight through
+func (c *coalesceRecorder) startStreaming() {
+	c.resp.writeHeaderTo(c.w)
+	c.w.Write(c.body.Bytes())
+	c.body = bytes.Buffer{}
+	c.streamed = true
+	close(c.streaming)
+}
+
+// Flush implements http.Flusher once the response is streamed
+func (c *coalesceRecorder) Flush() {
+	if c.streamed {
+		http.NewResponseController(c.w).Flush()
+	}
+}
+
+// forwardCoalesced forwards a coalescable request, or waits for an identical
+// request already in flight and answers with its response. Responses that set
+// cookies, are private, streamed or were not received are not shared; waiting
+// requests are then forwarded on their own, as soon as a stream starts.
+func (s *Server) forwardCoalesced(w http.ResponseWriter, r *http.Request, orgID, appID, subdomain string, forward func(http.ResponseWriter)) {
+	start := time.Now()
+	counters := s.coalescer.counters(appID)
+
+	var recorder *coalesceRecorder
+	var done chan struct{}
+	value, _, _ := s.coalescer.group.Do(coalesceKey(r), func() (interface{}, error) {
+		recorder = &coalesceRecorder{w: w, resp: coalescedResponse{header: make(http.Header)}, streaming: make(chan struct{})}
+		done = make(chan struct{})
+		go func() {
+			defer close(done)
+			forward(recorder)
+		}()
+		select {
+		case <-done:
+		case <-recorder.streaming:
+			return (*coalescedResponse)(nil), nil
+		}
+		if recorder.streamed {
+			return (*coalescedResponse)(nil), nil
+		}
+		recorder.resp.body = recorder.body.Bytes()
+		if !recorder.resp.shareable() {
+			return (*coalescedResponse)(nil), nil
+		}
+		return &recorder.resp, nil
+	})
+
+	if recorder != nil {
+		// This request was forwarded for the others; a streamed response is still being relayed
+		<-done
+		counters.forwarded.Add(1)
+		if !recorder.streamed && recorder.resp.status != 0 {
+			recorder.resp.writeTo(w)
+		}
+		return
+	}
+
+	shared := value.(*coalescedResponse)
+	if shared == nil {
+		counters.bypassed.Add(1)
+		forward(w)
+		return
+	}
+
+	counters.shared.Add(1)
+	if s.analyticsCache != nil {
+		s.analyticsCache.RecordRequest(appID, s.redaction.RedactString(r.URL.Path), shared.status)
+	}
+	s.recordRequest(r, orgID, appID, subdomain, shared.status, start)
+	shared.writeTo(w)
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRequestCoalescing(t *testing.T) {
+	s := &Server{}
+	var calls atomic.Int32
+	release := make(chan struct{})
+	forwarder := func(setCookie bool) func(http.ResponseWriter) {
+		return func(w http.ResponseWriter) {
+			calls.Add(1)
+			<-release
+			if setCookie {
+				w.Header().Set("Set-Cookie", "session=abc")
+			}
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("shared body"))
+		}
+	}
+	run := func(n int, setCookie bool) []*httptest.ResponseRecorder {
+		calls.Store(0)
+		release = make(chan struct{})
+		recorders := make([]*httptest.ResponseRecorder, n)
+		var wg sync.WaitGroup
+		for i := range recorders {
+			recorders[i] = httptest.NewRecorder()
+			wg.Add(1)
+			go func(w *httptest.ResponseRecorder) {
+				defer wg.Done()
+				r := httptest.NewRequest(http.MethodGet, "http://shop.link.test/assets/app.js", nil)
+				s.forwardCoalesced(w, r, "org", "app", "shop", forwarder(setCookie))
+			}(recorders[i])
+		}
+		// Let the requests pile up behind the first one before it answers
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		return recorders
+	}
+
+	for _, w := range run(5, false) {
+		if w.Code != http.StatusOK || w.Body.String() != "shared body" || w.Header().Get("Content-Type") != "text/plain" {
+			t.Errorf("coalesced response = %d %q %v, want the shared response", w.Code, w.Body.String(), w.Header())
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("backend requests = %d, want 1", calls.Load())
+	}
+	if stats := s.coalesceStats("app"); stats != (CoalesceStats{Forwarded: 1, Shared: 4}) {
+		t.Errorf("stats = %+v, want 1 forwarded and 4 shared", stats)
+	}
+
+	// Responses setting cookies are not shared; waiting requests go to the backend themselves
+	for _, w := range run(3, true) {
+		if w.Code != http.StatusOK || w.Body.String() != "shared body" {
+			t.Errorf("uncoalesced response = %d %q, want the backend response", w.Code, w.Body.String())
+		}
+	}
+	if calls.Load() != 3 {
+		t.Errorf("backend requests with Set-Cookie = %d, want 3", calls.Load())
+	}
+	if stats := s.coalesceStats("app"); stats.Forwarded != 2 || stats.Bypassed != 2 {
+		t.Errorf("stats = %+v, want 2 forwarded and 2 bypassed", stats)
+	}
+
+	get := func(header, value string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "http://shop.link.test/", nil)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		return r
+	}
+	if coalesceKey(get("Accept-Language", "nl")) == coalesceKey(get("Accept-Language", "en")) {
+		t.Error("requests with different Accept-Language share a key")
+	}
+	if coalesceKey(get("Cookie", "a=1")) == coalesceKey(get("Cookie", "a=2")) {
+		t.Error("requests with different cookies share a key")
+	}
+	if coalesceKey(get("User-Agent", "a")) != coalesceKey(get("User-Agent", "b")) {
+		t.Error("requests differing only in User-Agent don't share a key")
+	}
+	for _, r := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "http://shop.link.test/", strings.NewReader("x")),
+		get("Range", "bytes=0-10"),
+		get("Cache-Control", "no-store"),
+		get("Upgrade", "websocket"),
+	} {
+		if isCoalescable(r) {
+			t.Errorf("isCoalescable(%s %v) = true, want false", r.Method, r.Header)
+		}
+	}
+	if !isCoalescable(get("", "")) {
+		t.Error("isCoalescable(GET) = false, want true")
+	}
+}
+
+func TestCoalescedEventStream(t *testing.T) {
+	s := &Server{}
+	var calls atomic.Int32
+	release := make(chan struct{})
+	forward := func(w http.ResponseWriter) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("data: 1\n\n"))
+		<-release
+	}
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest(http.MethodGet, "http://shop.link.test/events", nil)
+			s.forwardCoalesced(httptest.NewRecorder(), r, "org", "app", "shop", forward)
+		}()
+	}
+
+	// The second request is forwarded on its own instead of waiting for the stream to end
+	deadline := time.Now().Add(2 * time.Second)
+	for calls.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	if calls.Load() != 2 {
+		t.Errorf("backend requests = %d, want 2", calls.Load())
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// complianceEmail returns the email query parameter of a compliance request,
+// writing a 400 when it is missing
+func complianceEmail(w http.ResponseWriter, r *http.Request) (string, bool) {
+	email := strings.TrimSpace(r.URL.Query().Get("email"))
+	if email == "" {
+		jsonError(w, "email is required", http.StatusBadRequest)
+		return "", false
+	}
+	return email, true
+}
+
+// handleOrgComplianceExport returns everything the organization stores about a
+// visitor identity: its auth audit events and its auth sessions
+func (s *Server) handleOrgComplianceExport(w http.ResponseWriter, r *http.Request, orgCtx *OrgContext) {
+	if !s.requireOrgAdmin(w, orgCtx) {
+		return
+	}
+	email, ok := complianceEmail(w, r)
+	if !ok {
+		return
+	}
+
+	records, err := s.db.GetComplianceRecords(orgCtx.OrgID, email)
+	if err != nil {
+		log.Printf("Failed to get compliance records: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	orgID := orgCtx.OrgID
+	if err := s.db.LogAdminAction(&orgID, db.AuditTypeComplianceExport, auth.GetClientIP(r), orgCtx.Username, email); err != nil {
+		log.Printf("Failed to audit compliance export: %v", err)
+	}
+	log.Printf("Compliance export for org %s by %s: %d audit events, %d sessions",
+		orgID, orgCtx.Username, len(records.AuditEvents), len(records.Sessions))
+
+	// Session IDs are bearer credentials, so they are left out of the export
+	sessions := make([]map[string]interface{}, len(records.Sessions))
+	for i, session := range records.Sessions {
+		sessions[i] = map[string]interface{}{
+			"appId":      session.AppID,
+			"orgWide":    session.OrgWide,
+			"userEmail":  session.UserEmail,
+			"userClaims": session.UserClaims,
+			"createdAt":  session.CreatedAt,
+			"expiresAt":  session.ExpiresAt,
+		}
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"email":       email,
+		"exportedAt":  time.Now().UTC(),
+		"auditEvents": records.AuditEvents,
+		"sessions":    sessions,
+	})
+}
+
+// handleOrgComplianceErase deletes the organization's auth sessions of a visitor
+// identity and anonymizes its audit events. The erasure itself is audited with
+// a hash of the email, so the audit log does not keep the identity it erased.
+func (s *Server) handleOrgComplianceErase(w http.ResponseWriter, r *http.Request, orgCtx *OrgContext) {
+	if !s.requireOrgAdmin(w, orgCtx) {
+		return
+	}
+	email, ok := complianceEmail(w, r)
+	if !ok {
+		return
+	}
+
+	sessionsDeleted, auditEventsAnonymized, err := s.db.EraseComplianceRecords(orgCtx.OrgID, email)
+	if err != nil {
+		log.Printf("Failed to erase compliance records: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	orgID := orgCtx.OrgID
+	target := "sha256:" + auth.HashToken(strings.ToLower(email))
+	if err := s.db.LogAdminAction(&orgID, db.AuditTypeComplianceErase, auth.GetClientIP(r), orgCtx.Username, target); err != nil {
+		log.Printf("Failed to audit compliance erasure: %v", err)
+	}
+	log.Printf("Compliance erasure for org %s by %s: %d sessions deleted, %d audit events anonymized",
+		orgID, orgCtx.Username, sessionsDeleted, auditEventsAnonymized)
+
+	jsonResponse(w, map[string]interface{}{
+		"success":               true,
+		"sessionsDeleted":       sessionsDeleted,
+		"auditEventsAnonymized": auditEventsAnonymized,
+	})
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestOrgComplianceExportErase(t *testing.T) {
+	database := newTestDB(t)
+
+	org, _ := database.CreateOrganization("acme")
+	app, _ := database.CreateApplication(org.ID, "docs", "docs")
+	other, _ := database.CreateOrganization("globex")
+
+	database.CreateSession(&app.ID, nil, "jane@example.com", map[string]string{"name": "Jane"}, time.Hour)
+	database.CreateOrgWideSession(org.ID, "Jane@Example.com", nil, time.Hour)
+	database.CreateOrgWideSession(org.ID, "bob@example.com", nil, time.Hour)
+	otherSession, _ := database.CreateOrgWideSession(other.ID, "jane@example.com", nil, time.Hour)
+	database.LogAuthSuccess(nil, &app.ID, "oidc", "1.2.3.4", "jane@example.com", "")
+	database.LogAuthSuccess(&other.ID, nil, "oidc", "5.6.7.8", "jane@example.com", "")
+
+	s := newTestServer(database)
+	admin := &OrgContext{OrgID: org.ID, Username: "alice", IsOrgAdmin: true}
+	call := func(handler func(http.ResponseWriter, *http.Request, *OrgContext), method, target string, orgCtx *OrgContext) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(method, target, nil), orgCtx)
+		return w
+	}
+
+	if w := call(s.handleOrgComplianceExport, http.MethodGet, "/org/compliance/export?email=jane@example.com", &OrgContext{OrgID: org.ID}); w.Code != http.StatusForbidden {
+		t.Errorf("member export: status %d, want 403", w.Code)
+	}
+	if w := call(s.handleOrgComplianceErase, http.MethodDelete, "/org/compliance/erase", admin); w.Code != http.StatusBadRequest {
+		t.Errorf("erase without email: status %d, want 400", w.Code)
+	}
+
+	w := call(s.handleOrgComplianceExport, http.MethodGet, "/org/compliance/export?email=jane@example.com", admin)
+	var export struct {
+		AuditEvents []*db.AuditEvent         `json:"auditEvents"`
+		Sessions    []map[string]interface{} `json:"sessions"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&export); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("export: status %d (%v)", w.Code, err)
+	}
+	if len(export.AuditEvents) != 1 || export.AuditEvents[0].SourceIP != "1.2.3.4" {
+		t.Errorf("exported audit events = %+v, want the org's one event", export.AuditEvents)
+	}
+	if len(export.Sessions) != 2 {
+		t.Errorf("exported %d sessions, want 2", len(export.Sessions))
+	}
+	for _, session := range export.Sessions {
+		if _, ok := session["id"]; ok {
+			t.Error("export contains a session ID")
+		}
+	}
+
+	w = call(s.handleOrgComplianceErase, http.MethodDelete, "/org/compliance/erase?email=JANE@example.com", admin)
+	var erased struct {
+		SessionsDeleted       int64 `json:"sessionsDeleted"`
+		AuditEventsAnonymized int64 `json:"auditEventsAnonymized"`
+	}
+	json.NewDecoder(w.Body).Decode(&erased)
+	// The audit events are the login and the export
+	if erased.SessionsDeleted != 2 || erased.AuditEventsAnonymized != 2 {
+		t.Errorf("erase = %+v, want 2 sessions and 2 audit events", erased)
+	}
+
+	records, _ := database.GetComplianceRecords(org.ID, "jane@example.com")
+	if len(records.AuditEvents) != 0 || len(records.Sessions) != 0 {
+		t.Errorf("records left after erase: %+v", records)
+	}
+	if records, _ := database.GetComplianceRecords(org.ID, "bob@example.com"); len(records.Sessions) != 1 {
+		t.Error("erase removed another visitor's session")
+	}
+	if session, _ := database.GetSession(otherSession.ID); session == nil {
+		t.Error("erase removed another org's session")
+	}
+	if records, _ := database.GetComplianceRecords(other.ID, "jane@example.com"); len(records.AuditEvents) != 1 {
+		t.Error("erase anonymized another org's audit event")
+	}
+
+	audit, _ := database.GetAuditEvents(&org.ID, nil, 10, 0)
+	var eraseAudit *db.AuditEvent
+	for _, event := range audit {
+		if event.AuthType == db.AuditTypeComplianceErase {
+			eraseAudit = event
+		}
+	}
+	if eraseAudit == nil || eraseAudit.Actor != "alice" || strings.Contains(eraseAudit.UserIdentity, "jane") {
+		t.Errorf("erase audit event = %+v, want one by alice without the email", eraseAudit)
+	}
+}
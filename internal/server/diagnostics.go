@@ -0,0 +1,151 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// PublicHealthResponse is the response of the public /api/health endpoint used by `digit-link doctor`
+type PublicHealthResponse struct {
+	Status string    `json:"status"`
+	Time   time.Time `json:"time"` // Server clock, for skew checks
+
+	// Client versions from the client_versions setting, for update notices
+	LatestClientVersion string `json:"latestClientVersion,omitempty"`
+	MinClientVersion    string `json:"minClientVersion,omitempty"`
+}
+
+// WhoAmIResponse describes the identity a tunnel token authenticates as
+type WhoAmIResponse struct {
+	Type      string     `json:"type"` // "account" or "api_key"
+	Username  string     `json:"username,omitempty"`
+	OrgID     string     `json:"orgId,omitempty"`
+	AppID     string     `json:"appId,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	ClientIP  string     `json:"clientIp"`
+	IPAllowed bool       `json:"ipAllowed"` // Whether the caller's IP passes the token's whitelist
+}
+
+// handlePublicHealth reports server status and time on the main domain, and the
+// client versions clients compare themselves against. Unlike the health check
+// server it is reachable by clients, so it leaves out the server's version.
+func (s *Server) handlePublicHealth(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	clientVersions := s.settingValue(db.SettingClientVersions).(*db.ClientVersionSettings)
+	resp := PublicHealthResponse{
+		Status:              "ok",
+		Time:                time.Now().UTC(),
+		LatestClientVersion: clientVersions.Latest,
+		MinClientVersion:    clientVersions.Minimum,
+	}
+	if err := s.checkDatabaseHealth(r.Context()); err != nil {
+		log.Printf("Public health check: database unhealthy: %v", err)
+		resp.Status = "unhealthy"
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode health response: %v", err)
+	}
+}
+
+// handleWhoAmI validates a tunnel token (account token or API key) from the Authorization header
+// and reports what it would connect as, including whether the caller's IP is whitelisted.
+// It is rate limited per IP like the login endpoints, and every rejected token gets the
+// same error so it cannot tell unknown tokens from expired ones.
+func (s *Server) handleWhoAmI(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if s.db == nil {
+		writeError(w, r, http.StatusServiceUnavailable, errCodeUnavailable, "Database not configured")
+		return
+	}
+
+	clientIP := auth.GetClientIP(r)
+	rateLimitKey := auth.BuildRateLimitKey("whoami", clientIP)
+	if s.loginRateLimiter != nil {
+		if allowed, retryAfter := s.loginRateLimiter.Allow(rateLimitKey); !allowed {
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", int(retryAfter.Seconds())))
+			writeError(w, r, http.StatusTooManyRequests, errCodeRateLimited, "Too many requests. Please try again later.")
+			return
+		}
+	}
+	rejectToken := func() {
+		if s.loginRateLimiter != nil {
+			s.loginRateLimiter.RecordFailure(rateLimitKey)
+		}
+		s.failureDelay.Wait(r.Context(), start)
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Invalid token")
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || token == r.Header.Get("Authorization") {
+		rejectToken()
+		return
+	}
+
+	resp := WhoAmIResponse{ClientIP: clientIP}
+
+	apiKey, err := s.db.GetAPIKeyByHash(db.HashAPIKey(token))
+	if err != nil {
+		log.Printf("Database error during API key lookup: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+
+	if apiKey != nil {
+		if apiKey.ExpiresAt != nil && apiKey.ExpiresAt.Before(time.Now()) {
+			rejectToken()
+			return
+		}
+		resp.Type = "api_key"
+		resp.ExpiresAt = apiKey.ExpiresAt
+		resp.IPAllowed = true
+		switch {
+		case apiKey.KeyType == db.KeyTypeApp && apiKey.AppID != nil:
+			resp.AppID = *apiKey.AppID
+			resp.IPAllowed, err = s.db.IsIPWhitelistedForApp(clientIP, resp.AppID)
+			if apiKey.OrgID != nil {
+				resp.OrgID = *apiKey.OrgID
+			}
+		case apiKey.OrgID != nil:
+			resp.OrgID = *apiKey.OrgID
+			resp.IPAllowed, err = s.db.IsIPWhitelistedForOrg(clientIP, resp.OrgID)
+		}
+	} else {
+		account, lookupErr := s.db.GetAccountByTokenHash(auth.HashToken(token))
+		if lookupErr != nil {
+			log.Printf("Database error during auth: %v", lookupErr)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+			return
+		}
+		if account == nil || account.IsTokenExpired() {
+			rejectToken()
+			return
+		}
+		resp.Type = "account"
+		resp.Username = account.Username
+		resp.OrgID = account.OrgID
+		resp.ExpiresAt = account.TokenExpiresAt
+		resp.IPAllowed, err = s.db.IsIPWhitelistedForAccount(clientIP, account.ID)
+	}
+	if err != nil {
+		log.Printf("Whitelist check error: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+
+	if s.loginRateLimiter != nil {
+		s.loginRateLimiter.RecordSuccess(rateLimitKey)
+	}
+	jsonResponse(w, resp)
+}
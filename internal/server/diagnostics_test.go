@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+)
+
+func TestWhoAmI(t *testing.T) {
+	database := newTestDB(t)
+
+	account, err := database.CreateAccount("alice", auth.HashToken("good-token"), false)
+	if err != nil {
+		t.Fatalf("CreateAccount() error: %v", err)
+	}
+	if _, err := database.AddAccountWhitelist(account.ID, "192.0.2.0/24", "office"); err != nil {
+		t.Fatalf("AddAccountWhitelist() error: %v", err)
+	}
+
+	s := newTestServer(database)
+	whoami := func(token string) (*httptest.ResponseRecorder, WhoAmIResponse) {
+		r := httptest.NewRequest(http.MethodGet, "/api/whoami", nil)
+		r.Header.Set("Accept", "application/json")
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		s.handleWhoAmI(w, r)
+		var resp WhoAmIResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp
+	}
+
+	w, resp := whoami("good-token")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+	if resp.Type != "account" || resp.Username != "alice" || !resp.IPAllowed {
+		t.Errorf("whoami = %+v, want whitelisted account alice", resp)
+	}
+
+	// Unknown, missing and expired tokens are indistinguishable
+	expired, _ := database.CreateAccount("bob", auth.HashToken("old-token"), false)
+	past := time.Now().Add(-time.Hour)
+	database.UpdateAccountTokenExpiry(expired.ID, &past)
+	for _, token := range []string{"", "bad-token", "old-token"} {
+		w, _ := whoami(token)
+		var body struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		if w.Code != http.StatusUnauthorized || body.Error != "Invalid token" {
+			t.Errorf("token %q: %d %q, want 401 Invalid token", token, w.Code, body.Error)
+		}
+	}
+
+	// Repeated failures from one IP are throttled
+	s.loginRateLimiter = auth.NewRateLimiter(database, auth.RateLimiterConfig{
+		WindowDuration:  time.Minute,
+		MaxAttempts:     2,
+		BlockDuration:   time.Minute,
+		CleanupInterval: time.Minute,
+	})
+	defer s.loginRateLimiter.Stop()
+	whoami("bad-token")
+	whoami("bad-token")
+	if w, _ := whoami("good-token"); w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("status after failures = %d, want 429 with Retry-After", w.Code)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/health", nil)
+	rec := httptest.NewRecorder()
+	s.handlePublicHealth(rec, r)
+	var health PublicHealthResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &health); err != nil {
+		t.Fatalf("invalid health response: %v", err)
+	}
+	if rec.Code != http.StatusOK || health.Status != "ok" || time.Since(health.Time) > time.Minute {
+		t.Errorf("health = %d %+v", rec.Code, health)
+	}
+	if strings.Contains(rec.Body.String(), `"version"`) {
+		t.Errorf("health exposes the server version: %s", rec.Body.String())
+	}
+}
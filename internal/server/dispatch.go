@@ -0,0 +1,179 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// dispatchQueueSize is the number of responses buffered per dispatch worker
+const dispatchQueueSize = 64
+
+// responseDispatcher hands tunnel responses to a fixed pool of workers so the
+// tunnel reader never waits on a response channel. Responses are sharded by
+// request ID, so all responses for one request are delivered in order. A
+// response for a shard whose queue is full is dropped rather than stalling the
+// reader and every other shard.
+type responseDispatcher struct {
+	tunnel  *Tunnel
+	queues  []chan dispatchItem
+	wg      sync.WaitGroup
+	dropped atomic.Int64 // Responses dropped because their shard's queue was full
+}
+
+// dispatchItem is a raw response waiting to be delivered
+type dispatchItem struct {
+	requestID string
+	msg       []byte
+}
+
+// newResponseDispatcher starts a dispatcher with the given number of workers
+func newResponseDispatcher(t *Tunnel, workers int) *responseDispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+
+	d := &responseDispatcher{
+		tunnel: t,
+		queues: make([]chan dispatchItem, workers),
+	}
+	for i := range d.queues {
+		d.queues[i] = make(chan dispatchItem, dispatchQueueSize)
+		d.wg.Add(1)
+		go d.run(d.queues[i])
+	}
+	return d
+}
+
+// dispatch queues a response for delivery to the handler waiting on requestID.
+// If the request's shard is backed up the response is dropped and the handler
+// is released at once, answering the visitor instead of waiting for the timeout.
+func (d *responseDispatcher) dispatch(requestID string, msg []byte) {
+	h := fnv.New32a()
+	h.Write([]byte(requestID))
+	select {
+	case d.queues[h.Sum32()%uint32(len(d.queues))] <- dispatchItem{requestID: requestID, msg: msg}:
+	default:
+		dropped := d.dropped.Add(1)
+		log.Printf("Tunnel %s: response queue full, dropped response for %s (%d dropped)", d.tunnel.Subdomain, requestID, dropped)
+		d.tunnel.RemoveResponseChannel(requestID)
+	}
+}
+
+// close stops the workers after all queued responses are delivered
+func (d *responseDispatcher) close() {
+	for _, q := range d.queues {
+		close(q)
+	}
+	d.wg.Wait()
+}
+
+// run delivers queued responses until the queue is closed
+func (d *responseDispatcher) run(queue <-chan dispatchItem) {
+	defer d.wg.Done()
+	for item := range queue {
+		if ch, ok := d.tunnel.GetResponseChannel(item.requestID); ok {
+			ch <- item.msg
+		}
+	}
+}
+
+// peekMessage reads the message type and payload ID from a raw tunnel message.
+// It stops decoding as soon as both are known, so large response bodies after
+// the ID are not scanned. ok is false if the message is not a JSON object.
+func peekMessage(msg []byte) (msgType, id string, ok bool) {
+	dec := json.NewDecoder(bytes.NewReader(msg))
+	if !expectDelim(dec, '{') {
+		return "", "", false
+	}
+
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return "", "", false
+		}
+
+		switch key {
+		case "type":
+			if err := dec.Decode(&msgType); err != nil {
+				return "", "", false
+			}
+		case "payload":
+			if msgType != "" {
+				id, ok = peekPayloadID(dec)
+				return msgType, id, ok
+			}
+			// Payload before type: fall back to skipping it
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return "", "", false
+			}
+			var full struct {
+				ID string `json:"id"`
+			}
+			json.Unmarshal(skip, &full)
+			id = full.ID
+		default:
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return "", "", false
+			}
+		}
+	}
+
+	return msgType, id, true
+}
+
+// peekPayloadID reads the "id" field of the payload object the decoder is positioned at
+func peekPayloadID(dec *json.Decoder) (string, bool) {
+	if !expectDelim(dec, '{') {
+		// Non-object payloads (e.g. null) carry no ID
+		return "", true
+	}
+
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return "", false
+		}
+		if key == "id" {
+			var id string
+			if err := dec.Decode(&id); err != nil {
+				return "", false
+			}
+			return id, true
+		}
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return "", false
+		}
+	}
+	return "", true
+}
+
+// expectDelim reads the next token and reports whether it is the given delimiter
+func expectDelim(dec *json.Decoder, delim json.Delim) bool {
+	tok, err := dec.Token()
+	if err != nil {
+		return false
+	}
+	d, isDelim := tok.(json.Delim)
+	return isDelim && d == delim
+}
+
+// GetTunnelDispatchWorkers returns the number of response dispatch workers per tunnel from environment or default
+func GetTunnelDispatchWorkers() int {
+	if workers := os.Getenv("TUNNEL_DISPATCH_WORKERS"); workers != "" {
+		var n int
+		fmt.Sscanf(workers, "%d", &n)
+		if n > 0 {
+			return n
+		}
+	}
+	return 4
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/protocol"
+)
+
+func TestPeekMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		msg      string
+		wantType string
+		wantID   string
+		wantOK   bool
+	}{
+		{"response", `{"type":"http_response","payload":{"id":"req-1","status_code":200,"body":"aGk="}}`, "http_response", "req-1", true},
+		{"id after body", `{"type":"http_response","payload":{"status_code":200,"body":"aGk=","id":"req-2"}}`, "http_response", "req-2", true},
+		{"payload before type", `{"payload":{"id":"req-3"},"type":"http_response"}`, "http_response", "req-3", true},
+		{"no payload", `{"type":"pong"}`, "pong", "", true},
+		{"null payload", `{"type":"pong","payload":null}`, "pong", "", true},
+		{"not an object", `["http_response"]`, "", "", false},
+		{"invalid", `{"type":`, "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgType, id, ok := peekMessage([]byte(tt.msg))
+			if msgType != tt.wantType || id != tt.wantID || ok != tt.wantOK {
+				t.Errorf("peekMessage() = (%q, %q, %v), want (%q, %q, %v)", msgType, id, ok, tt.wantType, tt.wantID, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestResponseDispatcherSlowHandler(t *testing.T) {
+	tun := NewTunnel("test", nil)
+	d := newResponseDispatcher(tun, 4)
+
+	shard := func(id string) uint32 {
+		h := fnv.New32a()
+		h.Write([]byte(id))
+		return h.Sum32() % 4
+	}
+
+	// An unbuffered channel nobody reads from yet stalls its worker
+	slow := make(chan []byte)
+	tun.mu.Lock()
+	tun.ResponseCh["slow"] = slow
+	tun.mu.Unlock()
+	d.dispatch("slow", []byte("slow"))
+	defer func() {
+		// Unblock the slow handler so the workers can exit
+		go func() { <-slow }()
+		d.close()
+	}()
+
+	// Responses on other shards are still delivered
+	delivered := 0
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("req-%d", i)
+		if shard(id) == shard("slow") {
+			continue
+		}
+		ch := tun.AddResponseChannel(id)
+		d.dispatch(id, []byte(id))
+		select {
+		case msg := <-ch:
+			if string(msg) != id {
+				t.Errorf("response for %s = %q", id, msg)
+			}
+			delivered++
+		case <-time.After(time.Second):
+			t.Fatalf("response for %s blocked by slow handler", id)
+		}
+	}
+	if delivered == 0 {
+		t.Fatal("no responses on other shards")
+	}
+
+	// Once the stalled shard's queue is full, its responses are dropped instead
+	// of blocking the reader, and their handlers are released
+	var queued []string
+	for i := 0; len(queued) <= dispatchQueueSize; i++ {
+		if id := fmt.Sprintf("queued-%d", i); shard(id) == shard("slow") {
+			queued = append(queued, id)
+		}
+	}
+	for _, id := range queued[:dispatchQueueSize] {
+		tun.AddResponseChannel(id)
+		d.dispatch(id, []byte(id))
+	}
+	overflow := queued[dispatchQueueSize]
+	ch := tun.AddResponseChannel(overflow)
+	dispatched := make(chan struct{})
+	go func() {
+		d.dispatch(overflow, []byte(overflow))
+		close(dispatched)
+	}()
+	select {
+	case <-dispatched:
+	case <-time.After(time.Second):
+		t.Fatal("dispatch to a full shard blocked the reader")
+	}
+	if msg, ok := <-ch; ok {
+		t.Errorf("dropped response delivered %q, want its channel closed", msg)
+	}
+	if dropped := d.dropped.Load(); dropped != 1 {
+		t.Errorf("dropped = %d, want 1", dropped)
+	}
+}
+
+// BenchmarkTunnelResponseDispatch measures reading the type and request ID of a
+// response and delivering it to its waiting handler
+func BenchmarkTunnelResponseDispatch(b *testing.B) {
+	for _, size := range []int{1 << 10, 64 << 10, 1 << 20} {
+		msg, _ := json.Marshal(protocol.Message{
+			Type: protocol.TypeHTTPResponse,
+			Payload: protocol.HTTPResponse{
+				ID:         "00000000-0000-0000-0000-000000000000",
+				StatusCode: http.StatusOK,
+				Headers:    map[string]string{"Content-Type": "application/octet-stream"},
+				Body:       make([]byte, size),
+			},
+		})
+
+		b.Run(fmt.Sprintf("peek/%dKB", size>>10), func(b *testing.B) {
+			b.SetBytes(int64(len(msg)))
+			for i := 0; i < b.N; i++ {
+				peekMessage(msg)
+			}
+		})
+
+		b.Run(fmt.Sprintf("unmarshal/%dKB", size>>10), func(b *testing.B) {
+			b.SetBytes(int64(len(msg)))
+			for i := 0; i < b.N; i++ {
+				var m protocol.TypedMessage
+				json.Unmarshal(msg, &m)
+				var id struct {
+					ID string `json:"id"`
+				}
+				json.Unmarshal(m.Payload, &id)
+			}
+		})
+
+		b.Run(fmt.Sprintf("dispatch/%dKB", size>>10), func(b *testing.B) {
+			tun := NewTunnel("bench", nil)
+			d := newResponseDispatcher(tun, GetTunnelDispatchWorkers())
+			defer d.close()
+
+			b.SetBytes(int64(len(msg)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				id := fmt.Sprintf("req-%d", i)
+				ch := tun.AddResponseChannel(id)
+				_, _, _ = peekMessage(msg)
+				d.dispatch(id, msg)
+				<-ch
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+)
+
+// Error codes returned with platform errors. They are part of the API: clients may
+// match on them, so existing values must not change.
+const (
+	errCodeBadRequest              = "bad_request"
+	errCodeUnauthorized            = "unauthorized"
+	errCodeForbidden               = "forbidden"
+	errCodeNotFound                = "not_found"
+	errCodeMethodNotAllowed        = "method_not_allowed"
+	errCodeConflict                = "conflict"
+	errCodeInternal                = "internal_error"
+	errCodeNotImplemented          = "not_implemented"
+	errCodeUnavailable             = "service_unavailable"
+	errCodeAuthRequired            = "auth_required"
+	errCodeTunnelNotFound          = "tunnel_not_found"
+	errCodeTunnelError             = "tunnel_error"
+	errCodeTunnelTimeout           = "tunnel_timeout"
+	errCodeTunnelBadResponse       = "tunnel_bad_response"
+	errCodeTunnelDegraded          = "tunnel_degraded"
+	errCodeQuotaExceeded           = "quota_exceeded"
+	errCodeConcurrencyLimit        = "concurrency_limit"
+	errCodeRateLimited             = "rate_limited"
+	errCodeRequestBlocked          = "request_blocked"
+	errCodeHTTPSRequired           = "https_required"
+	errCodeHeadersTooLarge         = "headers_too_large"
+	errCodeResponseHeadersTooLarge = "response_headers_too_large"
+	errCodeWebSocketUnsupported    = "websocket_unsupported"
+)
+
+// errorCodeHeader carries the error code on every platform error, whatever the body format
+const errorCodeHeader = "X-Digit-Link-Error"
+
+// ErrorResponse is the JSON body of a platform error
+type ErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// writeError responds with a platform error in the format the client asked for:
+// JSON for API clients, an HTML page for browsers and plain text otherwise
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	writeNegotiatedError(w, r, status, code, message, auth.DefaultBranding)
+}
+
+// writeVisitorError responds to a tunnel visitor with an error. Browsers get
+// the organization's branded error page.
+func (s *Server) writeVisitorError(w http.ResponseWriter, r *http.Request, orgID string, status int, code, message string) {
+	writeNegotiatedError(w, r, status, code, message, func() auth.Branding {
+		return s.orgBranding(orgID)
+	})
+}
+
+// writeNegotiatedError writes an error in the format negotiated from the Accept header.
+// branding is only called when an HTML page is rendered.
+func writeNegotiatedError(w http.ResponseWriter, r *http.Request, status int, code, message string, branding func() auth.Branding) {
+	w.Header().Set(errorCodeHeader, code)
+
+	switch {
+	case acceptsJSON(r):
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: message, Code: code})
+	case acceptsHTML(r):
+		auth.RenderErrorPage(w, status, message, branding())
+	default:
+		http.Error(w, message, status)
+	}
+}
+
+// orgBranding returns an organization's page branding, or the defaults
+func (s *Server) orgBranding(orgID string) auth.Branding {
+	if s.authMiddleware == nil {
+		return auth.DefaultBranding()
+	}
+	return s.authMiddleware.BrandingForOrg(orgID)
+}
+
+// orgIDForSubdomain returns the organization owning a subdomain's application, if any
+func (s *Server) orgIDForSubdomain(subdomain string) string {
+	if s.db == nil {
+		return ""
+	}
+	app, err := s.db.GetApplicationBySubdomain(subdomain)
+	if err != nil || app == nil {
+		return ""
+	}
+	return app.OrgID
+}
+
+// acceptsJSON reports whether the request asks for a JSON response
+func acceptsJSON(r *http.Request) bool {
+	if r == nil {
+		return false
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") || strings.Contains(accept, "+json")
+}
+
+// acceptsHTML reports whether the request comes from a browser asking for an HTML page
+func acceptsHTML(r *http.Request) bool {
+	return r != nil && strings.Contains(r.Header.Get("Accept"), "text/html")
+}
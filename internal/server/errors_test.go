@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestWriteVisitorErrorBranding(t *testing.T) {
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	branding := db.OrgBranding{LogoURL: "https://cdn.acme.test/logo.svg", PrimaryColor: "#ff0000", ProductName: "Acme <Tunnels>"}
+	if err := auth.ValidateBranding(branding); err != nil {
+		t.Fatalf("ValidateBranding() error: %v", err)
+	}
+	if err := database.UpdateOrganizationBranding(org.ID, branding); err != nil {
+		t.Fatalf("UpdateOrganizationBranding() error: %v", err)
+	}
+
+	s := newTestServer(database)
+
+	// Browsers get the org's branded page
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept", "text/html,application/xhtml+xml")
+	w := httptest.NewRecorder()
+	s.writeVisitorError(w, r, org.ID, http.StatusBadGateway, errCodeTunnelError, "Tunnel error")
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadGateway)
+	}
+	body := w.Body.String()
+	for _, want := range []string{"Tunnel error", "https://cdn.acme.test/logo.svg", "#ff0000", "255, 0, 0", "Acme &lt;Tunnels&gt;"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("branded page missing %q", want)
+		}
+	}
+
+	// Other clients keep plain text
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	w = httptest.NewRecorder()
+	s.writeVisitorError(w, r, org.ID, http.StatusBadGateway, errCodeTunnelError, "Tunnel error")
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q, want text/plain", ct)
+	}
+
+	for _, bad := range []db.OrgBranding{
+		{LogoURL: "http://cdn.acme.test/logo.svg"},
+		{LogoURL: "javascript:alert(1)"},
+		{PrimaryColor: "red; background: url(x)"},
+		{ProductName: "line\nbreak"},
+	} {
+		if err := auth.ValidateBranding(bad); err == nil {
+			t.Errorf("ValidateBranding(%+v) = nil, want error", bad)
+		}
+	}
+}
+
+func TestWriteErrorNegotiation(t *testing.T) {
+	tests := []struct {
+		name        string
+		accept      string
+		contentType string
+	}{
+		{"json", "application/json", "application/json"},
+		{"problem json", "application/problem+json", "application/json"},
+		{"browser", "text/html,application/xhtml+xml,*/*;q=0.8", "text/html"},
+		{"curl", "*/*", "text/plain"},
+		{"none", "", "text/plain"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/missing", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			writeError(w, r, http.StatusNotFound, errCodeNotFound, "Not found")
+
+			if w.Code != http.StatusNotFound {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, tt.contentType) {
+				t.Errorf("Content-Type = %q, want %s", ct, tt.contentType)
+			}
+			if code := w.Header().Get(errorCodeHeader); code != errCodeNotFound {
+				t.Errorf("%s = %q, want %q", errorCodeHeader, code, errCodeNotFound)
+			}
+			if tt.contentType == "application/json" {
+				var resp ErrorResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatalf("invalid JSON body: %v", err)
+				}
+				if resp.Code != errCodeNotFound || resp.Error != "Not found" {
+					t.Errorf("body = %+v", resp)
+				}
+			}
+			if !strings.Contains(w.Body.String(), "Not found") {
+				t.Errorf("body %q missing message", w.Body.String())
+			}
+		})
+	}
+}
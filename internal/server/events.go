@@ -0,0 +1,262 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types published on the admin and org event streams
+const (
+	EventTunnelConnected        = "tunnel.connected"
+	EventTunnelDisconnected     = "tunnel.disconnected"
+	EventTunnelRejected         = "tunnel.rejected"
+	EventAuthFailed             = "auth.failed"
+	EventAccountTOTPReset       = "account.totp_reset"
+	EventAccountSessionsRevoked = "account.sessions_revoked"
+	EventAccountSessionEvicted  = "account.session_evicted"
+	EventAppReleased            = "app.released"
+)
+
+const (
+	// eventHeartbeatInterval is how often an idle event stream gets a comment
+	// line, so proxies and load balancers do not close the connection
+	eventHeartbeatInterval = 15 * time.Second
+
+	// eventSubscriberBuffer is how many events a slow subscriber may fall
+	// behind before further events are dropped for it
+	eventSubscriberBuffer = 64
+)
+
+// Event is a tunnel or auth event streamed to the admin dashboard
+type Event struct {
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	Subdomain string    `json:"subdomain,omitempty"`
+	OrgID     string    `json:"orgId,omitempty"`
+	AppID     string    `json:"appId,omitempty"`
+	AccountID string    `json:"accountId,omitempty"`
+	ClientIP  string    `json:"clientIp,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+
+	Request *RequestLogEntry `json:"request,omitempty"` // Only on request-log streams
+}
+
+// EventFilter selects which events a subscriber receives. Empty fields match everything.
+type EventFilter struct {
+	OrgID     string
+	AppID     string
+	AccountID string
+	Types     map[string]bool
+}
+
+// Matches reports whether the event passes the filter
+func (f EventFilter) Matches(e Event) bool {
+	if f.OrgID != "" && e.OrgID != f.OrgID {
+		return false
+	}
+	if f.AppID != "" && e.AppID != f.AppID {
+		return false
+	}
+	if f.AccountID != "" && e.AccountID != f.AccountID {
+		return false
+	}
+	if len(f.Types) > 0 && !f.Types[e.Type] {
+		return false
+	}
+	return true
+}
+
+// eventSubscriber is a single event stream connection
+type eventSubscriber struct {
+	ch     chan Event
+	filter EventFilter
+}
+
+// EventBus fans out events to subscribed event streams
+type EventBus struct {
+	mu     sync.RWMutex
+	subs   map[*eventSubscriber]struct{}
+	closed bool
+}
+
+// NewEventBus creates an empty event bus
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[*eventSubscriber]struct{})}
+}
+
+// Subscribe registers a subscriber and returns its event channel and an
+// unsubscribe function that must be called when the stream ends
+func (b *EventBus) Subscribe(filter EventFilter) (<-chan Event, func()) {
+	sub := &eventSubscriber{
+		ch:     make(chan Event, eventSubscriberBuffer),
+		filter: filter,
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		close(sub.ch)
+	} else {
+		b.subs[sub] = struct{}{}
+	}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, sub)
+			b.mu.Unlock()
+		})
+	}
+}
+
+// Publish sends an event to all matching subscribers. It never blocks: events
+// for subscribers whose buffer is full are dropped.
+func (b *EventBus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subs {
+		if !sub.filter.Matches(e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+		}
+	}
+}
+
+// Close ends all event streams by closing their channels. Streams would
+// otherwise keep graceful shutdown waiting until its deadline.
+func (b *EventBus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subs {
+		close(sub.ch)
+		delete(b.subs, sub)
+	}
+}
+
+// Subscribers returns the number of connected subscribers
+func (b *EventBus) Subscribers() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs)
+}
+
+// publishEvent publishes an event if the server has an event bus
+func (s *Server) publishEvent(e Event) {
+	if s.events != nil {
+		e.Reason = s.redaction.RedactString(e.Reason)
+		s.events.Publish(e)
+	}
+}
+
+// eventFilterFromQuery builds a filter from the org, app and types query parameters
+func eventFilterFromQuery(r *http.Request) EventFilter {
+	q := r.URL.Query()
+	filter := EventFilter{
+		OrgID: q.Get("org"),
+		AppID: q.Get("app"),
+	}
+	if types := q.Get("types"); types != "" {
+		filter.Types = make(map[string]bool)
+		for _, t := range strings.Split(types, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				filter.Types[t] = true
+			}
+		}
+	}
+	return filter
+}
+
+// handleAdminEvents streams tunnel and auth events as Server-Sent Events.
+// Optional query parameters: org, app (IDs) and types (comma-separated event types).
+func (s *Server) handleAdminEvents(w http.ResponseWriter, r *http.Request) {
+	s.streamEvents(w, r, s.events, eventFilterFromQuery(r))
+}
+
+// handleOrgEvents streams events for the caller's organization. Org admins see
+// all events of the org; members only see events for tunnels they connected.
+func (s *Server) handleOrgEvents(w http.ResponseWriter, r *http.Request, orgCtx *OrgContext) {
+	filter := eventFilterFromQuery(r)
+
+	// The stream is always scoped to the caller's org, whatever the query says
+	filter.OrgID = orgCtx.OrgID
+	if !orgCtx.IsOrgAdmin {
+		filter.AccountID = orgCtx.AccountID
+	}
+
+	if filter.AppID != "" {
+		app, err := s.verifyOrgOwnership(orgCtx, filter.AppID)
+		if err != nil || app == nil {
+			jsonError(w, "Application not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	s.streamEvents(w, r, s.events, filter)
+}
+
+// streamEvents writes events on bus matching filter to w until the client goes
+// away or the bus is closed
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request, bus *EventBus, filter EventFilter) {
+	flusher, ok := w.(http.Flusher)
+	if !ok || bus == nil {
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Event streaming not supported")
+		return
+	}
+
+	events, unsubscribe := bus.Subscribe(filter)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable nginx response buffering
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				log.Printf("Failed to encode event: %v", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
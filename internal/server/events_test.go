@@ -0,0 +1,103 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminEventStream(t *testing.T) {
+	s := newTestServer(nil)
+	ts := httptest.NewServer(http.HandlerFunc(s.handleAdminEvents))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/admin/events?org=org-1", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /admin/events error: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	if line, _ := reader.ReadString('\n'); line != ": connected\n" {
+		t.Fatalf("first line = %q, want connected comment", line)
+	}
+	reader.ReadString('\n')
+
+	s.publishEvent(Event{Type: EventTunnelConnected, Subdomain: "other", OrgID: "org-2"})
+	s.publishEvent(Event{Type: EventAuthFailed, Subdomain: "web", OrgID: "org-1", Reason: "invalid API key"})
+
+	if line, _ := reader.ReadString('\n'); line != "event: auth.failed\n" {
+		t.Fatalf("event line = %q, want auth.failed for the filtered org only", line)
+	}
+	data, _ := reader.ReadString('\n')
+	var e Event
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &e); err != nil {
+		t.Fatalf("invalid event data %q: %v", data, err)
+	}
+	if e.Subdomain != "web" || e.Reason != "invalid API key" || e.Time.IsZero() {
+		t.Errorf("event = %+v", e)
+	}
+
+	// Disconnecting the client must unsubscribe it
+	cancel()
+	deadline := time.Now().Add(2 * time.Second)
+	for s.events.Subscribers() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("subscriber not removed after client disconnect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestOrgEventStreamScope(t *testing.T) {
+	s := newTestServer(nil)
+
+	// firstEvent subscribes as orgCtx (asking for another org's events) and
+	// returns the subdomain of the first event it receives
+	firstEvent := func(orgCtx *OrgContext) string {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s.handleOrgEvents(w, r, orgCtx)
+		}))
+		defer ts.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/org/events?org=org-2", nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET /org/events error: %v", err)
+		}
+		defer resp.Body.Close()
+		reader := bufio.NewReader(resp.Body)
+		reader.ReadString('\n')
+		reader.ReadString('\n')
+
+		s.publishEvent(Event{Type: EventTunnelConnected, Subdomain: "foreign", OrgID: "org-2", AccountID: "acct-3"})
+		s.publishEvent(Event{Type: EventTunnelConnected, Subdomain: "colleague", OrgID: "org-1", AccountID: "acct-2"})
+		s.publishEvent(Event{Type: EventTunnelConnected, Subdomain: "own", OrgID: "org-1", AccountID: "acct-1"})
+
+		reader.ReadString('\n')
+		data, _ := reader.ReadString('\n')
+		var e Event
+		json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &e)
+		return e.Subdomain
+	}
+
+	if got := firstEvent(&OrgContext{AccountID: "acct-1", OrgID: "org-1", IsOrgAdmin: true}); got != "colleague" {
+		t.Errorf("org admin first event = %q, want colleague", got)
+	}
+	if got := firstEvent(&OrgContext{AccountID: "acct-1", OrgID: "org-1"}); got != "own" {
+		t.Errorf("member first event = %q, want own", got)
+	}
+}
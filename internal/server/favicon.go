@@ -0,0 +1,142 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// maxFaviconBytes is the largest favicon an application can upload
+const maxFaviconBytes = 64 * 1024
+
+// faviconPath is the path browsers request favicons from
+const faviconPath = "/favicon.ico"
+
+// defaultFavicon is served for /favicon.ico when no favicon is uploaded and no tunnel can answer
+var defaultFavicon = &db.AppFavicon{
+	ContentType: "image/svg+xml",
+	Data: []byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 32 32">` +
+		`<rect x="2" y="2" width="28" height="28" rx="7" fill="#0a0a0b" stroke="#6ee7b7" stroke-width="2.5"/>` +
+		`<rect x="11" y="11" width="10" height="10" rx="2" fill="#6ee7b7" transform="rotate(45 16 16)"/></svg>`),
+	UpdatedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+}
+
+// detectFaviconType returns the content type of an uploaded favicon, or "" if it is not an
+// ICO, PNG, GIF or SVG image. The declared content type is ignored so uploads can't mislabel themselves.
+func detectFaviconType(data []byte) string {
+	if bytes.HasPrefix(data, []byte{0, 0, 1, 0}) {
+		return "image/x-icon"
+	}
+	switch ct := http.DetectContentType(data); ct {
+	case "image/png", "image/gif":
+		return ct
+	}
+	head := strings.ToLower(string(bytes.TrimSpace(data[:min(len(data), 512)])))
+	if strings.HasPrefix(head, "<svg") || (strings.HasPrefix(head, "<?xml") && strings.Contains(head, "<svg")) {
+		return "image/svg+xml"
+	}
+	return ""
+}
+
+// isFaviconRequest reports whether the request is a browser fetching the site icon
+func isFaviconRequest(r *http.Request) bool {
+	return r.URL.Path == faviconPath && (r.Method == http.MethodGet || r.Method == http.MethodHead)
+}
+
+// serveFavicon writes a favicon with caching headers, answering conditional requests
+func serveFavicon(w http.ResponseWriter, r *http.Request, f *db.AppFavicon) {
+	w.Header().Set("Content-Type", f.ContentType)
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// SVG can carry scripts; never let them run
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	http.ServeContent(w, r, faviconPath, f.UpdatedAt, bytes.NewReader(f.Data))
+}
+
+// serveAppFavicon serves the uploaded favicon of the subdomain's application.
+// Returns false if the app has none, so the request continues to the tunnel.
+func (s *Server) serveAppFavicon(w http.ResponseWriter, r *http.Request, subdomain string) bool {
+	if s.db == nil {
+		return false
+	}
+	f, err := s.db.GetAppFaviconBySubdomain(subdomain)
+	if err != nil {
+		log.Printf("Failed to get favicon for %s: %v", subdomain, err)
+		return false
+	}
+	if f == nil {
+		return false
+	}
+	serveFavicon(w, r, f)
+	return true
+}
+
+// handleOrgSetAppFavicon uploads an application's favicon (raw image body, ICO/PNG/GIF/SVG)
+func (s *Server) handleOrgSetAppFavicon(w http.ResponseWriter, r *http.Request, orgCtx *OrgContext, appID string) {
+	app, err := s.verifyOrgOwnership(orgCtx, appID)
+	if err != nil {
+		log.Printf("Failed to get application: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if app == nil {
+		jsonError(w, "Application not found", http.StatusNotFound)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxFaviconBytes))
+	if err != nil {
+		jsonError(w, "Favicon must be at most 64 KB", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if len(data) == 0 {
+		jsonError(w, "Favicon is empty", http.StatusBadRequest)
+		return
+	}
+	contentType := detectFaviconType(data)
+	if contentType == "" {
+		jsonError(w, "Favicon must be an ICO, PNG, GIF or SVG image", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if err := s.db.SetAppFavicon(appID, contentType, data); err != nil {
+		log.Printf("Failed to set favicon: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Org app favicon updated: %s by %s", appID, orgCtx.Username)
+	jsonResponse(w, map[string]interface{}{
+		"success":     true,
+		"contentType": contentType,
+		"size":        len(data),
+	})
+}
+
+// handleOrgDeleteAppFavicon removes an application's favicon
+func (s *Server) handleOrgDeleteAppFavicon(w http.ResponseWriter, r *http.Request, orgCtx *OrgContext, appID string) {
+	app, err := s.verifyOrgOwnership(orgCtx, appID)
+	if err != nil {
+		log.Printf("Failed to get application: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if app == nil {
+		jsonError(w, "Application not found", http.StatusNotFound)
+		return
+	}
+
+	if err := s.db.DeleteAppFavicon(appID); err != nil {
+		log.Printf("Failed to delete favicon: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Org app favicon deleted: %s by %s", appID, orgCtx.Username)
+	jsonResponse(w, map[string]bool{"success": true})
+}
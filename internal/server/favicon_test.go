@@ -0,0 +1,62 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAppFavicon(t *testing.T) {
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	app, err := database.CreateApplication(org.ID, "myapp", "My App")
+	if err != nil {
+		t.Fatalf("CreateApplication() error: %v", err)
+	}
+
+	s := newTestServer(database)
+	s.domain = "link.digit.zone"
+	orgCtx := &OrgContext{OrgID: org.ID, Username: "alice"}
+	upload := func(body []byte) int {
+		r := httptest.NewRequest(http.MethodPut, "/org/applications/"+app.ID+"/favicon", strings.NewReader(string(body)))
+		w := httptest.NewRecorder()
+		s.handleOrgSetAppFavicon(w, r, orgCtx, app.ID)
+		return w.Code
+	}
+
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	if code := upload(png); code != http.StatusOK {
+		t.Fatalf("upload PNG: status = %d, want 200", code)
+	}
+	if code := upload([]byte("<html><script>alert(1)</script></html>")); code != http.StatusUnsupportedMediaType {
+		t.Errorf("upload HTML: status = %d, want %d", code, http.StatusUnsupportedMediaType)
+	}
+	if code := upload(make([]byte, maxFaviconBytes+1)); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("upload oversized: status = %d, want %d", code, http.StatusRequestEntityTooLarge)
+	}
+
+	// The uploaded icon is served without a tunnel being connected
+	r := httptest.NewRequest(http.MethodGet, "/favicon.ico", nil)
+	r.Host = "myapp.link.digit.zone"
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" || !bytes.Equal(w.Body.Bytes(), png) {
+		t.Errorf("favicon = %d %q, want the uploaded PNG", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	// Without an upload, an unconnected subdomain gets the default icon
+	if err := database.DeleteAppFavicon(app.ID); err != nil {
+		t.Fatalf("DeleteAppFavicon() error: %v", err)
+	}
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Errorf("default favicon = %d %q, want SVG", w.Code, w.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// featureFlagDefaults are the known feature flags with their built-in defaults,
+// which the feature_flags setting overrides server-wide
+var featureFlagDefaults = db.FeatureFlags{
+	db.FeatureStreaming:           true,
+	db.FeatureRequestLog:          true,
+	db.FeatureReleaseInactiveApps: false,
+	db.FeatureGRPC:                false,
+}
+
+// validateFeatureFlag checks that a flag is known
+func validateFeatureFlag(flag string) error {
+	if _, ok := featureFlagDefaults[flag]; !ok {
+		return fmt.Errorf("unknown feature flag %q", flag)
+	}
+	return nil
+}
+
+// parseFeatureFlagDefaults decodes the feature_flags setting. Flags it leaves
+// out keep their built-in default.
+func parseFeatureFlagDefaults(raw json.RawMessage) (interface{}, error) {
+	var set map[string]bool
+	if err := decodeSetting(raw, &set); err != nil {
+		return nil, err
+	}
+	flags := copyFeatureFlags(featureFlagDefaults)
+	for flag, enabled := range set {
+		if err := validateFeatureFlag(flag); err != nil {
+			return nil, err
+		}
+		flags[flag] = enabled
+	}
+	return flags, nil
+}
+
+// copyFeatureFlags returns a copy of flags
+func copyFeatureFlags(flags db.FeatureFlags) db.FeatureFlags {
+	copied := make(db.FeatureFlags, len(flags))
+	for flag, enabled := range flags {
+		copied[flag] = enabled
+	}
+	return copied
+}
+
+// featureFlagCache keeps the organizations' feature flag overrides in memory,
+// since flags are checked on every request. A nil cache has no overrides.
+type featureFlagCache struct {
+	db   *db.DB
+	mu   sync.RWMutex
+	orgs map[string]db.FeatureFlags
+}
+
+// newFeatureFlagCache creates an empty feature flag cache
+func newFeatureFlagCache(database *db.DB) *featureFlagCache {
+	return &featureFlagCache{db: database, orgs: make(map[string]db.FeatureFlags)}
+}
+
+// get returns an organization's overrides
+func (c *featureFlagCache) get(orgID string) (db.FeatureFlags, error) {
+	if c == nil {
+		return nil, nil
+	}
+	c.mu.RLock()
+	flags, ok := c.orgs[orgID]
+	c.mu.RUnlock()
+	if ok {
+		return flags, nil
+	}
+
+	flags, err := c.db.GetOrgFeatureFlags(orgID)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.orgs[orgID] = flags
+	c.mu.Unlock()
+	return flags, nil
+}
+
+// invalidate drops an organization's cached overrides after they changed
+func (c *featureFlagCache) invalidate(orgID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	delete(c.orgs, orgID)
+	c.mu.Unlock()
+}
+
+// defaultFeatureFlags returns a copy of the flags of organizations that don't
+// override them, which the caller may modify
+func (s *Server) defaultFeatureFlags() db.FeatureFlags {
+	return copyFeatureFlags(s.settingValue(db.SettingFeatureFlags).(db.FeatureFlags))
+}
+
+// orgFeatureFlags returns an organization's flags in effect: its overrides on
+// top of the defaults
+func (s *Server) orgFeatureFlags(orgID string) (db.FeatureFlags, error) {
+	flags := s.defaultFeatureFlags()
+	if orgID == "" {
+		return flags, nil
+	}
+	overrides, err := s.featureFlags.get(orgID)
+	if err != nil {
+		return flags, err
+	}
+	for flag, enabled := range overrides {
+		if _, known := flags[flag]; known {
+			flags[flag] = enabled
+		}
+	}
+	return flags, nil
+}
+
+// featureEnabled reports whether a feature is enabled for an organization
+// ("" for tunnels without one). Overrides that cannot be loaded fall back to
+// the defaults.
+func (s *Server) featureEnabled(orgID, flag string) bool {
+	flags, err := s.orgFeatureFlags(orgID)
+	if err != nil {
+		log.Printf("Failed to load feature flags for org %s, using defaults: %v", orgID, err)
+	}
+	return flags[flag]
+}
+
+// featureFlagsResponse describes an organization's flags: those in effect, its
+// overrides and the defaults
+func (s *Server) featureFlagsResponse(orgID string) (map[string]interface{}, error) {
+	flags, err := s.orgFeatureFlags(orgID)
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := s.featureFlags.get(orgID)
+	if err != nil {
+		return nil, err
+	}
+	if overrides == nil {
+		overrides = db.FeatureFlags{}
+	}
+	return map[string]interface{}{
+		"orgId":     orgID,
+		"flags":     flags,
+		"overrides": overrides,
+		"defaults":  s.defaultFeatureFlags(),
+	}, nil
+}
+
+// handleGetOrgFeatureFlags returns an organization's feature flags
+func (s *Server) handleGetOrgFeatureFlags(w http.ResponseWriter, r *http.Request, orgID string) {
+	org, err := s.db.GetOrganizationByID(orgID)
+	if err != nil {
+		log.Printf("Failed to get organization: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+	if org == nil {
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Organization not found")
+		return
+	}
+
+	resp, err := s.featureFlagsResponse(orgID)
+	if err != nil {
+		log.Printf("Failed to get feature flags: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+	jsonResponse(w, resp)
+}
+
+// handleUpdateOrgFeatureFlags overrides an organization's feature flags. The
+// body maps flags to true or false, or to null to use the default again; flags
+// it leaves out are unchanged. The change is written to the audit log.
+func (s *Server) handleUpdateOrgFeatureFlags(w http.ResponseWriter, r *http.Request, orgID, adminUsername string) {
+	if !validateJSONContentType(w, r) {
+		return
+	}
+	limitRequestBody(r)
+
+	var req map[string]*bool
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "Invalid request body")
+		return
+	}
+	changes := make([]string, 0, len(req))
+	for flag, enabled := range req {
+		if err := validateFeatureFlag(flag); err != nil {
+			writeError(w, r, http.StatusBadRequest, errCodeBadRequest, err.Error())
+			return
+		}
+		value := "default"
+		if enabled != nil {
+			value = fmt.Sprint(*enabled)
+		}
+		changes = append(changes, flag+"="+value)
+	}
+	sort.Strings(changes)
+
+	org, err := s.db.GetOrganizationByID(orgID)
+	if err != nil {
+		log.Printf("Failed to get organization: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+	if org == nil {
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Organization not found")
+		return
+	}
+
+	if err := s.db.SetOrgFeatureFlags(orgID, req); err != nil {
+		log.Printf("Failed to set feature flags: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+	s.featureFlags.invalidate(orgID)
+
+	change := strings.Join(changes, " ")
+	log.Printf("Feature flags of org %s changed by admin %s: %s", org.Name, adminUsername, change)
+	if err := s.db.LogAdminAction(&orgID, db.AuditTypeFeatureFlagsChanged, auth.GetClientIP(r), adminUsername, change); err != nil {
+		log.Printf("Failed to audit feature flag change: %v", err)
+	}
+
+	resp, err := s.featureFlagsResponse(orgID)
+	if err != nil {
+		log.Printf("Failed to get feature flags: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+	jsonResponse(w, resp)
+}
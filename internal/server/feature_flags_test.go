@@ -0,0 +1,119 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestOrgFeatureFlags(t *testing.T) {
+	database := newTestDB(t)
+
+	org, _ := database.CreateOrganization("acme")
+	other, _ := database.CreateOrganization("other")
+	app, err := database.CreateApplication(org.ID, "web", "web")
+	if err != nil {
+		t.Fatalf("CreateApplication() error: %v", err)
+	}
+
+	s := newTestServer(database)
+	s.requestLog = NewRequestLog()
+	put := func(handler func(w http.ResponseWriter, r *http.Request), body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPut, "/admin/test", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+	putDefaults := func(body string) *httptest.ResponseRecorder {
+		return put(func(w http.ResponseWriter, r *http.Request) {
+			s.handleUpdateSetting(w, r, db.SettingFeatureFlags, "root")
+		}, body)
+	}
+	putOrg := func(orgID, body string) *httptest.ResponseRecorder {
+		return put(func(w http.ResponseWriter, r *http.Request) {
+			s.handleUpdateOrgFeatureFlags(w, r, orgID, "root")
+		}, body)
+	}
+	enabled := func(orgID string) (streaming, requestLog bool) {
+		return s.featureEnabled(orgID, db.FeatureStreaming), s.featureEnabled(orgID, db.FeatureRequestLog)
+	}
+
+	if streaming, requestLog := enabled(org.ID); !streaming || !requestLog {
+		t.Errorf("built-in defaults = %v %v, want both enabled", streaming, requestLog)
+	}
+
+	// Defaults come from the global feature_flags setting
+	if w := putDefaults(`{"request_log":false}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT feature_flags = %d: %s", w.Code, w.Body.String())
+	}
+	if w := putDefaults(`{"caching":true}`); w.Code != http.StatusBadRequest {
+		t.Errorf("PUT feature_flags with an unknown flag = %d, want 400", w.Code)
+	}
+	if streaming, requestLog := enabled(org.ID); !streaming || requestLog {
+		t.Errorf("after changing the defaults = %v %v, want streaming only", streaming, requestLog)
+	}
+
+	// Org overrides win over the defaults, for that org only
+	if w := putOrg(org.ID, `{"request_log":true,"streaming":false}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT org features = %d: %s", w.Code, w.Body.String())
+	}
+	if streaming, requestLog := enabled(org.ID); streaming || !requestLog {
+		t.Errorf("org with overrides = %v %v, want request_log only", streaming, requestLog)
+	}
+	if streaming, requestLog := enabled(other.ID); !streaming || requestLog {
+		t.Errorf("other org = %v %v, want the defaults", streaming, requestLog)
+	}
+	for _, body := range []string{`{"caching":true}`, `{"streaming":"yes"}`} {
+		if w := putOrg(org.ID, body); w.Code != http.StatusBadRequest {
+			t.Errorf("PUT org features %s = %d, want 400", body, w.Code)
+		}
+	}
+	if w := putOrg("no-such-org", `{"streaming":true}`); w.Code != http.StatusNotFound {
+		t.Errorf("PUT features of a missing org = %d, want 404", w.Code)
+	}
+
+	// The request log follows the org's flag
+	orgCtx := &OrgContext{AccountID: "acct-1", OrgID: org.ID}
+	tail := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.handleOrgAppLogsTail(w, httptest.NewRequest(http.MethodGet, "/org/applications/"+app.ID+"/logs/tail?follow=false", nil), orgCtx, app.ID)
+		return w
+	}
+	s.recordRequest(httptest.NewRequest(http.MethodGet, "/", nil), org.ID, app.ID, "web", http.StatusOK, time.Now())
+	if w := tail(); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":200`) {
+		t.Errorf("tail with request_log on = %d %s", w.Code, w.Body.String())
+	}
+
+	// null returns a flag to the default
+	if w := putOrg(org.ID, `{"request_log":null}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT org features = %d: %s", w.Code, w.Body.String())
+	}
+	if w := tail(); w.Code != http.StatusForbidden {
+		t.Errorf("tail with request_log off = %d, want 403", w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	s.handleGetOrganization(w, httptest.NewRequest(http.MethodGet, "/admin/organizations/"+org.ID, nil), org.ID)
+	var resp struct {
+		FeatureFlags db.FeatureFlags `json:"featureFlags"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if !reflect.DeepEqual(resp.FeatureFlags, db.FeatureFlags{db.FeatureStreaming: false, db.FeatureRequestLog: false, db.FeatureReleaseInactiveApps: false, db.FeatureGRPC: false}) {
+		t.Errorf("organization featureFlags = %v, want the flags in effect", resp.FeatureFlags)
+	}
+
+	events, err := database.GetAuditEvents(&org.ID, nil, 10, 0)
+	if err != nil {
+		t.Fatalf("GetAuditEvents() error: %v", err)
+	}
+	if len(events) != 2 || events[1].AuthType != db.AuditTypeFeatureFlagsChanged || events[1].UserIdentity != "request_log=true streaming=false" {
+		t.Errorf("audit events = %+v, want two feature_flags_changed", events)
+	}
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// maxHSTSMaxAge bounds the force_https setting's HSTS max-age (two years)
+const maxHSTSMaxAge = 2 * 365 * 24 * 60 * 60
+
+// validateForceHTTPSMode checks an application's force HTTPS mode; "" inherits
+// the server's force_https setting
+func validateForceHTTPSMode(mode string) error {
+	switch mode {
+	case "", db.ForceHTTPSOff, db.ForceHTTPSRedirect, db.ForceHTTPSReject:
+		return nil
+	}
+	return fmt.Errorf("forceHttps must be %q, %q, %q or empty", db.ForceHTTPSOff, db.ForceHTTPSRedirect, db.ForceHTTPSReject)
+}
+
+// requestScheme returns the scheme the visitor used: https on TLS connections,
+// otherwise the X-Forwarded-Proto of the TLS-terminating proxy in front. Unlike
+// client IPs the header is taken from any peer: spoofing it only lets a visitor
+// skip the redirect of their own request.
+func requestScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		proto, _, _ = strings.Cut(proto, ",")
+		return strings.ToLower(strings.TrimSpace(proto))
+	}
+	return "http"
+}
+
+// forceHTTPSMode returns the force HTTPS mode of a subdomain: its application's
+// own mode, or the server's force_https setting
+func forceHTTPSMode(app *db.Application, settings *db.ForceHTTPSSettings) string {
+	if app != nil && app.ForceHTTPS != "" {
+		return app.ForceHTTPS
+	}
+	return settings.Mode
+}
+
+// enforceHTTPS redirects or rejects plain HTTP requests to a tunnel that forces
+// HTTPS, and adds the HSTS header to its HTTPS responses. It only applies when
+// the server's public scheme is https, and leaves ACME challenges alone.
+// Returns true when the request was answered.
+func (s *Server) enforceHTTPS(w http.ResponseWriter, r *http.Request, subdomain string, app *db.Application) bool {
+	if s.scheme != "https" || subdomain == "" {
+		return false
+	}
+	settings := s.settingValue(db.SettingForceHTTPS).(*db.ForceHTTPSSettings)
+	mode := forceHTTPSMode(app, settings)
+	if mode == db.ForceHTTPSOff || mode == "" {
+		return false
+	}
+
+	if requestScheme(r) == "https" {
+		if settings.HSTSMaxAge > 0 {
+			w.Header().Set("Strict-Transport-Security", "max-age="+strconv.Itoa(settings.HSTSMaxAge))
+		}
+		return false
+	}
+	if strings.HasPrefix(r.URL.Path, "/.well-known/acme-challenge/") {
+		return false
+	}
+
+	if mode == db.ForceHTTPSReject {
+		s.writeVisitorError(w, r, s.orgIDForSubdomain(subdomain), http.StatusForbidden, errCodeHTTPSRequired, "This application is only served over HTTPS")
+		return true
+	}
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	// 308 keeps the method and body of requests other than GET and HEAD
+	status := http.StatusMovedPermanently
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		status = http.StatusPermanentRedirect
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	return true
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestForceHTTPS(t *testing.T) {
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	secure, err := database.CreateApplication(org.ID, "secure", "Secure")
+	if err != nil {
+		t.Fatalf("CreateApplication() error: %v", err)
+	}
+	if err := database.UpdateApplicationForceHTTPS(secure.ID, db.ForceHTTPSRedirect); err != nil {
+		t.Fatalf("UpdateApplicationForceHTTPS() error: %v", err)
+	}
+	if _, err := database.CreateApplication(org.ID, "plain", "Plain"); err != nil {
+		t.Fatalf("CreateApplication() error: %v", err)
+	}
+
+	s := newTestServer(database)
+	s.scheme = "https"
+	visit := func(method, target, proto string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		if proto != "" {
+			r.Header.Set("X-Forwarded-Proto", proto)
+		}
+		r.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+
+	w := visit(http.MethodGet, "http://secure.link.test:80/docs?page=2", "")
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "https://secure.link.test/docs?page=2" {
+		t.Errorf("GET over http = %d to %q, want 301 to https://secure.link.test/docs?page=2", w.Code, w.Header().Get("Location"))
+	}
+	if w := visit(http.MethodPost, "http://secure.link.test/form", "http"); w.Code != http.StatusPermanentRedirect {
+		t.Errorf("POST over http = %d, want 308", w.Code)
+	}
+	for _, tt := range []struct{ target, proto string }{
+		{"http://secure.link.test/docs", "https"},
+		{"http://secure.link.test/.well-known/acme-challenge/token", ""},
+		{"http://plain.link.test/docs", ""},
+	} {
+		if w := visit(http.MethodGet, tt.target, tt.proto); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s (proto %q) = %d, want it passed on (404 tunnel not found)", tt.target, tt.proto, w.Code)
+		}
+	}
+	if w := visit(http.MethodGet, "http://secure.link.test/docs", "https"); w.Header().Get("Strict-Transport-Security") != "" {
+		t.Error("HSTS sent without hstsMaxAge")
+	}
+
+	// The server setting applies to applications without their own mode
+	r := httptest.NewRequest(http.MethodPut, "/admin/settings/"+db.SettingForceHTTPS, strings.NewReader(`{"mode":"reject","hstsMaxAge":31536000}`))
+	r.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.handleUpdateSetting(rec, r, db.SettingForceHTTPS, "root")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update setting status = %d, want 200 (%s)", rec.Code, rec.Body.String())
+	}
+	if w := visit(http.MethodGet, "http://plain.link.test/docs", ""); w.Code != http.StatusForbidden || w.Header().Get(errorCodeHeader) != errCodeHTTPSRequired {
+		t.Errorf("GET plain over http = %d (%s), want 403 %s", w.Code, w.Header().Get(errorCodeHeader), errCodeHTTPSRequired)
+	}
+	if w := visit(http.MethodGet, "http://secure.link.test/docs", "https"); w.Header().Get("Strict-Transport-Security") != "max-age=31536000" {
+		t.Errorf("HSTS = %q, want max-age=31536000", w.Header().Get("Strict-Transport-Security"))
+	}
+	for _, raw := range []string{`{"mode":"always"}`, `{"mode":"redirect","hstsMaxAge":-1}`} {
+		if _, err := serverSettings[db.SettingForceHTTPS].parse(json.RawMessage(raw)); err == nil {
+			t.Errorf("force_https %s accepted, want rejected", raw)
+		}
+	}
+
+	// Without TLS in front nothing is enforced
+	s.scheme = "http"
+	if w := visit(http.MethodGet, "http://secure.link.test/docs", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET with scheme http = %d, want 404 (tunnel not found)", w.Code)
+	}
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"log"
+	"os"
+	"strconv"
+)
+
+// defaultMaxForwards is how many forwards (subdomains) one client connection may register
+const defaultMaxForwards = 10
+
+// GetTunnelMaxForwards returns the per-connection forward limit from environment or default.
+// Zero means unlimited.
+func GetTunnelMaxForwards() int {
+	if limit := os.Getenv("TUNNEL_MAX_FORWARDS"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err == nil && n >= 0 {
+			return n
+		}
+		log.Printf("WARNING: invalid TUNNEL_MAX_FORWARDS %q, using default", limit)
+	}
+	return defaultMaxForwards
+}
+
+// maxForwardsFor returns how many forwards a client connection of the organization
+// may register: its plan's limit, or the server default (0 = unlimited)
+func (s *Server) maxForwardsFor(orgID string) int {
+	if s.quotaChecker != nil && orgID != "" {
+		if n := s.quotaChecker.MaxForwards(orgID); n > 0 {
+			return n
+		}
+	}
+	return s.maxForwards
+}
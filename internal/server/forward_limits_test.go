@@ -0,0 +1,75 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/niekvdm/digit-link/internal/db"
+	"github.com/niekvdm/digit-link/internal/tunnel"
+)
+
+func TestMaxForwardsPerConnection(t *testing.T) {
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	rawKey, key, _ := db.GenerateAPIKey(&org.ID, nil, "org key", nil)
+	if err := database.CreateAPIKey(key); err != nil {
+		t.Fatalf("CreateAPIKey() error: %v", err)
+	}
+	if _, err := database.AddOrgWhitelist(org.ID, "127.0.0.1/32", "local", ""); err != nil {
+		t.Fatalf("AddOrgWhitelist() error: %v", err)
+	}
+
+	cache := NewUsageCache(database)
+	s := newTestServer(database)
+	s.usageCache = cache
+	s.quotaChecker = NewQuotaChecker(cache, database)
+	s.maxForwards = 3
+	tl := NewTunnelListener(s, nil)
+
+	authenticate := func(n int) *tunnel.AuthResponse {
+		req := &tunnel.AuthRequest{Token: rawKey}
+		for i := 0; i < n; i++ {
+			req.Forwards = append(req.Forwards, tunnel.ForwardConfig{Subdomain: fmt.Sprintf("fwd%d", i), LocalPort: 8000 + i})
+		}
+		return tl.authenticateSession(nil, req, "127.0.0.1").response
+	}
+
+	// Server default without a plan
+	if resp := authenticate(3); !resp.Success || resp.MaxForwards != 3 {
+		t.Errorf("3 forwards with default limit 3: %+v, want success advertising the limit", resp)
+	}
+	if resp := authenticate(4); resp.Success || resp.MaxForwards != 3 || !strings.Contains(resp.Error, "Too many forwards") {
+		t.Errorf("4 forwards with default limit 3: %+v, want rejection", resp)
+	}
+
+	// The plan's limit replaces the server default
+	one := 1
+	plan, err := database.CreatePlan(db.CreatePlanInput{Name: "Single", MaxForwards: &one})
+	if err != nil {
+		t.Fatalf("CreatePlan() error: %v", err)
+	}
+	if err := database.UpdateOrganizationPlan(org.ID, &plan.ID); err != nil {
+		t.Fatalf("UpdateOrganizationPlan() error: %v", err)
+	}
+	cache.UpdateOrgPlanID(org.ID, &plan.ID)
+	if resp := authenticate(2); resp.Success || resp.MaxForwards != 1 {
+		t.Errorf("2 forwards with plan limit 1: %+v, want rejection", resp)
+	}
+	if resp := authenticate(1); !resp.Success {
+		t.Errorf("1 forward with plan limit 1: %+v, want success", resp)
+	}
+
+	s.maxForwards = 0
+	if err := database.UpdateOrganizationPlan(org.ID, nil); err != nil {
+		t.Fatalf("UpdateOrganizationPlan() error: %v", err)
+	}
+	cache.UpdateOrgPlanID(org.ID, nil)
+	if resp := authenticate(20); !resp.Success || resp.MaxForwards != 0 {
+		t.Errorf("20 forwards without a limit: %+v, want success", resp)
+	}
+}
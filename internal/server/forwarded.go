@@ -0,0 +1,85 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// authSessionCookies are digit-link's own session cookies. They are not forwarded, so
+// a local service never sees a session it could replay (SSO cookies reach every tunnel).
+var authSessionCookies = map[string]bool{
+	auth.OIDCSessionCookie:      true,
+	auth.BasicAuthSessionCookie: true,
+}
+
+// forwardedHeaders builds the headers sent to the tunnel client: the visitor's headers
+// plus X-Forwarded-Host, X-Forwarded-Proto and X-Forwarded-For. Host is included when
+// the app's Host header mode preserves it or sets a custom value; otherwise the
+// client uses the local address. Transfer-Encoding is included for chunked requests to
+// apps that forward chunked, so the client sends the body chunked instead of with a
+// Content-Length. Apps in streaming mode ask for an uncompressed response, as
+// compressing makes a local service buffer what it would otherwise flush.
+func (s *Server) forwardedHeaders(r *http.Request, app *db.Application) map[string]string {
+	hostHeader := s.hostHeader(app)
+	headers := buildForwardedHeaders(r, s.scheme, hostHeader.Mode == db.HostHeaderPreserve)
+	if hostHeader.Mode == db.HostHeaderCustom {
+		headers["Host"] = hostHeader.Value
+	}
+	if app != nil && app.ForwardChunked && isChunkedRequest(r) {
+		headers["Transfer-Encoding"] = "chunked"
+	}
+	if app != nil && app.StreamingMode {
+		headers["Accept-Encoding"] = "identity"
+	}
+	return headers
+}
+
+// buildForwardedHeaders flattens the request headers and adds the X-Forwarded-* headers
+func buildForwardedHeaders(r *http.Request, scheme string, preserveHost bool) map[string]string {
+	headers := make(map[string]string, len(r.Header)+4)
+	for key, values := range r.Header {
+		headers[key] = values[0]
+	}
+	if cookies := stripAuthSessionCookies(r.Header.Values("Cookie")); cookies != "" {
+		headers["Cookie"] = cookies
+	} else {
+		delete(headers, "Cookie")
+	}
+
+	headers["X-Forwarded-Host"] = r.Host
+	headers["X-Forwarded-Proto"] = scheme
+
+	// Append the peer to any existing chain rather than replacing it
+	peer := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		peer = host
+	}
+	if prior := r.Header.Values("X-Forwarded-For"); len(prior) > 0 {
+		peer = strings.Join(prior, ", ") + ", " + peer
+	}
+	headers["X-Forwarded-For"] = peer
+
+	if preserveHost {
+		headers["Host"] = r.Host
+	}
+	return headers
+}
+
+// stripAuthSessionCookies joins the Cookie header lines without digit-link's session cookies
+func stripAuthSessionCookies(lines []string) string {
+	var kept []string
+	for _, line := range lines {
+		for _, pair := range strings.Split(line, ";") {
+			pair = strings.TrimSpace(pair)
+			name, _, _ := strings.Cut(pair, "=")
+			if pair != "" && !authSessionCookies[name] {
+				kept = append(kept, pair)
+			}
+		}
+	}
+	return strings.Join(kept, "; ")
+}
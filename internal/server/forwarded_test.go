@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/niekvdm/digit-link/internal/protocol"
+)
+
+func TestForwardedHeadersReachBackend(t *testing.T) {
+	var got *http.Request
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	}))
+	defer backend.Close()
+
+	proxy := newTestProxy(t, backend.URL)
+	backendHost := backend.Listener.Addr().String()
+
+	for _, preserveHost := range []bool{false, true} {
+		t.Run(fmt.Sprintf("preserveHost=%v", preserveHost), func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/path", nil)
+			r.Host = "myapp.link.digit.zone"
+			r.RemoteAddr = "198.51.100.7:54321"
+			r.Header.Add("X-Forwarded-For", "203.0.113.1")
+			r.Header.Add("X-Forwarded-For", "203.0.113.2")
+
+			headers := buildForwardedHeaders(r, "https", preserveHost)
+			if _, err := proxy.Forward(context.Background(), &protocol.HTTPRequest{ID: "req", Method: http.MethodGet, Path: "/path", Headers: headers}); err != nil {
+				t.Fatalf("Forward() error: %v", err)
+			}
+
+			wantHost := backendHost
+			if preserveHost {
+				wantHost = "myapp.link.digit.zone"
+			}
+			if got.Host != wantHost {
+				t.Errorf("Host = %q, want %q", got.Host, wantHost)
+			}
+			for key, want := range map[string]string{
+				"X-Forwarded-Host":  "myapp.link.digit.zone",
+				"X-Forwarded-Proto": "https",
+				"X-Forwarded-For":   "203.0.113.1, 203.0.113.2, 198.51.100.7",
+			} {
+				if v := got.Header.Get(key); v != want {
+					t.Errorf("%s = %q, want %q", key, v, want)
+				}
+			}
+		})
+	}
+}
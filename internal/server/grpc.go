@@ -0,0 +1,29 @@
+package server
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// isGRPCRequest reports whether a visitor request is a gRPC call over HTTP/2.
+// gRPC-Web carries its status in the body over HTTP/1, so it is forwarded like
+// any other request.
+func isGRPCRequest(r *http.Request) bool {
+	if r.ProtoMajor != 2 {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/grpc" || strings.HasPrefix(mediaType, "application/grpc+")
+}
+
+// serverProtocols are the protocols the server speaks to visitors. gRPC needs
+// HTTP/2, which arrives unencrypted (prior knowledge) when an ingress in front
+// of the server ends TLS. HTTP/1 clients are not affected.
+func serverProtocols() *http.Protocols {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+	return protocols
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestGRPCViaTCP(t *testing.T) {
+	// A sample gRPC server: messages are length-prefixed, the status is in the trailers
+	writeMessage := func(w io.Writer, msg string) {
+		prefix := []byte{0, 0, 0, 0, byte(len(msg))}
+		w.Write(append(prefix, msg...))
+	}
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || r.Header.Get("Te") != "trailers" {
+			http.Error(w, "gRPC needs HTTP/2", http.StatusHTTPVersionNotSupported)
+			return
+		}
+		req, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		switch r.URL.Path {
+		case "/echo.Echo/Unary":
+			writeMessage(w, string(req[5:]))
+		case "/echo.Echo/ServerStream":
+			for i := 1; i <= 3; i++ {
+				writeMessage(w, fmt.Sprintf("%s-%d", req[5:], i))
+				w.(http.Flusher).Flush()
+			}
+		default:
+			w.Header().Set(http.TrailerPrefix+"Grpc-Status", "12")
+			w.Header().Set(http.TrailerPrefix+"Grpc-Message", "unknown method")
+			return
+		}
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	}))
+	backend.Config.Protocols = new(http.Protocols)
+	backend.Config.Protocols.SetUnencryptedHTTP2(true)
+	backend.Start()
+	defer backend.Close()
+
+	serverSession := newTestTCPSession(t, backend.URL)
+
+	database := newTestDB(t)
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	enabled := true
+	if err := database.SetOrgFeatureFlags(org.ID, map[string]*bool{db.FeatureGRPC: &enabled}); err != nil {
+		t.Fatalf("SetOrgFeatureFlags() error: %v", err)
+	}
+	serverSession.SetAccountInfo("", org.ID, "")
+
+	s := newTestServer(database)
+	visitor := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.forwardRequestViaTCP(w, r, serverSession, "grpc", nil)
+	}))
+	visitor.Config.Protocols = serverProtocols()
+	visitor.Start()
+	defer visitor.Close()
+
+	h2c := &http.Transport{Protocols: new(http.Protocols)}
+	h2c.Protocols.SetUnencryptedHTTP2(true)
+	caller := &http.Client{Transport: h2c}
+
+	call := func(method, msg string) ([]string, http.Header) {
+		t.Helper()
+		var body bytes.Buffer
+		writeMessage(&body, msg)
+		req, _ := http.NewRequest(http.MethodPost, visitor.URL+"/echo.Echo/"+method, &body)
+		req.Header.Set("Content-Type", "application/grpc")
+		req.Header.Set("Te", "trailers")
+		resp, err := caller.Do(req)
+		if err != nil {
+			t.Fatalf("%s call error: %v", method, err)
+		}
+		defer resp.Body.Close()
+		if resp.ProtoMajor != 2 || resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s call: %s %d, want HTTP/2 200", method, resp.Proto, resp.StatusCode)
+		}
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("%s call body error: %v", method, err)
+		}
+		var msgs []string
+		for len(data) >= 5 {
+			n := int(data[4])
+			msgs = append(msgs, string(data[5:5+n]))
+			data = data[5+n:]
+		}
+		return msgs, resp.Trailer
+	}
+
+	if msgs, trailer := call("Unary", "ping"); !reflect.DeepEqual(msgs, []string{"ping"}) || trailer.Get("Grpc-Status") != "0" {
+		t.Errorf("unary call = %q with status %q, want [ping] with 0", msgs, trailer.Get("Grpc-Status"))
+	}
+	if msgs, trailer := call("ServerStream", "tick"); !reflect.DeepEqual(msgs, []string{"tick-1", "tick-2", "tick-3"}) || trailer.Get("Grpc-Status") != "0" {
+		t.Errorf("server-streaming call = %q with status %q, want 3 ticks with 0", msgs, trailer.Get("Grpc-Status"))
+	}
+	if msgs, trailer := call("Missing", "x"); len(msgs) != 0 || trailer.Get("Grpc-Status") != "12" || trailer.Get("Grpc-Message") != "unknown method" {
+		t.Errorf("unknown method = %q with status %q (%q), want none with 12", msgs, trailer.Get("Grpc-Status"), trailer.Get("Grpc-Message"))
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+const (
+	// defaultMaxHeaderBytes is the default limit on the total size of request and response headers
+	defaultMaxHeaderBytes = 64 * 1024
+	// maxAppHeaderBytes is the largest per-app header limit (the HTTP server rejects anything above it anyway)
+	maxAppHeaderBytes = http.DefaultMaxHeaderBytes
+	// minAppHeaderBytes is the smallest per-app header limit, so an app cannot lock out ordinary browsers
+	minAppHeaderBytes = 4 * 1024
+)
+
+// GetTunnelMaxHeaderBytes returns the default header size limit for tunnels from environment or default
+func GetTunnelMaxHeaderBytes() int {
+	if limit := os.Getenv("TUNNEL_MAX_HEADER_BYTES"); limit != "" {
+		var n int
+		fmt.Sscanf(limit, "%d", &n)
+		if n > 0 {
+			return n
+		}
+	}
+	return defaultMaxHeaderBytes
+}
+
+// validateAppMaxHeaderBytes checks a per-app header limit (0 = server default)
+func validateAppMaxHeaderBytes(n int) error {
+	if n != 0 && (n < minAppHeaderBytes || n > maxAppHeaderBytes) {
+		return fmt.Errorf("maxHeaderBytes must be 0 (server default) or between %d and %d", minAppHeaderBytes, maxAppHeaderBytes)
+	}
+	return nil
+}
+
+// maxHeaderBytesFor returns the header size limit of an app: its override or the server default
+func (s *Server) maxHeaderBytesFor(app *db.Application) int {
+	if app != nil && app.MaxHeaderBytes > 0 {
+		return app.MaxHeaderBytes
+	}
+	if s.maxHeaderBytes > 0 {
+		return s.maxHeaderBytes
+	}
+	return defaultMaxHeaderBytes
+}
+
+// requestHeaderBytes returns the size of a request's headers as sent on the wire
+func requestHeaderBytes(r *http.Request) int {
+	n := len("Host: \r\n") + len(r.Host)
+	for key, values := range r.Header {
+		for _, value := range values {
+			n += len(key) + len(": \r\n") + len(value)
+		}
+	}
+	return n
+}
+
+// responseHeaderBytes returns the size of the response headers relayed from the tunnel client
+func responseHeaderBytes(headers map[string]string) int {
+	n := 0
+	for key, value := range headers {
+		n += len(key) + len(": \r\n") + len(value)
+	}
+	return n
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestForwardRequestHeaderLimit(t *testing.T) {
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	app, err := database.CreateApplication(org.ID, "myapp", "My App")
+	if err != nil {
+		t.Fatalf("CreateApplication() error: %v", err)
+	}
+	if err := database.UpdateApplicationMaxHeaderBytes(app.ID, 8*1024); err != nil {
+		t.Fatalf("UpdateApplicationMaxHeaderBytes() error: %v", err)
+	}
+
+	s := newTestServer(database)
+	s.maxHeaderBytes = 32 * 1024
+	if got := s.maxHeaderBytesFor(s.authMiddleware.appForSubdomain("myapp")); got != 8*1024 {
+		t.Errorf("maxHeaderBytesFor(myapp) = %d, want app override %d", got, 8*1024)
+	}
+	if got := s.maxHeaderBytesFor(s.authMiddleware.appForSubdomain("other")); got != 32*1024 {
+		t.Errorf("maxHeaderBytesFor(other) = %d, want server default %d", got, 32*1024)
+	}
+
+	// The oversized request is rejected before anything is sent to the tunnel
+	tun := NewTunnel("myapp", nil)
+	tun.OrgID = org.ID
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Host = "myapp.link.digit.zone"
+	r.Header.Set("Accept", "application/json")
+	r.Header.Set("Cookie", strings.Repeat("a", 10*1024))
+	w := httptest.NewRecorder()
+	s.forwardRequest(w, r, tun, s.authMiddleware.appForSubdomain(tun.Subdomain))
+
+	if w.Code != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusRequestHeaderFieldsTooLarge)
+	}
+	if code := w.Header().Get(errorCodeHeader); code != errCodeHeadersTooLarge {
+		t.Errorf("%s = %q, want %q", errorCodeHeader, code, errCodeHeadersTooLarge)
+	}
+
+	if err := validateAppMaxHeaderBytes(100); err == nil {
+		t.Error("validateAppMaxHeaderBytes(100) = nil, want error")
+	}
+	if err := validateAppMaxHeaderBytes(0); err != nil {
+		t.Errorf("validateAppMaxHeaderBytes(0) = %v, want nil", err)
+	}
+}
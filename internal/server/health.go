@@ -17,7 +17,22 @@ type HealthResponse struct {
 
 // ReadyResponse represents the response from the /ready endpoint
 type ReadyResponse struct {
-	Status string `json:"status"`
+	Status   string `json:"status"`
+	AuthMode string `json:"authMode"` // authModeFailClosed or authModeFailOpen
+}
+
+// Auth modes reported by the health endpoints
+const (
+	authModeFailClosed = "fail-closed"
+	authModeFailOpen   = "fail-open"
+)
+
+// authMode returns the server's auth mode for the health endpoints
+func (s *Server) authMode() string {
+	if s.authFailOpen {
+		return authModeFailOpen
+	}
+	return authModeFailClosed
 }
 
 // LiveResponse represents the response from the /live endpoint
@@ -56,6 +71,7 @@ func (s *Server) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
 	} else {
 		checks["database"] = "connected"
 	}
+	checks["authMode"] = s.authMode()
 
 	response := HealthResponse{
 		Checks: checks,
@@ -87,7 +103,7 @@ func (s *Server) handleReadyCheck(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Readiness check: database unavailable: %v", err)
 	}
 
-	response := ReadyResponse{}
+	response := ReadyResponse{AuthMode: s.authMode()}
 
 	if ready {
 		response.Status = "ready"
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestClientVersions(t *testing.T) {
+	for _, raw := range []string{`{"latest":"latest"}`, `{"latest":"v1.2.0","minimum":"v1.3.0"}`} {
+		if _, err := serverSettings[db.SettingClientVersions].parse(json.RawMessage(raw)); err == nil {
+			t.Errorf("client_versions %s accepted, want rejected", raw)
+		}
+	}
+
+	database := newTestDB(t)
+	s := newTestServer(database)
+
+	health := func() PublicHealthResponse {
+		w := httptest.NewRecorder()
+		s.handlePublicHealth(w, httptest.NewRequest(http.MethodGet, "/api/health", nil))
+		var resp PublicHealthResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid health response: %v", err)
+		}
+		return resp
+	}
+	if resp := health(); resp.LatestClientVersion != "" || resp.MinClientVersion != "" {
+		t.Errorf("health advertises %q/%q without the setting", resp.LatestClientVersion, resp.MinClientVersion)
+	}
+
+	r := httptest.NewRequest(http.MethodPut, "/admin/settings/"+db.SettingClientVersions, strings.NewReader(`{"latest":"v1.5.0","minimum":"v1.2.0"}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.handleUpdateSetting(w, r, db.SettingClientVersions, "root")
+	if w.Code != http.StatusOK {
+		t.Fatalf("update setting status = %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+	if resp := health(); resp.LatestClientVersion != "v1.5.0" || resp.MinClientVersion != "v1.2.0" {
+		t.Errorf("health advertises %q/%q, want v1.5.0/v1.2.0", resp.LatestClientVersion, resp.MinClientVersion)
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// maxHostHeaderLength bounds a custom Host header (a DNS name plus a port)
+const maxHostHeaderLength = 261
+
+// validateHostHeader checks an application's Host header setting. An empty mode
+// inherits the server's setting; a custom mode needs a host, optionally with a
+// port, and other modes take no value.
+func validateHostHeader(hostHeader db.HostHeaderConfig) error {
+	switch hostHeader.Mode {
+	case "", db.HostHeaderPreserve, db.HostHeaderLocal:
+		if hostHeader.Value != "" {
+			return fmt.Errorf("hostHeader.value is only used with mode %q", db.HostHeaderCustom)
+		}
+		return nil
+	case db.HostHeaderCustom:
+		if !validHostHeaderValue(hostHeader.Value) {
+			return fmt.Errorf("hostHeader.value must be a host like myapp.local or localhost:8080")
+		}
+		return nil
+	}
+	return fmt.Errorf("hostHeader.mode must be %q, %q or %q", db.HostHeaderPreserve, db.HostHeaderLocal, db.HostHeaderCustom)
+}
+
+// validHostHeaderValue reports whether value is a bare host with an optional port,
+// safe to write into a request the client builds by hand
+func validHostHeaderValue(value string) bool {
+	if value == "" || len(value) > maxHostHeaderLength {
+		return false
+	}
+	for _, c := range value {
+		if c <= ' ' || c == 0x7f {
+			return false
+		}
+	}
+	if strings.ContainsAny(value, "/\\@?#") {
+		return false
+	}
+	u, err := url.Parse("http://" + value)
+	return err == nil && u.Host == value && u.Hostname() != ""
+}
+
+// hostHeader returns the Host header setting for an application: its own, with
+// preserveHost as the preserve mode, or the server's host_header setting when the
+// application doesn't choose one
+func (s *Server) hostHeader(app *db.Application) db.HostHeaderConfig {
+	if app != nil {
+		if app.HostHeader.Mode != "" {
+			return app.HostHeader
+		}
+		if app.PreserveHost {
+			return db.HostHeaderConfig{Mode: db.HostHeaderPreserve}
+		}
+	}
+	return *s.settingValue(db.SettingHostHeader).(*db.HostHeaderConfig)
+}
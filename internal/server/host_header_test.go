@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/niekvdm/digit-link/internal/db"
+	"github.com/niekvdm/digit-link/internal/protocol"
+)
+
+func TestHostHeaderModes(t *testing.T) {
+	var got *http.Request
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	}))
+	defer backend.Close()
+
+	proxy := newTestProxy(t, backend.URL)
+	backendHost := backend.Listener.Addr().String()
+
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	for subdomain, hostHeader := range map[string]db.HostHeaderConfig{
+		"inherit":  {},
+		"preserve": {Mode: db.HostHeaderPreserve},
+		"local":    {Mode: db.HostHeaderLocal},
+		"custom":   {Mode: db.HostHeaderCustom, Value: "myapp.local:3000"},
+		"legacy":   {},
+	} {
+		app, err := database.CreateApplication(org.ID, subdomain, subdomain)
+		if err != nil {
+			t.Fatalf("CreateApplication() error: %v", err)
+		}
+		if err := database.UpdateApplicationHostHeader(app.ID, hostHeader); err != nil {
+			t.Fatalf("UpdateApplicationHostHeader() error: %v", err)
+		}
+		if subdomain == "legacy" {
+			database.UpdateApplicationPreserveHost(app.ID, true)
+		}
+	}
+
+	s := newTestServer(database)
+	s.scheme = "https"
+	hostFor := func(subdomain string) string {
+		r := httptest.NewRequest(http.MethodGet, "/path", nil)
+		r.Host = subdomain + ".link.digit.zone"
+		headers := s.forwardedHeaders(r, s.authMiddleware.appForSubdomain(subdomain))
+		if _, err := proxy.Forward(context.Background(), &protocol.HTTPRequest{ID: "req", Method: http.MethodGet, Path: "/path", Headers: headers}); err != nil {
+			t.Fatalf("Forward() error: %v", err)
+		}
+		return got.Host
+	}
+
+	for subdomain, want := range map[string]string{
+		"inherit":  backendHost,
+		"preserve": "preserve.link.digit.zone",
+		"local":    backendHost,
+		"custom":   "myapp.local:3000",
+		"legacy":   "legacy.link.digit.zone",
+	} {
+		if host := hostFor(subdomain); host != want {
+			t.Errorf("%s: backend Host = %q, want %q", subdomain, host, want)
+		}
+	}
+
+	// Applications without a mode follow the server's host_header setting
+	r := httptest.NewRequest(http.MethodPut, "/admin/settings/"+db.SettingHostHeader, strings.NewReader(`{"mode":"custom","value":"shared.internal"}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.handleUpdateSetting(w, r, db.SettingHostHeader, "root")
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT host_header = %d: %s", w.Code, w.Body.String())
+	}
+	if host := hostFor("inherit"); host != "shared.internal" {
+		t.Errorf("inherit: backend Host = %q, want the server setting", host)
+	}
+	if host := hostFor("local"); host != backendHost {
+		t.Errorf("local: backend Host = %q, want the application's mode to win", host)
+	}
+
+	for _, hostHeader := range []db.HostHeaderConfig{
+		{Mode: db.HostHeaderCustom},
+		{Mode: db.HostHeaderCustom, Value: "evil.test\r\nX-Injected: 1"},
+		{Mode: db.HostHeaderCustom, Value: "user@evil.test"},
+		{Mode: db.HostHeaderCustom, Value: "evil.test/path"},
+		{Mode: db.HostHeaderLocal, Value: "myapp.local"},
+		{Mode: "rewrite"},
+	} {
+		if err := validateHostHeader(hostHeader); err == nil {
+			t.Errorf("validateHostHeader(%+v) = nil, want an error", hostHeader)
+		}
+	}
+	for _, body := range []string{`{}`, `{"mode":"custom"}`} {
+		r := httptest.NewRequest(http.MethodPut, "/admin/settings/"+db.SettingHostHeader, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.handleUpdateSetting(w, r, db.SettingHostHeader, "root")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("PUT host_header %s = %d, want 400", body, w.Code)
+		}
+	}
+}
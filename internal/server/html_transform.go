@@ -0,0 +1,158 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// maxHTMLTransformBytes bounds the HTML bodies the transform rewrites, before and
+// after decompression; larger responses pass through unchanged
+const maxHTMLTransformBytes = 2 << 20
+
+var (
+	htmlHeadTag = regexp.MustCompile(`(?i)<head(\s[^>]*)?>`)
+	htmlBaseTag = regexp.MustCompile(`(?i)<base[\s/>]`)
+)
+
+// validateHTMLBaseHref checks an application's injected <base href> (empty = off):
+// an absolute path or an http(s) URL
+func validateHTMLBaseHref(href string) error {
+	if href == "" {
+		return nil
+	}
+	if u, err := url.Parse(href); err == nil {
+		if strings.HasPrefix(href, "/") && !strings.HasPrefix(href, "//") {
+			return nil
+		}
+		if (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+			return nil
+		}
+	}
+	return fmt.Errorf("htmlBaseHref must be an absolute path like /app/ or an http(s) URL")
+}
+
+// validateHTMLRewriteOrigin checks an application's backend origin rewritten in
+// HTML responses (empty = off): an http(s) scheme and host without a path
+func validateHTMLRewriteOrigin(origin string) error {
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		(u.Path != "" && u.Path != "/") || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("htmlRewriteOrigin must be an origin like http://localhost:3000")
+	}
+	return nil
+}
+
+// applyHTMLTransform returns the body of a tunneled response with the app's HTML
+// transform applied, adjusting headers to the new body. Only text/html bodies up
+// to maxHTMLTransformBytes without a Content-Encoding or with gzip are
+// transformed; a gzip body is sent decompressed. Other responses, and pages the
+// transform does not change, are returned as they are. The transform is
+// experimental: it matches text rather than parsing the markup.
+func (s *Server) applyHTMLTransform(headers map[string]string, body []byte, r *http.Request, status int, app *db.Application) []byte {
+	if app == nil || (app.HTMLBaseHref == "" && app.HTMLRewriteOrigin == "") {
+		return body
+	}
+	if len(body) == 0 || len(body) > maxHTMLTransformBytes || r.Method == http.MethodHead || !bodyAllowedForStatus(status) {
+		return body
+	}
+	if mediaType, _, _ := mime.ParseMediaType(headers["Content-Type"]); mediaType != "text/html" {
+		return body
+	}
+
+	page := body
+	encoding := strings.ToLower(strings.TrimSpace(headers["Content-Encoding"]))
+	switch encoding {
+	case "", "identity":
+	case "gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return body
+		}
+		page, err = io.ReadAll(io.LimitReader(zr, maxHTMLTransformBytes+1))
+		if err != nil || len(page) > maxHTMLTransformBytes {
+			return body
+		}
+	default:
+		return body
+	}
+
+	publicURL := fmt.Sprintf("%s://%s.%s", s.scheme, app.Subdomain, s.domain)
+	transformed := transformHTML(page, app.HTMLBaseHref, strings.TrimSuffix(app.HTMLRewriteOrigin, "/"), publicURL)
+	if bytes.Equal(transformed, page) {
+		return body
+	}
+
+	delete(headers, "Content-Encoding")
+	if _, chunked := headers["Transfer-Encoding"]; !chunked {
+		headers["Content-Length"] = strconv.Itoa(len(transformed))
+	}
+	// The backend's strong validator no longer names the bytes sent
+	if etag := headers["Etag"]; etag != "" && !strings.HasPrefix(etag, "W/") {
+		headers["Etag"] = "W/" + etag
+	}
+	return transformed
+}
+
+// transformHTML rewrites absolute URLs on origin to publicURL and injects a
+// <base href> after the opening head tag, unless the page declares its own
+func transformHTML(page []byte, baseHref, origin, publicURL string) []byte {
+	if origin != "" {
+		page = replaceOrigin(page, origin, publicURL)
+	}
+	if baseHref != "" && !htmlBaseTag.Match(page) {
+		if loc := htmlHeadTag.FindIndex(page); loc != nil {
+			tag := `<base href="` + html.EscapeString(baseHref) + `">`
+			out := make([]byte, 0, len(page)+len(tag))
+			out = append(out, page[:loc[1]]...)
+			out = append(out, tag...)
+			page = append(out, page[loc[1]:]...)
+		}
+	}
+	return page
+}
+
+// replaceOrigin replaces origin with publicURL where it is not followed by more
+// of a host name or port, so http://localhost:3000 leaves http://localhost:30001 alone
+func replaceOrigin(page []byte, origin, publicURL string) []byte {
+	needle := []byte(origin)
+	if !bytes.Contains(page, needle) {
+		return page
+	}
+	var out bytes.Buffer
+	out.Grow(len(page))
+	for {
+		i := bytes.Index(page, needle)
+		if i < 0 {
+			break
+		}
+		end := i + len(needle)
+		out.Write(page[:i])
+		if end < len(page) && isHostByte(page[end]) {
+			out.Write(needle)
+		} else {
+			out.WriteString(publicURL)
+		}
+		page = page[end:]
+	}
+	out.Write(page)
+	return out.Bytes()
+}
+
+// isHostByte reports whether b can continue a host name or port
+func isHostByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b == '.' || b == '-' || b == ':' || b == '_'
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHTMLTransform(t *testing.T) {
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	if _, err := database.CreateApplication(org.ID, "plain", "plain"); err != nil {
+		t.Fatalf("CreateApplication() error: %v", err)
+	}
+	app, err := database.CreateApplication(org.ID, "wiki", "wiki")
+	if err != nil {
+		t.Fatalf("CreateApplication() error: %v", err)
+	}
+	database.UpdateApplicationHTMLBaseHref(app.ID, "/wiki/")
+	database.UpdateApplicationHTMLRewriteOrigin(app.ID, "http://localhost:3000/")
+
+	s := newTestServer(database)
+	s.scheme = "https"
+
+	page := `<html><head><title>x</title></head><body><a href="http://localhost:3000/docs">docs</a> <a href="http://localhost:30001/">other</a></body></html>`
+	want := `<html><head><base href="/wiki/"><title>x</title></head><body><a href="https://wiki.link.test/docs">docs</a> <a href="http://localhost:30001/">other</a></body></html>`
+	get := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	headers := map[string]string{"Content-Type": "text/html; charset=utf-8", "Content-Length": strconv.Itoa(len(page)), "Etag": `"v1"`}
+	if got := s.applyHTMLTransform(headers, []byte(page), get, http.StatusOK, s.authMiddleware.appForSubdomain("wiki")); string(got) != want {
+		t.Errorf("transformed page = %q, want %q", got, want)
+	}
+	if headers["Content-Length"] != strconv.Itoa(len(want)) || headers["Etag"] != `W/"v1"` {
+		t.Errorf("headers = %v, want updated Content-Length and weak ETag", headers)
+	}
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(page))
+	zw.Close()
+	headers = map[string]string{"Content-Type": "text/html", "Content-Encoding": "gzip"}
+	if got := s.applyHTMLTransform(headers, gz.Bytes(), get, http.StatusOK, s.authMiddleware.appForSubdomain("wiki")); string(got) != want || headers["Content-Encoding"] != "" {
+		t.Errorf("gzip page = %q with Content-Encoding %q, want it decompressed and transformed", got, headers["Content-Encoding"])
+	}
+
+	unchanged := []struct {
+		name      string
+		subdomain string
+		headers   map[string]string
+		body      string
+		method    string
+	}{
+		{"transform off", "plain", map[string]string{"Content-Type": "text/html"}, page, http.MethodGet},
+		{"not HTML", "wiki", map[string]string{"Content-Type": "application/json"}, page, http.MethodGet},
+		{"unsupported encoding", "wiki", map[string]string{"Content-Type": "text/html", "Content-Encoding": "br"}, page, http.MethodGet},
+		{"HEAD", "wiki", map[string]string{"Content-Type": "text/html"}, page, http.MethodHead},
+		{"page has a base", "wiki", map[string]string{"Content-Type": "text/html"}, `<head><base href="/"></head>`, http.MethodGet},
+		{"too large", "wiki", map[string]string{"Content-Type": "text/html"}, "<head>" + strings.Repeat("x", maxHTMLTransformBytes), http.MethodGet},
+	}
+	for _, tt := range unchanged {
+		t.Run(tt.name, func(t *testing.T) {
+			got := s.applyHTMLTransform(tt.headers, []byte(tt.body), httptest.NewRequest(tt.method, "/", nil), http.StatusOK, s.authMiddleware.appForSubdomain(tt.subdomain))
+			if string(got) != tt.body {
+				t.Errorf("body changed to %.80q", got)
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		baseHref, origin string
+		wantErr          bool
+	}{
+		{"/app/", "http://localhost:3000", false},
+		{"https://example.com/app/", "https://backend:8443/", false},
+		{"app/", "", true},
+		{"//evil.example/", "", true},
+		{"", "http://localhost:3000/path", true},
+		{"", "ftp://localhost", true},
+	} {
+		err := validateHTMLBaseHref(tt.baseHref)
+		if err == nil {
+			err = validateHTMLRewriteOrigin(tt.origin)
+		}
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validate(%q, %q) error = %v, want error: %v", tt.baseHref, tt.origin, err, tt.wantErr)
+		}
+	}
+}
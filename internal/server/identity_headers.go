@@ -0,0 +1,46 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/niekvdm/digit-link/internal/db"
+	"github.com/niekvdm/digit-link/internal/policy"
+)
+
+// validateIdentityHeaders checks an application's list of forwarded identity details
+func validateIdentityHeaders(names []string) error {
+	for _, name := range names {
+		if _, ok := db.IdentityHeaderNames[name]; !ok {
+			return fmt.Errorf("invalid identity header %q: must be one of user, email, method, groups", name)
+		}
+	}
+	return nil
+}
+
+// setIdentityHeaders tells the local service who the visitor is. Copies of the
+// identity headers sent by the visitor are always removed so they cannot be
+// spoofed; the app's selected headers are then set from the auth result.
+func setIdentityHeaders(r *http.Request, result *policy.AuthResult, authCtx *policy.AuthContext) {
+	for _, header := range db.IdentityHeaderNames {
+		r.Header.Del(header)
+	}
+	if result == nil || !result.Authenticated || result.Method == "" || authCtx == nil || authCtx.App == nil {
+		return
+	}
+
+	values := map[string]string{
+		"user":   result.UserIdentity,
+		"method": result.Method,
+		"groups": strings.Join(result.Groups, ","),
+	}
+	if result.Method == string(policy.AuthTypeOIDC) {
+		values["email"] = result.UserIdentity
+	}
+	for _, name := range authCtx.App.IdentityHeaders {
+		if value := values[name]; value != "" {
+			r.Header.Set(db.IdentityHeaderNames[name], value)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/policy"
+)
+
+func TestIdentityHeaders(t *testing.T) {
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	app, err := database.CreateApplication(org.ID, "api", "api")
+	if err != nil {
+		t.Fatalf("CreateApplication() error: %v", err)
+	}
+	if err := database.UpdateApplicationIdentityHeaders(app.ID, []string{"email", "method", "groups"}); err != nil {
+		t.Fatalf("UpdateApplicationIdentityHeaders() error: %v", err)
+	}
+	if app, err = database.GetApplicationBySubdomain("api"); err != nil {
+		t.Fatalf("GetApplicationBySubdomain() error: %v", err)
+	}
+	if !reflect.DeepEqual(app.IdentityHeaders, []string{"email", "method", "groups"}) {
+		t.Fatalf("IdentityHeaders = %v, want [email method groups]", app.IdentityHeaders)
+	}
+
+	session, err := database.CreateSession(&app.ID, &org.ID, "jane@acme.com", map[string]string{"groups": "admins,dev"}, time.Hour)
+	if err != nil {
+		t.Fatalf("CreateSession() error: %v", err)
+	}
+	result := policy.SuccessFromSession(session)
+	result.Method = string(policy.AuthTypeOIDC)
+	authCtx := &policy.AuthContext{Subdomain: "api", App: app}
+
+	spoofed := func() *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "http://api.link.digit.zone/", nil)
+		r.Header.Set("X-Auth-User", "mallory")
+		r.Header.Set("X-Auth-Email", "mallory@evil.com")
+		return r
+	}
+
+	r := spoofed()
+	setIdentityHeaders(r, result, authCtx)
+	want := map[string]string{
+		"X-Auth-User":   "", // Not selected by the app
+		"X-Auth-Email":  "jane@acme.com",
+		"X-Auth-Method": "oidc",
+		"X-Auth-Groups": "admins,dev",
+	}
+	for header, value := range want {
+		if got := r.Header.Get(header); got != value {
+			t.Errorf("%s = %q, want %q", header, got, value)
+		}
+	}
+
+	// Requests that did not pass an auth policy only lose the spoofed headers
+	r = spoofed()
+	setIdentityHeaders(r, policy.Success("no_auth_required"), authCtx)
+	for header := range want {
+		if got := r.Header.Get(header); got != "" {
+			t.Errorf("unauthenticated request %s = %q, want it removed", header, got)
+		}
+	}
+
+	if err := validateIdentityHeaders([]string{"user", "X-Auth-User"}); err == nil {
+		t.Error("validateIdentityHeaders() accepted a header name, want only user, email, method or groups")
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// inFlightCounter counts the forwarded requests each organization has in flight
+type inFlightCounter struct {
+	orgs sync.Map // map[string]*atomic.Int64
+}
+
+// newInFlightCounter creates an empty in-flight counter
+func newInFlightCounter() *inFlightCounter {
+	return &inFlightCounter{}
+}
+
+// counter returns the organization's counter, creating it on first use
+func (c *inFlightCounter) counter(orgID string) *atomic.Int64 {
+	if v, ok := c.orgs.Load(orgID); ok {
+		return v.(*atomic.Int64)
+	}
+	v, _ := c.orgs.LoadOrStore(orgID, new(atomic.Int64))
+	return v.(*atomic.Int64)
+}
+
+// acquire counts a request unless the organization already has limit requests
+// in flight (0 = unlimited)
+func (c *inFlightCounter) acquire(orgID string, limit int64) bool {
+	n := c.counter(orgID)
+	if n.Add(1) > limit && limit > 0 {
+		n.Add(-1)
+		return false
+	}
+	return true
+}
+
+// release ends a request counted by acquire
+func (c *inFlightCounter) release(orgID string) {
+	c.counter(orgID).Add(-1)
+}
+
+// current returns how many requests the organization has in flight
+func (c *inFlightCounter) current(orgID string) int64 {
+	if c == nil {
+		return 0
+	}
+	if v, ok := c.orgs.Load(orgID); ok {
+		return v.(*atomic.Int64).Load()
+	}
+	return 0
+}
+
+// beginInFlight counts a forwarded request toward its organization's requests in
+// flight. Over the plan's maxConcurrentRequests it responds with 503 and returns
+// false; otherwise the caller must call endInFlight once the request is done.
+func (s *Server) beginInFlight(w http.ResponseWriter, r *http.Request, orgID string) bool {
+	if s.inFlight == nil || orgID == "" {
+		return true
+	}
+	var limit int64
+	if s.quotaChecker != nil {
+		limit = int64(s.quotaChecker.MaxConcurrentRequests(orgID))
+	}
+	if !s.inFlight.acquire(orgID, limit) {
+		w.Header().Set("Retry-After", "1")
+		s.writeVisitorError(w, r, orgID, http.StatusServiceUnavailable, errCodeConcurrencyLimit, "Too many concurrent requests")
+		return false
+	}
+	return true
+}
+
+// endInFlight ends a request counted by beginInFlight
+func (s *Server) endInFlight(orgID string) {
+	if s.inFlight == nil || orgID == "" {
+		return
+	}
+	s.inFlight.release(orgID)
+}
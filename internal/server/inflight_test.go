@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestOrgConcurrentRequestLimit(t *testing.T) {
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	two := 2
+	plan, err := database.CreatePlan(db.CreatePlanInput{Name: "Small", MaxConcurrentRequests: &two})
+	if err != nil {
+		t.Fatalf("CreatePlan() error: %v", err)
+	}
+	if err := database.UpdateOrganizationPlan(org.ID, &plan.ID); err != nil {
+		t.Fatalf("UpdateOrganizationPlan() error: %v", err)
+	}
+	cache := NewUsageCache(database)
+	cache.UpdateOrgPlanID(org.ID, &plan.ID)
+	s := newTestServer(database)
+	s.usageCache = cache
+	s.quotaChecker = NewQuotaChecker(cache, database)
+	s.inFlight = newInFlightCounter()
+
+	begin := func(orgID string) (bool, *httptest.ResponseRecorder) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "http://app.link.test/", nil)
+		r.Header.Set("Accept", "application/json")
+		return s.beginInFlight(w, r, orgID), w
+	}
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := begin(org.ID); !ok {
+			t.Fatalf("request %d rejected, want it let through", i+1)
+		}
+	}
+	if ok, w := begin(org.ID); ok || w.Code != http.StatusServiceUnavailable || w.Header().Get(errorCodeHeader) != errCodeConcurrencyLimit || w.Header().Get("Retry-After") == "" {
+		t.Errorf("third request: status %d, code %q, want 503 %s with Retry-After", w.Code, w.Header().Get(errorCodeHeader), errCodeConcurrencyLimit)
+	}
+	if n := s.inFlight.current(org.ID); n != 2 {
+		t.Errorf("in flight = %d after a rejection, want 2", n)
+	}
+
+	s.endInFlight(org.ID)
+	if ok, _ := begin(org.ID); !ok {
+		t.Error("request after one finished rejected, want it let through")
+	}
+
+	// Organizations without a plan limit are not capped
+	for i := 0; i < 10; i++ {
+		if ok, _ := begin("other-org"); !ok {
+			t.Fatalf("unlimited request %d rejected", i+1)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleOrgStats(rec, httptest.NewRequest(http.MethodGet, "/org/stats", nil), &OrgContext{OrgID: org.ID})
+	var stats map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&stats)
+	if stats["inFlightRequests"] != float64(2) || stats["maxConcurrentRequests"] != float64(2) {
+		t.Errorf("stats = %v, want 2 of 2 requests in flight", stats)
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/niekvdm/digit-link/internal/db"
+	"github.com/niekvdm/digit-link/internal/protocol"
+	"github.com/niekvdm/digit-link/internal/tunnel"
+)
+
+// validateLocalTargetPolicy checks the networks and port ranges of a
+// local_target_policy setting
+func validateLocalTargetPolicy(policy *db.LocalTargetPolicy) error {
+	for _, cidr := range policy.AllowedNetworks {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("allowedNetworks: %q is not a CIDR like 127.0.0.0/8", cidr)
+		}
+	}
+	for _, ports := range policy.AllowedPorts {
+		if _, _, err := parsePortRange(ports); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parsePortRange parses a port ("3000") or an inclusive port range ("8000-8999")
+func parsePortRange(value string) (low, high int, err error) {
+	lowPart, highPart, isRange := strings.Cut(value, "-")
+	if !isRange {
+		highPart = lowPart
+	}
+	low, lowErr := strconv.Atoi(lowPart)
+	high, highErr := strconv.Atoi(highPart)
+	if lowErr != nil || highErr != nil || low < 1 || high > 65535 || low > high {
+		return 0, 0, fmt.Errorf("allowedPorts: %q is not a port or port range like 8000-8999", value)
+	}
+	return low, high, nil
+}
+
+// localTargetIPs returns the addresses a reported target address stands for.
+// Host names other than localhost resolve where the client runs, so they
+// match no network.
+func localTargetIPs(address string) []net.IP {
+	if strings.HasPrefix(address, "unix:") || strings.EqualFold(address, "localhost") {
+		return []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	}
+	if ip := net.ParseIP(strings.Trim(address, "[]")); ip != nil {
+		return []net.IP{ip}
+	}
+	return nil
+}
+
+// localTargetDenied returns why a policy rejects a local target, or "" when it
+// allows it. A nil target, or one without an address, was not reported by the
+// client; only its port is checked then.
+func localTargetDenied(policy *db.LocalTargetPolicy, target *protocol.LocalTarget) string {
+	if target == nil || target.Address == "" {
+		if policy.RequireReport {
+			return "Local target not reported; this server requires a client that reports where it forwards to"
+		}
+		if target == nil {
+			return ""
+		}
+	}
+
+	if target.Address != "" && len(policy.AllowedNetworks) > 0 {
+		allowed := false
+		for _, cidr := range policy.AllowedNetworks {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				continue
+			}
+			for _, ip := range localTargetIPs(target.Address) {
+				allowed = allowed || network.Contains(ip)
+			}
+		}
+		if !allowed {
+			return fmt.Sprintf("Local target %s is not allowed: the address is outside the allowed networks", target)
+		}
+	}
+
+	if target.Port != 0 && !strings.HasPrefix(target.Address, "unix:") && len(policy.AllowedPorts) > 0 {
+		allowed := false
+		for _, ports := range policy.AllowedPorts {
+			low, high, err := parsePortRange(ports)
+			allowed = allowed || (err == nil && target.Port >= low && target.Port <= high)
+		}
+		if !allowed {
+			return fmt.Sprintf("Local target %s is not allowed: port %d is not an allowed port", target, target.Port)
+		}
+	}
+	return ""
+}
+
+// checkLocalTarget returns why the local_target_policy setting rejects a
+// target, or "" when it allows it
+func (s *Server) checkLocalTarget(target *protocol.LocalTarget) string {
+	return localTargetDenied(s.settingValue(db.SettingLocalTargetPolicy).(*db.LocalTargetPolicy), target)
+}
+
+// forwardLocalTargets returns the local targets of a TCP forward: its own and
+// those of its path routes
+func forwardLocalTargets(fwd tunnel.ForwardConfig) []*protocol.LocalTarget {
+	targets := []*protocol.LocalTarget{{Address: fwd.LocalAddr, Port: fwd.LocalPort, HTTPS: fwd.LocalHTTPS}}
+	for _, route := range fwd.Routes {
+		targets = append(targets, &protocol.LocalTarget{Address: fwd.LocalAddr, Port: route.LocalPort, HTTPS: route.LocalHTTPS})
+	}
+	return targets
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+	"github.com/niekvdm/digit-link/internal/protocol"
+)
+
+func TestLocalTargetPolicy(t *testing.T) {
+	policy := &db.LocalTargetPolicy{AllowedNetworks: []string{"127.0.0.0/8", "10.1.0.0/16"}, AllowedPorts: []string{"3000", "8000-8999"}}
+	for _, tt := range []struct {
+		target  *protocol.LocalTarget
+		allowed bool
+	}{
+		{nil, true},
+		{&protocol.LocalTarget{Address: "localhost", Port: 3000}, true},
+		{&protocol.LocalTarget{Address: "10.1.2.3", Port: 8443, HTTPS: true}, true},
+		{&protocol.LocalTarget{Address: "unix:/run/app.sock"}, true},
+		{&protocol.LocalTarget{Address: "", Port: 8080}, true},
+		{&protocol.LocalTarget{Address: "", Port: 22}, false},
+		{&protocol.LocalTarget{Address: "10.2.0.1", Port: 3000}, false},
+		{&protocol.LocalTarget{Address: "db.internal", Port: 3000}, false},
+		{&protocol.LocalTarget{Address: "127.0.0.1", Port: 22}, false},
+	} {
+		if msg := localTargetDenied(policy, tt.target); (msg == "") != tt.allowed {
+			t.Errorf("localTargetDenied(%+v) = %q, want allowed %v", tt.target, msg, tt.allowed)
+		}
+	}
+	if msg := localTargetDenied(&db.LocalTargetPolicy{RequireReport: true}, nil); msg == "" {
+		t.Error("unreported target allowed while the policy requires a report")
+	}
+
+	for _, raw := range []string{`{"allowedNetworks":["10.0.0.1"]}`, `{"allowedPorts":["9000-8000"]}`, `{"allowedPorts":["0"]}`} {
+		if _, err := serverSettings[db.SettingLocalTargetPolicy].parse(json.RawMessage(raw)); err == nil {
+			t.Errorf("local_target_policy %s accepted, want rejected", raw)
+		}
+	}
+
+	database := newTestDB(t)
+	org, _ := database.CreateOrganization("acme")
+	database.AddOrgWhitelist(org.ID, "127.0.0.1", "test client", "")
+	raw := "alice-token"
+	if _, err := database.CreateOrgAccount("alice", auth.HashToken(raw), "", org.ID); err != nil {
+		t.Fatalf("CreateOrgAccount() error: %v", err)
+	}
+	if _, err := database.SetSetting(db.SettingLocalTargetPolicy, json.RawMessage(`{"allowedNetworks":["127.0.0.0/8"],"allowedPorts":["3000"]}`)); err != nil {
+		t.Fatalf("SetSetting() error: %v", err)
+	}
+
+	s := newTestServer(database)
+	ts := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer ts.Close()
+
+	register := func(req protocol.RegisterRequest) (*websocket.Conn, protocol.RegisterResponse) {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/_tunnel", nil)
+		if err != nil {
+			t.Fatalf("Dial() error: %v", err)
+		}
+		reg, _ := json.Marshal(protocol.Message{Type: protocol.TypeRegisterRequest, Payload: req})
+		conn.WriteMessage(websocket.TextMessage, reg)
+		var regResp struct {
+			Payload protocol.RegisterResponse `json:"payload"`
+		}
+		if err := conn.ReadJSON(&regResp); err != nil {
+			t.Fatalf("reading registration response: %v", err)
+		}
+		return conn, regResp.Payload
+	}
+
+	conn, resp := register(protocol.RegisterRequest{Token: raw, Subdomain: "blocked", LocalTarget: &protocol.LocalTarget{Address: "localhost", Port: 22}})
+	conn.Close()
+	if resp.Success || resp.Code != protocol.RegisterCodeLocalTarget {
+		t.Errorf("registration to a disallowed port = %+v, want code %s", resp, protocol.RegisterCodeLocalTarget)
+	}
+
+	// Clients that don't report their target still connect
+	legacy, resp := register(protocol.RegisterRequest{Token: raw, Subdomain: "legacy"})
+	defer legacy.Close()
+	if !resp.Success {
+		t.Errorf("registration without a local target = %+v, want success", resp)
+	}
+
+	conn, resp = register(protocol.RegisterRequest{Token: raw, Subdomain: "web", LocalTarget: &protocol.LocalTarget{Address: "localhost", Port: 3000}})
+	defer conn.Close()
+	if !resp.Success {
+		t.Fatalf("registration to an allowed target = %+v, want success", resp)
+	}
+	records, err := database.ListActiveTunnels()
+	if err != nil {
+		t.Fatalf("ListActiveTunnels() error: %v", err)
+	}
+	targets := make(map[string]string)
+	for _, record := range records {
+		targets[record.Subdomain] = record.LocalTarget
+	}
+	if want := map[string]string{"legacy": "", "web": "http://localhost:3000"}; !reflect.DeepEqual(targets, want) {
+		t.Errorf("recorded local targets = %v, want %v", targets, want)
+	}
+}
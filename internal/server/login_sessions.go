@@ -0,0 +1,83 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// errLoginSessionLimit rejects a login of an account that already has as many
+// sessions as its organization allows
+var errLoginSessionLimit = errors.New("too many active sessions")
+
+// loginSessionLimitMessage is shown to members whose login was rejected by the session limit
+const loginSessionLimitMessage = "Too many active sessions. Log out elsewhere or ask an org admin to revoke your sessions."
+
+// validateLoginSessionLimit checks an organization's login session limit
+func validateLoginSessionLimit(limit db.OrgLoginSessionLimit) error {
+	if limit.Max < 0 {
+		return fmt.Errorf("loginSessionLimit.max cannot be negative")
+	}
+	switch limit.OnExceed {
+	case "", db.LoginSessionRevokeOldest, db.LoginSessionReject:
+		return nil
+	}
+	return fmt.Errorf("loginSessionLimit.onExceed must be %q or %q", db.LoginSessionRevokeOldest, db.LoginSessionReject)
+}
+
+// startLoginSession records a login of an org member whose organization limits
+// concurrent sessions and returns its ID for the session JWT. At the limit the
+// member's oldest sessions are revoked, each audited and published as an event,
+// or the login is rejected with errLoginSessionLimit, as the org configured.
+// Logins that are not limited are not tracked and get an empty ID.
+func (s *Server) startLoginSession(account *db.Account, r *http.Request, expiresAt time.Time) (string, error) {
+	if s.db == nil || account.OrgID == "" {
+		return "", nil
+	}
+	org, err := s.db.GetOrganizationByID(account.OrgID)
+	if err != nil || org == nil || org.LoginSessionLimit.Max <= 0 {
+		return "", err
+	}
+	limit := org.LoginSessionLimit
+
+	session, evicted, err := s.db.CreateLimitedLoginSession(account.ID, expiresAt, limit.Max, limit.OnExceed != db.LoginSessionReject)
+	if err != nil {
+		return "", err
+	}
+	if session == nil {
+		return "", errLoginSessionLimit
+	}
+
+	if len(evicted) > 0 {
+		clientIP := auth.GetClientIP(r)
+		for _, old := range evicted {
+			reason := fmt.Sprintf("Session from %s ended by a new login: at most %d sessions allowed", old.CreatedAt.Format(time.RFC3339), limit.Max)
+			if err := s.db.LogAuthEvent(&db.AuditEvent{
+				OrgID:         &account.OrgID,
+				AuthType:      db.AuditTypeSessionEvicted,
+				Success:       true,
+				FailureReason: reason,
+				SourceIP:      clientIP,
+				UserIdentity:  account.Username,
+				KeyID:         old.ID,
+			}); err != nil {
+				log.Printf("Failed to audit session eviction: %v", err)
+			}
+			s.publishEvent(Event{
+				Type:      EventAccountSessionEvicted,
+				OrgID:     account.OrgID,
+				AccountID: account.ID,
+				ClientIP:  clientIP,
+				Reason:    reason,
+			})
+		}
+		log.Printf("Login of %s ended %d older sessions (limit %d)", account.Username, len(evicted), limit.Max)
+	}
+
+	return session.ID, nil
+}
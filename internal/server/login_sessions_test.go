@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestLoginSessionLimit(t *testing.T) {
+	t.Setenv("BCRYPT_COST", "10")
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	hash, err := auth.HashPassword("correct-horse")
+	if err != nil {
+		t.Fatalf("HashPassword() error: %v", err)
+	}
+	if _, err := database.CreateOrgAccount("bob", auth.HashToken("token"), hash, org.ID); err != nil {
+		t.Fatalf("CreateOrgAccount() error: %v", err)
+	}
+	if err := database.UpdateOrganizationLoginSessionLimit(org.ID, db.OrgLoginSessionLimit{Max: 2}); err != nil {
+		t.Fatalf("UpdateOrganizationLoginSessionLimit() error: %v", err)
+	}
+
+	s := newTestServer(database)
+	login := func() (int, string) {
+		r := httptest.NewRequest(http.MethodPost, "/auth/org/login", strings.NewReader(`{"username":"bob","password":"correct-horse"}`))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.handleAuth(w, r)
+		var resp OrgLoginResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp.Token
+	}
+	valid := func(token string) bool {
+		r := httptest.NewRequest(http.MethodGet, "/org/me", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		orgCtx, err := s.authenticateOrgAccount(r)
+		return err == nil && orgCtx != nil
+	}
+
+	var tokens []string
+	for i := 0; i < 3; i++ {
+		status, token := login()
+		if status != http.StatusOK || token == "" {
+			t.Fatalf("login %d = %d, want a session", i+1, status)
+		}
+		tokens = append(tokens, token)
+	}
+
+	// The third login revoked the oldest session
+	if valid(tokens[0]) {
+		t.Error("oldest session still valid after exceeding the limit")
+	}
+	if !valid(tokens[1]) || !valid(tokens[2]) {
+		t.Error("newest sessions not valid")
+	}
+	audit, _ := database.GetAuditEvents(&org.ID, nil, 10, 0)
+	var evicted int
+	for _, event := range audit {
+		if event.AuthType == db.AuditTypeSessionEvicted && event.UserIdentity == "bob" {
+			evicted++
+			if !strings.Contains(event.FailureReason, "at most 2 sessions") {
+				t.Errorf("eviction failureReason = %q, want the limit", event.FailureReason)
+			}
+		}
+	}
+	if evicted != 1 {
+		t.Errorf("audited %d evictions, want 1", evicted)
+	}
+
+	// Rejecting keeps the existing sessions
+	if err := database.UpdateOrganizationLoginSessionLimit(org.ID, db.OrgLoginSessionLimit{Max: 2, OnExceed: db.LoginSessionReject}); err != nil {
+		t.Fatalf("UpdateOrganizationLoginSessionLimit() error: %v", err)
+	}
+	if status, token := login(); status != http.StatusForbidden || token != "" {
+		t.Errorf("login over the limit = %d, want 403 without a session", status)
+	}
+	if !valid(tokens[1]) || !valid(tokens[2]) {
+		t.Error("sessions revoked by a rejected login")
+	}
+
+	if err := validateLoginSessionLimit(db.OrgLoginSessionLimit{Max: 1, OnExceed: "block"}); err == nil {
+		t.Error("validateLoginSessionLimit() accepted an unknown onExceed")
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/niekvdm/digit-link/internal/protocol"
+)
+
+const (
+	// defaultMaxMessageBytes is the default limit on a single WebSocket message from a tunnel client
+	defaultMaxMessageBytes = 16 * 1024 * 1024
+	// defaultMaxResponseBytes is the default limit on a message reassembled from fragments
+	defaultMaxResponseBytes = 256 * 1024 * 1024
+)
+
+// GetTunnelMaxMessageBytes returns the WebSocket message size limit for tunnel clients from environment or default
+func GetTunnelMaxMessageBytes() int {
+	if limit := os.Getenv("TUNNEL_MAX_MESSAGE_BYTES"); limit != "" {
+		var n int
+		fmt.Sscanf(limit, "%d", &n)
+		if n > 0 {
+			return n
+		}
+	}
+	return defaultMaxMessageBytes
+}
+
+// GetTunnelMaxResponseBytes returns the limit on fragmented tunnel messages from environment or default
+func GetTunnelMaxResponseBytes() int {
+	if limit := os.Getenv("TUNNEL_MAX_RESPONSE_BYTES"); limit != "" {
+		var n int
+		fmt.Sscanf(limit, "%d", &n)
+		if n > 0 {
+			return n
+		}
+	}
+	return defaultMaxResponseBytes
+}
+
+// fragmentAssembler joins fragment messages from a tunnel client back into
+// the original message, refusing to grow past a size limit
+type fragmentAssembler struct {
+	limit int
+	buf   []byte
+}
+
+// add appends a fragment message. It returns the reassembled message once the
+// final fragment arrives, or an error if the fragment is invalid or the
+// message grows past the limit.
+func (a *fragmentAssembler) add(msg []byte) ([]byte, error) {
+	var frame struct {
+		Payload protocol.Fragment `json:"payload"`
+	}
+	if err := json.Unmarshal(msg, &frame); err != nil {
+		return nil, fmt.Errorf("invalid fragment: %w", err)
+	}
+
+	if a.limit > 0 && len(a.buf)+len(frame.Payload.Data) > a.limit {
+		a.buf = nil
+		return nil, fmt.Errorf("fragmented message exceeds %d bytes", a.limit)
+	}
+	a.buf = append(a.buf, frame.Payload.Data...)
+
+	if !frame.Payload.Final {
+		return nil, nil
+	}
+	full := a.buf
+	a.buf = nil
+	return full, nil
+}
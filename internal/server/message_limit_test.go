@@ -0,0 +1,86 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/niekvdm/digit-link/internal/protocol"
+)
+
+func TestTunnelMessageLimit(t *testing.T) {
+	s := newTestServer(nil)
+	s.maxMessageBytes = 2048
+	s.maxResponseBytes = 64 * 1024
+	ts := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer ts.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/_tunnel", nil)
+	if err != nil {
+		t.Fatalf("Dial() error: %v", err)
+	}
+	defer conn.Close()
+
+	reg, _ := json.Marshal(protocol.Message{Type: protocol.TypeRegisterRequest, Payload: protocol.RegisterRequest{Subdomain: "big"}})
+	conn.WriteMessage(websocket.TextMessage, reg)
+	var regResp struct {
+		Payload protocol.RegisterResponse `json:"payload"`
+	}
+	if err := conn.ReadJSON(&regResp); err != nil || !regResp.Payload.Success {
+		t.Fatalf("registration failed: %v %+v", err, regResp.Payload)
+	}
+	if regResp.Payload.MaxMessageBytes != 2048 {
+		t.Errorf("MaxMessageBytes = %d, want 2048", regResp.Payload.MaxMessageBytes)
+	}
+
+	// A response larger than the limit gets through when fragmented
+	s.mu.RLock()
+	tun := s.tunnels["big"]
+	s.mu.RUnlock()
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		s.forwardRequest(rec, httptest.NewRequest(http.MethodGet, "http://big.link.test/file", nil), tun, nil)
+		close(done)
+	}()
+
+	var req struct {
+		Type    string               `json:"type"`
+		Payload protocol.HTTPRequest `json:"payload"`
+	}
+	if err := conn.ReadJSON(&req); err != nil || req.Type != protocol.TypeHTTPRequest {
+		t.Fatalf("expected http_request, got %q (%v)", req.Type, err)
+	}
+	body := bytes.Repeat([]byte("0123456789"), 1000)
+	resp, _ := json.Marshal(protocol.Message{
+		Type:    protocol.TypeHTTPResponse,
+		Payload: protocol.HTTPResponse{ID: req.Payload.ID, StatusCode: http.StatusOK, Body: body},
+	})
+	parts := protocol.FragmentMessage(resp, regResp.Payload.MaxMessageBytes)
+	if len(parts) < 2 {
+		t.Fatalf("FragmentMessage() returned %d parts, want several", len(parts))
+	}
+	for _, part := range parts {
+		if len(part) > 2048 {
+			t.Fatalf("fragment of %d bytes exceeds the limit", len(part))
+		}
+		conn.WriteMessage(websocket.TextMessage, part)
+	}
+	<-done
+	if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), body) {
+		t.Errorf("fragmented response: status %d, %d body bytes, want 200 with %d", rec.Code, rec.Body.Len(), len(body))
+	}
+
+	// A single oversized message closes the tunnel with 1009
+	conn.WriteMessage(websocket.TextMessage, bytes.Repeat([]byte("x"), 4096))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Errorf("read after oversized message: %v, want close 1009", err)
+	}
+}
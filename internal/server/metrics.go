@@ -0,0 +1,184 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+const (
+	// metricsSnapshotInterval is how often server counters are written to the time series
+	metricsSnapshotInterval = time.Minute
+	// defaultMetricsRetentionDays is how long metrics snapshots are kept by default
+	defaultMetricsRetentionDays = 30
+	// maxMetricsRetentionDays bounds the metrics_retention setting
+	maxMetricsRetentionDays = 365
+	// maxTimeseriesPoints bounds the buckets of one time series response
+	maxTimeseriesPoints = 10000
+)
+
+// Time series metrics served by /admin/metrics/timeseries
+const (
+	metricRequests = "requests" // Requests answered for tunnels, per bucket
+	metricErrors   = "errors"   // Requests answered with a 5xx status, per bucket
+	metricTunnels  = "tunnels"  // Most tunnels connected at a snapshot in the bucket
+)
+
+// serverMetrics counts requests and errors since the last metrics snapshot
+type serverMetrics struct {
+	requests atomic.Int64
+	errors   atomic.Int64
+}
+
+// countRequest counts a request answered for a tunnel subdomain, and an error for
+// 5xx statuses. A status of 0 means nothing was written, which net/http sends as 200.
+func (m *serverMetrics) countRequest(status int) {
+	m.requests.Add(1)
+	if status >= http.StatusInternalServerError {
+		m.errors.Add(1)
+	}
+}
+
+// activeTunnelCount returns the number of subdomains served by connected tunnels
+func (s *Server) activeTunnelCount() int {
+	s.mu.RLock()
+	count := len(s.tunnels)
+	s.mu.RUnlock()
+	if s.tunnelListener != nil {
+		s.tunnelListener.mu.RLock()
+		count += len(s.tunnelListener.sessions)
+		s.tunnelListener.mu.RUnlock()
+	}
+	return count
+}
+
+// snapshotMetrics writes the counters since the previous snapshot and the
+// tunnels connected now into the minute bucket of at
+func (s *Server) snapshotMetrics(at time.Time) error {
+	return s.db.AddServerMetrics(db.ServerMetrics{
+		BucketStart:   at.UTC().Truncate(metricsSnapshotInterval),
+		RequestCount:  s.metrics.requests.Swap(0),
+		ErrorCount:    s.metrics.errors.Swap(0),
+		ActiveTunnels: s.activeTunnelCount(),
+	})
+}
+
+// metricsRoutine snapshots the server counters every minute and prunes
+// snapshots older than the metrics_retention setting
+func (s *Server) metricsRoutine() {
+	if s.db == nil {
+		return
+	}
+	ticker := time.NewTicker(metricsSnapshotInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if err := s.snapshotMetrics(now); err != nil {
+			log.Printf("Failed to snapshot server metrics: %v", err)
+		}
+		if now.Minute() == 0 {
+			days := s.settingValue(db.SettingMetricsRetention).(*db.MetricsRetentionSettings).Days
+			if _, err := s.db.DeleteServerMetricsBefore(now.AddDate(0, 0, -days)); err != nil {
+				log.Printf("Failed to prune server metrics: %v", err)
+			}
+		}
+	}
+}
+
+// timeseriesPoint is the value of a metric in one bucket
+type timeseriesPoint struct {
+	BucketStart time.Time `json:"bucketStart"`
+	Value       int64     `json:"value"`
+}
+
+// handleMetricsTimeseries returns a server metric over time in minute, hour or
+// day buckets, folded from the minute snapshots. Buckets without snapshots,
+// such as while the server was down, are left out.
+func (s *Server) handleMetricsTimeseries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	metric := query.Get("metric")
+	switch metric {
+	case metricRequests, metricErrors, metricTunnels:
+	case "":
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "metric is required")
+		return
+	default:
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "Invalid metric (expected requests, errors or tunnels)")
+		return
+	}
+
+	var err error
+	to := time.Now().UTC()
+	from := to.Add(-24 * time.Hour)
+	if v := query.Get("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "Invalid from (expected RFC3339)")
+			return
+		}
+	}
+	if v := query.Get("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "Invalid to (expected RFC3339)")
+			return
+		}
+	}
+	if !from.Before(to) {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "from must be before to")
+		return
+	}
+
+	bucket := query.Get("bucket")
+	var bucketSize time.Duration
+	switch bucket {
+	case "", "hour":
+		bucket = "hour"
+		bucketSize = time.Hour
+	case "minute":
+		bucketSize = time.Minute
+	case "day":
+		bucketSize = 24 * time.Hour
+	default:
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "Invalid bucket (expected minute, hour or day)")
+		return
+	}
+	if to.Sub(from)/bucketSize > maxTimeseriesPoints {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "Range has too many buckets; use a larger bucket")
+		return
+	}
+
+	snapshots, err := s.db.GetServerMetrics(from.UTC(), to.UTC())
+	if err != nil {
+		log.Printf("Failed to get server metrics: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+
+	// Counts add up within a bucket; the tunnel gauge keeps its peak
+	points := []*timeseriesPoint{}
+	for _, m := range snapshots {
+		start := m.BucketStart.UTC().Truncate(bucketSize)
+		if len(points) == 0 || !points[len(points)-1].BucketStart.Equal(start) {
+			points = append(points, &timeseriesPoint{BucketStart: start})
+		}
+		p := points[len(points)-1]
+		switch metric {
+		case metricRequests:
+			p.Value += m.RequestCount
+		case metricErrors:
+			p.Value += m.ErrorCount
+		case metricTunnels:
+			p.Value = max(p.Value, int64(m.ActiveTunnels))
+		}
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"metric": metric,
+		"from":   from,
+		"to":     to,
+		"bucket": bucket,
+		"points": points,
+	})
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestMetricsTimeseries(t *testing.T) {
+	database := newTestDB(t)
+
+	s := newTestServer(database)
+	s.tunnels = map[string]*Tunnel{"a": {}, "b": {}}
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i, statuses := range [][]int{{200, 200, 502}, {404}, {500, 200}} {
+		for _, status := range statuses {
+			s.metrics.countRequest(status)
+		}
+		if i == 2 {
+			delete(s.tunnels, "b")
+		}
+		// The last snapshot falls in the next hour
+		if err := s.snapshotMetrics(base.Add(time.Duration(i) * 30 * time.Minute)); err != nil {
+			t.Fatalf("snapshotMetrics() error: %v", err)
+		}
+	}
+
+	series := func(query string) (int, []timeseriesPoint) {
+		w := httptest.NewRecorder()
+		s.handleMetricsTimeseries(w, httptest.NewRequest(http.MethodGet, "/admin/metrics/timeseries?"+query, nil))
+		var resp struct {
+			Points []timeseriesPoint `json:"points"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Points
+	}
+	rangeQuery := "&from=2026-03-01T00:00:00Z&to=2026-03-02T00:00:00Z"
+
+	for metric, want := range map[string][]timeseriesPoint{
+		"requests": {{base, 4}, {base.Add(time.Hour), 2}},
+		"errors":   {{base, 1}, {base.Add(time.Hour), 1}},
+		"tunnels":  {{base, 2}, {base.Add(time.Hour), 1}},
+	} {
+		code, points := series("metric=" + metric + rangeQuery)
+		if code != http.StatusOK || len(points) != len(want) {
+			t.Errorf("%s = %d %+v, want %+v", metric, code, points, want)
+			continue
+		}
+		for i := range want {
+			if !points[i].BucketStart.Equal(want[i].BucketStart) || points[i].Value != want[i].Value {
+				t.Errorf("%s = %+v, want %+v", metric, points, want)
+				break
+			}
+		}
+	}
+	if _, points := series("metric=requests&bucket=day" + rangeQuery); len(points) != 1 || points[0].Value != 6 {
+		t.Errorf("daily requests = %+v, want one bucket of 6", points)
+	}
+
+	for _, query := range []string{"metric=latency", "", "metric=requests&bucket=week", "metric=requests&bucket=minute&from=2025-01-01T00:00:00Z&to=2026-01-01T00:00:00Z"} {
+		if code, _ := series(query); code != http.StatusBadRequest {
+			t.Errorf("%q: status %d, want 400", query, code)
+		}
+	}
+
+	// Retention comes from the metrics_retention setting
+	if days := s.settingValue(db.SettingMetricsRetention).(*db.MetricsRetentionSettings).Days; days != defaultMetricsRetentionDays {
+		t.Errorf("default retention = %d days, want %d", days, defaultMetricsRetentionDays)
+	}
+	if _, err := serverSettings[db.SettingMetricsRetention].parse(json.RawMessage(`{"days":0}`)); err == nil {
+		t.Error("retention of 0 days accepted")
+	}
+	if deleted, err := database.DeleteServerMetricsBefore(base.Add(time.Hour)); err != nil || deleted != 2 {
+		t.Errorf("DeleteServerMetricsBefore() = %d, %v, want 2 snapshots pruned", deleted, err)
+	}
+}
+
+func TestRequestMetricsCountedOnce(t *testing.T) {
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	app, err := database.CreateApplication(org.ID, "secure", "Secure")
+	if err != nil {
+		t.Fatalf("CreateApplication() error: %v", err)
+	}
+	if err := database.UpdateApplicationForceHTTPS(app.ID, db.ForceHTTPSRedirect); err != nil {
+		t.Fatalf("UpdateApplicationForceHTTPS() error: %v", err)
+	}
+
+	s := newTestServer(database)
+	s.scheme = "https"
+	for _, tt := range []struct {
+		target string
+		status int
+	}{
+		{"http://secure.link.test/docs", http.StatusMovedPermanently},
+		{"https://missing.link.test/", http.StatusNotFound},
+		{"https://link.test/api/health", http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+		if w.Code != tt.status {
+			t.Fatalf("GET %s = %d, want %d", tt.target, w.Code, tt.status)
+		}
+	}
+
+	// The redirect and the missing tunnel count once each; the main domain is not a tunnel
+	if requests, errors := s.metrics.requests.Load(), s.metrics.errors.Load(); requests != 2 || errors != 0 {
+		t.Errorf("counted %d requests and %d errors, want 2 and 0", requests, errors)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -37,10 +38,14 @@ type AuthMiddleware struct {
 	basicLoginHandler *auth.BasicAuthLoginHandler
 	apiKeyHandler     AuthHandler
 	oidcHandler       AuthHandler
+	webhookHandler    AuthHandler
 
 	// Rate limiter
 	rateLimiter *auth.RateLimiter
 
+	// Rate limiter for API keys on the elevated tier, keyed by key ID
+	elevatedRateLimiter *auth.RateLimiter
+
 	// Per-app rate limiter cache
 	appRateLimiters  sync.Map // map[string]*auth.RateLimiter
 	appRLConfigCache sync.Map // map[string]*appRateLimitCacheEntry
@@ -49,6 +54,12 @@ type AuthMiddleware struct {
 	defaultDeny bool   // If true, deny when policy cannot be determined
 	scheme      string // URL scheme (http or https) for cookie security
 	domain      string // Server domain for subdomain extraction
+
+	// Server-wide session cookie attributes, orgs may override them
+	cookieConfig auth.CookieConfig
+
+	// Hosts besides the requested one that logins may redirect back to
+	returnHosts []string
 }
 
 // appRateLimitCacheEntry caches rate limit config with expiration
@@ -69,6 +80,12 @@ type AuthHandler interface {
 // AuthMiddlewareOption is a functional option for configuring the middleware
 type AuthMiddlewareOption func(*AuthMiddleware)
 
+// GetAuthFailOpen reports whether AUTH_FAIL_OPEN lets requests through when their
+// auth policy cannot be loaded. Default is fail-closed.
+func GetAuthFailOpen() bool {
+	return os.Getenv("AUTH_FAIL_OPEN") == "true"
+}
+
 // WithDefaultDeny sets whether to deny by default when policy is undetermined
 func WithDefaultDeny(deny bool) AuthMiddlewareOption {
 	return func(m *AuthMiddleware) {
@@ -97,6 +114,13 @@ func WithOIDCHandler(h AuthHandler) AuthMiddlewareOption {
 	}
 }
 
+// WithWebhookHandler sets the authorization webhook handler
+func WithWebhookHandler(h AuthHandler) AuthMiddlewareOption {
+	return func(m *AuthMiddleware) {
+		m.webhookHandler = h
+	}
+}
+
 // WithRateLimiter sets the rate limiter
 func WithRateLimiter(rl *auth.RateLimiter) AuthMiddlewareOption {
 	return func(m *AuthMiddleware) {
@@ -104,6 +128,13 @@ func WithRateLimiter(rl *auth.RateLimiter) AuthMiddlewareOption {
 	}
 }
 
+// WithElevatedRateLimiter sets the rate limiter used for elevated-tier API keys
+func WithElevatedRateLimiter(rl *auth.RateLimiter) AuthMiddlewareOption {
+	return func(m *AuthMiddleware) {
+		m.elevatedRateLimiter = rl
+	}
+}
+
 // WithScheme sets the URL scheme for cookie security
 func WithScheme(scheme string) AuthMiddlewareOption {
 	return func(m *AuthMiddleware) {
@@ -134,6 +165,10 @@ func NewAuthMiddleware(database *db.DB, opts ...AuthMiddlewareOption) *AuthMiddl
 		defaultDeny:    true,   // Fail closed by default
 		scheme:         "https", // Default to https
 		rateLimiter:    auth.NewRateLimiter(database, auth.DefaultRateLimiterConfig()),
+
+		elevatedRateLimiter: auth.NewRateLimiter(database, auth.ElevatedRateLimiterConfig()),
+		cookieConfig:        auth.GetCookieConfig(),
+		returnHosts:         auth.GetLoginReturnHosts(),
 	}
 
 	for _, opt := range opts {
@@ -142,6 +177,9 @@ func NewAuthMiddleware(database *db.DB, opts ...AuthMiddlewareOption) *AuthMiddl
 
 	// Initialize basic login handler after opts (needs scheme)
 	m.basicLoginHandler = auth.NewBasicAuthLoginHandler(database, m.scheme)
+	if m.webhookHandler == nil {
+		m.webhookHandler = auth.NewWebhookAuthHandler()
+	}
 
 	return m
 }
@@ -232,33 +270,40 @@ func (m *AuthMiddleware) AuthenticateWithContext(w http.ResponseWriter, r *http.
 
 // authenticate dispatches to the appropriate auth handler
 func (m *AuthMiddleware) authenticate(w http.ResponseWriter, r *http.Request, p *policy.EffectivePolicy, ctx *policy.AuthContext) (*policy.AuthResult, *policy.AuthContext) {
-	// Check rate limit before authentication
+	// Check rate limit before authentication. The per-IP bucket is checked before
+	// a presented API key is looked up, so floods of invalid keys cost no lookups.
 	clientIP := auth.GetClientIP(r)
-	rateLimitKey := auth.IPRateLimitKey(clientIP)
-	if ctx != nil && ctx.AppID != "" {
-		rateLimitKey = auth.AppIPRateLimitKey(ctx.AppID, clientIP)
+	ipLimiter, skipIP := m.getAppRateLimiter(ctx)
+	ipKey := appIPRateLimitKey(ctx, clientIP)
+
+	var lookup *apiKeyLookup
+	if m.validatesAPIKeys(p) {
+		if raw := apiKeyFromRequest(r); raw != "" {
+			if !skipIP && ipLimiter != nil {
+				if blocked, retryAfter := ipLimiter.IsBlocked(ipKey); blocked {
+					return m.rateLimited(w, p, ctx, clientIP, retryAfter), ctx
+				}
+			}
+			lookup = m.lookupAPIKey(raw)
+		}
 	}
 
-	// Get the appropriate rate limiter for this app
-	rl, skipRateLimiting := m.getAppRateLimiter(ctx)
+	rl, rateLimitKey, skipRateLimiting := ipLimiter, ipKey, skipIP
+	if key := lookup.scopedKey(ctx); key != nil {
+		switch key.RateLimitTier {
+		case db.RateLimitTierExempt:
+			rl, rateLimitKey, skipRateLimiting = nil, "", true
+		case db.RateLimitTierElevated:
+			if m.elevatedRateLimiter != nil {
+				rl, rateLimitKey, skipRateLimiting = m.elevatedRateLimiter, auth.APIKeyRateLimitKey(key.ID), false
+			}
+		}
+	}
 
 	if !skipRateLimiting && rl != nil {
 		allowed, retryAfter := rl.Allow(rateLimitKey)
 		if !allowed {
-			// Log rate limit hit
-			if m.db != nil && ctx != nil {
-				var orgID, appID *string
-				if ctx.OrgID != "" {
-					orgID = &ctx.OrgID
-				}
-				if ctx.AppID != "" {
-					appID = &ctx.AppID
-				}
-				m.db.LogAuthFailure(orgID, appID, string(p.Type), clientIP, "rate_limited")
-			}
-
-			w.Header().Set("Retry-After", fmt.Sprintf("%d", int(retryAfter.Seconds())))
-			return policy.Failure(fmt.Sprintf("rate limited, retry after %v", retryAfter)), ctx
+			return m.rateLimited(w, p, ctx, clientIP, retryAfter), ctx
 		}
 	}
 
@@ -266,9 +311,10 @@ func (m *AuthMiddleware) authenticate(w http.ResponseWriter, r *http.Request, p
 
 	// If API key is enabled as add-on, try it first
 	if p.HasAPIKeyAddOn() && m.hasAPIKeyHeader(r) {
-		result = m.defaultAPIKeyAuth(w, r, p, ctx)
+		result = m.defaultAPIKeyAuth(w, r, ctx, lookup)
 		if result.Authenticated {
 			// API key auth succeeded
+			result.Method = string(policy.AuthTypeAPIKey)
 			if !skipRateLimiting && rl != nil {
 				rl.RecordSuccess(rateLimitKey)
 			}
@@ -291,7 +337,7 @@ func (m *AuthMiddleware) authenticate(w http.ResponseWriter, r *http.Request, p
 
 	case policy.AuthTypeAPIKey:
 		if m.apiKeyHandler == nil {
-			result = m.defaultAPIKeyAuth(w, r, p, ctx)
+			result = m.defaultAPIKeyAuth(w, r, ctx, lookup)
 		} else {
 			result = m.apiKeyHandler.Authenticate(w, r, p, ctx)
 		}
@@ -303,6 +349,9 @@ func (m *AuthMiddleware) authenticate(w http.ResponseWriter, r *http.Request, p
 			result = m.oidcHandler.Authenticate(w, r, p, ctx)
 		}
 
+	case policy.AuthTypeWebhook:
+		result = m.webhookHandler.Authenticate(w, r, p, ctx)
+
 	default:
 		// Unknown auth type - deny if in strict mode
 		if m.defaultDeny {
@@ -312,6 +361,11 @@ func (m *AuthMiddleware) authenticate(w http.ResponseWriter, r *http.Request, p
 		}
 	}
 
+	// Record the method that let the request through, for the identity headers
+	if result.Authenticated && (p.IsBasic() || p.IsAPIKey() || p.IsOIDC() || p.IsWebhook()) {
+		result.Method = string(p.Type)
+	}
+
 	// Record success/failure for rate limiting
 	if !skipRateLimiting && rl != nil {
 		if result.Authenticated {
@@ -326,6 +380,65 @@ func (m *AuthMiddleware) authenticate(w http.ResponseWriter, r *http.Request, p
 	return result, ctx
 }
 
+// rateLimited logs a request refused by the rate limiter and returns its failure
+func (m *AuthMiddleware) rateLimited(w http.ResponseWriter, p *policy.EffectivePolicy, ctx *policy.AuthContext, clientIP string, retryAfter time.Duration) *policy.AuthResult {
+	if m.db != nil && ctx != nil {
+		var orgID, appID *string
+		if ctx.OrgID != "" {
+			orgID = &ctx.OrgID
+		}
+		if ctx.AppID != "" {
+			appID = &ctx.AppID
+		}
+		m.db.LogAuthFailure(orgID, appID, string(p.Type), clientIP, "rate_limited")
+	}
+
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", int(retryAfter.Seconds())))
+	return policy.Failure(fmt.Sprintf("rate limited, retry after %v", retryAfter))
+}
+
+// appIPRateLimitKey returns the per-IP rate limit bucket of a request, per app when known
+func appIPRateLimitKey(ctx *policy.AuthContext, clientIP string) string {
+	if ctx != nil && ctx.AppID != "" {
+		return auth.AppIPRateLimitKey(ctx.AppID, clientIP)
+	}
+	return auth.IPRateLimitKey(clientIP)
+}
+
+// apiKeyLookup is an API key presented with a request, validated once so the
+// rate limiter and the authentication share the result
+type apiKeyLookup struct {
+	raw string
+	key *db.APIKey // nil when the key is unknown or expired
+	err error
+}
+
+// validatesAPIKeys checks if the middleware itself validates the API keys of the
+// policy: as an add-on, or as its auth type without a custom handler
+func (m *AuthMiddleware) validatesAPIKeys(p *policy.EffectivePolicy) bool {
+	if m.db == nil || p == nil {
+		return false
+	}
+	return p.HasAPIKeyAddOn() || (p.Type == policy.AuthTypeAPIKey && m.apiKeyHandler == nil)
+}
+
+// lookupAPIKey validates a raw API key
+func (m *AuthMiddleware) lookupAPIKey(raw string) *apiKeyLookup {
+	key, err := m.db.ValidateAPIKey(raw)
+	return &apiKeyLookup{raw: raw, key: key, err: err}
+}
+
+// scopedKey returns the looked up key if it is valid for the org/app in ctx.
+// Requests with such a key on the elevated or exempt tier are limited per key
+// (or not at all) instead of sharing the per-IP bucket with anonymous traffic,
+// so a noisy neighbour behind the same IP cannot lock out an automated client.
+func (l *apiKeyLookup) scopedKey(ctx *policy.AuthContext) *db.APIKey {
+	if l == nil || l.key == nil || apiKeyScopeError(l.key, ctx) != "" {
+		return nil
+	}
+	return l.key
+}
+
 // hasAPIKeyHeader checks if an API key header is present (without validating)
 func (m *AuthMiddleware) hasAPIKeyHeader(r *http.Request) bool {
 	if r.Header.Get("X-API-Key") != "" {
@@ -378,8 +491,10 @@ func (m *AuthMiddleware) HandleAuthResult(w http.ResponseWriter, r *http.Request
 		w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate")
 		w.Header().Set("Pragma", "no-cache")
 		http.Redirect(w, r, loginURL, http.StatusFound)
+	} else if p != nil && p.Type == policy.AuthTypeAPIKey && auth.RedirectWithoutAPIKey(w, r, p) {
+		// Browser sent to the app's "get an API key" page
 	} else {
-		http.Error(w, "Unauthorized: "+result.Error, http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Unauthorized: "+result.Error)
 	}
 	return false
 }
@@ -403,30 +518,30 @@ func (m *AuthMiddleware) sendChallenge(w http.ResponseWriter, r *http.Request, p
 	case policy.AuthTypeAPIKey:
 		if m.apiKeyHandler != nil {
 			m.apiKeyHandler.Challenge(w, r, p, ctx)
-		} else {
-			http.Error(w, "API key required", http.StatusUnauthorized)
+		} else if !auth.RedirectWithoutAPIKey(w, r, p) {
+			writeError(w, r, http.StatusUnauthorized, errCodeAuthRequired, "API key required")
 		}
 
 	case policy.AuthTypeOIDC:
 		if m.oidcHandler != nil {
 			m.oidcHandler.Challenge(w, r, p, ctx)
 		} else {
-			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			writeError(w, r, http.StatusUnauthorized, errCodeAuthRequired, "Authentication required")
 		}
 
 	default:
-		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, errCodeAuthRequired, "Authentication required")
 	}
 }
 
 // sendBasicChallenge sends a Basic auth challenge
-func (m *AuthMiddleware) sendBasicChallenge(w http.ResponseWriter, ctx *policy.AuthContext) {
+func (m *AuthMiddleware) sendBasicChallenge(w http.ResponseWriter, r *http.Request, ctx *policy.AuthContext) {
 	realm := "digit-link"
 	if ctx != nil && ctx.Subdomain != "" {
 		realm = ctx.Subdomain + ".digit-link"
 	}
 	w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`"`)
-	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, "Unauthorized")
 }
 
 // Default auth implementations (stubs that deny by default)
@@ -467,7 +582,7 @@ func (m *AuthMiddleware) defaultBasicAuth(w http.ResponseWriter, r *http.Request
 
 		session, err := m.basicLoginHandler.ValidateSession(r, appID, orgID)
 		if err == nil && session != nil {
-			return policy.SuccessWithSession(session.ID, session.UserEmail)
+			return policy.SuccessFromSession(session)
 		}
 	}
 
@@ -486,8 +601,8 @@ func (m *AuthMiddleware) defaultBasicAuth(w http.ResponseWriter, r *http.Request
 // HandleBasicAuthLogin handles the Basic Auth login endpoint
 // This is the ONLY endpoint that sends the 401 challenge, ensuring single prompt
 func (m *AuthMiddleware) HandleBasicAuthLogin(w http.ResponseWriter, r *http.Request) {
-	// Parse query parameters
-	returnURL := r.URL.Query().Get("return")
+	// Parse query parameters; the return URL must stay on this host
+	returnURL := auth.SafeReturnURL(r.URL.Query().Get("return"), r.Host, m.returnHosts)
 	subdomain := r.URL.Query().Get("subdomain")
 
 	// Fallback to extracting subdomain from Host header if not in query
@@ -496,7 +611,7 @@ func (m *AuthMiddleware) HandleBasicAuthLogin(w http.ResponseWriter, r *http.Req
 	}
 
 	if subdomain == "" {
-		http.Error(w, "Missing subdomain parameter", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "Missing subdomain parameter")
 		return
 	}
 
@@ -504,53 +619,113 @@ func (m *AuthMiddleware) HandleBasicAuthLogin(w http.ResponseWriter, r *http.Req
 	effectivePolicy, authCtx, err := m.policyLoader.LoadForSubdomain(subdomain)
 	if err != nil {
 		log.Printf("Failed to load policy for subdomain %s: %v", subdomain, err)
-		http.Error(w, "Failed to load auth policy", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to load auth policy")
 		return
 	}
 
 	if effectivePolicy == nil || effectivePolicy.Basic == nil {
-		http.Error(w, "Basic auth not configured for this subdomain", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "Basic auth not configured for this subdomain")
 		return
 	}
 
+	// Restrict framing of the login page, unless the organization allows embedding
+	var org *db.Organization
+	if authCtx != nil {
+		org = m.lookupOrganization(authCtx.OrgID)
+	}
+	frameAncestors := ""
+	if org != nil {
+		frameAncestors = org.AuthFrameAncestors
+	}
+	auth.BasicLoginSecurityHeaders().WithFrameAncestors(frameAncestors).Apply(w)
+
 	// Delegate to the login handler
 	config := &auth.LoginConfig{
 		Policy:    effectivePolicy,
 		AuthCtx:   authCtx,
 		ReturnURL: returnURL,
+		Branding:  auth.BrandingForOrg(org),
+		Cookie:    m.cookieConfig.ForOrg(org),
+
+		ReturnHosts: m.returnHosts,
 	}
 
 	m.basicLoginHandler.HandleLogin(w, r, config)
 }
 
+// FrameAncestorsForSubdomain returns the CSP frame-ancestors sources allowed to
+// embed the login pages of a subdomain's organization ("" = not embeddable)
+func (m *AuthMiddleware) FrameAncestorsForSubdomain(subdomain string) string {
+	_, authCtx, err := m.policyLoader.LoadForSubdomain(subdomain)
+	if err != nil || authCtx == nil {
+		return ""
+	}
+	return m.orgFrameAncestors(authCtx.OrgID)
+}
+
+// appForSubdomain returns the subdomain's application, or nil without one. The
+// proxy looks it up once per request and reads the app's settings from it.
+func (m *AuthMiddleware) appForSubdomain(subdomain string) *db.Application {
+	if m == nil {
+		return nil
+	}
+	_, authCtx, err := m.policyLoader.LoadForSubdomain(subdomain)
+	if err != nil || authCtx == nil {
+		return nil
+	}
+	return authCtx.App
+}
+
+// BrandingForOrg returns the login and error page branding of an organization
+func (m *AuthMiddleware) BrandingForOrg(orgID string) auth.Branding {
+	return auth.BrandingForOrg(m.lookupOrganization(orgID))
+}
+
+// CookieConfigForOrg returns the session cookie attributes of an organization
+func (m *AuthMiddleware) CookieConfigForOrg(orgID string) auth.CookieConfig {
+	return m.cookieConfig.ForOrg(m.lookupOrganization(orgID))
+}
+
+// orgFrameAncestors returns an organization's login page frame-ancestors setting
+func (m *AuthMiddleware) orgFrameAncestors(orgID string) string {
+	org := m.lookupOrganization(orgID)
+	if org == nil {
+		return ""
+	}
+	return org.AuthFrameAncestors
+}
+
+// lookupOrganization returns an organization by ID, or nil if it is unset or cannot be loaded
+func (m *AuthMiddleware) lookupOrganization(orgID string) *db.Organization {
+	if orgID == "" || m.db == nil {
+		return nil
+	}
+	org, err := m.db.GetOrganizationByID(orgID)
+	if err != nil {
+		return nil
+	}
+	return org
+}
+
 // GetBasicAuthLoginPath returns the path for the basic auth login endpoint
 func GetBasicAuthLoginPath() string {
 	return auth.BasicAuthLoginPath
 }
 
-func (m *AuthMiddleware) defaultAPIKeyAuth(w http.ResponseWriter, r *http.Request, p *policy.EffectivePolicy, ctx *policy.AuthContext) *policy.AuthResult {
-	// Check for API key in header
-	apiKey := r.Header.Get("X-API-Key")
-	if apiKey == "" {
-		// Try X-Tunnel-API-Key header (alias for tunnel clients)
-		apiKey = r.Header.Get("X-Tunnel-API-Key")
-	}
-	if apiKey == "" {
-		// Try Authorization: Bearer
-		authHeader := r.Header.Get("Authorization")
-		if strings.HasPrefix(authHeader, "Bearer ") {
-			apiKey = strings.TrimPrefix(authHeader, "Bearer ")
+func (m *AuthMiddleware) defaultAPIKeyAuth(w http.ResponseWriter, r *http.Request, ctx *policy.AuthContext, lookup *apiKeyLookup) *policy.AuthResult {
+	if lookup == nil {
+		apiKey := apiKeyFromRequest(r)
+		if apiKey == "" {
+			return policy.Challenge("API key required")
 		}
+		lookup = m.lookupAPIKey(apiKey)
 	}
-
-	if apiKey == "" {
-		return policy.Challenge("API key required")
-	}
+	apiKey := lookup.raw
 
 	log.Printf("[APIKey] Validating key with prefix: %s...", apiKey[:min(8, len(apiKey))])
 
-	// Validate API key
-	key, err := m.db.ValidateAPIKey(apiKey)
+	// Validated once per request, before the rate limit check
+	key, err := lookup.key, lookup.err
 	if err != nil {
 		log.Printf("[APIKey] Validation error: %v", err)
 		return policy.Failure("API key validation error")
@@ -562,16 +737,8 @@ func (m *AuthMiddleware) defaultAPIKeyAuth(w http.ResponseWriter, r *http.Reques
 	log.Printf("[APIKey] Key valid: id=%s appID=%v orgID=%v", key.ID, key.AppID, key.OrgID)
 
 	// Check if key is for this org/app
-	if ctx != nil {
-		if ctx.AppID != "" && key.AppID != nil && *key.AppID != ctx.AppID {
-			// Key is for a different app
-			if key.OrgID == nil || *key.OrgID != ctx.OrgID {
-				return policy.Failure("API key not valid for this application")
-			}
-		}
-		if ctx.OrgID != "" && key.OrgID != nil && *key.OrgID != ctx.OrgID {
-			return policy.Failure("API key not valid for this organization")
-		}
+	if msg := apiKeyScopeError(key, ctx); msg != "" {
+		return policy.Failure(msg)
 	}
 
 	// Update last used
@@ -580,9 +747,45 @@ func (m *AuthMiddleware) defaultAPIKeyAuth(w http.ResponseWriter, r *http.Reques
 	return policy.SuccessWithKey(key.ID, key.KeyPrefix)
 }
 
+// apiKeyFromRequest extracts a raw API key from the request headers
+func apiKeyFromRequest(r *http.Request) string {
+	// Check for API key in header
+	apiKey := r.Header.Get("X-API-Key")
+	if apiKey == "" {
+		// Try X-Tunnel-API-Key header (alias for tunnel clients)
+		apiKey = r.Header.Get("X-Tunnel-API-Key")
+	}
+	if apiKey == "" {
+		// Try Authorization: Bearer
+		authHeader := r.Header.Get("Authorization")
+		if strings.HasPrefix(authHeader, "Bearer ") {
+			apiKey = strings.TrimPrefix(authHeader, "Bearer ")
+		}
+	}
+	return apiKey
+}
+
+// apiKeyScopeError returns a failure message if key may not be used for the
+// org/app in ctx, or an empty string if it may
+func apiKeyScopeError(key *db.APIKey, ctx *policy.AuthContext) string {
+	if ctx == nil {
+		return ""
+	}
+	if ctx.AppID != "" && key.AppID != nil && *key.AppID != ctx.AppID {
+		// Key is for a different app
+		if key.OrgID == nil || *key.OrgID != ctx.OrgID {
+			return "API key not valid for this application"
+		}
+	}
+	if ctx.OrgID != "" && key.OrgID != nil && *key.OrgID != ctx.OrgID {
+		return "API key not valid for this organization"
+	}
+	return ""
+}
+
 func (m *AuthMiddleware) defaultOIDCAuth(w http.ResponseWriter, r *http.Request, p *policy.EffectivePolicy, ctx *policy.AuthContext) *policy.AuthResult {
 	// Check for session cookie
-	cookie, err := r.Cookie("digit_link_session")
+	cookie, err := r.Cookie(auth.OIDCSessionCookie)
 	if err != nil || cookie.Value == "" {
 		// No session - need to redirect to login
 		return policy.Redirect("/__auth/login?redirect=" + r.URL.RequestURI())
@@ -604,11 +807,11 @@ func (m *AuthMiddleware) defaultOIDCAuth(w http.ResponseWriter, r *http.Request,
 		log.Printf("Session validation error: %v", err)
 		return policy.Redirect("/__auth/login?redirect=" + r.URL.RequestURI())
 	}
-	if session == nil {
+	if session == nil || !auth.OrgSessionAllowed(session, p.OIDC) {
 		return policy.Redirect("/__auth/login?redirect=" + r.URL.RequestURI())
 	}
 
-	return policy.SuccessWithSession(session.ID, session.UserEmail)
+	return policy.SuccessFromSession(session)
 }
 
 // isInternalEndpoint checks if the path is an internal endpoint that should bypass auth
@@ -754,6 +957,11 @@ func (m *AuthMiddleware) InvalidateAppRateLimitCache(appID string) {
 	}
 }
 
+// DefaultRateLimiter returns the rate limiter used for apps without their own configuration
+func (m *AuthMiddleware) DefaultRateLimiter() *auth.RateLimiter {
+	return m.rateLimiter
+}
+
 // extractSubdomainFromHost extracts the subdomain from a Host header value
 func (m *AuthMiddleware) extractSubdomainFromHost(host string) string {
 	if m.domain == "" {
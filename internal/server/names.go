@@ -0,0 +1,32 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxEntityNameLength is the longest organization or plan name, in characters
+const maxEntityNameLength = 100
+
+// normalizeEntityName trims a display name, collapses runs of whitespace to
+// single spaces and checks it. kind ("Organization", "Plan") prefixes errors.
+func normalizeEntityName(kind, name string) (string, error) {
+	if !utf8.ValidString(name) {
+		return "", fmt.Errorf("%s name must be valid UTF-8", kind)
+	}
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		return "", fmt.Errorf("%s name is required", kind)
+	}
+	if n := utf8.RuneCountInString(name); n > maxEntityNameLength {
+		return "", fmt.Errorf("%s name must be at most %d characters", kind, maxEntityNameLength)
+	}
+	for _, c := range name {
+		if unicode.IsControl(c) || unicode.Is(unicode.Cf, c) {
+			return "", fmt.Errorf("%s name cannot contain control characters", kind)
+		}
+	}
+	return name, nil
+}
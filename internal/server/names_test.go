@@ -0,0 +1,92 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestNormalizeEntityName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"Acme", "Acme", false},
+		{"  Acme  Corp\t", "Acme Corp", false},
+		{"", "", true},
+		{" \t\n", "", true},
+		{"Acme\x00", "", true},
+		{"Ac\u200bme", "", true},
+		{"\xffAcme", "", true},
+		{strings.Repeat("é", maxEntityNameLength), strings.Repeat("é", maxEntityNameLength), false},
+		{strings.Repeat("a", maxEntityNameLength+1), "", true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeEntityName("Organization", tt.name)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("normalizeEntityName(%q) = %q, %v, want %q (error %v)", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestEntityNameUniqueness(t *testing.T) {
+	database := newTestDB(t)
+	s := newTestServer(database)
+
+	call := func(handler func(http.ResponseWriter, *http.Request), body string) int {
+		r := httptest.NewRequest(http.MethodPost, "/admin/", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+
+	if code := call(s.handleCreateOrganization, `{"name":"  Acme  "}`); code != http.StatusOK && code != http.StatusCreated {
+		t.Fatalf("create Acme: status %d", code)
+	}
+	org, _ := database.GetOrganizationByName("Acme")
+	if org == nil {
+		t.Fatal("organization name was not trimmed")
+	}
+	other, err := database.CreateOrganization("Other")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	if code := call(s.handleCreateOrganization, `{"name":"acme"}`); code != http.StatusConflict {
+		t.Errorf("create acme: status %d, want 409", code)
+	}
+	if code := call(s.handleCreateOrganization, `{"name":"bad\u0007name"}`); code != http.StatusBadRequest {
+		t.Errorf("create with control character: status %d, want 400", code)
+	}
+	updateOrg := func(id string) func(http.ResponseWriter, *http.Request) {
+		return func(w http.ResponseWriter, r *http.Request) { s.handleUpdateOrganization(w, r, id) }
+	}
+	if code := call(updateOrg(other.ID), `{"name":"ACME"}`); code != http.StatusConflict {
+		t.Errorf("rename to ACME: status %d, want 409", code)
+	}
+	if code := call(updateOrg(org.ID), `{"name":"ACME"}`); code != http.StatusOK {
+		t.Errorf("recase own name: status %d, want 200", code)
+	}
+
+	if code := call(s.handleCreatePlan, `{"name":"Pro"}`); code != http.StatusOK && code != http.StatusCreated {
+		t.Fatalf("create Pro: status %d", code)
+	}
+	if code := call(s.handleCreatePlan, `{"name":" pro "}`); code != http.StatusConflict {
+		t.Errorf("create pro: status %d, want 409", code)
+	}
+	basic, err := database.CreatePlan(db.CreatePlanInput{Name: "Basic"})
+	if err != nil {
+		t.Fatalf("CreatePlan() error: %v", err)
+	}
+	updatePlan := func(w http.ResponseWriter, r *http.Request) { s.handleUpdatePlan(w, r, basic.ID) }
+	if code := call(updatePlan, `{"name":"PRO"}`); code != http.StatusConflict {
+		t.Errorf("rename plan to PRO: status %d, want 409", code)
+	}
+	if code := call(updatePlan, `{"name":""}`); code != http.StatusBadRequest {
+		t.Errorf("rename plan to empty: status %d, want 400", code)
+	}
+}
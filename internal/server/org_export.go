@@ -0,0 +1,471 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// orgExportVersion is the format version of organization export bundles
+const orgExportVersion = 1
+
+// OrgExport is a portable bundle of an organization's configuration.
+// Secrets (basic auth hashes, OIDC client secrets) are never included; the
+// policy types already omit them from JSON, so they must be set again after import.
+type OrgExport struct {
+	Version      int                   `json:"version"`
+	ExportedAt   time.Time             `json:"exportedAt"`
+	Organization OrgExportInfo         `json:"organization"`
+	Policy       *db.OrgAuthPolicy     `json:"policy,omitempty"`
+	Whitelist    []ExportedWhitelist   `json:"whitelist"`
+	Applications []ExportedApplication `json:"applications"`
+}
+
+// OrgExportInfo holds the exported organization settings
+type OrgExportInfo struct {
+	Name               string                   `json:"name"`
+	RequireTOTP        bool                     `json:"requireTotp"`
+	PlanID             *string                  `json:"planId,omitempty"`
+	PlanName           string                   `json:"planName,omitempty"`
+	AuthFrameAncestors string                   `json:"authFrameAncestors,omitempty"`
+	Branding           *db.OrgBranding          `json:"branding,omitempty"`
+	SessionCookie      *db.OrgSessionCookie     `json:"sessionCookie,omitempty"`
+	LoginSessionLimit  *db.OrgLoginSessionLimit `json:"loginSessionLimit,omitempty"`
+}
+
+// ExportedWhitelist is a whitelist entry without server-specific IDs
+type ExportedWhitelist struct {
+	IPRange     string `json:"ipRange"`
+	Description string `json:"description,omitempty"`
+}
+
+// ExportedApplication is an application with its policy, whitelist and rate limit settings
+type ExportedApplication struct {
+	Subdomain         string                 `json:"subdomain"`
+	Name              string                 `json:"name"`
+	AuthMode          db.AuthMode            `json:"authMode"`
+	AuthType          db.AuthType            `json:"authType,omitempty"`
+	PreserveHost      bool                   `json:"preserveHost,omitempty"`
+	HostHeader        *db.HostHeaderConfig   `json:"hostHeader,omitempty"`
+	MaxHeaderBytes    int                    `json:"maxHeaderBytes,omitempty"`
+	IdentityHeaders   []string               `json:"identityHeaders,omitempty"`
+	StaticResponses   []db.StaticResponse    `json:"staticResponses,omitempty"`
+	ForwardChunked    bool                   `json:"forwardChunked,omitempty"`
+	HTTP2             bool                   `json:"http2,omitempty"`
+	Coalesce          bool                   `json:"coalesce,omitempty"`
+	StreamingMode     bool                   `json:"streamingMode,omitempty"`
+	ForceHTTPS        string                 `json:"forceHttps,omitempty"`
+	HTMLBaseHref      string                 `json:"htmlBaseHref,omitempty"`
+	HTMLRewriteOrigin string                 `json:"htmlRewriteOrigin,omitempty"`
+	Policy            *db.AppAuthPolicy      `json:"policy,omitempty"`
+	Whitelist         []ExportedWhitelist    `json:"whitelist"`
+	RateLimit         *db.AppRateLimitConfig `json:"rateLimit,omitempty"`
+}
+
+// buildOrgExport collects an organization's configuration into an export bundle
+func (s *Server) buildOrgExport(org *db.Organization) (*OrgExport, error) {
+	export := &OrgExport{
+		Version:    orgExportVersion,
+		ExportedAt: time.Now().UTC(),
+		Organization: OrgExportInfo{
+			Name:               org.Name,
+			RequireTOTP:        org.RequireTOTP,
+			PlanID:             org.PlanID,
+			AuthFrameAncestors: org.AuthFrameAncestors,
+		},
+		Whitelist:    []ExportedWhitelist{},
+		Applications: []ExportedApplication{},
+	}
+	if org.Branding != (db.OrgBranding{}) {
+		branding := org.Branding
+		export.Organization.Branding = &branding
+	}
+	if org.SessionCookie != (db.OrgSessionCookie{}) {
+		cookie := org.SessionCookie
+		export.Organization.SessionCookie = &cookie
+	}
+	if org.LoginSessionLimit != (db.OrgLoginSessionLimit{}) {
+		limit := org.LoginSessionLimit
+		export.Organization.LoginSessionLimit = &limit
+	}
+
+	if org.PlanID != nil {
+		plan, err := s.db.GetPlan(*org.PlanID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get plan: %w", err)
+		}
+		if plan != nil {
+			export.Organization.PlanName = plan.Name
+		}
+	}
+
+	policy, err := s.db.GetOrgAuthPolicy(org.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get org policy: %w", err)
+	}
+	export.Policy = policy
+
+	orgWhitelist, err := s.db.ListOrgWhitelist(org.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list org whitelist: %w", err)
+	}
+	for _, entry := range orgWhitelist {
+		export.Whitelist = append(export.Whitelist, ExportedWhitelist{IPRange: entry.IPRange, Description: entry.Description})
+	}
+
+	apps, err := s.db.ListApplicationsByOrg(org.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list applications: %w", err)
+	}
+	for _, app := range apps {
+		exported := ExportedApplication{
+			Subdomain:         app.Subdomain,
+			Name:              app.Name,
+			AuthMode:          app.AuthMode,
+			AuthType:          app.AuthType,
+			PreserveHost:      app.PreserveHost,
+			MaxHeaderBytes:    app.MaxHeaderBytes,
+			IdentityHeaders:   app.IdentityHeaders,
+			StaticResponses:   app.StaticResponses,
+			ForwardChunked:    app.ForwardChunked,
+			HTTP2:             app.HTTP2,
+			Coalesce:          app.Coalesce,
+			StreamingMode:     app.StreamingMode,
+			ForceHTTPS:        app.ForceHTTPS,
+			HTMLBaseHref:      app.HTMLBaseHref,
+			HTMLRewriteOrigin: app.HTMLRewriteOrigin,
+			Whitelist:         []ExportedWhitelist{},
+		}
+		if app.ReleasedAt != nil {
+			// Released applications are exported under the subdomain they had
+			exported.Subdomain = app.ReleasedSubdomain
+		}
+
+		if app.HostHeader.Mode != "" {
+			hostHeader := app.HostHeader
+			exported.HostHeader = &hostHeader
+		}
+
+		if exported.Policy, err = s.db.GetAppAuthPolicy(app.ID); err != nil {
+			return nil, fmt.Errorf("failed to get policy for %s: %w", app.Subdomain, err)
+		}
+		if exported.RateLimit, err = s.db.GetAppRateLimitConfig(app.ID); err != nil {
+			return nil, fmt.Errorf("failed to get rate limit for %s: %w", app.Subdomain, err)
+		}
+
+		appWhitelist, err := s.db.ListAppWhitelist(app.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list whitelist for %s: %w", app.Subdomain, err)
+		}
+		for _, entry := range appWhitelist {
+			exported.Whitelist = append(exported.Whitelist, ExportedWhitelist{IPRange: entry.IPRange, Description: entry.Description})
+		}
+
+		export.Applications = append(export.Applications, exported)
+	}
+
+	return export, nil
+}
+
+// handleExportOrganization returns an organization's configuration as a JSON bundle
+func (s *Server) handleExportOrganization(w http.ResponseWriter, r *http.Request, orgID string) {
+	org, err := s.db.GetOrganizationByID(orgID)
+	if err != nil {
+		log.Printf("Failed to get organization: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if org == nil {
+		jsonError(w, "Organization not found", http.StatusNotFound)
+		return
+	}
+
+	export, err := s.buildOrgExport(org)
+	if err != nil {
+		log.Printf("Failed to export organization %s: %v", orgID, err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="org-%s.json"`, orgID))
+	json.NewEncoder(w).Encode(export)
+}
+
+// handleImportOrganization recreates an exported organization under a new name.
+// Subdomains can be remapped to avoid collisions with existing applications.
+func (s *Server) handleImportOrganization(w http.ResponseWriter, r *http.Request) {
+	if !validateJSONContentType(w, r) {
+		return
+	}
+	limitRequestBody(r)
+
+	var req struct {
+		Name         string            `json:"name"`
+		Bundle       *OrgExport        `json:"bundle"`
+		SubdomainMap map[string]string `json:"subdomainMap,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Bundle == nil {
+		jsonError(w, "Bundle is required", http.StatusBadRequest)
+		return
+	}
+	if req.Bundle.Version != orgExportVersion {
+		jsonError(w, fmt.Sprintf("Unsupported bundle version %d", req.Bundle.Version), http.StatusBadRequest)
+		return
+	}
+	if err := auth.ValidateFrameAncestors(req.Bundle.Organization.AuthFrameAncestors); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if b := req.Bundle.Organization.Branding; b != nil {
+		*b = auth.NormalizeBranding(*b)
+		if err := auth.ValidateBranding(*b); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if c := req.Bundle.Organization.SessionCookie; c != nil {
+		*c = auth.NormalizeSessionCookie(*c)
+		if err := auth.ValidateSessionCookie(*c, s.domain, s.scheme == "https"); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if l := req.Bundle.Organization.LoginSessionLimit; l != nil {
+		if err := validateLoginSessionLimit(*l); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if p := req.Bundle.Policy; p != nil {
+		if err := auth.ValidateAPIKeyRedirectURL(p.APIKeyRedirectURL); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := applyWebhookPolicy(p.AuthType, &p.WebhookURL, &p.WebhookHeaders); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Name == "" {
+		req.Name = req.Bundle.Organization.Name
+	}
+	name, err := normalizeEntityName("Organization", req.Name)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Name = name
+
+	taken, err := s.db.OrganizationNameTaken(req.Name, "")
+	if err != nil {
+		log.Printf("Failed to check organization name: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if taken {
+		jsonError(w, "Organization name already exists", http.StatusConflict)
+		return
+	}
+
+	// Resolve final subdomains and reject the import up front if any collide
+	subdomains := make([]string, len(req.Bundle.Applications))
+	seen := make(map[string]bool)
+	conflicts := make(map[string][]string)
+	for i, app := range req.Bundle.Applications {
+		subdomain := strings.ToLower(app.Subdomain)
+		if mapped, ok := req.SubdomainMap[app.Subdomain]; ok {
+			subdomain = strings.ToLower(mapped)
+		}
+		if err := s.subdomainPolicy.Validate(subdomain); err != nil {
+			jsonError(w, fmt.Sprintf("Invalid subdomain %q: %v", subdomain, err), http.StatusBadRequest)
+			return
+		}
+		if err := validateAppMaxHeaderBytes(app.MaxHeaderBytes); err != nil {
+			jsonError(w, fmt.Sprintf("Application %q: %v", app.Subdomain, err), http.StatusBadRequest)
+			return
+		}
+		if err := validateIdentityHeaders(app.IdentityHeaders); err != nil {
+			jsonError(w, fmt.Sprintf("Application %q: %v", app.Subdomain, err), http.StatusBadRequest)
+			return
+		}
+		if err := validateStaticResponses(app.StaticResponses); err != nil {
+			jsonError(w, fmt.Sprintf("Application %q: %v", app.Subdomain, err), http.StatusBadRequest)
+			return
+		}
+		if err := validateForceHTTPSMode(app.ForceHTTPS); err != nil {
+			jsonError(w, fmt.Sprintf("Application %q: %v", app.Subdomain, err), http.StatusBadRequest)
+			return
+		}
+		if app.HostHeader != nil {
+			if err := validateHostHeader(*app.HostHeader); err != nil {
+				jsonError(w, fmt.Sprintf("Application %q: %v", app.Subdomain, err), http.StatusBadRequest)
+				return
+			}
+		}
+		if app.Policy != nil {
+			if err := auth.ValidateAPIKeyRedirectURL(app.Policy.APIKeyRedirectURL); err != nil {
+				jsonError(w, fmt.Sprintf("Application %q: %v", app.Subdomain, err), http.StatusBadRequest)
+				return
+			}
+			if err := applyWebhookPolicy(app.Policy.AuthType, &app.Policy.WebhookURL, &app.Policy.WebhookHeaders); err != nil {
+				jsonError(w, fmt.Sprintf("Application %q: %v", app.Subdomain, err), http.StatusBadRequest)
+				return
+			}
+		}
+		available, err := s.db.IsSubdomainAvailable(subdomain)
+		if err != nil {
+			log.Printf("Failed to check subdomain: %v", err)
+			jsonError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !available || seen[subdomain] {
+			conflicts[app.Subdomain] = s.suggestSubdomains(subdomain)
+		}
+		seen[subdomain] = true
+		subdomains[i] = subdomain
+	}
+	if len(conflicts) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":     "Subdomains already in use; remap them with subdomainMap",
+			"conflicts": conflicts,
+		})
+		return
+	}
+
+	org, warnings, err := s.importOrganization(req.Name, req.Bundle, subdomains)
+	if err != nil {
+		log.Printf("Failed to import organization %s: %v", req.Name, err)
+		jsonError(w, "Import failed", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Organization imported: %s (%d applications)", org.Name, len(subdomains))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":      true,
+		"organization": org,
+		"warnings":     warnings,
+	})
+}
+
+// importOrganization creates the organization and its applications from a
+// bundle in one transaction
+func (s *Server) importOrganization(name string, bundle *OrgExport, subdomains []string) (*db.Organization, []string, error) {
+	warnings := []string{}
+
+	planID := s.resolveImportPlan(bundle.Organization)
+	if planID == nil && (bundle.Organization.PlanID != nil || bundle.Organization.PlanName != "") {
+		warnings = append(warnings, "Plan not found on this server; organization has no plan")
+	}
+
+	org := &db.Organization{
+		Name:               name,
+		PlanID:             planID,
+		RequireTOTP:        bundle.Organization.RequireTOTP,
+		AuthFrameAncestors: bundle.Organization.AuthFrameAncestors,
+	}
+	if b := bundle.Organization.Branding; b != nil {
+		org.Branding = *b
+	}
+	if c := bundle.Organization.SessionCookie; c != nil {
+		org.SessionCookie = *c
+	}
+	if l := bundle.Organization.LoginSessionLimit; l != nil {
+		org.LoginSessionLimit = *l
+	}
+
+	imp := &db.OrganizationImport{Organization: org}
+	if bundle.Policy != nil {
+		policy := *bundle.Policy
+		imp.Policy = &policy
+		warnings = append(warnings, policySecretWarning("organization", policy.AuthType)...)
+	}
+	for _, entry := range bundle.Whitelist {
+		imp.Whitelist = append(imp.Whitelist, db.OrgWhitelistEntry{IPRange: entry.IPRange, Description: entry.Description})
+	}
+
+	for i, exported := range bundle.Applications {
+		app := &db.Application{
+			Subdomain:         subdomains[i],
+			Name:              exported.Name,
+			AuthMode:          exported.AuthMode,
+			AuthType:          exported.AuthType,
+			PreserveHost:      exported.PreserveHost,
+			MaxHeaderBytes:    exported.MaxHeaderBytes,
+			IdentityHeaders:   exported.IdentityHeaders,
+			StaticResponses:   exported.StaticResponses,
+			ForwardChunked:    exported.ForwardChunked,
+			HTTP2:             exported.HTTP2,
+			Coalesce:          exported.Coalesce,
+			StreamingMode:     exported.StreamingMode,
+			ForceHTTPS:        exported.ForceHTTPS,
+			HTMLBaseHref:      exported.HTMLBaseHref,
+			HTMLRewriteOrigin: exported.HTMLRewriteOrigin,
+		}
+		if exported.HostHeader != nil {
+			app.HostHeader = *exported.HostHeader
+		}
+
+		imported := db.ApplicationImport{Application: app}
+		if exported.Policy != nil {
+			policy := *exported.Policy
+			imported.Policy = &policy
+			warnings = append(warnings, policySecretWarning(app.Subdomain, policy.AuthType)...)
+		}
+		for _, entry := range exported.Whitelist {
+			imported.Whitelist = append(imported.Whitelist, db.AppWhitelistEntry{IPRange: entry.IPRange, Description: entry.Description})
+		}
+		if exported.RateLimit != nil {
+			config := *exported.RateLimit
+			imported.RateLimit = &config
+		}
+		imp.Applications = append(imp.Applications, imported)
+	}
+
+	if err := s.db.ImportOrganization(imp); err != nil {
+		return nil, nil, err
+	}
+	return org, warnings, nil
+}
+
+// resolveImportPlan finds the bundle's plan on this server by ID, then by name
+func (s *Server) resolveImportPlan(info OrgExportInfo) *string {
+	if info.PlanID != nil {
+		if plan, err := s.db.GetPlan(*info.PlanID); err == nil && plan != nil {
+			return &plan.ID
+		}
+	}
+	if info.PlanName != "" {
+		if plan, err := s.db.GetPlanByName(info.PlanName); err == nil && plan != nil {
+			return &plan.ID
+		}
+	}
+	return nil
+}
+
+// policySecretWarning describes the secrets that were not exported for a policy
+func policySecretWarning(target string, authType db.AuthType) []string {
+	switch authType {
+	case db.AuthTypeBasic:
+		return []string{fmt.Sprintf("Basic auth credentials for %s must be set again", target)}
+	case db.AuthTypeOIDC:
+		return []string{fmt.Sprintf("OIDC client secret for %s must be set again", target)}
+	}
+	return nil
+}
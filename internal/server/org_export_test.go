@@ -0,0 +1,137 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestOrgExportImportRoundTrip(t *testing.T) {
+	database := newTestDB(t)
+	s := newTestServer(database)
+	s.scheme = "https"
+
+	plan, err := database.CreatePlan(db.CreatePlanInput{Name: "Pro"})
+	if err != nil {
+		t.Fatalf("CreatePlan() error: %v", err)
+	}
+	org, err := database.CreateOrganizationWithPlan("Acme", &plan.ID)
+	if err != nil {
+		t.Fatalf("CreateOrganizationWithPlan() error: %v", err)
+	}
+	database.UpdateOrganizationTOTPRequirement(org.ID, true)
+	database.UpdateOrganizationBranding(org.ID, db.OrgBranding{ProductName: "Acme Cloud", PrimaryColor: "#112233"})
+	database.CreateOrgAuthPolicy(&db.OrgAuthPolicy{OrgID: org.ID, AuthType: db.AuthTypeBasic, BasicUserHash: "user-hash", BasicPassHash: "pass-hash"})
+	database.AddOrgWhitelist(org.ID, "10.0.0.0/8", "office", "")
+
+	app, err := database.CreateApplication(org.ID, "acme-web", "Web")
+	if err != nil {
+		t.Fatalf("CreateApplication() error: %v", err)
+	}
+	database.UpdateApplication(app.ID, "Web", db.AuthModeCustom, db.AuthTypeOIDC)
+	database.UpdateApplicationHTTP2(app.ID, true)
+	database.UpdateApplicationIdentityHeaders(app.ID, []string{"user", "email"})
+	database.CreateAppAuthPolicy(&db.AppAuthPolicy{
+		AppID: app.ID, AuthType: db.AuthTypeOIDC, OIDCIssuerURL: "https://id.example.com", OIDCClientID: "acme", OIDCClientSecretEnc: "encrypted",
+	})
+	database.AddAppWhitelist(app.ID, "192.0.2.0/24", "partner", "")
+	database.SetAppRateLimitConfig(&db.AppRateLimitConfig{AppID: app.ID, Enabled: true, MaxAttempts: 5, WindowDurationSeconds: 60, BlockDurationSeconds: 300})
+	if _, err := database.CreateApplication(org.ID, "acme-api", "API"); err != nil {
+		t.Fatalf("CreateApplication() error: %v", err)
+	}
+
+	export := func(orgID string) (*OrgExport, string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.handleExportOrganization(w, httptest.NewRequest(http.MethodGet, "/admin/organizations/"+orgID+"/export", nil), orgID)
+		if w.Code != http.StatusOK {
+			t.Fatalf("export status = %d: %s", w.Code, w.Body.String())
+		}
+		var bundle OrgExport
+		if err := json.Unmarshal(w.Body.Bytes(), &bundle); err != nil {
+			t.Fatalf("export body: %v", err)
+		}
+		return &bundle, w.Body.String()
+	}
+	importOrg := func(body any) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		r := httptest.NewRequest(http.MethodPost, "/admin/organizations/import", bytes.NewReader(data))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.handleImportOrganization(w, r)
+		return w
+	}
+
+	original, raw := export(org.ID)
+	for _, secret := range []string{"user-hash", "pass-hash", "encrypted"} {
+		if bytes.Contains([]byte(raw), []byte(secret)) {
+			t.Errorf("export contains secret %q", secret)
+		}
+	}
+
+	// The original's subdomains are taken, so the import is refused until they are remapped
+	if w := importOrg(map[string]any{"name": "Acme Copy", "bundle": original}); w.Code != http.StatusConflict {
+		t.Fatalf("import without remapping = %d, want %d: %s", w.Code, http.StatusConflict, w.Body.String())
+	}
+	w := importOrg(map[string]any{
+		"name":         "Acme Copy",
+		"bundle":       original,
+		"subdomainMap": map[string]string{"acme-web": "copy-web", "acme-api": "copy-api"},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("import status = %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Organization db.Organization `json:"organization"`
+		Warnings     []string        `json:"warnings"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Warnings) != 2 {
+		t.Errorf("import warnings = %q, want the basic auth and OIDC secrets to set again", resp.Warnings)
+	}
+
+	// Exporting the copy gives the same bundle, under the new name and
+	// subdomains, less the IDs and timestamps of the new records
+	normalize := func(bundle *OrgExport) {
+		bundle.ExportedAt = time.Time{}
+		if bundle.Policy != nil {
+			bundle.Policy.OrgID = ""
+		}
+		for i := range bundle.Applications {
+			if p := bundle.Applications[i].Policy; p != nil {
+				p.AppID = ""
+			}
+			if l := bundle.Applications[i].RateLimit; l != nil {
+				l.AppID, l.UpdatedAt = "", time.Time{}
+			}
+		}
+	}
+	copied, _ := export(resp.Organization.ID)
+	want, _ := export(org.ID)
+	normalize(copied)
+	normalize(want)
+	want.Organization.Name = "Acme Copy"
+	for i := range want.Applications {
+		want.Applications[i].Subdomain = strings.Replace(want.Applications[i].Subdomain, "acme-", "copy-", 1)
+	}
+	for _, bundle := range []*OrgExport{copied, want} {
+		sort.Slice(bundle.Applications, func(i, j int) bool { return bundle.Applications[i].Subdomain < bundle.Applications[j].Subdomain })
+	}
+	got, _ := json.MarshalIndent(copied, "", "  ")
+	expected, _ := json.MarshalIndent(want, "", "  ")
+	if !bytes.Equal(got, expected) {
+		t.Errorf("re-exported bundle differs:\ngot  %s\nwant %s", got, expected)
+	}
+
+	// The name is taken now
+	if w := importOrg(map[string]any{"name": "Acme Copy", "bundle": original, "subdomainMap": map[string]string{"acme-web": "third-web", "acme-api": "third-api"}}); w.Code != http.StatusConflict {
+		t.Errorf("import under a taken name = %d, want %d", w.Code, http.StatusConflict)
+	}
+}
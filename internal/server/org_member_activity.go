@@ -0,0 +1,87 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// handleOrgAccountActivity returns a member's tunnel activity within the
+// organization: tunnel counts, the bandwidth of tunnels opened in the last days
+// (default 30, at most 365), when the member was last active, live tunnels and
+// a page of tunnel records (org admin only)
+func (s *Server) handleOrgAccountActivity(w http.ResponseWriter, r *http.Request, orgCtx *OrgContext, accountID string) {
+	if !s.requireOrgAdmin(w, orgCtx) {
+		return
+	}
+
+	account, err := s.verifyOrgAccountOwnership(orgCtx, accountID)
+	if err != nil {
+		log.Printf("Failed to get account: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if account == nil {
+		jsonError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+
+	days := 30
+	if v := r.URL.Query().Get("days"); v != "" {
+		if d, err := parseInt(v); err == nil && d > 0 && d <= 365 {
+			days = d
+		}
+	}
+	since := time.Now().AddDate(0, 0, -days)
+	limit, offset := pageParams(r)
+
+	activity, err := s.db.GetAccountTunnelActivity(account.ID, orgCtx.OrgID, since)
+	if err != nil {
+		log.Printf("Failed to get account activity: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	records, err := s.db.ListAccountTunnelsInOrg(account.ID, orgCtx.OrgID, limit, offset)
+	if err != nil {
+		log.Printf("Failed to list account tunnels: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if records == nil {
+		records = []*db.TunnelRecord{}
+	}
+
+	// The member is active now while a tunnel is open; otherwise the latest of
+	// a token use and a tunnel closing counts
+	var lastActivity *time.Time
+	if activity.ActiveTunnels > 0 {
+		now := time.Now()
+		lastActivity = &now
+	} else {
+		lastActivity = account.LastUsed
+		if closed := activity.LastClosedAt; closed != nil && (lastActivity == nil || closed.After(*lastActivity)) {
+			lastActivity = closed
+		}
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"account": map[string]interface{}{
+			"id":       account.ID,
+			"username": account.Username,
+			"active":   account.Active,
+		},
+		"days":          days,
+		"totalTunnels":  activity.TotalTunnels,
+		"activeTunnels": activity.ActiveTunnels,
+		"bytesSent":     activity.BytesSent,
+		"bytesReceived": activity.BytesReceived,
+		"lastActivity":  lastActivity,
+		"live":          s.accountTunnels(account.ID),
+		"records":       records,
+		"total":         activity.TotalTunnels,
+		"limit":         limit,
+		"offset":        offset,
+	})
+}
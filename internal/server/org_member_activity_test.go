@@ -0,0 +1,71 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestOrgAccountActivity(t *testing.T) {
+	database := newTestDB(t)
+
+	org, _ := database.CreateOrganization("acme")
+	other, _ := database.CreateOrganization("other")
+	otherApp, _ := database.CreateApplication(other.ID, "elsewhere", "elsewhere")
+	member, err := database.CreateOrgAccount("member", auth.HashToken("member"), "", org.ID)
+	if err != nil {
+		t.Fatalf("CreateOrgAccount() error: %v", err)
+	}
+	outsider, _ := database.CreateOrgAccount("outsider", auth.HashToken("outsider"), "", other.ID)
+
+	closed, _ := database.CreateTunnel(member.ID, "old", "1.2.3.4")
+	database.UpdateTunnelStats(closed.ID, 100, 200)
+	database.CloseTunnel(closed.ID)
+	open, _ := database.CreateTunnel(member.ID, "live", "1.2.3.4")
+	database.UpdateTunnelStats(open.ID, 10, 20)
+	foreign, _ := database.CreateTunnel(member.ID, "elsewhere", "1.2.3.4")
+	database.UpdateTunnelAppID(foreign.ID, otherApp.ID)
+	database.UpdateTunnelStats(foreign.ID, 1000, 1000)
+
+	s := newTestServer(database)
+	activity := func(orgCtx *OrgContext, accountID string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.handleOrgAccountActivity(w, httptest.NewRequest(http.MethodGet, "/org/accounts/"+accountID+"/activity", nil), orgCtx, accountID)
+		return w
+	}
+
+	if w := activity(&OrgContext{OrgID: org.ID, AccountID: member.ID}, member.ID); w.Code != http.StatusForbidden {
+		t.Errorf("member: status %d, want 403", w.Code)
+	}
+	admin := &OrgContext{OrgID: org.ID, Username: "boss", IsOrgAdmin: true}
+	if w := activity(admin, outsider.ID); w.Code != http.StatusNotFound {
+		t.Errorf("other org's account: status %d, want 404", w.Code)
+	}
+
+	w := activity(admin, member.ID)
+	var got struct {
+		TotalTunnels  int                `json:"totalTunnels"`
+		ActiveTunnels int                `json:"activeTunnels"`
+		BytesSent     int64              `json:"bytesSent"`
+		BytesReceived int64              `json:"bytesReceived"`
+		LastActivity  *time.Time         `json:"lastActivity"`
+		Records       []*db.TunnelRecord `json:"records"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("decode activity: %v", err)
+	}
+	if got.TotalTunnels != 2 || got.ActiveTunnels != 1 || len(got.Records) != 2 {
+		t.Errorf("activity = %d tunnels (%d active), %d records, want 2 (1 active) without the other org's app", got.TotalTunnels, got.ActiveTunnels, len(got.Records))
+	}
+	if got.BytesSent != 110 || got.BytesReceived != 220 {
+		t.Errorf("bandwidth = %d sent, %d received, want 110 and 220", got.BytesSent, got.BytesReceived)
+	}
+	if got.LastActivity == nil {
+		t.Error("lastActivity = nil, want the member active with an open tunnel")
+	}
+}
@@ -45,20 +45,59 @@ func (s *Server) handleOrg(w http.ResponseWriter, r *http.Request) {
 	case path == "/stats" && r.Method == http.MethodGet:
 		s.handleOrgStats(w, r, orgCtx)
 
+	// Live event stream (Server-Sent Events)
+	case path == "/events" && r.Method == http.MethodGet:
+		s.handleOrgEvents(w, r, orgCtx)
+
 	// Organization policy management
 	case path == "/policy" && r.Method == http.MethodGet:
 		s.handleOrgGetOrgPolicy(w, r, orgCtx)
 	case path == "/policy" && r.Method == http.MethodPut:
 		s.handleOrgSetOrgPolicy(w, r, orgCtx)
+	case path == "/policy/affected-apps" && r.Method == http.MethodGet:
+		s.handleOrgPolicyAffectedApps(w, r, orgCtx)
 
 	// Application management
 	case path == "/applications" && r.Method == http.MethodGet:
 		s.handleOrgListApplications(w, r, orgCtx)
 	case path == "/applications" && r.Method == http.MethodPost:
 		s.handleOrgCreateApplication(w, r, orgCtx)
+	case strings.HasPrefix(path, "/applications/") && strings.HasSuffix(path, "/rules") && r.Method == http.MethodGet:
+		appID := strings.TrimSuffix(strings.TrimPrefix(path, "/applications/"), "/rules")
+		s.handleOrgListRequestRules(w, r, orgCtx, appID)
+	case strings.HasPrefix(path, "/applications/") && strings.HasSuffix(path, "/rules") && r.Method == http.MethodPost:
+		appID := strings.TrimSuffix(strings.TrimPrefix(path, "/applications/"), "/rules")
+		s.handleOrgCreateRequestRule(w, r, orgCtx, appID)
+	case strings.HasPrefix(path, "/applications/") && strings.Contains(path, "/rules/") && r.Method == http.MethodPut:
+		// PUT /applications/:id/rules/:ruleId
+		appID, ruleID, _ := strings.Cut(strings.TrimPrefix(path, "/applications/"), "/rules/")
+		s.handleOrgUpdateRequestRule(w, r, orgCtx, appID, ruleID)
+	case strings.HasPrefix(path, "/applications/") && strings.Contains(path, "/rules/") && r.Method == http.MethodDelete:
+		// DELETE /applications/:id/rules/:ruleId
+		appID, ruleID, _ := strings.Cut(strings.TrimPrefix(path, "/applications/"), "/rules/")
+		s.handleOrgDeleteRequestRule(w, r, orgCtx, appID, ruleID)
+	case strings.HasPrefix(path, "/applications/") && strings.HasSuffix(path, "/static-responses") && r.Method == http.MethodGet:
+		appID := strings.TrimSuffix(strings.TrimPrefix(path, "/applications/"), "/static-responses")
+		s.handleOrgListStaticResponses(w, r, orgCtx, appID)
+	case strings.HasPrefix(path, "/applications/") && strings.HasSuffix(path, "/static-responses") && r.Method == http.MethodPut:
+		appID := strings.TrimSuffix(strings.TrimPrefix(path, "/applications/"), "/static-responses")
+		s.handleOrgSetStaticResponse(w, r, orgCtx, appID)
+	case strings.HasPrefix(path, "/applications/") && strings.HasSuffix(path, "/static-responses") && r.Method == http.MethodDelete:
+		// DELETE /applications/:id/static-responses?path=/status
+		appID := strings.TrimSuffix(strings.TrimPrefix(path, "/applications/"), "/static-responses")
+		s.handleOrgDeleteStaticResponse(w, r, orgCtx, appID)
+	case strings.HasPrefix(path, "/applications/") && strings.HasSuffix(path, "/restore") && r.Method == http.MethodPost:
+		appID := strings.TrimSuffix(strings.TrimPrefix(path, "/applications/"), "/restore")
+		s.handleOrgRestoreApplication(w, r, orgCtx, appID)
 	case strings.HasPrefix(path, "/applications/") && strings.HasSuffix(path, "/stats") && r.Method == http.MethodGet:
 		appID := strings.TrimSuffix(strings.TrimPrefix(path, "/applications/"), "/stats")
 		s.handleOrgAppStats(w, r, orgCtx, appID)
+	case strings.HasPrefix(path, "/applications/") && strings.HasSuffix(path, "/logs/tail") && r.Method == http.MethodGet:
+		appID := strings.TrimSuffix(strings.TrimPrefix(path, "/applications/"), "/logs/tail")
+		s.handleOrgAppLogsTail(w, r, orgCtx, appID)
+	case strings.HasPrefix(path, "/applications/") && strings.HasSuffix(path, "/whitelist-check") && r.Method == http.MethodGet:
+		appID := strings.TrimSuffix(strings.TrimPrefix(path, "/applications/"), "/whitelist-check")
+		s.handleOrgAppWhitelistCheck(w, r, orgCtx, appID)
 	case strings.HasPrefix(path, "/applications/") && strings.HasSuffix(path, "/policy") && r.Method == http.MethodGet:
 		appID := strings.TrimSuffix(strings.TrimPrefix(path, "/applications/"), "/policy")
 		s.handleOrgGetAppPolicy(w, r, orgCtx, appID)
@@ -74,6 +113,12 @@ func (s *Server) handleOrg(w http.ResponseWriter, r *http.Request) {
 	case strings.HasPrefix(path, "/applications/") && strings.HasSuffix(path, "/rate-limit") && r.Method == http.MethodDelete:
 		appID := strings.TrimSuffix(strings.TrimPrefix(path, "/applications/"), "/rate-limit")
 		s.handleOrgDeleteAppRateLimit(w, r, orgCtx, appID)
+	case strings.HasPrefix(path, "/applications/") && strings.HasSuffix(path, "/favicon") && r.Method == http.MethodPut:
+		appID := strings.TrimSuffix(strings.TrimPrefix(path, "/applications/"), "/favicon")
+		s.handleOrgSetAppFavicon(w, r, orgCtx, appID)
+	case strings.HasPrefix(path, "/applications/") && strings.HasSuffix(path, "/favicon") && r.Method == http.MethodDelete:
+		appID := strings.TrimSuffix(strings.TrimPrefix(path, "/applications/"), "/favicon")
+		s.handleOrgDeleteAppFavicon(w, r, orgCtx, appID)
 	case strings.HasPrefix(path, "/applications/") && r.Method == http.MethodGet:
 		appID := strings.TrimPrefix(path, "/applications/")
 		s.handleOrgGetApplication(w, r, orgCtx, appID)
@@ -103,6 +148,8 @@ func (s *Server) handleOrg(w http.ResponseWriter, r *http.Request) {
 		s.handleOrgListAPIKeys(w, r, orgCtx)
 	case path == "/api-keys" && r.Method == http.MethodPost:
 		s.handleOrgCreateAPIKey(w, r, orgCtx)
+	case path == "/api-keys/rotate-all" && r.Method == http.MethodPost:
+		s.handleOrgRotateAllAPIKeys(w, r, orgCtx)
 	case strings.HasPrefix(path, "/api-keys/") && r.Method == http.MethodDelete:
 		keyID := strings.TrimPrefix(path, "/api-keys/")
 		s.handleOrgDeleteAPIKey(w, r, orgCtx, keyID)
@@ -128,6 +175,22 @@ func (s *Server) handleOrg(w http.ResponseWriter, r *http.Request) {
 		s.handleOrgListAccounts(w, r, orgCtx)
 	case path == "/accounts" && r.Method == http.MethodPost:
 		s.handleOrgCreateAccount(w, r, orgCtx)
+	case strings.HasPrefix(path, "/accounts/") && strings.HasSuffix(path, "/tokens") && r.Method == http.MethodGet:
+		accountID := strings.TrimSuffix(strings.TrimPrefix(path, "/accounts/"), "/tokens")
+		s.handleOrgListAccountTokens(w, r, orgCtx, accountID)
+	case strings.HasPrefix(path, "/accounts/") && strings.HasSuffix(path, "/tokens") && r.Method == http.MethodPost:
+		accountID := strings.TrimSuffix(strings.TrimPrefix(path, "/accounts/"), "/tokens")
+		s.handleOrgCreateAccountToken(w, r, orgCtx, accountID)
+	case strings.HasPrefix(path, "/accounts/") && strings.Contains(path, "/tokens/") && r.Method == http.MethodDelete:
+		// DELETE /accounts/:id/tokens/:tokenId
+		accountID, tokenID, _ := strings.Cut(strings.TrimPrefix(path, "/accounts/"), "/tokens/")
+		s.handleOrgRevokeAccountToken(w, r, orgCtx, accountID, tokenID)
+	case strings.HasPrefix(path, "/accounts/") && strings.HasSuffix(path, "/whitelist-check") && r.Method == http.MethodGet:
+		accountID := strings.TrimSuffix(strings.TrimPrefix(path, "/accounts/"), "/whitelist-check")
+		s.handleOrgAccountWhitelistCheck(w, r, orgCtx, accountID)
+	case strings.HasPrefix(path, "/accounts/") && strings.HasSuffix(path, "/activity") && r.Method == http.MethodGet:
+		accountID := strings.TrimSuffix(strings.TrimPrefix(path, "/accounts/"), "/activity")
+		s.handleOrgAccountActivity(w, r, orgCtx, accountID)
 	case strings.HasPrefix(path, "/accounts/") && strings.HasSuffix(path, "/hard") && r.Method == http.MethodDelete:
 		accountID := strings.TrimSuffix(strings.TrimPrefix(path, "/accounts/"), "/hard")
 		s.handleOrgHardDeleteAccount(w, r, orgCtx, accountID)
@@ -159,6 +222,12 @@ func (s *Server) handleOrg(w http.ResponseWriter, r *http.Request) {
 	case path == "/usage/history" && r.Method == http.MethodGet:
 		s.handleOrgGetUsageHistory(w, r, orgCtx)
 
+	// Visitor data export and erasure (org admin only)
+	case path == "/compliance/export" && r.Method == http.MethodGet:
+		s.handleOrgComplianceExport(w, r, orgCtx)
+	case path == "/compliance/erase" && r.Method == http.MethodDelete:
+		s.handleOrgComplianceErase(w, r, orgCtx)
+
 	// Organization settings (org admin only)
 	case path == "/settings" && r.Method == http.MethodGet:
 		s.handleOrgGetSettings(w, r, orgCtx)
@@ -213,6 +282,15 @@ func (s *Server) authenticateOrgAccount(r *http.Request) (*OrgContext, error) {
 	if err != nil || account == nil {
 		return nil, err
 	}
+	// Tokens issued before the account moved to another organization don't
+	// grant access to the old one
+	if account.OrgID != claims.OrgID {
+		return nil, nil
+	}
+	revoked, err := s.dashboardSessionRevoked(claims)
+	if err != nil || revoked {
+		return nil, err
+	}
 
 	return &OrgContext{
 		AccountID:  claims.AccountID,
@@ -265,6 +343,14 @@ func (s *Server) handleOrgStats(w http.ResponseWriter, r *http.Request, orgCtx *
 	activeTunnels := s.GetActiveTunnelsByOrg(orgCtx.OrgID)
 	stats["liveTunnels"] = len(activeTunnels)
 
+	// Forwarded requests in flight, against the plan's cap if it sets one
+	stats["inFlightRequests"] = s.inFlight.current(orgCtx.OrgID)
+	if s.quotaChecker != nil {
+		if max := s.quotaChecker.MaxConcurrentRequests(orgCtx.OrgID); max > 0 {
+			stats["maxConcurrentRequests"] = max
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stats)
 }
@@ -287,6 +373,57 @@ func (s *Server) handleOrgGetOrgPolicy(w http.ResponseWriter, r *http.Request, o
 	})
 }
 
+// PolicyAffectedApp summarizes an application for the org policy blast radius
+type PolicyAffectedApp struct {
+	ID        string      `json:"id"`
+	Name      string      `json:"name"`
+	Subdomain string      `json:"subdomain"`
+	AuthMode  db.AuthMode `json:"authMode"`
+}
+
+// handleOrgPolicyAffectedApps groups the org's applications by whether a change to
+// the org policy applies to them. Custom apps without a policy of their own fall
+// back to the org policy, so they are listed as inheriting.
+func (s *Server) handleOrgPolicyAffectedApps(w http.ResponseWriter, r *http.Request, orgCtx *OrgContext) {
+	apps, err := s.db.ListApplicationsByOrg(orgCtx.OrgID)
+	if err != nil {
+		log.Printf("Failed to list org apps: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	inherit := []PolicyAffectedApp{}
+	custom := []PolicyAffectedApp{}
+	disabled := []PolicyAffectedApp{}
+	for _, app := range apps {
+		entry := PolicyAffectedApp{ID: app.ID, Name: app.Name, Subdomain: app.Subdomain, AuthMode: app.AuthMode}
+		switch app.AuthMode {
+		case db.AuthModeDisabled:
+			disabled = append(disabled, entry)
+		case db.AuthModeCustom:
+			appPolicy, err := s.db.GetAppAuthPolicy(app.ID)
+			if err != nil {
+				log.Printf("Failed to get app policy: %v", err)
+				jsonError(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if appPolicy == nil {
+				inherit = append(inherit, entry)
+			} else {
+				custom = append(custom, entry)
+			}
+		default:
+			inherit = append(inherit, entry)
+		}
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"inherit":  inherit,
+		"custom":   custom,
+		"disabled": disabled,
+	})
+}
+
 func (s *Server) handleOrgSetOrgPolicy(w http.ResponseWriter, r *http.Request, orgCtx *OrgContext) {
 	if !validateOrgJSONRequest(w, r) {
 		return
@@ -295,6 +432,7 @@ func (s *Server) handleOrgSetOrgPolicy(w http.ResponseWriter, r *http.Request, o
 	var req struct {
 		AuthType             string            `json:"authType"`
 		APIKeyEnabled        bool              `json:"apiKeyEnabled"`
+		APIKeyRedirectURL    string            `json:"apiKeyRedirectUrl,omitempty"`
 		BasicUsername        string            `json:"basicUsername,omitempty"`
 		BasicPassword        string            `json:"basicPassword,omitempty"`
 		BasicSessionDuration int               `json:"basicSessionDuration,omitempty"` // Hours, 0 = default (24h)
@@ -304,6 +442,8 @@ func (s *Server) handleOrgSetOrgPolicy(w http.ResponseWriter, r *http.Request, o
 		OIDCScopes           []string          `json:"oidcScopes,omitempty"`
 		OIDCAllowedDomains   []string          `json:"oidcAllowedDomains,omitempty"`
 		OIDCRequiredClaims   map[string]string `json:"oidcRequiredClaims,omitempty"`
+		WebhookURL           string            `json:"webhookUrl,omitempty"`
+		WebhookHeaders       []string          `json:"webhookHeaders,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -313,21 +453,27 @@ func (s *Server) handleOrgSetOrgPolicy(w http.ResponseWriter, r *http.Request, o
 
 	// Validate auth type
 	authType := db.AuthType(req.AuthType)
-	if authType != db.AuthTypeBasic && authType != db.AuthTypeAPIKey && authType != db.AuthTypeOIDC {
+	if authType != db.AuthTypeBasic && authType != db.AuthTypeAPIKey && authType != db.AuthTypeOIDC && authType != db.AuthTypeWebhook {
 		jsonError(w, "Invalid auth type", http.StatusBadRequest)
 		return
 	}
 
 	// API key add-on is only valid with Basic or OIDC
-	if req.APIKeyEnabled && authType == db.AuthTypeAPIKey {
+	if req.APIKeyEnabled && (authType == db.AuthTypeAPIKey || authType == db.AuthTypeWebhook) {
 		jsonError(w, "API key add-on is only valid with Basic or OIDC auth types", http.StatusBadRequest)
 		return
 	}
 
 	policy := &db.OrgAuthPolicy{
-		OrgID:         orgCtx.OrgID,
-		AuthType:      authType,
-		APIKeyEnabled: req.APIKeyEnabled,
+		OrgID:          orgCtx.OrgID,
+		AuthType:       authType,
+		APIKeyEnabled:  req.APIKeyEnabled,
+		WebhookURL:     req.WebhookURL,
+		WebhookHeaders: req.WebhookHeaders,
+	}
+	if err := applyWebhookPolicy(authType, &policy.WebhookURL, &policy.WebhookHeaders); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	switch authType {
@@ -360,6 +506,13 @@ func (s *Server) handleOrgSetOrgPolicy(w http.ResponseWriter, r *http.Request, o
 		policy.BasicPassHash = passHash
 		policy.BasicSessionDuration = req.BasicSessionDuration
 
+	case db.AuthTypeAPIKey:
+		if err := auth.ValidateAPIKeyRedirectURL(req.APIKeyRedirectURL); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		policy.APIKeyRedirectURL = req.APIKeyRedirectURL
+
 	case db.AuthTypeOIDC:
 		if req.OIDCIssuerURL == "" || req.OIDCClientID == "" {
 			jsonError(w, "OIDC requires issuer URL and client ID", http.StatusBadRequest)
@@ -430,6 +583,8 @@ func (s *Server) handleOrgListApplications(w http.ResponseWriter, r *http.Reques
 			"hasPolicy":         hasPolicy,
 			"isActive":          activeCount > 0,
 			"activeTunnelCount": activeCount,
+			"releasedAt":        app.ReleasedAt,
+			"releasedSubdomain": app.ReleasedSubdomain,
 		}
 		if tunnelStats != nil {
 			result[i]["stats"] = tunnelStats
@@ -468,6 +623,8 @@ func (s *Server) handleOrgGetApplication(w http.ResponseWriter, r *http.Request,
 		"hasPolicy":         hasPolicy,
 		"isActive":          activeCount > 0,
 		"activeTunnelCount": activeCount,
+		"releasedAt":        app.ReleasedAt,
+		"releasedSubdomain": app.ReleasedSubdomain,
 	}
 	if tunnelStats != nil {
 		result["stats"] = tunnelStats
@@ -499,6 +656,12 @@ func (s *Server) handleOrgCreateApplication(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	req.Subdomain = strings.ToLower(req.Subdomain)
+	if err := s.subdomainPolicy.Validate(req.Subdomain); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Check subdomain availability
 	available, err := s.db.IsSubdomainAvailable(req.Subdomain)
 	if err != nil {
@@ -543,16 +706,33 @@ func (s *Server) handleOrgUpdateApplication(w http.ResponseWriter, r *http.Reque
 		jsonError(w, "Application not found", http.StatusNotFound)
 		return
 	}
+	if app.ReleasedAt != nil {
+		jsonError(w, "Application was released; restore it first", http.StatusConflict)
+		return
+	}
 
 	if !validateOrgJSONRequest(w, r) {
 		return
 	}
 
 	var req struct {
-		Name      string `json:"name"`
-		Subdomain string `json:"subdomain"`
-		AuthMode  string `json:"authMode"`
-		AuthType  string `json:"authType,omitempty"`
+		Name            string               `json:"name"`
+		Subdomain       string               `json:"subdomain"`
+		AuthMode        string               `json:"authMode"`
+		AuthType        string               `json:"authType,omitempty"`
+		PreserveHost    *bool                `json:"preserveHost,omitempty"`
+		HostHeader      *db.HostHeaderConfig `json:"hostHeader,omitempty"`      // {} inherits the server's host_header setting
+		MaxHeaderBytes  *int                 `json:"maxHeaderBytes,omitempty"`  // 0 resets to the server default
+		IdentityHeaders *[]string            `json:"identityHeaders,omitempty"` // [] stops forwarding identity headers
+		ForwardChunked  *bool                `json:"forwardChunked,omitempty"`
+		HTTP2           *bool                `json:"http2,omitempty"`
+		Coalesce        *bool                `json:"coalesce,omitempty"`
+		StreamingMode   *bool                `json:"streamingMode,omitempty"`
+		ForceHTTPS      *string              `json:"forceHttps,omitempty"` // "" inherits the server's force_https setting
+
+		// Experimental HTML transform; "" turns a setting off
+		HTMLBaseHref      *string `json:"htmlBaseHref,omitempty"`
+		HTMLRewriteOrigin *string `json:"htmlRewriteOrigin,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -560,6 +740,48 @@ func (s *Server) handleOrgUpdateApplication(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	if req.MaxHeaderBytes != nil {
+		if err := validateAppMaxHeaderBytes(*req.MaxHeaderBytes); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if req.IdentityHeaders != nil {
+		if err := validateIdentityHeaders(*req.IdentityHeaders); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if req.HostHeader != nil {
+		if err := validateHostHeader(*req.HostHeader); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if req.ForceHTTPS != nil {
+		if err := validateForceHTTPSMode(*req.ForceHTTPS); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if req.HTMLBaseHref != nil {
+		if err := validateHTMLBaseHref(*req.HTMLBaseHref); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if req.HTMLRewriteOrigin != nil {
+		if err := validateHTMLRewriteOrigin(*req.HTMLRewriteOrigin); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Validate auth mode
 	authMode := db.AuthMode(req.AuthMode)
 	if authMode != db.AuthModeInherit && authMode != db.AuthModeDisabled && authMode != db.AuthModeCustom {
@@ -568,9 +790,14 @@ func (s *Server) handleOrgUpdateApplication(w http.ResponseWriter, r *http.Reque
 	}
 
 	// If subdomain is provided and different, use UpdateApplicationFull
-	subdomain := req.Subdomain
+	subdomain := strings.ToLower(req.Subdomain)
 	if subdomain == "" {
 		subdomain = app.Subdomain
+	} else if subdomain != app.Subdomain {
+		if err := s.subdomainPolicy.Validate(subdomain); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 	}
 
 	authType := db.AuthType(req.AuthType)
@@ -584,6 +811,94 @@ func (s *Server) handleOrgUpdateApplication(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	if req.PreserveHost != nil {
+		if err := s.db.UpdateApplicationPreserveHost(appID, *req.PreserveHost); err != nil {
+			log.Printf("Failed to update application preserve host: %v", err)
+			jsonError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if req.HostHeader != nil {
+		if err := s.db.UpdateApplicationHostHeader(appID, *req.HostHeader); err != nil {
+			log.Printf("Failed to update application host header: %v", err)
+			jsonError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if req.MaxHeaderBytes != nil {
+		if err := s.db.UpdateApplicationMaxHeaderBytes(appID, *req.MaxHeaderBytes); err != nil {
+			log.Printf("Failed to update application max header bytes: %v", err)
+			jsonError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if req.IdentityHeaders != nil {
+		if err := s.db.UpdateApplicationIdentityHeaders(appID, *req.IdentityHeaders); err != nil {
+			log.Printf("Failed to update application identity headers: %v", err)
+			jsonError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if req.ForwardChunked != nil {
+		if err := s.db.UpdateApplicationForwardChunked(appID, *req.ForwardChunked); err != nil {
+			log.Printf("Failed to update application forward chunked: %v", err)
+			jsonError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if req.HTTP2 != nil {
+		if err := s.db.UpdateApplicationHTTP2(appID, *req.HTTP2); err != nil {
+			log.Printf("Failed to update application http2: %v", err)
+			jsonError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if req.Coalesce != nil {
+		if err := s.db.UpdateApplicationCoalesce(appID, *req.Coalesce); err != nil {
+			log.Printf("Failed to update application coalesce: %v", err)
+			jsonError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if req.StreamingMode != nil {
+		if err := s.db.UpdateApplicationStreamingMode(appID, *req.StreamingMode); err != nil {
+			log.Printf("Failed to update application streaming mode: %v", err)
+			jsonError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if req.ForceHTTPS != nil {
+		if err := s.db.UpdateApplicationForceHTTPS(appID, *req.ForceHTTPS); err != nil {
+			log.Printf("Failed to update application force https: %v", err)
+			jsonError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if req.HTMLBaseHref != nil {
+		if err := s.db.UpdateApplicationHTMLBaseHref(appID, *req.HTMLBaseHref); err != nil {
+			log.Printf("Failed to update application html base href: %v", err)
+			jsonError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if req.HTMLRewriteOrigin != nil {
+		if err := s.db.UpdateApplicationHTMLRewriteOrigin(appID, *req.HTMLRewriteOrigin); err != nil {
+			log.Printf("Failed to update application html rewrite origin: %v", err)
+			jsonError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// Invalidate policy cache for both old and new subdomains
 	if s.authMiddleware != nil {
 		s.authMiddleware.InvalidateSubdomainCache(app.Subdomain)
@@ -613,9 +928,6 @@ func (s *Server) handleOrgDeleteApplication(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Delete app policy first
-	s.db.DeleteAppAuthPolicy(appID)
-
 	if err := s.db.DeleteApplication(appID); err != nil {
 		log.Printf("Failed to delete application: %v", err)
 		jsonError(w, "Internal server error", http.StatusInternalServerError)
@@ -711,6 +1023,7 @@ func (s *Server) handleOrgSetAppPolicy(w http.ResponseWriter, r *http.Request, o
 	var req struct {
 		AuthType             string            `json:"authType"`
 		APIKeyEnabled        bool              `json:"apiKeyEnabled"`
+		APIKeyRedirectURL    string            `json:"apiKeyRedirectUrl,omitempty"`
 		BasicUsername        string            `json:"basicUsername,omitempty"`
 		BasicPassword        string            `json:"basicPassword,omitempty"`
 		BasicSessionDuration int               `json:"basicSessionDuration,omitempty"` // Hours, 0 = default (24h)
@@ -720,6 +1033,8 @@ func (s *Server) handleOrgSetAppPolicy(w http.ResponseWriter, r *http.Request, o
 		OIDCScopes           []string          `json:"oidcScopes,omitempty"`
 		OIDCAllowedDomains   []string          `json:"oidcAllowedDomains,omitempty"`
 		OIDCRequiredClaims   map[string]string `json:"oidcRequiredClaims,omitempty"`
+		WebhookURL           string            `json:"webhookUrl,omitempty"`
+		WebhookHeaders       []string          `json:"webhookHeaders,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -729,21 +1044,27 @@ func (s *Server) handleOrgSetAppPolicy(w http.ResponseWriter, r *http.Request, o
 
 	// Validate auth type
 	authType := db.AuthType(req.AuthType)
-	if authType != db.AuthTypeBasic && authType != db.AuthTypeAPIKey && authType != db.AuthTypeOIDC {
+	if authType != db.AuthTypeBasic && authType != db.AuthTypeAPIKey && authType != db.AuthTypeOIDC && authType != db.AuthTypeWebhook {
 		jsonError(w, "Invalid auth type", http.StatusBadRequest)
 		return
 	}
 
 	// API key add-on is only valid with Basic or OIDC
-	if req.APIKeyEnabled && authType == db.AuthTypeAPIKey {
+	if req.APIKeyEnabled && (authType == db.AuthTypeAPIKey || authType == db.AuthTypeWebhook) {
 		jsonError(w, "API key add-on is only valid with Basic or OIDC auth types", http.StatusBadRequest)
 		return
 	}
 
 	policy := &db.AppAuthPolicy{
-		AppID:         appID,
-		AuthType:      authType,
-		APIKeyEnabled: req.APIKeyEnabled,
+		AppID:          appID,
+		AuthType:       authType,
+		APIKeyEnabled:  req.APIKeyEnabled,
+		WebhookURL:     req.WebhookURL,
+		WebhookHeaders: req.WebhookHeaders,
+	}
+	if err := applyWebhookPolicy(authType, &policy.WebhookURL, &policy.WebhookHeaders); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	switch authType {
@@ -776,6 +1097,13 @@ func (s *Server) handleOrgSetAppPolicy(w http.ResponseWriter, r *http.Request, o
 		policy.BasicPassHash = passHash
 		policy.BasicSessionDuration = req.BasicSessionDuration
 
+	case db.AuthTypeAPIKey:
+		if err := auth.ValidateAPIKeyRedirectURL(req.APIKeyRedirectURL); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		policy.APIKeyRedirectURL = req.APIKeyRedirectURL
+
 	case db.AuthTypeOIDC:
 		if req.OIDCIssuerURL == "" || req.OIDCClientID == "" {
 			jsonError(w, "OIDC requires issuer URL and client ID", http.StatusBadRequest)
@@ -845,7 +1173,7 @@ func (s *Server) handleOrgGetAppRateLimit(w http.ResponseWriter, r *http.Request
 	}
 
 	// Get default values
-	defaultMax, defaultWindow, defaultBlock := db.DefaultRateLimitValues()
+	defaultMax, defaultWindow, defaultBlock := s.defaultRateLimitValues()
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -1192,6 +1520,8 @@ func (s *Server) handleOrgCreateAPIKey(w http.ResponseWriter, r *http.Request, o
 		AppID       string `json:"appId,omitempty"`
 		Description string `json:"description"`
 		ExpiresIn   *int   `json:"expiresIn,omitempty"` // days
+
+		RateLimitTier string `json:"rateLimitTier,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1199,6 +1529,16 @@ func (s *Server) handleOrgCreateAPIKey(w http.ResponseWriter, r *http.Request, o
 		return
 	}
 
+	if req.RateLimitTier != "" && !db.IsValidRateLimitTier(req.RateLimitTier) {
+		jsonError(w, "rateLimitTier must be one of standard, elevated, exempt", http.StatusBadRequest)
+		return
+	}
+	// Exempt keys skip auth rate limiting entirely, so only server admins grant them
+	if req.RateLimitTier == db.RateLimitTierExempt {
+		jsonError(w, "Only server admins can create exempt API keys", http.StatusForbidden)
+		return
+	}
+
 	var expiresAt *time.Time
 	if req.ExpiresIn != nil && *req.ExpiresIn > 0 {
 		exp := time.Now().Add(time.Duration(*req.ExpiresIn) * 24 * time.Hour)
@@ -1229,6 +1569,9 @@ func (s *Server) handleOrgCreateAPIKey(w http.ResponseWriter, r *http.Request, o
 		jsonError(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	if req.RateLimitTier != "" {
+		key.RateLimitTier = req.RateLimitTier
+	}
 
 	if err := s.db.CreateAPIKey(key); err != nil {
 		log.Printf("Failed to create API key: %v", err)
@@ -1246,6 +1589,81 @@ func (s *Server) handleOrgCreateAPIKey(w http.ResponseWriter, r *http.Request, o
 	})
 }
 
+// RotatedAPIKey is an API key revoked by a bulk rotation and its replacement.
+// Key and RawKey are empty for expired keys, which are revoked without replacement.
+type RotatedAPIKey struct {
+	OldKeyID     string     `json:"oldKeyId"`
+	OldKeyPrefix string     `json:"oldKeyPrefix"`
+	Key          *db.APIKey `json:"key,omitempty"`
+	RawKey       string     `json:"rawKey,omitempty"`
+}
+
+// handleOrgRotateAllAPIKeys revokes all of the org's API keys and issues replacements with
+// the same application, description, expiry and rate limit tier. With dryRun=true it only
+// lists the keys that would be rotated.
+func (s *Server) handleOrgRotateAllAPIKeys(w http.ResponseWriter, r *http.Request, orgCtx *OrgContext) {
+	if !s.requireOrgAdmin(w, orgCtx) {
+		return
+	}
+
+	keys, err := s.db.ListAPIKeysByOrg(orgCtx.OrgID)
+	if err != nil {
+		log.Printf("Failed to list API keys: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if keys == nil {
+		keys = []*db.APIKey{}
+	}
+
+	if r.URL.Query().Get("dryRun") == "true" {
+		jsonResponse(w, map[string]interface{}{
+			"dryRun": true,
+			"keys":   keys,
+		})
+		return
+	}
+
+	now := time.Now()
+	oldIDs := make([]string, 0, len(keys))
+	var replacements []*db.APIKey
+	rotated := make([]RotatedAPIKey, 0, len(keys))
+	for _, old := range keys {
+		oldIDs = append(oldIDs, old.ID)
+		entry := RotatedAPIKey{OldKeyID: old.ID, OldKeyPrefix: old.KeyPrefix}
+		if old.ExpiresAt == nil || old.ExpiresAt.After(now) {
+			rawKey, key, err := db.GenerateAPIKey(old.OrgID, old.AppID, old.Description, old.ExpiresAt)
+			if err != nil {
+				log.Printf("Failed to generate API key: %v", err)
+				jsonError(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			key.RateLimitTier = old.RateLimitTier
+			replacements = append(replacements, key)
+			entry.Key, entry.RawKey = key, rawKey
+		}
+		rotated = append(rotated, entry)
+	}
+
+	if err := s.db.ReplaceAPIKeys(oldIDs, replacements); err != nil {
+		log.Printf("Failed to rotate API keys: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	orgID := orgCtx.OrgID
+	target := fmt.Sprintf("%d API keys", len(keys))
+	if err := s.db.LogAdminAction(&orgID, db.AuditTypeAPIKeysRotated, auth.GetClientIP(r), orgCtx.Username, target); err != nil {
+		log.Printf("Failed to audit API key rotation: %v", err)
+	}
+	log.Printf("Org API keys rotated: %d keys (%d replaced) for org %s by %s", len(keys), len(replacements), orgID, orgCtx.Username)
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"rotated": rotated,
+	})
+}
+
 func (s *Server) handleOrgDeleteAPIKey(w http.ResponseWriter, r *http.Request, orgCtx *OrgContext, keyID string) {
 	// Get key to verify ownership
 	key, err := s.db.GetAPIKeyByID(keyID)
@@ -1318,10 +1736,12 @@ func (s *Server) GetActiveTunnelsByOrg(orgID string) []map[string]interface{} {
 	for subdomain, tunnel := range s.tunnels {
 		if tunnel.OrgID == orgID {
 			tunnels = append(tunnels, map[string]interface{}{
-				"subdomain": subdomain,
-				"url":       strings.Join([]string{s.scheme, "://", subdomain, ".", s.domain}, ""),
-				"createdAt": tunnel.CreatedAt,
-				"appId":     tunnel.AppID,
+				"subdomain":         subdomain,
+				"url":               strings.Join([]string{s.scheme, "://", subdomain, ".", s.domain}, ""),
+				"createdAt":         tunnel.CreatedAt,
+				"appId":             tunnel.AppID,
+				"maxBytesPerSecond": tunnel.limiter.Rate(),
+				"degraded":          tunnel.degraded.Load(),
 			})
 		}
 	}
@@ -1337,9 +1757,11 @@ func (s *Server) GetActiveTunnelsByApp(appID string) []map[string]interface{} {
 	for subdomain, tunnel := range s.tunnels {
 		if tunnel.AppID == appID {
 			tunnels = append(tunnels, map[string]interface{}{
-				"subdomain": subdomain,
-				"url":       strings.Join([]string{s.scheme, "://", subdomain, ".", s.domain}, ""),
-				"createdAt": tunnel.CreatedAt,
+				"subdomain":         subdomain,
+				"url":               strings.Join([]string{s.scheme, "://", subdomain, ".", s.domain}, ""),
+				"createdAt":         tunnel.CreatedAt,
+				"maxBytesPerSecond": tunnel.limiter.Rate(),
+				"degraded":          tunnel.degraded.Load(),
 			})
 		}
 	}
@@ -1415,14 +1837,18 @@ func (s *Server) handleOrgGetMyAccount(w http.ResponseWriter, r *http.Request, o
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"account": map[string]interface{}{
-			"id":          account.ID,
-			"username":    account.Username,
-			"isOrgAdmin":  account.IsOrgAdmin,
-			"totpEnabled": account.TOTPEnabled,
-			"createdAt":   account.CreatedAt,
-			"lastUsed":    account.LastUsed,
-			"active":      account.Active,
-			"hasPassword": account.PasswordHash != "",
+			"id":                account.ID,
+			"username":          account.Username,
+			"isOrgAdmin":        account.IsOrgAdmin,
+			"totpEnabled":       account.TOTPEnabled,
+			"createdAt":         account.CreatedAt,
+			"lastUsed":          account.LastUsed,
+			"active":            account.Active,
+			"tokenExpiresAt":    account.TokenExpiresAt,
+			"tokenExpiringSoon": account.IsTokenExpiringSoon(tokenExpiryWarningWindow),
+			"tokenExpired":      account.IsTokenExpired(),
+			"hasPassword":       account.PasswordHash != "",
+			"defaultSubdomain":  account.DefaultSubdomain,
 		},
 	})
 }
@@ -1434,7 +1860,8 @@ func (s *Server) handleOrgUpdateMyAccount(w http.ResponseWriter, r *http.Request
 	}
 
 	var req struct {
-		Username string `json:"username"`
+		Username         string  `json:"username"`
+		DefaultSubdomain *string `json:"defaultSubdomain"` // "" clears it
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1442,6 +1869,28 @@ func (s *Server) handleOrgUpdateMyAccount(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	var defaultSubdomain string
+	if req.DefaultSubdomain != nil {
+		defaultSubdomain = strings.ToLower(strings.TrimSpace(*req.DefaultSubdomain))
+		if defaultSubdomain != "" {
+			if err := s.subdomainPolicy.Validate(defaultSubdomain); err != nil {
+				jsonError(w, fmt.Sprintf("Invalid default subdomain: %v", err), http.StatusBadRequest)
+				return
+			}
+			// Application subdomains are only served to their app's tunnels
+			available, err := s.db.IsSubdomainAvailable(defaultSubdomain)
+			if err != nil {
+				log.Printf("Failed to check subdomain availability: %v", err)
+				jsonError(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if !available {
+				jsonError(w, "Default subdomain is used by an application", http.StatusConflict)
+				return
+			}
+		}
+	}
+
 	if req.Username != "" {
 		// Check if username is taken by another account
 		existing, err := s.db.GetAccountByUsername(req.Username)
@@ -1462,6 +1911,14 @@ func (s *Server) handleOrgUpdateMyAccount(w http.ResponseWriter, r *http.Request
 		}
 	}
 
+	if req.DefaultSubdomain != nil {
+		if err := s.db.UpdateAccountDefaultSubdomain(orgCtx.AccountID, defaultSubdomain); err != nil {
+			log.Printf("Failed to update default subdomain: %v", err)
+			jsonError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	log.Printf("Org user %s updated their account", orgCtx.Username)
 
 	w.Header().Set("Content-Type", "application/json")
@@ -1514,7 +1971,7 @@ func (s *Server) handleOrgSetMyPassword(w http.ResponseWriter, r *http.Request,
 // handleOrgGetMyTOTPSetup generates a new TOTP secret for the current user
 func (s *Server) handleOrgGetMyTOTPSetup(w http.ResponseWriter, r *http.Request, orgCtx *OrgContext) {
 	// Generate TOTP secret
-	totpKey, err := auth.GenerateTOTPSecret(orgCtx.Username)
+	totpKey, err := s.generateTOTPSecret(orgCtx.Username)
 	if err != nil {
 		log.Printf("Failed to generate TOTP secret: %v", err)
 		jsonError(w, "Failed to generate TOTP", http.StatusInternalServerError)
@@ -1530,7 +1987,7 @@ func (s *Server) handleOrgGetMyTOTPSetup(w http.ResponseWriter, r *http.Request,
 	}
 
 	// Store the secret (not enabled until verified)
-	if err := s.db.UpdateAccountTOTP(orgCtx.AccountID, encryptedSecret, false); err != nil {
+	if err := s.db.BeginAccountTOTPSetup(orgCtx.AccountID, encryptedSecret); err != nil {
 		log.Printf("Failed to store TOTP secret: %v", err)
 		jsonError(w, "Failed to setup TOTP", http.StatusInternalServerError)
 		return
@@ -1589,6 +2046,15 @@ func (s *Server) handleOrgEnableMyTOTP(w http.ResponseWriter, r *http.Request, o
 		return
 	}
 
+	if expired, err := s.totpSetupExpired(account); err != nil {
+		log.Printf("Failed to check TOTP setup: %v", err)
+		jsonError(w, "Failed to verify TOTP", http.StatusInternalServerError)
+		return
+	} else if expired {
+		jsonError(w, "TOTP setup expired. Call GET /accounts/me/totp/setup again", http.StatusBadRequest)
+		return
+	}
+
 	// Decrypt the TOTP secret
 	secret, err := auth.DecryptTOTPSecret(account.TOTPSecret)
 	if err != nil {
@@ -1697,8 +2163,9 @@ func (s *Server) handleOrgDisableMyTOTP(w http.ResponseWriter, r *http.Request,
 		s.loginRateLimiter.RecordSuccess(rateLimitKey)
 	}
 
-	// Disable TOTP
-	if err := s.db.UpdateAccountTOTP(orgCtx.AccountID, "", false); err != nil {
+	// Disable TOTP like a reset, so an admin gets the same re-enrollment grace
+	// period instead of password-only logins for good
+	if _, err := s.db.ResetAccountTOTP(orgCtx.AccountID); err != nil {
 		log.Printf("Failed to disable TOTP: %v", err)
 		jsonError(w, "Failed to disable TOTP", http.StatusInternalServerError)
 		return
@@ -1728,14 +2195,17 @@ func (s *Server) handleOrgListAccounts(w http.ResponseWriter, r *http.Request, o
 	result := make([]map[string]interface{}, len(accounts))
 	for i, acc := range accounts {
 		result[i] = map[string]interface{}{
-			"id":          acc.ID,
-			"username":    acc.Username,
-			"isOrgAdmin":  acc.IsOrgAdmin,
-			"totpEnabled": acc.TOTPEnabled,
-			"createdAt":   acc.CreatedAt,
-			"lastUsed":    acc.LastUsed,
-			"active":      acc.Active,
-			"hasPassword": acc.PasswordHash != "",
+			"id":                acc.ID,
+			"username":          acc.Username,
+			"isOrgAdmin":        acc.IsOrgAdmin,
+			"totpEnabled":       acc.TOTPEnabled,
+			"createdAt":         acc.CreatedAt,
+			"lastUsed":          acc.LastUsed,
+			"active":            acc.Active,
+			"tokenExpiresAt":    acc.TokenExpiresAt,
+			"tokenExpiringSoon": acc.IsTokenExpiringSoon(tokenExpiryWarningWindow),
+			"tokenExpired":      acc.IsTokenExpired(),
+			"hasPassword":       acc.PasswordHash != "",
 		}
 	}
 
@@ -1765,14 +2235,17 @@ func (s *Server) handleOrgGetAccount(w http.ResponseWriter, r *http.Request, org
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"account": map[string]interface{}{
-			"id":          account.ID,
-			"username":    account.Username,
-			"isOrgAdmin":  account.IsOrgAdmin,
-			"totpEnabled": account.TOTPEnabled,
-			"createdAt":   account.CreatedAt,
-			"lastUsed":    account.LastUsed,
-			"active":      account.Active,
-			"hasPassword": account.PasswordHash != "",
+			"id":                account.ID,
+			"username":          account.Username,
+			"isOrgAdmin":        account.IsOrgAdmin,
+			"totpEnabled":       account.TOTPEnabled,
+			"createdAt":         account.CreatedAt,
+			"lastUsed":          account.LastUsed,
+			"active":            account.Active,
+			"tokenExpiresAt":    account.TokenExpiresAt,
+			"tokenExpiringSoon": account.IsTokenExpiringSoon(tokenExpiryWarningWindow),
+			"tokenExpired":      account.IsTokenExpired(),
+			"hasPassword":       account.PasswordHash != "",
 		},
 	})
 }
@@ -1788,9 +2261,11 @@ func (s *Server) handleOrgCreateAccount(w http.ResponseWriter, r *http.Request,
 	}
 
 	var req struct {
-		Username   string `json:"username"`
-		Password   string `json:"password,omitempty"`
-		IsOrgAdmin bool   `json:"isOrgAdmin"`
+		Username           string `json:"username"`
+		Password           string `json:"password,omitempty"`
+		IsOrgAdmin         bool   `json:"isOrgAdmin"`
+		TokenExpiresIn     *int   `json:"tokenExpiresIn,omitempty"`     // days
+		MustChangePassword bool   `json:"mustChangePassword,omitempty"` // Force a change on first login
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1807,6 +2282,10 @@ func (s *Server) handleOrgCreateAccount(w http.ResponseWriter, r *http.Request,
 		jsonError(w, "Password must be at least 8 characters", http.StatusBadRequest)
 		return
 	}
+	if req.MustChangePassword && req.Password == "" {
+		jsonError(w, "mustChangePassword requires a password", http.StatusBadRequest)
+		return
+	}
 
 	// Check if username exists
 	existing, err := s.db.GetAccountByUsername(req.Username)
@@ -1839,8 +2318,9 @@ func (s *Server) handleOrgCreateAccount(w http.ResponseWriter, r *http.Request,
 		}
 	}
 
-	// Create account
-	account, err := s.db.CreateOrgAccountWithOrgAdmin(req.Username, tokenHash, passwordHash, orgCtx.OrgID, req.IsOrgAdmin)
+	// Create account, with its token expiry and password change flag in the same write
+	account, err := s.db.CreateOrgAccountWithOrgAdmin(req.Username, tokenHash, passwordHash, orgCtx.OrgID, req.IsOrgAdmin,
+		tokenExpiresAtFromDays(req.TokenExpiresIn), req.MustChangePassword)
 	if err != nil {
 		log.Printf("Failed to create account: %v", err)
 		jsonError(w, "Internal server error", http.StatusInternalServerError)
@@ -1853,11 +2333,13 @@ func (s *Server) handleOrgCreateAccount(w http.ResponseWriter, r *http.Request,
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
 		"account": map[string]interface{}{
-			"id":          account.ID,
-			"username":    account.Username,
-			"isOrgAdmin":  account.IsOrgAdmin,
-			"createdAt":   account.CreatedAt,
-			"hasPassword": passwordHash != "",
+			"id":                 account.ID,
+			"username":           account.Username,
+			"isOrgAdmin":         account.IsOrgAdmin,
+			"createdAt":          account.CreatedAt,
+			"hasPassword":        passwordHash != "",
+			"tokenExpiresAt":     account.TokenExpiresAt,
+			"mustChangePassword": account.MustChangePassword,
 		},
 		"token": token,
 	})
@@ -1943,7 +2425,8 @@ func (s *Server) handleOrgSetAccountPassword(w http.ResponseWriter, r *http.Requ
 	}
 
 	var req struct {
-		Password string `json:"password"`
+		Password           string `json:"password"`
+		MustChangePassword bool   `json:"mustChangePassword,omitempty"` // Force a change on next login
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1968,6 +2451,11 @@ func (s *Server) handleOrgSetAccountPassword(w http.ResponseWriter, r *http.Requ
 		jsonError(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	if err := s.db.SetAccountMustChangePassword(accountID, req.MustChangePassword); err != nil {
+		log.Printf("Failed to set password change flag: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	log.Printf("Password set for org account %s by %s", accountID, orgCtx.Username)
 
@@ -1994,6 +2482,12 @@ func (s *Server) handleOrgRegenerateToken(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	expiresAt, err := decodeTokenExpiry(r)
+	if err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
 	// Generate new token
 	token, tokenHash, err := auth.GenerateToken()
 	if err != nil {
@@ -2007,13 +2501,19 @@ func (s *Server) handleOrgRegenerateToken(w http.ResponseWriter, r *http.Request
 		jsonError(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	if err := s.db.UpdateAccountTokenExpiry(accountID, expiresAt); err != nil {
+		log.Printf("Failed to update token expiry: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	log.Printf("Token regenerated for org account %s by %s", accountID, orgCtx.Username)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"token":   token,
+		"success":        true,
+		"token":          token,
+		"tokenExpiresAt": expiresAt,
 	})
 }
 
@@ -2216,6 +2716,7 @@ func (s *Server) handleOrgGetUsage(w http.ResponseWriter, r *http.Request, orgCt
 			"tunnelHours":       tunnelSeconds / 3600,
 			"requestCount":      requestCount,
 			"currentConcurrent": currentConcurrent,
+			"inFlightRequests":  s.inFlight.current(orgCtx.OrgID),
 		},
 	}
 
@@ -2226,6 +2727,7 @@ func (s *Server) handleOrgGetUsage(w http.ResponseWriter, r *http.Request, orgCt
 			"tunnelHoursMonthly":    plan.TunnelHoursMonthly,
 			"concurrentTunnelsMax":  plan.ConcurrentTunnelsMax,
 			"requestsMonthly":       plan.RequestsMonthly,
+			"maxConcurrentRequests": plan.MaxConcurrentRequests,
 			"overageAllowedPercent": plan.OverageAllowedPercent,
 			"gracePeriodHours":      plan.GracePeriodHours,
 		}
@@ -2354,6 +2856,17 @@ func (s *Server) handleOrgGetSettings(w http.ResponseWriter, r *http.Request, or
 		"name":        org.Name,
 		"requireTotp": org.RequireTOTP,
 		"createdAt":   org.CreatedAt,
+
+		"authFrameAncestors": org.AuthFrameAncestors,
+		"branding":           org.Branding,
+		"sessionCookie":      org.SessionCookie,
+		"loginSessionLimit":  org.LoginSessionLimit,
+	}
+
+	if featureFlags, err := s.orgFeatureFlags(org.ID); err != nil {
+		log.Printf("Failed to get feature flags: %v", err)
+	} else {
+		response["featureFlags"] = featureFlags
 	}
 
 	if plan != nil {
@@ -2379,18 +2892,85 @@ func (s *Server) handleOrgUpdateSettings(w http.ResponseWriter, r *http.Request,
 	var input struct {
 		Name        *string `json:"name"`
 		RequireTOTP *bool   `json:"requireTotp"`
+
+		// CSP frame-ancestors sources allowed to embed login pages ("" = not embeddable)
+		AuthFrameAncestors *string `json:"authFrameAncestors"`
+
+		// Logo, color and product name of login/error pages (empty fields use the defaults)
+		Branding *db.OrgBranding `json:"branding"`
+
+		// Domain and SameSite of tunnel session cookies (empty fields use the server defaults)
+		SessionCookie *db.OrgSessionCookie `json:"sessionCookie"`
+
+		// Concurrent dashboard/portal logins per member (max 0 = unlimited)
+		LoginSessionLimit *db.OrgLoginSessionLimit `json:"loginSessionLimit"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		jsonError(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
+	if input.Branding != nil {
+		*input.Branding = auth.NormalizeBranding(*input.Branding)
+		if err := auth.ValidateBranding(*input.Branding); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if input.SessionCookie != nil {
+		*input.SessionCookie = auth.NormalizeSessionCookie(*input.SessionCookie)
+		if err := auth.ValidateSessionCookie(*input.SessionCookie, s.domain, s.scheme == "https"); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		org, err := s.db.GetOrganizationByID(orgCtx.OrgID)
+		if err != nil {
+			log.Printf("Failed to get organization: %v", err)
+			jsonError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if org == nil {
+			jsonError(w, "Organization not found", http.StatusNotFound)
+			return
+		}
+		// A domain cookie uses the server-wide cookie name and reaches every tunnel
+		// on the server, including other orgs' tunnels, so only server admins set it.
+		// SSO sets its cookie on the server domain too.
+		if input.SessionCookie.Domain != org.SessionCookie.Domain {
+			jsonError(w, "Only server admins can change the session cookie domain", http.StatusForbidden)
+			return
+		}
+		if input.SessionCookie.SSO != org.SessionCookie.SSO {
+			jsonError(w, "Only server admins can change single sign-on", http.StatusForbidden)
+			return
+		}
+	}
+
+	if input.LoginSessionLimit != nil {
+		if err := validateLoginSessionLimit(*input.LoginSessionLimit); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	if input.Name != nil {
-		if *input.Name == "" {
-			jsonError(w, "Name cannot be empty", http.StatusBadRequest)
+		name, err := normalizeEntityName("Organization", *input.Name)
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		taken, err := s.db.OrganizationNameTaken(name, orgCtx.OrgID)
+		if err != nil {
+			log.Printf("Failed to check organization name: %v", err)
+			jsonError(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
-		if err := s.db.UpdateOrganization(orgCtx.OrgID, *input.Name); err != nil {
+		if taken {
+			jsonError(w, "Organization name already exists", http.StatusConflict)
+			return
+		}
+		if err := s.db.UpdateOrganization(orgCtx.OrgID, name); err != nil {
 			log.Printf("Failed to update organization name: %v", err)
 			jsonError(w, "Internal server error", http.StatusInternalServerError)
 			return
@@ -2405,6 +2985,42 @@ func (s *Server) handleOrgUpdateSettings(w http.ResponseWriter, r *http.Request,
 		}
 	}
 
+	if input.AuthFrameAncestors != nil {
+		if err := auth.ValidateFrameAncestors(*input.AuthFrameAncestors); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.db.UpdateOrganizationAuthFrameAncestors(orgCtx.OrgID, strings.Join(strings.Fields(*input.AuthFrameAncestors), " ")); err != nil {
+			log.Printf("Failed to update organization frame ancestors: %v", err)
+			jsonError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if input.Branding != nil {
+		if err := s.db.UpdateOrganizationBranding(orgCtx.OrgID, *input.Branding); err != nil {
+			log.Printf("Failed to update organization branding: %v", err)
+			jsonError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if input.SessionCookie != nil {
+		if err := s.db.UpdateOrganizationSessionCookie(orgCtx.OrgID, *input.SessionCookie); err != nil {
+			log.Printf("Failed to update organization session cookie: %v", err)
+			jsonError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if input.LoginSessionLimit != nil {
+		if err := s.db.UpdateOrganizationLoginSessionLimit(orgCtx.OrgID, *input.LoginSessionLimit); err != nil {
+			log.Printf("Failed to update organization login session limit: %v", err)
+			jsonError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	log.Printf("Org settings updated by %s", orgCtx.Username)
 
 	jsonResponse(w, map[string]bool{"success": true})
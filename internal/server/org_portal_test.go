@@ -0,0 +1,245 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+	"github.com/niekvdm/digit-link/internal/protocol"
+	"github.com/niekvdm/digit-link/internal/tunnel"
+)
+
+func TestAccountDefaultSubdomain(t *testing.T) {
+	database := newTestDB(t)
+
+	org, _ := database.CreateOrganization("acme")
+	database.AddOrgWhitelist(org.ID, "127.0.0.1", "test client", "")
+	if _, err := database.CreateApplication(org.ID, "shop", "Shop"); err != nil {
+		t.Fatalf("CreateApplication() error: %v", err)
+	}
+	account, err := database.CreateOrgAccount("bob", auth.HashToken("token"), "", org.ID)
+	if err != nil {
+		t.Fatalf("CreateOrgAccount() error: %v", err)
+	}
+
+	s := newTestServer(database)
+	orgCtx := &OrgContext{OrgID: org.ID, AccountID: account.ID, Username: "bob"}
+	update := func(body string) int {
+		r := httptest.NewRequest(http.MethodPut, "/org/accounts/me", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.handleOrgUpdateMyAccount(w, r, orgCtx)
+		return w.Code
+	}
+	for body, want := range map[string]int{
+		`{"defaultSubdomain":"-bad"}`:      http.StatusBadRequest,
+		`{"defaultSubdomain":"shop"}`:      http.StatusConflict,
+		`{"defaultSubdomain":" Bob-Dev "}`: http.StatusOK,
+	} {
+		if got := update(body); got != want {
+			t.Errorf("PUT /org/accounts/me %s = %d, want %d", body, got, want)
+		}
+	}
+	stored, _ := database.GetAccountByID(account.ID)
+	if stored.DefaultSubdomain != "bob-dev" {
+		t.Fatalf("DefaultSubdomain = %q, want bob-dev", stored.DefaultSubdomain)
+	}
+
+	// A TCP forward without a subdomain gets the default as well
+	tl := NewTunnelListener(s, nil)
+	authReq := &tunnel.AuthRequest{Token: "token", Forwards: []tunnel.ForwardConfig{{LocalPort: 3000}, {Subdomain: "web", LocalPort: 8080}}}
+	tcpResp := tl.authenticateSession(nil, authReq, "127.0.0.1").response
+	if !tcpResp.Success || len(tcpResp.Tunnels) != 2 || tcpResp.Tunnels[0].Subdomain != "bob-dev" || tcpResp.Tunnels[1].Subdomain != "web" {
+		t.Fatalf("TCP registration = %+v, want bob-dev and web", tcpResp)
+	}
+	if authReq.Forwards[0].Subdomain != "bob-dev" {
+		t.Errorf("registered forward subdomain = %q, want bob-dev", authReq.Forwards[0].Subdomain)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer ts.Close()
+	register := func(req protocol.RegisterRequest) (*websocket.Conn, protocol.RegisterResponse) {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/_tunnel", nil)
+		if err != nil {
+			t.Fatalf("Dial() error: %v", err)
+		}
+		reg, _ := json.Marshal(protocol.Message{Type: protocol.TypeRegisterRequest, Payload: req})
+		conn.WriteMessage(websocket.TextMessage, reg)
+		var regResp struct {
+			Payload protocol.RegisterResponse `json:"payload"`
+		}
+		if err := conn.ReadJSON(&regResp); err != nil {
+			t.Fatalf("reading registration response: %v", err)
+		}
+		return conn, regResp.Payload
+	}
+
+	first, resp := register(protocol.RegisterRequest{Token: "token"})
+	defer first.Close()
+	if !resp.Success || resp.Subdomain != "bob-dev" {
+		t.Fatalf("registration = %+v, want the default subdomain bob-dev", resp)
+	}
+	// Taken by the first tunnel, so the next one falls back to a random subdomain
+	second, resp := register(protocol.RegisterRequest{Token: "token"})
+	defer second.Close()
+	if !resp.Success || resp.Subdomain == "bob-dev" {
+		t.Errorf("second registration = %+v, want a random subdomain", resp)
+	}
+	// An explicit subdomain still wins
+	third, resp := register(protocol.RegisterRequest{Token: "token", Subdomain: "other"})
+	defer third.Close()
+	if !resp.Success || resp.Subdomain != "other" {
+		t.Errorf("explicit registration = %+v, want subdomain other", resp)
+	}
+
+	if got := update(`{"defaultSubdomain":""}`); got != http.StatusOK {
+		t.Fatalf("clearing the default subdomain = %d, want 200", got)
+	}
+	if stored, _ := database.GetAccountByID(account.ID); stored.DefaultSubdomain != "" {
+		t.Errorf("DefaultSubdomain = %q after clearing, want empty", stored.DefaultSubdomain)
+	}
+}
+
+func TestOrgRotateAllAPIKeys(t *testing.T) {
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	app, err := database.CreateApplication(org.ID, "api", "api")
+	if err != nil {
+		t.Fatalf("CreateApplication() error: %v", err)
+	}
+	orgRaw, orgKey, _ := db.GenerateAPIKey(&org.ID, nil, "deploy", nil)
+	_, appKey, _ := db.GenerateAppAPIKey(org.ID, app.ID, "ci", nil)
+	appKey.RateLimitTier = db.RateLimitTierElevated
+	expired := time.Now().Add(-time.Hour)
+	_, expiredKey, _ := db.GenerateAPIKey(&org.ID, nil, "old", &expired)
+	for _, key := range []*db.APIKey{orgKey, appKey, expiredKey} {
+		if err := database.CreateAPIKey(key); err != nil {
+			t.Fatalf("CreateAPIKey() error: %v", err)
+		}
+	}
+
+	s := newTestServer(database)
+	rotate := func(orgCtx *OrgContext, query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.handleOrgRotateAllAPIKeys(w, httptest.NewRequest(http.MethodPost, "/org/api-keys/rotate-all"+query, nil), orgCtx)
+		return w
+	}
+
+	if w := rotate(&OrgContext{OrgID: org.ID, Username: "member"}, ""); w.Code != http.StatusForbidden {
+		t.Errorf("member rotation: status %d, want 403", w.Code)
+	}
+
+	admin := &OrgContext{OrgID: org.ID, Username: "alice", IsOrgAdmin: true}
+	w := rotate(admin, "?dryRun=true")
+	var dryRun struct {
+		DryRun bool         `json:"dryRun"`
+		Keys   []*db.APIKey `json:"keys"`
+	}
+	json.NewDecoder(w.Body).Decode(&dryRun)
+	if !dryRun.DryRun || len(dryRun.Keys) != 3 {
+		t.Errorf("dry run listed %d keys, want 3", len(dryRun.Keys))
+	}
+	if key, _ := database.GetAPIKeyByID(orgKey.ID); key == nil {
+		t.Fatal("dry run revoked a key")
+	}
+
+	w = rotate(admin, "")
+	var resp struct {
+		Rotated []RotatedAPIKey `json:"rotated"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || len(resp.Rotated) != 3 {
+		t.Fatalf("rotation: status %d, %d keys (%v), want 3", w.Code, len(resp.Rotated), err)
+	}
+
+	if key, _ := database.GetAPIKeyByHash(db.HashAPIKey(orgRaw)); key != nil {
+		t.Error("old key still valid after rotation")
+	}
+	keys, _ := database.ListAPIKeysByOrg(org.ID)
+	if len(keys) != 2 {
+		t.Errorf("%d keys after rotation, want 2 (expired key not replaced)", len(keys))
+	}
+	for _, rotated := range resp.Rotated {
+		switch rotated.OldKeyID {
+		case expiredKey.ID:
+			if rotated.Key != nil {
+				t.Error("expired key was replaced")
+			}
+		case appKey.ID:
+			key, _ := database.GetAPIKeyByHash(db.HashAPIKey(rotated.RawKey))
+			if key == nil || key.AppID == nil || *key.AppID != app.ID || key.Description != "ci" || key.RateLimitTier != db.RateLimitTierElevated {
+				t.Errorf("app key replacement = %+v, want same app, description and tier", key)
+			}
+		}
+	}
+
+	audit, _ := database.GetAuditEvents(&org.ID, nil, 10, 0)
+	if len(audit) != 1 || audit[0].AuthType != db.AuditTypeAPIKeysRotated || audit[0].Actor != "alice" {
+		t.Errorf("audit events = %+v, want one api_keys_rotated by alice", audit)
+	}
+}
+
+func TestOrgPolicyAffectedApps(t *testing.T) {
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	modes := map[string]db.AuthMode{
+		"docs":     db.AuthModeInherit,
+		"admin":    db.AuthModeCustom,
+		"draft":    db.AuthModeCustom, // No policy of its own yet
+		"public":   db.AuthModeDisabled,
+		"internal": db.AuthModeInherit,
+	}
+	for subdomain, mode := range modes {
+		app, err := database.CreateApplication(org.ID, subdomain, subdomain)
+		if err != nil {
+			t.Fatalf("CreateApplication() error: %v", err)
+		}
+		database.UpdateApplicationAuthMode(app.ID, mode)
+		if subdomain == "admin" {
+			if err := database.CreateAppAuthPolicy(&db.AppAuthPolicy{AppID: app.ID, AuthType: db.AuthTypeAPIKey}); err != nil {
+				t.Fatalf("CreateAppAuthPolicy() error: %v", err)
+			}
+		}
+	}
+	other, _ := database.CreateOrganization("other")
+	database.CreateApplication(other.ID, "elsewhere", "elsewhere")
+
+	s := newTestServer(database)
+	w := httptest.NewRecorder()
+	s.handleOrgPolicyAffectedApps(w, httptest.NewRequest(http.MethodGet, "/org/policy/affected-apps", nil), &OrgContext{OrgID: org.ID})
+
+	var resp map[string][]PolicyAffectedApp
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	groups := map[string][]string{}
+	for group, apps := range resp {
+		for _, app := range apps {
+			groups[group] = append(groups[group], app.Subdomain)
+		}
+		sort.Strings(groups[group])
+	}
+	want := map[string][]string{
+		"inherit":  {"docs", "draft", "internal"},
+		"custom":   {"admin"},
+		"disabled": {"public"},
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("affected apps = %v, want %v", groups, want)
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"log"
+	"os"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// PlanDowngradePolicy decides what happens when an organization is assigned a
+// plan whose limits it already exceeds
+type PlanDowngradePolicy string
+
+const (
+	// PlanDowngradeWarn assigns the plan and reports the violations
+	PlanDowngradeWarn PlanDowngradePolicy = "warn"
+	// PlanDowngradeEnforce rejects the plan until the organization is under its limits
+	PlanDowngradeEnforce PlanDowngradePolicy = "enforce"
+)
+
+// GetPlanDowngradePolicy returns the downgrade policy from PLAN_DOWNGRADE_POLICY (default warn)
+func GetPlanDowngradePolicy() PlanDowngradePolicy {
+	switch p := PlanDowngradePolicy(os.Getenv("PLAN_DOWNGRADE_POLICY")); p {
+	case "":
+		return PlanDowngradeWarn
+	case PlanDowngradeWarn, PlanDowngradeEnforce:
+		return p
+	default:
+		log.Printf("WARNING: invalid PLAN_DOWNGRADE_POLICY %q, using warn", p)
+		return PlanDowngradeWarn
+	}
+}
+
+// PlanViolation is a plan limit the organization's current usage is above
+type PlanViolation struct {
+	Limit   string `json:"limit"` // Plan field name, e.g. concurrentTunnelsMax
+	Current int64  `json:"current"`
+	Max     int64  `json:"max"`
+}
+
+// planViolations returns the limits of plan that the organization's current
+// usage (live tunnels and this billing period's totals) is above
+func (s *Server) planViolations(orgID string, plan *db.Plan) ([]PlanViolation, error) {
+	var bandwidth, tunnelSeconds, requests int64
+	var concurrent int32
+	if s.usageCache != nil {
+		bandwidth, tunnelSeconds, requests, concurrent = s.usageCache.GetCurrentUsage(orgID)
+	} else {
+		usage, err := s.db.GetCurrentPeriodUsage(orgID)
+		if err != nil {
+			return nil, err
+		}
+		if usage != nil {
+			bandwidth, tunnelSeconds, requests = usage.BandwidthBytes, usage.TunnelSeconds, usage.RequestCount
+		}
+		concurrent = int32(len(s.GetActiveTunnelsByOrg(orgID)))
+	}
+
+	violations := []PlanViolation{}
+	check := func(limit string, current int64, max *int64) {
+		if max != nil && current > *max {
+			violations = append(violations, PlanViolation{Limit: limit, Current: current, Max: *max})
+		}
+	}
+	if plan.ConcurrentTunnelsMax != nil {
+		max := int64(*plan.ConcurrentTunnelsMax)
+		check("concurrentTunnelsMax", int64(concurrent), &max)
+	}
+	check("bandwidthBytesMonthly", bandwidth, plan.BandwidthBytesMonthly)
+	if max := plan.TunnelHoursMonthly; max != nil && tunnelSeconds > *max*3600 {
+		violations = append(violations, PlanViolation{Limit: "tunnelHoursMonthly", Current: tunnelSeconds / 3600, Max: *max})
+	}
+	check("requestsMonthly", requests, plan.RequestsMonthly)
+	return violations, nil
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestPlanDowngradeViolations(t *testing.T) {
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	one := 1
+	small, err := database.CreatePlan(db.CreatePlanInput{Name: "Small", ConcurrentTunnelsMax: &one})
+	if err != nil {
+		t.Fatalf("CreatePlan() error: %v", err)
+	}
+
+	s := newTestServer(database)
+	s.tunnels = map[string]*Tunnel{
+		"a": {Subdomain: "a", OrgID: org.ID},
+		"b": {Subdomain: "b", OrgID: org.ID},
+	}
+	assign := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPut, "/admin/organizations/"+org.ID+"/plan", strings.NewReader(`{"planId":"`+small.ID+`"}`))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.handleSetOrganizationPlan(w, r, org.ID)
+		return w
+	}
+	var resp struct {
+		Violations []PlanViolation `json:"violations"`
+	}
+	want := []PlanViolation{{Limit: "concurrentTunnelsMax", Current: 2, Max: 1}}
+
+	s.planDowngradePolicy = PlanDowngradeEnforce
+	w := assign()
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusConflict || !reflect.DeepEqual(resp.Violations, want) {
+		t.Errorf("enforce: status %d, violations %+v, want 409 with %+v", w.Code, resp.Violations, want)
+	}
+	if got, _ := database.GetOrganizationByID(org.ID); got.PlanID != nil {
+		t.Error("enforce: plan assigned despite violations")
+	}
+
+	s.planDowngradePolicy = PlanDowngradeWarn
+	w = assign()
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || !reflect.DeepEqual(resp.Violations, want) {
+		t.Errorf("warn: status %d, violations %+v, want 200 with %+v", w.Code, resp.Violations, want)
+	}
+	if got, _ := database.GetOrganizationByID(org.ID); got.PlanID == nil || *got.PlanID != small.ID {
+		t.Error("warn: plan not assigned")
+	}
+}
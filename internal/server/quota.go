@@ -48,23 +48,12 @@ func (qc *QuotaChecker) CheckQuota(orgID string, quotaType QuotaType) QuotaResul
 		Limit:     -1,
 	}
 
-	// Get cached plan ID (no DB query - fast path)
-	planID := qc.cache.GetOrgPlanID(orgID)
-	if planID == nil {
+	plan := qc.orgPlan(orgID)
+	if plan == nil {
 		// No plan = no limits
 		return result
 	}
 
-	plan := qc.cache.GetPlan(*planID)
-	if plan == nil {
-		// Plan not found in cache, try to reload from DB
-		var err error
-		plan, err = qc.db.GetPlan(*planID)
-		if err != nil || plan == nil {
-			return result
-		}
-	}
-
 	// Get current usage
 	bandwidth, tunnelSeconds, requests, concurrent := qc.cache.GetCurrentUsage(orgID)
 
@@ -153,6 +142,56 @@ func (qc *QuotaChecker) CheckQuota(orgID string, quotaType QuotaType) QuotaResul
 	return result
 }
 
+// orgPlan returns the organization's plan, or nil when it has none
+func (qc *QuotaChecker) orgPlan(orgID string) *db.Plan {
+	// Get cached plan ID (no DB query - fast path)
+	planID := qc.cache.GetOrgPlanID(orgID)
+	if planID == nil {
+		return nil
+	}
+
+	plan := qc.cache.GetPlan(*planID)
+	if plan == nil {
+		// Plan not found in cache, try to reload from DB
+		var err error
+		plan, err = qc.db.GetPlan(*planID)
+		if err != nil {
+			return nil
+		}
+	}
+	return plan
+}
+
+// MaxBytesPerSecond returns the per-tunnel throughput cap of the organization's
+// plan, or 0 when tunnels are not throttled
+func (qc *QuotaChecker) MaxBytesPerSecond(orgID string) int64 {
+	plan := qc.orgPlan(orgID)
+	if plan == nil || plan.MaxBytesPerSecond == nil {
+		return 0
+	}
+	return *plan.MaxBytesPerSecond
+}
+
+// MaxForwards returns how many forwards a client connection of the organization
+// may register according to its plan, or 0 when the plan sets no limit
+func (qc *QuotaChecker) MaxForwards(orgID string) int {
+	plan := qc.orgPlan(orgID)
+	if plan == nil || plan.MaxForwards == nil {
+		return 0
+	}
+	return *plan.MaxForwards
+}
+
+// MaxConcurrentRequests returns how many forwarded requests the organization may
+// have in flight at once according to its plan, or 0 when the plan sets no limit
+func (qc *QuotaChecker) MaxConcurrentRequests(orgID string) int {
+	plan := qc.orgPlan(orgID)
+	if plan == nil || plan.MaxConcurrentRequests == nil {
+		return 0
+	}
+	return *plan.MaxConcurrentRequests
+}
+
 // CheckAllQuotas checks all quotas for an organization
 func (qc *QuotaChecker) CheckAllQuotas(orgID string) map[QuotaType]QuotaResult {
 	results := make(map[QuotaType]QuotaResult)
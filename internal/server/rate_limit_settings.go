@@ -0,0 +1,133 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// validateRateLimitSettings checks a rate limit against the ranges accepted for
+// per-app rate limits
+func validateRateLimitSettings(settings *db.RateLimitSettings) error {
+	if settings.MaxAttempts < 1 || settings.MaxAttempts > 100 {
+		return fmt.Errorf("maxAttempts must be between 1 and 100")
+	}
+	if settings.WindowDurationSeconds < 60 || settings.WindowDurationSeconds > 3600 {
+		return fmt.Errorf("windowDurationSeconds must be between 60 and 3600")
+	}
+	if settings.BlockDurationSeconds < 60 || settings.BlockDurationSeconds > 86400 {
+		return fmt.Errorf("blockDurationSeconds must be between 60 and 86400")
+	}
+	return nil
+}
+
+// rateLimitSettingsOf describes a limiter's configuration as settings
+func rateLimitSettingsOf(config auth.RateLimiterConfig) *db.RateLimitSettings {
+	return &db.RateLimitSettings{
+		MaxAttempts:           config.MaxAttempts,
+		WindowDurationSeconds: int(config.WindowDuration / time.Second),
+		BlockDurationSeconds:  int(config.BlockDuration / time.Second),
+	}
+}
+
+// defaultRateLimitValues returns the default rate limit in effect: the one set
+// through the admin API, or the built-in default
+func (s *Server) defaultRateLimitValues() (maxAttempts, windowSeconds, blockSeconds int) {
+	if s.authMiddleware == nil {
+		return db.DefaultRateLimitValues()
+	}
+	current := rateLimitSettingsOf(s.authMiddleware.DefaultRateLimiter().Config())
+	return current.MaxAttempts, current.WindowDurationSeconds, current.BlockDurationSeconds
+}
+
+// applyDefaultRateLimit configures the default rate limiter with settings
+func (s *Server) applyDefaultRateLimit(settings *db.RateLimitSettings) {
+	rl := s.authMiddleware.DefaultRateLimiter()
+	config := rl.Config()
+	config.MaxAttempts = settings.MaxAttempts
+	config.WindowDuration = time.Duration(settings.WindowDurationSeconds) * time.Second
+	config.BlockDuration = time.Duration(settings.BlockDurationSeconds) * time.Second
+	rl.SetConfig(config)
+}
+
+// handleGetRateLimitSettings returns the default rate limit in effect and the
+// built-in default it replaces
+func (s *Server) handleGetRateLimitSettings(w http.ResponseWriter, r *http.Request) {
+	stored, err := s.db.GetDefaultRateLimitSettings()
+	if err != nil {
+		log.Printf("Failed to get default rate limit: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+
+	current := rateLimitSettingsOf(s.authMiddleware.DefaultRateLimiter().Config())
+	builtIn := rateLimitSettingsOf(auth.DefaultRateLimiterConfig())
+	var updatedAt *time.Time
+	if stored != nil {
+		updatedAt = &stored.UpdatedAt
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"maxAttempts":           current.MaxAttempts,
+		"windowDurationSeconds": current.WindowDurationSeconds,
+		"blockDurationSeconds":  current.BlockDurationSeconds,
+		"updatedAt":             updatedAt,
+		"defaults": map[string]int{
+			"maxAttempts":           builtIn.MaxAttempts,
+			"windowDurationSeconds": builtIn.WindowDurationSeconds,
+			"blockDurationSeconds":  builtIn.BlockDurationSeconds,
+		},
+	})
+}
+
+// handleUpdateRateLimitSettings changes the default rate limit, applies it to
+// the running limiter and stores it so it survives restarts. The change is
+// written to the audit log.
+func (s *Server) handleUpdateRateLimitSettings(w http.ResponseWriter, r *http.Request, adminUsername string) {
+	if !validateJSONContentType(w, r) {
+		return
+	}
+	limitRequestBody(r)
+
+	var settings db.RateLimitSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "Invalid request body")
+		return
+	}
+	if err := validateRateLimitSettings(&settings); err != nil {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, err.Error())
+		return
+	}
+
+	previous := rateLimitSettingsOf(s.authMiddleware.DefaultRateLimiter().Config())
+	if err := s.db.SetDefaultRateLimitSettings(&settings); err != nil {
+		log.Printf("Failed to store default rate limit: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+	s.settings.invalidate(db.SettingDefaultRateLimit)
+	s.applyDefaultRateLimit(&settings)
+
+	log.Printf("Default rate limit changed by admin %s: %d attempts per %ds blocking %ds, was %d per %ds blocking %ds",
+		adminUsername, settings.MaxAttempts, settings.WindowDurationSeconds, settings.BlockDurationSeconds,
+		previous.MaxAttempts, previous.WindowDurationSeconds, previous.BlockDurationSeconds)
+
+	change := fmt.Sprintf("maxAttempts=%d windowDurationSeconds=%d blockDurationSeconds=%d",
+		settings.MaxAttempts, settings.WindowDurationSeconds, settings.BlockDurationSeconds)
+	if err := s.db.LogAdminAction(nil, db.AuditTypeRateLimitChanged, auth.GetClientIP(r), adminUsername, change); err != nil {
+		log.Printf("Failed to audit rate limit change: %v", err)
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success":               true,
+		"maxAttempts":           settings.MaxAttempts,
+		"windowDurationSeconds": settings.WindowDurationSeconds,
+		"blockDurationSeconds":  settings.BlockDurationSeconds,
+		"updatedAt":             settings.UpdatedAt,
+	})
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestDefaultRateLimitSettings(t *testing.T) {
+	database := newTestDB(t)
+
+	s := newTestServer(database)
+	get := func() map[string]interface{} {
+		w := httptest.NewRecorder()
+		s.handleGetRateLimitSettings(w, httptest.NewRequest(http.MethodGet, "/admin/settings/rate-limit", nil))
+		var resp map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp
+	}
+	put := func(body string) int {
+		r := httptest.NewRequest(http.MethodPut, "/admin/settings/rate-limit", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.handleUpdateRateLimitSettings(w, r, "root")
+		return w.Code
+	}
+
+	if resp := get(); resp["maxAttempts"] != float64(10) || resp["windowDurationSeconds"] != float64(900) || resp["updatedAt"] != nil {
+		t.Errorf("initial settings = %v, want the built-in default", resp)
+	}
+
+	for _, body := range []string{
+		`{"maxAttempts":0,"windowDurationSeconds":60,"blockDurationSeconds":60}`,
+		`{"maxAttempts":5,"windowDurationSeconds":59,"blockDurationSeconds":60}`,
+		`{"maxAttempts":5,"windowDurationSeconds":60,"blockDurationSeconds":86401}`,
+	} {
+		if code := put(body); code != http.StatusBadRequest {
+			t.Errorf("PUT %s = %d, want 400", body, code)
+		}
+	}
+
+	if code := put(`{"maxAttempts":3,"windowDurationSeconds":60,"blockDurationSeconds":120}`); code != http.StatusOK {
+		t.Fatalf("PUT = %d, want 200", code)
+	}
+	if resp := get(); resp["maxAttempts"] != float64(3) || resp["blockDurationSeconds"] != float64(120) || resp["updatedAt"] == nil {
+		t.Errorf("settings after update = %v", resp)
+	}
+
+	// The running limiter blocks after the new limit, without a restart
+	rl := s.authMiddleware.DefaultRateLimiter()
+	for i := 0; i < 3; i++ {
+		if ok, _ := rl.Allow("ip:198.51.100.7"); !ok {
+			t.Fatalf("attempt %d blocked, want allowed", i+1)
+		}
+	}
+	if ok, retryAfter := rl.Allow("ip:198.51.100.7"); ok || retryAfter != 2*time.Minute {
+		t.Errorf("4th attempt = (%v, %v), want blocked for 2m", ok, retryAfter)
+	}
+
+	events, err := database.GetAuditEvents(nil, nil, 10, 0)
+	if err != nil {
+		t.Fatalf("GetAuditEvents() error: %v", err)
+	}
+	if len(events) != 1 || events[0].AuthType != db.AuditTypeRateLimitChanged || events[0].Actor != "root" {
+		t.Errorf("audit events = %+v, want one rate_limit_changed by root", events)
+	}
+
+	// The stored setting is applied again after a restart
+	restarted := newTestServer(database)
+	restarted.loadSettings()
+	if config := restarted.authMiddleware.DefaultRateLimiter().Config(); config.MaxAttempts != 3 || config.WindowDuration != time.Minute {
+		t.Errorf("config after restart = %+v, want 3 attempts per minute", config)
+	}
+}
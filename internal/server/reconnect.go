@@ -0,0 +1,170 @@
+package server
+
+import (
+	"crypto/subtle"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+const (
+	// defaultReconnectTokenTTL is how long after a tunnel was last heard from its
+	// reconnect token can resume it. It only needs to cover a network blip.
+	defaultReconnectTokenTTL = 10 * time.Minute
+	// defaultReconnectGrace is how long a tunnel may take to answer a liveness probe
+	// before its concurrency slot is given to a reconnecting client
+	defaultReconnectGrace = 5 * time.Second
+)
+
+// GetReconnectTokenTTL returns the reconnect token lifetime from environment or default.
+// Zero disables reconnect tokens.
+func GetReconnectTokenTTL() time.Duration {
+	if ttl := os.Getenv("TUNNEL_RECONNECT_TOKEN_TTL"); ttl != "" {
+		seconds, err := strconv.Atoi(ttl)
+		if err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		log.Printf("WARNING: invalid TUNNEL_RECONNECT_TOKEN_TTL %q, using default", ttl)
+	}
+	return defaultReconnectTokenTTL
+}
+
+// GetReconnectGrace returns the liveness probe grace period from environment or default.
+// Zero disables releasing dead tunnels for reconnecting clients.
+func GetReconnectGrace() time.Duration {
+	if grace := os.Getenv("TUNNEL_RECONNECT_GRACE"); grace != "" {
+		seconds, err := strconv.Atoi(grace)
+		if err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		log.Printf("WARNING: invalid TUNNEL_RECONNECT_GRACE %q, using default", grace)
+	}
+	return defaultReconnectGrace
+}
+
+// tunnelOwner identifies the credential a tunnel registered with. A reconnect token
+// only resumes a tunnel for the same account or API key.
+func tunnelOwner(account *db.Account, apiKey *db.APIKey) string {
+	switch {
+	case account != nil:
+		return "account:" + account.ID
+	case apiKey != nil:
+		return "api_key:" + apiKey.ID
+	}
+	return "" // Legacy secret
+}
+
+// reconnectGrant is the reconnect token of a tunnel connection: its hash, the
+// credential it was issued to and how long it stays valid
+type reconnectGrant struct {
+	owner string
+	hash  string
+	ttl   time.Duration
+}
+
+// issue generates a new reconnect token for owner, replacing any earlier one. It
+// returns "" when reconnect tokens are disabled or cannot be generated.
+func (g *reconnectGrant) issue(owner string, ttl time.Duration) string {
+	if ttl <= 0 {
+		return ""
+	}
+	token, hash, err := auth.GenerateToken()
+	if err != nil {
+		log.Printf("Failed to generate reconnect token: %v", err)
+		return ""
+	}
+	g.owner = owner
+	g.hash = hash
+	g.ttl = ttl
+	return token
+}
+
+// allows reports whether a registration with token and owner may use the grant.
+// The token expires ttl after the connection was last heard from, so it outlives
+// a dropped connection only briefly however long the connection was up.
+func (g *reconnectGrant) allows(token, owner string, lastSeen time.Time) bool {
+	if token == "" || g.hash == "" || time.Since(lastSeen) > g.ttl {
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(owner), []byte(g.owner)) != 1 {
+		return false
+	}
+	return auth.ValidateToken(token, g.hash)
+}
+
+// issueReconnectToken generates the tunnel's reconnect token. It returns "" when
+// reconnect tokens are disabled or cannot be generated.
+func (t *Tunnel) issueReconnectToken(ttl time.Duration) string {
+	return t.reconnect.issue(t.owner, ttl)
+}
+
+// canResume reports whether a registration with token and owner may replace this tunnel
+func (t *Tunnel) canResume(token, owner string) bool {
+	return t.reconnect.allows(token, owner, time.Unix(0, t.lastSeen.Load()))
+}
+
+// releaseDeadTunnels makes room for a client that hits the organization's
+// concurrent tunnel limit while reconnecting. The organization's tunnels held by
+// the same owner are pinged, and those that do not answer within the grace
+// period are closed and cleaned up, so the client is not rejected because of its
+// own dead connections. It returns the number of tunnels released.
+func (s *Server) releaseDeadTunnels(orgID, owner string) int {
+	if s.reconnectGrace <= 0 || orgID == "" || owner == "" {
+		return 0
+	}
+
+	s.mu.RLock()
+	var candidates []*Tunnel
+	for _, t := range s.tunnels {
+		if t.OrgID == orgID && t.owner == owner && !t.IsClosed() {
+			candidates = append(candidates, t)
+		}
+	}
+	s.mu.RUnlock()
+	if len(candidates) == 0 {
+		return 0
+	}
+
+	// Any message or pong received after the probe proves the connection is alive
+	probe := time.Now()
+	for _, t := range candidates {
+		t.WriteMessage(websocket.PingMessage, nil)
+	}
+
+	// Wait for every candidate to answer, go away on its own, or run out the grace period
+	timer := time.NewTimer(s.reconnectGrace)
+	defer timer.Stop()
+	expired := false
+	for _, t := range candidates {
+		if expired {
+			break
+		}
+		select {
+		case <-t.seenAfter(probe):
+		case <-t.done:
+		case <-timer.C:
+			expired = true
+		}
+	}
+
+	released := 0
+	for _, t := range candidates {
+		if t.seenSince(probe) {
+			continue
+		}
+		log.Printf("Tunnel %s did not answer within %s, releasing it for a reconnecting client", t.Subdomain, s.reconnectGrace)
+		t.Close()
+		// Closing ends the tunnel's message loop; wait for its cleanup to free the slot
+		select {
+		case <-t.done:
+		case <-time.After(time.Second):
+		}
+		released++
+	}
+	return released
+}
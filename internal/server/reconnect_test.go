@@ -0,0 +1,281 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/niekvdm/digit-link/internal/db"
+	"github.com/niekvdm/digit-link/internal/protocol"
+	"github.com/niekvdm/digit-link/internal/tunnel"
+)
+
+func TestTunnelReconnectToken(t *testing.T) {
+	s := newTestServer(nil)
+	s.reconnectTokenTTL = time.Hour
+	ts := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer ts.Close()
+
+	register := func(reconnectToken string) (*websocket.Conn, protocol.RegisterResponse) {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/_tunnel", nil)
+		if err != nil {
+			t.Fatalf("Dial() error: %v", err)
+		}
+		reg, _ := json.Marshal(protocol.Message{Type: protocol.TypeRegisterRequest, Payload: protocol.RegisterRequest{Subdomain: "myapp", ReconnectToken: reconnectToken}})
+		conn.WriteMessage(websocket.TextMessage, reg)
+		var regResp struct {
+			Payload protocol.RegisterResponse `json:"payload"`
+		}
+		if err := conn.ReadJSON(&regResp); err != nil {
+			t.Fatalf("reading registration response: %v", err)
+		}
+		return conn, regResp.Payload
+	}
+
+	first, resp := register("")
+	defer first.Close()
+	if !resp.Success || resp.ConnectionID == "" || resp.ReconnectToken == "" || resp.ReconnectTokenTTL != 3600 {
+		t.Fatalf("first registration: %+v, want success with connection ID and reconnect token", resp)
+	}
+	token := resp.ReconnectToken
+
+	for _, reconnectToken := range []string{"", "wrong-token"} {
+		conn, resp := register(reconnectToken)
+		conn.Close()
+		if resp.Success {
+			t.Errorf("registration with token %q replaced the live tunnel, want conflict", reconnectToken)
+		}
+	}
+
+	second, resp := register(token)
+	defer second.Close()
+	if !resp.Success || resp.ReconnectToken == "" || resp.ReconnectToken == token {
+		t.Fatalf("resume: %+v, want success with a new reconnect token", resp)
+	}
+	s.mu.RLock()
+	connectionID := s.tunnels["myapp"].ConnectionID
+	s.mu.RUnlock()
+	if connectionID != resp.ConnectionID {
+		t.Errorf("tunnel connection = %s, want the resumed connection %s", connectionID, resp.ConnectionID)
+	}
+
+	// The replaced connection is closed, and its cleanup leaves the new tunnel registered
+	first.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := first.ReadMessage(); err == nil {
+		t.Error("replaced connection still open")
+	}
+	time.Sleep(50 * time.Millisecond)
+	s.mu.RLock()
+	_, registered := s.tunnels["myapp"]
+	s.mu.RUnlock()
+	if !registered {
+		t.Error("resumed tunnel was unregistered by the replaced connection's cleanup")
+	}
+
+	// A token is used up once it has resumed the tunnel
+	conn, resp := register(token)
+	conn.Close()
+	if resp.Success {
+		t.Error("old reconnect token resumed the tunnel again")
+	}
+}
+
+func TestTCPReconnectToken(t *testing.T) {
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	rawKeys := make([]string, 2)
+	for i := range rawKeys {
+		rawKey, key, _ := db.GenerateAPIKey(&org.ID, nil, "org key", nil)
+		if err := database.CreateAPIKey(key); err != nil {
+			t.Fatalf("CreateAPIKey() error: %v", err)
+		}
+		rawKeys[i] = rawKey
+	}
+	if _, err := database.AddOrgWhitelist(org.ID, "127.0.0.1/32", "local", ""); err != nil {
+		t.Fatalf("AddOrgWhitelist() error: %v", err)
+	}
+
+	s := newTestServer(database)
+	s.reconnectTokenTTL = time.Hour
+	tl := NewTunnelListener(s, nil)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			session, err := tunnel.NewServerSession(conn, tunnel.DefaultYamuxConfig())
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			go tl.handleSession(session)
+		}
+	}()
+
+	register := func(rawKey, reconnectToken string) (*tunnel.Session, *tunnel.AuthResponse) {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("Dial() error: %v", err)
+		}
+		session, err := tunnel.NewClientSession(conn, tunnel.DefaultYamuxConfig())
+		if err != nil {
+			t.Fatalf("NewClientSession() error: %v", err)
+		}
+		t.Cleanup(func() { session.Close() })
+		stream, err := session.Open()
+		if err != nil {
+			t.Fatalf("Open() error: %v", err)
+		}
+		defer stream.Close()
+		req := tunnel.AuthRequest{Token: rawKey, Forwards: []tunnel.ForwardConfig{{Subdomain: "myapp", LocalPort: 3000}}, ReconnectToken: reconnectToken}
+		if err := tunnel.WriteFrame(stream, &req); err != nil {
+			t.Fatalf("WriteFrame() error: %v", err)
+		}
+		resp, err := tunnel.ReadFrame[tunnel.AuthResponse](stream)
+		if err != nil {
+			t.Fatalf("ReadFrame() error: %v", err)
+		}
+		return session, resp
+	}
+	registered := func() *tunnel.Session {
+		// The listener registers the session after sending the auth response
+		for i := 0; i < 100; i++ {
+			if session, ok := tl.GetSession("myapp"); ok {
+				return session
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return nil
+	}
+
+	first, resp := register(rawKeys[0], "")
+	if !resp.Success || resp.ConnectionID == "" || resp.ReconnectToken == "" || resp.ReconnectTokenTTL != 3600 {
+		t.Fatalf("first registration: %+v, want success with connection ID and reconnect token", resp)
+	}
+	token := resp.ReconnectToken
+	firstSession := registered()
+	if firstSession == nil {
+		t.Fatal("first session was not registered")
+	}
+
+	for _, attempt := range []struct{ key, token string }{{rawKeys[0], ""}, {rawKeys[0], "wrong-token"}, {rawKeys[1], token}} {
+		if _, resp := register(attempt.key, attempt.token); resp.Success {
+			t.Errorf("registration with token %q replaced the live session, want conflict", attempt.token)
+		}
+	}
+
+	_, resp = register(rawKeys[0], token)
+	if !resp.Success || resp.ReconnectToken == "" || resp.ReconnectToken == token {
+		t.Fatalf("resume: %+v, want success with a new reconnect token", resp)
+	}
+
+	// The replaced session is closed, and its cleanup leaves the new session registered
+	select {
+	case <-first.CloseChan():
+	case <-time.After(5 * time.Second):
+		t.Fatal("replaced session still open")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if session := registered(); session == nil || session == firstSession {
+		t.Error("resumed session was unregistered or not swapped in")
+	}
+
+	// A token is used up once it has resumed the session
+	if _, resp := register(rawKeys[0], token); resp.Success {
+		t.Error("old reconnect token resumed the session again")
+	}
+}
+
+func TestReleaseDeadTunnels(t *testing.T) {
+	s := newTestServer(nil)
+	s.reconnectGrace = 300 * time.Millisecond
+	upgrader := websocket.Upgrader{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		q := r.URL.Query()
+		tunnel := NewTunnelWithContext(q.Get("subdomain"), conn, "", q.Get("org"), "", nil)
+		tunnel.owner = q.Get("owner")
+		s.mu.Lock()
+		s.tunnels[tunnel.Subdomain] = tunnel
+		s.mu.Unlock()
+
+		s.handleTunnelMessages(tunnel)
+
+		s.mu.Lock()
+		delete(s.tunnels, tunnel.Subdomain)
+		s.mu.Unlock()
+		tunnel.Close()
+		close(tunnel.done)
+	}))
+	defer ts.Close()
+
+	// A live client reads (and so answers pings); a dead one never does
+	connect := func(subdomain, org, owner string, live bool) {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/?subdomain="+subdomain+"&org="+org+"&owner="+owner, nil)
+		if err != nil {
+			t.Fatalf("Dial() error: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		if live {
+			go func() {
+				for {
+					if _, _, err := conn.ReadMessage(); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}
+	connect("alive", "org-1", "account:a", true)
+	connect("dead", "org-1", "account:a", false)
+	connect("other-owner", "org-1", "account:b", false)
+	connect("other-org", "org-2", "account:a", false)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.RLock()
+		n := len(s.tunnels)
+		s.mu.RUnlock()
+		if n == 4 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d tunnels registered, want 4", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if released := s.releaseDeadTunnels("org-1", "account:a"); released != 1 {
+		t.Errorf("releaseDeadTunnels() = %d, want 1", released)
+	}
+	s.mu.RLock()
+	for subdomain, want := range map[string]bool{"alive": true, "dead": false, "other-owner": true, "other-org": true} {
+		if _, ok := s.tunnels[subdomain]; ok != want {
+			t.Errorf("tunnel %s registered = %v, want %v", subdomain, ok, want)
+		}
+	}
+	s.mu.RUnlock()
+
+	s.reconnectGrace = 0
+	if released := s.releaseDeadTunnels("org-1", "account:b"); released != 0 {
+		t.Errorf("releaseDeadTunnels() with grace disabled = %d, want 0", released)
+	}
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// redactedValue replaces sensitive values in logs, analytics and event streams
+const redactedValue = "[REDACTED]"
+
+// Headers and query parameters that are always redacted
+var (
+	defaultRedactedHeaders     = []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization", "X-API-Key"}
+	defaultRedactedQueryParams = []string{"token"}
+)
+
+// RedactionRules removes sensitive data from request details before they are
+// logged, persisted or streamed. A nil *RedactionRules redacts nothing.
+type RedactionRules struct {
+	headers     map[string]bool // Canonical header names
+	queryParams map[string]bool // Lowercase query parameter names
+	pattern     *regexp.Regexp  // Matches are replaced in paths, query values, header values and event reasons
+}
+
+// NewRedactionRules builds rules from the defaults plus extra header and query
+// parameter names (matched case-insensitively) and an optional regex pattern
+func NewRedactionRules(headers, queryParams []string, pattern *regexp.Regexp) *RedactionRules {
+	rr := &RedactionRules{
+		headers:     make(map[string]bool),
+		queryParams: make(map[string]bool),
+		pattern:     pattern,
+	}
+	for _, h := range append(defaultRedactedHeaders, headers...) {
+		if h = strings.TrimSpace(h); h != "" {
+			rr.headers[http.CanonicalHeaderKey(h)] = true
+		}
+	}
+	for _, p := range append(defaultRedactedQueryParams, queryParams...) {
+		if p = strings.TrimSpace(p); p != "" {
+			rr.queryParams[strings.ToLower(p)] = true
+		}
+	}
+	return rr
+}
+
+// GetRedactionRules returns the redaction rules from REDACT_HEADERS and
+// REDACT_QUERY_PARAMS (comma-separated, added to the defaults) and REDACT_PATTERN
+func GetRedactionRules() *RedactionRules {
+	var pattern *regexp.Regexp
+	if p := os.Getenv("REDACT_PATTERN"); p != "" {
+		var err error
+		if pattern, err = regexp.Compile(p); err != nil {
+			log.Printf("WARNING: invalid REDACT_PATTERN, ignoring it: %v", err)
+		}
+	}
+	return NewRedactionRules(splitList(os.Getenv("REDACT_HEADERS")), splitList(os.Getenv("REDACT_QUERY_PARAMS")), pattern)
+}
+
+// splitList splits a comma-separated environment value
+func splitList(v string) []string {
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
+
+// RedactString replaces matches of the redaction pattern
+func (rr *RedactionRules) RedactString(s string) string {
+	if rr == nil || rr.pattern == nil || s == "" {
+		return s
+	}
+	return rr.pattern.ReplaceAllString(s, redactedValue)
+}
+
+// RedactURL redacts the values of sensitive query parameters in a request URI
+// (path and query) and applies the pattern. Parameter order is preserved.
+func (rr *RedactionRules) RedactURL(uri string) string {
+	if rr == nil {
+		return uri
+	}
+	path, query, hasQuery := strings.Cut(uri, "?")
+	if hasQuery {
+		params := strings.Split(query, "&")
+		for i, param := range params {
+			key, _, hasValue := strings.Cut(param, "=")
+			name, err := url.QueryUnescape(key)
+			if err != nil {
+				name = key
+			}
+			if hasValue && rr.queryParams[strings.ToLower(name)] {
+				params[i] = key + "=" + redactedValue
+			}
+		}
+		path += "?" + strings.Join(params, "&")
+	}
+	return rr.RedactString(path)
+}
+
+// RedactHeaders returns a copy of h with sensitive header values redacted
+func (rr *RedactionRules) RedactHeaders(h http.Header) http.Header {
+	if rr == nil {
+		return h
+	}
+	redacted := make(http.Header, len(h))
+	for name, values := range h {
+		copied := make([]string, len(values))
+		for i, v := range values {
+			if rr.headers[http.CanonicalHeaderKey(name)] {
+				copied[i] = redactedValue
+			} else {
+				copied[i] = rr.RedactString(v)
+			}
+		}
+		redacted[name] = copied
+	}
+	return redacted
+}
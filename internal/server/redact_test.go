@@ -0,0 +1,52 @@
+package server
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestRedactionRules(t *testing.T) {
+	rr := NewRedactionRules([]string{"x-session"}, []string{"Email"}, regexp.MustCompile(`sk_[a-z0-9]+`))
+
+	uriTests := map[string]string{
+		"/path":                                  "/path",
+		"/path?token=abc&page=2":                 "/path?token=[REDACTED]&page=2",
+		"/path?page=2&TOKEN=abc&email=a%40b.com": "/path?page=2&TOKEN=[REDACTED]&email=[REDACTED]",
+		"/keys/sk_live123?q=sk_test9":            "/keys/[REDACTED]?q=[REDACTED]",
+		"/path?token":                            "/path?token",
+	}
+	for uri, want := range uriTests {
+		if got := rr.RedactURL(uri); got != want {
+			t.Errorf("RedactURL(%q) = %q, want %q", uri, got, want)
+		}
+	}
+
+	h := http.Header{
+		"Authorization": {"Bearer secret"},
+		"Set-Cookie":    {"a=1", "b=2"},
+		"X-Session":     {"abc"},
+		"X-Debug":       {"key sk_abc"},
+		"Accept":        {"text/html"},
+	}
+	got := rr.RedactHeaders(h)
+	want := http.Header{
+		"Authorization": {redactedValue},
+		"Set-Cookie":    {redactedValue, redactedValue},
+		"X-Session":     {redactedValue},
+		"X-Debug":       {"key " + redactedValue},
+		"Accept":        {"text/html"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RedactHeaders() = %v, want %v", got, want)
+	}
+	if h.Get("Authorization") != "Bearer secret" {
+		t.Error("RedactHeaders() modified its input")
+	}
+
+	var none *RedactionRules
+	if got := none.RedactURL("/path?token=abc"); got != "/path?token=abc" {
+		t.Errorf("nil rules RedactURL() = %q, want input unchanged", got)
+	}
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// EventRequest is a request-log entry, streamed on /org/applications/{id}/logs/tail
+const EventRequest = "request"
+
+const (
+	// requestLogRecent is how many recent entries are kept per application
+	requestLogRecent = 100
+)
+
+// RequestLogEntry describes a request answered by the local service
+type RequestLogEntry struct {
+	Method     string      `json:"method"`
+	Path       string      `json:"path"`              // Redacted request URI
+	Headers    http.Header `json:"headers,omitempty"` // Redacted request headers
+	Status     int         `json:"status"`
+	DurationMs int64       `json:"durationMs"` // Until the local service responded
+}
+
+// RequestLog keeps the recent requests of each application and publishes new
+// ones to tail streams, on a bus of its own so they stay out of the event feeds
+type RequestLog struct {
+	bus *EventBus
+
+	mu     sync.Mutex
+	recent map[string][]Event // Oldest first, by app ID
+}
+
+// NewRequestLog creates an empty request log
+func NewRequestLog() *RequestLog {
+	return &RequestLog{
+		bus:    NewEventBus(),
+		recent: make(map[string][]Event),
+	}
+}
+
+// Record adds an entry to the application's recent requests and publishes it
+func (rl *RequestLog) Record(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	rl.mu.Lock()
+	recent := append(rl.recent[e.AppID], e)
+	if len(recent) > requestLogRecent {
+		recent = recent[len(recent)-requestLogRecent:]
+	}
+	rl.recent[e.AppID] = recent
+	rl.mu.Unlock()
+
+	rl.bus.Publish(e)
+}
+
+// Recent returns up to limit of the application's most recent entries, oldest first
+func (rl *RequestLog) Recent(appID string, limit int) []Event {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	recent := rl.recent[appID]
+	if limit < len(recent) {
+		recent = recent[len(recent)-limit:]
+	}
+	return append([]Event{}, recent...)
+}
+
+// Close ends all tail streams
+func (rl *RequestLog) Close() {
+	rl.bus.Close()
+}
+
+// recordRequest adds a forwarded request to its application's request log
+func (s *Server) recordRequest(r *http.Request, orgID, appID, subdomain string, status int, start time.Time) {
+	if s.requestLog == nil || appID == "" || !s.featureEnabled(orgID, db.FeatureRequestLog) {
+		return
+	}
+	s.requestLog.Record(Event{
+		Type:      EventRequest,
+		Subdomain: subdomain,
+		OrgID:     orgID,
+		AppID:     appID,
+		ClientIP:  getClientIP(r),
+		Request: &RequestLogEntry{
+			Method:     r.Method,
+			Path:       s.redaction.RedactURL(r.URL.RequestURI()),
+			Headers:    s.redaction.RedactHeaders(r.Header),
+			Status:     status,
+			DurationMs: time.Since(start).Milliseconds(),
+		},
+	})
+}
+
+// handleOrgAppLogsTail streams the application's requests as Server-Sent Events
+// as they happen. With follow=false it returns the recent requests instead;
+// limit (1-100, default 100) caps how many.
+func (s *Server) handleOrgAppLogsTail(w http.ResponseWriter, r *http.Request, orgCtx *OrgContext, appID string) {
+	app, err := s.verifyOrgOwnership(orgCtx, appID)
+	if err != nil || app == nil {
+		jsonError(w, "Application not found", http.StatusNotFound)
+		return
+	}
+
+	if !s.featureEnabled(orgCtx.OrgID, db.FeatureRequestLog) {
+		jsonError(w, "Request logging is not enabled for this organization", http.StatusForbidden)
+		return
+	}
+
+	follow := true
+	if v := r.URL.Query().Get("follow"); v != "" {
+		if follow, err = strconv.ParseBool(v); err != nil {
+			jsonError(w, "follow must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if follow {
+		var bus *EventBus
+		if s.requestLog != nil {
+			bus = s.requestLog.bus
+		}
+		s.streamEvents(w, r, bus, EventFilter{OrgID: orgCtx.OrgID, AppID: app.ID})
+		return
+	}
+
+	limit := requestLogRecent
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > requestLogRecent {
+			jsonError(w, "limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries := []Event{}
+	if s.requestLog != nil {
+		entries = s.requestLog.Recent(app.ID, limit)
+	}
+	jsonResponse(w, map[string]interface{}{"entries": entries})
+}
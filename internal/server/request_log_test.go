@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOrgAppLogsTail(t *testing.T) {
+	database := newTestDB(t)
+
+	org, _ := database.CreateOrganization("acme")
+	other, _ := database.CreateOrganization("other")
+	app, err := database.CreateApplication(org.ID, "web", "web")
+	if err != nil {
+		t.Fatalf("CreateApplication() error: %v", err)
+	}
+	sibling, _ := database.CreateApplication(org.ID, "api", "api")
+	foreign, _ := database.CreateApplication(other.ID, "foreign", "foreign")
+
+	s := newTestServer(database)
+	s.requestLog = NewRequestLog()
+	s.redaction = NewRedactionRules(nil, nil, nil)
+	orgCtx := &OrgContext{AccountID: "acct-1", OrgID: org.ID}
+	record := func(appID, uri string, status int) {
+		r := httptest.NewRequest(http.MethodGet, uri, nil)
+		r.Header.Set("Cookie", "session=secret")
+		s.recordRequest(r, org.ID, appID, "web", status, time.Now())
+	}
+	tail := func(appID, query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.handleOrgAppLogsTail(w, httptest.NewRequest(http.MethodGet, "/org/applications/"+appID+"/logs/tail"+query, nil), orgCtx, appID)
+		return w
+	}
+
+	if w := tail(foreign.ID, "?follow=false"); w.Code != http.StatusNotFound {
+		t.Errorf("tail of another org's app = %d, want 404", w.Code)
+	}
+	if w := tail(app.ID, "?follow=maybe"); w.Code != http.StatusBadRequest {
+		t.Errorf("follow=maybe = %d, want 400", w.Code)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.handleOrgAppLogsTail(w, r, orgCtx, app.ID)
+	}))
+	defer ts.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET logs/tail error: %v", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	reader.ReadString('\n')
+	reader.ReadString('\n')
+
+	record(sibling.ID, "/other", http.StatusOK)
+	record(app.ID, "/login?token=secret&next=/", http.StatusFound)
+
+	if line, _ := reader.ReadString('\n'); line != "event: request\n" {
+		t.Fatalf("event line = %q, want a request for the tailed app only", line)
+	}
+	data, _ := reader.ReadString('\n')
+	var e Event
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &e); err != nil {
+		t.Fatalf("invalid event data %q: %v", data, err)
+	}
+	if e.AppID != app.ID || e.Request == nil || e.Request.Path != "/login?token=[REDACTED]&next=/" || e.Request.Status != http.StatusFound ||
+		e.Request.Headers.Get("Cookie") != redactedValue {
+		t.Errorf("entry = %+v (request %+v)", e, e.Request)
+	}
+
+	record(app.ID, "/second", http.StatusOK)
+	w := tail(app.ID, "?follow=false&limit=1")
+	var recent struct {
+		Entries []Event `json:"entries"`
+	}
+	json.NewDecoder(w.Body).Decode(&recent)
+	if w.Code != http.StatusOK || len(recent.Entries) != 1 || recent.Entries[0].Request.Path != "/second" {
+		t.Errorf("follow=false = %d %+v, want the latest entry", w.Code, recent.Entries)
+	}
+	if w := tail(app.ID, "?follow=false&limit=500"); w.Code != http.StatusBadRequest {
+		t.Errorf("limit=500 = %d, want 400", w.Code)
+	}
+}
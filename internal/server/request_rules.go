@@ -0,0 +1,392 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// EventRequestBlocked is published when a request rule blocks a visitor request
+const EventRequestBlocked = "request.blocked"
+
+const (
+	// maxRequestRulesPerApp bounds the rules checked on every request of an application
+	maxRequestRulesPerApp = 50
+
+	// maxRequestRuleValueLength bounds a rule's value, such as its regular expression
+	maxRequestRuleValueLength = 512
+)
+
+// knownBadUserAgents matches the User-Agent of common vulnerability scanners,
+// used by user_agent rules without a value of their own
+var knownBadUserAgents = regexp.MustCompile(`(?i)(sqlmap|nikto|nmap|masscan|zgrab|nuclei|acunetix|wpscan|dirbuster|gobuster|feroxbuster|havij|w3af|netsparker)`)
+
+// compiledRequestRule is an enabled request rule ready to match requests
+type compiledRequestRule struct {
+	rule     *db.RequestRule
+	re       *regexp.Regexp // path and user_agent rules
+	maxBytes int64          // body_size rules
+}
+
+// compileRequestRule validates a rule and prepares it for matching. The value
+// of header and method rules is normalized in place.
+func compileRequestRule(rule *db.RequestRule) (*compiledRequestRule, error) {
+	if len(rule.Value) > maxRequestRuleValueLength {
+		return nil, fmt.Errorf("value must be at most %d characters", maxRequestRuleValueLength)
+	}
+	compiled := &compiledRequestRule{rule: rule}
+	switch rule.Type {
+	case db.RequestRulePath:
+		if rule.Value == "" {
+			return nil, fmt.Errorf("a path rule needs a regular expression")
+		}
+		re, err := regexp.Compile(rule.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %v", err)
+		}
+		compiled.re = re
+	case db.RequestRuleUserAgent:
+		if rule.Value == "" {
+			compiled.re = knownBadUserAgents
+			break
+		}
+		re, err := regexp.Compile("(?i)" + rule.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %v", err)
+		}
+		compiled.re = re
+	case db.RequestRuleHeader:
+		name := http.CanonicalHeaderKey(strings.TrimSpace(rule.Value))
+		if name == "" || strings.ContainsAny(name, " :\t\r\n") {
+			return nil, fmt.Errorf("a header rule needs a header name")
+		}
+		rule.Value = name
+	case db.RequestRuleMethod:
+		method := strings.ToUpper(strings.TrimSpace(rule.Value))
+		if method == "" || strings.ContainsAny(method, " \t\r\n") {
+			return nil, fmt.Errorf("a method rule needs an HTTP method")
+		}
+		rule.Value = method
+	case db.RequestRuleBodySize:
+		maxBytes, err := strconv.ParseInt(strings.TrimSpace(rule.Value), 10, 64)
+		if err != nil || maxBytes < 0 {
+			return nil, fmt.Errorf("a body_size rule needs a byte count")
+		}
+		rule.Value = strconv.FormatInt(maxBytes, 10)
+		compiled.maxBytes = maxBytes
+	default:
+		return nil, fmt.Errorf("type must be path, header, method, body_size or user_agent")
+	}
+	return compiled, nil
+}
+
+// matches reports whether the request breaks the rule. Bodies of unknown
+// length are not matched here; see limitBody.
+func (c *compiledRequestRule) matches(r *http.Request) bool {
+	switch c.rule.Type {
+	case db.RequestRulePath:
+		return c.re.MatchString(r.URL.Path)
+	case db.RequestRuleUserAgent:
+		return c.re.MatchString(r.UserAgent())
+	case db.RequestRuleHeader:
+		_, ok := r.Header[c.rule.Value]
+		return ok
+	case db.RequestRuleMethod:
+		return r.Method == c.rule.Value
+	case db.RequestRuleBodySize:
+		return r.ContentLength > c.maxBytes
+	}
+	return false
+}
+
+// requestRuleCache keeps the applications' compiled request rules in memory,
+// since they are checked on every request. A nil cache has no rules.
+type requestRuleCache struct {
+	db   *db.DB
+	mu   sync.RWMutex
+	apps map[string][]*compiledRequestRule
+}
+
+// newRequestRuleCache creates an empty request rule cache
+func newRequestRuleCache(database *db.DB) *requestRuleCache {
+	return &requestRuleCache{db: database, apps: make(map[string][]*compiledRequestRule)}
+}
+
+// get returns an application's enabled rules
+func (c *requestRuleCache) get(appID string) ([]*compiledRequestRule, error) {
+	if c == nil {
+		return nil, nil
+	}
+	c.mu.RLock()
+	rules, ok := c.apps[appID]
+	c.mu.RUnlock()
+	if ok {
+		return rules, nil
+	}
+
+	stored, err := c.db.ListAppRequestRules(appID)
+	if err != nil {
+		return nil, err
+	}
+	rules = make([]*compiledRequestRule, 0, len(stored))
+	for _, rule := range stored {
+		if !rule.Enabled {
+			continue
+		}
+		compiled, err := compileRequestRule(rule)
+		if err != nil {
+			log.Printf("Skipping invalid request rule %s of app %s: %v", rule.ID, appID, err)
+			continue
+		}
+		rules = append(rules, compiled)
+	}
+	c.mu.Lock()
+	c.apps[appID] = rules
+	c.mu.Unlock()
+	return rules, nil
+}
+
+// invalidate drops an application's cached rules after they changed
+func (c *requestRuleCache) invalidate(appID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	delete(c.apps, appID)
+	c.mu.Unlock()
+}
+
+// blockedByRequestRules checks a visitor request against its application's
+// rules and answers 403 when one matches. Rules that cannot be loaded let the
+// request through, so a database hiccup does not take applications down.
+func (s *Server) blockedByRequestRules(w http.ResponseWriter, r *http.Request, orgID, appID, subdomain string) bool {
+	if appID == "" {
+		return false
+	}
+	rules, err := s.requestRules.get(appID)
+	if err != nil {
+		log.Printf("Failed to load request rules of app %s: %v", appID, err)
+		return false
+	}
+
+	for _, rule := range rules {
+		if !rule.matches(r) {
+			continue
+		}
+		clientIP := auth.GetClientIP(r)
+		reason := fmt.Sprintf("Request rule %s (%s %q) matched %s %s", rule.rule.ID, rule.rule.Type, rule.rule.Value, r.Method, r.URL.Path)
+		log.Printf("Blocked request to %s from %s: %s", subdomain, clientIP, reason)
+		if s.db != nil {
+			if err := s.db.LogAuthFailure(&orgID, &appID, db.AuditTypeRequestBlocked, clientIP, reason); err != nil {
+				log.Printf("Failed to audit blocked request: %v", err)
+			}
+		}
+		s.publishEvent(Event{
+			Type:      EventRequestBlocked,
+			Subdomain: subdomain,
+			OrgID:     orgID,
+			AppID:     appID,
+			ClientIP:  clientIP,
+			Reason:    reason,
+		})
+		s.writeVisitorError(w, r, orgID, http.StatusForbidden, errCodeRequestBlocked, "Request blocked by the application's rules")
+		return true
+	}
+
+	limitBody(w, r, rules)
+	return false
+}
+
+// limitBody caps a body of unknown length, such as a chunked upload, at the
+// smallest body_size rule, since it cannot be checked before it is read
+func limitBody(w http.ResponseWriter, r *http.Request, rules []*compiledRequestRule) {
+	if r.ContentLength >= 0 || r.Body == nil {
+		return
+	}
+	limit := int64(-1)
+	for _, rule := range rules {
+		if rule.rule.Type == db.RequestRuleBodySize && (limit < 0 || rule.maxBytes < limit) {
+			limit = rule.maxBytes
+		}
+	}
+	if limit >= 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
+}
+
+// requestRuleInput is the body of the request rule create and update endpoints
+type requestRuleInput struct {
+	Type        string `json:"type"`
+	Value       string `json:"value"`
+	Description string `json:"description,omitempty"`
+	Enabled     *bool  `json:"enabled,omitempty"` // Defaults to true
+}
+
+// decodeRequestRule reads and validates a rule from the request body
+func decodeRequestRule(w http.ResponseWriter, r *http.Request, rule *db.RequestRule) bool {
+	if !validateOrgJSONRequest(w, r) {
+		return false
+	}
+	var req requestRuleInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return false
+	}
+	if len(req.Description) > maxRequestRuleValueLength {
+		jsonError(w, fmt.Sprintf("description must be at most %d characters", maxRequestRuleValueLength), http.StatusBadRequest)
+		return false
+	}
+
+	rule.Type = req.Type
+	rule.Value = req.Value
+	rule.Description = strings.TrimSpace(req.Description)
+	rule.Enabled = req.Enabled == nil || *req.Enabled
+	if _, err := compileRequestRule(rule); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// handleOrgListRequestRules lists an application's request rules
+func (s *Server) handleOrgListRequestRules(w http.ResponseWriter, r *http.Request, orgCtx *OrgContext, appID string) {
+	app, err := s.verifyOrgOwnership(orgCtx, appID)
+	if err != nil {
+		log.Printf("Failed to get application: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if app == nil {
+		jsonError(w, "Application not found", http.StatusNotFound)
+		return
+	}
+
+	rules, err := s.db.ListAppRequestRules(app.ID)
+	if err != nil {
+		log.Printf("Failed to list request rules: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if rules == nil {
+		rules = []*db.RequestRule{}
+	}
+	jsonResponse(w, map[string]interface{}{
+		"rules":    rules,
+		"maxRules": maxRequestRulesPerApp,
+	})
+}
+
+// handleOrgCreateRequestRule adds a request rule to an application
+func (s *Server) handleOrgCreateRequestRule(w http.ResponseWriter, r *http.Request, orgCtx *OrgContext, appID string) {
+	app, err := s.verifyOrgOwnership(orgCtx, appID)
+	if err != nil {
+		log.Printf("Failed to get application: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if app == nil {
+		jsonError(w, "Application not found", http.StatusNotFound)
+		return
+	}
+
+	rule := &db.RequestRule{AppID: app.ID}
+	if !decodeRequestRule(w, r, rule) {
+		return
+	}
+
+	count, err := s.db.CountAppRequestRules(app.ID)
+	if err != nil {
+		log.Printf("Failed to count request rules: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if count >= maxRequestRulesPerApp {
+		jsonError(w, fmt.Sprintf("An application can have at most %d request rules", maxRequestRulesPerApp), http.StatusConflict)
+		return
+	}
+
+	if err := s.db.CreateAppRequestRule(rule); err != nil {
+		log.Printf("Failed to create request rule: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	s.requestRules.invalidate(app.ID)
+
+	log.Printf("Request rule %s (%s %q) added to app %s by %s", rule.ID, rule.Type, rule.Value, app.Subdomain, orgCtx.Username)
+	jsonResponse(w, map[string]interface{}{"success": true, "rule": rule})
+}
+
+// handleOrgUpdateRequestRule replaces one of an application's request rules
+func (s *Server) handleOrgUpdateRequestRule(w http.ResponseWriter, r *http.Request, orgCtx *OrgContext, appID, ruleID string) {
+	app, err := s.verifyOrgOwnership(orgCtx, appID)
+	if err != nil {
+		log.Printf("Failed to get application: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if app == nil {
+		jsonError(w, "Application not found", http.StatusNotFound)
+		return
+	}
+
+	rule, err := s.db.GetAppRequestRule(app.ID, ruleID)
+	if err != nil {
+		log.Printf("Failed to get request rule: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if rule == nil {
+		jsonError(w, "Request rule not found", http.StatusNotFound)
+		return
+	}
+	if !decodeRequestRule(w, r, rule) {
+		return
+	}
+
+	if err := s.db.UpdateAppRequestRule(rule); err != nil {
+		log.Printf("Failed to update request rule: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	s.requestRules.invalidate(app.ID)
+
+	log.Printf("Request rule %s of app %s updated by %s", rule.ID, app.Subdomain, orgCtx.Username)
+	jsonResponse(w, map[string]interface{}{"success": true, "rule": rule})
+}
+
+// handleOrgDeleteRequestRule removes one of an application's request rules
+func (s *Server) handleOrgDeleteRequestRule(w http.ResponseWriter, r *http.Request, orgCtx *OrgContext, appID, ruleID string) {
+	app, err := s.verifyOrgOwnership(orgCtx, appID)
+	if err != nil {
+		log.Printf("Failed to get application: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if app == nil {
+		jsonError(w, "Application not found", http.StatusNotFound)
+		return
+	}
+
+	deleted, err := s.db.DeleteAppRequestRule(app.ID, ruleID)
+	if err != nil {
+		log.Printf("Failed to delete request rule: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		jsonError(w, "Request rule not found", http.StatusNotFound)
+		return
+	}
+	s.requestRules.invalidate(app.ID)
+
+	log.Printf("Request rule %s removed from app %s by %s", ruleID, app.Subdomain, orgCtx.Username)
+	jsonResponse(w, map[string]interface{}{"success": true})
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestRequestRules(t *testing.T) {
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	app, err := database.CreateApplication(org.ID, "shop", "Shop")
+	if err != nil {
+		t.Fatalf("CreateApplication() error: %v", err)
+	}
+	s := newTestServer(database)
+	orgCtx := &OrgContext{OrgID: org.ID, Username: "alice"}
+
+	create := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/org/applications/"+app.ID+"/rules", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		s.handleOrgCreateRequestRule(w, r, orgCtx, app.ID)
+		return w
+	}
+	for _, body := range []string{
+		`{"type":"path","value":"("}`,
+		`{"type":"path","value":""}`,
+		`{"type":"body_size","value":"lots"}`,
+		`{"type":"header","value":"X Bad"}`,
+		`{"type":"cookie","value":"x"}`,
+	} {
+		if w := create(body); w.Code != http.StatusBadRequest {
+			t.Errorf("create %s = %d, want 400", body, w.Code)
+		}
+	}
+	for _, body := range []string{
+		`{"type":"path","value":"^/wp-(admin|login)","description":"No WordPress here"}`,
+		`{"type":"header","value":"x-debug-token"}`,
+		`{"type":"method","value":"trace"}`,
+		`{"type":"body_size","value":"1024"}`,
+		`{"type":"user_agent","value":""}`,
+		`{"type":"path","value":"^/old","enabled":false}`,
+	} {
+		if w := create(body); w.Code != http.StatusOK {
+			t.Fatalf("create %s = %d: %s", body, w.Code, w.Body.String())
+		}
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		header  map[string]string
+		body    string
+		blocked bool
+	}{
+		{"plain request", http.MethodGet, "/products", nil, "", false},
+		{"blocked path", http.MethodGet, "/wp-login.php", nil, "", true},
+		{"disabled rule", http.MethodGet, "/old/page", nil, "", false},
+		{"blocked header", http.MethodGet, "/", map[string]string{"X-Debug-Token": "1"}, "", true},
+		{"blocked method", "TRACE", "/", nil, "", true},
+		{"known scanner", http.MethodGet, "/", map[string]string{"User-Agent": "sqlmap/1.7"}, "", true},
+		{"browser", http.MethodGet, "/", map[string]string{"User-Agent": "Mozilla/5.0"}, "", false},
+		{"small body", http.MethodPost, "/upload", nil, strings.Repeat("a", 1024), false},
+		{"large body", http.MethodPost, "/upload", nil, strings.Repeat("a", 1025), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "http://shop.link.test"+tt.path, strings.NewReader(tt.body))
+			r.Header.Set("Accept", "application/json")
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			if got := s.blockedByRequestRules(w, r, org.ID, app.ID, "shop"); got != tt.blocked {
+				t.Fatalf("blocked = %v, want %v", got, tt.blocked)
+			}
+			if tt.blocked && (w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), errCodeRequestBlocked)) {
+				t.Errorf("blocked response = %d %s, want 403 %s", w.Code, w.Body.String(), errCodeRequestBlocked)
+			}
+		})
+	}
+
+	// Bodies of unknown length are cut off at the body_size limit
+	r := httptest.NewRequest(http.MethodPost, "http://shop.link.test/upload", strings.NewReader(strings.Repeat("a", 2048)))
+	r.ContentLength = -1
+	if s.blockedByRequestRules(httptest.NewRecorder(), r, org.ID, app.ID, "shop") {
+		t.Fatal("chunked upload blocked before it was read")
+	}
+	if _, err := io.ReadAll(r.Body); err == nil {
+		t.Error("reading a chunked body over the body_size limit succeeded")
+	}
+
+	events, err := database.GetAuditEvents(&org.ID, nil, 20, 0)
+	if err != nil {
+		t.Fatalf("GetAuditEvents() error: %v", err)
+	}
+	blocked := 0
+	for _, event := range events {
+		if event.AuthType == db.AuditTypeRequestBlocked && !event.Success && event.AppID != nil && *event.AppID == app.ID {
+			blocked++
+		}
+	}
+	if blocked != 5 {
+		t.Errorf("%d request_blocked audit events, want 5", blocked)
+	}
+
+	// Changes apply to the next request
+	rules, err := database.ListAppRequestRules(app.ID)
+	if err != nil || len(rules) != 6 {
+		t.Fatalf("ListAppRequestRules() = %d rules, %v; want 6", len(rules), err)
+	}
+	w := httptest.NewRecorder()
+	del := httptest.NewRequest(http.MethodDelete, "/org/applications/"+app.ID+"/rules/"+rules[0].ID, nil)
+	s.handleOrgDeleteRequestRule(w, del, orgCtx, app.ID, rules[0].ID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete rule = %d: %s", w.Code, w.Body.String())
+	}
+	if s.blockedByRequestRules(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://shop.link.test/wp-login.php", nil), org.ID, app.ID, "shop") {
+		t.Error("request blocked by a deleted rule")
+	}
+	w = httptest.NewRecorder()
+	put := httptest.NewRequest(http.MethodPut, "/org/applications/"+app.ID+"/rules/"+rules[5].ID, strings.NewReader(`{"type":"path","value":"^/old"}`))
+	put.Header.Set("Content-Type", "application/json")
+	s.handleOrgUpdateRequestRule(w, put, orgCtx, app.ID, rules[5].ID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update rule = %d: %s", w.Code, w.Body.String())
+	}
+	if !s.blockedByRequestRules(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://shop.link.test/old/page", nil), org.ID, app.ID, "shop") {
+		t.Error("request not blocked by a re-enabled rule")
+	}
+
+	// Another organization can't see or change the rules
+	otherOrg, _ := database.CreateOrganization("globex")
+	w = httptest.NewRecorder()
+	s.handleOrgListRequestRules(w, httptest.NewRequest(http.MethodGet, "/org/applications/"+app.ID+"/rules", nil), &OrgContext{OrgID: otherOrg.ID}, app.ID)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("list rules of another org's app = %d, want 404", w.Code)
+	}
+
+	// The number of rules is bounded
+	for i := len(rules) - 1; i < maxRequestRulesPerApp; i++ {
+		if w := create(`{"type":"method","value":"PATCH"}`); w.Code != http.StatusOK {
+			t.Fatalf("create rule %d = %d: %s", i+1, w.Code, w.Body.String())
+		}
+	}
+	if w := create(`{"type":"method","value":"PATCH"}`); w.Code != http.StatusConflict {
+		t.Errorf("create rule over the limit = %d, want 409", w.Code)
+	}
+}
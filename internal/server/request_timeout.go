@@ -0,0 +1,68 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// defaultTunnelRequestTimeout is how long a forwarded request waits for the client's response
+const defaultTunnelRequestTimeout = 5 * time.Minute
+
+// requestAckState describes whether the tunnel client acknowledged receiving a request
+type requestAckState int
+
+const (
+	// ackUnsupported means the client has not been seen acknowledging requests (older clients)
+	ackUnsupported requestAckState = iota
+	// ackPending means the client acknowledges requests but has not acknowledged this one
+	ackPending
+	// ackReceived means the client received the request and is waiting on the local service
+	ackReceived
+)
+
+// writeTunnelTimeout responds with a 504 explaining how far the request got, so users can
+// tell a slow local service from an unresponsive or disconnected tunnel client
+func (s *Server) writeTunnelTimeout(w http.ResponseWriter, r *http.Request, orgID string, state requestAckState, connected bool) {
+	w.Header().Set("X-Digit-Link-Tunnel-State", tunnelTimeoutState(state, connected))
+	s.writeVisitorError(w, r, orgID, http.StatusGatewayTimeout, errCodeTunnelTimeout, tunnelTimeoutMessage(state, connected, s.requestTimeout))
+}
+
+// tunnelTimeoutState returns a short machine-readable reason for a tunnel timeout
+func tunnelTimeoutState(state requestAckState, connected bool) string {
+	switch {
+	case !connected:
+		return "disconnected"
+	case state == ackReceived:
+		return "acknowledged"
+	case state == ackPending:
+		return "unacknowledged"
+	}
+	return "unknown"
+}
+
+// tunnelTimeoutMessage returns the body of a tunnel timeout response
+func tunnelTimeoutMessage(state requestAckState, connected bool, timeout time.Duration) string {
+	switch {
+	case !connected:
+		return "Tunnel timeout: the tunnel client disconnected before responding"
+	case state == ackReceived:
+		return fmt.Sprintf("Tunnel timeout: the tunnel client received the request, but the local service did not respond within %s", timeout)
+	case state == ackPending:
+		return fmt.Sprintf("Tunnel timeout: the tunnel client is connected but never acknowledged the request within %s", timeout)
+	}
+	return fmt.Sprintf("Tunnel timeout: no response within %s (the tunnel client is connected but does not report request delivery; upgrade it for more detail)", timeout)
+}
+
+// GetTunnelRequestTimeout returns how long forwarded requests wait for a response from environment or default
+func GetTunnelRequestTimeout() time.Duration {
+	if timeout := os.Getenv("TUNNEL_REQUEST_TIMEOUT"); timeout != "" {
+		var d int
+		fmt.Sscanf(timeout, "%d", &d)
+		if d > 0 {
+			return time.Duration(d) * time.Second
+		}
+	}
+	return defaultTunnelRequestTimeout
+}
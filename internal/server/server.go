@@ -1,14 +1,18 @@
 package server
 
 import (
+	"context"
 	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -76,12 +80,105 @@ type Server struct {
 	// Rate limiter for login endpoints
 	loginRateLimiter *auth.RateLimiter
 
+	// Rate limiter for API key introspection, so it cannot be used as a key oracle
+	introspectRateLimiter *auth.RateLimiter
+
 	// Usage tracking and quota enforcement
 	usageCache   *UsageCache
 	quotaChecker *QuotaChecker
 
+	// Forwarded requests in flight per organization, capped by the plan
+	inFlight *inFlightCounter
+
+	// Per-application request analytics
+	analyticsCache *AnalyticsCache
+
+	// Server settings changed at runtime through the admin API
+	settings *settingsCache
+
+	// Per-organization feature flag overrides
+	featureFlags *featureFlagCache
+
+	// Per-application rules blocking matching requests
+	requestRules *requestRuleCache
+
 	// TCP tunnel listener (yamux-based)
 	tunnelListener *TunnelListener
+
+	// HTTP server (set by Run, used for graceful shutdown)
+	httpServer *http.Server
+
+	// Guards httpServer, set and read from different goroutines
+	serversMu sync.Mutex
+
+	// Number of workers delivering responses per WebSocket tunnel
+	dispatchWorkers int
+
+	// How long forwarded requests wait for the client's response
+	requestTimeout time.Duration
+
+	// Minimum time failed logins take to answer, to slow down credential probing
+	failureDelay auth.FailureDelay
+
+	// Default limit on request and response header size per tunnel request
+	maxHeaderBytes int
+
+	// Limits on a single WebSocket message from a tunnel client, and on a
+	// message reassembled from fragments
+	maxMessageBytes  int
+	maxResponseBytes int
+
+	// Default limit on forwards registered by one client connection (0 = unlimited)
+	maxForwards int
+
+	// Naming rules for tunnel and application subdomains
+	subdomainPolicy SubdomainPolicy
+
+	// How long a tunnel's reconnect token can resume its subdomain (0 = disabled)
+	reconnectTokenTTL time.Duration
+
+	// How long an unresponsive tunnel keeps its concurrency slot from a reconnecting client (0 = disabled)
+	reconnectGrace time.Duration
+
+	// Rules removing tokens and PII from logged, persisted and streamed request details
+	redaction *RedactionRules
+
+	// Via entry added to tunneled responses ("" = disabled)
+	via string
+
+	// What assigning a plan below the organization's current usage does
+	planDowngradePolicy PlanDowngradePolicy
+
+	// Exports a span per forwarded request (nil = tracing off)
+	tracer *Tracer
+
+	// Hash of the one-time token required by /setup/init ("" = setup closed)
+	setupTokenHash string
+	setupMu        sync.Mutex
+
+	// Reject registrations that authenticate with the legacy secret instead of a token
+	disableLegacySecret bool
+
+	// How long an admin whose TOTP was reset can log in with password only to re-enroll (0 = unlimited)
+	totpResetGrace time.Duration
+
+	// How long an unverified TOTP setup is kept before its secret is cleared (0 = until replaced)
+	totpSetupTimeout time.Duration
+
+	// Let requests through when their auth policy cannot be loaded (fail-open)
+	authFailOpen bool
+
+	// Live tunnel and auth events for the admin event stream
+	events *EventBus
+
+	// Recent and live requests per application for log tails
+	requestLog *RequestLog
+
+	// Identical concurrent GETs sharing one backend request, for apps that enable it
+	coalescer requestCoalescer
+
+	// Request and error counts since the last metrics snapshot
+	metrics serverMetrics
 }
 
 // New creates a new tunnel server
@@ -95,6 +192,33 @@ func New(domain, scheme, secret string, database *db.DB) *Server {
 		secret:  secret,
 		db:      database,
 		tunnels: make(map[string]*Tunnel),
+
+		dispatchWorkers: GetTunnelDispatchWorkers(),
+		requestTimeout:  GetTunnelRequestTimeout(),
+		failureDelay:    auth.GetFailureDelay(),
+		maxHeaderBytes:  GetTunnelMaxHeaderBytes(),
+		events:          NewEventBus(),
+		requestLog:      NewRequestLog(),
+		inFlight:        newInFlightCounter(),
+
+		maxMessageBytes:     GetTunnelMaxMessageBytes(),
+		maxResponseBytes:    GetTunnelMaxResponseBytes(),
+		maxForwards:         GetTunnelMaxForwards(),
+		subdomainPolicy:     GetSubdomainPolicy(),
+		reconnectTokenTTL:   GetReconnectTokenTTL(),
+		reconnectGrace:      GetReconnectGrace(),
+		redaction:           GetRedactionRules(),
+		via:                 GetViaHeader(),
+		planDowngradePolicy: GetPlanDowngradePolicy(),
+		authFailOpen:        GetAuthFailOpen(),
+		disableLegacySecret: GetDisableLegacySecret(),
+		totpResetGrace:      GetTOTPResetGrace(),
+		totpSetupTimeout:    GetTOTPSetupTimeout(),
+		tracer:              GetTracer(),
+	}
+	s.tracer.Start()
+	if s.disableLegacySecret && secret != "" {
+		log.Println("Legacy secret authentication is disabled (DISABLE_LEGACY_SECRET); SECRET is ignored")
 	}
 
 	// Initialize WebSocket upgrader with origin validation
@@ -135,7 +259,16 @@ func New(domain, scheme, secret string, database *db.DB) *Server {
 
 	// Initialize auth handlers if database is available
 	if database != nil {
-		s.authMiddleware = NewAuthMiddleware(database, WithDefaultDeny(true), WithScheme(scheme), WithDomain(domain))
+		s.authMiddleware = NewAuthMiddleware(database, WithDefaultDeny(!s.authFailOpen), WithScheme(scheme), WithDomain(domain))
+		s.settings = newSettingsCache(database)
+		s.featureFlags = newFeatureFlagCache(database)
+		s.requestRules = newRequestRuleCache(database)
+		s.loadSettings()
+		if s.authFailOpen {
+			log.Printf("WARNING: AUTH_FAIL_OPEN is set: requests are ALLOWED WITHOUT AUTHENTICATION when their auth policy cannot be loaded")
+		} else {
+			log.Printf("Auth mode: %s (requests are denied when their auth policy cannot be loaded)", authModeFailClosed)
+		}
 		s.oidcHandler = auth.NewOIDCAuthHandler(database, domain)
 		// Initialize rate limiter for login endpoints with stricter settings
 		s.loginRateLimiter = auth.NewRateLimiter(database, auth.RateLimiterConfig{
@@ -144,11 +277,22 @@ func New(domain, scheme, secret string, database *db.DB) *Server {
 			BlockDuration:   30 * time.Minute,
 			CleanupInterval: 5 * time.Minute,
 		})
+		s.introspectRateLimiter = auth.NewRateLimiter(database, auth.RateLimiterConfig{
+			WindowDuration:  15 * time.Minute,
+			MaxAttempts:     20,
+			BlockDuration:   15 * time.Minute,
+			CleanupInterval: 5 * time.Minute,
+		})
 
 		// Initialize usage tracking and quota enforcement
 		s.usageCache = NewUsageCache(database)
 		s.usageCache.Start()
 		s.quotaChecker = NewQuotaChecker(s.usageCache, database)
+
+		s.analyticsCache = NewAnalyticsCache(database)
+		s.analyticsCache.Start()
+
+		s.initSetupToken()
 	}
 
 	return s
@@ -217,6 +361,20 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Extract subdomain from Host header
 	subdomain := s.extractSubdomain(r.Host)
 
+	// Every response for a tunnel subdomain is counted once in the server metrics,
+	// whether it came from the tunnel or was answered here
+	counted := &statusRecorder{ResponseWriter: w}
+	defer func() { s.metrics.countRequest(counted.status) }()
+	w = counted
+
+	// The application's settings are read from one lookup for the whole request
+	app := s.authMiddleware.appForSubdomain(subdomain)
+
+	// Tunnels forcing HTTPS redirect or reject plain HTTP before anything else
+	if s.enforceHTTPS(w, r, subdomain, app) {
+		return
+	}
+
 	// Handle tunnel-level auth endpoints (mounted on subdomain)
 	if strings.HasPrefix(r.URL.Path, "/__auth/") {
 		s.handleTunnelAuth(w, r, subdomain)
@@ -244,6 +402,16 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Uploaded favicons are served without authentication or reaching the tunnel
+	if isFaviconRequest(r) && s.serveAppFavicon(w, r, subdomain) {
+		return
+	}
+
+	// So are the application's public static responses, even while no tunnel is connected
+	if s.serveStaticResponse(w, r, app, false) {
+		return
+	}
+
 	// Find tunnel for subdomain - check WebSocket tunnels first
 	s.mu.RLock()
 	wsTunnel, wsOk := s.tunnels[subdomain]
@@ -257,29 +425,102 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !wsOk && !tcpOk {
-		http.Error(w, fmt.Sprintf("Tunnel '%s' not found", subdomain), http.StatusNotFound)
+		// Error pages still get an icon
+		if isFaviconRequest(r) {
+			serveFavicon(w, r, defaultFavicon)
+			return
+		}
+
+		// Only browsers get a branded page, so skip the application lookup for everyone else
+		orgID := ""
+		if acceptsHTML(r) {
+			orgID = s.orgIDForSubdomain(subdomain)
+		}
+		s.writeVisitorError(w, r, orgID, http.StatusNotFound, errCodeTunnelNotFound, fmt.Sprintf("Tunnel '%s' not found", subdomain))
+		return
+	}
+
+	var orgID, appID string
+	if wsOk {
+		orgID, appID = wsTunnel.OrgID, wsTunnel.AppID
+	} else {
+		_, orgID, appID = tcpSession.GetAccountInfo()
+	}
+
+	// Requests matching the application's rules are blocked before anything else
+	if s.blockedByRequestRules(w, r, orgID, appID, subdomain) {
 		return
 	}
 
 	// Apply tunnel-level authentication if middleware is configured
+	var result *policy.AuthResult
+	var authCtx *policy.AuthContext
 	if s.authMiddleware != nil {
-		result, authCtx := s.authMiddleware.AuthenticateRequest(w, r, subdomain)
+		result, authCtx = s.authMiddleware.AuthenticateRequest(w, r, subdomain)
 
 		// Get the effective policy from context for challenge handling
 		effectivePolicy := GetEffectivePolicyFromContext(r)
 
 		if !s.authMiddleware.HandleAuthResult(w, r, result, effectivePolicy, authCtx) {
 			// Auth failed, response already sent
+			if !result.ShouldRedirect && !result.ShouldChallenge {
+				e := Event{Type: EventAuthFailed, Subdomain: subdomain, ClientIP: auth.GetClientIP(r), Reason: result.Error}
+				if authCtx != nil {
+					e.OrgID, e.AppID = authCtx.OrgID, authCtx.AppID
+				}
+				s.publishEvent(e)
+			}
 			return
 		}
 	}
 
+	// The other static responses are only served to visitors who got past the rules and auth
+	if s.serveStaticResponse(w, r, app, true) {
+		return
+	}
+
+	// Visitors of a client whose local service is not up yet get a 503 instead of a 502
+	if wsOk && wsTunnel.degraded.Load() {
+		s.writeTunnelDegraded(w, r, wsTunnel.OrgID, subdomain)
+		return
+	}
+	if tcpOk && tcpSession.Degraded() {
+		_, orgID, _ := tcpSession.GetAccountInfo()
+		s.writeTunnelDegraded(w, r, orgID, subdomain)
+		return
+	}
+
+	// Tell the local service who the visitor is, as configured by the app
+	setIdentityHeaders(r, result, authCtx)
+
+	// Trace the forwarded request. The backend receives the span as its parent.
+	if span := s.tracer.StartSpan(r, r.Method); span != nil {
+		span.SetAttribute("http.request.method", r.Method)
+		span.SetAttribute("digitlink.subdomain", subdomain)
+		span.SetAttribute("digitlink.app_id", appID)
+		for name, values := range s.redaction.RedactHeaders(r.Header) {
+			span.SetAttribute("http.request.header."+strings.ToLower(name), strings.Join(values, ", "))
+		}
+		r.Header.Set("Traceparent", span.Traceparent())
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		defer func() { span.End(recorder.status) }()
+		w = recorder
+	}
+
 	// Forward request through appropriate tunnel type
-	if wsOk {
-		s.forwardRequest(w, r, wsTunnel)
-	} else {
-		s.forwardRequestViaTCP(w, r, tcpSession, subdomain)
+	forward := func(w http.ResponseWriter) {
+		if wsOk {
+			s.forwardRequest(w, r, wsTunnel, app)
+		} else {
+			s.forwardRequestViaTCP(w, r, tcpSession, subdomain, app)
+		}
+	}
+	if appID != "" && isCoalescable(r) && app != nil && app.Coalesce && !app.StreamingMode {
+		s.forwardCoalesced(w, r, orgID, appID, subdomain, forward)
+		return
 	}
+	forward(w)
 }
 
 // handlePublicAPI handles public API endpoints that don't require authentication
@@ -289,8 +530,12 @@ func (s *Server) handlePublicAPI(w http.ResponseWriter, r *http.Request) {
 	switch {
 	case path == "/plans" && r.Method == http.MethodGet:
 		s.handlePublicListPlans(w, r)
+	case path == "/health" && r.Method == http.MethodGet:
+		s.handlePublicHealth(w, r)
+	case path == "/whoami" && r.Method == http.MethodGet:
+		s.handleWhoAmI(w, r)
 	default:
-		http.Error(w, "Not found", http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Not found")
 	}
 }
 
@@ -298,7 +543,7 @@ func (s *Server) handlePublicAPI(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handlePublicListPlans(w http.ResponseWriter, r *http.Request) {
 	plans, err := s.db.ListPlans()
 	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 
@@ -372,9 +617,12 @@ func (s *Server) GetActiveTunnels() []map[string]interface{} {
 	tunnels := make([]map[string]interface{}, 0, len(s.tunnels))
 	for subdomain, tunnel := range s.tunnels {
 		tunnels = append(tunnels, map[string]interface{}{
-			"subdomain": subdomain,
-			"url":       fmt.Sprintf("%s://%s.%s", s.scheme, subdomain, s.domain),
-			"createdAt": tunnel.CreatedAt,
+			"subdomain":         subdomain,
+			"url":               fmt.Sprintf("%s://%s.%s", s.scheme, subdomain, s.domain),
+			"createdAt":         tunnel.CreatedAt,
+			"maxBytesPerSecond": tunnel.limiter.Rate(),
+			"degraded":          tunnel.degraded.Load(),
+			"localTarget":       tunnel.LocalTarget,
 		})
 	}
 	return tunnels
@@ -398,6 +646,11 @@ func (s *Server) extractSubdomain(host string) string {
 		domain = domain[:idx]
 	}
 
+	// Hostnames are case-insensitive and may carry a trailing root dot;
+	// subdomains are registered lowercase, so normalize before lookup
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+
 	// Check if it's a subdomain of our domain
 	if !strings.HasSuffix(host, domain) {
 		return ""
@@ -412,6 +665,11 @@ func (s *Server) extractSubdomain(host string) string {
 	return subdomain
 }
 
+// tokenExpiredMessage is the error returned to clients authenticating with an expired account token
+func tokenExpiredMessage(expiresAt time.Time) string {
+	return fmt.Sprintf("Token expired on %s; ask an administrator to regenerate it", expiresAt.UTC().Format("2006-01-02 15:04 MST"))
+}
+
 // handleWebSocket handles WebSocket connections from tunnel clients
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	// Get client IP for whitelist check
@@ -430,11 +688,21 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Oversized messages close the connection with 1009 (message too big)
+	// instead of being buffered in full
+	if s.maxMessageBytes > 0 {
+		conn.SetReadLimit(int64(s.maxMessageBytes))
+	}
+
 	// Wait for registration message
 	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
 	_, msg, err := conn.ReadMessage()
 	if err != nil {
-		log.Printf("Failed to read registration: %v", err)
+		if errors.Is(err, websocket.ErrReadLimit) {
+			log.Printf("Registration from %s exceeds %d bytes, closing", clientIP, s.maxMessageBytes)
+		} else {
+			log.Printf("Failed to read registration: %v", err)
+		}
 		conn.Close()
 		return
 	}
@@ -468,21 +736,37 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	var app *db.Application
 	var orgID string
 
+	// reject refuses the registration and reports it on the event stream
+	reject := func(code protocol.RegisterCode, msg string) {
+		s.sendRegisterResponse(conn, protocol.RegisterResponse{Error: msg, Code: code})
+		conn.Close()
+		e := Event{Type: EventTunnelRejected, Subdomain: regReq.Subdomain, OrgID: orgID, ClientIP: clientIP, Reason: msg}
+		if account != nil {
+			e.AccountID = account.ID
+		}
+		s.publishEvent(e)
+	}
+
+	// With legacy secret authentication disabled, every registration needs a token
+	if regReq.Token == "" && s.disableLegacySecret {
+		log.Printf("Authentication failed for subdomain %s from %s: no token provided and legacy secret authentication is disabled", regReq.Subdomain, clientIP)
+		reject(protocol.RegisterCodeAuthRequired, "Authentication required: provide a valid token")
+		return
+	}
+
 	if s.db != nil {
 		// Try token-based authentication first
 		if regReq.Token == "" {
 			// Fallback to legacy secret if no token provided
 			if s.secret != "" && regReq.Secret != s.secret {
 				log.Printf("Authentication failed for subdomain %s from %s: no valid token or secret", regReq.Subdomain, clientIP)
-				s.sendRegisterResponse(conn, false, "", "", "Authentication required: provide a valid token")
-				conn.Close()
+				reject(protocol.RegisterCodeAuthRequired, "Authentication required: provide a valid token")
 				return
 			}
 			// Legacy mode without token - skip account/IP checks if secret matches
 			if s.secret == "" {
 				log.Printf("Authentication failed for subdomain %s from %s: no token provided", regReq.Subdomain, clientIP)
-				s.sendRegisterResponse(conn, false, "", "", "Authentication required: provide a valid token")
-				conn.Close()
+				reject(protocol.RegisterCodeAuthRequired, "Authentication required: provide a valid token")
 				return
 			}
 		} else {
@@ -491,8 +775,7 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 			apiKey, err = s.db.GetAPIKeyByHash(apiKeyHash)
 			if err != nil {
 				log.Printf("Database error during API key lookup: %v", err)
-				s.sendRegisterResponse(conn, false, "", "", "Internal server error")
-				conn.Close()
+				reject(protocol.RegisterCodeInternal, "Internal server error")
 				return
 			}
 
@@ -500,8 +783,7 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 				// Check if key is expired
 				if apiKey.ExpiresAt != nil && apiKey.ExpiresAt.Before(time.Now()) {
 					log.Printf("Authentication failed for subdomain %s from %s: API key expired", regReq.Subdomain, clientIP)
-					s.sendRegisterResponse(conn, false, "", "", "API key has expired")
-					conn.Close()
+					reject(protocol.RegisterCodeTokenExpired, "API key has expired")
 					return
 				}
 
@@ -511,16 +793,19 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 					app, err = s.db.GetApplicationByID(*apiKey.AppID)
 					if err != nil || app == nil {
 						log.Printf("Authentication failed for subdomain %s from %s: app not found for API key", regReq.Subdomain, clientIP)
-						s.sendRegisterResponse(conn, false, "", "", "Application not found for API key")
-						conn.Close()
+						reject(protocol.RegisterCodeAppNotFound, "Application not found for API key")
+						return
+					}
+					if app.ReleasedAt != nil {
+						log.Printf("Authentication failed for subdomain %s from %s: app %s was released", regReq.Subdomain, clientIP, app.ID)
+						reject(protocol.RegisterCodeAppReleased, "Application was released after being offline; restore it to connect")
 						return
 					}
 
 					// For app API keys, enforce the subdomain must match the app's subdomain
 					if regReq.Subdomain != "" && strings.ToLower(regReq.Subdomain) != app.Subdomain {
 						log.Printf("Authentication failed for subdomain %s from %s: app API key can only connect to %s", regReq.Subdomain, clientIP, app.Subdomain)
-						s.sendRegisterResponse(conn, false, "", "", fmt.Sprintf("This API key can only connect to subdomain '%s'", app.Subdomain))
-						conn.Close()
+						reject(protocol.RegisterCodeAppSubdomain, fmt.Sprintf("This API key can only connect to subdomain '%s'", app.Subdomain))
 						return
 					}
 
@@ -532,14 +817,12 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 					whitelisted, err := s.db.IsIPWhitelistedForApp(clientIP, app.ID)
 					if err != nil {
 						log.Printf("Whitelist check error: %v", err)
-						s.sendRegisterResponse(conn, false, "", "", "Internal server error")
-						conn.Close()
+						reject(protocol.RegisterCodeInternal, "Internal server error")
 						return
 					}
 					if !whitelisted {
 						log.Printf("Connection rejected for app %s (%s): IP %s not whitelisted", app.Name, regReq.Subdomain, clientIP)
-						s.sendRegisterResponse(conn, false, "", "", "IP address not whitelisted")
-						conn.Close()
+						reject(protocol.RegisterCodeIPNotWhitelisted, "IP address not whitelisted")
 						return
 					}
 				} else if apiKey.OrgID != nil {
@@ -550,14 +833,12 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 					whitelisted, err := s.db.IsIPWhitelistedForOrg(clientIP, orgID)
 					if err != nil {
 						log.Printf("Whitelist check error: %v", err)
-						s.sendRegisterResponse(conn, false, "", "", "Internal server error")
-						conn.Close()
+						reject(protocol.RegisterCodeInternal, "Internal server error")
 						return
 					}
 					if !whitelisted {
 						log.Printf("Connection rejected for org %s (%s): IP %s not whitelisted", orgID, regReq.Subdomain, clientIP)
-						s.sendRegisterResponse(conn, false, "", "", "IP address not whitelisted")
-						conn.Close()
+						reject(protocol.RegisterCodeIPNotWhitelisted, "IP address not whitelisted")
 						return
 					}
 				}
@@ -570,14 +851,17 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 				account, err = s.db.GetAccountByTokenHash(tokenHash)
 				if err != nil {
 					log.Printf("Database error during auth: %v", err)
-					s.sendRegisterResponse(conn, false, "", "", "Internal server error")
-					conn.Close()
+					reject(protocol.RegisterCodeInternal, "Internal server error")
 					return
 				}
 				if account == nil {
 					log.Printf("Authentication failed for subdomain %s from %s: invalid token", regReq.Subdomain, clientIP)
-					s.sendRegisterResponse(conn, false, "", "", "Invalid token")
-					conn.Close()
+					reject(protocol.RegisterCodeInvalidToken, "Invalid token")
+					return
+				}
+				if account.IsTokenExpired() {
+					log.Printf("Authentication failed for subdomain %s from %s: token expired for %s", regReq.Subdomain, clientIP, account.Username)
+					reject(protocol.RegisterCodeTokenExpired, tokenExpiredMessage(*account.TokenExpiresAt))
 					return
 				}
 
@@ -587,62 +871,124 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 				whitelisted, err := s.db.IsIPWhitelistedForAccount(clientIP, account.ID)
 				if err != nil {
 					log.Printf("Whitelist check error: %v", err)
-					s.sendRegisterResponse(conn, false, "", "", "Internal server error")
-					conn.Close()
+					reject(protocol.RegisterCodeInternal, "Internal server error")
 					return
 				}
 				if !whitelisted {
 					log.Printf("Connection rejected for %s (%s): IP %s not whitelisted", account.Username, regReq.Subdomain, clientIP)
-					s.sendRegisterResponse(conn, false, "", "", "IP address not whitelisted")
-					conn.Close()
+					reject(protocol.RegisterCodeIPNotWhitelisted, "IP address not whitelisted")
 					return
 				}
 
 				// Update last used timestamp
 				s.db.UpdateAccountLastUsed(account.ID)
+				s.db.UpdateAccountTokenLastUsed(account.TokenID)
 			}
 		}
 	} else {
 		// No database - legacy mode with secret only
 		if s.secret != "" && regReq.Secret != s.secret {
-			s.sendRegisterResponse(conn, false, "", "", "Invalid secret")
-			conn.Close()
+			reject(protocol.RegisterCodeInvalidToken, "Invalid secret")
 			return
 		}
 	}
 
+	// A registration by application ID takes its subdomain and organization from the app
+	if regReq.AppID != "" {
+		bound, code, msg := s.bindApplication(regReq.AppID, regReq.Subdomain, account, apiKey)
+		if bound == nil {
+			log.Printf("Registration for app %s from %s rejected: %s", regReq.AppID, clientIP, msg)
+			reject(code, msg)
+			return
+		}
+		app = bound
+		regReq.Subdomain = app.Subdomain
+		orgID = app.OrgID
+
+		whitelisted, err := s.db.IsIPWhitelistedForApp(clientIP, app.ID)
+		if err != nil {
+			log.Printf("Whitelist check error: %v", err)
+			reject(protocol.RegisterCodeInternal, "Internal server error")
+			return
+		}
+		if !whitelisted {
+			log.Printf("Connection rejected for app %s (%s): IP %s not whitelisted", app.Name, regReq.Subdomain, clientIP)
+			reject(protocol.RegisterCodeIPNotWhitelisted, "IP address not whitelisted")
+			return
+		}
+	}
+
+	if msg := s.checkLocalTarget(regReq.LocalTarget); msg != "" {
+		log.Printf("Registration for %s from %s rejected: %s", regReq.Subdomain, clientIP, msg)
+		reject(protocol.RegisterCodeLocalTarget, msg)
+		return
+	}
+
 	// Validate or generate subdomain
 	subdomain := strings.ToLower(regReq.Subdomain)
-	if subdomain == "" {
-		// Generate a random subdomain
-		subdomain = generateRandomSubdomain()
-		log.Printf("Generated random subdomain: %s", subdomain)
-	} else if !isValidSubdomain(subdomain) {
-		s.sendRegisterResponse(conn, false, "", "", "Invalid subdomain")
-		conn.Close()
+	if subdomain == "" && regReq.SubdomainPrefix != "" {
+		// Generate a random subdomain after the requested prefix
+		prefix := strings.ToLower(regReq.SubdomainPrefix)
+		if err := s.validateSubdomainPrefix(prefix); err != nil {
+			reject(protocol.RegisterCodeInvalidSubdomain, fmt.Sprintf("Invalid subdomain prefix: %v", err))
+			return
+		}
+		generated, err := s.generatePrefixedSubdomain(prefix)
+		if err != nil {
+			log.Printf("Subdomain generation with prefix %s failed: %v", prefix, err)
+			reject(protocol.RegisterCodeNoFreeSubdomain, fmt.Sprintf("No free subdomain with prefix '%s'; try another prefix", prefix))
+			return
+		}
+		subdomain = generated
+		log.Printf("Generated subdomain with prefix %s: %s", prefix, subdomain)
+	} else if subdomain == "" {
+		// The account's default subdomain, or a random one when it is taken
+		assigned, err := s.defaultSubdomain(account)
+		if err != nil {
+			log.Printf("Random subdomain generation failed: %v", err)
+			reject(protocol.RegisterCodeNoFreeSubdomain, "No free random subdomain available; try again or request a subdomain")
+			return
+		}
+		subdomain = assigned
+		log.Printf("Assigned subdomain: %s", subdomain)
+	} else if err := s.subdomainPolicy.Validate(subdomain); err != nil {
+		reject(protocol.RegisterCodeInvalidSubdomain, fmt.Sprintf("Invalid subdomain: %v", err))
 		return
 	}
 
-	// Check if subdomain is already in use
+	// A client reconnecting after a network blip may find its old connection still
+	// holding a concurrency slot; release its connections that no longer answer
+	owner := tunnelOwner(account, apiKey)
+	if s.quotaChecker != nil && orgID != "" && !s.quotaChecker.CheckQuota(orgID, QuotaConcurrentTunnels).Allowed {
+		s.releaseDeadTunnels(orgID, owner)
+	}
+
+	// Check if subdomain is already in use. A client with a valid reconnect token
+	// resumes it instead, replacing a connection the server has not noticed is dead.
 	s.mu.Lock()
-	if _, exists := s.tunnels[subdomain]; exists {
+	replaced, resumed := s.tunnels[subdomain]
+	if resumed && !replaced.canResume(regReq.ReconnectToken, owner) {
 		s.mu.Unlock()
-		s.sendRegisterResponse(conn, false, "", "", "Subdomain already in use")
+		s.sendRegisterConflict(conn, subdomain)
 		conn.Close()
 		return
 	}
 
-	// Check quota before registering tunnel
+	// Check quota before registering tunnel. A resumed tunnel takes over the
+	// concurrency slot of the one it replaces, so it is neither checked nor counted again.
 	if s.quotaChecker != nil && orgID != "" {
-		allowed, reason := s.quotaChecker.CanConnectTunnel(orgID)
-		if !allowed {
-			s.mu.Unlock()
-			s.sendRegisterResponse(conn, false, "", "", fmt.Sprintf("Quota exceeded: %s", reason))
-			conn.Close()
-			return
+		if resumed {
+			replaced.slotTransferred.Store(true)
+		} else {
+			allowed, reason := s.quotaChecker.CanConnectTunnel(orgID)
+			if !allowed {
+				s.mu.Unlock()
+				reject(protocol.RegisterCodeQuotaExceeded, fmt.Sprintf("Quota exceeded: %s", reason))
+				return
+			}
+			// Track concurrent tunnel increase
+			s.usageCache.IncrementConcurrentTunnels(orgID)
 		}
-		// Track concurrent tunnel increase
-		s.usageCache.IncrementConcurrentTunnels(orgID)
 	}
 
 	// Register tunnel with context
@@ -654,9 +1000,24 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	if account != nil {
 		tunnel.AccountID = account.ID
 	}
+	tunnel.ConnectionID = uuid.New().String()
+	tunnel.owner = owner
+	tunnel.limiter = s.tunnelBandwidthLimiter(orgID)
+	tunnel.degraded.Store(regReq.Degraded)
+	if regReq.LocalTarget != nil {
+		tunnel.LocalTarget = regReq.LocalTarget.String()
+	}
+	reconnectToken := tunnel.issueReconnectToken(s.reconnectTokenTTL)
 	s.tunnels[subdomain] = tunnel
 	s.mu.Unlock()
 
+	if resumed {
+		// Closing the old connection ends its message loop, which cleans up its
+		// usage and database record but leaves the new registration in place
+		log.Printf("Tunnel %s resumed by connection %s, replacing %s", subdomain, tunnel.ConnectionID, replaced.ConnectionID)
+		replaced.Close()
+	}
+
 	// Record tunnel in database
 	var tunnelRecordID string
 	if s.db != nil {
@@ -675,6 +1036,9 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 			if appID != "" {
 				s.db.UpdateTunnelAppID(tunnelRecordID, appID)
 			}
+			if tunnel.LocalTarget != "" {
+				s.db.UpdateTunnelLocalTarget(tunnelRecordID, tunnel.LocalTarget)
+			}
 		}
 	}
 
@@ -692,22 +1056,37 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Send success response
-	s.sendRegisterResponse(conn, true, subdomain, url, "")
+	resp := protocol.RegisterResponse{
+		Success:        true,
+		Subdomain:      subdomain,
+		URL:            url,
+		ConnectionID:   tunnel.ConnectionID,
+		ReconnectToken: reconnectToken,
+	}
+	if reconnectToken != "" {
+		resp.ReconnectTokenTTL = int(s.reconnectTokenTTL.Seconds())
+	}
+	s.sendRegisterResponse(conn, resp)
+	s.publishEvent(Event{Type: EventTunnelConnected, Subdomain: subdomain, OrgID: orgID, AppID: appID, AccountID: tunnel.AccountID, ClientIP: clientIP})
 
 	// Handle incoming messages (responses from client)
 	tunnelStartTime := time.Now()
 	s.handleTunnelMessages(tunnel)
 
-	// Cleanup on disconnect
+	// Cleanup on disconnect, unless a resumed connection has taken the subdomain over
 	s.mu.Lock()
-	delete(s.tunnels, subdomain)
+	if s.tunnels[subdomain] == tunnel {
+		delete(s.tunnels, subdomain)
+	}
 	s.mu.Unlock()
 	tunnel.Close()
 
 	// Track usage on disconnect
 	if s.usageCache != nil && orgID != "" {
-		// Decrement concurrent tunnels
-		s.usageCache.DecrementConcurrentTunnels(orgID)
+		// Decrement concurrent tunnels, unless a resumed connection took over the slot
+		if !tunnel.slotTransferred.Load() {
+			s.usageCache.DecrementConcurrentTunnels(orgID)
+		}
 		// Record tunnel duration
 		tunnelDuration := time.Since(tunnelStartTime)
 		s.usageCache.RecordTunnelTime(orgID, int64(tunnelDuration.Seconds()))
@@ -718,18 +1097,34 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		s.db.CloseTunnel(tunnelRecordID)
 	}
 
+	s.publishEvent(Event{Type: EventTunnelDisconnected, Subdomain: subdomain, OrgID: orgID, AppID: appID, AccountID: tunnel.AccountID, ClientIP: clientIP})
 	log.Printf("Tunnel disconnected: %s", subdomain)
+	close(tunnel.done)
 }
 
 // sendRegisterResponse sends a registration response to the client
-func (s *Server) sendRegisterResponse(conn *websocket.Conn, success bool, subdomain, url, errMsg string) {
+func (s *Server) sendRegisterResponse(conn *websocket.Conn, payload protocol.RegisterResponse) {
+	if payload.Success {
+		// Tell the client how large its messages may be, so it fragments larger responses
+		payload.MaxMessageBytes = s.maxMessageBytes
+	}
+	resp := protocol.Message{
+		Type:    protocol.TypeRegisterResponse,
+		Payload: payload,
+	}
+	data, _ := json.Marshal(resp)
+	conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// sendRegisterConflict rejects a registration for a taken subdomain, suggesting available alternatives
+func (s *Server) sendRegisterConflict(conn *websocket.Conn, subdomain string) {
 	resp := protocol.Message{
 		Type: protocol.TypeRegisterResponse,
 		Payload: protocol.RegisterResponse{
-			Success:   success,
-			Subdomain: subdomain,
-			URL:       url,
-			Error:     errMsg,
+			Success:     false,
+			Error:       "Subdomain already in use",
+			Code:        protocol.RegisterCodeSubdomainTaken,
+			Suggestions: s.suggestSubdomains(subdomain),
 		},
 	}
 	data, _ := json.Marshal(resp)
@@ -746,53 +1141,73 @@ func (s *Server) handleTunnelMessages(tunnel *Tunnel) {
 
 	// Set pong handler to reset the read deadline on each pong
 	tunnel.Conn.SetPongHandler(func(string) error {
+		tunnel.markSeen()
 		tunnel.Conn.SetReadDeadline(time.Now().Add(pongWait))
 		return nil
 	})
 
+	// Deliver responses off the reader goroutine so a slow handler cannot stall it
+	dispatcher := newResponseDispatcher(tunnel, s.dispatchWorkers)
+	defer dispatcher.close()
+
+	// Responses larger than the message limit arrive as fragments
+	fragments := &fragmentAssembler{limit: s.maxResponseBytes}
+
 	for {
 		_, msg, err := tunnel.Conn.ReadMessage()
 		if err != nil {
-			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+			if errors.Is(err, websocket.ErrReadLimit) {
+				log.Printf("Tunnel %s sent a message larger than %d bytes, closing", tunnel.Subdomain, s.maxMessageBytes)
+			} else if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
 				log.Printf("Tunnel read error (%s): %v", tunnel.Subdomain, err)
 			}
 			return
 		}
 
 		// Reset read deadline on any message received
+		tunnel.markSeen()
 		tunnel.Conn.SetReadDeadline(time.Now().Add(pongWait))
 
-		// Use TypedMessage to extract type without fully parsing payload
-		var message protocol.TypedMessage
-		if err := json.Unmarshal(msg, &message); err != nil {
-			log.Printf("Invalid message from tunnel: %v", err)
+		if msgType, _, ok := peekMessage(msg); ok && msgType == protocol.TypeFragment {
+			full, err := fragments.add(msg)
+			if err != nil {
+				log.Printf("Tunnel %s: %v, closing", tunnel.Subdomain, err)
+				tunnel.Conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseMessageTooBig, err.Error()), time.Now().Add(time.Second))
+				return
+			}
+			if full == nil {
+				continue
+			}
+			msg = full
+		}
+
+		// Peek at the type and request ID without parsing the response body
+		msgType, requestID, ok := peekMessage(msg)
+		if !ok {
+			log.Printf("Invalid message from tunnel: %s", tunnel.Subdomain)
 			continue
 		}
 
-		switch message.Type {
+		switch msgType {
 		case protocol.TypeHTTPResponse:
 			// Forward raw message to waiting request handler - avoids re-parsing
-			if ch, ok := tunnel.GetResponseChannel(s.extractRequestIDFromRaw(message.Payload)); ok {
-				ch <- msg
-			}
+			dispatcher.dispatch(requestID, msg)
+		case protocol.TypeRequestAck:
+			tunnel.AcknowledgeRequest(requestID)
 		case protocol.TypePong:
 			// Heartbeat response - deadline already reset above
+		case protocol.TypeHealth:
+			var message struct {
+				Payload protocol.HealthStatus `json:"payload"`
+			}
+			if err := json.Unmarshal(msg, &message); err == nil {
+				tunnel.setHealth(message.Payload.Healthy)
+			}
 		}
 	}
 }
 
-// extractRequestIDFromRaw extracts the request ID from raw JSON payload
-func (s *Server) extractRequestIDFromRaw(payload json.RawMessage) string {
-	// Quick extraction of just the ID field without full unmarshal
-	var idExtract struct {
-		ID string `json:"id"`
-	}
-	if err := json.Unmarshal(payload, &idExtract); err != nil {
-		return ""
-	}
-	return idExtract.ID
-}
-
 // extractRequestID extracts the request ID from a response payload (legacy)
 func (s *Server) extractRequestID(payload interface{}) string {
 	if m, ok := payload.(map[string]interface{}); ok {
@@ -804,7 +1219,9 @@ func (s *Server) extractRequestID(payload interface{}) string {
 }
 
 // forwardRequest forwards an HTTP request through the tunnel
-func (s *Server) forwardRequest(w http.ResponseWriter, r *http.Request, tunnel *Tunnel) {
+func (s *Server) forwardRequest(w http.ResponseWriter, r *http.Request, tunnel *Tunnel, app *db.Application) {
+	start := time.Now()
+
 	// Check quota before processing request
 	if s.quotaChecker != nil && tunnel.OrgID != "" {
 		allowed, reason := s.quotaChecker.CanProcessRequest(tunnel.OrgID)
@@ -815,22 +1232,30 @@ func (s *Server) forwardRequest(w http.ResponseWriter, r *http.Request, tunnel *
 				w.Header().Set(k, v)
 			}
 			w.Header().Set("Retry-After", "86400") // Retry after 1 day (end of billing period)
-			http.Error(w, fmt.Sprintf("Quota exceeded: %s", reason), http.StatusTooManyRequests)
+			s.writeVisitorError(w, r, tunnel.OrgID, http.StatusTooManyRequests, errCodeQuotaExceeded, fmt.Sprintf("Quota exceeded: %s", reason))
 			return
 		}
 	}
 
+	if !s.beginInFlight(w, r, tunnel.OrgID) {
+		return
+	}
+	defer s.endInFlight(tunnel.OrgID)
+
+	headerLimit := s.maxHeaderBytesFor(app)
+	if requestHeaderBytes(r) > headerLimit {
+		s.writeVisitorError(w, r, tunnel.OrgID, http.StatusRequestHeaderFieldsTooLarge, errCodeHeadersTooLarge, "Request header fields too large")
+		return
+	}
+
 	requestID := uuid.New().String()
 
 	// Build HTTP request message
-	headers := make(map[string]string)
-	for key, values := range r.Header {
-		headers[key] = values[0]
-	}
+	headers := s.forwardedHeaders(r, app)
 
 	var body []byte
 	if r.Body != nil {
-		body, _ = io.ReadAll(r.Body)
+		body, _ = io.ReadAll(tunnel.limiter.reader(r.Context(), r.Body))
 	}
 
 	httpReq := protocol.HTTPRequest{
@@ -848,7 +1273,7 @@ func (s *Server) forwardRequest(w http.ResponseWriter, r *http.Request, tunnel *
 
 	data, err := json.Marshal(msg)
 	if err != nil {
-		http.Error(w, "Internal error", http.StatusInternalServerError)
+		s.writeVisitorError(w, r, tunnel.OrgID, http.StatusInternalServerError, errCodeInternal, "Internal error")
 		return
 	}
 
@@ -861,15 +1286,35 @@ func (s *Server) forwardRequest(w http.ResponseWriter, r *http.Request, tunnel *
 
 	// Send request to tunnel client
 	if err := tunnel.WriteMessage(websocket.TextMessage, data); err != nil {
-		http.Error(w, "Tunnel error", http.StatusBadGateway)
+		s.writeVisitorError(w, r, tunnel.OrgID, http.StatusBadGateway, errCodeTunnelError, "Tunnel error")
 		return
 	}
 
 	// Wait for response with timeout
 	select {
-	case responseData := <-responseCh:
-		// Track bytes received (response size)
-		bytesReceived := int64(len(responseData))
+	case responseData, ok := <-responseCh:
+		if !ok {
+			// The tunnel closed while the request was pending
+			s.writeTunnelTimeout(w, r, tunnel.OrgID, tunnel.requestAckState(requestID), false)
+			return
+		}
+
+		// Use TypedMessage to parse directly without double serialization
+		var respMsg protocol.TypedMessage
+		if err := json.Unmarshal(responseData, &respMsg); err != nil {
+			s.writeVisitorError(w, r, tunnel.OrgID, http.StatusBadGateway, errCodeTunnelBadResponse, "Invalid response")
+			return
+		}
+
+		// Parse response payload directly from raw JSON
+		var httpResp protocol.HTTPResponse
+		if err := json.Unmarshal(respMsg.Payload, &httpResp); err != nil {
+			s.writeVisitorError(w, r, tunnel.OrgID, http.StatusBadGateway, errCodeTunnelBadResponse, "Invalid response payload")
+			return
+		}
+
+		// Track bytes received (response size, without a body the visitor never gets)
+		bytesReceived := websocketResponseBytes(len(responseData), r, &httpResp)
 
 		// Update tunnel stats in database
 		if s.db != nil && tunnel.RecordID != "" {
@@ -882,42 +1327,38 @@ func (s *Server) forwardRequest(w http.ResponseWriter, r *http.Request, tunnel *
 			s.usageCache.RecordRequest(tunnel.OrgID)
 		}
 
-		// Use TypedMessage to parse directly without double serialization
-		var respMsg protocol.TypedMessage
-		if err := json.Unmarshal(responseData, &respMsg); err != nil {
-			http.Error(w, "Invalid response", http.StatusBadGateway)
+		if responseHeaderBytes(httpResp.Headers) > headerLimit {
+			log.Printf("Response headers from %s exceed %d bytes", tunnel.Subdomain, headerLimit)
+			s.writeVisitorError(w, r, tunnel.OrgID, http.StatusBadGateway, errCodeResponseHeadersTooLarge, "Response header fields too large")
 			return
 		}
 
-		// Parse response payload directly from raw JSON
-		var httpResp protocol.HTTPResponse
-		if err := json.Unmarshal(respMsg.Payload, &httpResp); err != nil {
-			http.Error(w, "Invalid response payload", http.StatusBadGateway)
-			return
+		if s.analyticsCache != nil {
+			s.analyticsCache.RecordRequest(tunnel.AppID, s.redaction.RedactString(r.URL.Path), httpResp.StatusCode)
 		}
+		s.recordRequest(r, tunnel.OrgID, tunnel.AppID, tunnel.Subdomain, httpResp.StatusCode, start)
 
-		// Write response headers
-		for key, value := range httpResp.Headers {
-			w.Header().Set(key, value)
-		}
-
-		// Add CORS headers if Origin was present in request
-		addCORSHeaders(w, r)
+		httpResp.Headers = s.applyAppProtocol(httpResp.Headers, r, httpResp.StatusCode, app)
+		httpResp.Body = s.applyHTMLTransform(httpResp.Headers, httpResp.Body, r, httpResp.StatusCode, app)
+		writeTunnelResponse(tunnel.limiter.writer(r.Context(), w), r, httpResp.StatusCode, httpResp.Headers, httpResp.Body, s.via)
 
-		w.WriteHeader(httpResp.StatusCode)
-		if len(httpResp.Body) > 0 {
-			w.Write(httpResp.Body)
+	case <-r.Context().Done():
+		// Visitor disconnected; free the response channel and let the client stop working on it
+		if err := tunnel.SendCancel(requestID); err != nil {
+			log.Printf("Failed to send cancel for %s: %v", tunnel.Subdomain, err)
 		}
 
-	case <-time.After(5 * time.Minute):
-		http.Error(w, "Tunnel timeout", http.StatusGatewayTimeout)
+	case <-time.After(s.requestTimeout):
+		s.writeTunnelTimeout(w, r, tunnel.OrgID, tunnel.requestAckState(requestID), !tunnel.IsClosed())
 	}
 }
 
 // forwardRequestViaTCP forwards an HTTP request through a TCP/yamux tunnel
-func (s *Server) forwardRequestViaTCP(w http.ResponseWriter, r *http.Request, session *tunnel.Session, subdomain string) {
+func (s *Server) forwardRequestViaTCP(w http.ResponseWriter, r *http.Request, session *tunnel.Session, subdomain string, app *db.Application) {
+	start := time.Now()
+
 	// Get org ID for quota checking
-	accountID, orgID, _ := session.GetAccountInfo()
+	accountID, orgID, appID := session.GetAccountInfo()
 
 	// Check quota before processing request
 	if s.quotaChecker != nil && orgID != "" {
@@ -928,42 +1369,63 @@ func (s *Server) forwardRequestViaTCP(w http.ResponseWriter, r *http.Request, se
 				w.Header().Set(k, v)
 			}
 			w.Header().Set("Retry-After", "86400")
-			http.Error(w, fmt.Sprintf("Quota exceeded: %s", reason), http.StatusTooManyRequests)
+			s.writeVisitorError(w, r, orgID, http.StatusTooManyRequests, errCodeQuotaExceeded, fmt.Sprintf("Quota exceeded: %s", reason))
 			return
 		}
 	}
 
+	headerLimit := s.maxHeaderBytesFor(app)
+	if requestHeaderBytes(r) > headerLimit {
+		s.writeVisitorError(w, r, orgID, http.StatusRequestHeaderFieldsTooLarge, errCodeHeadersTooLarge, "Request header fields too large")
+		return
+	}
+
 	// Check if this is a WebSocket upgrade request
 	isWS := isWebSocketUpgrade(r)
 	if isWS {
-		log.Printf("[WS] Detected WebSocket upgrade request for %s: %s %s", subdomain, r.Method, r.URL.RequestURI())
+		log.Printf("[WS] Detected WebSocket upgrade request for %s: %s %s", subdomain, r.Method, s.redaction.RedactURL(r.URL.RequestURI()))
+	}
+
+	// WebSocket connections are long-lived, so only plain requests count as in flight
+	if !isWS {
+		if !s.beginInFlight(w, r, orgID) {
+			return
+		}
+		defer s.endInFlight(orgID)
 	}
 
 	// Open a new yamux stream for this request
 	stream, err := session.Open()
 	if err != nil {
 		log.Printf("Failed to open yamux stream for %s: %v", subdomain, err)
-		http.Error(w, "Tunnel unavailable", http.StatusBadGateway)
+		s.writeVisitorError(w, r, orgID, http.StatusBadGateway, errCodeTunnelError, "Tunnel unavailable")
 		return
 	}
 
 	// For regular HTTP, defer close. For WebSocket, we'll handle it after piping
 	if !isWS {
 		defer stream.Close()
+
+		// Closing the stream when the visitor disconnects tells the client to abort the request
+		stop := context.AfterFunc(r.Context(), func() { stream.Close() })
+		defer stop()
 	}
 
 	requestID := uuid.New().String()
 
 	// Build request headers
-	headers := make(map[string]string)
-	for key, values := range r.Header {
-		headers[key] = values[0]
-	}
+	headers := s.forwardedHeaders(r, app)
+
+	// Streaming apps relay every response as it arrives: uncompressed, not
+	// coalesced and streamed even while the org's streaming feature is off. Only
+	// TCP tunnels stream; WebSocket tunnels buffer every response.
+	streaming := app != nil && app.StreamingMode
 
-	// Read request body
+	// Read request body, throttled by the session's plan
+	limiter := s.tunnelListener.limiter(session)
 	var body []byte
 	if r.Body != nil {
-		body, _ = io.ReadAll(r.Body)
+		body, _ = io.ReadAll(limiter.reader(r.Context(), r.Body))
 	}
 
 	// Create request frame
@@ -974,12 +1436,15 @@ func (s *Server) forwardRequestViaTCP(w http.ResponseWriter, r *http.Request, se
 		Path:      r.URL.RequestURI(),
 		Headers:   headers,
 		Body:      body,
+		WantAck:   !isWS,
+		GRPC:      !isWS && isGRPCRequest(r) && s.featureEnabled(orgID, db.FeatureGRPC),
+		Stream:    !isWS && streaming,
 	}
 
 	// Send request frame
 	if err := tunnel.WriteFrame(stream, &reqFrame); err != nil {
 		log.Printf("Failed to write request frame for %s: %v", subdomain, err)
-		http.Error(w, "Tunnel error", http.StatusBadGateway)
+		s.writeVisitorError(w, r, orgID, http.StatusBadGateway, errCodeTunnelError, "Tunnel error")
 		if isWS {
 			stream.Close()
 		}
@@ -990,11 +1455,31 @@ func (s *Server) forwardRequestViaTCP(w http.ResponseWriter, r *http.Request, se
 	bytesSent := int64(len(body) + 500) // Approximate frame overhead
 
 	// Read response frame with timeout
-	stream.SetReadDeadline(time.Now().Add(5 * time.Minute))
-	respFrame, err := tunnel.ReadFrame[tunnel.ResponseFrame](stream)
+	stream.SetReadDeadline(time.Now().Add(s.requestTimeout))
+	var respFrame *tunnel.ResponseFrame
+	var acked bool
+	if isWS {
+		respFrame, err = tunnel.ReadFrame[tunnel.ResponseFrame](stream)
+	} else {
+		respFrame, acked, err = tunnel.ReadResponseFrame(stream)
+	}
+	if acked {
+		session.SetAcknowledgesRequests()
+	}
 	if err != nil {
+		if r.Context().Err() != nil {
+			// Visitor disconnected; there is no one to respond to
+			return
+		}
 		log.Printf("Failed to read response frame for %s: %v", subdomain, err)
-		http.Error(w, "Tunnel timeout or error", http.StatusGatewayTimeout)
+		state := ackUnsupported
+		switch {
+		case acked:
+			state = ackReceived
+		case !isWS && session.AcknowledgesRequests():
+			state = ackPending
+		}
+		s.writeTunnelTimeout(w, r, orgID, state, !session.IsClosed())
 		if isWS {
 			stream.Close()
 		}
@@ -1006,8 +1491,20 @@ func (s *Server) forwardRequestViaTCP(w http.ResponseWriter, r *http.Request, se
 		stream.SetReadDeadline(time.Time{})
 	}
 
-	// Track bytes received
-	bytesReceived := int64(len(respFrame.Body) + 500) // Approximate frame overhead
+	if responseHeaderBytes(respFrame.Headers) > headerLimit {
+		log.Printf("Response headers from %s exceed %d bytes", subdomain, headerLimit)
+		s.writeVisitorError(w, r, orgID, http.StatusBadGateway, errCodeResponseHeadersTooLarge, "Response header fields too large")
+		if isWS {
+			stream.Close()
+		}
+		return
+	}
+
+	// Track bytes received (304/204 and HEAD responses carry no body, whatever the frame holds)
+	bytesReceived := int64(500) // Approximate frame overhead
+	if bodyAllowedForStatus(respFrame.Status) && r.Method != http.MethodHead {
+		bytesReceived += int64(len(respFrame.Body))
+	}
 
 	// Update usage tracking
 	if s.usageCache != nil && orgID != "" {
@@ -1015,6 +1512,11 @@ func (s *Server) forwardRequestViaTCP(w http.ResponseWriter, r *http.Request, se
 		s.usageCache.RecordRequest(orgID)
 	}
 
+	if s.analyticsCache != nil {
+		s.analyticsCache.RecordRequest(appID, s.redaction.RedactString(r.URL.Path), respFrame.Status)
+	}
+	s.recordRequest(r, orgID, appID, subdomain, respFrame.Status, start)
+
 	// Log request (optional - for debugging)
 	_ = accountID // Silence unused variable if not logging
 
@@ -1031,18 +1533,31 @@ func (s *Server) forwardRequestViaTCP(w http.ResponseWriter, r *http.Request, se
 	}
 
 	// Regular HTTP response
-	// Write response headers
-	for key, value := range respFrame.Headers {
-		w.Header().Set(key, value)
-	}
-
-	// Add CORS headers if Origin was present in request
-	addCORSHeaders(w, r)
-
-	w.WriteHeader(respFrame.Status)
-	if len(respFrame.Body) > 0 {
-		w.Write(respFrame.Body)
+	respFrame.Headers = s.applyAppProtocol(respFrame.Headers, r, respFrame.Status, app)
+	if respFrame.Stream && !respFrame.Trailers && !streaming && !s.featureEnabled(orgID, db.FeatureStreaming) {
+		// Streaming is off for the org and not forced by the app: buffer the body like any other response
+		body, err := io.ReadAll(respFrame.BodyStream)
+		respFrame.BodyStream.Close()
+		if err != nil {
+			log.Printf("Failed to read streaming response for %s: %v", subdomain, err)
+			s.writeVisitorError(w, r, orgID, http.StatusBadGateway, errCodeTunnelBadResponse, "Invalid response")
+			return
+		}
+		respFrame.Stream, respFrame.Body = false, body
+	}
+	if respFrame.Stream {
+		// The request timeout covers the wait for the response, not how long it streams;
+		// a stream is cut off once it stays silent for streamIdleTimeout instead. The
+		// body is relayed as it arrives, so it is neither transformed nor buffered.
+		body := &idleDeadlineReader{r: respFrame.BodyStream, conn: stream, timeout: streamIdleTimeout}
+		streamed := writeStreamingResponse(limiter.writer(r.Context(), w), r, respFrame.Status, respFrame.Headers, body, respFrame.Trailer, s.via)
+		if s.usageCache != nil && orgID != "" {
+			s.usageCache.RecordBandwidth(orgID, streamed)
+		}
+		return
 	}
+	respFrame.Body = s.applyHTMLTransform(respFrame.Headers, respFrame.Body, r, respFrame.Status, app)
+	writeTunnelResponse(limiter.writer(r.Context(), w), r, respFrame.Status, respFrame.Headers, respFrame.Body, s.via)
 
 	// Close stream for WebSocket requests that didn't get 101
 	if isWS {
@@ -1058,7 +1573,7 @@ func (s *Server) handleWebSocketUpgrade(w http.ResponseWriter, r *http.Request,
 	hijacker, ok := w.(http.Hijacker)
 	if !ok {
 		log.Printf("WebSocket upgrade failed: ResponseWriter does not support hijacking")
-		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeWebSocketUnsupported, "WebSocket not supported")
 		stream.Close()
 		return
 	}
@@ -1120,7 +1635,147 @@ func addCORSHeaders(w http.ResponseWriter, r *http.Request) {
 	if w.Header().Get("Access-Control-Allow-Origin") == "" {
 		w.Header().Set("Access-Control-Allow-Origin", origin)
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		// The response now depends on the Origin, so caches must key on it
+		addVary(w.Header(), "Origin")
+	}
+}
+
+// addVary adds a header name to the Vary header, keeping any values set by the backend
+func addVary(h http.Header, name string) {
+	vary := h.Get("Vary")
+	for _, v := range strings.Split(vary, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.EqualFold(v, name) {
+			return
+		}
+	}
+	if vary == "" {
+		h.Set("Vary", name)
+		return
+	}
+	h.Set("Vary", vary+", "+name)
+}
+
+// bodyAllowedForStatus reports whether a response with the given status may have a body (RFC 9110)
+func bodyAllowedForStatus(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == http.StatusNoContent, status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+// websocketResponseBytes returns the bytes a WebSocket tunnel response counts
+// for: the whole frame, less the body field of a 204, 304 or HEAD response,
+// whose body writeTunnelResponse drops
+func websocketResponseBytes(frameLen int, r *http.Request, resp *protocol.HTTPResponse) int64 {
+	if len(resp.Body) == 0 || (bodyAllowedForStatus(resp.StatusCode) && r.Method != http.MethodHead) {
+		return int64(frameLen)
+	}
+	return int64(frameLen - len(`,"body":""`) - base64.StdEncoding.EncodedLen(len(resp.Body)))
+}
+
+// writeTunnelResponse writes a response received through a tunnel, adding via to
+// its Via header. Bodies are dropped for statuses that cannot carry one, so a 304
+// stays empty while its validators (ETag, Last-Modified, Cache-Control, Vary) pass
+// through unchanged.
+func writeTunnelResponse(w http.ResponseWriter, r *http.Request, status int, headers map[string]string, body []byte, via string) {
+	for key, value := range headers {
+		w.Header().Set(key, value)
+	}
+	appendVia(w.Header(), via)
+
+	// Add CORS headers if Origin was present in request
+	addCORSHeaders(w, r)
+
+	if !bodyAllowedForStatus(status) {
+		body = nil
+	}
+	if r.Method == http.MethodHead {
+		// HEAD responses never carry a body, even when the local service sends
+		// one. Its length still tells the visitor what a GET would return.
+		if len(body) > 0 && w.Header().Get("Content-Length") == "" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		}
+		body = nil
+	}
+
+	w.WriteHeader(status)
+	if len(body) > 0 {
+		w.Write(body)
+	}
+}
+
+// streamIdleTimeout is how long a streamed response may go without a chunk
+// from the tunnel before the server gives up on it
+const streamIdleTimeout = 2 * time.Minute
+
+// idleDeadlineReader reads a streamed body from a tunnel stream, pushing the
+// stream's read deadline out before every read so only a silent stream times out
+type idleDeadlineReader struct {
+	r       io.Reader
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (d *idleDeadlineReader) Read(p []byte) (int, error) {
+	d.conn.SetReadDeadline(time.Now().Add(d.timeout))
+	return d.r.Read(p)
+}
+
+// writeStreamingResponse writes a streamed tunnel response to the visitor,
+// flushing each chunk as it arrives from the tunnel, and returns the number of
+// body bytes written. trailer, when set, gives the trailers sent after a body
+// that was read to the end, such as a gRPC call's status.
+func writeStreamingResponse(w http.ResponseWriter, r *http.Request, status int, headers map[string]string, body io.Reader, trailer func() map[string]string, via string) int64 {
+	for key, value := range headers {
+		w.Header().Set(key, value)
+	}
+	appendVia(w.Header(), via)
+	addCORSHeaders(w, r)
+
+	// Ask a reverse proxy in front of the server not to buffer the stream either
+	if w.Header().Get("X-Accel-Buffering") == "" {
+		w.Header().Set("X-Accel-Buffering", "no")
+	}
+
+	w.WriteHeader(status)
+	if !bodyAllowedForStatus(status) || r.Method == http.MethodHead {
+		return 0
+	}
+
+	rc := http.NewResponseController(w)
+	rc.Flush()
+
+	// Stop relaying once the visitor is gone; the caller closes the tunnel stream
+	// on the same signal, which tells the client to stop reading its service
+	var written int64
+	buf := make([]byte, 32*1024)
+	for r.Context().Err() == nil {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return written
+			}
+			written += int64(n)
+			rc.Flush()
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return written
+		}
 	}
+
+	if trailer != nil && r.Context().Err() == nil {
+		for key, value := range trailer() {
+			w.Header().Set(http.TrailerPrefix+key, value)
+		}
+	}
+	return written
 }
 
 // reservedSubdomains contains subdomains that cannot be registered by users
@@ -1156,32 +1811,6 @@ var reservedSubdomains = map[string]bool{
 	"prod":      true,
 }
 
-// isValidSubdomain checks if a subdomain name is valid
-func isValidSubdomain(s string) bool {
-	if len(s) < 1 || len(s) > 63 {
-		return false
-	}
-
-	// Check against reserved subdomains
-	if reservedSubdomains[s] {
-		return false
-	}
-
-	for _, c := range s {
-		if !((c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-') {
-			return false
-		}
-	}
-	return s[0] != '-' && s[len(s)-1] != '-'
-}
-
-// generateRandomSubdomain creates a random subdomain using UUID
-func generateRandomSubdomain() string {
-	id := uuid.New().String()
-	// Use first 8 characters of UUID for a short, unique subdomain
-	return id[:8]
-}
-
 // Run starts the server on the specified port
 func (s *Server) Run(port int) error {
 	addr := fmt.Sprintf(":%d", port)
@@ -1189,8 +1818,16 @@ func (s *Server) Run(port int) error {
 
 	// Start ping routine
 	go s.pingRoutine()
-
-	return http.ListenAndServe(addr, s)
+	go s.totpSetupCleanupRoutine()
+	go s.appReleaseRoutine()
+	go s.apiKeyPurgeRoutine()
+	go s.metricsRoutine()
+
+	httpServer := &http.Server{Addr: addr, Handler: s, Protocols: serverProtocols()}
+	s.serversMu.Lock()
+	s.httpServer = httpServer
+	s.serversMu.Unlock()
+	return httpServer.ListenAndServe()
 }
 
 // StartTunnelListener starts the TCP+TLS tunnel listener if configured
@@ -1282,6 +1919,12 @@ func GetSecret() string {
 	return os.Getenv("SECRET")
 }
 
+// GetDisableLegacySecret returns whether legacy secret authentication is turned off
+// (DISABLE_LEGACY_SECRET=true), so tunnel clients must register with a token
+func GetDisableLegacySecret() bool {
+	return os.Getenv("DISABLE_LEGACY_SECRET") == "true"
+}
+
 // GetPort returns the server port from environment or default
 func GetPort() int {
 	if port := os.Getenv("PORT"); port != "" {
@@ -1297,8 +1940,12 @@ func GetPort() int {
 // handleTunnelAuth handles tunnel-level authentication endpoints
 // These are mounted on subdomain paths like /__auth/login, /__auth/callback, etc.
 func (s *Server) handleTunnelAuth(w http.ResponseWriter, r *http.Request, subdomain string) {
-	// Set security headers for auth endpoints
-	auth.SetAuthSecurityHeaders(w)
+	// Set security headers for auth endpoints, allowing embedding where the org permits it
+	frameAncestors := ""
+	if s.authMiddleware != nil {
+		frameAncestors = s.authMiddleware.FrameAncestorsForSubdomain(subdomain)
+	}
+	auth.SetAuthSecurityHeaders(w, frameAncestors)
 	auth.NoCacheHeaders(w)
 
 	path := strings.TrimPrefix(r.URL.Path, "/__auth")
@@ -1313,14 +1960,14 @@ func (s *Server) handleTunnelAuth(w http.ResponseWriter, r *http.Request, subdom
 	case "/health":
 		s.handleTunnelAuthHealth(w, r, subdomain)
 	default:
-		http.Error(w, "Not found", http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Not found")
 	}
 }
 
 // handleTunnelAuthLogin handles the OIDC login flow
 func (s *Server) handleTunnelAuthLogin(w http.ResponseWriter, r *http.Request, subdomain string) {
 	if s.db == nil {
-		http.Error(w, "Authentication not configured", http.StatusServiceUnavailable)
+		writeError(w, r, http.StatusServiceUnavailable, errCodeUnavailable, "Authentication not configured")
 		return
 	}
 
@@ -1328,7 +1975,7 @@ func (s *Server) handleTunnelAuthLogin(w http.ResponseWriter, r *http.Request, s
 	app, err := s.db.GetApplicationBySubdomain(subdomain)
 	if err != nil {
 		log.Printf("Error looking up application for auth: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 
@@ -1354,7 +2001,7 @@ func (s *Server) handleTunnelAuthLogin(w http.ResponseWriter, r *http.Request, s
 		effectivePolicy, _, err = s.authMiddleware.policyLoader.LoadForSubdomain(subdomain)
 		if err != nil {
 			log.Printf("Error loading policy for subdomain %s: %v", subdomain, err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 			return
 		}
 	}
@@ -1366,13 +2013,13 @@ func (s *Server) handleTunnelAuthLogin(w http.ResponseWriter, r *http.Request, s
 			oidcPolicy, err = s.db.GetOrgAuthPolicy(orgID)
 			if err != nil {
 				log.Printf("Error getting org auth policy: %v", err)
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 				return
 			}
 		}
 
 		if oidcPolicy == nil || oidcPolicy.AuthType != db.AuthTypeOIDC {
-			http.Error(w, "OIDC authentication not configured for this application", http.StatusNotImplemented)
+			writeError(w, r, http.StatusNotImplemented, errCodeNotImplemented, "OIDC authentication not configured for this application")
 			return
 		}
 
@@ -1392,7 +2039,7 @@ func (s *Server) handleTunnelAuthLogin(w http.ResponseWriter, r *http.Request, s
 	}
 
 	if effectivePolicy.Type != policy.AuthTypeOIDC || effectivePolicy.OIDC == nil {
-		http.Error(w, "OIDC authentication not configured for this application", http.StatusNotImplemented)
+		writeError(w, r, http.StatusNotImplemented, errCodeNotImplemented, "OIDC authentication not configured for this application")
 		return
 	}
 
@@ -1400,14 +2047,14 @@ func (s *Server) handleTunnelAuthLogin(w http.ResponseWriter, r *http.Request, s
 	if s.oidcHandler != nil {
 		s.oidcHandler.HandleLogin(w, r, effectivePolicy, authCtx)
 	} else {
-		http.Error(w, "OIDC handler not initialized", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "OIDC handler not initialized")
 	}
 }
 
 // handleTunnelAuthCallback handles the OIDC callback
 func (s *Server) handleTunnelAuthCallback(w http.ResponseWriter, r *http.Request, subdomain string) {
 	if s.db == nil || s.oidcHandler == nil {
-		http.Error(w, "Authentication not configured", http.StatusServiceUnavailable)
+		writeError(w, r, http.StatusServiceUnavailable, errCodeUnavailable, "Authentication not configured")
 		return
 	}
 
@@ -1415,7 +2062,7 @@ func (s *Server) handleTunnelAuthCallback(w http.ResponseWriter, r *http.Request
 	app, err := s.db.GetApplicationBySubdomain(subdomain)
 	if err != nil {
 		log.Printf("Error looking up application for auth callback: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 		return
 	}
 
@@ -1441,7 +2088,7 @@ func (s *Server) handleTunnelAuthCallback(w http.ResponseWriter, r *http.Request
 		effectivePolicy, _, err = s.authMiddleware.policyLoader.LoadForSubdomain(subdomain)
 		if err != nil {
 			log.Printf("Error loading policy for subdomain %s: %v", subdomain, err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 			return
 		}
 	}
@@ -1453,13 +2100,13 @@ func (s *Server) handleTunnelAuthCallback(w http.ResponseWriter, r *http.Request
 			oidcPolicy, err = s.db.GetOrgAuthPolicy(orgID)
 			if err != nil {
 				log.Printf("Error getting org auth policy: %v", err)
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
 				return
 			}
 		}
 
 		if oidcPolicy == nil || oidcPolicy.AuthType != db.AuthTypeOIDC {
-			http.Error(w, "OIDC authentication not configured", http.StatusNotImplemented)
+			writeError(w, r, http.StatusNotImplemented, errCodeNotImplemented, "OIDC authentication not configured")
 			return
 		}
 
@@ -1478,7 +2125,7 @@ func (s *Server) handleTunnelAuthCallback(w http.ResponseWriter, r *http.Request
 	}
 
 	if effectivePolicy.Type != policy.AuthTypeOIDC || effectivePolicy.OIDC == nil {
-		http.Error(w, "OIDC authentication not configured", http.StatusNotImplemented)
+		writeError(w, r, http.StatusNotImplemented, errCodeNotImplemented, "OIDC authentication not configured")
 		return
 	}
 
@@ -1487,22 +2134,36 @@ func (s *Server) handleTunnelAuthCallback(w http.ResponseWriter, r *http.Request
 
 // handleTunnelAuthLogout handles logout (clears session)
 func (s *Server) handleTunnelAuthLogout(w http.ResponseWriter, r *http.Request, subdomain string) {
+	// The cookie can only be cleared with the attributes it was set with
+	var authCtx *policy.AuthContext
+	if s.authMiddleware != nil && s.authMiddleware.policyLoader != nil {
+		_, authCtx, _ = s.authMiddleware.policyLoader.LoadForSubdomain(subdomain)
+	}
+
 	if s.oidcHandler != nil {
-		s.oidcHandler.HandleLogout(w, r)
+		s.oidcHandler.HandleLogout(w, r, authCtx)
 	} else {
+		var cookieConfig auth.CookieConfig
+		if s.authMiddleware != nil && authCtx != nil {
+			cookieConfig = s.authMiddleware.CookieConfigForOrg(authCtx.OrgID)
+		}
+
 		// Fallback: Clear the session cookie
-		http.SetCookie(w, &http.Cookie{
-			Name:     "digit_link_session",
+		http.SetCookie(w, cookieConfig.Apply(&http.Cookie{
+			Name:     auth.OIDCSessionCookie,
 			Value:    "",
 			Path:     "/",
 			MaxAge:   -1,
 			HttpOnly: true,
 			Secure:   true,
-			SameSite: http.SameSiteLaxMode,
-		})
+		}))
 
-		// Get redirect URL
-		redirectURL := r.URL.Query().Get("redirect")
+		// Redirect to home or specified URL on this host
+		returnHosts := auth.GetLoginReturnHosts()
+		if s.authMiddleware != nil {
+			returnHosts = s.authMiddleware.returnHosts
+		}
+		redirectURL := auth.SafeReturnURL(r.URL.Query().Get("redirect"), r.Host, returnHosts)
 		if redirectURL == "" {
 			redirectURL = "/"
 		}
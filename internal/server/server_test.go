@@ -0,0 +1,573 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/client"
+	"github.com/niekvdm/digit-link/internal/db"
+	"github.com/niekvdm/digit-link/internal/protocol"
+	"github.com/niekvdm/digit-link/internal/tunnel"
+)
+
+// newTestDB opens a fresh database in the test's temporary directory and
+// closes it when the test ends
+func newTestDB(t *testing.T) *db.DB {
+	t.Helper()
+	database, err := db.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("db.New() error: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+// newTestServer returns a server with the caches the request path reads and
+// none of the background workers New starts. Without a database it runs like
+// a server that only knows the legacy secret.
+func newTestServer(database *db.DB) *Server {
+	s := &Server{
+		domain:          "link.test",
+		scheme:          "http",
+		tunnels:         make(map[string]*Tunnel),
+		dispatchWorkers: 1,
+		requestTimeout:  5 * time.Second,
+		events:          NewEventBus(),
+	}
+	if database != nil {
+		s.db = database
+		s.authMiddleware = NewAuthMiddleware(database)
+		s.settings = newSettingsCache(database)
+		s.featureFlags = newFeatureFlagCache(database)
+		s.requestRules = newRequestRuleCache(database)
+	}
+	return s
+}
+
+// newTestProxy returns the client's proxy to the local service at rawURL
+func newTestProxy(t *testing.T, rawURL string) *client.Proxy {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("url.Parse() error: %v", err)
+	}
+	port, _ := strconv.Atoi(u.Port())
+	return client.NewProxy(u.Hostname(), port, false)
+}
+
+// newTestTCPSession returns the server side of a TCP tunnel whose client
+// answers like the TCP client: each request is acknowledged and forwarded to
+// the local service at backendURL, and the body follows the response frame,
+// in chunks with the trailers for gRPC calls
+func newTestTCPSession(t *testing.T, backendURL string) *tunnel.Session {
+	t.Helper()
+	proxy := newTestProxy(t, backendURL)
+
+	serverConn, clientConn := net.Pipe()
+	serverSession, err := tunnel.NewServerSession(serverConn, tunnel.DefaultYamuxConfig())
+	if err != nil {
+		t.Fatalf("NewServerSession() error: %v", err)
+	}
+	t.Cleanup(func() { serverSession.Close() })
+	clientSession, err := tunnel.NewClientSession(clientConn, tunnel.DefaultYamuxConfig())
+	if err != nil {
+		t.Fatalf("NewClientSession() error: %v", err)
+	}
+	t.Cleanup(func() { clientSession.Close() })
+
+	go func() {
+		for {
+			stream, err := clientSession.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer stream.Close()
+				req, err := tunnel.ReadFrame[tunnel.RequestFrame](stream)
+				if err != nil {
+					return
+				}
+				tunnel.WriteFrame(stream, &tunnel.ResponseFrame{ID: req.ID, Ack: true})
+				forward := proxy.ForwardRaw
+				if req.GRPC {
+					forward = proxy.ForwardGRPC
+				} else if req.Stream {
+					forward = proxy.ForwardStreaming
+				}
+				resp, err := forward(context.Background(), req.Method, req.Path, req.Headers, req.Body)
+				if err != nil {
+					return
+				}
+				resp.ID = req.ID
+				if err := tunnel.WriteFrame(stream, resp); err == nil && resp.Trailers {
+					tunnel.WriteChunkedBody(stream, resp.BodyStream, resp.Trailer)
+				} else if err == nil && resp.BodyStream != nil {
+					io.Copy(stream, resp.BodyStream)
+				}
+				if resp.BodyStream != nil {
+					resp.BodyStream.Close()
+				}
+			}()
+		}
+	}()
+	return serverSession
+}
+
+func TestExtractSubdomain(t *testing.T) {
+	s := &Server{domain: "link.digit.zone"}
+
+	tests := []struct {
+		name string
+		host string
+		want string
+	}{
+		{"lowercase", "myapp.link.digit.zone", "myapp"},
+		{"mixed case subdomain", "MyApp.link.digit.zone", "myapp"},
+		{"mixed case domain", "myapp.Link.Digit.Zone", "myapp"},
+		{"uppercase with port", "MYAPP.LINK.DIGIT.ZONE:443", "myapp"},
+		{"trailing dot", "MyApp.link.digit.zone.", "myapp"},
+		{"bare domain", "Link.Digit.Zone", ""},
+		{"other domain", "myapp.example.com", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.extractSubdomain(tt.host); got != tt.want {
+				t.Errorf("extractSubdomain(%q) = %q, want %q", tt.host, got, tt.want)
+			}
+		})
+	}
+
+	// A configured domain with uppercase letters and a port still matches
+	s = &Server{domain: "Link.Digit.Zone:8080"}
+	if got := s.extractSubdomain("myapp.link.digit.zone:8080"); got != "myapp" {
+		t.Errorf("extractSubdomain with mixed-case domain = %q, want %q", got, "myapp")
+	}
+}
+
+func TestWriteTunnelResponseNotModified(t *testing.T) {
+	// Simulates a backend 304 relayed through the tunnel, including a stray body
+	// that must never reach the client
+	headers := map[string]string{
+		"Etag":          `"v1"`,
+		"Last-Modified": "Mon, 01 Jan 2024 00:00:00 GMT",
+		"Cache-Control": "max-age=60",
+		"Vary":          "Accept-Encoding",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeTunnelResponse(w, r, http.StatusNotModified, headers, []byte("phantom body"), "")
+	}))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("If-None-Match", `"v1"`)
+	req.Header.Set("Origin", "https://example.com")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusNotModified)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if len(body) != 0 {
+		t.Errorf("body = %q, want empty", body)
+	}
+	for key, want := range map[string]string{
+		"Etag":          `"v1"`,
+		"Last-Modified": "Mon, 01 Jan 2024 00:00:00 GMT",
+		"Cache-Control": "max-age=60",
+		"Vary":          "Accept-Encoding, Origin",
+	} {
+		if got := resp.Header.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestWebSocketResponseBytes(t *testing.T) {
+	frame := func(status int, body string) (int, *protocol.HTTPResponse) {
+		resp := &protocol.HTTPResponse{ID: "1", StatusCode: status, Body: []byte(body)}
+		data, _ := json.Marshal(protocol.Message{Type: protocol.TypeHTTPResponse, Payload: resp})
+		return len(data), resp
+	}
+	tests := []struct {
+		name   string
+		method string
+		status int
+		body   string
+		full   bool
+	}{
+		{"200 counts its body", http.MethodGet, http.StatusOK, "hello world", true},
+		{"304 drops a phantom body", http.MethodGet, http.StatusNotModified, "phantom body", false},
+		{"204 drops a phantom body", http.MethodGet, http.StatusNoContent, "phantom body", false},
+		{"HEAD drops the body", http.MethodHead, http.StatusOK, "hello world", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frameLen, resp := frame(tt.status, tt.body)
+			want := int64(frameLen)
+			if !tt.full {
+				// The frame of the same response without a body
+				emptyLen, _ := frame(tt.status, "")
+				want = int64(emptyLen)
+			}
+			if got := websocketResponseBytes(frameLen, httptest.NewRequest(tt.method, "/", nil), resp); got != want {
+				t.Errorf("websocketResponseBytes() = %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestBodyAllowedForStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		want   bool
+	}{
+		{http.StatusOK, true},
+		{http.StatusSwitchingProtocols, false},
+		{http.StatusNoContent, false},
+		{http.StatusNotModified, false},
+		{http.StatusNotFound, true},
+	}
+
+	for _, tt := range tests {
+		if got := bodyAllowedForStatus(tt.status); got != tt.want {
+			t.Errorf("bodyAllowedForStatus(%d) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestAddVary(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		want     string
+	}{
+		{"empty", "", "Origin"},
+		{"append", "Accept-Encoding", "Accept-Encoding, Origin"},
+		{"already present", "accept-encoding, origin", "accept-encoding, origin"},
+		{"wildcard", "*", "*"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			if tt.existing != "" {
+				h.Set("Vary", tt.existing)
+			}
+			addVary(h, "Origin")
+			if got := h.Get("Vary"); got != tt.want {
+				t.Errorf("Vary = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamingResponseViaTCP(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprintln(w, `{"line":1}`)
+		w.(http.Flusher).Flush()
+		<-release
+		fmt.Fprintln(w, `{"line":2}`)
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	serverSession := newTestTCPSession(t, backend.URL)
+
+	s := newTestServer(nil)
+	visitor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.forwardRequestViaTCP(w, r, serverSession, "logs", nil)
+	}))
+	defer visitor.Close()
+
+	resp, err := http.Get(visitor.URL + "/logs")
+	if err != nil {
+		t.Fatalf("GET error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q, want application/x-ndjson", ct)
+	}
+	if resp.ContentLength != -1 {
+		t.Errorf("ContentLength = %d, want -1 for a streamed body", resp.ContentLength)
+	}
+
+	// The first line arrives while the backend still holds back the second
+	lines := make(chan string)
+	go func() {
+		reader := bufio.NewReader(resp.Body)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			lines <- line
+		}
+	}()
+	select {
+	case line := <-lines:
+		if line != `{"line":1}`+"\n" {
+			t.Errorf("first line = %q", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("first line was not delivered before the response completed")
+	}
+
+	release <- struct{}{}
+	if line := <-lines; line != `{"line":2}`+"\n" {
+		t.Errorf("second line = %q", line)
+	}
+	if _, ok := <-lines; ok {
+		t.Error("stream continued after the backend finished")
+	}
+}
+
+func TestStreamingResponseStops(t *testing.T) {
+	// A stream without chunks for the idle timeout fails the read
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+	body := &idleDeadlineReader{r: serverConn, conn: serverConn, timeout: 50 * time.Millisecond}
+	go clientConn.Write([]byte("chunk"))
+	buf := make([]byte, 16)
+	if n, err := body.Read(buf); err != nil || string(buf[:n]) != "chunk" {
+		t.Fatalf("Read() = %q, %v, want the chunk", buf[:n], err)
+	}
+	if _, err := body.Read(buf); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Read() of a silent stream error = %v, want a deadline error", err)
+	}
+
+	// A visitor that is gone gets no more of the body
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequest(http.MethodGet, "/logs", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	if n := writeStreamingResponse(w, r, http.StatusOK, nil, strings.NewReader("line\n"), nil, ""); n != 0 || w.Body.Len() != 0 {
+		t.Errorf("streamed %d bytes to a gone visitor, want 0", n)
+	}
+}
+
+func TestDisableLegacySecret(t *testing.T) {
+	database := newTestDB(t)
+
+	for _, withDB := range []bool{true, false} {
+		for _, disabled := range []bool{false, true} {
+			var serverDB *db.DB
+			if withDB {
+				serverDB = database
+			}
+			s := newTestServer(serverDB)
+			s.secret = "s3cret"
+			s.disableLegacySecret = disabled
+			ts := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+
+			conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/_tunnel", nil)
+			if err != nil {
+				t.Fatalf("Dial() error: %v", err)
+			}
+			reg, _ := json.Marshal(protocol.Message{Type: protocol.TypeRegisterRequest, Payload: protocol.RegisterRequest{Subdomain: "legacy", Secret: "s3cret"}})
+			conn.WriteMessage(websocket.TextMessage, reg)
+			var regResp struct {
+				Payload protocol.RegisterResponse `json:"payload"`
+			}
+			if err := conn.ReadJSON(&regResp); err != nil {
+				t.Fatalf("reading registration response: %v", err)
+			}
+			conn.Close()
+			ts.Close()
+
+			if regResp.Payload.Success == disabled {
+				t.Errorf("db=%v disabled=%v: registration with the secret succeeded = %v, want %v (error %q)",
+					withDB, disabled, regResp.Payload.Success, !disabled, regResp.Payload.Error)
+			}
+		}
+	}
+}
+
+func TestHeadResponseNeverHasBody(t *testing.T) {
+	s := newTestServer(nil)
+	ts := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer ts.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/_tunnel", nil)
+	if err != nil {
+		t.Fatalf("Dial() error: %v", err)
+	}
+	defer conn.Close()
+	reg, _ := json.Marshal(protocol.Message{Type: protocol.TypeRegisterRequest, Payload: protocol.RegisterRequest{Subdomain: "head"}})
+	conn.WriteMessage(websocket.TextMessage, reg)
+	var regResp struct {
+		Payload protocol.RegisterResponse `json:"payload"`
+	}
+	if err := conn.ReadJSON(&regResp); err != nil || !regResp.Payload.Success {
+		t.Fatalf("registration failed: %v %+v", err, regResp.Payload)
+	}
+	s.mu.RLock()
+	tun := s.tunnels["head"]
+	s.mu.RUnlock()
+
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		wantLength string
+	}{
+		{"backend sets Content-Length", map[string]string{"Content-Length": "11"}, "11"},
+		{"no Content-Length", map[string]string{}, "11"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			done := make(chan struct{})
+			go func() {
+				s.forwardRequest(rec, httptest.NewRequest(http.MethodHead, "http://head.link.test/file", nil), tun, s.authMiddleware.appForSubdomain(tun.Subdomain))
+				close(done)
+			}()
+
+			var req struct {
+				Payload protocol.HTTPRequest `json:"payload"`
+			}
+			if err := conn.ReadJSON(&req); err != nil {
+				t.Fatalf("reading request: %v", err)
+			}
+			// A misbehaving local service answers HEAD with a body
+			resp, _ := json.Marshal(protocol.Message{
+				Type:    protocol.TypeHTTPResponse,
+				Payload: protocol.HTTPResponse{ID: req.Payload.ID, StatusCode: http.StatusOK, Headers: tt.headers, Body: []byte("hello world")},
+			})
+			conn.WriteMessage(websocket.TextMessage, resp)
+			<-done
+
+			if rec.Body.Len() != 0 {
+				t.Errorf("HEAD response body = %q, want empty", rec.Body.String())
+			}
+			if got := rec.Header().Get("Content-Length"); got != tt.wantLength {
+				t.Errorf("Content-Length = %q, want %q", got, tt.wantLength)
+			}
+		})
+	}
+}
+
+func TestRegisterRejectionCodes(t *testing.T) {
+	database := newTestDB(t)
+
+	token, tokenHash, _ := auth.GenerateToken()
+	if _, err := database.CreateAccount("dev", tokenHash, false); err != nil {
+		t.Fatalf("CreateAccount() error: %v", err)
+	}
+	s := newTestServer(database)
+	s.subdomainPolicy = SubdomainPolicy{MinLength: 3}
+	ts := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer ts.Close()
+
+	register := func(req protocol.RegisterRequest) (*websocket.Conn, protocol.RegisterResponse) {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/_tunnel", nil)
+		if err != nil {
+			t.Fatalf("Dial() error: %v", err)
+		}
+		reg, _ := json.Marshal(protocol.Message{Type: protocol.TypeRegisterRequest, Payload: req})
+		conn.WriteMessage(websocket.TextMessage, reg)
+		var resp struct {
+			Payload protocol.RegisterResponse `json:"payload"`
+		}
+		if err := conn.ReadJSON(&resp); err != nil {
+			t.Fatalf("reading registration response: %v", err)
+		}
+		return conn, resp.Payload
+	}
+	expect := func(name string, req protocol.RegisterRequest, want protocol.RegisterCode) {
+		t.Helper()
+		conn, resp := register(req)
+		conn.Close()
+		if resp.Success || resp.Code != want {
+			t.Errorf("%s: success %v, code %q (%s), want code %q", name, resp.Success, resp.Code, resp.Error, want)
+		}
+	}
+
+	expect("no token", protocol.RegisterRequest{Subdomain: "demo"}, protocol.RegisterCodeAuthRequired)
+	expect("unknown token", protocol.RegisterRequest{Subdomain: "demo", Token: "nope"}, protocol.RegisterCodeInvalidToken)
+	expect("not whitelisted", protocol.RegisterRequest{Subdomain: "demo", Token: token}, protocol.RegisterCodeIPNotWhitelisted)
+
+	if _, err := database.AddGlobalWhitelist("127.0.0.1/32", "local", ""); err != nil {
+		t.Fatalf("AddGlobalWhitelist() error: %v", err)
+	}
+	expect("invalid subdomain", protocol.RegisterRequest{Subdomain: "ab", Token: token}, protocol.RegisterCodeInvalidSubdomain)
+
+	conn, resp := register(protocol.RegisterRequest{Subdomain: "demo", Token: token})
+	defer conn.Close()
+	if !resp.Success || resp.Code != "" {
+		t.Fatalf("registration: success %v, code %q (%s), want success without a code", resp.Success, resp.Code, resp.Error)
+	}
+	expect("taken", protocol.RegisterRequest{Subdomain: "demo", Token: token}, protocol.RegisterCodeSubdomainTaken)
+
+	// TCP auth responses carry the same codes
+	tl := NewTunnelListener(s, nil)
+	for name, tt := range map[string]struct {
+		req  tunnel.AuthRequest
+		want protocol.RegisterCode
+	}{
+		"tcp unknown token":     {tunnel.AuthRequest{Token: "nope", Forwards: []tunnel.ForwardConfig{{Subdomain: "api", LocalPort: 3000}}}, protocol.RegisterCodeInvalidToken},
+		"tcp invalid subdomain": {tunnel.AuthRequest{Token: token, Forwards: []tunnel.ForwardConfig{{Subdomain: "ab", LocalPort: 3000}}}, protocol.RegisterCodeInvalidSubdomain},
+		"tcp taken":             {tunnel.AuthRequest{Token: token, Forwards: []tunnel.ForwardConfig{{Subdomain: "demo", LocalPort: 3000}}}, protocol.RegisterCodeSubdomainTaken},
+		"tcp unknown app":       {tunnel.AuthRequest{Token: token, AppID: "missing", Forwards: []tunnel.ForwardConfig{{Subdomain: "api", LocalPort: 3000}}}, protocol.RegisterCodeAppNotFound},
+	} {
+		resp := tl.authenticateSession(nil, &tt.req, "127.0.0.1").response
+		if resp.Success || resp.Code != tt.want {
+			t.Errorf("%s: success %v, code %q (%s), want code %q", name, resp.Success, resp.Code, resp.Error, tt.want)
+		}
+	}
+}
+
+func TestOIDCLogoutRedirect(t *testing.T) {
+	database := newTestDB(t)
+
+	h := auth.NewOIDCAuthHandler(database, "link.digit.zone")
+	// Without an OIDC handler the server clears the session cookie itself
+	s := newTestServer(database)
+	logouts := map[string]func(http.ResponseWriter, *http.Request){
+		"oidc":     func(w http.ResponseWriter, r *http.Request) { h.HandleLogout(w, r, nil) },
+		"fallback": func(w http.ResponseWriter, r *http.Request) { s.handleTunnelAuthLogout(w, r, "api") },
+	}
+	for name, logout := range logouts {
+		for redirect, want := range map[string]string{
+			"":                                "/",
+			"/goodbye":                        "/goodbye",
+			"https://api.link.digit.zone/bye": "https://api.link.digit.zone/bye",
+			"https://evil.example":            "/",
+			"https://evil.example/":           "/",
+			"//evil.example/":                 "/",
+			"javascript:alert(1)":             "/",
+		} {
+			r := httptest.NewRequest(http.MethodGet, "http://api.link.digit.zone/__auth/logout?redirect="+url.QueryEscape(redirect), nil)
+			w := httptest.NewRecorder()
+			logout(w, r)
+			if w.Code != http.StatusFound || w.Header().Get("Location") != want {
+				t.Errorf("%s logout with redirect %q: status %d location %q, want 302 to %q", name, redirect, w.Code, w.Header().Get("Location"), want)
+			}
+		}
+	}
+}
@@ -0,0 +1,454 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+	"github.com/niekvdm/digit-link/internal/version"
+)
+
+// settingSpec describes a server setting admins can change at runtime
+type settingSpec struct {
+	description string
+
+	// parse decodes and validates a new value
+	parse func(raw json.RawMessage) (interface{}, error)
+
+	// defaultValue is the value in effect while the setting is not stored
+	defaultValue func() interface{}
+
+	// apply puts a value into effect, for settings that are not read on use
+	apply func(s *Server, value interface{})
+}
+
+// serverSettings are the settings served by /admin/settings/:key
+var serverSettings = map[string]settingSpec{
+	db.SettingDefaultRateLimit: {
+		description: "Rate limit of authentication attempts for applications without their own",
+		parse: func(raw json.RawMessage) (interface{}, error) {
+			var settings db.RateLimitSettings
+			if err := decodeSetting(raw, &settings); err != nil {
+				return nil, err
+			}
+			if err := validateRateLimitSettings(&settings); err != nil {
+				return nil, err
+			}
+			return &settings, nil
+		},
+		defaultValue: func() interface{} {
+			return rateLimitSettingsOf(auth.DefaultRateLimiterConfig())
+		},
+		apply: func(s *Server, value interface{}) {
+			s.applyDefaultRateLimit(value.(*db.RateLimitSettings))
+		},
+	},
+	db.SettingHostHeader: {
+		description: "Host header sent to the local services of tunnels whose application doesn't choose one",
+		parse: func(raw json.RawMessage) (interface{}, error) {
+			var hostHeader db.HostHeaderConfig
+			if err := decodeSetting(raw, &hostHeader); err != nil {
+				return nil, err
+			}
+			if hostHeader.Mode == "" {
+				return nil, fmt.Errorf("mode is required")
+			}
+			if err := validateHostHeader(hostHeader); err != nil {
+				return nil, err
+			}
+			return &hostHeader, nil
+		},
+		defaultValue: func() interface{} {
+			return &db.HostHeaderConfig{Mode: db.HostHeaderLocal}
+		},
+	},
+	db.SettingFeatureFlags: {
+		description: "Feature flags of organizations that don't override them",
+		parse:       parseFeatureFlagDefaults,
+		defaultValue: func() interface{} {
+			return copyFeatureFlags(featureFlagDefaults)
+		},
+	},
+	db.SettingAPIKeyPurge: {
+		description: "Purge of API keys that expired longer ago than the grace window",
+		parse: func(raw json.RawMessage) (interface{}, error) {
+			var settings db.APIKeyPurgeSettings
+			if err := decodeSetting(raw, &settings); err != nil {
+				return nil, err
+			}
+			if settings.GraceDays < 0 {
+				return nil, fmt.Errorf("graceDays must not be negative")
+			}
+			return &settings, nil
+		},
+		defaultValue: func() interface{} {
+			// Off until an admin opts in: purging deletes keys for good
+			return &db.APIKeyPurgeSettings{Enabled: false, GraceDays: defaultAPIKeyPurgeGraceDays}
+		},
+	},
+	db.SettingLocalTargetPolicy: {
+		description: "Local networks and ports tunnel clients may forward to",
+		parse: func(raw json.RawMessage) (interface{}, error) {
+			var policy db.LocalTargetPolicy
+			if err := decodeSetting(raw, &policy); err != nil {
+				return nil, err
+			}
+			if err := validateLocalTargetPolicy(&policy); err != nil {
+				return nil, err
+			}
+			return &policy, nil
+		},
+		defaultValue: func() interface{} {
+			return &db.LocalTargetPolicy{}
+		},
+	},
+	db.SettingMetricsRetention: {
+		description: "Days of server metrics kept for the admin time series",
+		parse: func(raw json.RawMessage) (interface{}, error) {
+			var settings db.MetricsRetentionSettings
+			if err := decodeSetting(raw, &settings); err != nil {
+				return nil, err
+			}
+			if settings.Days < 1 || settings.Days > maxMetricsRetentionDays {
+				return nil, fmt.Errorf("days must be between 1 and %d", maxMetricsRetentionDays)
+			}
+			return &settings, nil
+		},
+		defaultValue: func() interface{} {
+			return &db.MetricsRetentionSettings{Days: defaultMetricsRetentionDays}
+		},
+	},
+	db.SettingClientVersions: {
+		description: "Latest and minimum client versions advertised to clients",
+		parse: func(raw json.RawMessage) (interface{}, error) {
+			var settings db.ClientVersionSettings
+			if err := decodeSetting(raw, &settings); err != nil {
+				return nil, err
+			}
+			for _, v := range []string{settings.Latest, settings.Minimum} {
+				if v != "" && !version.Valid(v) {
+					return nil, fmt.Errorf("invalid version %q (expected e.g. v1.2.3)", v)
+				}
+			}
+			if settings.Latest != "" && settings.Minimum != "" {
+				if cmp, _ := version.Compare(settings.Minimum, settings.Latest); cmp > 0 {
+					return nil, fmt.Errorf("minimum %s is newer than latest %s", settings.Minimum, settings.Latest)
+				}
+			}
+			return &settings, nil
+		},
+		defaultValue: func() interface{} {
+			return &db.ClientVersionSettings{}
+		},
+	},
+	db.SettingForceHTTPS: {
+		description: "Redirect or reject plain HTTP requests to tunnels, and their HSTS max-age",
+		parse: func(raw json.RawMessage) (interface{}, error) {
+			var settings db.ForceHTTPSSettings
+			if err := decodeSetting(raw, &settings); err != nil {
+				return nil, err
+			}
+			if settings.Mode == "" {
+				settings.Mode = db.ForceHTTPSOff
+			}
+			if err := validateForceHTTPSMode(settings.Mode); err != nil {
+				return nil, fmt.Errorf("mode must be %q, %q or %q", db.ForceHTTPSOff, db.ForceHTTPSRedirect, db.ForceHTTPSReject)
+			}
+			if settings.HSTSMaxAge < 0 || settings.HSTSMaxAge > maxHSTSMaxAge {
+				return nil, fmt.Errorf("hstsMaxAge must be between 0 and %d seconds", maxHSTSMaxAge)
+			}
+			return &settings, nil
+		},
+		defaultValue: func() interface{} {
+			return &db.ForceHTTPSSettings{Mode: db.ForceHTTPSOff}
+		},
+	},
+	db.SettingTOTP: {
+		description: "Issuer and account label of TOTP entries in authenticator apps",
+		parse: func(raw json.RawMessage) (interface{}, error) {
+			var settings db.TOTPSettings
+			if err := decodeSetting(raw, &settings); err != nil {
+				return nil, err
+			}
+			if settings.Issuer == "" {
+				settings.Issuer = auth.TOTPIssuer
+			}
+			if settings.Label == "" {
+				settings.Label = db.TOTPLabelUsername
+			}
+			if err := auth.ValidateTOTPLabel(settings.Issuer); err != nil {
+				return nil, fmt.Errorf("issuer %v", err)
+			}
+			if !strings.Contains(settings.Label, db.TOTPLabelUsername) {
+				return nil, fmt.Errorf("label must contain %s", db.TOTPLabelUsername)
+			}
+			if err := auth.ValidateTOTPLabel(settings.Label); err != nil {
+				return nil, fmt.Errorf("label %v", err)
+			}
+			return &settings, nil
+		},
+		defaultValue: func() interface{} {
+			return &db.TOTPSettings{Issuer: auth.TOTPIssuer, Label: db.TOTPLabelUsername}
+		},
+	},
+}
+
+// settingValue returns the parsed value of a setting in effect: the stored
+// value, or the default when none is stored or it cannot be read. The value is
+// cached and shared between callers, which must not modify it.
+func (s *Server) settingValue(key string) interface{} {
+	spec := serverSettings[key]
+	if s.settings == nil {
+		return spec.defaultValue()
+	}
+	return s.settings.value(key, spec)
+}
+
+// decodeSetting decodes a setting value, rejecting unknown fields
+func decodeSetting(raw json.RawMessage, value interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(value); err != nil {
+		return fmt.Errorf("invalid value: %v", err)
+	}
+	return nil
+}
+
+// settingsCache keeps stored server settings in memory. Settings are written
+// through it, so its entries only go stale when written elsewhere, which
+// invalidates them.
+type settingsCache struct {
+	db       *db.DB
+	mu       sync.RWMutex
+	settings map[string]*db.Setting // nil for settings that are not stored
+	values   map[string]interface{} // Parsed values in effect
+}
+
+// newSettingsCache creates an empty settings cache
+func newSettingsCache(database *db.DB) *settingsCache {
+	return &settingsCache{db: database, settings: make(map[string]*db.Setting), values: make(map[string]interface{})}
+}
+
+// value returns the parsed value of a setting in effect, parsing the stored
+// value only when it is first read after a change. A value that could not be
+// loaded is not cached, so the next read tries again.
+func (c *settingsCache) value(key string, spec settingSpec) interface{} {
+	c.mu.RLock()
+	value, ok := c.values[key]
+	c.mu.RUnlock()
+	if ok {
+		return value
+	}
+
+	setting, err := c.get(key)
+	if err != nil {
+		return spec.defaultValue()
+	}
+	value = spec.defaultValue()
+	if setting != nil {
+		if parsed, err := spec.parse(setting.Value); err == nil {
+			value = parsed
+		}
+	}
+
+	// Keep it only if the setting did not change while it was parsed
+	c.mu.Lock()
+	if current, ok := c.settings[key]; ok && current == setting {
+		c.values[key] = value
+	}
+	c.mu.Unlock()
+	return value
+}
+
+// get returns a stored setting, or nil when it is not stored
+func (c *settingsCache) get(key string) (*db.Setting, error) {
+	c.mu.RLock()
+	setting, ok := c.settings[key]
+	c.mu.RUnlock()
+	if ok {
+		return setting, nil
+	}
+
+	setting, err := c.db.GetSetting(key)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.settings[key] = setting
+	c.mu.Unlock()
+	return setting, nil
+}
+
+// set stores a setting and caches it
+func (c *settingsCache) set(key string, value json.RawMessage) (*db.Setting, error) {
+	setting, err := c.db.SetSetting(key, value)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.settings[key] = setting
+	delete(c.values, key)
+	c.mu.Unlock()
+	return setting, nil
+}
+
+// invalidate drops a cached setting after it was written directly to the database
+func (c *settingsCache) invalidate(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	delete(c.settings, key)
+	delete(c.values, key)
+	c.mu.Unlock()
+}
+
+// loadSettings applies the stored settings that are not read on use, so they
+// survive restarts. Stored values that are no longer valid are ignored.
+func (s *Server) loadSettings() {
+	for key, spec := range serverSettings {
+		if spec.apply == nil {
+			continue
+		}
+		setting, err := s.settings.get(key)
+		if err != nil {
+			log.Printf("WARNING: failed to load setting %s, using default: %v", key, err)
+			continue
+		}
+		if setting == nil {
+			continue
+		}
+		value, err := spec.parse(setting.Value)
+		if err != nil {
+			log.Printf("WARNING: stored setting %s is invalid, using default: %v", key, err)
+			continue
+		}
+		spec.apply(s, value)
+		log.Printf("Setting %s: %s", key, setting.Value)
+	}
+}
+
+// settingResponse describes a setting: its value in effect, its default and
+// when it was last changed (null while the default is in effect)
+func (s *Server) settingResponse(key string, spec settingSpec) (map[string]interface{}, error) {
+	setting, err := s.settings.get(key)
+	if err != nil {
+		return nil, err
+	}
+	resp := map[string]interface{}{
+		"key":         key,
+		"description": spec.description,
+		"value":       spec.defaultValue(),
+		"default":     spec.defaultValue(),
+		"updatedAt":   nil,
+	}
+	if setting != nil {
+		resp["value"] = setting.Value
+		resp["updatedAt"] = setting.UpdatedAt
+	}
+	return resp, nil
+}
+
+// handleListSettings returns all server settings, ordered by key
+func (s *Server) handleListSettings(w http.ResponseWriter, r *http.Request) {
+	keys := make([]string, 0, len(serverSettings))
+	for key := range serverSettings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	settings := make([]map[string]interface{}, 0, len(keys))
+	for _, key := range keys {
+		resp, err := s.settingResponse(key, serverSettings[key])
+		if err != nil {
+			log.Printf("Failed to get setting %s: %v", key, err)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+			return
+		}
+		settings = append(settings, resp)
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"settings": settings,
+	})
+}
+
+// handleGetSetting returns one server setting
+func (s *Server) handleGetSetting(w http.ResponseWriter, r *http.Request, key string) {
+	spec, ok := serverSettings[key]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Unknown setting")
+		return
+	}
+
+	resp, err := s.settingResponse(key, spec)
+	if err != nil {
+		log.Printf("Failed to get setting %s: %v", key, err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+	jsonResponse(w, resp)
+}
+
+// handleUpdateSetting validates and stores a server setting and puts it into
+// effect. The request body is the new value. The change is written to the
+// audit log.
+func (s *Server) handleUpdateSetting(w http.ResponseWriter, r *http.Request, key, adminUsername string) {
+	spec, ok := serverSettings[key]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Unknown setting")
+		return
+	}
+	if !validateJSONContentType(w, r) {
+		return
+	}
+	limitRequestBody(r)
+
+	raw, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "Invalid request body")
+		return
+	}
+	value, err := spec.parse(raw)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, err.Error())
+		return
+	}
+
+	// Store the value as parsed, so it is normalized
+	normalized, err := json.Marshal(value)
+	if err != nil {
+		log.Printf("Failed to encode setting %s: %v", key, err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+	if _, err := s.settings.set(key, normalized); err != nil {
+		log.Printf("Failed to store setting %s: %v", key, err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+	if spec.apply != nil {
+		spec.apply(s, value)
+	}
+
+	log.Printf("Setting %s changed by admin %s: %s", key, adminUsername, normalized)
+	if err := s.db.LogAdminAction(nil, db.AuditTypeSettingChanged, auth.GetClientIP(r), adminUsername, key); err != nil {
+		log.Printf("Failed to audit setting change: %v", err)
+	}
+
+	resp, err := s.settingResponse(key, spec)
+	if err != nil {
+		log.Printf("Failed to get setting %s: %v", key, err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+	jsonResponse(w, resp)
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestSettingValueCache(t *testing.T) {
+	database := newTestDB(t)
+	s := newTestServer(database)
+	purge := func() *db.APIKeyPurgeSettings {
+		return s.settingValue(db.SettingAPIKeyPurge).(*db.APIKeyPurgeSettings)
+	}
+
+	// The value is parsed once and shared until the setting changes
+	first := purge()
+	if purge() != first {
+		t.Error("settingValue() parsed the setting again without a change")
+	}
+	if _, err := s.settings.set(db.SettingAPIKeyPurge, json.RawMessage(`{"enabled":true,"graceDays":5}`)); err != nil {
+		t.Fatalf("set() error: %v", err)
+	}
+	if got := purge(); !got.Enabled || got.GraceDays != 5 {
+		t.Errorf("settingValue() after set = %+v, want the new value", got)
+	}
+
+	// Written elsewhere and invalidated
+	if _, err := database.SetSetting(db.SettingAPIKeyPurge, json.RawMessage(`{"enabled":false,"graceDays":7}`)); err != nil {
+		t.Fatalf("SetSetting() error: %v", err)
+	}
+	s.settings.invalidate(db.SettingAPIKeyPurge)
+	if got := purge(); got.Enabled || got.GraceDays != 7 {
+		t.Errorf("settingValue() after invalidate = %+v, want the stored value", got)
+	}
+
+	// Callers get their own copy of the feature flags to modify
+	flags := s.defaultFeatureFlags()
+	flags[db.FeatureStreaming] = !flags[db.FeatureStreaming]
+	if s.defaultFeatureFlags()[db.FeatureStreaming] == flags[db.FeatureStreaming] {
+		t.Error("modifying the default feature flags changed the cached value")
+	}
+}
+
+func TestServerSettings(t *testing.T) {
+	database := newTestDB(t)
+
+	s := newTestServer(database)
+	get := func(key string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		s.handleGetSetting(w, httptest.NewRequest(http.MethodGet, "/admin/settings/"+key, nil), key)
+		var resp map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+	put := func(key, body string) int {
+		r := httptest.NewRequest(http.MethodPut, "/admin/settings/"+key, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.handleUpdateSetting(w, r, key, "root")
+		return w.Code
+	}
+
+	w := httptest.NewRecorder()
+	s.handleListSettings(w, httptest.NewRequest(http.MethodGet, "/admin/settings", nil))
+	var list struct {
+		Settings []map[string]interface{} `json:"settings"`
+	}
+	json.NewDecoder(w.Body).Decode(&list)
+	if len(list.Settings) != len(serverSettings) || list.Settings[0]["key"] != db.SettingAPIKeyPurge {
+		t.Errorf("settings = %v, want every known setting", list.Settings)
+	}
+
+	if code, _ := get("no_such_setting"); code != http.StatusNotFound {
+		t.Errorf("GET unknown setting = %d, want 404", code)
+	}
+	if code := put("no_such_setting", `{}`); code != http.StatusNotFound {
+		t.Errorf("PUT unknown setting = %d, want 404", code)
+	}
+
+	code, resp := get(db.SettingDefaultRateLimit)
+	if code != http.StatusOK || resp["updatedAt"] != nil || !reflect.DeepEqual(resp["value"], resp["default"]) {
+		t.Errorf("GET unset setting = %d %v, want the default", code, resp)
+	}
+
+	for _, body := range []string{
+		`{"maxAttempts":101,"windowDurationSeconds":60,"blockDurationSeconds":60}`,
+		`{"maxAttempts":5,"windowDurationSeconds":60,"blockDurationSeconds":60,"burst":2}`,
+		`"five"`,
+	} {
+		if code := put(db.SettingDefaultRateLimit, body); code != http.StatusBadRequest {
+			t.Errorf("PUT %s = %d, want 400", body, code)
+		}
+	}
+
+	if code := put(db.SettingDefaultRateLimit, `{"maxAttempts":4,"windowDurationSeconds":120,"blockDurationSeconds":300}`); code != http.StatusOK {
+		t.Fatalf("PUT = %d, want 200", code)
+	}
+	if config := s.authMiddleware.DefaultRateLimiter().Config(); config.MaxAttempts != 4 || config.BlockDuration != 5*time.Minute {
+		t.Errorf("limiter config = %+v, want the new setting applied", config)
+	}
+	_, resp = get(db.SettingDefaultRateLimit)
+	if value, _ := resp["value"].(map[string]interface{}); value["maxAttempts"] != float64(4) || resp["updatedAt"] == nil {
+		t.Errorf("GET after PUT = %v", resp)
+	}
+
+	// Writes that bypass the cache show up once they invalidate it
+	if err := database.SetDefaultRateLimitSettings(&db.RateLimitSettings{MaxAttempts: 7, WindowDurationSeconds: 60, BlockDurationSeconds: 60}); err != nil {
+		t.Fatalf("SetDefaultRateLimitSettings() error: %v", err)
+	}
+	s.settings.invalidate(db.SettingDefaultRateLimit)
+	_, resp = get(db.SettingDefaultRateLimit)
+	if value, _ := resp["value"].(map[string]interface{}); value["maxAttempts"] != float64(7) {
+		t.Errorf("GET after invalidation = %v, want maxAttempts 7", resp)
+	}
+
+	events, err := database.GetAuditEvents(nil, nil, 10, 0)
+	if err != nil {
+		t.Fatalf("GetAuditEvents() error: %v", err)
+	}
+	if len(events) != 1 || events[0].AuthType != db.AuditTypeSettingChanged || events[0].UserIdentity != db.SettingDefaultRateLimit {
+		t.Errorf("audit events = %+v, want one setting_changed for %s", events, db.SettingDefaultRateLimit)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/niekvdm/digit-link/internal/auth"
 )
@@ -15,6 +16,7 @@ type SetupStatusResponse struct {
 
 // SetupInitRequest contains the initial setup request
 type SetupInitRequest struct {
+	SetupToken    string `json:"setupToken"` // One-time token from the server log or SETUP_TOKEN
 	Username      string `json:"username"`
 	Password      string `json:"password"`
 	AutoWhitelist bool   `json:"autoWhitelist"`
@@ -50,6 +52,29 @@ type SetupCompleteResponse struct {
 	Error   string `json:"error,omitempty"`
 }
 
+// initSetupToken creates the one-time token /setup/init requires while no admin
+// account exists. SETUP_TOKEN sets it explicitly (e.g. when several instances
+// share a database); otherwise a random token is generated and logged.
+func (s *Server) initSetupToken() {
+	if !s.NeedsSetup() {
+		return
+	}
+
+	token := os.Getenv("SETUP_TOKEN")
+	if token == "" {
+		var err error
+		token, err = auth.GenerateAdminSetupToken()
+		if err != nil {
+			log.Printf("Failed to generate setup token, /setup/init is disabled: %v", err)
+			return
+		}
+		log.Printf("No admin account exists. Setup token for /setup/init: %s", token)
+	} else {
+		log.Printf("No admin account exists. /setup/init requires the SETUP_TOKEN value")
+	}
+	s.setupTokenHash = auth.HashToken(token)
+}
+
 // handleSetup handles setup-related endpoints
 func (s *Server) handleSetup(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -71,7 +96,7 @@ func (s *Server) handleSetup(w http.ResponseWriter, r *http.Request) {
 // handleSetupStatus checks if initial setup is needed
 func (s *Server) handleSetupStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		writeError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -81,7 +106,7 @@ func (s *Server) handleSetupStatus(w http.ResponseWriter, r *http.Request) {
 		hasAdmin, err := s.db.HasAdminAccount()
 		if err != nil {
 			log.Printf("Error checking admin status: %v", err)
-			http.Error(w, `{"error": "Database error"}`, http.StatusInternalServerError)
+			writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Database error")
 			return
 		}
 		needsSetup = !hasAdmin
@@ -95,7 +120,7 @@ func (s *Server) handleSetupStatus(w http.ResponseWriter, r *http.Request) {
 // handleSetupInit performs initial admin setup - creates account with password
 func (s *Server) handleSetupInit(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		writeError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -107,6 +132,10 @@ func (s *Server) handleSetupInit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Serialize setup so the token cannot be used to create two admins
+	s.setupMu.Lock()
+	defer s.setupMu.Unlock()
+
 	// Check if already configured
 	hasAdmin, err := s.db.HasAdminAccount()
 	if err != nil {
@@ -120,7 +149,7 @@ func (s *Server) handleSetupInit(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if hasAdmin {
-		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(http.StatusForbidden)
 		json.NewEncoder(w).Encode(SetupInitResponse{
 			Success: false,
 			Error:   "Server already configured",
@@ -139,6 +168,17 @@ func (s *Server) handleSetupInit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Without a setup token (e.g. the admin was deleted after startup) setup stays closed
+	if s.setupTokenHash == "" || !auth.ValidateToken(req.SetupToken, s.setupTokenHash) {
+		log.Printf("Setup attempt with invalid setup token from %s", auth.GetClientIP(r))
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(SetupInitResponse{
+			Success: false,
+			Error:   "Invalid setup token",
+		})
+		return
+	}
+
 	// Validate username
 	username := req.Username
 	if username == "" {
@@ -200,6 +240,8 @@ func (s *Server) handleSetupInit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The token is single-use
+	s.setupTokenHash = ""
 	log.Printf("Initial admin account created: %s", username)
 
 	// Auto-whitelist the client's IP if requested
@@ -242,7 +284,7 @@ func (s *Server) handleSetupInit(w http.ResponseWriter, r *http.Request) {
 // handleSetupTOTP generates TOTP secret for initial admin setup
 func (s *Server) handleSetupTOTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		writeError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -281,7 +323,7 @@ func (s *Server) handleSetupTOTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Generate TOTP secret
-	totpKey, err := auth.GenerateTOTPSecret(username)
+	totpKey, err := s.generateTOTPSecret(username)
 	if err != nil {
 		log.Printf("Failed to generate TOTP secret: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -305,7 +347,7 @@ func (s *Server) handleSetupTOTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Store the secret (not enabled until verified)
-	if err := s.db.UpdateAccountTOTP(accountID, encryptedSecret, false); err != nil {
+	if err := s.db.BeginAccountTOTPSetup(accountID, encryptedSecret); err != nil {
 		log.Printf("Failed to store TOTP secret: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(SetupTOTPResponse{
@@ -325,7 +367,7 @@ func (s *Server) handleSetupTOTP(w http.ResponseWriter, r *http.Request) {
 // handleSetupComplete verifies TOTP and completes setup
 func (s *Server) handleSetupComplete(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		writeError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -370,6 +412,26 @@ func (s *Server) handleSetupComplete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// An abandoned setup's secret is cleared after the setup timeout
+	expired, err := s.totpSetupExpired(account)
+	if err != nil {
+		log.Printf("Failed to check TOTP setup: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(SetupCompleteResponse{
+			Success: false,
+			Error:   "Failed to verify TOTP",
+		})
+		return
+	}
+	if expired || account.TOTPSecret == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SetupCompleteResponse{
+			Success: false,
+			Error:   "TOTP setup expired. Start the setup again.",
+		})
+		return
+	}
+
 	// Decrypt the TOTP secret
 	secret, err := auth.DecryptTOTPSecret(account.TOTPSecret)
 	if err != nil {
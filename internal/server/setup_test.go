@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSetupInitRequiresToken(t *testing.T) {
+	database := newTestDB(t)
+
+	s := newTestServer(database)
+	setup := func(token string) *httptest.ResponseRecorder {
+		body := `{"setupToken":"` + token + `","username":"admin","password":"correct-horse"}`
+		w := httptest.NewRecorder()
+		s.handleSetup(w, httptest.NewRequest(http.MethodPost, "/setup/init", strings.NewReader(body)))
+		return w
+	}
+
+	// Without a token generated at startup, setup stays closed
+	if w := setup(""); w.Code != http.StatusUnauthorized {
+		t.Errorf("no setup token: status %d, want 401", w.Code)
+	}
+
+	t.Setenv("SETUP_TOKEN", "s3tup")
+	s.initSetupToken()
+	if w := setup("wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong token: status %d, want 401", w.Code)
+	}
+	if hasAdmin, _ := database.HasAdminAccount(); hasAdmin {
+		t.Fatal("admin created with a wrong setup token")
+	}
+
+	if w := setup("s3tup"); w.Code != http.StatusOK {
+		t.Fatalf("valid token: status %d (%s), want 200", w.Code, w.Body.String())
+	}
+
+	// Once an admin exists the endpoint is closed, even for the original token
+	if w := setup("s3tup"); w.Code != http.StatusForbidden {
+		t.Errorf("after setup: status %d, want 403", w.Code)
+	}
+	s.initSetupToken()
+	if s.setupTokenHash != "" {
+		t.Error("setup token issued although an admin exists")
+	}
+}
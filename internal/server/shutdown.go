@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/niekvdm/digit-link/internal/protocol"
+	"github.com/niekvdm/digit-link/internal/tunnel"
+)
+
+// shutdownNoticeFlush is how long to wait after notifying clients before closing their connections
+const shutdownNoticeFlush = 500 * time.Millisecond
+
+// Shutdown notifies connected clients, closes tunnels and waits for in-flight
+// HTTP requests to finish until ctx expires
+func (s *Server) Shutdown(ctx context.Context) error {
+	message := GetShutdownMessage()
+	delay := GetShutdownReconnectDelay()
+	log.Printf("Shutting down: notifying clients to reconnect in %s", delay)
+
+	s.notifyShutdown(message, delay)
+	time.Sleep(shutdownNoticeFlush)
+
+	if err := s.StopTunnelListener(); err != nil {
+		log.Printf("Failed to stop tunnel listener: %v", err)
+	}
+
+	// End event streams and log tails so they do not hold up the HTTP server shutdown
+	if s.events != nil {
+		s.events.Close()
+	}
+	if s.requestLog != nil {
+		s.requestLog.Close()
+	}
+
+	var err error
+	s.serversMu.Lock()
+	httpServer := s.httpServer
+	s.serversMu.Unlock()
+	if httpServer != nil {
+		err = httpServer.Shutdown(ctx)
+	}
+
+	// Close WebSocket tunnels (hijacked connections are not tracked by http.Server)
+	s.mu.Lock()
+	for subdomain, t := range s.tunnels {
+		t.Close()
+		delete(s.tunnels, subdomain)
+	}
+	s.mu.Unlock()
+
+	if s.usageCache != nil {
+		s.usageCache.Stop()
+	}
+	if s.analyticsCache != nil {
+		s.analyticsCache.Stop()
+	}
+	s.tracer.Stop()
+
+	return err
+}
+
+// notifyShutdown sends a shutdown notice to every WebSocket and TCP tunnel client
+func (s *Server) notifyShutdown(message string, delay time.Duration) {
+	data, err := json.Marshal(protocol.Message{
+		Type: protocol.TypeShutdown,
+		Payload: protocol.ShutdownNotice{
+			Message:        message,
+			ReconnectDelay: int(delay.Seconds()),
+		},
+	})
+	if err == nil {
+		s.mu.RLock()
+		for subdomain, t := range s.tunnels {
+			if err := t.WriteMessage(websocket.TextMessage, data); err != nil {
+				log.Printf("Failed to send shutdown notice to %s: %v", subdomain, err)
+			}
+		}
+		s.mu.RUnlock()
+	}
+
+	if s.tunnelListener != nil {
+		s.tunnelListener.NotifyShutdown(&tunnel.ShutdownNotice{
+			Message:        message,
+			ReconnectDelay: int(delay.Seconds()),
+		})
+	}
+}
+
+// NotifyShutdown sends a shutdown notice on a new stream of every active session
+func (tl *TunnelListener) NotifyShutdown(notice *tunnel.ShutdownNotice) {
+	// Sessions are registered once per subdomain; notify each session once
+	tl.mu.RLock()
+	sessions := make(map[*tunnel.Session]string)
+	for subdomain, session := range tl.sessions {
+		sessions[session] = subdomain
+	}
+	tl.mu.RUnlock()
+
+	for session, subdomain := range sessions {
+		stream, err := session.Open()
+		if err != nil {
+			log.Printf("Failed to open shutdown stream for %s: %v", subdomain, err)
+			continue
+		}
+		frame := tunnel.RequestFrame{Type: tunnel.TypeShutdown, Shutdown: notice}
+		if err := tunnel.WriteFrame(stream, &frame); err != nil {
+			log.Printf("Failed to send shutdown notice to %s: %v", subdomain, err)
+		}
+		stream.Close()
+	}
+}
+
+// GetShutdownMessage returns the message shown to clients on shutdown from environment or default
+func GetShutdownMessage() string {
+	if message := os.Getenv("SHUTDOWN_MESSAGE"); message != "" {
+		return message
+	}
+	return "Server is shutting down, reconnecting to another instance..."
+}
+
+// GetShutdownReconnectDelay returns the reconnect delay hinted to clients on shutdown from environment or default
+func GetShutdownReconnectDelay() time.Duration {
+	if delay := os.Getenv("SHUTDOWN_RECONNECT_DELAY"); delay != "" {
+		var d int
+		fmt.Sscanf(delay, "%d", &d)
+		if d > 0 {
+			return time.Duration(d) * time.Second
+		}
+	}
+	return 5 * time.Second
+}
@@ -0,0 +1,236 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+const (
+	// maxStaticResponsesPerApp bounds the static responses of an application
+	maxStaticResponsesPerApp = 20
+
+	// maxStaticResponsesBytes bounds the stored static responses of an application
+	// together, since they are loaded with the application on every request
+	maxStaticResponsesBytes = 64 << 10
+
+	// maxStaticResponsePathLength bounds the path of a static response
+	maxStaticResponsePathLength = 512
+)
+
+// staticResponseReservedHeaders are set by the server and cannot be configured
+var staticResponseReservedHeaders = []string{"Content-Length", "Transfer-Encoding", "Connection", "Upgrade", "Trailer"}
+
+// validateStaticResponse checks a static response before it is stored,
+// defaulting its status to 200 and canonicalizing its header names
+func validateStaticResponse(resp *db.StaticResponse) error {
+	if !strings.HasPrefix(resp.Path, "/") || strings.ContainsAny(resp.Path, "?# \t\r\n") {
+		return fmt.Errorf("path must be a URL path starting with / (without query)")
+	}
+	if len(resp.Path) > maxStaticResponsePathLength {
+		return fmt.Errorf("path must be at most %d characters", maxStaticResponsePathLength)
+	}
+	if strings.HasPrefix(resp.Path, "/__auth/") {
+		return fmt.Errorf("paths under /__auth/ are reserved")
+	}
+	if resp.Status == 0 {
+		resp.Status = http.StatusOK
+	}
+	if resp.Status < 200 || resp.Status > 599 {
+		return fmt.Errorf("status must be between 200 and 599")
+	}
+	if (resp.Status == http.StatusNoContent || resp.Status == http.StatusNotModified) && resp.Body != "" {
+		return fmt.Errorf("a %d response has no body", resp.Status)
+	}
+
+	headers := make(map[string]string, len(resp.Headers))
+	for name, value := range resp.Headers {
+		canonical := http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if canonical == "" || strings.ContainsAny(canonical, " :\t\r\n") {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if slices.Contains(staticResponseReservedHeaders, canonical) {
+			return fmt.Errorf("header %s is set by the server", canonical)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("header %s has an invalid value", canonical)
+		}
+		headers[canonical] = value
+	}
+	resp.Headers = headers
+	if len(resp.Headers) == 0 {
+		resp.Headers = nil
+	}
+	return nil
+}
+
+// validateStaticResponses checks the full set of static responses of an
+// application, such as one from an imported bundle
+func validateStaticResponses(responses []db.StaticResponse) error {
+	if len(responses) > maxStaticResponsesPerApp {
+		return fmt.Errorf("at most %d static responses are allowed", maxStaticResponsesPerApp)
+	}
+	seen := make(map[string]bool, len(responses))
+	for i := range responses {
+		if err := validateStaticResponse(&responses[i]); err != nil {
+			return fmt.Errorf("static response %s: %v", responses[i].Path, err)
+		}
+		if seen[responses[i].Path] {
+			return fmt.Errorf("duplicate static response for %s", responses[i].Path)
+		}
+		seen[responses[i].Path] = true
+	}
+	if data, _ := json.Marshal(responses); len(data) > maxStaticResponsesBytes {
+		return fmt.Errorf("static responses must be at most %d KB together", maxStaticResponsesBytes>>10)
+	}
+	return nil
+}
+
+// serveStaticResponse answers a GET or HEAD request with the static response
+// of the subdomain's application for its path. Before the visitor is
+// authenticated only public responses are served. Returns false if there is
+// none, so the request continues to the tunnel.
+func (s *Server) serveStaticResponse(w http.ResponseWriter, r *http.Request, app *db.Application, authenticated bool) bool {
+	if app == nil || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return false
+	}
+	i := slices.IndexFunc(app.StaticResponses, func(resp db.StaticResponse) bool { return resp.Path == r.URL.Path })
+	if i < 0 {
+		return false
+	}
+	resp := &app.StaticResponses[i]
+	if !resp.Public && !authenticated {
+		return false
+	}
+
+	for name, value := range resp.Headers {
+		w.Header().Set(name, value)
+	}
+	if w.Header().Get("Content-Type") == "" && resp.Body != "" {
+		w.Header().Set("Content-Type", http.DetectContentType([]byte(resp.Body)))
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(resp.Body)))
+	w.WriteHeader(resp.Status)
+	if r.Method != http.MethodHead {
+		w.Write([]byte(resp.Body))
+	}
+	return true
+}
+
+// handleOrgListStaticResponses lists an application's static responses
+func (s *Server) handleOrgListStaticResponses(w http.ResponseWriter, r *http.Request, orgCtx *OrgContext, appID string) {
+	app, err := s.verifyOrgOwnership(orgCtx, appID)
+	if err != nil {
+		log.Printf("Failed to get application: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if app == nil {
+		jsonError(w, "Application not found", http.StatusNotFound)
+		return
+	}
+
+	responses := app.StaticResponses
+	if responses == nil {
+		responses = []db.StaticResponse{}
+	}
+	jsonResponse(w, map[string]interface{}{
+		"responses":    responses,
+		"maxResponses": maxStaticResponsesPerApp,
+		"maxBytes":     maxStaticResponsesBytes,
+	})
+}
+
+// handleOrgSetStaticResponse adds a static response to an application, or
+// replaces the one at the same path
+func (s *Server) handleOrgSetStaticResponse(w http.ResponseWriter, r *http.Request, orgCtx *OrgContext, appID string) {
+	app, err := s.verifyOrgOwnership(orgCtx, appID)
+	if err != nil {
+		log.Printf("Failed to get application: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if app == nil {
+		jsonError(w, "Application not found", http.StatusNotFound)
+		return
+	}
+
+	if !validateOrgJSONRequest(w, r) {
+		return
+	}
+	var resp db.StaticResponse
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxStaticResponsesBytes)).Decode(&resp); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := validateStaticResponse(&resp); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	responses := slices.Clone(app.StaticResponses)
+	if i := slices.IndexFunc(responses, func(existing db.StaticResponse) bool { return existing.Path == resp.Path }); i >= 0 {
+		responses[i] = resp
+	} else {
+		responses = append(responses, resp)
+	}
+	if len(responses) > maxStaticResponsesPerApp {
+		jsonError(w, fmt.Sprintf("An application can have at most %d static responses", maxStaticResponsesPerApp), http.StatusConflict)
+		return
+	}
+	if data, _ := json.Marshal(responses); len(data) > maxStaticResponsesBytes {
+		jsonError(w, fmt.Sprintf("Static responses of an application must be at most %d KB together", maxStaticResponsesBytes>>10), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if err := s.db.UpdateApplicationStaticResponses(app.ID, responses); err != nil {
+		log.Printf("Failed to update static responses: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if s.authMiddleware != nil {
+		s.authMiddleware.InvalidateSubdomainCache(app.Subdomain)
+	}
+
+	log.Printf("Static response %d at %s set on app %s by %s", resp.Status, resp.Path, app.Subdomain, orgCtx.Username)
+	jsonResponse(w, map[string]interface{}{"success": true, "response": resp})
+}
+
+// handleOrgDeleteStaticResponse removes the static response at a path from an application
+func (s *Server) handleOrgDeleteStaticResponse(w http.ResponseWriter, r *http.Request, orgCtx *OrgContext, appID string) {
+	app, err := s.verifyOrgOwnership(orgCtx, appID)
+	if err != nil {
+		log.Printf("Failed to get application: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if app == nil {
+		jsonError(w, "Application not found", http.StatusNotFound)
+		return
+	}
+
+	path := r.URL.Query().Get("path")
+	responses := slices.DeleteFunc(slices.Clone(app.StaticResponses), func(existing db.StaticResponse) bool { return existing.Path == path })
+	if len(responses) == len(app.StaticResponses) {
+		jsonError(w, "Static response not found", http.StatusNotFound)
+		return
+	}
+
+	if err := s.db.UpdateApplicationStaticResponses(app.ID, responses); err != nil {
+		log.Printf("Failed to update static responses: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if s.authMiddleware != nil {
+		s.authMiddleware.InvalidateSubdomainCache(app.Subdomain)
+	}
+
+	log.Printf("Static response at %s removed from app %s by %s", path, app.Subdomain, orgCtx.Username)
+	jsonResponse(w, map[string]interface{}{"success": true})
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestStaticResponses(t *testing.T) {
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	app, err := database.CreateApplication(org.ID, "myapp", "My App")
+	if err != nil {
+		t.Fatalf("CreateApplication() error: %v", err)
+	}
+
+	s := newTestServer(database)
+	s.domain = "link.digit.zone"
+	orgCtx := &OrgContext{OrgID: org.ID, Username: "alice"}
+	set := func(body string) int {
+		r := httptest.NewRequest(http.MethodPut, "/org/applications/"+app.ID+"/static-responses", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.handleOrgSetStaticResponse(w, r, orgCtx, app.ID)
+		return w.Code
+	}
+	visit := func(method, path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		r.Host = "myapp.link.digit.zone"
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+
+	// Served before the tunnel lookup, so it answers without a tunnel
+	if w := visit(http.MethodGet, "/status"); w.Code != http.StatusNotFound {
+		t.Fatalf("before: status = %d, want 404 (tunnel not found)", w.Code)
+	}
+	if code := set(`{"path":"/status","headers":{"content-type":"application/json"},"body":"{\"ok\":true}","public":true}`); code != http.StatusOK {
+		t.Fatalf("set /status: status = %d, want 200", code)
+	}
+	w := visit(http.MethodGet, "/status")
+	if w.Code != http.StatusOK || w.Body.String() != `{"ok":true}` || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("GET /status = %d %q (%s), want 200 {\"ok\":true} as JSON", w.Code, w.Body.String(), w.Header().Get("Content-Type"))
+	}
+	if w := visit(http.MethodHead, "/status"); w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("HEAD /status = %d with %d body bytes, want 200 without body", w.Code, w.Body.Len())
+	}
+	if w := visit(http.MethodGet, "/status/more"); w.Code != http.StatusNotFound {
+		t.Errorf("GET /status/more = %d, want 404 (paths match exactly)", w.Code)
+	}
+	if w := visit(http.MethodPost, "/status"); w.Code != http.StatusNotFound {
+		t.Errorf("POST /status = %d, want 404 (only GET and HEAD are answered)", w.Code)
+	}
+	if requests := s.metrics.requests.Load(); requests != 5 {
+		t.Errorf("counted %d requests, want 5", requests)
+	}
+
+	// Responses that are not public wait for the tunnel lookup, rules and auth
+	if code := set(`{"path":"/private","body":"internal"}`); code != http.StatusOK {
+		t.Fatalf("set /private: status = %d, want 200", code)
+	}
+	if w := visit(http.MethodGet, "/private"); w.Code != http.StatusNotFound {
+		t.Errorf("GET /private without a tunnel = %d, want 404 (tunnel not found)", w.Code)
+	}
+	s.tunnels["myapp"] = &Tunnel{Subdomain: "myapp", OrgID: org.ID, AppID: app.ID}
+	if w := visit(http.MethodGet, "/private"); w.Code != http.StatusOK || w.Body.String() != "internal" {
+		t.Errorf("GET /private with a tunnel = %d %q, want 200 internal", w.Code, w.Body.String())
+	}
+	delete(s.tunnels, "myapp")
+
+	// Setting the same path again replaces it
+	if code := set(`{"path":"/status","status":503,"body":"down for maintenance","public":true}`); code != http.StatusOK {
+		t.Fatalf("replace /status: status = %d, want 200", code)
+	}
+	if w := visit(http.MethodGet, "/status"); w.Code != http.StatusServiceUnavailable || w.Body.String() != "down for maintenance" {
+		t.Errorf("GET /status = %d %q, want 503 maintenance", w.Code, w.Body.String())
+	}
+
+	for _, body := range []string{
+		`{"path":"status"}`,
+		`{"path":"/a?b=1"}`,
+		`{"path":"/__auth/login"}`,
+		`{"path":"/a","status":99}`,
+		`{"path":"/a","status":204,"body":"x"}`,
+		`{"path":"/a","headers":{"Content-Length":"5"}}`,
+		`{"path":"/a","headers":{"X-Bad":"a\r\nb"}}`,
+	} {
+		if code := set(body); code != http.StatusBadRequest {
+			t.Errorf("set %s: status = %d, want 400", body, code)
+		}
+	}
+	big := strings.Repeat("x", maxStaticResponsesBytes/2)
+	set(`{"path":"/big1","body":"` + big + `"}`)
+	if code := set(`{"path":"/big2","body":"` + big + `"}`); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("set over the size limit: status = %d, want 413", code)
+	}
+
+	r := httptest.NewRequest(http.MethodDelete, "/org/applications/"+app.ID+"/static-responses?path=/status", nil)
+	rec := httptest.NewRecorder()
+	s.handleOrgDeleteStaticResponse(rec, r, orgCtx, app.ID)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete /status: status = %d, want 200", rec.Code)
+	}
+	if w := visit(http.MethodGet, "/status"); w.Code != http.StatusNotFound {
+		t.Errorf("after delete: status = %d, want 404", w.Code)
+	}
+	rec = httptest.NewRecorder()
+	s.handleOrgDeleteStaticResponse(rec, r, orgCtx, app.ID)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("delete again: status = %d, want 404", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleOrgListStaticResponses(rec, httptest.NewRequest(http.MethodGet, "/org/applications/"+app.ID+"/static-responses", nil), orgCtx, app.ID)
+	var list struct {
+		Responses []db.StaticResponse `json:"responses"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list.Responses) != 2 || list.Responses[0].Path != "/private" {
+		t.Errorf("list = %s, want /private and /big1", rec.Body.String())
+	}
+}
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+const (
+	// maxSubdomainLength is the DNS label limit, the upper bound for any policy
+	maxSubdomainLength = 63
+	// randomSubdomainLength is the length of generated subdomains unless the policy needs more
+	randomSubdomainLength = 8
+	// randomSubdomainCharset is the default alphabet of generated subdomains
+	randomSubdomainCharset = "abcdefghijklmnopqrstuvwxyz0123456789"
+	// maxRandomSubdomainAttempts bounds how often a generated subdomain is redrawn before giving up
+	maxRandomSubdomainAttempts = 32
+	// randomSubdomainGrowAfter is how many taken names are drawn at one length before
+	// the random part grows by a character, so a crowded namespace stops getting retried
+	randomSubdomainGrowAfter = 4
+	// prefixedSubdomainSuffixLength is the length of the random part after a requested prefix
+	prefixedSubdomainSuffixLength = 4
+)
+
+// SubdomainPolicy holds the naming rules for tunnel and application subdomains.
+// The zero value allows 1-63 characters of [a-z0-9-], not starting or ending with '-'.
+type SubdomainPolicy struct {
+	MinLength            int  // 0 means 1
+	MaxLength            int  // 0 means 63
+	RequireLeadingLetter bool // Reject names that start with a digit
+	RejectNumericOnly    bool // Reject names made of digits only
+
+	RandomLength  int    // Length of generated subdomains; 0 means 8, kept within the lengths above
+	RandomCharset string // Characters of generated subdomains; "" means a-z and 0-9
+}
+
+// GetSubdomainPolicy returns the subdomain policy from environment or defaults
+func GetSubdomainPolicy() SubdomainPolicy {
+	var p SubdomainPolicy
+	if v := os.Getenv("SUBDOMAIN_MIN_LENGTH"); v != "" {
+		fmt.Sscanf(v, "%d", &p.MinLength)
+	}
+	if v := os.Getenv("SUBDOMAIN_MAX_LENGTH"); v != "" {
+		fmt.Sscanf(v, "%d", &p.MaxLength)
+	}
+	p.RequireLeadingLetter = os.Getenv("SUBDOMAIN_ALLOW_LEADING_DIGIT") == "false"
+	p.RejectNumericOnly = os.Getenv("SUBDOMAIN_ALLOW_NUMERIC_ONLY") == "false"
+	if v := os.Getenv("SUBDOMAIN_RANDOM_LENGTH"); v != "" {
+		fmt.Sscanf(v, "%d", &p.RandomLength)
+	}
+	p.RandomCharset = strings.ToLower(os.Getenv("SUBDOMAIN_RANDOM_CHARSET"))
+
+	if p.MinLength < 0 || p.MinLength > maxSubdomainLength {
+		log.Printf("WARNING: SUBDOMAIN_MIN_LENGTH must be between 1 and %d, using default", maxSubdomainLength)
+		p.MinLength = 0
+	}
+	if p.MaxLength < 0 || p.MaxLength > maxSubdomainLength {
+		log.Printf("WARNING: SUBDOMAIN_MAX_LENGTH must be between 1 and %d, using default", maxSubdomainLength)
+		p.MaxLength = 0
+	}
+	if p.minLength() > p.maxLength() {
+		log.Printf("WARNING: SUBDOMAIN_MIN_LENGTH is above SUBDOMAIN_MAX_LENGTH, using default lengths")
+		p.MinLength, p.MaxLength = 0, 0
+	}
+	if p.RandomLength < 0 || p.RandomLength > maxSubdomainLength {
+		log.Printf("WARNING: SUBDOMAIN_RANDOM_LENGTH must be between 1 and %d, using default", maxSubdomainLength)
+		p.RandomLength = 0
+	}
+	if p.RandomCharset != "" {
+		if err := p.validateRandomCharset(); err != nil {
+			log.Printf("WARNING: SUBDOMAIN_RANDOM_CHARSET %v, using default", err)
+			p.RandomCharset = ""
+		}
+	}
+	return p
+}
+
+// validateRandomCharset checks that the charset can generate names the policy accepts
+func (p SubdomainPolicy) validateRandomCharset() error {
+	seen := make(map[rune]bool)
+	letters := false
+	for _, c := range p.RandomCharset {
+		if !((c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')) {
+			return fmt.Errorf("may only contain lowercase letters and digits")
+		}
+		if seen[c] {
+			return fmt.Errorf("repeats %q", c)
+		}
+		seen[c] = true
+		letters = letters || (c >= 'a' && c <= 'z')
+	}
+	if len(seen) < 2 {
+		return fmt.Errorf("needs at least two characters")
+	}
+	if !letters && (p.RequireLeadingLetter || p.RejectNumericOnly) {
+		return fmt.Errorf("needs a letter for the subdomain policy")
+	}
+	return nil
+}
+
+func (p SubdomainPolicy) randomLength() int {
+	n := randomSubdomainLength
+	if p.RandomLength > 0 {
+		n = p.RandomLength
+	}
+	return min(max(n, p.minLength()), p.maxLength())
+}
+
+func (p SubdomainPolicy) randomCharset() string {
+	if p.RandomCharset != "" {
+		return p.RandomCharset
+	}
+	return randomSubdomainCharset
+}
+
+func (p SubdomainPolicy) minLength() int {
+	if p.MinLength > 0 {
+		return p.MinLength
+	}
+	return 1
+}
+
+func (p SubdomainPolicy) maxLength() int {
+	if p.MaxLength > 0 {
+		return p.MaxLength
+	}
+	return maxSubdomainLength
+}
+
+// Validate checks a lowercase subdomain against the policy and the reserved names
+func (p SubdomainPolicy) Validate(s string) error {
+	if len(s) < p.minLength() || len(s) > p.maxLength() {
+		return fmt.Errorf("subdomain must be between %d and %d characters", p.minLength(), p.maxLength())
+	}
+
+	if reservedSubdomains[s] {
+		return fmt.Errorf("subdomain %q is reserved", s)
+	}
+
+	numeric := true
+	for _, c := range s {
+		if !((c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-') {
+			return fmt.Errorf("subdomain may only contain lowercase letters, digits and '-'")
+		}
+		if c < '0' || c > '9' {
+			numeric = false
+		}
+	}
+	if s[0] == '-' || s[len(s)-1] == '-' {
+		return fmt.Errorf("subdomain cannot start or end with '-'")
+	}
+	if p.RequireLeadingLetter && s[0] >= '0' && s[0] <= '9' {
+		return fmt.Errorf("subdomain must start with a letter")
+	}
+	if p.RejectNumericOnly && numeric {
+		return fmt.Errorf("subdomain cannot be numeric only")
+	}
+	return nil
+}
+
+// isValidSubdomain checks if a subdomain name is valid under the server's policy
+func (s *Server) isValidSubdomain(subdomain string) bool {
+	return s.subdomainPolicy.Validate(subdomain) == nil
+}
+
+// generateRandomSubdomain creates an available random subdomain that satisfies the server's policy
+func (s *Server) generateRandomSubdomain() (string, error) {
+	return s.generateSubdomain("", s.subdomainPolicy.randomLength())
+}
+
+// defaultSubdomain returns the subdomain for a registration that asks for none:
+// the account's default subdomain while it is free, otherwise a random one
+func (s *Server) defaultSubdomain(account *db.Account) (string, error) {
+	if account != nil && account.DefaultSubdomain != "" && s.isSubdomainAvailable(account.DefaultSubdomain) {
+		return account.DefaultSubdomain, nil
+	}
+	return s.generateRandomSubdomain()
+}
+
+// generateSubdomain draws available subdomains made of prefix and n characters of
+// the policy's charset. Every randomSubdomainGrowAfter taken names the random part
+// grows by a character, up to the policy's maximum length. Draws never sleep, so a
+// registration is not held up by a crowded namespace; it gives up after
+// maxRandomSubdomainAttempts draws.
+func (s *Server) generateSubdomain(prefix string, n int) (string, error) {
+	charset := s.subdomainPolicy.randomCharset()
+	taken := 0
+	for i := 0; i < maxRandomSubdomainAttempts; i++ {
+		candidate := prefix + randomString(charset, n)
+		if prefix == "" && s.subdomainPolicy.RequireLeadingLetter {
+			// Draw the first character from the letters so the policy doesn't
+			// turn most draws of a digit-heavy charset into wasted attempts
+			candidate = randomString(charsetLetters(charset), 1) + candidate[1:]
+		}
+		if !s.isValidSubdomain(candidate) {
+			// Breaks a policy rule (a leading digit, say) rather than colliding
+			continue
+		}
+		if s.isSubdomainAvailable(candidate) {
+			return candidate, nil
+		}
+
+		taken++
+		if taken%randomSubdomainGrowAfter == 0 && len(prefix)+n < s.subdomainPolicy.maxLength() {
+			n++
+		}
+	}
+	return "", fmt.Errorf("no free subdomain found after %d attempts", maxRandomSubdomainAttempts)
+}
+
+// charsetLetters returns the letters of charset, which has at least one when
+// the policy requires a leading letter (see validateRandomCharset)
+func charsetLetters(charset string) string {
+	return strings.Map(func(c rune) rune {
+		if c >= 'a' && c <= 'z' {
+			return c
+		}
+		return -1
+	}, charset)
+}
+
+// randomString returns n characters drawn uniformly from charset
+func randomString(charset string, n int) string {
+	// Bytes at or above limit are rejected so every character is equally likely
+	limit := 256 - 256%len(charset)
+	b := make([]byte, 0, n)
+	buf := make([]byte, n+n/2+1)
+	for len(b) < n {
+		rand.Read(buf)
+		for _, v := range buf {
+			if int(v) < limit && len(b) < n {
+				b = append(b, charset[int(v)%len(charset)])
+			}
+		}
+	}
+	return string(b)
+}
+
+// prefixedSubdomainSuffix returns how many random characters follow a prefix,
+// enough to reach the policy's minimum length
+func (s *Server) prefixedSubdomainSuffix(prefix string) int {
+	return max(prefixedSubdomainSuffixLength, s.subdomainPolicy.minLength()-len(prefix))
+}
+
+// validateSubdomainPrefix checks that names generated from a lowercase prefix
+// can satisfy the server's policy
+func (s *Server) validateSubdomainPrefix(prefix string) error {
+	n := s.prefixedSubdomainSuffix(prefix)
+	if maxPrefix := s.subdomainPolicy.maxLength() - n; len(prefix) > maxPrefix {
+		return fmt.Errorf("prefix can be at most %d characters", maxPrefix)
+	}
+	return s.subdomainPolicy.Validate(prefix + strings.Repeat("a", n))
+}
+
+// generatePrefixedSubdomain creates an available subdomain made of a validated
+// prefix and a random suffix, redrawing the suffix on collision
+func (s *Server) generatePrefixedSubdomain(prefix string) (string, error) {
+	return s.generateSubdomain(prefix, s.prefixedSubdomainSuffix(prefix))
+}
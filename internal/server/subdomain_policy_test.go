@@ -0,0 +1,152 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSubdomainPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    SubdomainPolicy
+		subdomain string
+		valid     bool
+	}{
+		{"default allows single char", SubdomainPolicy{}, "a", true},
+		{"default allows 63 chars", SubdomainPolicy{}, strings.Repeat("a", 63), true},
+		{"default rejects 64 chars", SubdomainPolicy{}, strings.Repeat("a", 64), false},
+		{"default allows leading digit", SubdomainPolicy{}, "1app", true},
+		{"default allows numeric only", SubdomainPolicy{}, "12345", true},
+		{"default rejects uppercase", SubdomainPolicy{}, "MyApp", false},
+		{"default rejects underscore", SubdomainPolicy{}, "my_app", false},
+		{"default rejects leading hyphen", SubdomainPolicy{}, "-app", false},
+		{"default rejects trailing hyphen", SubdomainPolicy{}, "app-", false},
+		{"default rejects reserved", SubdomainPolicy{}, "admin", false},
+		{"min length rejects short", SubdomainPolicy{MinLength: 3}, "ab", false},
+		{"min length allows exact", SubdomainPolicy{MinLength: 3}, "abc", true},
+		{"max length rejects long", SubdomainPolicy{MaxLength: 10}, "abcdefghijk", false},
+		{"max length allows exact", SubdomainPolicy{MaxLength: 10}, "abcdefghij", true},
+		{"leading letter rejects digit", SubdomainPolicy{RequireLeadingLetter: true}, "1app", false},
+		{"leading letter allows letter", SubdomainPolicy{RequireLeadingLetter: true}, "app1", true},
+		{"numeric only rejected", SubdomainPolicy{RejectNumericOnly: true}, "12345", false},
+		{"numeric with hyphen allowed", SubdomainPolicy{RejectNumericOnly: true}, "123-45", true},
+		{"mixed allowed when numeric only rejected", SubdomainPolicy{RejectNumericOnly: true}, "1app", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate(tt.subdomain)
+			if (err == nil) != tt.valid {
+				t.Errorf("Validate(%q) = %v, want valid=%v", tt.subdomain, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestGetSubdomainPolicy(t *testing.T) {
+	t.Setenv("SUBDOMAIN_MIN_LENGTH", "3")
+	t.Setenv("SUBDOMAIN_MAX_LENGTH", "20")
+	t.Setenv("SUBDOMAIN_ALLOW_LEADING_DIGIT", "false")
+	t.Setenv("SUBDOMAIN_ALLOW_NUMERIC_ONLY", "false")
+	t.Setenv("SUBDOMAIN_RANDOM_LENGTH", "6")
+	t.Setenv("SUBDOMAIN_RANDOM_CHARSET", "ABCdef234")
+
+	want := SubdomainPolicy{MinLength: 3, MaxLength: 20, RequireLeadingLetter: true, RejectNumericOnly: true, RandomLength: 6, RandomCharset: "abcdef234"}
+	if got := GetSubdomainPolicy(); got != want {
+		t.Errorf("GetSubdomainPolicy() = %+v, want %+v", got, want)
+	}
+
+	for _, charset := range []string{"a", "aab", "ab-", "0123"} {
+		t.Setenv("SUBDOMAIN_RANDOM_CHARSET", charset)
+		if got := GetSubdomainPolicy(); got.RandomCharset != "" {
+			t.Errorf("SUBDOMAIN_RANDOM_CHARSET=%s: got %q, want the default", charset, got.RandomCharset)
+		}
+	}
+
+	t.Setenv("SUBDOMAIN_MIN_LENGTH", "30")
+	if got := GetSubdomainPolicy(); got.MinLength != 0 || got.MaxLength != 0 {
+		t.Errorf("min above max: got %+v, want default lengths", got)
+	}
+
+	// Generated subdomains must satisfy the policy too
+	s := &Server{subdomainPolicy: SubdomainPolicy{MinLength: 12, RequireLeadingLetter: true, RejectNumericOnly: true}}
+	for i := 0; i < 20; i++ {
+		if sub, err := s.generateRandomSubdomain(); err != nil || !s.isValidSubdomain(sub) {
+			t.Fatalf("generateRandomSubdomain() = %q, %v, violates policy", sub, err)
+		}
+	}
+
+	// A charset that is mostly digits still yields names with a leading letter
+	s.subdomainPolicy = SubdomainPolicy{RequireLeadingLetter: true, RandomLength: 4, RandomCharset: "0123456789a"}
+	for i := 0; i < 50; i++ {
+		if sub, err := s.generateRandomSubdomain(); err != nil || !s.isValidSubdomain(sub) {
+			t.Fatalf("generateRandomSubdomain() = %q, %v, violates policy", sub, err)
+		}
+	}
+}
+
+func TestPrefixedSubdomain(t *testing.T) {
+	s := newTestServer(nil)
+	s.subdomainPolicy = SubdomainPolicy{MinLength: 12, MaxLength: 20, RequireLeadingLetter: true}
+
+	rejected := []string{"-feature", "1feature", "feat_", "a-very-long-prefix-"}
+	for _, prefix := range rejected {
+		if err := s.validateSubdomainPrefix(prefix); err == nil {
+			t.Errorf("validateSubdomainPrefix(%q) = nil, want error", prefix)
+		}
+	}
+
+	for _, prefix := range []string{"feature-", "pr", "a-prefix-of-16ch"} {
+		if err := s.validateSubdomainPrefix(prefix); err != nil {
+			t.Fatalf("validateSubdomainPrefix(%q) error: %v", prefix, err)
+		}
+		sub, _ := s.generatePrefixedSubdomain(prefix)
+		if !strings.HasPrefix(sub, prefix) || len(sub)-len(prefix) < prefixedSubdomainSuffixLength || !s.isValidSubdomain(sub) {
+			t.Errorf("generatePrefixedSubdomain(%q) = %q, want a valid name with a random suffix", prefix, sub)
+		}
+	}
+
+	// Names held by a tunnel are never handed out
+	for i := 0; i < 50; i++ {
+		sub, err := s.generatePrefixedSubdomain("feature-")
+		if err != nil {
+			t.Fatalf("generatePrefixedSubdomain() error: %v", err)
+		}
+		if _, taken := s.tunnels[sub]; taken {
+			t.Fatalf("generatePrefixedSubdomain() = %q, already in use", sub)
+		}
+		s.tunnels[sub] = &Tunnel{Subdomain: sub}
+	}
+}
+
+func TestRandomSubdomainCrowdedNamespace(t *testing.T) {
+	// Two-character names from a three-letter charset: 9 names in all
+	s := newTestServer(nil)
+	s.subdomainPolicy = SubdomainPolicy{MaxLength: 3, RandomLength: 2, RandomCharset: "abc"}
+	for _, a := range "abc" {
+		for _, b := range "abc" {
+			sub := string(a) + string(b)
+			s.tunnels[sub] = &Tunnel{Subdomain: sub}
+		}
+	}
+
+	// Every two-character name is taken, so the generator has to grow to three
+	sub, err := s.generateRandomSubdomain()
+	if err != nil {
+		t.Fatalf("generateRandomSubdomain() error: %v", err)
+	}
+	if len(sub) != 3 || strings.Trim(sub, "abc") != "" {
+		t.Errorf("generateRandomSubdomain() = %q, want a free three-character name", sub)
+	}
+
+	// With no room to grow, it gives up instead of retrying forever
+	s.subdomainPolicy.MaxLength = 2
+	start := time.Now()
+	if sub, err := s.generateRandomSubdomain(); err == nil {
+		t.Errorf("generateRandomSubdomain() = %q in a full namespace, want an error", sub)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("giving up took %v, want the retries bounded", elapsed)
+	}
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// maxSubdomainSuggestions is the number of alternatives offered on a subdomain conflict
+const maxSubdomainSuggestions = 3
+
+// maxSuggestionAttempts bounds the availability probes per conflict
+const maxSuggestionAttempts = 12
+
+// isSubdomainInUse checks if a subdomain is held by a connected WebSocket or TCP tunnel
+func (s *Server) isSubdomainInUse(subdomain string) bool {
+	s.mu.RLock()
+	_, wsExists := s.tunnels[subdomain]
+	s.mu.RUnlock()
+	if wsExists {
+		return true
+	}
+
+	if s.tunnelListener != nil {
+		if _, tcpExists := s.tunnelListener.GetSession(subdomain); tcpExists {
+			return true
+		}
+	}
+	return false
+}
+
+// isSubdomainAvailable checks if a subdomain is valid, not connected and not reserved by an application
+func (s *Server) isSubdomainAvailable(subdomain string) bool {
+	if !s.isValidSubdomain(subdomain) || s.isSubdomainInUse(subdomain) {
+		return false
+	}
+
+	if s.db != nil {
+		available, err := s.db.IsSubdomainAvailable(subdomain)
+		if err != nil || !available {
+			return false
+		}
+	}
+	return true
+}
+
+// suggestSubdomains returns available alternatives for a taken subdomain.
+// Numbered variants (name-2, name-3, ...) are tried first so suggestions are stable
+// between attempts, then random suffixes fill any remaining slots.
+func (s *Server) suggestSubdomains(subdomain string) []string {
+	base := strings.Trim(strings.ToLower(subdomain), "-")
+	if base == "" {
+		return nil
+	}
+	// Leave room for a suffix within the subdomain length limit
+	if maxBase := s.subdomainPolicy.maxLength() - 8; len(base) > maxBase && maxBase > 0 {
+		base = strings.TrimRight(base[:maxBase], "-")
+	}
+
+	suggestions := make([]string, 0, maxSubdomainSuggestions)
+	for i := 0; i < maxSuggestionAttempts && len(suggestions) < maxSubdomainSuggestions; i++ {
+		var candidate string
+		if i < maxSuggestionAttempts/2 {
+			candidate = fmt.Sprintf("%s-%d", base, i+2)
+		} else {
+			candidate = fmt.Sprintf("%s-%s", base, uuid.New().String()[:4])
+		}
+		if s.isSubdomainAvailable(candidate) {
+			suggestions = append(suggestions, candidate)
+		}
+	}
+	return suggestions
+}
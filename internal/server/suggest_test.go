@@ -0,0 +1,71 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSuggestSubdomains(t *testing.T) {
+	database := newTestDB(t)
+	s := newTestServer(database)
+
+	org, err := database.CreateOrganization("Acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	// myapp-2 is reserved by an application and myapp-4 is held by a connected tunnel
+	if _, err := database.CreateApplication(org.ID, "myapp-2", "Reserved"); err != nil {
+		t.Fatalf("CreateApplication() error: %v", err)
+	}
+	s.tunnels["myapp-4"] = &Tunnel{Subdomain: "myapp-4"}
+
+	if got := s.suggestSubdomains("myapp"); !reflect.DeepEqual(got, []string{"myapp-3", "myapp-5", "myapp-6"}) {
+		t.Errorf("suggestSubdomains(myapp) = %v, want the free numbered variants", got)
+	}
+	// The name is normalized before the suffix is added
+	if got := s.suggestSubdomains("-MyApp-"); !reflect.DeepEqual(got, []string{"myapp-3", "myapp-5", "myapp-6"}) {
+		t.Errorf("suggestSubdomains(-MyApp-) = %v, want the suggestions of myapp", got)
+	}
+
+	// A reserved name gets variants that are not reserved themselves
+	if got := s.suggestSubdomains("api"); !reflect.DeepEqual(got, []string{"api-2", "api-3", "api-4"}) {
+		t.Errorf("suggestSubdomains(api) = %v, want numbered variants", got)
+	}
+
+	for _, name := range []string{"", "---"} {
+		if got := s.suggestSubdomains(name); got != nil {
+			t.Errorf("suggestSubdomains(%q) = %v, want none", name, got)
+		}
+	}
+	// Candidates the policy rejects are never suggested
+	if got := s.suggestSubdomains("my_app"); len(got) != 0 {
+		t.Errorf("suggestSubdomains(my_app) = %v, want none", got)
+	}
+}
+
+func TestSuggestSubdomainsLimits(t *testing.T) {
+	s := newTestServer(nil)
+	s.subdomainPolicy = SubdomainPolicy{MaxLength: 12}
+
+	// Long names are shortened so the suffix fits the policy
+	if got := s.suggestSubdomains("averylongname"); !reflect.DeepEqual(got, []string{"aver-2", "aver-3", "aver-4"}) {
+		t.Errorf("suggestSubdomains(averylongname) = %v, want shortened variants", got)
+	}
+
+	// With every numbered variant taken, random suffixes fill the suggestions up to the limit
+	for i := 2; i < 2+maxSuggestionAttempts/2; i++ {
+		name := fmt.Sprintf("shop-%d", i)
+		s.tunnels[name] = &Tunnel{Subdomain: name}
+	}
+	got := s.suggestSubdomains("shop")
+	if len(got) != maxSubdomainSuggestions {
+		t.Fatalf("suggestSubdomains(shop) = %v, want %d suggestions", got, maxSubdomainSuggestions)
+	}
+	for _, name := range got {
+		if _, taken := s.tunnels[name]; taken || !strings.HasPrefix(name, "shop-") || len(name) != len("shop-")+4 || !s.isValidSubdomain(name) {
+			t.Errorf("suggestion %q, want a free shop- name with a random suffix", name)
+		}
+	}
+}
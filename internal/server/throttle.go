@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// throttleChunkBytes caps how much a throttled read or write passes through at
+// once, so large bodies are paced smoothly instead of in one long wait
+const throttleChunkBytes = 32 * 1024
+
+// bandwidthLimiter is a token bucket shared by all requests through one tunnel,
+// in both directions. The bucket holds at most one second of traffic. A nil
+// *bandwidthLimiter does not throttle.
+type bandwidthLimiter struct {
+	rate int64 // Bytes per second
+
+	mu     sync.Mutex
+	tokens float64 // Available bytes; negative while reservations are waiting
+	last   time.Time
+}
+
+// newBandwidthLimiter returns a limiter for bytesPerSecond, or nil when it is not positive
+func newBandwidthLimiter(bytesPerSecond int64) *bandwidthLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &bandwidthLimiter{
+		rate:   bytesPerSecond,
+		tokens: float64(bytesPerSecond),
+		last:   time.Now(),
+	}
+}
+
+// Rate returns the effective rate in bytes per second (0 = unlimited)
+func (l *bandwidthLimiter) Rate() int64 {
+	if l == nil {
+		return 0
+	}
+	return l.rate
+}
+
+// chunkSize returns the largest piece of data to pass through per wait
+func (l *bandwidthLimiter) chunkSize() int {
+	return int(min(l.rate, throttleChunkBytes))
+}
+
+// reserve takes n bytes from the bucket and returns how long the caller must
+// wait before sending them. The lock is never held while waiting, so concurrent
+// streams queue up behind each other's reservations instead of blocking.
+func (l *bandwidthLimiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*float64(l.rate), float64(l.rate))
+	l.last = now
+
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+}
+
+// refund returns n reserved bytes that were never sent
+func (l *bandwidthLimiter) refund(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = min(l.tokens+float64(n), float64(l.rate))
+}
+
+// wait blocks until n bytes may be sent or ctx is done
+func (l *bandwidthLimiter) wait(ctx context.Context, n int) error {
+	delay := l.reserve(n)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.refund(n)
+		return ctx.Err()
+	}
+}
+
+// reader returns r throttled by the limiter until ctx is done
+func (l *bandwidthLimiter) reader(ctx context.Context, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &throttledReader{r: r, ctx: ctx, limiter: l}
+}
+
+// writer returns w with its body writes throttled by the limiter until ctx is done
+func (l *bandwidthLimiter) writer(ctx context.Context, w http.ResponseWriter) http.ResponseWriter {
+	if l == nil {
+		return w
+	}
+	return &throttledResponseWriter{ResponseWriter: w, ctx: ctx, limiter: l}
+}
+
+// throttledReader paces reads through a bandwidthLimiter
+type throttledReader struct {
+	r       io.Reader
+	ctx     context.Context
+	limiter *bandwidthLimiter
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	if chunk := tr.limiter.chunkSize(); len(p) > chunk {
+		p = p[:chunk]
+	}
+	n, err := tr.r.Read(p)
+	if n > 0 {
+		// Charge what was actually read, so short reads are not over-throttled
+		if werr := tr.limiter.wait(tr.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// throttledResponseWriter paces body writes through a bandwidthLimiter. Each
+// chunk is flushed once written, so the visitor receives data at the limited
+// rate rather than in bursts.
+type throttledResponseWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	limiter *bandwidthLimiter
+}
+
+func (tw *throttledResponseWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), tw.limiter.chunkSize())]
+		if err := tw.limiter.wait(tw.ctx, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := tw.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		tw.Flush()
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// Flush implements http.Flusher when the underlying writer does
+func (tw *throttledResponseWriter) Flush() {
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (tw *throttledResponseWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// tunnelBandwidthLimiter returns the limiter for a new tunnel of the organization,
+// or nil when its plan sets no MaxBytesPerSecond
+func (s *Server) tunnelBandwidthLimiter(orgID string) *bandwidthLimiter {
+	if s.quotaChecker == nil || orgID == "" {
+		return nil
+	}
+	return newBandwidthLimiter(s.quotaChecker.MaxBytesPerSecond(orgID))
+}
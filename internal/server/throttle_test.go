@@ -0,0 +1,60 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestBandwidthThrottling(t *testing.T) {
+	database := newTestDB(t)
+
+	rate := int64(64 * 1024)
+	plan, err := database.CreatePlan(db.CreatePlanInput{Name: "Throttled", MaxBytesPerSecond: &rate})
+	if err != nil {
+		t.Fatalf("CreatePlan() error: %v", err)
+	}
+	if got, err := database.GetPlan(plan.ID); err != nil || got.MaxBytesPerSecond == nil || *got.MaxBytesPerSecond != rate {
+		t.Fatalf("GetPlan() MaxBytesPerSecond = %v, %v, want %d", got.MaxBytesPerSecond, err, rate)
+	}
+
+	var unlimited *bandwidthLimiter
+	if newBandwidthLimiter(0) != nil || unlimited.Rate() != 0 {
+		t.Error("a zero rate should not throttle")
+	}
+	w := httptest.NewRecorder()
+	if unlimited.writer(context.Background(), w) != w {
+		t.Error("an unlimited writer should be passed through")
+	}
+
+	// The first second of traffic is the burst; the half second after it must be paced.
+	// Requests and responses through the tunnel share the bucket.
+	limiter := newBandwidthLimiter(rate)
+	start := time.Now()
+	body, err := io.ReadAll(limiter.reader(context.Background(), bytes.NewReader(make([]byte, rate))))
+	if err != nil || int64(len(body)) != rate {
+		t.Fatalf("throttled read = %d bytes, %v", len(body), err)
+	}
+	tw := limiter.writer(context.Background(), w)
+	writeTunnelResponse(tw, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, nil, make([]byte, rate/2), "")
+	elapsed := time.Since(start)
+	if w.Body.Len() != int(rate/2) {
+		t.Errorf("response body = %d bytes, want %d", w.Body.Len(), rate/2)
+	}
+	if elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("1.5s of traffic took %v, want about 0.5s after the burst", elapsed)
+	}
+
+	// A visitor that goes away stops waiting instead of blocking the stream
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if n, err := newBandwidthLimiter(1).writer(ctx, httptest.NewRecorder()).Write([]byte("ab")); n != 1 || err != context.Canceled {
+		t.Errorf("write after cancel = %d, %v, want the burst then context.Canceled", n, err)
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// defaultTOTPResetGrace is how long an admin whose TOTP was reset can log in
+// with password only to re-enroll
+const defaultTOTPResetGrace = time.Hour
+
+// defaultTOTPSetupTimeout is how long a started TOTP setup can be verified
+// before its unverified secret is cleared
+const defaultTOTPSetupTimeout = 15 * time.Minute
+
+// GetTOTPResetGrace returns the admin TOTP re-enrollment grace period from environment or default.
+// Zero disables the limit, so a reset admin can re-enroll at any time.
+func GetTOTPResetGrace() time.Duration {
+	if grace := os.Getenv("ADMIN_TOTP_RESET_GRACE"); grace != "" {
+		seconds, err := strconv.Atoi(grace)
+		if err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		log.Printf("WARNING: invalid ADMIN_TOTP_RESET_GRACE %q, using default", grace)
+	}
+	return defaultTOTPResetGrace
+}
+
+// GetTOTPSetupTimeout returns how long an unverified TOTP setup is kept from environment or default.
+// Zero keeps unverified secrets until the setup is verified or started again.
+func GetTOTPSetupTimeout() time.Duration {
+	if timeout := os.Getenv("TOTP_SETUP_TIMEOUT"); timeout != "" {
+		seconds, err := strconv.Atoi(timeout)
+		if err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		log.Printf("WARNING: invalid TOTP_SETUP_TIMEOUT %q, using default", timeout)
+	}
+	return defaultTOTPSetupTimeout
+}
+
+// adminTOTPGraceEndsAt returns when the re-enrollment grace period of an admin
+// whose TOTP was reset ends, or nil when the account is not in one. Admins
+// that never had TOTP, like freshly created ones, are not limited.
+func (s *Server) adminTOTPGraceEndsAt(account *db.Account) (*time.Time, error) {
+	if !account.IsAdmin || account.TOTPEnabled || s.totpResetGrace <= 0 {
+		return nil, nil
+	}
+	resetAt, err := s.db.GetAccountTOTPResetAt(account.ID)
+	if err != nil || resetAt == nil {
+		return nil, err
+	}
+	endsAt := resetAt.Add(s.totpResetGrace)
+	return &endsAt, nil
+}
+
+// totpSetupExpired reports whether the account's unverified TOTP secret belongs
+// to a setup started longer than the setup timeout ago, clearing it if so
+func (s *Server) totpSetupExpired(account *db.Account) (bool, error) {
+	if account.TOTPEnabled || account.TOTPSecret == "" || s.totpSetupTimeout <= 0 {
+		return false, nil
+	}
+	setupAt, err := s.db.GetAccountTOTPSetupAt(account.ID)
+	if err != nil {
+		return false, err
+	}
+	if setupAt != nil && time.Since(*setupAt) < s.totpSetupTimeout {
+		return false, nil
+	}
+	if err := s.db.UpdateAccountTOTP(account.ID, "", false); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// clearStaleTOTPSetups clears the unverified secrets of abandoned TOTP setups
+func (s *Server) clearStaleTOTPSetups() {
+	if s.db == nil || s.totpSetupTimeout <= 0 {
+		return
+	}
+	cleared, err := s.db.ClearStaleTOTPSetups(time.Now().Add(-s.totpSetupTimeout))
+	if err != nil {
+		log.Printf("Failed to clear stale TOTP setups: %v", err)
+	} else if cleared > 0 {
+		log.Printf("Cleared %d abandoned TOTP setups", cleared)
+	}
+}
+
+// totpSetupCleanupRoutine periodically clears abandoned TOTP setups
+func (s *Server) totpSetupCleanupRoutine() {
+	if s.db == nil || s.totpSetupTimeout <= 0 {
+		return
+	}
+	ticker := time.NewTicker(max(s.totpSetupTimeout, time.Minute))
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.clearStaleTOTPSetups()
+	}
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+	"github.com/pquerna/otp/totp"
+)
+
+func TestAdminTOTPResetGrace(t *testing.T) {
+	t.Setenv("BCRYPT_COST", "10")
+	database := newTestDB(t)
+
+	hash, err := auth.HashPassword("correct-horse")
+	if err != nil {
+		t.Fatalf("HashPassword() error: %v", err)
+	}
+	admin, err := database.CreateAccountWithPassword("root", auth.HashToken("token"), hash, true)
+	if err != nil {
+		t.Fatalf("CreateAccountWithPassword() error: %v", err)
+	}
+
+	s := newTestServer(database)
+	s.totpResetGrace = time.Hour
+	login := func() (int, LoginResponse) {
+		r := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(`{"username":"root","password":"correct-horse"}`))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.handleLogin(w, r)
+		var resp LoginResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+
+	// A freshly created admin can enroll without a deadline
+	if status, resp := login(); status != http.StatusOK || !resp.NeedsSetup || resp.TOTPGrace {
+		t.Errorf("new admin login = %d %+v, want setup without grace", status, resp)
+	}
+
+	database.UpdateAccountTOTP(admin.ID, "secret", true)
+	w := httptest.NewRecorder()
+	s.handleResetAccountTOTP(w, httptest.NewRequest(http.MethodDelete, "/admin/accounts/"+admin.ID+"/totp", nil), admin.ID, "other")
+	var reset struct {
+		TOTPGraceEndsAt *time.Time `json:"totpGraceEndsAt"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&reset); err != nil || reset.TOTPGraceEndsAt == nil {
+		t.Fatalf("reset = %d (%v), want totpGraceEndsAt", w.Code, err)
+	}
+
+	status, resp := login()
+	if status != http.StatusOK || !resp.NeedsSetup || !resp.TOTPGrace || resp.TOTPGraceEndsAt == nil || !resp.TOTPGraceEndsAt.Equal(*reset.TOTPGraceEndsAt) {
+		t.Errorf("login in grace period = %d %+v, want flagged setup", status, resp)
+	}
+
+	s.totpResetGrace = time.Nanosecond
+	if status, _ := login(); status != http.StatusForbidden {
+		t.Errorf("login after grace period: status %d, want 403", status)
+	}
+
+	audit, _ := database.GetAuditEvents(nil, nil, 10, 0)
+	var graceLogins, blocked int
+	for _, event := range audit {
+		if event.AuthType == db.AuditTypeTOTPGraceLogin && event.UserIdentity == "root" {
+			graceLogins++
+			if !event.Success {
+				blocked++
+			}
+		}
+	}
+	if graceLogins != 2 || blocked != 1 {
+		t.Errorf("audited %d grace logins (%d blocked), want 2 (1 blocked)", graceLogins, blocked)
+	}
+
+	// Enrolling ends the grace period
+	database.UpdateAccountTOTP(admin.ID, "secret", true)
+	if resetAt, _ := database.GetAccountTOTPResetAt(admin.ID); resetAt != nil {
+		t.Errorf("TOTP reset at = %v after enrolling, want nil", resetAt)
+	}
+
+	// Disabling TOTP yourself starts the same grace period as a reset
+	key, err := auth.GenerateTOTPSecret("digit-link", "root")
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret() error: %v", err)
+	}
+	encrypted, _ := auth.EncryptTOTPSecret(key.Secret)
+	database.UpdateAccountTOTP(admin.ID, encrypted, true)
+	code, _ := totp.GenerateCode(key.Secret, time.Now())
+	r := httptest.NewRequest(http.MethodDelete, "/admin/me/totp", strings.NewReader(`{"code":"`+code+`"}`))
+	r.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	s.handleAdminDisableMyTOTP(w, r, &struct {
+		ID       string
+		Username string
+		IsAdmin  bool
+	}{ID: admin.ID, Username: "root", IsAdmin: true})
+	if w.Code != http.StatusOK {
+		t.Fatalf("disable TOTP = %d (%s), want 200", w.Code, w.Body.String())
+	}
+	if resetAt, _ := database.GetAccountTOTPResetAt(admin.ID); resetAt == nil {
+		t.Error("TOTP reset at not recorded when the admin disabled TOTP")
+	}
+}
+
+func TestTOTPSetupTimeout(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	database := newTestDB(t)
+
+	account, err := database.CreateAccount("root", auth.HashToken("token"), true)
+	if err != nil {
+		t.Fatalf("CreateAccount() error: %v", err)
+	}
+	admin := &struct {
+		ID       string
+		Username string
+		IsAdmin  bool
+	}{ID: account.ID, Username: "root", IsAdmin: true}
+	s := newTestServer(database)
+	s.totpSetupTimeout = time.Hour
+
+	startSetup := func() string {
+		w := httptest.NewRecorder()
+		s.handleAdminGetMyTOTPSetup(w, httptest.NewRequest(http.MethodGet, "/admin/me/totp/setup", nil), admin)
+		var resp struct {
+			Secret string `json:"secret"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Secret == "" {
+			t.Fatalf("setup = %d (%v), want a secret", w.Code, err)
+		}
+		return resp.Secret
+	}
+	verify := func(secret string) int {
+		code, err := totp.GenerateCode(secret, time.Now())
+		if err != nil {
+			t.Fatalf("GenerateCode() error: %v", err)
+		}
+		r := httptest.NewRequest(http.MethodPost, "/admin/me/totp/setup", strings.NewReader(`{"code":"`+code+`"}`))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.handleAdminEnableMyTOTP(w, r, admin)
+		return w.Code
+	}
+
+	// A setup abandoned for longer than the timeout is cleared by the cleanup
+	abandoned := startSetup()
+	if setupAt, _ := database.GetAccountTOTPSetupAt(account.ID); setupAt == nil {
+		t.Fatal("TOTP setup at = nil after starting a setup")
+	}
+	if n, _ := database.ClearStaleTOTPSetups(time.Now().Add(-time.Minute)); n != 0 {
+		t.Errorf("ClearStaleTOTPSetups() cleared %d setups within the timeout, want 0", n)
+	}
+	if n, _ := database.ClearStaleTOTPSetups(time.Now().Add(time.Minute)); n != 1 {
+		t.Errorf("ClearStaleTOTPSetups() cleared %d setups, want 1", n)
+	}
+	if got, _ := database.GetAccountByID(account.ID); got.TOTPSecret != "" || got.TOTPEnabled {
+		t.Errorf("account after cleanup: secret %q, enabled %v, want cleared", got.TOTPSecret, got.TOTPEnabled)
+	}
+	if status := verify(abandoned); status != http.StatusBadRequest {
+		t.Errorf("verify cleared setup: status %d, want 400", status)
+	}
+
+	// A setup that outlived the timeout is rejected and cleared on verification
+	expired := startSetup()
+	s.totpSetupTimeout = time.Nanosecond
+	if status := verify(expired); status != http.StatusBadRequest {
+		t.Errorf("verify expired setup: status %d, want 400", status)
+	}
+	if got, _ := database.GetAccountByID(account.ID); got.TOTPSecret != "" {
+		t.Error("expired setup's secret was not cleared")
+	}
+
+	// A setup within the timeout still verifies
+	s.totpSetupTimeout = time.Hour
+	if status := verify(startSetup()); status != http.StatusOK {
+		t.Errorf("verify setup within timeout: status %d, want 200", status)
+	}
+	if got, _ := database.GetAccountByID(account.ID); !got.TOTPEnabled {
+		t.Error("TOTP not enabled after verifying")
+	}
+	if setupAt, _ := database.GetAccountTOTPSetupAt(account.ID); setupAt != nil {
+		t.Errorf("TOTP setup at = %v after enabling, want nil", setupAt)
+	}
+	if n, _ := database.ClearStaleTOTPSetups(time.Now().Add(time.Minute)); n != 0 {
+		t.Errorf("ClearStaleTOTPSetups() cleared %d enabled secrets, want 0", n)
+	}
+}
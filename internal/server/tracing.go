@@ -0,0 +1,381 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultTraceServiceName is the service.name of exported spans unless OTEL_SERVICE_NAME is set
+	defaultTraceServiceName = "digit-link"
+	// traceScopeName identifies digit-link as the instrumentation scope of its spans
+	traceScopeName = "github.com/niekvdm/digit-link"
+	// traceExportInterval is how often finished spans are sent to the collector
+	traceExportInterval = 5 * time.Second
+	// traceBatchSize triggers an early export once this many spans are pending
+	traceBatchSize = 512
+	// traceMaxPending caps buffered spans; further spans are dropped while the collector is unreachable
+	traceMaxPending = 4096
+	// traceExportTimeout bounds a single export request
+	traceExportTimeout = 10 * time.Second
+)
+
+// OTLP span kind and status codes
+const (
+	spanKindServer  = 2
+	spanStatusError = 2
+)
+
+// Tracer records a span per forwarded request and exports the spans to an
+// OpenTelemetry collector with OTLP/HTTP (JSON encoding). A nil *Tracer records nothing.
+type Tracer struct {
+	endpoint    string
+	serviceName string
+	client      *http.Client
+
+	mu      sync.Mutex
+	pending []*Span
+
+	flushCh chan struct{}
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+}
+
+// GetTracer returns a tracer exporting to OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, or to
+// OTEL_EXPORTER_OTLP_ENDPOINT with /v1/traces appended. It returns nil (tracing off)
+// when neither is set.
+func GetTracer() *Tracer {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	if endpoint == "" {
+		return nil
+	}
+
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = defaultTraceServiceName
+	}
+	log.Printf("Tracing enabled: exporting spans to %s", endpoint)
+	return NewTracer(endpoint, serviceName)
+}
+
+// NewTracer creates a tracer exporting to the OTLP/HTTP traces endpoint
+func NewTracer(endpoint, serviceName string) *Tracer {
+	return &Tracer{
+		endpoint:    endpoint,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: traceExportTimeout},
+		flushCh:     make(chan struct{}, 1),
+		stopCh:      make(chan struct{}),
+	}
+}
+
+// Start begins the background export goroutine
+func (t *Tracer) Start() {
+	if t == nil {
+		return
+	}
+	t.wg.Add(1)
+	go t.exportLoop()
+}
+
+// Stop stops the export goroutine and exports the remaining spans
+func (t *Tracer) Stop() {
+	if t == nil {
+		return
+	}
+	close(t.stopCh)
+	t.wg.Wait()
+	t.flush()
+}
+
+// exportLoop exports pending spans periodically or when a batch is full
+func (t *Tracer) exportLoop() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(traceExportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.stopCh:
+			return
+		case <-ticker.C:
+			t.flush()
+		case <-t.flushCh:
+			t.flush()
+		}
+	}
+}
+
+// Span is one traced request. A nil *Span ignores all calls.
+type Span struct {
+	tracer       *Tracer
+	name         string
+	traceID      [16]byte
+	spanID       [8]byte
+	parentSpanID [8]byte // Zero for a root span
+	sampled      bool
+	start        time.Time
+	end          time.Time
+	attributes   []otlpAttribute
+	statusCode   int
+}
+
+// StartSpan starts a server span for r. A valid incoming traceparent header makes
+// the span a child of the caller's span; otherwise a new trace is started.
+func (t *Tracer) StartSpan(r *http.Request, name string) *Span {
+	if t == nil {
+		return nil
+	}
+
+	span := &Span{tracer: t, name: name, sampled: true, start: time.Now()}
+	if traceID, parentID, flags, ok := parseTraceparent(r.Header.Get("Traceparent")); ok {
+		span.traceID, span.parentSpanID = traceID, parentID
+		span.sampled = flags&0x01 == 1
+	} else {
+		rand.Read(span.traceID[:])
+	}
+	rand.Read(span.spanID[:])
+	return span
+}
+
+// Traceparent returns the W3C traceparent header identifying this span, for
+// propagation to the backend
+func (sp *Span) Traceparent() string {
+	if sp == nil {
+		return ""
+	}
+	flags := "00"
+	if sp.sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sp.traceID[:]) + "-" + hex.EncodeToString(sp.spanID[:]) + "-" + flags
+}
+
+// SetAttribute adds a string attribute; empty values are skipped
+func (sp *Span) SetAttribute(key, value string) {
+	if sp == nil || value == "" {
+		return
+	}
+	sp.attributes = append(sp.attributes, otlpAttribute{Key: key, Value: otlpValue{StringValue: &value}})
+}
+
+// End finishes the span with the response status (0 when no response was
+// written) and queues it for export unless the caller's trace is not sampled
+func (sp *Span) End(status int) {
+	if sp == nil {
+		return
+	}
+	sp.end = time.Now()
+	if status != 0 {
+		code := strconv.Itoa(status)
+		sp.attributes = append(sp.attributes, otlpAttribute{Key: "http.response.status_code", Value: otlpValue{IntValue: &code}})
+	}
+	if status == 0 || status >= 500 {
+		sp.statusCode = spanStatusError
+	}
+	if !sp.sampled {
+		return
+	}
+
+	t := sp.tracer
+	t.mu.Lock()
+	if len(t.pending) < traceMaxPending {
+		t.pending = append(t.pending, sp)
+	}
+	full := len(t.pending) >= traceBatchSize
+	t.mu.Unlock()
+
+	if full {
+		select {
+		case t.flushCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// parseTraceparent parses a W3C traceparent header. Headers of later versions
+// are read like version 00, ignoring any extra fields.
+func parseTraceparent(header string) (traceID [16]byte, spanID [8]byte, flags byte, ok bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return traceID, spanID, 0, false
+	}
+	if len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return traceID, spanID, 0, false
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil || traceID == [16]byte{} {
+		return traceID, spanID, 0, false
+	}
+	if _, err := hex.Decode(spanID[:], []byte(parts[2])); err != nil || spanID == [8]byte{} {
+		return traceID, spanID, 0, false
+	}
+	var f [1]byte
+	if _, err := hex.Decode(f[:], []byte(parts[3])); err != nil {
+		return traceID, spanID, 0, false
+	}
+	return traceID, spanID, f[0], true
+}
+
+// OTLP/HTTP JSON payload (opentelemetry-proto ExportTraceServiceRequest)
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"` // int64 is encoded as a string
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code int `json:"code,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpExportRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+// exportRequest builds the OTLP payload for spans
+func (t *Tracer) exportRequest(spans []*Span) otlpExportRequest {
+	scope := otlpScopeSpans{Spans: make([]otlpSpan, 0, len(spans))}
+	scope.Scope.Name = traceScopeName
+	for _, sp := range spans {
+		s := otlpSpan{
+			TraceID:           hex.EncodeToString(sp.traceID[:]),
+			SpanID:            hex.EncodeToString(sp.spanID[:]),
+			Name:              sp.name,
+			Kind:              spanKindServer,
+			StartTimeUnixNano: strconv.FormatInt(sp.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(sp.end.UnixNano(), 10),
+			Attributes:        sp.attributes,
+			Status:            otlpStatus{Code: sp.statusCode},
+		}
+		if sp.parentSpanID != [8]byte{} {
+			s.ParentSpanID = hex.EncodeToString(sp.parentSpanID[:])
+		}
+		scope.Spans = append(scope.Spans, s)
+	}
+
+	serviceName := t.serviceName
+	resource := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	resource.Resource.Attributes = []otlpAttribute{{Key: "service.name", Value: otlpValue{StringValue: &serviceName}}}
+	return otlpExportRequest{ResourceSpans: []otlpResourceSpans{resource}}
+}
+
+// flush exports all pending spans. Spans are dropped when the export fails, so
+// an unreachable collector never holds up request handling or memory.
+func (t *Tracer) flush() {
+	t.mu.Lock()
+	spans := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+
+	if len(spans) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(t.exportRequest(spans))
+	if err != nil {
+		log.Printf("Failed to encode spans: %v", err)
+		return
+	}
+	resp, err := t.client.Post(t.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Failed to export %d spans: %v", len(spans), err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Failed to export %d spans: collector returned %s", len(spans), resp.Status)
+	}
+}
+
+// statusRecorder remembers the status code written to a ResponseWriter. A
+// hijacked connection (WebSocket upgrade) is recorded as 101.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(p []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher when the underlying writer does
+func (sr *statusRecorder) Flush() {
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker when the underlying writer does
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := sr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil && sr.status == 0 {
+		sr.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
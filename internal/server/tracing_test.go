@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/niekvdm/digit-link/internal/protocol"
+)
+
+func TestRequestTracing(t *testing.T) {
+	exported := make(chan otlpExportRequest, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req otlpExportRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		exported <- req
+	}))
+	defer collector.Close()
+
+	s := newTestServer(nil)
+	s.tracer = NewTracer(collector.URL, "edge")
+	s.redaction = NewRedactionRules(nil, nil, nil)
+	ts := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer ts.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/_tunnel", nil)
+	if err != nil {
+		t.Fatalf("Dial() error: %v", err)
+	}
+	defer conn.Close()
+	reg, _ := json.Marshal(protocol.Message{Type: protocol.TypeRegisterRequest, Payload: protocol.RegisterRequest{Subdomain: "traced"}})
+	conn.WriteMessage(websocket.TextMessage, reg)
+	var regResp struct {
+		Payload protocol.RegisterResponse `json:"payload"`
+	}
+	if err := conn.ReadJSON(&regResp); err != nil || !regResp.Payload.Success {
+		t.Fatalf("registration failed: %v %+v", err, regResp.Payload)
+	}
+
+	const traceID, callerSpanID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "http://traced.link.test/orders", nil)
+	r.Header.Set("traceparent", "00-"+traceID+"-"+callerSpanID+"-01")
+	r.Header.Set("Authorization", "Bearer secret")
+	done := make(chan struct{})
+	go func() {
+		s.ServeHTTP(rec, r)
+		close(done)
+	}()
+
+	var req struct {
+		Payload protocol.HTTPRequest `json:"payload"`
+	}
+	if err := conn.ReadJSON(&req); err != nil {
+		t.Fatalf("reading request: %v", err)
+	}
+	parts := strings.Split(req.Payload.Headers["Traceparent"], "-")
+	if len(parts) != 4 || parts[1] != traceID || parts[2] == callerSpanID {
+		t.Errorf("backend traceparent = %q, want trace %s with the edge span as parent", req.Payload.Headers["Traceparent"], traceID)
+	}
+	resp, _ := json.Marshal(protocol.Message{
+		Type:    protocol.TypeHTTPResponse,
+		Payload: protocol.HTTPResponse{ID: req.Payload.ID, StatusCode: http.StatusCreated},
+	})
+	conn.WriteMessage(websocket.TextMessage, resp)
+	<-done
+
+	s.tracer.flush()
+	var export otlpExportRequest
+	select {
+	case export = <-exported:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no spans exported")
+	}
+	spans := export.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 1 {
+		t.Fatalf("exported %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.TraceID != traceID || span.ParentSpanID != callerSpanID || span.SpanID != parts[2] {
+		t.Errorf("span ids = %s/%s/%s, want trace %s, parent %s, span %s", span.TraceID, span.ParentSpanID, span.SpanID, traceID, callerSpanID, parts[2])
+	}
+	attrs := map[string]string{}
+	for _, a := range span.Attributes {
+		switch {
+		case a.Value.StringValue != nil:
+			attrs[a.Key] = *a.Value.StringValue
+		case a.Value.IntValue != nil:
+			attrs[a.Key] = *a.Value.IntValue
+		}
+	}
+	want := map[string]string{
+		"http.request.method":               "GET",
+		"digitlink.subdomain":               "traced",
+		"http.response.status_code":         "201",
+		"http.request.header.traceparent":   "00-" + traceID + "-" + callerSpanID + "-01",
+		"http.request.header.authorization": redactedValue,
+	}
+	if !reflect.DeepEqual(attrs, want) {
+		t.Errorf("span attributes = %v, want %v", attrs, want)
+	}
+
+	// Unconfigured tracing is a no-op
+	var off *Tracer
+	if span := off.StartSpan(r, "GET"); span != nil || span.Traceparent() != "" {
+		t.Error("a nil tracer should not start spans")
+	}
+}
@@ -1,11 +1,14 @@
 package server
 
 import (
+	"encoding/json"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/niekvdm/digit-link/internal/db"
+	"github.com/niekvdm/digit-link/internal/protocol"
 )
 
 // Tunnel represents a connected client tunnel
@@ -14,9 +17,13 @@ type Tunnel struct {
 	Conn       *websocket.Conn
 	CreatedAt  time.Time
 	ResponseCh map[string]chan []byte // Request ID -> response channel
-	mu         sync.RWMutex           // Protects ResponseCh map
+	mu         sync.RWMutex           // Protects ResponseCh and acked maps
 	writeMu    sync.Mutex             // Protects websocket writes
 
+	acked  map[string]bool // Request IDs the client acknowledged receiving
+	acks   atomic.Bool     // Set once the client has acknowledged a request
+	closed atomic.Bool
+
 	// Auth context for this tunnel
 	AccountID string          // The account that owns this tunnel
 	OrgID     string          // The organization this tunnel belongs to
@@ -25,30 +32,101 @@ type Tunnel struct {
 
 	// Database record tracking
 	RecordID string // The tunnel record ID in the database for stats tracking
+
+	// LocalTarget is the local service the client reported, e.g. http://localhost:3000
+	LocalTarget string
+
+	// ConnectionID identifies this connection; it changes when a client resumes the subdomain
+	ConnectionID string
+
+	// Throughput cap from the organization's plan (nil = unlimited)
+	limiter *bandwidthLimiter
+
+	// Credential the tunnel registered with (see tunnelOwner)
+	owner string
+
+	// Reconnect token that lets the same credential replace this connection
+	reconnect reconnectGrant
+
+	lastSeen        atomic.Int64  // Unix nanoseconds of the last message or pong from the client
+	slotTransferred atomic.Bool   // Concurrent tunnel slot handed to the connection that resumed this one
+	degraded        atomic.Bool   // Set while the client reports its local service is down
+	done            chan struct{} // Closed once the tunnel's disconnect cleanup has finished
+
+	// Liveness probes wait on seenCh; markSeen closes it when seenWaiting is set
+	seenMu      sync.Mutex
+	seenCh      chan struct{}
+	seenWaiting atomic.Bool
 }
 
 // NewTunnel creates a new tunnel instance
 func NewTunnel(subdomain string, conn *websocket.Conn) *Tunnel {
-	return &Tunnel{
+	t := &Tunnel{
 		Subdomain:  subdomain,
 		Conn:       conn,
 		CreatedAt:  time.Now(),
 		ResponseCh: make(map[string]chan []byte),
+		acked:      make(map[string]bool),
+		done:       make(chan struct{}),
 	}
+	t.markSeen()
+	return t
 }
 
 // NewTunnelWithContext creates a new tunnel with auth context
 func NewTunnelWithContext(subdomain string, conn *websocket.Conn, accountID, orgID, appID string, app *db.Application) *Tunnel {
-	return &Tunnel{
+	t := &Tunnel{
 		Subdomain:  subdomain,
 		Conn:       conn,
 		CreatedAt:  time.Now(),
 		ResponseCh: make(map[string]chan []byte),
+		acked:      make(map[string]bool),
 		AccountID:  accountID,
 		OrgID:      orgID,
 		AppID:      appID,
 		App:        app,
+		done:       make(chan struct{}),
+	}
+	t.markSeen()
+	return t
+}
+
+// markSeen records that the client was just heard from
+func (t *Tunnel) markSeen() {
+	t.lastSeen.Store(time.Now().UnixNano())
+	if !t.seenWaiting.Load() {
+		return
+	}
+	t.seenMu.Lock()
+	if t.seenCh != nil {
+		close(t.seenCh)
+		t.seenCh = nil
+		t.seenWaiting.Store(false)
+	}
+	t.seenMu.Unlock()
+}
+
+// seenAfter returns a channel that is closed once the client is heard from after since
+func (t *Tunnel) seenAfter(since time.Time) <-chan struct{} {
+	t.seenMu.Lock()
+	defer t.seenMu.Unlock()
+	if t.seenCh == nil {
+		t.seenCh = make(chan struct{})
+		t.seenWaiting.Store(true)
+	}
+	// markSeen stores lastSeen before checking seenWaiting, so an answer that
+	// raced with registering the waiter shows up here
+	if t.seenSince(since) {
+		ch := make(chan struct{})
+		close(ch)
+		return ch
 	}
+	return t.seenCh
+}
+
+// seenSince reports whether the client was heard from after since
+func (t *Tunnel) seenSince(since time.Time) bool {
+	return t.lastSeen.Load() > since.UnixNano()
 }
 
 // AddResponseChannel creates a channel for a request ID
@@ -67,6 +145,7 @@ func (t *Tunnel) GetResponseChannel(requestID string) (chan []byte, bool) {
 	ch, ok := t.ResponseCh[requestID]
 	if ok {
 		delete(t.ResponseCh, requestID)
+		delete(t.acked, requestID)
 	}
 	return ch, ok
 }
@@ -79,19 +158,62 @@ func (t *Tunnel) RemoveResponseChannel(requestID string) {
 		close(ch)
 		delete(t.ResponseCh, requestID)
 	}
+	delete(t.acked, requestID)
+}
+
+// AcknowledgeRequest records that the client received a pending request
+func (t *Tunnel) AcknowledgeRequest(requestID string) {
+	t.acks.Store(true)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.ResponseCh[requestID]; ok {
+		t.acked[requestID] = true
+	}
+}
+
+// requestAckState reports whether the client acknowledged a pending request
+func (t *Tunnel) requestAckState(requestID string) requestAckState {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	switch {
+	case t.acked[requestID]:
+		return ackReceived
+	case t.acks.Load():
+		return ackPending
+	}
+	return ackUnsupported
+}
+
+// IsClosed reports whether the tunnel connection has been closed
+func (t *Tunnel) IsClosed() bool {
+	return t.closed.Load()
 }
 
 // Close closes the tunnel and all pending response channels
 func (t *Tunnel) Close() {
 	t.mu.Lock()
 	defer t.mu.Unlock()
+	t.closed.Store(true)
 	for id, ch := range t.ResponseCh {
 		close(ch)
 		delete(t.ResponseCh, id)
 	}
+	clear(t.acked)
 	t.Conn.Close()
 }
 
+// SendCancel tells the tunnel client to abort a request whose visitor has gone away
+func (t *Tunnel) SendCancel(requestID string) error {
+	data, err := json.Marshal(protocol.Message{
+		Type:    protocol.TypeCancel,
+		Payload: protocol.CancelRequest{ID: requestID},
+	})
+	if err != nil {
+		return err
+	}
+	return t.WriteMessage(websocket.TextMessage, data)
+}
+
 // WriteMessage sends a message to the tunnel client in a thread-safe manner.
 // This method must be used for all writes to the websocket connection to prevent
 // concurrent write panics.
@@ -6,33 +6,40 @@ import (
 	"log"
 	"net"
 	"os"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/niekvdm/digit-link/internal/auth"
 	"github.com/niekvdm/digit-link/internal/db"
+	"github.com/niekvdm/digit-link/internal/protocol"
 	"github.com/niekvdm/digit-link/internal/tunnel"
 	proxyproto "github.com/pires/go-proxyproto"
 )
 
 // TunnelListener handles TCP+TLS tunnel connections using yamux
 type TunnelListener struct {
-	server    *Server
-	listener  net.Listener
-	tlsConfig *tls.Config
-	sessions  map[string]*tunnel.Session // subdomain -> session
-	mu        sync.RWMutex
-	done      chan struct{}
+	server     *Server
+	listener   net.Listener
+	tlsConfig  *tls.Config
+	sessions   map[string]*tunnel.Session // subdomain -> session
+	limiters   map[*tunnel.Session]*bandwidthLimiter
+	reconnects map[*tunnel.Session]*reconnectGrant
+	mu         sync.RWMutex
+	done       chan struct{}
 }
 
 // NewTunnelListener creates a new TCP tunnel listener
 func NewTunnelListener(server *Server, tlsConfig *tls.Config) *TunnelListener {
 	return &TunnelListener{
-		server:    server,
-		tlsConfig: tlsConfig,
-		sessions:  make(map[string]*tunnel.Session),
-		done:      make(chan struct{}),
+		server:     server,
+		tlsConfig:  tlsConfig,
+		sessions:   make(map[string]*tunnel.Session),
+		limiters:   make(map[*tunnel.Session]*bandwidthLimiter),
+		reconnects: make(map[*tunnel.Session]*reconnectGrant),
+		done:       make(chan struct{}),
 	}
 }
 
@@ -163,8 +170,13 @@ func (tl *TunnelListener) handleSession(session *tunnel.Session) {
 	// Validate auth request structure
 	if err := authReq.Validate(); err != nil {
 		log.Printf("Invalid auth request from %s: %v", remoteAddr, err)
+		code := protocol.RegisterCodeInvalidRequest
+		if authReq.Token == "" {
+			code = protocol.RegisterCodeAuthRequired
+		}
 		tunnel.WriteFrame(stream, &tunnel.AuthResponse{
 			Success: false,
+			Code:    code,
 			Error:   err.Error(),
 		})
 		stream.Close()
@@ -187,22 +199,35 @@ func (tl *TunnelListener) handleSession(session *tunnel.Session) {
 	if !authResult.response.Success {
 		log.Printf("Authentication failed for %s: %s", remoteAddr, authResult.response.Error)
 		session.Close()
+		tl.server.publishEvent(Event{Type: EventTunnelRejected, OrgID: authResult.orgID, AccountID: authResult.accountID, ClientIP: clientIP, Reason: authResult.response.Error})
 		return
 	}
 
 	// Register session with all subdomains
 	session.SetForwards(authReq.Forwards)
+	session.SetDegraded(authReq.Degraded)
 	session.SetAccountInfo(authResult.accountID, authResult.orgID, authResult.appID)
 
-	if err := tl.RegisterSession(session); err != nil {
+	if err := tl.RegisterSession(session, authResult.replaced...); err != nil {
 		log.Printf("Failed to register session from %s: %v", remoteAddr, err)
 		session.Close()
 		return
 	}
+	tl.setLimiter(session, tl.server.tunnelBandwidthLimiter(authResult.orgID))
+	tl.setReconnect(session, &authResult.reconnect)
+
+	// Closing the replaced sessions ends their handlers, whose cleanup leaves
+	// this session's registration in place
+	for _, replaced := range authResult.replaced {
+		log.Printf("TCP session from %s resumed by connection %s", replaced.RemoteAddr(), authResult.response.ConnectionID)
+		replaced.Close()
+	}
 
 	// Log successful registration
-	for _, t := range authResult.response.Tunnels {
-		log.Printf("TCP tunnel registered: %s -> %s (ip: %s)", t.Subdomain, t.URL, clientIP)
+	// Tunnels are in the order of the forwards they were registered for
+	for i, t := range authResult.response.Tunnels {
+		log.Printf("TCP tunnel registered: %s -> %s (ip: %s, local: %s)", t.Subdomain, t.URL, clientIP, forwardLocalTargets(authReq.Forwards[i])[0])
+		tl.server.publishEvent(Event{Type: EventTunnelConnected, Subdomain: t.Subdomain, OrgID: authResult.orgID, AppID: authResult.appID, AccountID: authResult.accountID, ClientIP: clientIP})
 	}
 
 	// Track session start time for usage
@@ -227,6 +252,10 @@ func (tl *TunnelListener) handleSession(session *tunnel.Session) {
 		tl.server.usageCache.RecordTunnelTime(authResult.orgID, int64(sessionDuration.Seconds()))
 	}
 
+	for _, t := range authResult.response.Tunnels {
+		tl.server.publishEvent(Event{Type: EventTunnelDisconnected, Subdomain: t.Subdomain, OrgID: authResult.orgID, AppID: authResult.appID, AccountID: authResult.accountID, ClientIP: clientIP})
+	}
+
 	log.Printf("TCP tunnel session disconnected: %s", remoteAddr)
 }
 
@@ -236,6 +265,18 @@ type authResult struct {
 	accountID string
 	orgID     string
 	appID     string
+
+	// Sessions the client resumes with its reconnect token, and the new token's grant
+	replaced  []*tunnel.Session
+	reconnect reconnectGrant
+}
+
+// reject fails the authentication with a reason code and message
+func (r *authResult) reject(code protocol.RegisterCode, msg string) *authResult {
+	r.response.Success = false
+	r.response.Code = code
+	r.response.Error = msg
+	return r
 }
 
 // authenticateSession validates the auth request and returns the result
@@ -245,8 +286,7 @@ func (tl *TunnelListener) authenticateSession(session *tunnel.Session, authReq *
 	}
 
 	if tl.server.db == nil {
-		result.response.Error = "Database not configured"
-		return result
+		return result.reject(protocol.RegisterCodeInternal, "Database not configured")
 	}
 
 	// Try API key authentication first
@@ -254,8 +294,7 @@ func (tl *TunnelListener) authenticateSession(session *tunnel.Session, authReq *
 	apiKey, err := tl.server.db.GetAPIKeyByHash(apiKeyHash)
 	if err != nil {
 		log.Printf("Database error during API key lookup: %v", err)
-		result.response.Error = "Internal server error"
-		return result
+		return result.reject(protocol.RegisterCodeInternal, "Internal server error")
 	}
 
 	var account *db.Account
@@ -263,16 +302,17 @@ func (tl *TunnelListener) authenticateSession(session *tunnel.Session, authReq *
 	if apiKey != nil {
 		// API key authentication
 		if apiKey.ExpiresAt != nil && apiKey.ExpiresAt.Before(time.Now()) {
-			result.response.Error = "API key has expired"
-			return result
+			return result.reject(protocol.RegisterCodeTokenExpired, "API key has expired")
 		}
 
 		if apiKey.KeyType == db.KeyTypeApp && apiKey.AppID != nil {
 			// App-specific API key
 			app, err := tl.server.db.GetApplicationByID(*apiKey.AppID)
 			if err != nil || app == nil {
-				result.response.Error = "Application not found for API key"
-				return result
+				return result.reject(protocol.RegisterCodeAppNotFound, "Application not found for API key")
+			}
+			if app.ReleasedAt != nil {
+				return result.reject(protocol.RegisterCodeAppReleased, "Application was released after being offline; restore it to connect")
 			}
 			result.orgID = app.OrgID
 			result.appID = app.ID
@@ -280,12 +320,10 @@ func (tl *TunnelListener) authenticateSession(session *tunnel.Session, authReq *
 			// Check app-level IP whitelist
 			whitelisted, err := tl.server.db.IsIPWhitelistedForApp(clientIP, app.ID)
 			if err != nil {
-				result.response.Error = "Internal server error"
-				return result
+				return result.reject(protocol.RegisterCodeInternal, "Internal server error")
 			}
 			if !whitelisted {
-				result.response.Error = "IP address not whitelisted"
-				return result
+				return result.reject(protocol.RegisterCodeIPNotWhitelisted, "IP address not whitelisted")
 			}
 		} else if apiKey.OrgID != nil {
 			// Org-level API key
@@ -294,12 +332,10 @@ func (tl *TunnelListener) authenticateSession(session *tunnel.Session, authReq *
 			// Check org-level IP whitelist
 			whitelisted, err := tl.server.db.IsIPWhitelistedForOrg(clientIP, result.orgID)
 			if err != nil {
-				result.response.Error = "Internal server error"
-				return result
+				return result.reject(protocol.RegisterCodeInternal, "Internal server error")
 			}
 			if !whitelisted {
-				result.response.Error = "IP address not whitelisted"
-				return result
+				return result.reject(protocol.RegisterCodeIPNotWhitelisted, "IP address not whitelisted")
 			}
 		}
 
@@ -309,12 +345,13 @@ func (tl *TunnelListener) authenticateSession(session *tunnel.Session, authReq *
 		tokenHash := auth.HashToken(authReq.Token)
 		account, err = tl.server.db.GetAccountByTokenHash(tokenHash)
 		if err != nil {
-			result.response.Error = "Internal server error"
-			return result
+			return result.reject(protocol.RegisterCodeInternal, "Internal server error")
 		}
 		if account == nil {
-			result.response.Error = "Invalid token"
-			return result
+			return result.reject(protocol.RegisterCodeInvalidToken, "Invalid token")
+		}
+		if account.IsTokenExpired() {
+			return result.reject(protocol.RegisterCodeTokenExpired, tokenExpiredMessage(*account.TokenExpiresAt))
 		}
 
 		result.accountID = account.ID
@@ -323,26 +360,76 @@ func (tl *TunnelListener) authenticateSession(session *tunnel.Session, authReq *
 		// Check account IP whitelist
 		whitelisted, err := tl.server.db.IsIPWhitelistedForAccount(clientIP, account.ID)
 		if err != nil {
-			result.response.Error = "Internal server error"
-			return result
+			return result.reject(protocol.RegisterCodeInternal, "Internal server error")
 		}
 		if !whitelisted {
-			result.response.Error = "IP address not whitelisted"
-			return result
+			return result.reject(protocol.RegisterCodeIPNotWhitelisted, "IP address not whitelisted")
 		}
 
 		tl.server.db.UpdateAccountLastUsed(account.ID)
+		tl.server.db.UpdateAccountTokenLastUsed(account.TokenID)
+	}
+
+	// A registration by application ID serves only that app's subdomain
+	if authReq.AppID != "" {
+		if len(authReq.Forwards) != 1 {
+			return result.reject(protocol.RegisterCodeInvalidRequest, "Registering by application allows exactly one forward")
+		}
+		app, code, msg := tl.server.bindApplication(authReq.AppID, authReq.Forwards[0].Subdomain, account, apiKey)
+		if app == nil {
+			return result.reject(code, msg)
+		}
+		result.orgID = app.OrgID
+		result.appID = app.ID
+		authReq.Forwards[0].Subdomain = app.Subdomain
+
+		whitelisted, err := tl.server.db.IsIPWhitelistedForApp(clientIP, app.ID)
+		if err != nil {
+			return result.reject(protocol.RegisterCodeInternal, "Internal server error")
+		}
+		if !whitelisted {
+			return result.reject(protocol.RegisterCodeIPNotWhitelisted, "IP address not whitelisted")
+		}
+	}
+
+	// Bound the subdomains one connection can claim. The connection still counts
+	// as a single tunnel toward the organization's concurrent tunnel limit.
+	result.response.MaxForwards = tl.server.maxForwardsFor(result.orgID)
+	if max := result.response.MaxForwards; max > 0 && len(authReq.Forwards) > max {
+		log.Printf("Registration from %s rejected: %d forwards requested, limit is %d", clientIP, len(authReq.Forwards), max)
+		return result.reject(protocol.RegisterCodeQuotaExceeded, fmt.Sprintf("Too many forwards: %d requested, at most %d per connection", len(authReq.Forwards), max))
 	}
 
-	// Validate and register subdomains
+	// Validate and register subdomains. A subdomain held by a TCP session of the
+	// same credential is resumed with a valid reconnect token, which replaces the
+	// whole session the server has not noticed is dead.
+	owner := tunnelOwner(account, apiKey)
 	tunnels := make([]tunnel.TunnelInfo, 0, len(authReq.Forwards))
-	for _, fwd := range authReq.Forwards {
+	for i, fwd := range authReq.Forwards {
 		subdomain := strings.ToLower(fwd.Subdomain)
 
+		// A forward without a subdomain gets the account's default subdomain or a
+		// random one. The session registers the forwards as assigned here.
+		if subdomain == "" {
+			assigned, err := tl.server.defaultSubdomain(account)
+			if err != nil {
+				log.Printf("Random subdomain generation failed: %v", err)
+				return result.reject(protocol.RegisterCodeNoFreeSubdomain, "No free random subdomain available; try again or request a subdomain")
+			}
+			subdomain = assigned
+			authReq.Forwards[i].Subdomain = subdomain
+		}
+
 		// Validate subdomain
-		if !isValidSubdomain(subdomain) {
-			result.response.Error = fmt.Sprintf("Invalid subdomain: %s", subdomain)
-			return result
+		if err := tl.server.subdomainPolicy.Validate(subdomain); err != nil {
+			return result.reject(protocol.RegisterCodeInvalidSubdomain, fmt.Sprintf("Invalid subdomain %s: %v", subdomain, err))
+		}
+
+		for _, target := range forwardLocalTargets(fwd) {
+			if msg := tl.server.checkLocalTarget(target); msg != "" {
+				log.Printf("Registration of %s from %s rejected: %s", subdomain, clientIP, msg)
+				return result.reject(protocol.RegisterCodeLocalTarget, msg)
+			}
 		}
 
 		// Check if subdomain is already in use (WebSocket tunnels)
@@ -350,26 +437,21 @@ func (tl *TunnelListener) authenticateSession(session *tunnel.Session, authReq *
 		_, wsExists := tl.server.tunnels[subdomain]
 		tl.server.mu.RUnlock()
 		if wsExists {
-			result.response.Error = fmt.Sprintf("Subdomain %s already in use", subdomain)
-			return result
+			result.response.Suggestions = tl.server.suggestSubdomains(subdomain)
+			return result.reject(protocol.RegisterCodeSubdomainTaken, fmt.Sprintf("Subdomain %s already in use", subdomain))
 		}
 
 		// Check if subdomain is already in use (TCP tunnels)
 		tl.mu.RLock()
-		_, tcpExists := tl.sessions[subdomain]
+		existing, tcpExists := tl.sessions[subdomain]
+		resumed := tcpExists && tl.canResume(existing, authReq.ReconnectToken, owner)
 		tl.mu.RUnlock()
-		if tcpExists {
-			result.response.Error = fmt.Sprintf("Subdomain %s already in use", subdomain)
-			return result
+		if tcpExists && !resumed {
+			result.response.Suggestions = tl.server.suggestSubdomains(subdomain)
+			return result.reject(protocol.RegisterCodeSubdomainTaken, fmt.Sprintf("Subdomain %s already in use", subdomain))
 		}
-
-		// Check quota before registering
-		if tl.server.quotaChecker != nil && result.orgID != "" {
-			allowed, reason := tl.server.quotaChecker.CanConnectTunnel(result.orgID)
-			if !allowed {
-				result.response.Error = fmt.Sprintf("Quota exceeded: %s", reason)
-				return result
-			}
+		if resumed && !slices.Contains(result.replaced, existing) {
+			result.replaced = append(result.replaced, existing)
 		}
 
 		url := fmt.Sprintf("%s://%s.%s", tl.server.scheme, subdomain, tl.server.domain)
@@ -380,20 +462,36 @@ func (tl *TunnelListener) authenticateSession(session *tunnel.Session, authReq *
 		})
 	}
 
+	// Check quota before registering. A resumed session replaces one that still
+	// counts toward the concurrent tunnel limit until its cleanup runs.
+	if tl.server.quotaChecker != nil && result.orgID != "" && len(result.replaced) == 0 {
+		allowed, reason := tl.server.quotaChecker.CanConnectTunnel(result.orgID)
+		if !allowed {
+			return result.reject(protocol.RegisterCodeQuotaExceeded, fmt.Sprintf("Quota exceeded: %s", reason))
+		}
+	}
+
 	result.response.Success = true
 	result.response.Tunnels = tunnels
+	result.response.ConnectionID = uuid.New().String()
+	if token := result.reconnect.issue(owner, tl.server.reconnectTokenTTL); token != "" {
+		result.response.ReconnectToken = token
+		result.response.ReconnectTokenTTL = int(tl.server.reconnectTokenTTL.Seconds())
+	}
 	return result
 }
 
-// maintainSession keeps the session alive until it's closed
+// maintainSession keeps the session alive until it's closed. The session is
+// kept alive by yamux's built-in keepalive; streams the client opens carry
+// health reports.
 func (tl *TunnelListener) maintainSession(session *tunnel.Session) {
-	// The session will be kept alive by yamux's built-in keepalive
-	// We just need to wait for the session to be closed
 	for {
-		if session.IsClosed() {
+		stream, err := session.AcceptStream()
+		if err != nil {
+			// Accepting only fails once the session is closed
 			return
 		}
-		time.Sleep(time.Second)
+		go tl.readHealthFrame(session, stream)
 	}
 }
 
@@ -406,11 +504,16 @@ func extractIPFromAddr(addr string) string {
 	return host
 }
 
-// RegisterSession registers a session for multiple subdomains
-func (tl *TunnelListener) RegisterSession(session *tunnel.Session) error {
+// RegisterSession registers a session for multiple subdomains. The subdomains
+// and reconnect token of the sessions it replaces are dropped first.
+func (tl *TunnelListener) RegisterSession(session *tunnel.Session, replaced ...*tunnel.Session) error {
 	tl.mu.Lock()
 	defer tl.mu.Unlock()
 
+	for _, old := range replaced {
+		tl.unregisterLocked(old)
+	}
+
 	subdomains := session.GetSubdomains()
 	for _, subdomain := range subdomains {
 		if _, exists := tl.sessions[subdomain]; exists {
@@ -429,10 +532,57 @@ func (tl *TunnelListener) RegisterSession(session *tunnel.Session) error {
 func (tl *TunnelListener) UnregisterSession(session *tunnel.Session) {
 	tl.mu.Lock()
 	defer tl.mu.Unlock()
+	tl.unregisterLocked(session)
+}
 
+// unregisterLocked removes a session's subdomains, unless a resuming session has
+// taken them over, and its limiter and reconnect token. Callers hold tl.mu.
+func (tl *TunnelListener) unregisterLocked(session *tunnel.Session) {
 	for _, subdomain := range session.GetSubdomains() {
-		delete(tl.sessions, subdomain)
+		if tl.sessions[subdomain] == session {
+			delete(tl.sessions, subdomain)
+		}
+	}
+	delete(tl.limiters, session)
+	delete(tl.reconnects, session)
+}
+
+// setReconnect stores the grant of the reconnect token issued to a session
+func (tl *TunnelListener) setReconnect(session *tunnel.Session, grant *reconnectGrant) {
+	if grant.hash == "" {
+		return
 	}
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	tl.reconnects[session] = grant
+}
+
+// canResume reports whether a registration with token and owner may replace
+// session. Yamux keepalives close sessions that stop answering, so an open
+// session counts as just heard from. Callers hold tl.mu.
+func (tl *TunnelListener) canResume(session *tunnel.Session, token, owner string) bool {
+	grant := tl.reconnects[session]
+	return grant != nil && !session.IsClosed() && grant.allows(token, owner, time.Now())
+}
+
+// setLimiter sets the throughput cap shared by all of a session's subdomains
+func (tl *TunnelListener) setLimiter(session *tunnel.Session, limiter *bandwidthLimiter) {
+	if limiter == nil {
+		return
+	}
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	tl.limiters[session] = limiter
+}
+
+// limiter returns the session's throughput cap (nil = unlimited)
+func (tl *TunnelListener) limiter(session *tunnel.Session) *bandwidthLimiter {
+	if tl == nil {
+		return nil
+	}
+	tl.mu.RLock()
+	defer tl.mu.RUnlock()
+	return tl.limiters[session]
 }
 
 // GetSession returns the session for a subdomain
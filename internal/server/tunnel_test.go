@@ -0,0 +1,30 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestTunnelRequestAckState(t *testing.T) {
+	tun := NewTunnel("test", nil)
+	tun.AddResponseChannel("req-1")
+	tun.AddResponseChannel("req-2")
+
+	if got := tun.requestAckState("req-1"); got != ackUnsupported {
+		t.Errorf("state before any ack = %v, want ackUnsupported", got)
+	}
+
+	tun.AcknowledgeRequest("req-1")
+	if got := tun.requestAckState("req-1"); got != ackReceived {
+		t.Errorf("acknowledged request state = %v, want ackReceived", got)
+	}
+	if got := tun.requestAckState("req-2"); got != ackPending {
+		t.Errorf("unacknowledged request state = %v, want ackPending", got)
+	}
+
+	// Acks for requests that are no longer pending are not kept
+	tun.RemoveResponseChannel("req-1")
+	tun.AcknowledgeRequest("req-3")
+	if len(tun.acked) != 0 {
+		t.Errorf("acked = %v, want empty", tun.acked)
+	}
+}
@@ -1,7 +1,9 @@
 package server
 
 import (
+	"fmt"
 	"log"
+	"os"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -85,6 +87,9 @@ func (uc *UsageCache) syncLoop() {
 	defer plansTicker.Stop()
 	defer rollupTicker.Stop()
 
+	// Catch up on rollups missed while the server was down
+	uc.runRollups()
+
 	for {
 		select {
 		case <-uc.stopCh:
@@ -340,6 +345,23 @@ func (uc *UsageCache) ResetOrgUsage(orgID string) {
 	usage.mu.Unlock()
 }
 
+// ReloadOrgUsage replaces an organization's cached baseline with the stored
+// usage of the current period, after its snapshots were rewritten. Call
+// flushOrg first so no unflushed usage is dropped.
+func (uc *UsageCache) ReloadOrgUsage(orgID string) error {
+	existing, err := uc.db.GetCurrentPeriodUsage(orgID)
+	if err != nil {
+		return err
+	}
+	usage := uc.getOrCreateOrgUsage(orgID)
+	usage.mu.Lock()
+	usage.dbBandwidthBytes = existing.BandwidthBytes
+	usage.dbTunnelSeconds = existing.TunnelSeconds
+	usage.dbRequestCount = existing.RequestCount
+	usage.mu.Unlock()
+	return nil
+}
+
 // UpdateOrgPlanID updates the cached plan ID for an organization (called when plan changes)
 func (uc *UsageCache) UpdateOrgPlanID(orgID string, planID *string) {
 	usage := uc.getOrCreateOrgUsage(orgID)
@@ -349,49 +371,58 @@ func (uc *UsageCache) UpdateOrgPlanID(orgID string, planID *string) {
 	usage.mu.Unlock()
 }
 
-// Retention periods
 const (
-	HourlyRetention = 7 * 24 * time.Hour  // 7 days
-	DailyRetention  = 90 * 24 * time.Hour // 90 days
+	// HourlyRetention is how long hourly snapshots are kept after being rolled up
+	HourlyRetention = 7 * 24 * time.Hour
+	// defaultDailyRetention is how long daily snapshots are kept unless configured
+	defaultDailyRetention = 90 * 24 * time.Hour
+	// minDailyRetention keeps last month's daily snapshots intact while it can still be rolled up
+	minDailyRetention = 45 * 24 * time.Hour
+	// monthlyRollupDays is how many days into a month the previous month is rolled up,
+	// so a server that was down on the 1st still produces the monthly snapshot
+	monthlyRollupDays = 7
 )
 
-// runRollups performs periodic rollup and cleanup operations
+// runRollups rolls finished periods up into coarser snapshots and prunes old ones.
+// Rollups are upserts, so repeating them every run is harmless.
 func (uc *UsageCache) runRollups() {
-	now := time.Now()
+	now := time.Now().UTC()
 
 	// Daily rollup: aggregate yesterday's hourly data into a daily snapshot
-	// Run at the start of each day (when hour is 0-1)
-	if now.Hour() < 1 {
-		yesterday := now.AddDate(0, 0, -1)
-		if err := uc.db.RollupHourlyToDaily(yesterday); err != nil {
-			log.Printf("Failed to rollup hourly to daily: %v", err)
-		} else {
-			log.Printf("Completed daily rollup for %s", yesterday.Format("2006-01-02"))
-		}
+	yesterday := now.AddDate(0, 0, -1)
+	if err := uc.db.RollupHourlyToDaily(yesterday); err != nil {
+		log.Printf("Failed to rollup hourly to daily: %v", err)
 	}
 
 	// Monthly rollup: aggregate last month's daily data into a monthly snapshot
-	// Run on the 1st of each month
-	if now.Day() == 1 && now.Hour() < 1 {
-		lastMonth := now.AddDate(0, -1, 0)
+	if now.Day() <= monthlyRollupDays {
+		lastMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -1, 0)
 		if err := uc.db.RollupDailyToMonthly(lastMonth); err != nil {
 			log.Printf("Failed to rollup daily to monthly: %v", err)
-		} else {
-			log.Printf("Completed monthly rollup for %s", lastMonth.Format("2006-01"))
 		}
 	}
 
-	// Cleanup old hourly snapshots (older than 7 days)
 	if deleted, err := uc.db.CleanupOldHourlySnapshots(HourlyRetention); err != nil {
 		log.Printf("Failed to cleanup old hourly snapshots: %v", err)
 	} else if deleted > 0 {
 		log.Printf("Cleaned up %d old hourly snapshots", deleted)
 	}
 
-	// Cleanup old daily snapshots (older than 90 days)
-	if deleted, err := uc.db.CleanupOldDailySnapshots(DailyRetention); err != nil {
+	if deleted, err := uc.db.CleanupOldDailySnapshots(GetUsageDailyRetention()); err != nil {
 		log.Printf("Failed to cleanup old daily snapshots: %v", err)
 	} else if deleted > 0 {
 		log.Printf("Cleaned up %d old daily snapshots", deleted)
 	}
 }
+
+// GetUsageDailyRetention returns how long daily usage snapshots are kept from environment or default
+func GetUsageDailyRetention() time.Duration {
+	if days := os.Getenv("USAGE_DAILY_RETENTION_DAYS"); days != "" {
+		var d int
+		fmt.Sscanf(days, "%d", &d)
+		if d > 0 {
+			return max(time.Duration(d)*24*time.Hour, minDailyRetention)
+		}
+	}
+	return defaultDailyRetention
+}
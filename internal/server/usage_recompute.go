@@ -0,0 +1,95 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// maxUsageRecomputeRange bounds the range of one usage recompute
+const maxUsageRecomputeRange = 366 * 24 * time.Hour
+
+// handleRecomputeUsage rebuilds an organization's usage snapshots for a range
+// from its tunnel records, to reconcile accounting that drifted. The range is
+// widened to whole UTC days; the response holds the totals before and after.
+func (s *Server) handleRecomputeUsage(w http.ResponseWriter, r *http.Request, adminUsername string) {
+	query := r.URL.Query()
+	orgID := query.Get("org")
+	if orgID == "" {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "org is required")
+		return
+	}
+	from, err := time.Parse(time.RFC3339, query.Get("from"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "Invalid from (expected RFC3339)")
+		return
+	}
+	to, err := time.Parse(time.RFC3339, query.Get("to"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "Invalid to (expected RFC3339)")
+		return
+	}
+	if !from.Before(to) {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "from must be before to")
+		return
+	}
+	if to.Sub(from) > maxUsageRecomputeRange {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "Range must not exceed 366 days")
+		return
+	}
+
+	org, err := s.db.GetOrganizationByID(orgID)
+	if err != nil {
+		log.Printf("Failed to get organization: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+	if org == nil {
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Organization not found")
+		return
+	}
+
+	// Write pending usage first so the recompute replaces it rather than adding to it later
+	if s.usageCache != nil {
+		s.usageCache.flushOrg(org.ID)
+	}
+
+	result, err := s.db.RecomputeOrgUsage(org.ID, from, to)
+	if err != nil {
+		log.Printf("Failed to recompute usage: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+
+	if s.usageCache != nil {
+		if err := s.usageCache.ReloadOrgUsage(org.ID); err != nil {
+			log.Printf("Failed to reload usage of org %s: %v", org.ID, err)
+		}
+	}
+
+	delta := result.After.Sub(result.Before)
+	log.Printf("Usage of organization %s recomputed for %s to %s by admin %s", org.Name,
+		result.From.Format(time.DateOnly), result.To.Format(time.DateOnly), adminUsername)
+	target := fmt.Sprintf("%s from %s to %s: bandwidth %+d bytes, tunnel time %+d s, requests %+d",
+		org.Name, result.From.Format(time.DateOnly), result.To.Format(time.DateOnly),
+		delta.BandwidthBytes, delta.TunnelSeconds, delta.RequestCount)
+	if err := s.db.LogAdminAction(&org.ID, db.AuditTypeUsageRecomputed, auth.GetClientIP(r), adminUsername, target); err != nil {
+		log.Printf("Failed to audit usage recompute: %v", err)
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"success": true,
+		"orgId":   org.ID,
+		"orgName": org.Name,
+		"from":    result.From,
+		"to":      result.To,
+		"hours":   result.Hours,
+		"before":  result.Before,
+		"after":   result.After,
+		"delta":   delta,
+	})
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestRecomputeUsage(t *testing.T) {
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	account, err := database.CreateOrgAccount("alice", auth.HashToken("alice"), "", org.ID)
+	if err != nil {
+		t.Fatalf("CreateOrgAccount() error: %v", err)
+	}
+	day := time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+	addTunnel := func(from, to time.Duration, bytes, requests int64) {
+		tunnel, err := database.CreateTunnel(account.ID, "alice", "127.0.0.1")
+		if err != nil {
+			t.Fatalf("CreateTunnel() error: %v", err)
+		}
+		if _, err := database.Conn().Exec(`UPDATE tunnels SET created_at = ?, closed_at = ?, bytes_sent = ?, request_count = ? WHERE id = ?`,
+			day.Add(from), day.Add(to), bytes, requests, tunnel.ID); err != nil {
+			t.Fatalf("update tunnel: %v", err)
+		}
+	}
+	// Two hours with bandwidth and requests spread evenly, plus a second tunnel overlapping at 11:00
+	addTunnel(10*time.Hour+30*time.Minute, 12*time.Hour+30*time.Minute, 4000, 40)
+	addTunnel(11*time.Hour, 11*time.Hour+30*time.Minute, 0, 0)
+
+	// Drifted aggregates: a bogus hour, its daily rollup and the month
+	for _, snap := range []struct {
+		period db.PeriodType
+		start  time.Time
+		values [4]int64
+	}{
+		{db.PeriodHourly, day.Add(10 * time.Hour), [4]int64{999999, 1, 1, 1}},
+		{db.PeriodDaily, day, [4]int64{5000, 100, 7, 3}},
+		{db.PeriodMonthly, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), [4]int64{10000, 1000, 50, 3}},
+	} {
+		if err := database.UpsertUsageSnapshot(org.ID, snap.period, snap.start, snap.values[0], snap.values[1], snap.values[2], int(snap.values[3])); err != nil {
+			t.Fatalf("UpsertUsageSnapshot() error: %v", err)
+		}
+	}
+
+	s := newTestServer(database)
+	recompute := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.handleRecomputeUsage(w, httptest.NewRequest(http.MethodPost, "/admin/maintenance/recompute-usage?"+query, nil), "root")
+		return w
+	}
+	if w := recompute("org=" + org.ID + "&from=2026-01-16T00:00:00Z&to=2026-01-15T00:00:00Z"); w.Code != http.StatusBadRequest {
+		t.Errorf("reversed range: status %d, want 400", w.Code)
+	}
+	if w := recompute("org=missing&from=2026-01-15T00:00:00Z&to=2026-01-16T00:00:00Z"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown org: status %d, want 404", w.Code)
+	}
+
+	// A range inside the day is widened to the whole day
+	w := recompute("org=" + org.ID + "&from=2026-01-15T09:00:00Z&to=2026-01-15T13:00:00Z")
+	if w.Code != http.StatusOK {
+		t.Fatalf("recompute: status %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		From   time.Time      `json:"from"`
+		To     time.Time      `json:"to"`
+		Hours  int            `json:"hours"`
+		Before db.UsageTotals `json:"before"`
+		After  db.UsageTotals `json:"after"`
+		Delta  db.UsageTotals `json:"delta"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	wantAfter := db.UsageTotals{BandwidthBytes: 4000, TunnelSeconds: 9000, RequestCount: 40, PeakConcurrentTunnels: 2}
+	if !resp.From.Equal(day) || !resp.To.Equal(day.AddDate(0, 0, 1)) || resp.Hours != 3 {
+		t.Errorf("recomputed %v to %v in %d hours, want the whole day in 3 hours", resp.From, resp.To, resp.Hours)
+	}
+	if resp.Before != (db.UsageTotals{BandwidthBytes: 5000, TunnelSeconds: 100, RequestCount: 7, PeakConcurrentTunnels: 3}) || resp.After != wantAfter {
+		t.Errorf("before/after = %+v / %+v, want the drifted day / %+v", resp.Before, resp.After, wantAfter)
+	}
+	if resp.Delta != resp.After.Sub(resp.Before) {
+		t.Errorf("delta = %+v, want after - before", resp.Delta)
+	}
+
+	hours, err := database.GetUsageSnapshotsForOrg(org.ID, db.PeriodHourly, day.Add(10*time.Hour), day.AddDate(0, 0, 1))
+	if err != nil || len(hours) != 3 || hours[0].BandwidthBytes != 1000 || hours[1].TunnelSeconds != 5400 || hours[1].PeakConcurrentTunnels != 2 {
+		t.Errorf("hourly snapshots = %+v, %v, want 3 recomputed hours", hours, err)
+	}
+	month, err := database.GetUsageSnapshot(org.ID, db.PeriodMonthly, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil || month == nil || month.BandwidthBytes != 9000 || month.TunnelSeconds != 9900 || month.RequestCount != 83 {
+		t.Errorf("monthly snapshot = %+v, %v, want it moved by the day's difference", month, err)
+	}
+
+	audit, err := database.GetAuditEvents(&org.ID, nil, 10, 0)
+	if err != nil || len(audit) != 1 || audit[0].AuthType != db.AuditTypeUsageRecomputed || audit[0].Actor != "root" {
+		t.Errorf("audit = %+v, %v, want one usage_recomputed entry by root", audit, err)
+	}
+}
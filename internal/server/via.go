@@ -0,0 +1,53 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// viaPseudonym is the name digit-link uses for itself in the Via header
+const viaPseudonym = "digit-link"
+
+// GetViaHeader returns the Via entry added to tunneled responses, or "" when
+// VIA_HEADER=false. INSTANCE_ID, if set, is added as a comment to tell instances apart.
+func GetViaHeader() string {
+	if os.Getenv("VIA_HEADER") == "false" {
+		return ""
+	}
+	via := "1.1 " + viaPseudonym
+	if instance := os.Getenv("INSTANCE_ID"); instance != "" {
+		if !isViaComment(instance) {
+			log.Printf("WARNING: INSTANCE_ID %q may only contain letters, digits, '-', '_' and '.', leaving it out of Via", instance)
+		} else {
+			via += " (" + instance + ")"
+		}
+	}
+	return via
+}
+
+// isViaComment reports whether s can be used in a Via comment without escaping
+func isViaComment(s string) bool {
+	for _, c := range s {
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// appendVia adds via to the response's Via header after any entries set by the
+// local service (RFC 9110 section 7.6.3)
+func appendVia(h http.Header, via string) {
+	if via == "" {
+		return
+	}
+	var entries []string
+	for _, v := range h.Values("Via") {
+		if v = strings.TrimSpace(v); v != "" {
+			entries = append(entries, v)
+		}
+	}
+	h.Set("Via", strings.Join(append(entries, via), ", "))
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestViaHeader(t *testing.T) {
+	t.Setenv("INSTANCE_ID", "eu-1")
+	via := GetViaHeader()
+	if via != "1.1 digit-link (eu-1)" {
+		t.Errorf("GetViaHeader() = %q, want 1.1 digit-link (eu-1)", via)
+	}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		via     string
+		want    string
+	}{
+		{"added", map[string]string{}, via, via},
+		{"appended to backend Via", map[string]string{"Via": "1.1 nginx"}, via, "1.1 nginx, " + via},
+		{"disabled", map[string]string{"Via": "1.1 nginx"}, "", "1.1 nginx"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		writeTunnelResponse(w, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, tt.headers, nil, tt.via)
+		if got := w.Header().Get("Via"); got != tt.want {
+			t.Errorf("%s: Via = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	t.Setenv("VIA_HEADER", "false")
+	if via := GetViaHeader(); via != "" {
+		t.Errorf("GetViaHeader() = %q with VIA_HEADER=false, want disabled", via)
+	}
+}
@@ -0,0 +1,22 @@
+package server
+
+import (
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// applyWebhookPolicy validates the authorization webhook of a policy of the
+// given type and puts its header allowlist in canonical form. Other policy
+// types call no webhook, so their webhook fields are cleared.
+func applyWebhookPolicy(authType db.AuthType, webhookURL *string, headers *[]string) error {
+	if authType != db.AuthTypeWebhook {
+		*webhookURL, *headers = "", nil
+		return nil
+	}
+	canonical, err := auth.ValidateWebhookConfig(*webhookURL, *headers)
+	if err != nil {
+		return err
+	}
+	*headers = canonical
+	return nil
+}
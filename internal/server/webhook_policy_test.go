@@ -0,0 +1,92 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/policy"
+)
+
+// stubWebhookHandler stands in for the authorization webhook, whose real
+// transport refuses the loopback address of a test server. It lets a request
+// through when the allowlisted X-Tenant header would be sent.
+type stubWebhookHandler struct {
+	config *policy.WebhookConfig
+}
+
+func (h *stubWebhookHandler) Authenticate(w http.ResponseWriter, r *http.Request, p *policy.EffectivePolicy, ctx *policy.AuthContext) *policy.AuthResult {
+	h.config = p.Webhook
+	req := auth.NewWebhookRequest(r, p.Webhook, ctx)
+	if req.Headers["X-Tenant"] == nil || req.Headers["Authorization"] != nil {
+		return policy.Failure("denied by authorization webhook")
+	}
+	return policy.Success("")
+}
+
+func (h *stubWebhookHandler) Challenge(w http.ResponseWriter, r *http.Request, p *policy.EffectivePolicy, ctx *policy.AuthContext) {
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+func TestWebhookPolicy(t *testing.T) {
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	if _, err := database.CreateApplication(org.ID, "api", "api"); err != nil {
+		t.Fatalf("CreateApplication() error: %v", err)
+	}
+
+	webhook := &stubWebhookHandler{}
+	s := newTestServer(database)
+	s.authMiddleware = NewAuthMiddleware(database, WithWebhookHandler(webhook))
+	setPolicy := func(body string) int {
+		r := httptest.NewRequest(http.MethodPut, "/admin/organizations/"+org.ID+"/policy", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.handleSetOrgPolicy(w, r, org.ID)
+		return w.Code
+	}
+	for _, body := range []string{
+		`{"authType":"webhook"}`,
+		`{"authType":"webhook","webhookUrl":"https://authz.example.com","webhookHeaders":["Bad Name"]}`,
+		`{"authType":"webhook","webhookUrl":"https://authz.example.com","apiKeyEnabled":true}`,
+		`{"authType":"webhook","webhookUrl":"http://authz.example.com"}`,
+		`{"authType":"webhook","webhookUrl":"https://127.0.0.1:8080/check"}`,
+		`{"authType":"webhook","webhookUrl":"https://169.254.169.254/latest/meta-data"}`,
+	} {
+		if code := setPolicy(body); code != http.StatusBadRequest {
+			t.Errorf("set %s: status %d, want 400", body, code)
+		}
+	}
+	if code := setPolicy(`{"authType":"webhook","webhookUrl":"https://authz.example.com/check","webhookHeaders":["x-tenant"]}`); code != http.StatusOK {
+		t.Fatalf("set webhook policy: status %d, want 200", code)
+	}
+	if p, _ := database.GetOrgAuthPolicy(org.ID); p == nil || p.WebhookURL != "https://authz.example.com/check" || len(p.WebhookHeaders) != 1 || p.WebhookHeaders[0] != "X-Tenant" {
+		t.Fatalf("stored policy = %+v, want the webhook with canonical headers", p)
+	}
+
+	// Only the allowlisted header reaches the webhook, which lets the request through
+	for tenant, want := range map[string]int{"acme": http.StatusOK, "": http.StatusUnauthorized} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "http://api.link.digit.zone/", nil)
+		r.Header.Set("Authorization", "Bearer token")
+		if tenant != "" {
+			r.Header.Set("X-Tenant", tenant)
+		}
+		result, authCtx := s.authMiddleware.AuthenticateRequest(w, r, "api")
+		if s.authMiddleware.HandleAuthResult(w, r, result, GetEffectivePolicyFromContext(r), authCtx) {
+			w.WriteHeader(http.StatusOK)
+		}
+		if w.Code != want || (want == http.StatusOK && result.Method != "webhook") {
+			t.Errorf("tenant %q: status %d (method %q), want %d", tenant, w.Code, result.Method, want)
+		}
+	}
+	if webhook.config == nil || webhook.config.URL != "https://authz.example.com/check" {
+		t.Errorf("webhook called with %+v, want the stored policy", webhook.config)
+	}
+}
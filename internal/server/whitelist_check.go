@@ -0,0 +1,155 @@
+package server
+
+import (
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+// WhitelistCheckResponse explains whether an IP passes an account's or application's
+// whitelist and which entry let it through
+type WhitelistCheckResponse struct {
+	IP      string             `json:"ip"`
+	Allowed bool               `json:"allowed"`
+	Match   *db.WhitelistMatch `json:"match"` // Nil when no entry matched
+}
+
+// whitelistCheckIP returns the ip query parameter, defaulting to the caller's IP
+func whitelistCheckIP(r *http.Request) (string, bool) {
+	ip := r.URL.Query().Get("ip")
+	if ip == "" {
+		ip = auth.GetClientIP(r)
+	}
+	return ip, net.ParseIP(ip) != nil
+}
+
+// handleAccountWhitelistCheck reports whether an IP may connect tunnels with an account's token
+func (s *Server) handleAccountWhitelistCheck(w http.ResponseWriter, r *http.Request, accountID string) {
+	ip, ok := whitelistCheckIP(r)
+	if !ok {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "Invalid IP address")
+		return
+	}
+
+	account, err := s.db.GetAccountByID(accountID)
+	if err != nil {
+		log.Printf("Failed to get account: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+	if account == nil {
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Account not found")
+		return
+	}
+
+	match, err := s.db.MatchIPWhitelistForAccount(ip, accountID)
+	if err != nil {
+		log.Printf("Whitelist check error: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+
+	jsonResponse(w, WhitelistCheckResponse{IP: ip, Allowed: match != nil, Match: match})
+}
+
+// handleApplicationWhitelistCheck reports whether an IP may connect tunnels with an application's API keys
+func (s *Server) handleApplicationWhitelistCheck(w http.ResponseWriter, r *http.Request, appID string) {
+	ip, ok := whitelistCheckIP(r)
+	if !ok {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "Invalid IP address")
+		return
+	}
+
+	app, err := s.db.GetApplicationByID(appID)
+	if err != nil {
+		log.Printf("Failed to get application: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+	if app == nil {
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, "Application not found")
+		return
+	}
+
+	match, err := s.db.MatchIPWhitelistForApp(ip, appID)
+	if err != nil {
+		log.Printf("Whitelist check error: %v", err)
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "Internal server error")
+		return
+	}
+
+	jsonResponse(w, WhitelistCheckResponse{IP: ip, Allowed: match != nil, Match: match})
+}
+
+// handleOrgAccountWhitelistCheck is the org-scoped account whitelist check. Members may
+// only check their own account ("me"). Global entries are reported without their details.
+func (s *Server) handleOrgAccountWhitelistCheck(w http.ResponseWriter, r *http.Request, orgCtx *OrgContext, accountID string) {
+	if accountID == "me" {
+		accountID = orgCtx.AccountID
+	}
+	if accountID != orgCtx.AccountID && !s.requireOrgAdmin(w, orgCtx) {
+		return
+	}
+
+	ip, ok := whitelistCheckIP(r)
+	if !ok {
+		jsonError(w, "Invalid IP address", http.StatusBadRequest)
+		return
+	}
+
+	account, err := s.verifyOrgAccountOwnership(orgCtx, accountID)
+	if err != nil {
+		log.Printf("Failed to get account: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if account == nil {
+		jsonError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+
+	match, err := s.db.MatchIPWhitelistForAccount(ip, accountID)
+	if err != nil {
+		log.Printf("Whitelist check error: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if match != nil && match.Layer == db.WhitelistLayerGlobal {
+		// The global whitelist is managed by server admins, only say that it matched
+		match = &db.WhitelistMatch{Layer: db.WhitelistLayerGlobal}
+	}
+
+	jsonResponse(w, WhitelistCheckResponse{IP: ip, Allowed: match != nil, Match: match})
+}
+
+// handleOrgAppWhitelistCheck is the org-scoped application whitelist check
+func (s *Server) handleOrgAppWhitelistCheck(w http.ResponseWriter, r *http.Request, orgCtx *OrgContext, appID string) {
+	ip, ok := whitelistCheckIP(r)
+	if !ok {
+		jsonError(w, "Invalid IP address", http.StatusBadRequest)
+		return
+	}
+
+	app, err := s.verifyOrgOwnership(orgCtx, appID)
+	if err != nil {
+		log.Printf("Failed to get application: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if app == nil {
+		jsonError(w, "Application not found", http.StatusNotFound)
+		return
+	}
+
+	match, err := s.db.MatchIPWhitelistForApp(ip, appID)
+	if err != nil {
+		log.Printf("Whitelist check error: %v", err)
+		jsonError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, WhitelistCheckResponse{IP: ip, Allowed: match != nil, Match: match})
+}
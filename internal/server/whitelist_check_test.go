@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/niekvdm/digit-link/internal/auth"
+	"github.com/niekvdm/digit-link/internal/db"
+)
+
+func TestWhitelistCheck(t *testing.T) {
+	database := newTestDB(t)
+
+	org, err := database.CreateOrganization("acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization() error: %v", err)
+	}
+	app, err := database.CreateApplication(org.ID, "myapp", "My App")
+	if err != nil {
+		t.Fatalf("CreateApplication() error: %v", err)
+	}
+	member, err := database.CreateOrgAccount("member", auth.HashToken("member"), "", org.ID)
+	if err != nil {
+		t.Fatalf("CreateOrgAccount() error: %v", err)
+	}
+	other, err := database.CreateOrgAccount("other", auth.HashToken("other"), "", org.ID)
+	if err != nil {
+		t.Fatalf("CreateOrgAccount() error: %v", err)
+	}
+
+	orgEntry, _ := database.AddOrgWhitelist(org.ID, "10.0.0.0/8", "office", "")
+	appEntry, _ := database.AddAppWhitelist(app.ID, "192.168.1.0/24", "ci", "")
+	database.AddGlobalWhitelist("172.16.0.1", "ops vpn", "")
+	accountEntry, _ := database.AddAccountWhitelist(member.ID, "198.51.100.7", "home")
+
+	s := newTestServer(database)
+	check := func(handler func(w http.ResponseWriter, r *http.Request), ip string) (int, WhitelistCheckResponse) {
+		r := httptest.NewRequest(http.MethodGet, "/whitelist-check?ip="+ip, nil)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		var resp WhitelistCheckResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+	adminAccount := func(w http.ResponseWriter, r *http.Request) { s.handleAccountWhitelistCheck(w, r, member.ID) }
+	adminApp := func(w http.ResponseWriter, r *http.Request) { s.handleApplicationWhitelistCheck(w, r, app.ID) }
+
+	tests := []struct {
+		name    string
+		handler func(w http.ResponseWriter, r *http.Request)
+		ip      string
+		layer   string
+		entryID string
+	}{
+		{"account via org", adminAccount, "10.1.2.3", db.WhitelistLayerOrg, orgEntry.ID},
+		{"account via global", adminAccount, "172.16.0.1", db.WhitelistLayerGlobal, ""},
+		{"account via account", adminAccount, "198.51.100.7", db.WhitelistLayerAccount, accountEntry.ID},
+		{"account not allowed", adminAccount, "203.0.113.1", "", ""},
+		{"app via app", adminApp, "192.168.1.20", db.WhitelistLayerApp, appEntry.ID},
+		{"app via org", adminApp, "10.9.9.9", db.WhitelistLayerOrg, orgEntry.ID},
+		{"app ignores account entries", adminApp, "198.51.100.7", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, resp := check(tt.handler, tt.ip)
+			if status != http.StatusOK {
+				t.Fatalf("status = %d, want %d", status, http.StatusOK)
+			}
+			if resp.Allowed != (tt.layer != "") {
+				t.Errorf("allowed = %v, want %v", resp.Allowed, tt.layer != "")
+			}
+			if tt.layer == "" {
+				if resp.Match != nil {
+					t.Errorf("match = %+v, want none", resp.Match)
+				}
+				return
+			}
+			if resp.Match == nil || resp.Match.Layer != tt.layer {
+				t.Fatalf("match = %+v, want layer %s", resp.Match, tt.layer)
+			}
+			if tt.entryID != "" && resp.Match.EntryID != tt.entryID {
+				t.Errorf("entryId = %s, want %s", resp.Match.EntryID, tt.entryID)
+			}
+		})
+	}
+
+	if status, _ := check(adminAccount, "not-an-ip"); status != http.StatusBadRequest {
+		t.Errorf("invalid ip status = %d, want %d", status, http.StatusBadRequest)
+	}
+
+	// Org scope: members may only check themselves and don't see global entry details
+	memberCtx := &OrgContext{AccountID: member.ID, OrgID: org.ID}
+	status, resp := check(func(w http.ResponseWriter, r *http.Request) {
+		s.handleOrgAccountWhitelistCheck(w, r, memberCtx, "me")
+	}, "172.16.0.1")
+	if status != http.StatusOK || resp.Match == nil || resp.Match.Layer != db.WhitelistLayerGlobal || resp.Match.IPRange != "" {
+		t.Errorf("member self check = %d %+v, want redacted global match", status, resp.Match)
+	}
+	if status, _ := check(func(w http.ResponseWriter, r *http.Request) {
+		s.handleOrgAccountWhitelistCheck(w, r, memberCtx, other.ID)
+	}, "10.1.2.3"); status != http.StatusForbidden {
+		t.Errorf("member checking another account = %d, want %d", status, http.StatusForbidden)
+	}
+	foreignCtx := &OrgContext{AccountID: "someone", OrgID: "other-org", IsOrgAdmin: true}
+	if status, _ := check(func(w http.ResponseWriter, r *http.Request) {
+		s.handleOrgAppWhitelistCheck(w, r, foreignCtx, app.ID)
+	}, "10.1.2.3"); status != http.StatusNotFound {
+		t.Errorf("other org checking app = %d, want %d", status, http.StatusNotFound)
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"strings"
+
+	"github.com/niekvdm/digit-link/internal/protocol"
 )
 
 // Message types for TCP tunnel communication
@@ -16,14 +19,29 @@ const (
 	TypeHTTPResponse = "http_response"
 	TypePing         = "ping"
 	TypePong         = "pong"
+	TypeShutdown     = "shutdown"
+	TypeHealth       = "health"
 )
 
 // ForwardConfig defines a single port forwarding configuration
 type ForwardConfig struct {
-	Subdomain  string `json:"subdomain"`
+	Subdomain  string      `json:"subdomain"`
+	LocalPort  int         `json:"localPort"`
+	LocalHTTPS bool        `json:"localHttps,omitempty"` // Use HTTPS for local forwarding
+	Primary    bool        `json:"primary,omitempty"`
+	Routes     []PathRoute `json:"routes,omitempty"` // Client-side path routing (longest prefix wins)
+
+	// LocalAddr is the local host the client forwards to, reported so the server
+	// can show and restrict it. Empty from clients that predate it.
+	LocalAddr string `json:"localAddr,omitempty"`
+}
+
+// PathRoute maps a path prefix within a forward to a different local target.
+// Requests that match no route go to the forward's own LocalPort.
+type PathRoute struct {
+	Prefix     string `json:"prefix"`
 	LocalPort  int    `json:"localPort"`
-	LocalHTTPS bool   `json:"localHttps,omitempty"` // Use HTTPS for local forwarding
-	Primary    bool   `json:"primary,omitempty"`
+	LocalHTTPS bool   `json:"localHttps,omitempty"`
 }
 
 // AuthRequest is sent by the client after establishing the yamux session
@@ -31,7 +49,15 @@ type ForwardConfig struct {
 type AuthRequest struct {
 	Token    string          `json:"token"`
 	Forwards []ForwardConfig `json:"forwards"`
-	AppID    string          `json:"appId,omitempty"` // App ID when using app-specific API key
+	AppID    string          `json:"appId,omitempty"` // Register for this application; its only forward must use its subdomain
+
+	// Degraded registers while the local services are not accepting connections
+	// yet. The server answers visitors with 503 until a HealthFrame reports them healthy.
+	Degraded bool `json:"degraded,omitempty"`
+
+	// ReconnectToken from an earlier registration resumes its subdomains,
+	// replacing the previous session if the server still holds it
+	ReconnectToken string `json:"reconnectToken,omitempty"`
 }
 
 // TunnelInfo contains information about a registered tunnel endpoint
@@ -44,19 +70,40 @@ type TunnelInfo struct {
 
 // AuthResponse is sent by the server to confirm or reject authentication
 type AuthResponse struct {
-	Success bool         `json:"success"`
-	Tunnels []TunnelInfo `json:"tunnels,omitempty"`
-	Error   string       `json:"error,omitempty"`
+	Success     bool                  `json:"success"`
+	Tunnels     []TunnelInfo          `json:"tunnels,omitempty"`
+	Error       string                `json:"error,omitempty"`
+	Code        protocol.RegisterCode `json:"code,omitempty"`        // Why authentication failed, as in WebSocket register responses
+	Suggestions []string              `json:"suggestions,omitempty"` // Available alternatives when a subdomain is taken
+	MaxForwards int                   `json:"maxForwards,omitempty"` // Forwards the connection may register (0 = unlimited)
+
+	// ConnectionID identifies this session. ReconnectToken lets the client resume
+	// its subdomains after a dropped connection; it is only valid for the same
+	// credentials, up to ReconnectTokenTTL seconds after the session was last alive.
+	ConnectionID      string `json:"connectionId,omitempty"`
+	ReconnectToken    string `json:"reconnectToken,omitempty"`
+	ReconnectTokenTTL int    `json:"reconnectTokenTtl,omitempty"`
 }
 
 // RequestFrame represents an HTTP request sent from server to client over a yamux stream
 type RequestFrame struct {
+	Type      string            `json:"type,omitempty"`     // Empty for HTTP requests, TypeShutdown for shutdown notices
+	Shutdown  *ShutdownNotice   `json:"shutdown,omitempty"` // Set when Type is TypeShutdown
 	ID        string            `json:"id"`
 	Subdomain string            `json:"subdomain"`
 	Method    string            `json:"method"`
 	Path      string            `json:"path"`
 	Headers   map[string]string `json:"headers"`
 	Body      []byte            `json:"body,omitempty"`
+	WantAck   bool              `json:"wantAck,omitempty"` // Client sends an acknowledgement frame before the response
+
+	// GRPC marks a gRPC call: the client forwards it over HTTP/2 and answers
+	// with a Trailers response, so the call's status reaches the caller
+	GRPC bool `json:"grpc,omitempty"`
+
+	// Stream asks the client to relay the response body as it arrives, whatever
+	// its content type, for applications in streaming mode
+	Stream bool `json:"stream,omitempty"`
 }
 
 // ResponseFrame represents an HTTP response sent from client to server over a yamux stream
@@ -65,6 +112,41 @@ type ResponseFrame struct {
 	Status  int               `json:"status"`
 	Headers map[string]string `json:"headers"`
 	Body    []byte            `json:"body,omitempty"`
+	Ack     bool              `json:"ack,omitempty"`    // Acknowledgement that the request was received; the response follows
+	Stream  bool              `json:"stream,omitempty"` // The body follows the frame as raw bytes until the stream closes
+
+	// Trailers marks a streamed body sent as BodyChunk frames instead of raw
+	// bytes, the last of which carries the response trailers
+	Trailers bool `json:"trailers,omitempty"`
+
+	// BodyStream is the body of a streamed response: the local service's on the
+	// client, the rest of the yamux stream on the server
+	BodyStream io.ReadCloser `json:"-"`
+
+	// Trailer returns the trailers of a Trailers response once BodyStream has
+	// been read to the end
+	Trailer func() map[string]string `json:"-"`
+}
+
+// BodyChunk is a piece of a streamed body with trailers. The last chunk has
+// End set and carries the trailers instead of data.
+type BodyChunk struct {
+	Data     []byte            `json:"data,omitempty"`
+	Trailers map[string]string `json:"trailers,omitempty"`
+	End      bool              `json:"end,omitempty"`
+}
+
+// ShutdownNotice is sent by the server before it shuts down so clients can back off before reconnecting
+type ShutdownNotice struct {
+	Message        string `json:"message,omitempty"`
+	ReconnectDelay int    `json:"reconnectDelay,omitempty"` // Seconds to wait before reconnecting
+}
+
+// HealthFrame is sent by a client that registered degraded, on a stream it opens,
+// when the health of its local services changes
+type HealthFrame struct {
+	Type    string `json:"type"` // TypeHealth
+	Healthy bool   `json:"healthy"`
 }
 
 // PingFrame is used for keepalive
@@ -87,6 +169,112 @@ func ReadFrame[T any](r io.Reader) (*T, error) {
 	return &frame, nil
 }
 
+// ReadResponseFrame reads the response to a request sent with WantAck, skipping the
+// acknowledgement frame before it. acked reports whether the acknowledgement arrived,
+// also when reading the response fails.
+func ReadResponseFrame(r io.Reader) (frame *ResponseFrame, acked bool, err error) {
+	// A single decoder, as it may buffer the response while reading the acknowledgement
+	decoder := json.NewDecoder(r)
+	for {
+		var f ResponseFrame
+		if err := decoder.Decode(&f); err != nil {
+			return nil, acked, fmt.Errorf("failed to decode frame: %w", err)
+		}
+		if !f.Ack {
+			if f.Stream && f.Trailers {
+				body := &chunkedBody{decoder: decoder}
+				f.BodyStream, f.Trailer = body, body.trailers
+			} else if f.Stream {
+				body, err := streamedBody(decoder, r)
+				if err != nil {
+					return nil, acked, err
+				}
+				f.BodyStream = body
+			}
+			return &f, acked, nil
+		}
+		acked = true
+	}
+}
+
+// streamedBody returns the body that follows a streamed response frame: what the
+// decoder already buffered, then the rest of r
+func streamedBody(decoder *json.Decoder, r io.Reader) (io.ReadCloser, error) {
+	body := io.MultiReader(decoder.Buffered(), r)
+
+	// WriteFrame ends the frame with a newline that is not part of the body
+	var newline [1]byte
+	if _, err := io.ReadFull(body, newline[:]); err != nil || newline[0] != '\n' {
+		return nil, fmt.Errorf("malformed streamed response frame")
+	}
+	return io.NopCloser(body), nil
+}
+
+// chunkedBody reads a body sent as BodyChunk frames
+type chunkedBody struct {
+	decoder *json.Decoder
+	buf     []byte
+	trailer map[string]string
+	done    bool
+}
+
+func (b *chunkedBody) Read(p []byte) (int, error) {
+	for len(b.buf) == 0 {
+		if b.done {
+			return 0, io.EOF
+		}
+		var chunk BodyChunk
+		if err := b.decoder.Decode(&chunk); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, fmt.Errorf("failed to decode body chunk: %w", err)
+		}
+		if chunk.End {
+			b.trailer, b.done = chunk.Trailers, true
+		}
+		b.buf = chunk.Data
+	}
+	n := copy(p, b.buf)
+	b.buf = b.buf[n:]
+	return n, nil
+}
+
+func (b *chunkedBody) Close() error { return nil }
+
+// trailers returns the trailers of the last chunk, nil before it was read
+func (b *chunkedBody) trailers() map[string]string {
+	return b.trailer
+}
+
+// WriteChunkedBody writes a body as BodyChunk frames, each as it is read, then
+// the end chunk with the trailers, which trailer returns once body is read. It
+// returns the number of body bytes written.
+func WriteChunkedBody(w io.Writer, body io.Reader, trailer func() map[string]string) (int64, error) {
+	var written int64
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if werr := WriteFrame(w, &BodyChunk{Data: buf[:n]}); werr != nil {
+				return written, werr
+			}
+			written += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+	end := &BodyChunk{End: true}
+	if trailer != nil {
+		end.Trailers = trailer()
+	}
+	return written, WriteFrame(w, end)
+}
+
 // WriteFrame writes a JSON-encoded frame to a writer (yamux stream)
 func WriteFrame[T any](w io.Writer, frame *T) error {
 	encoder := json.NewEncoder(w)
@@ -108,16 +296,30 @@ func (a *AuthRequest) Validate() error {
 	subdomains := make(map[string]bool)
 	primaryCount := 0
 	for i, f := range a.Forwards {
-		if f.Subdomain == "" {
-			return fmt.Errorf("forward %d: subdomain is required", i)
-		}
 		if f.LocalPort <= 0 || f.LocalPort > 65535 {
 			return fmt.Errorf("forward %d: invalid port %d", i, f.LocalPort)
 		}
+		if subdomains[f.Subdomain] && f.Subdomain == "" {
+			// The server assigns the default subdomain to a single forward
+			return fmt.Errorf("forward %d: only one forward may leave the subdomain empty", i)
+		}
 		if subdomains[f.Subdomain] {
 			return fmt.Errorf("forward %d: duplicate subdomain %s", i, f.Subdomain)
 		}
 		subdomains[f.Subdomain] = true
+		prefixes := make(map[string]bool)
+		for j, r := range f.Routes {
+			if !strings.HasPrefix(r.Prefix, "/") {
+				return fmt.Errorf("forward %d route %d: prefix must start with /", i, j)
+			}
+			if r.LocalPort <= 0 || r.LocalPort > 65535 {
+				return fmt.Errorf("forward %d route %d: invalid port %d", i, j, r.LocalPort)
+			}
+			if prefixes[r.Prefix] {
+				return fmt.Errorf("forward %d route %d: duplicate prefix %s", i, j, r.Prefix)
+			}
+			prefixes[r.Prefix] = true
+		}
 		if f.Primary {
 			primaryCount++
 		}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/yamux"
@@ -33,6 +34,8 @@ type Session struct {
 	appID     string
 	createdAt time.Time
 	mu        sync.RWMutex
+	acks      atomic.Bool // Set once the client has acknowledged a request
+	degraded  atomic.Bool // Set while the client reports its local services are down
 }
 
 // NewServerSession creates a new server-side session from an incoming connection
@@ -118,6 +121,26 @@ func (s *Session) GetAccountInfo() (accountID, orgID, appID string) {
 	return s.accountID, s.orgID, s.appID
 }
 
+// SetAcknowledgesRequests records that the client acknowledges requests it receives
+func (s *Session) SetAcknowledgesRequests() {
+	s.acks.Store(true)
+}
+
+// AcknowledgesRequests reports whether the client has been seen acknowledging requests
+func (s *Session) AcknowledgesRequests() bool {
+	return s.acks.Load()
+}
+
+// SetDegraded records whether the client's local services are down
+func (s *Session) SetDegraded(degraded bool) {
+	s.degraded.Store(degraded)
+}
+
+// Degraded reports whether the client's local services are down
+func (s *Session) Degraded() bool {
+	return s.degraded.Load()
+}
+
 // CreatedAt returns when the session was created
 func (s *Session) CreatedAt() time.Time {
 	return s.createdAt
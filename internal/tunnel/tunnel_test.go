@@ -1,6 +1,7 @@
 package tunnel
 
 import (
+	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
@@ -107,8 +108,19 @@ func TestAuthRequestValidation(t *testing.T) {
 					{Subdomain: "", LocalPort: 3000},
 				},
 			},
+			wantErr: false,
+		},
+		{
+			name: "two empty subdomains",
+			req: AuthRequest{
+				Token: "test-token",
+				Forwards: []ForwardConfig{
+					{Subdomain: "", LocalPort: 3000},
+					{Subdomain: "", LocalPort: 3001},
+				},
+			},
 			wantErr: true,
-			errMsg:  "subdomain is required",
+			errMsg:  "only one forward may leave the subdomain empty",
 		},
 		{
 			name: "invalid port zero",
@@ -156,6 +168,46 @@ func TestAuthRequestValidation(t *testing.T) {
 			wantErr: true,
 			errMsg:  "only one forward can be marked as primary",
 		},
+		{
+			name: "valid path routes",
+			req: AuthRequest{
+				Token: "test-token",
+				Forwards: []ForwardConfig{
+					{Subdomain: "myapp", LocalPort: 3000, Routes: []PathRoute{
+						{Prefix: "/api", LocalPort: 8080},
+						{Prefix: "/admin", LocalPort: 9000, LocalHTTPS: true},
+					}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "route prefix without slash",
+			req: AuthRequest{
+				Token: "test-token",
+				Forwards: []ForwardConfig{
+					{Subdomain: "myapp", LocalPort: 3000, Routes: []PathRoute{
+						{Prefix: "api", LocalPort: 8080},
+					}},
+				},
+			},
+			wantErr: true,
+			errMsg:  "prefix must start with /",
+		},
+		{
+			name: "duplicate route prefix",
+			req: AuthRequest{
+				Token: "test-token",
+				Forwards: []ForwardConfig{
+					{Subdomain: "myapp", LocalPort: 3000, Routes: []PathRoute{
+						{Prefix: "/api", LocalPort: 8080},
+						{Prefix: "/api", LocalPort: 8081},
+					}},
+				},
+			},
+			wantErr: true,
+			errMsg:  "duplicate prefix",
+		},
 	}
 
 	for _, tt := range tests {
@@ -707,3 +759,77 @@ func TestFrameReadWrite(t *testing.T) {
 		t.Errorf("unexpected body: %s", req.Body)
 	}
 }
+
+func TestReadResponseFrameWithAck(t *testing.T) {
+	reader, writer := io.Pipe()
+
+	// Both frames in a single write, so the decoder buffers the response while reading the ack
+	go func() {
+		defer writer.Close()
+		var buf bytes.Buffer
+		WriteFrame(&buf, &ResponseFrame{ID: "test-123", Ack: true})
+		WriteFrame(&buf, &ResponseFrame{ID: "test-123", Status: 200, Body: []byte("ok")})
+		writer.Write(buf.Bytes())
+	}()
+
+	resp, acked, err := ReadResponseFrame(reader)
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if !acked {
+		t.Error("expected acknowledgement to be reported")
+	}
+	if resp.Status != 200 || string(resp.Body) != "ok" {
+		t.Errorf("unexpected response: %d %q", resp.Status, resp.Body)
+	}
+
+	// Without a response after the ack, the ack is still reported
+	reader, writer = io.Pipe()
+	go func() {
+		WriteFrame(writer, &ResponseFrame{ID: "test-456", Ack: true})
+		writer.Close()
+	}()
+	if _, acked, err := ReadResponseFrame(reader); err == nil || !acked {
+		t.Errorf("ReadResponseFrame() = (acked %v, err %v), want acked with error", acked, err)
+	}
+}
+
+func TestReadResponseFrameWithTrailers(t *testing.T) {
+	var buf bytes.Buffer
+	WriteFrame(&buf, &ResponseFrame{ID: "test-123", Ack: true})
+	WriteFrame(&buf, &ResponseFrame{ID: "test-123", Status: 200, Stream: true, Trailers: true})
+	body := io.MultiReader(bytes.NewReader([]byte("first,")), bytes.NewReader([]byte("second")))
+	n, err := WriteChunkedBody(&buf, body, func() map[string]string {
+		return map[string]string{"Grpc-Status": "0"}
+	})
+	if err != nil || n != int64(len("first,second")) {
+		t.Fatalf("WriteChunkedBody() = %d, %v", n, err)
+	}
+
+	resp, _, err := ReadResponseFrame(&buf)
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if resp.Trailer() != nil {
+		t.Error("trailers reported before the body was read")
+	}
+	data, err := io.ReadAll(resp.BodyStream)
+	if err != nil || string(data) != "first,second" {
+		t.Errorf("body = %q, %v, want first,second", data, err)
+	}
+	if got := resp.Trailer()["Grpc-Status"]; got != "0" {
+		t.Errorf("Grpc-Status trailer = %q, want 0", got)
+	}
+
+	// A body cut off before its end chunk is an error, not a complete body
+	buf.Reset()
+	WriteFrame(&buf, &ResponseFrame{ID: "test-456", Status: 200, Stream: true, Trailers: true})
+	WriteFrame(&buf, &BodyChunk{Data: []byte("partial")})
+	resp, _, err = ReadResponseFrame(&buf)
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if _, err := io.ReadAll(resp.BodyStream); err == nil {
+		t.Error("expected an error for a body without its end chunk")
+	}
+}
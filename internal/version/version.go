@@ -0,0 +1,67 @@
+// Package version holds the build version of the server and client binaries
+package version
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Version is set at build time:
+// go build -ldflags "-X github.com/niekvdm/digit-link/internal/version.Version=v1.2.3"
+var Version = "dev"
+
+// Compare compares two versions like v1.2.3: -1 if a is older than b, 0 if
+// they are equal and 1 if a is newer. The leading v and trailing components
+// are optional; a pre-release (v1.2.3-rc.1) is older than its release.
+// ok is false when either is not such a version, e.g. "dev".
+func Compare(a, b string) (cmp int, ok bool) {
+	va, preA, okA := parse(a)
+	vb, preB, okB := parse(b)
+	if !okA || !okB {
+		return 0, false
+	}
+	for i := range va {
+		if va[i] != vb[i] {
+			if va[i] < vb[i] {
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	switch {
+	case preA && !preB:
+		return -1, true
+	case !preA && preB:
+		return 1, true
+	}
+	return 0, true
+}
+
+// Valid reports whether v is a version Compare understands
+func Valid(v string) bool {
+	_, _, ok := parse(v)
+	return ok
+}
+
+// parse splits a version into major, minor and patch and whether it is a pre-release
+func parse(v string) (parts [3]int, prerelease bool, ok bool) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexByte(v, '+'); i >= 0 {
+		v = v[:i] // Build metadata doesn't order versions
+	}
+	if i := strings.IndexByte(v, '-'); i >= 0 {
+		v, prerelease = v[:i], true
+	}
+	fields := strings.Split(v, ".")
+	if len(fields) > 3 {
+		return parts, false, false
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return parts, false, false
+		}
+		parts[i] = n
+	}
+	return parts, prerelease, true
+}
@@ -0,0 +1,22 @@
+package version
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		cmp  int
+		ok   bool
+	}{
+		{"v1.2.3", "v1.2.3", 0, true},
+		{"v1.2.3", "1.10.0", -1, true},
+		{"v2", "v1.9.9", 1, true},
+		{"v1.3.0-rc.1", "v1.3.0", -1, true},
+		{"v1.3.0+build.5", "v1.3.0", 0, true},
+		{"dev", "v1.0.0", 0, false},
+	} {
+		if cmp, ok := Compare(tt.a, tt.b); cmp != tt.cmp || ok != tt.ok {
+			t.Errorf("Compare(%q, %q) = %d, %v, want %d, %v", tt.a, tt.b, cmp, ok, tt.cmp, tt.ok)
+		}
+	}
+}